@@ -0,0 +1,264 @@
+// Package admin 提供通过 unix 套接字访问的管理控制台
+// 运维人员无需在程序中链接命令行工具，即可查看和调整无界面节点的运行状态。
+// 每个连接按行发送 JSON 编码的 Request，服务端按行返回 JSON 编码的 Response。
+package admin
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	rtdebug "runtime/debug"
+	"sort"
+	"sync"
+
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/sirupsen/logrus"
+)
+
+// maxRequestSize 单个请求的最大字节数
+const maxRequestSize = 64 << 10
+
+// Command 处理一条管理命令
+// 参数：
+//   - args: []string 命令参数
+//
+// 返回值：
+//   - interface{}: 命令结果，编码为 JSON 返回
+//   - error: 命令失败时返回错误信息
+type Command func(args []string) (interface{}, error)
+
+// Request 管理命令请求
+type Request struct {
+	Token   string   `json:"token"`   // 访问令牌
+	Command string   `json:"command"` // 命令名称
+	Args    []string `json:"args"`    // 命令参数
+}
+
+// Response 管理命令响应
+type Response struct {
+	OK     bool            `json:"ok"`               // 命令是否成功
+	Result json.RawMessage `json:"result,omitempty"` // 命令结果
+	Error  string          `json:"error,omitempty"`  // 失败原因
+}
+
+// Server 管理控制台服务端
+type Server struct {
+	token string // 访问令牌
+
+	mu       sync.RWMutex
+	commands map[string]Command    // 命令名称到处理函数的映射
+	listener net.Listener          // 正在监听的套接字
+	path     string                // 套接字文件路径
+	conns    map[net.Conn]struct{} // 正在处理的连接
+	wg       sync.WaitGroup
+}
+
+// NewServer 创建管理控制台服务端
+// 参数：
+//   - token: string 访问令牌，请求携带的令牌不一致时拒绝执行
+//
+// 返回值：
+//   - *Server: 管理控制台服务端
+func NewServer(token string) *Server {
+	s := &Server{
+		token:    token,
+		commands: make(map[string]Command),
+		conns:    make(map[net.Conn]struct{}),
+	}
+	s.Handle("help", func(args []string) (interface{}, error) {
+		return s.Commands(), nil
+	})
+	return s
+}
+
+// Handle 注册管理命令，同名命令会被替换
+// 参数：
+//   - name: string 命令名称
+//   - cmd: Command 命令处理函数
+func (s *Server) Handle(name string, cmd Command) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands[name] = cmd
+}
+
+// Commands 列出已注册的命令名称
+func (s *Server) Commands() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.commands))
+	for name := range s.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Listen 在 unix 套接字上开始接受连接
+// 遗留的套接字文件会被替换，新套接字仅允许当前用户访问
+// 参数：
+//   - path: string 套接字文件路径
+//
+// 返回值：
+//   - error: 监听失败时返回错误信息
+func (s *Server) Listen(path string) error {
+	if s.token == "" {
+		return fmt.Errorf("%w: 管理控制台的访问令牌不能为空", errs.ErrInvalidArgument)
+	}
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("%w: %s 已存在且不是套接字", errs.ErrInvalidArgument, path)
+		}
+		os.Remove(path)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return err
+	}
+
+	s.mu.Lock()
+	s.listener, s.path = listener, path
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.serve(listener)
+	return nil
+}
+
+// Close 停止接受连接并删除套接字文件
+func (s *Server) Close() error {
+	s.mu.Lock()
+	listener, path := s.listener, s.path
+	s.listener = nil
+	if listener != nil {
+		// 关闭空闲的连接，使处理协程退出
+		for conn := range s.conns {
+			conn.Close()
+		}
+	}
+	s.mu.Unlock()
+	if listener == nil {
+		return nil
+	}
+
+	err := listener.Close()
+	s.wg.Wait()
+	os.Remove(path)
+	return err
+}
+
+// serve 接受连接直到套接字关闭
+func (s *Server) serve(listener net.Listener) {
+	defer s.wg.Done()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+			}
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn 逐行处理连接上的请求
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxRequestSize)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		if err := encoder.Encode(s.execute(scanner.Bytes())); err != nil {
+			return
+		}
+	}
+}
+
+// execute 验证令牌并执行一条请求
+func (s *Server) execute(line []byte) *Response {
+	var req Request
+	if err := json.Unmarshal(line, &req); err != nil {
+		return &Response{Error: fmt.Sprintf("请求格式错误: %v", err)}
+	}
+	if subtle.ConstantTimeCompare([]byte(req.Token), []byte(s.token)) != 1 {
+		logrus.Warnf("[%s]管理控制台拒绝了令牌无效的请求: %s", debug.WhereAmI(), req.Command)
+		return &Response{Error: errs.ErrUnauthorized.Error()}
+	}
+
+	s.mu.RLock()
+	cmd, ok := s.commands[req.Command]
+	s.mu.RUnlock()
+	if !ok {
+		return &Response{Error: fmt.Sprintf("未知命令: %s", req.Command)}
+	}
+
+	result, err := run(req.Command, cmd, req.Args)
+	if err != nil {
+		return &Response{Error: err.Error()}
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return &Response{Error: fmt.Sprintf("编码命令结果失败: %v", err)}
+	}
+	return &Response{OK: true, Result: data}
+}
+
+// run 执行命令，命令崩溃时返回错误而不使节点退出
+func run(name string, cmd Command, args []string) (result interface{}, err error) {
+	defer func() {
+		if value := recover(); value != nil {
+			logrus.Errorf("[%s]管理控制台命令 %s 崩溃: %v\n%s", debug.WhereAmI(), name, value, rtdebug.Stack())
+			err = fmt.Errorf("命令 %s 崩溃: %v", name, value)
+		}
+	}()
+	return cmd(args)
+}
+
+// Call 连接管理控制台并执行一条命令
+// 参数：
+//   - path: string 套接字文件路径
+//   - token: string 访问令牌
+//   - command: string 命令名称
+//   - args: ...string 命令参数
+//
+// 返回值：
+//   - *Response: 命令响应
+//   - error: 连接或通信失败时返回错误信息
+func Call(path, token, command string, args ...string) (*Response, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(&Request{Token: token, Command: command, Args: args}); err != nil {
+		return nil, err
+	}
+	res := new(Response)
+	if err := json.NewDecoder(conn).Decode(res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
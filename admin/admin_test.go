@@ -0,0 +1,77 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bpfs/defs/errs"
+)
+
+func TestServer(t *testing.T) {
+	// unix 套接字路径有长度限制，不使用 t.TempDir
+	dir, err := os.MkdirTemp("", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "admin.sock")
+
+	if err := NewServer("").Listen(path); !errors.Is(err, errs.ErrInvalidArgument) {
+		t.Fatalf("令牌为空时应拒绝监听, 实际 %v", err)
+	}
+
+	const token = "0123456789abcdef"
+	server := NewServer(token)
+	server.Handle("echo", func(args []string) (interface{}, error) {
+		return args, nil
+	})
+	server.Handle("panic", func(args []string) (interface{}, error) {
+		panic("boom")
+	})
+	if err := server.Listen(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("套接字应仅允许当前用户访问: %v %v", info, err)
+	}
+
+	res, err := Call(path, "wrong", "echo", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.OK || res.Error != errs.ErrUnauthorized.Error() {
+		t.Fatalf("令牌无效的请求应被拒绝: %+v", res)
+	}
+
+	res, err = Call(path, token, "echo", "a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var args []string
+	if !res.OK || json.Unmarshal(res.Result, &args) != nil || len(args) != 2 || args[1] != "b" {
+		t.Fatalf("命令结果不符: %+v", res)
+	}
+
+	if res, _ = Call(path, token, "missing"); res.OK {
+		t.Fatal("未知命令应返回错误")
+	}
+
+	// 命令崩溃时返回错误，连接与服务端继续可用
+	if res, err = Call(path, token, "panic"); err != nil || res.OK {
+		t.Fatalf("崩溃的命令应返回错误: %+v %v", res, err)
+	}
+	if res, err = Call(path, token, "echo"); err != nil || !res.OK {
+		t.Fatalf("命令崩溃后服务端应继续可用: %+v %v", res, err)
+	}
+
+	if err := server.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("关闭后应删除套接字文件")
+	}
+}
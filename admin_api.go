@@ -0,0 +1,154 @@
+package defs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bpfs/defs/admin"
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/peermode"
+	"github.com/sirupsen/logrus"
+)
+
+// adminSettings 可通过管理控制台在运行时修改的选项
+var adminSettings = map[string]struct {
+	get func(opt *opts.Options) bool
+	set func(opt *opts.Options, v bool)
+}{
+	"readonly":         {(*opts.Options).GetReadOnly, (*opts.Options).BuildReadOnly},
+	"dryrun":           {(*opts.Options).GetDryRun, (*opts.Options).BuildDryRun},
+	"compress-uploads": {(*opts.Options).GetCompressUploads, (*opts.Options).BuildCompressUploads},
+	"delta-manifests":  {(*opts.Options).GetDeltaManifests, (*opts.Options).BuildDeltaManifests},
+}
+
+// ServeAdmin 在 unix 套接字上启动管理控制台
+// 支持的命令：tasks、peers、versions、workers、streams、gc、config [set <名称> <值>]、loglevel [级别 | 模块=级别 ... | reset]、help
+// 参数：
+//   - config: *opts.AdminConfig 监听参数
+//
+// 返回值：
+//   - error: 监听失败时返回错误信息
+func (fs *FS) ServeAdmin(config *opts.AdminConfig) error {
+	if fs.admin != nil {
+		return fmt.Errorf("%w: 管理控制台已启动", errs.ErrInvalidArgument)
+	}
+
+	server := admin.NewServer(config.Token)
+	server.Handle("tasks", fs.adminTasks)
+	server.Handle("peers", fs.adminPeers)
+	server.Handle("versions", func(args []string) (interface{}, error) {
+		return fs.PeerVersions(), nil
+	})
+	server.Handle("workers", func(args []string) (interface{}, error) {
+		return map[string]interface{}{
+			"workers": fs.Workers(),
+			"crashes": fs.CrashHistory(),
+		}, nil
+	})
+	server.Handle("streams", func(args []string) (interface{}, error) {
+		return fs.Connections(), nil
+	})
+	server.Handle("gc", fs.adminGC)
+	server.Handle("config", fs.adminConfig)
+	server.Handle("loglevel", adminLogLevel)
+
+	if err := server.Listen(config.Socket); err != nil {
+		return err
+	}
+	fs.admin = server
+	return nil
+}
+
+// CloseAdmin 关闭管理控制台
+func (fs *FS) CloseAdmin() error {
+	if fs.admin == nil {
+		return nil
+	}
+	err := fs.admin.Close()
+	fs.admin = nil
+	return err
+}
+
+// adminTasks 列出上传任务的状态统计与下载任务的摘要
+func (fs *FS) adminTasks(args []string) (interface{}, error) {
+	return map[string]interface{}{
+		"upload":   fs.upload.TaskStatusCounts(),
+		"download": fs.download.ListDownloads(),
+	}, nil
+}
+
+// adminPeers 列出各模式路由表中的节点
+func (fs *FS) adminPeers(args []string) (interface{}, error) {
+	peers := make(map[string][]string)
+	for mode, name := range map[int]string{peermode.ModeClient: "client", peermode.ModeServer: "server"} {
+		table := fs.p2p.RoutingTable(mode)
+		if table == nil {
+			continue
+		}
+		for _, p := range table.ListPeers() {
+			peers[name] = append(peers[name], p.String())
+		}
+	}
+	return peers, nil
+}
+
+// adminGC 回收遗留的下载临时空间并删除已到期的存储承诺收据
+func (fs *FS) adminGC(args []string) (interface{}, error) {
+	result := map[string]int{
+		"tempFiles": fs.download.SweepTempSpace(fs.opt, fs.afe, fs.p2p.Host().ID()),
+	}
+	receipts, err := fs.PruneReceipts()
+	if err != nil {
+		return nil, err
+	}
+	result["receipts"] = len(receipts)
+	return result, nil
+}
+
+// adminConfig 查看或修改运行时选项
+func (fs *FS) adminConfig(args []string) (interface{}, error) {
+	if len(args) == 0 {
+		values := make(map[string]bool, len(adminSettings))
+		for name, setting := range adminSettings {
+			values[name] = setting.get(fs.opt)
+		}
+		return values, nil
+	}
+
+	if len(args) != 3 || args[0] != "set" {
+		return nil, fmt.Errorf("%w: 用法 config set <名称> <值>", errs.ErrInvalidArgument)
+	}
+	setting, ok := adminSettings[args[1]]
+	if !ok {
+		return nil, fmt.Errorf("%w: 不支持修改的选项 %s", errs.ErrInvalidArgument, args[1])
+	}
+	v, err := strconv.ParseBool(args[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s 的值必须为布尔值", errs.ErrInvalidArgument, args[1])
+	}
+	setting.set(fs.opt, v)
+	logrus.Infof("管理控制台将选项 %s 设置为 %v", args[1], v)
+	return map[string]bool{args[1]: v}, nil
+}
+
+// adminLogLevel 查看或修改日志级别
+// 参数形如 "debug" 或 "uploads=debug kbucket=warn"，"reset" 清除所有模块级别
+func adminLogLevel(args []string) (interface{}, error) {
+	if len(args) == 1 && args[0] == "reset" {
+		debug.ResetModuleLevels()
+	} else if len(args) > 0 {
+		if err := debug.ParseLogLevels(strings.Join(args, ",")); err != nil {
+			return nil, fmt.Errorf("%w: %v", errs.ErrInvalidArgument, err)
+		}
+	}
+
+	level, modules := debug.LogLevels()
+	result := map[string]string{"default": level.String()}
+	for module, l := range modules {
+		result[module] = l.String()
+	}
+	return result, nil
+}
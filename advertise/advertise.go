@@ -0,0 +1,269 @@
+// Package advertise 控制本节点向其他节点通告的地址
+// 处于多网卡、NAT 或容器网络中的节点，默认会通告全部监听地址，其中不可达的地址浪费对方的拨号尝试。
+// Advertiser 按策略筛选并排序通告的地址：显式指定的公网地址在前，其余地址按网卡顺序与 IP 版本偏好排列。
+// 构建主机时通过 libp2p.AddrsFactory(advertiser.Factory) 传入；策略可在运行时修改，修改后通过 Refresh 通知主机重新通告
+package advertise
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/bpfs/defs/errs"
+	"github.com/libp2p/go-libp2p/core/host"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// Policy 地址通告策略，零值通告全部监听地址
+type Policy struct {
+	Public      []string // 显式指定的公网地址(multiaddr)，按顺序最先通告，用于端口映射等无法自动发现的场景
+	Interfaces  []string // 允许通告的网卡名称，按优先级排列；为空时不按网卡筛选
+	PreferIPv6  bool     // IPv6 地址排在 IPv4 地址之前
+	DisableIPv4 bool     // 不通告 IPv4 地址
+	DisableIPv6 bool     // 不通告 IPv6 地址
+	NoLoopback  bool     // 不通告回环地址
+	NoPrivate   bool     // 不通告私有网络与链路本地地址
+	DenyCIDRs   []string // 不通告的 IP 段
+}
+
+// compiled 解析后的策略
+type compiled struct {
+	policy     Policy
+	public     []ma.Multiaddr
+	interfaces map[string]int // 网卡名称到优先级的映射
+	deny       []*net.IPNet
+}
+
+// compile 解析策略
+// 返回值：
+//   - error: 地址或 IP 段无效时返回包装了 errs.ErrInvalidArgument 的错误
+func compile(p Policy) (*compiled, error) {
+	if p.DisableIPv4 && p.DisableIPv6 && len(p.Public) == 0 {
+		return nil, fmt.Errorf("%w: 不可同时禁用 IPv4 与 IPv6 地址", errs.ErrInvalidArgument)
+	}
+	c := &compiled{policy: p, interfaces: make(map[string]int)}
+	for _, s := range p.Public {
+		addr, err := ma.NewMultiaddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: 无效的公网地址 %s", errs.ErrInvalidArgument, s)
+		}
+		c.public = append(c.public, addr)
+	}
+	for i, name := range p.Interfaces {
+		if _, ok := c.interfaces[name]; !ok {
+			c.interfaces[name] = i
+		}
+	}
+	for _, cidr := range p.DenyCIDRs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: 无效的 IP 段 %s", errs.ErrInvalidArgument, cidr)
+		}
+		c.deny = append(c.deny, ipNet)
+	}
+	return c, nil
+}
+
+// InterfaceLookup 返回本机各 IP 所属的网卡名称，键为 net.IP.String()
+type InterfaceLookup func() map[string]string
+
+// systemInterfaces 读取本机网卡的地址
+func systemInterfaces() map[string]string {
+	result := make(map[string]string)
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return result
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				result[ipNet.IP.String()] = iface.Name
+			}
+		}
+	}
+	return result
+}
+
+// Advertiser 地址通告控制
+// 零值不可用，通过 NewAdvertiser 创建；nil 接收者通告全部监听地址
+type Advertiser struct {
+	mu     sync.RWMutex
+	c      *compiled
+	lookup InterfaceLookup // 查询 IP 所属的网卡
+	hosts  []host.Host     // 通过 Attach 关联的主机，策略变化时通知重新通告
+}
+
+// NewAdvertiser 创建通告全部监听地址的地址通告控制
+func NewAdvertiser() *Advertiser {
+	c, _ := compile(Policy{})
+	return &Advertiser{c: c, lookup: systemInterfaces}
+}
+
+// SetInterfaceLookup 替换查询 IP 所属网卡的方式，用于测试或自定义网络环境
+func (a *Advertiser) SetInterfaceLookup(lookup InterfaceLookup) {
+	if a == nil || lookup == nil {
+		return
+	}
+	a.mu.Lock()
+	a.lookup = lookup
+	a.mu.Unlock()
+}
+
+// Policy 获取当前策略
+func (a *Advertiser) Policy() Policy {
+	if a == nil {
+		return Policy{}
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	p := a.c.policy
+	p.Public = append([]string(nil), p.Public...)
+	p.Interfaces = append([]string(nil), p.Interfaces...)
+	p.DenyCIDRs = append([]string(nil), p.DenyCIDRs...)
+	return p
+}
+
+// SetPolicy 替换策略，并通知关联的主机重新通告地址
+// 参数：
+//   - policy: Policy 新的策略
+//
+// 返回值：
+//   - error: 策略无效时返回包装了 errs.ErrInvalidArgument 的错误
+func (a *Advertiser) SetPolicy(policy Policy) error {
+	if a == nil {
+		return nil
+	}
+	c, err := compile(policy)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.c = c
+	hosts := append([]host.Host(nil), a.hosts...)
+	a.mu.Unlock()
+
+	for _, h := range hosts {
+		refresh(h)
+	}
+	return nil
+}
+
+// Attach 关联构建时传入了 Factory 的主机，策略变化时通知其重新通告地址
+func (a *Advertiser) Attach(h host.Host) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	a.hosts = append(a.hosts, h)
+	a.mu.Unlock()
+}
+
+// refresh 通知主机地址已变化
+func refresh(h host.Host) {
+	if s, ok := h.(interface{ SignalAddressChange() }); ok {
+		s.SignalAddressChange()
+	}
+}
+
+// candidate 待排序的地址
+type candidate struct {
+	addr  ma.Multiaddr
+	group int // 0: 公网地址，1: 有 IP 的地址，2: 没有 IP 的地址(如中继地址)
+	iface int // 网卡优先级
+	ipv6  bool
+	order int // 原始顺序
+}
+
+// Factory 按策略筛选并排序监听地址，实现 libp2p 的 AddrsFactory
+// 参数：
+//   - addrs: []ma.Multiaddr 主机的监听地址
+//
+// 返回值：
+//   - []ma.Multiaddr: 通告的地址
+func (a *Advertiser) Factory(addrs []ma.Multiaddr) []ma.Multiaddr {
+	if a == nil {
+		return addrs
+	}
+	a.mu.RLock()
+	c, lookup := a.c, a.lookup
+	a.mu.RUnlock()
+
+	var ifaces map[string]string
+	if len(c.interfaces) > 0 && lookup != nil {
+		ifaces = lookup()
+	}
+
+	var candidates []candidate
+	for _, addr := range c.public {
+		candidates = append(candidates, candidate{addr: addr, group: 0, order: len(candidates)})
+	}
+	for _, addr := range addrs {
+		ip, err := manet.ToIP(addr)
+		if err != nil || ip == nil {
+			candidates = append(candidates, candidate{addr: addr, group: 2, order: len(candidates)})
+			continue
+		}
+		ipv6 := ip.To4() == nil
+		switch {
+		case ipv6 && c.policy.DisableIPv6, !ipv6 && c.policy.DisableIPv4:
+			continue
+		case c.policy.NoLoopback && ip.IsLoopback():
+			continue
+		case c.policy.NoPrivate && (ip.IsPrivate() || ip.IsLinkLocalUnicast()):
+			continue
+		case contains(c.deny, ip):
+			continue
+		}
+
+		iface := 0
+		if len(c.interfaces) > 0 {
+			// 未指定网卡(0.0.0.0 或 ::)的监听地址已由主机展开为各网卡的地址，这里只处理具体地址
+			rank, ok := c.interfaces[ifaces[ip.String()]]
+			if !ok {
+				continue
+			}
+			iface = rank
+		}
+		candidates = append(candidates, candidate{addr: addr, group: 1, iface: iface, ipv6: ipv6, order: len(candidates)})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		x, y := candidates[i], candidates[j]
+		if x.group != y.group {
+			return x.group < y.group
+		}
+		if x.iface != y.iface {
+			return x.iface < y.iface
+		}
+		if x.ipv6 != y.ipv6 {
+			return x.ipv6 == c.policy.PreferIPv6
+		}
+		return x.order < y.order
+	})
+
+	result := make([]ma.Multiaddr, 0, len(candidates))
+	seen := make(map[string]bool)
+	for _, cand := range candidates {
+		if key := string(cand.addr.Bytes()); !seen[key] {
+			seen[key] = true
+			result = append(result, cand.addr)
+		}
+	}
+	return result
+}
+
+// contains 判断 IP 是否属于任一 IP 段
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
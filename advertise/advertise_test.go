@@ -0,0 +1,100 @@
+package advertise
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/bpfs/defs/errs"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func addrs(t *testing.T, ss ...string) []ma.Multiaddr {
+	t.Helper()
+	var result []ma.Multiaddr
+	for _, s := range ss {
+		result = append(result, ma.StringCast(s))
+	}
+	return result
+}
+
+func strs(addrs []ma.Multiaddr) []string {
+	result := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		result = append(result, addr.String())
+	}
+	return result
+}
+
+func TestFactory(t *testing.T) {
+	listen := addrs(t,
+		"/ip4/127.0.0.1/tcp/4001",
+		"/ip4/192.168.1.10/tcp/4001",
+		"/ip4/10.8.0.2/tcp/4001",
+		"/ip6/::1/tcp/4001",
+		"/ip6/2001:db8::10/tcp/4001",
+		"/p2p-circuit",
+	)
+	lookup := func() map[string]string {
+		return map[string]string{
+			"127.0.0.1":    "lo",
+			"::1":          "lo",
+			"192.168.1.10": "eth0",
+			"2001:db8::10": "eth0",
+			"10.8.0.2":     "wg0",
+		}
+	}
+
+	tests := []struct {
+		name   string
+		policy Policy
+		want   []string
+	}{
+		{"零值通告全部地址", Policy{}, strs(listen)},
+		{
+			"公网地址在前且不通告回环地址",
+			Policy{Public: []string{"/ip4/203.0.113.7/tcp/4001"}, NoLoopback: true},
+			[]string{"/ip4/203.0.113.7/tcp/4001", "/ip4/192.168.1.10/tcp/4001", "/ip4/10.8.0.2/tcp/4001", "/ip6/2001:db8::10/tcp/4001", "/p2p-circuit"},
+		},
+		{
+			"按网卡顺序并优先 IPv6",
+			Policy{Interfaces: []string{"wg0", "eth0"}, PreferIPv6: true},
+			[]string{"/ip4/10.8.0.2/tcp/4001", "/ip6/2001:db8::10/tcp/4001", "/ip4/192.168.1.10/tcp/4001", "/p2p-circuit"},
+		},
+		{
+			"禁用 IPv6 并排除私有地址",
+			Policy{DisableIPv6: true, NoPrivate: true, DenyCIDRs: []string{"127.0.0.0/8"}},
+			[]string{"/p2p-circuit"},
+		},
+	}
+
+	for _, tt := range tests {
+		a := NewAdvertiser()
+		a.SetInterfaceLookup(lookup)
+		if err := a.SetPolicy(tt.policy); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := strs(a.Factory(listen)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\n got %v\nwant %v", tt.name, got, tt.want)
+		}
+	}
+
+	// nil 接收者通告全部地址
+	var a *Advertiser
+	if got := a.Factory(listen); len(got) != len(listen) {
+		t.Fatalf("nil advertiser returned %d addrs", len(got))
+	}
+}
+
+func TestSetPolicyInvalid(t *testing.T) {
+	a := NewAdvertiser()
+	for _, p := range []Policy{
+		{Public: []string{"not-an-addr"}},
+		{DenyCIDRs: []string{"10.0.0.0"}},
+		{DisableIPv4: true, DisableIPv6: true},
+	} {
+		if err := a.SetPolicy(p); !errors.Is(err, errs.ErrInvalidArgument) {
+			t.Errorf("SetPolicy(%+v) = %v, want ErrInvalidArgument", p, err)
+		}
+	}
+}
@@ -185,6 +185,46 @@ func WriteFile(fs Afero, filename string, data []byte, perm os.FileMode) error {
 	return err // 返回错误信息
 }
 
+// WriteFileAtomic 将数据写入指定名称的文件，写入中断时保留原有内容
+// 参数：
+//   - fs: Afero 文件系统
+//   - filename: string 文件名
+//   - data: []byte 数据
+//   - perm: os.FileMode 文件权限
+//
+// 返回值：
+//   - error: 错误信息
+func WriteFileAtomic(fs Afero, filename string, data []byte, perm os.FileMode) error {
+	// 先写入同目录下唯一命名的临时文件并刷盘，再重命名覆盖目标文件，
+	// 避免写入中断损坏文件，也避免并发写入者共用同一个临时文件
+	f, err := TempFile(fs, filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		logrus.Errorf("[%s]创建临时文件失败: %v", debug.WhereAmI(), err)
+		return err
+	}
+	tempFilename := f.Name()
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = fs.Chmod(tempFilename, perm)
+	}
+	if err != nil {
+		fs.Remove(tempFilename) // 清理临时文件
+		logrus.Errorf("[%s]写入临时文件失败: %v", debug.WhereAmI(), err)
+		return err
+	}
+	if err := fs.Rename(tempFilename, filename); err != nil {
+		fs.Remove(tempFilename) // 清理临时文件
+		logrus.Errorf("[%s]重命名文件失败: %v", debug.WhereAmI(), err)
+		return err
+	}
+	return nil
+}
+
 // 随机数状态，用于生成随机的临时文件名，确保临时文件名的唯一性
 var (
 	randNum uint32     // 随机数种子
@@ -0,0 +1,91 @@
+package defs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"time"
+
+	"github.com/bpfs/defs/downloads"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// approvalPollInterval 申请方查询下载申请状态的间隔
+const approvalPollInterval = 5 * time.Second
+
+// RestrictDownloads 设置文件是否受限，受限文件的下载申请需所有者批准
+// 受限文件随默认所有者签名的撤销列表发送给存储节点，存储节点只向持有限定其节点令牌的请求方提供片段
+// 参数：
+//   - fileID: string 文件唯一标识
+//   - restricted: bool 是否受限
+//
+// 返回值：
+//   - error: 只读模式下返回包装了 errs.ErrReadOnly 的错误，保存或发送失败时返回错误信息
+func (fs *FS) RestrictDownloads(fileID string, restricted bool) error {
+	if err := fs.opt.CheckWritable("设置受限文件"); err != nil {
+		return err
+	}
+	if err := fs.download.RestrictDownloads(fs.afe, fileID, restricted); err != nil {
+		return err
+	}
+	list, err := downloads.Restrict(fs.afe, fs.opt.GetDefaultOwnerPriv(), fileID, restricted)
+	if err != nil {
+		return err
+	}
+	return downloads.PublishRevocations(fs.p2p, fs.pub, list)
+}
+
+// PendingApprovals 获取等待批准的下载申请
+func (fs *FS) PendingApprovals() []downloads.ApprovalRequest {
+	return fs.download.PendingApprovals()
+}
+
+// ApprovalEvents 获取下载申请状态变化的通知通道
+func (fs *FS) ApprovalEvents() <-chan downloads.ApprovalRequest {
+	return fs.download.ApprovalEvents()
+}
+
+// Approve 批准下载申请，申请方随后使用签发的委托下载令牌下载文件
+// 参数：
+//   - requestID: string 申请的唯一标识
+//
+// 返回值：
+//   - error: 申请不存在、已处理或已失效时返回错误信息
+func (fs *FS) Approve(requestID string) error {
+	return fs.download.Approve(fs.opt, fs.afe, requestID, fs.opt.GetDefaultOwnerPriv())
+}
+
+// Deny 拒绝下载申请
+// 参数：
+//   - requestID: string 申请的唯一标识
+//
+// 返回值：
+//   - error: 申请不存在、已处理或已失效时返回错误信息
+func (fs *FS) Deny(requestID string) error {
+	return fs.download.Deny(requestID)
+}
+
+// DownloadWithApproval 向所有者节点申请下载受限文件，批准后开始下载
+// 参数：
+//   - ctx: context.Context 上下文，取消时停止等待或取消下载任务
+//   - owner: peer.ID 所有者节点
+//   - fileID: string 文件唯一标识
+//   - note: string 申请说明
+//   - delegatePriv: *ecdsa.PrivateKey 申请身份的私钥，为 nil 时使用默认所有者
+//
+// 返回值：
+//   - *downloads.DownloadSuccessInfo: 文件下载成功后的返回信息
+//   - error: 申请被拒绝或失效时返回包装了 errs.ErrUnauthorized 的错误
+func (fs *FS) DownloadWithApproval(ctx context.Context, owner peer.ID, fileID, note string, delegatePriv *ecdsa.PrivateKey) (*downloads.DownloadSuccessInfo, error) {
+	if delegatePriv == nil {
+		delegatePriv = fs.opt.GetDefaultOwnerPriv()
+	}
+	requestID, err := downloads.RequestApproval(ctx, fs.p2p, owner, fileID, &delegatePriv.PublicKey, note)
+	if err != nil {
+		return nil, err
+	}
+	token, err := downloads.AwaitApproval(ctx, fs.p2p, owner, requestID, approvalPollInterval)
+	if err != nil {
+		return nil, err
+	}
+	return fs.DownloadDelegatedContext(ctx, token, delegatePriv)
+}
@@ -0,0 +1,268 @@
+package defs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/index"
+	"github.com/bpfs/defs/uploads"
+	"github.com/bpfs/defs/wallets"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+)
+
+// Rename 重命名已上传的文件，无需删除后重新上传
+// 文件的元数据记录改用新文件名，所有者发布的指向文件的名称在原命名空间与目录内改用新文件名，只替换路径的最后一段，旧名称被释放；
+// 这些记录作为一个变更整体发布到索引节点，全部生效或全部不生效。变更发布成功后更新本地的完整性报告
+// 参数：
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥
+//   - indexPeer: peer.ID 索引节点
+//   - fileID: string 文件唯一标识
+//   - newName: string 新的文件名
+//
+// 返回值：
+//   - *index.Change: 已发布的变更
+//   - error: 文件没有任何记录时返回包装了 errs.ErrNotFound 的错误
+func (fs *FS) Rename(ownerPriv *ecdsa.PrivateKey, indexPeer peer.ID, fileID, newName string) (*index.Change, error) {
+	return fs.RenameContext(fs.ctx, ownerPriv, indexPeer, fileID, newName)
+}
+
+// RenameContext 重命名已上传的文件，ctx 结束时中止请求
+func (fs *FS) RenameContext(ctx context.Context, ownerPriv *ecdsa.PrivateKey, indexPeer peer.ID, fileID, newName string) (*index.Change, error) {
+	newName = strings.TrimSpace(newName)
+	if fileID == "" || newName == "" {
+		return nil, fmt.Errorf("%w: 文件唯一标识与新文件名不能为空", errs.ErrInvalidArgument)
+	}
+	owner, err := ownerOf(ownerPriv)
+	if err != nil {
+		return nil, err
+	}
+
+	change := &index.Change{FileID: fileID}
+
+	// 元数据记录改用新文件名，其余字段保持不变
+	records, err := index.SearchContext(ctx, fs.p2p, indexPeer, &index.Query{FileID: fileID, Owner: owner, Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) > 0 && records[0].Name != newName {
+		current := records[0]
+		change.Record, err = index.NewIndexRecord(ownerPriv, fileID, newName, current.Size, current.ContentType, current.Labels...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 名称在原命名空间与目录内改用新文件名，只替换路径的最后一段
+	if err := fs.moveNames(ctx, ownerPriv, indexPeer, change, owner, func(name *index.NameRecord) string {
+		if dir := path.Dir(name.Path); dir != "." {
+			return name.Namespace + "/" + dir + "/" + newName
+		}
+		return name.Namespace + "/" + newName
+	}); err != nil {
+		return nil, err
+	}
+
+	report, _ := uploads.LoadReport(fs.afe, fileID)
+	if report != nil && report.Owner != owner {
+		report = nil
+	}
+	if change.Record == nil && len(change.Names) == 0 && report == nil {
+		if len(records) == 0 {
+			return nil, fmt.Errorf("%w: 文件 %s", errs.ErrNotFound, fileID)
+		}
+		return change, nil
+	}
+
+	if change.Record != nil || len(change.Names) > 0 {
+		if err := fs.publishChange(ctx, indexPeer, change); err != nil {
+			return nil, err
+		}
+	}
+
+	// 更新本地保存的完整性报告
+	if report != nil && report.Name != newName {
+		report.Name = newName
+		if err := report.Sign(ownerPriv); err != nil {
+			return nil, err
+		}
+		if err := uploads.SaveReport(fs.afe, report); err != nil {
+			logrus.Errorf("[%s]更新文件 %s 的完整性报告失败: %v", debug.WhereAmI(), fileID, err)
+			return nil, err
+		}
+	}
+	return change, nil
+}
+
+// Move 将已上传的文件移动到另一个存储桶
+// 存储桶即名称的命名空间：所有者发布的指向文件的名称改到新的命名空间下，路径保持不变，旧名称被释放；
+// 文件还没有名称时以文件名作为路径加入存储桶。这些记录作为一个变更整体发布到索引节点，全部生效或全部不生效
+// 参数：
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥
+//   - indexPeer: peer.ID 索引节点
+//   - fileID: string 文件唯一标识
+//   - bucket: string 目标存储桶
+//
+// 返回值：
+//   - *index.Change: 已发布的变更
+//   - error: 文件没有任何记录时返回包装了 errs.ErrNotFound 的错误
+func (fs *FS) Move(ownerPriv *ecdsa.PrivateKey, indexPeer peer.ID, fileID, bucket string) (*index.Change, error) {
+	return fs.MoveContext(fs.ctx, ownerPriv, indexPeer, fileID, bucket)
+}
+
+// MoveContext 将已上传的文件移动到另一个存储桶，ctx 结束时中止请求
+func (fs *FS) MoveContext(ctx context.Context, ownerPriv *ecdsa.PrivateKey, indexPeer peer.ID, fileID, bucket string) (*index.Change, error) {
+	bucket = strings.TrimSpace(bucket)
+	if fileID == "" || bucket == "" || strings.Contains(bucket, "/") {
+		return nil, fmt.Errorf("%w: 文件唯一标识不能为空，存储桶不能为空或包含\"/\"", errs.ErrInvalidArgument)
+	}
+	owner, err := ownerOf(ownerPriv)
+	if err != nil {
+		return nil, err
+	}
+
+	change := &index.Change{FileID: fileID}
+	if err := fs.moveNames(ctx, ownerPriv, indexPeer, change, owner, func(name *index.NameRecord) string {
+		return bucket + "/" + name.Path
+	}); err != nil {
+		return nil, err
+	}
+
+	// 文件还没有名称时以文件名加入存储桶
+	if len(change.Names) == 0 {
+		names, err := index.NamesOfContext(ctx, fs.p2p, indexPeer, fileID)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			if name.Owner == owner && name.Namespace == bucket {
+				// 已在目标存储桶中
+				return change, nil
+			}
+		}
+
+		fileName := ""
+		if report, err := uploads.LoadReport(fs.afe, fileID); err == nil && report.Owner == owner {
+			fileName = report.Name
+		} else if records, err := index.SearchContext(ctx, fs.p2p, indexPeer, &index.Query{FileID: fileID, Owner: owner, Limit: 1}); err == nil && len(records) > 0 {
+			fileName = records[0].Name
+		}
+		if fileName == "" {
+			return nil, fmt.Errorf("%w: 文件 %s", errs.ErrNotFound, fileID)
+		}
+
+		name := bucket + "/" + fileName
+		version, err := fs.nextNameVersion(ctx, indexPeer, name, fileID, owner)
+		if err != nil {
+			return nil, err
+		}
+		record, err := index.NewNameRecord(ownerPriv, name, fileID, version)
+		if err != nil {
+			return nil, err
+		}
+		change.Names = append(change.Names, record)
+	}
+
+	if err := fs.publishChange(ctx, indexPeer, change); err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// publishChange 将变更发布到索引节点，并在本地索引中整体采纳，
+// 通过 OnAssetChange 注册的回调对每次重命名或移动只收到一次通知
+func (fs *FS) publishChange(ctx context.Context, indexPeer peer.ID, change *index.Change) error {
+	if err := index.PublishChangeContext(ctx, fs.p2p, indexPeer, change); err != nil {
+		return err
+	}
+	fs.index.ApplyChange(change)
+	return nil
+}
+
+// OnAssetChange 注册文件变更的处理回调
+// 重命名或移动文件时，元数据记录与名称记录作为一个变更整体采纳，回调对每个变更只调用一次；
+// 本节点发起的变更与从其他节点复制来的变更都会通知
+// 参数：
+//   - handler: index.ChangeHandler 变更的处理回调
+func (fs *FS) OnAssetChange(handler index.ChangeHandler) {
+	fs.index.OnChange(handler)
+}
+
+// moveNames 将所有者发布的指向文件的名称改为 target 返回的新名称，并释放旧名称
+func (fs *FS) moveNames(ctx context.Context, ownerPriv *ecdsa.PrivateKey, indexPeer peer.ID, change *index.Change, owner string, target func(name *index.NameRecord) string) error {
+	names, err := index.NamesOfContext(ctx, fs.p2p, indexPeer, change.FileID)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for _, old := range names {
+		if old.Owner != owner {
+			continue
+		}
+		newName := target(old)
+		if newName == old.Name() {
+			continue
+		}
+		if _, _, err := index.ParseName(newName); err != nil {
+			return fmt.Errorf("%w: %v", errs.ErrInvalidArgument, err)
+		}
+
+		// 多个旧名称可能对应同一个新名称，新名称只发布一次
+		if !seen[newName] {
+			seen[newName] = true
+			version, err := fs.nextNameVersion(ctx, indexPeer, newName, change.FileID, owner)
+			if err != nil {
+				return err
+			}
+			record, err := index.NewNameRecord(ownerPriv, newName, change.FileID, version)
+			if err != nil {
+				return err
+			}
+			change.Names = append(change.Names, record)
+		}
+
+		// 释放旧名称
+		released, err := index.NewNameRecord(ownerPriv, old.Name(), "", old.Version+1)
+		if err != nil {
+			return err
+		}
+		change.Names = append(change.Names, released)
+	}
+	return nil
+}
+
+// nextNameVersion 获取发布名称时使用的版本号
+// 名称已指向其他文件时返回错误，不会覆盖其他文件的名称
+func (fs *FS) nextNameVersion(ctx context.Context, indexPeer peer.ID, name, fileID, owner string) (uint64, error) {
+	existing, err := index.ResolveNameContext(ctx, fs.p2p, indexPeer, name)
+	switch {
+	case errors.Is(err, errs.ErrNotFound):
+		return 1, nil
+	case err != nil:
+		return 0, err
+	case existing.Owner != owner || (!existing.Released() && existing.FileID != fileID):
+		return 0, fmt.Errorf("%w: 名称 %s 已指向其他文件", errs.ErrInvalidArgument, name)
+	default:
+		return existing.Version + 1, nil
+	}
+}
+
+// ownerOf 获取所有者公钥哈希的十六进制字符串
+func ownerOf(ownerPriv *ecdsa.PrivateKey) (string, error) {
+	if ownerPriv == nil {
+		return "", fmt.Errorf("%w: 所有者私钥不能为空", errs.ErrInvalidArgument)
+	}
+	pubKeyHash, ok := wallets.PrivateKeyToPublicKeyHash(ownerPriv)
+	if !ok {
+		return "", fmt.Errorf("通过私钥生成公钥哈希时失败")
+	}
+	return hex.EncodeToString(pubKeyHash), nil
+}
@@ -0,0 +1,56 @@
+package defs
+
+import (
+	"context"
+	"crypto/ecdsa"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/downloads"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/uploads"
+	"github.com/bpfs/dep2p"
+	"github.com/bpfs/dep2p/kbucket"
+	"github.com/bpfs/dep2p/pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Uploader 应用程序发起与管理上传任务所用的接口
+// fs.Upload() 返回的 *uploads.UploadManager 实现此接口，测试时可改用 defstest 包中的模拟实现
+type Uploader interface {
+	NewUpload(opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, pubsub *pubsub.DeP2PPubSub, path string, ownerPriv *ecdsa.PrivateKey) (*uploads.UploadSuccessInfo, error)
+	NewUploadContext(ctx context.Context, opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, pubsub *pubsub.DeP2PPubSub, path string, ownerPriv *ecdsa.PrivateKey) (*uploads.UploadSuccessInfo, error)
+	PauseUpload(taskID string) error
+	PauseUploadContext(ctx context.Context, taskID string) error
+	ContinueUpload(taskID string) error
+	ContinueUploadContext(ctx context.Context, taskID string) error
+	CancelUpload(taskID string) error
+	CancelUploadContext(ctx context.Context, taskID string) error
+	UploadDetailContext(ctx context.Context, taskID string) (*uploads.UploadDetail, error)
+	ListUploadDetailsContext(ctx context.Context) ([]*uploads.UploadDetail, error)
+}
+
+// Downloader 应用程序发起与管理下载任务所用的接口
+// fs.Download() 返回的 *downloads.DownloadManager 实现此接口，测试时可改用 defstest 包中的模拟实现
+type Downloader interface {
+	NewDownload(opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, pubsub *pubsub.DeP2PPubSub, fileID string, ownerPriv *ecdsa.PrivateKey, segmentNodes ...map[int][]peer.ID) (*downloads.DownloadSuccessInfo, error)
+	NewDownloadContext(ctx context.Context, opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, pubsub *pubsub.DeP2PPubSub, fileID string, ownerPriv *ecdsa.PrivateKey, segmentNodes ...map[int][]peer.ID) (*downloads.DownloadSuccessInfo, error)
+	PauseDownload(taskID string) error
+	PauseDownloadContext(ctx context.Context, taskID string) error
+	ContinueDownload(taskID string) error
+	ContinueDownloadContext(ctx context.Context, taskID string) error
+	CancelDownload(taskID string) error
+	CancelDownloadContext(ctx context.Context, taskID string) error
+	ListDownloadsContext(ctx context.Context) ([]*downloads.DownloadSummary, error)
+}
+
+// Router 应用程序查看路由表所用的接口
+// fs.P2P() 返回的 *dep2p.DeP2P 实现此接口，测试时可改用 defstest 包中的模拟实现
+type Router interface {
+	RoutingTable(mode int) *kbucket.RoutingTable
+}
+
+var (
+	_ Uploader   = (*uploads.UploadManager)(nil)
+	_ Downloader = (*downloads.DownloadManager)(nil)
+	_ Router     = (*dep2p.DeP2P)(nil)
+)
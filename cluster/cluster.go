@@ -0,0 +1,331 @@
+// Package cluster 将多个进程组成一个逻辑存储节点
+// 任一成员接收的文件片段按片段唯一标识分布到各成员，元数据主节点记录各片段所在的成员
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/network"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/defs/supervise"
+	"github.com/bpfs/defs/util"
+	"github.com/bpfs/dep2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+)
+
+// saveInterval 主节点保存片段位置的间隔
+const saveInterval = time.Minute
+
+// Cluster 集群成员的运行状态
+// 未设置集群配置时 Enabled 返回 false，其余方法不应被调用
+type Cluster struct {
+	ctx    context.Context    // 上下文用于管理协程的生命周期
+	cancel context.CancelFunc // 取消函数
+	mu     sync.RWMutex       // 用于保护片段位置的读写锁
+
+	opt    *opts.Options       // 文件存储选项配置
+	afe    afero.Afero         // 文件系统接口
+	p2p    *dep2p.DeP2P        // 网络主机
+	config *opts.ClusterConfig // 集群配置
+	self   peer.ID             // 本节点的ID
+
+	locations map[string]map[string]peer.ID // 主节点记录的片段位置，第一层键为文件唯一标识，第二层为片段唯一标识
+	dirty     bool                          // 片段位置是否有未保存的变更
+}
+
+type NewClusterInput struct {
+	fx.In
+	LC         fx.Lifecycle
+	Ctx        context.Context       // 全局上下文
+	Opt        *opts.Options         // 文件存储选项配置
+	Afe        afero.Afero           // 文件系统接口
+	P2P        *dep2p.DeP2P          // 网络主机
+	Supervisor *supervise.Supervisor // 后台任务的崩溃恢复
+}
+
+type NewClusterOutput struct {
+	fx.Out
+	Cluster *Cluster // 集群
+}
+
+// NewCluster 创建并初始化一个新的 Cluster 实例
+// 本节点不在集群成员中时视为未启用集群
+// 参数：
+//   - input: NewClusterInput 用于初始化 Cluster 的输入结构体。
+//
+// 返回值：
+//   - NewClusterOutput: 包含 Cluster 的输出结构体。
+func NewCluster(input NewClusterInput) (out NewClusterOutput) {
+	c := newCluster(input.Ctx, input.Opt, input.Afe, input.P2P, input.P2P.Host().ID())
+	out.Cluster = c
+	if !c.Enabled() {
+		return out
+	}
+
+	filePath := filepath.Join(paths.GetDBDir(), "cluster-"+c.config.Name)
+	if c.IsLeader() {
+		if err := c.load(filePath); err != nil && !os.IsNotExist(err) {
+			logrus.Warnf("[%s]加载集群片段位置失败: %v", debug.WhereAmI(), err)
+		}
+	}
+
+	// 后台任务崩溃时保存集群状态
+	input.Supervisor.OnCrash("cluster", func() {
+		if c.IsLeader() {
+			if err := c.save(filePath); err != nil {
+				logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+			}
+		}
+	})
+
+	input.LC.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			c.registerProtocol()
+			if c.IsLeader() {
+				input.Supervisor.Go("cluster", "periodic-save", func() { c.periodicSave(filePath) })
+			}
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			c.cancel()
+			if c.IsLeader() {
+				return c.save(filePath)
+			}
+			return nil
+		},
+	})
+	return out
+}
+
+// newCluster 创建集群成员的运行状态
+func newCluster(ctx context.Context, opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, self peer.ID) *Cluster {
+	ctx, cancel := context.WithCancel(ctx)
+	c := &Cluster{
+		ctx:       ctx,
+		cancel:    cancel,
+		opt:       opt,
+		afe:       afe,
+		p2p:       p2p,
+		self:      self,
+		locations: make(map[string]map[string]peer.ID),
+	}
+	if config := opt.GetCluster(); config.Has(self) {
+		c.config = config
+	}
+	return c
+}
+
+// Enabled 检查本节点是否作为集群成员运行
+func (c *Cluster) Enabled() bool {
+	return c != nil && c.config != nil
+}
+
+// IsLeader 检查本节点是否为元数据主节点
+func (c *Cluster) IsLeader() bool {
+	return c.Enabled() && c.config.Leader == c.self
+}
+
+// Owner 获取负责存储片段的成员
+// 使用最高随机权重(rendezvous)哈希，成员增减时只有少量片段改变归属
+// 参数：
+//   - segmentID: string 文件片段的唯一标识
+//
+// 返回值：
+//   - peer.ID: 负责存储片段的成员
+func (c *Cluster) Owner(segmentID string) peer.ID {
+	var owner peer.ID
+	var best []byte
+	for _, member := range c.config.Members {
+		h := sha256.New()
+		h.Write([]byte(member))
+		h.Write([]byte(segmentID))
+		score := h.Sum(nil)
+		if best == nil || bytes.Compare(score, best) > 0 {
+			owner, best = member, score
+		}
+	}
+	return owner
+}
+
+// Store 将本节点接收的文件片段存储到负责的成员
+// 负责的成员不可达时存储在本节点，保证片段不会丢失
+// 参数：
+//   - ctx: context.Context 上下文
+//   - fileID: string 文件唯一标识
+//   - segmentID: string 文件片段的唯一标识
+//   - data: []byte 文件片段的内容
+//
+// 返回值：
+//   - peer.ID: 实际存储片段的成员
+//   - error: 本节点写入失败时返回错误
+func (c *Cluster) Store(ctx context.Context, fileID, segmentID string, data []byte) (peer.ID, error) {
+	if owner := c.Owner(segmentID); owner != c.self {
+		err := c.forward(ctx, owner, &StoreReq{FileID: fileID, SegmentID: segmentID, SliceByte: data})
+		if err == nil {
+			return owner, nil
+		}
+		logrus.Warnf("[%s]转发文件片段 %s 到成员 %s 失败，存储在本节点: %v", debug.WhereAmI(), segmentID, owner, err)
+	}
+
+	if err := c.writeLocal(fileID, segmentID, data); err != nil {
+		return "", err
+	}
+	return c.self, nil
+}
+
+// writeLocal 将片段写入本节点并报告给主节点
+func (c *Cluster) writeLocal(fileID, segmentID string, data []byte) error {
+	subDir := filepath.Join(paths.GetSlicePath(), c.self.String(), fileID)
+	if err := util.Write(c.opt, c.afe, subDir, segmentID, data); err != nil {
+		return err
+	}
+	c.opt.GetCounters().AddStored(int64(len(data)))
+	c.record(fileID, map[string]peer.ID{segmentID: c.self})
+	return nil
+}
+
+// record 向主节点报告片段位置，失败时仅记录日志，主节点仍可通过哈希推算位置
+func (c *Cluster) record(fileID string, segments map[string]peer.ID) {
+	if c.IsLeader() {
+		c.put(fileID, segments)
+		return
+	}
+
+	go func() {
+		req := &RecordReq{FileID: fileID, Segments: segments}
+		res, err := network.SendStreamContext(c.ctx, c.p2p, StreamClusterRecordProtocol, "", c.config.Leader, req)
+		if err := checkResponse(c.config.Leader, StreamClusterRecordProtocol, res, err); err != nil {
+			logrus.Warnf("[%s]向主节点报告片段位置失败: %v", debug.WhereAmI(), err)
+		}
+	}()
+}
+
+// put 记录片段位置
+func (c *Cluster) put(fileID string, segments map[string]peer.ID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	file := c.locations[fileID]
+	if file == nil {
+		file = make(map[string]peer.ID, len(segments))
+		c.locations[fileID] = file
+	}
+	for segmentID, member := range segments {
+		file[segmentID] = member
+	}
+	c.dirty = true
+}
+
+// Locate 获取文件各片段所在的成员
+// 参数：
+//   - ctx: context.Context 上下文
+//   - fileID: string 文件唯一标识
+//
+// 返回值：
+//   - map[string]peer.ID: 片段唯一标识与所在成员的映射
+//   - error: 主节点没有该文件的记录时返回包装了 errs.ErrNotFound 的错误
+func (c *Cluster) Locate(ctx context.Context, fileID string) (map[string]peer.ID, error) {
+	if c.IsLeader() {
+		return c.lookup(fileID)
+	}
+
+	res, err := network.SendStreamContext(ctx, c.p2p, StreamClusterLocateProtocol, "", c.config.Leader, &LocateReq{FileID: fileID})
+	if err := checkResponse(c.config.Leader, StreamClusterLocateProtocol, res, err); err != nil {
+		if res != nil && res.Code == 404 {
+			return nil, fmt.Errorf("%w: 文件 %s: %w", errs.ErrNotFound, fileID, err)
+		}
+		return nil, err
+	}
+
+	segments := make(map[string]peer.ID)
+	if err := util.DecodeFromBytes(res.Data, &segments); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return nil, err
+	}
+	return segments, nil
+}
+
+// lookup 从主节点的记录中获取文件各片段所在的成员
+func (c *Cluster) lookup(fileID string) (map[string]peer.ID, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	file, ok := c.locations[fileID]
+	if !ok {
+		return nil, fmt.Errorf("%w: 文件 %s", errs.ErrNotFound, fileID)
+	}
+	segments := make(map[string]peer.ID, len(file))
+	for segmentID, member := range file {
+		segments[segmentID] = member
+	}
+	return segments, nil
+}
+
+// periodicSave 定时保存片段位置
+func (c *Cluster) periodicSave(filePath string) {
+	ticker := time.NewTicker(saveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.save(filePath); err != nil {
+				logrus.Errorf("[%s]保存集群片段位置失败: %v", debug.WhereAmI(), err)
+			}
+		}
+	}
+}
+
+// save 保存有变更的片段位置
+func (c *Cluster) save(filePath string) error {
+	c.mu.Lock()
+	if !c.dirty {
+		c.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(c.locations)
+	c.dirty = false
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, data, 0644)
+}
+
+// load 加载片段位置
+func (c *Cluster) load(filePath string) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	locations := make(map[string]map[string]peer.ID)
+	if err := json.Unmarshal(data, &locations); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.locations = locations
+	c.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,105 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/paths"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+)
+
+func TestOwnerRendezvous(t *testing.T) {
+	members := []peer.ID{"node-a", "node-b", "node-c"}
+	opt := opts.DefaultOptions()
+	if err := opt.BuildCluster(&opts.ClusterConfig{Name: "c", Leader: "node-a", Members: members}); err != nil {
+		t.Fatal(err)
+	}
+	c := newCluster(context.Background(), opt, nil, nil, "node-a")
+	if !c.Enabled() || !c.IsLeader() {
+		t.Fatal("本节点应为集群主节点")
+	}
+
+	counts := make(map[peer.ID]int)
+	owners := make(map[string]peer.ID)
+	for i := 0; i < 3000; i++ {
+		segmentID := fmt.Sprintf("segment-%d", i)
+		owners[segmentID] = c.Owner(segmentID)
+		counts[owners[segmentID]]++
+	}
+	for _, member := range members {
+		if counts[member] < 800 || counts[member] > 1200 {
+			t.Fatalf("片段分布不均匀: %v", counts)
+		}
+	}
+
+	// 移除一个成员后，只有原本属于该成员的片段改变归属
+	c.config = &opts.ClusterConfig{Name: "c", Leader: "node-a", Members: members[:2]}
+	for segmentID, prev := range owners {
+		if prev != "node-c" && c.Owner(segmentID) != prev {
+			t.Fatalf("片段 %s 不应改变归属", segmentID)
+		}
+	}
+
+	other := newCluster(context.Background(), opt, nil, nil, "node-x")
+	if other.Enabled() {
+		t.Fatal("非成员节点不应启用集群")
+	}
+}
+
+func TestStoreAndLocate(t *testing.T) {
+	self := test.RandPeerIDFatal(t)
+	opt := opts.DefaultOptions()
+	if err := opt.BuildCluster(&opts.ClusterConfig{Name: "solo", Leader: self, Members: []peer.ID{self}}); err != nil {
+		t.Fatal(err)
+	}
+	afe := afero.NewMemMapFs()
+	c := newCluster(context.Background(), opt, afe, nil, self)
+
+	if _, err := c.Locate(context.Background(), "file-1"); !errors.Is(err, errs.ErrNotFound) {
+		t.Fatalf("没有记录时应返回 ErrNotFound, 实际 %v", err)
+	}
+
+	member, err := c.Store(context.Background(), "file-1", "segment-1", []byte("data"))
+	if err != nil || member != self {
+		t.Fatalf("存储片段失败: %s, %v", member, err)
+	}
+	path := filepath.Join(paths.GetSlicePath(), self.String(), "file-1", "segment-1")
+	if ok, _ := afero.Exists(afe, path); !ok {
+		t.Fatal("片段应写入本节点")
+	}
+
+	segments, err := c.Locate(context.Background(), "file-1")
+	if err != nil || segments["segment-1"] != self {
+		t.Fatalf("片段位置不正确: %v, %v", segments, err)
+	}
+
+	// 主节点重启后从文件恢复片段位置
+	filePath := filepath.Join(t.TempDir(), "cluster")
+	if err := c.save(filePath); err != nil {
+		t.Fatal(err)
+	}
+	restored := newCluster(context.Background(), opt, afe, nil, self)
+	if err := restored.load(filePath); err != nil {
+		t.Fatal(err)
+	}
+	if segments, err := restored.Locate(context.Background(), "file-1"); err != nil || segments["segment-1"] != self {
+		t.Fatalf("恢复的片段位置不正确: %v, %v", segments, err)
+	}
+}
+
+func TestBuildClusterValidation(t *testing.T) {
+	opt := opts.DefaultOptions()
+	if err := opt.BuildCluster(&opts.ClusterConfig{Name: "c", Leader: "node-x", Members: []peer.ID{"node-a"}}); err == nil {
+		t.Fatal("主节点不是成员时应返回错误")
+	}
+	if err := opt.BuildCluster(&opts.ClusterConfig{Name: "c", Leader: "node-a", Members: []peer.ID{"node-a", "node-a"}}); err == nil {
+		t.Fatal("成员重复时应返回错误")
+	}
+}
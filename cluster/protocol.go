@@ -0,0 +1,150 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/network"
+	"github.com/bpfs/defs/util"
+	"github.com/bpfs/dep2p/streams"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/sirupsen/logrus"
+)
+
+const version = "1.0.0"
+
+var (
+	// 成员间转发文件片段
+	StreamClusterStoreProtocol = fmt.Sprintf("defs@stream/cluster/store/%s", version)
+
+	// 向主节点报告片段位置
+	StreamClusterRecordProtocol = fmt.Sprintf("defs@stream/cluster/record/%s", version)
+
+	// 向主节点查询片段位置
+	StreamClusterLocateProtocol = fmt.Sprintf("defs@stream/cluster/locate/%s", version)
+)
+
+// StoreReq 成员间转发文件片段的请求消息
+type StoreReq struct {
+	FileID    string // 文件唯一标识
+	SegmentID string // 文件片段的唯一标识
+	SliceByte []byte // 切片内容
+}
+
+// RecordReq 报告片段位置的请求消息
+type RecordReq struct {
+	FileID   string             // 文件唯一标识
+	Segments map[string]peer.ID // 片段唯一标识与所在成员的映射
+}
+
+// LocateReq 查询片段位置的请求消息
+type LocateReq struct {
+	FileID string // 文件唯一标识
+}
+
+// registerProtocol 注册成员间的流协议，主节点额外处理位置的报告与查询
+func (c *Cluster) registerProtocol() {
+	h := c.p2p.Host()
+	streams.RegisterStreamHandler(h, protocol.ID(StreamClusterStoreProtocol), network.HandlerWithLimits(StreamClusterStoreProtocol, network.HandlerWithRW(c.handleStore)))
+	network.RegisterReusableHandler(h, StreamClusterStoreProtocol, c.handleStore)
+
+	if c.IsLeader() {
+		streams.RegisterStreamHandler(h, protocol.ID(StreamClusterRecordProtocol), network.HandlerWithLimits(StreamClusterRecordProtocol, network.HandlerWithRW(c.handleRecord)))
+		streams.RegisterStreamHandler(h, protocol.ID(StreamClusterLocateProtocol), network.HandlerWithLimits(StreamClusterLocateProtocol, network.HandlerWithRW(c.handleLocate)))
+	}
+}
+
+// forward 将文件片段转发给负责存储的成员
+func (c *Cluster) forward(ctx context.Context, member peer.ID, req *StoreReq) error {
+	res, err := network.SendStreamContext(ctx, c.p2p, StreamClusterStoreProtocol, "", member, req)
+	return checkResponse(member, StreamClusterStoreProtocol, res, err)
+}
+
+// handleStore 处理其他成员转发的文件片段
+func (c *Cluster) handleStore(req *streams.RequestMessage, res *streams.ResponseMessage) (int32, string) {
+	if !c.fromMember(req) {
+		return 403, "非集群成员"
+	}
+	payload := new(StoreReq)
+	if err := util.DecodeFromBytes(req.Payload, payload); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return 6603, "解码错误"
+	}
+	if c.opt.GetReadOnly() {
+		return 6610, "只读节点不接受文件片段"
+	}
+
+	if err := c.writeLocal(payload.FileID, payload.SegmentID, payload.SliceByte); err != nil {
+		logrus.Errorf("[%s]存储转发的文件片段失败: %v", debug.WhereAmI(), err)
+		return 500, "存储接收内容失败"
+	}
+	return 200, "成功"
+}
+
+// handleRecord 处理成员报告的片段位置
+func (c *Cluster) handleRecord(req *streams.RequestMessage, res *streams.ResponseMessage) (int32, string) {
+	if !c.fromMember(req) {
+		return 403, "非集群成员"
+	}
+	payload := new(RecordReq)
+	if err := util.DecodeFromBytes(req.Payload, payload); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return 6603, "解码错误"
+	}
+
+	// 只接受集群成员作为片段位置
+	for segmentID, member := range payload.Segments {
+		if !c.config.Has(member) {
+			delete(payload.Segments, segmentID)
+		}
+	}
+	c.put(payload.FileID, payload.Segments)
+	return 200, "成功"
+}
+
+// handleLocate 处理成员查询片段位置
+func (c *Cluster) handleLocate(req *streams.RequestMessage, res *streams.ResponseMessage) (int32, string) {
+	if !c.fromMember(req) {
+		return 403, "非集群成员"
+	}
+	payload := new(LocateReq)
+	if err := util.DecodeFromBytes(req.Payload, payload); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return 6603, "解码错误"
+	}
+
+	segments, err := c.lookup(payload.FileID)
+	if err != nil {
+		return 404, "文件不存在"
+	}
+	data, err := util.EncodeToBytes(segments)
+	if err != nil {
+		return 6605, fmt.Sprintf("%s", err)
+	}
+	res.Data = data
+	return 200, "成功"
+}
+
+// fromMember 检查请求是否来自集群成员
+// 请求由 network.HandlerWithRW 处理，Sender 为流连接上经过认证的对方节点ID
+func (c *Cluster) fromMember(req *streams.RequestMessage) bool {
+	sender, err := peer.Decode(req.Message.GetSender())
+	return err == nil && c.config.Has(sender)
+}
+
+// checkResponse 检查响应，将失败转换为 errs.PeerError
+func checkResponse(receiver peer.ID, protocol string, res *streams.ResponseMessage, err error) error {
+	if err != nil {
+		return errs.Unreachable(receiver, protocol, err)
+	}
+	if res == nil {
+		return errs.Unreachable(receiver, protocol, nil)
+	}
+	if res.Code != 200 {
+		return errs.Rejected(receiver, protocol, res.Code, res.Msg)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package defs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bpfs/defs/errs"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ClusterLocate 查询文件各片段存储在哪个集群成员
+// 参数：
+//   - ctx: context.Context 上下文
+//   - fileID: string 文件唯一标识
+//
+// 返回值：
+//   - map[string]peer.ID: 片段唯一标识与所在成员的映射
+//   - error: 未启用集群时返回包装了 errs.ErrInvalidArgument 的错误，主节点没有记录时返回包装了 errs.ErrNotFound 的错误
+func (fs *FS) ClusterLocate(ctx context.Context, fileID string) (map[string]peer.ID, error) {
+	if !fs.cluster.Enabled() {
+		return nil, fmt.Errorf("%w: 未启用集群", errs.ErrInvalidArgument)
+	}
+	return fs.cluster.Locate(ctx, fileID)
+}
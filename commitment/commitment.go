@@ -0,0 +1,140 @@
+// Package commitment 实现了上传方与存储节点之间的存储承诺。
+// 存储节点在接收文件片段时签发收据，承诺在到期前保存该片段；
+// 上传方保存收据，在审计或发现数据缺失时出示收据，作为评价存储节点信誉的依据。
+package commitment
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Receipt 存储节点签发的存储承诺收据
+type Receipt struct {
+	FileID    string  // 文件唯一标识
+	SegmentID string  // 文件片段的唯一标识
+	Checksum  []byte  // 接收到的片段内容的 SHA-256 哈希
+	Size      int     // 片段内容的大小
+	Peer      peer.ID // 签发收据的存储节点
+	Uploader  peer.ID // 上传方节点
+	IssuedAt  int64   // 签发时间(Unix 秒)
+	ExpiresAt int64   // 承诺保存的截止时间(Unix 秒)
+	Signature []byte  // 存储节点的签名
+}
+
+// NewReceipt 存储节点为接收到的文件片段签发收据
+// 参数：
+//   - priv: crypto.PrivKey 存储节点的私钥
+//   - uploader: peer.ID 上传方节点
+//   - fileID: string 文件唯一标识
+//   - segmentID: string 文件片段的唯一标识
+//   - data: []byte 接收到的片段内容
+//   - expiresAt: int64 承诺保存的截止时间(Unix 秒)
+//
+// 返回值：
+//   - *Receipt: 签名后的收据
+//   - error: 如果发生错误，返回错误信息
+func NewReceipt(priv crypto.PrivKey, uploader peer.ID, fileID, segmentID string, data []byte, expiresAt int64) (*Receipt, error) {
+	id, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	r := &Receipt{
+		FileID:    fileID,
+		SegmentID: segmentID,
+		Checksum:  sum[:],
+		Size:      len(data),
+		Peer:      id,
+		Uploader:  uploader,
+		IssuedAt:  time.Now().Unix(),
+		ExpiresAt: expiresAt,
+	}
+
+	signingData, err := r.signingData()
+	if err != nil {
+		return nil, err
+	}
+	r.Signature, err = priv.Sign(signingData)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Verify 使用存储节点的公钥验证收据签名
+// 返回值：
+//   - error: 验证失败时返回错误信息
+func (r *Receipt) Verify() error {
+	pub, err := r.Peer.ExtractPublicKey()
+	if err != nil {
+		return fmt.Errorf("无法从节点 %s 提取公钥: %v", r.Peer, err)
+	}
+
+	signingData, err := r.signingData()
+	if err != nil {
+		return err
+	}
+	valid, err := pub.Verify(signingData, r.Signature)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return fmt.Errorf("收据签名无效")
+	}
+	if r.ExpiresAt < r.IssuedAt {
+		return fmt.Errorf("收据的截止时间早于签发时间")
+	}
+	return nil
+}
+
+// Matches 检查收据是否对应指定的存储节点、上传方、文件与片段内容
+// 参数：
+//   - node: peer.ID 接收片段的存储节点
+//   - uploader: peer.ID 上传方节点，即本节点
+//   - fileID: string 文件唯一标识
+//   - segmentID: string 文件片段的唯一标识
+//   - data: []byte 发送的片段内容
+//
+// 返回值：
+//   - error: 收据与发送的内容不一致时返回错误
+func (r *Receipt) Matches(node, uploader peer.ID, fileID, segmentID string, data []byte) error {
+	sum := sha256.Sum256(data)
+	switch {
+	case r.Peer != node:
+		return fmt.Errorf("收据签发节点 %s 与接收节点 %s 不一致", r.Peer, node)
+	case r.Uploader != uploader:
+		return fmt.Errorf("收据中的上传方 %s 与本节点 %s 不一致", r.Uploader, uploader)
+	case r.FileID != fileID:
+		return fmt.Errorf("收据中的文件 %s 与发送的文件 %s 不一致", r.FileID, fileID)
+	case r.SegmentID != segmentID:
+		return fmt.Errorf("收据中的片段 %s 与发送的片段 %s 不一致", r.SegmentID, segmentID)
+	case string(r.Checksum) != string(sum[:]) || r.Size != len(data):
+		return fmt.Errorf("收据中的片段内容与发送的内容不一致")
+	}
+	return nil
+}
+
+// Active 检查收据在指定时间是否仍在承诺期内
+func (r *Receipt) Active(now time.Time) bool {
+	return now.Unix() <= r.ExpiresAt
+}
+
+// signingData 返回收据中参与签名的字段
+// 与 util.MergeFieldsForSigning 的编码方式相同，opts 依赖本包，因此不能直接引用 util
+func (r *Receipt) signingData() ([]byte, error) {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	for _, field := range []interface{}{r.FileID, r.SegmentID, r.Checksum, r.Size, r.Peer.String(), r.Uploader.String(), r.IssuedAt, r.ExpiresAt} {
+		if err := enc.Encode(field); err != nil {
+			return nil, err
+		}
+	}
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,87 @@
+package commitment
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestReceipt(t *testing.T) {
+	priv, _, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, _ := peer.IDFromPrivateKey(priv)
+	uploaderPriv, _, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploader, _ := peer.IDFromPrivateKey(uploaderPriv)
+	data := []byte("segment content")
+
+	r, err := NewReceipt(priv, uploader, "file-1", "seg-1", data, time.Now().Add(time.Hour).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Verify(); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if err := r.Matches(node, uploader, "file-1", "seg-1", data); err != nil {
+		t.Fatalf("Matches: %v", err)
+	}
+	if err := r.Matches(node, uploader, "file-1", "seg-1", []byte("other")); err == nil {
+		t.Fatal("Matches accepted different content")
+	}
+	if err := r.Matches(node, uploader, "file-2", "seg-1", data); err == nil {
+		t.Fatal("Matches accepted a receipt for another file")
+	}
+	if err := r.Matches(node, node, "file-1", "seg-1", data); err == nil {
+		t.Fatal("Matches accepted a receipt issued to another uploader")
+	}
+
+	// 篡改截止时间后签名失效
+	tampered := *r
+	tampered.ExpiresAt += 3600
+	if err := tampered.Verify(); err == nil {
+		t.Fatal("Verify accepted a tampered receipt")
+	}
+
+	path := filepath.Join(t.TempDir(), "receipts")
+	store := NewStore()
+	if err := store.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add(r); err != nil {
+		t.Fatal(err)
+	}
+
+	var disputes []*Dispute
+	reloaded := NewStore()
+	if err := reloaded.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	reloaded.OnDispute(func(d *Dispute) { disputes = append(disputes, d) })
+	if got := reloaded.ForPeer(node); len(got) != 1 || got[0].SegmentID != "seg-1" {
+		t.Fatalf("ForPeer = %v", got)
+	}
+	if _, err := reloaded.Dispute(reloaded.ForFile("file-1")[0], "片段缺失"); err != nil {
+		t.Fatal(err)
+	}
+	if len(disputes) != 1 {
+		t.Fatalf("disputes = %d", len(disputes))
+	}
+
+	if !reloaded.Committed("file-1", "seg-1", time.Now()) || reloaded.Committed("file-1", "seg-2", time.Now()) || reloaded.Committed("file-1", "seg-1", time.Now().Add(2*time.Hour)) {
+		t.Fatal("Committed 的结果不符")
+	}
+
+	if expired := reloaded.Expired(time.Now().Add(2 * time.Hour)); len(expired) != 1 || len(reloaded.ForFile("file-1")) != 1 {
+		t.Fatalf("Expired = %v", expired)
+	}
+	if n, err := reloaded.Prune(time.Now().Add(2 * time.Hour)); err != nil || n != 1 || len(reloaded.ForFile("file-1")) != 0 {
+		t.Fatalf("Prune = %d, %v", n, err)
+	}
+}
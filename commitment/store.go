@@ -0,0 +1,271 @@
+package commitment
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+)
+
+// Dispute 上传方出示收据指出存储节点违反承诺
+type Dispute struct {
+	Receipt    *Receipt // 存储节点签发的收据
+	Reason     string   // 违约原因，如片段缺失或内容不一致
+	ReportedAt int64    // 提出争议的时间(Unix 秒)
+}
+
+// DisputeHandler 处理争议的回调，通常用于降低存储节点的信誉
+type DisputeHandler func(dispute *Dispute)
+
+// Store 保存的存储承诺收据
+// 上传方保存存储节点签发的收据，用于审计与争议；存储节点保存自己签发的收据，在承诺期内不清理对应的片段。
+// 零值不可用，通过 NewStore 创建；所有方法在 nil 接收者上均为空操作
+type Store struct {
+	mu       sync.RWMutex
+	receipts map[string][]*Receipt // 文件唯一标识到收据的映射
+	path     string                // 持久化文件路径，为空时不持久化
+	handlers []DisputeHandler      // 争议处理回调
+}
+
+// NewStore 创建一个空的收据存储
+func NewStore() *Store {
+	return &Store{receipts: make(map[string][]*Receipt)}
+}
+
+// Open 设置持久化文件路径并加载已保存的收据
+// 参数：
+//   - path: string 持久化文件路径
+//
+// 返回值：
+//   - error: 文件存在但解析失败时返回错误
+func (s *Store) Open(path string) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var receipts map[string][]*Receipt
+	if err := json.Unmarshal(data, &receipts); err != nil {
+		return err
+	}
+	for fileID, list := range receipts {
+		s.receipts[fileID] = append(s.receipts[fileID], list...)
+	}
+	return nil
+}
+
+// Add 保存一张已验证的收据，同一节点对同一片段的收据只保留截止时间最晚的一张
+// 参数：
+//   - r: *Receipt 存储节点签发的收据
+//
+// 返回值：
+//   - error: 保存失败时返回错误
+func (s *Store) Add(r *Receipt) error {
+	if s == nil || r == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	list := s.receipts[r.FileID]
+	replaced := false
+	for i, existing := range list {
+		if existing.Peer == r.Peer && existing.SegmentID == r.SegmentID {
+			if r.ExpiresAt > existing.ExpiresAt {
+				list[i] = r
+			}
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		s.receipts[r.FileID] = append(list, r)
+	}
+	s.mu.Unlock()
+
+	return s.save()
+}
+
+// ForFile 获取指定文件的所有收据
+func (s *Store) ForFile(fileID string) []*Receipt {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*Receipt(nil), s.receipts[fileID]...)
+}
+
+// Committed 检查文件片段在指定时间是否仍有未到期的承诺
+// 参数：
+//   - fileID: string 文件唯一标识
+//   - segmentID: string 文件片段的唯一标识
+//   - now: time.Time 当前时间
+//
+// 返回值：
+//   - bool: 存在未到期的收据时返回 true
+func (s *Store) Committed(fileID, segmentID string, now time.Time) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, r := range s.receipts[fileID] {
+		if r.SegmentID == segmentID && r.Active(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// ForPeer 获取指定存储节点签发的所有收据
+func (s *Store) ForPeer(id peer.ID) []*Receipt {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []*Receipt
+	for _, list := range s.receipts {
+		for _, r := range list {
+			if r.Peer == id {
+				result = append(result, r)
+			}
+		}
+	}
+	return result
+}
+
+// Expired 获取在指定时间之前已到期的收据，即 Prune 将要删除的收据
+// 返回值：
+//   - []*Receipt: 已到期的收据
+func (s *Store) Expired(now time.Time) []*Receipt {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var expired []*Receipt
+	for _, list := range s.receipts {
+		for _, r := range list {
+			if !r.Active(now) {
+				expired = append(expired, r)
+			}
+		}
+	}
+	return expired
+}
+
+// Prune 删除在指定时间之前已到期的收据
+// 返回值：
+//   - int: 删除的收据数量
+//   - error: 保存失败时返回错误
+func (s *Store) Prune(now time.Time) (int, error) {
+	if s == nil {
+		return 0, nil
+	}
+
+	s.mu.Lock()
+	removed := 0
+	for fileID, list := range s.receipts {
+		kept := list[:0]
+		for _, r := range list {
+			if r.Active(now) {
+				kept = append(kept, r)
+			} else {
+				removed++
+			}
+		}
+		if len(kept) == 0 {
+			delete(s.receipts, fileID)
+		} else {
+			s.receipts[fileID] = kept
+		}
+	}
+	s.mu.Unlock()
+
+	if removed > 0 {
+		if err := s.save(); err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// OnDispute 注册争议处理回调
+func (s *Store) OnDispute(handler DisputeHandler) {
+	if s == nil || handler == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers = append(s.handlers, handler)
+}
+
+// Dispute 出示收据指出存储节点违反承诺，并通知所有争议处理回调
+// 只有签名有效且仍在承诺期内的收据才能提出争议
+// 参数：
+//   - r: *Receipt 存储节点签发的收据
+//   - reason: string 违约原因
+//
+// 返回值：
+//   - *Dispute: 提出的争议
+//   - error: 收据无效或已到期时返回错误
+func (s *Store) Dispute(r *Receipt, reason string) (*Dispute, error) {
+	if err := r.Verify(); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if !r.Active(now) {
+		return nil, fmt.Errorf("收据已于 %s 到期", time.Unix(r.ExpiresAt, 0).Format(time.RFC3339))
+	}
+
+	dispute := &Dispute{Receipt: r, Reason: reason, ReportedAt: now.Unix()}
+	if s != nil {
+		s.mu.RLock()
+		handlers := append([]DisputeHandler(nil), s.handlers...)
+		s.mu.RUnlock()
+		for _, handler := range handlers {
+			handler(dispute)
+		}
+	}
+	return dispute, nil
+}
+
+// save 将收据保存到持久化文件
+// 返回值：
+//   - error: 写入失败时返回错误
+func (s *Store) save() error {
+	s.mu.RLock()
+	path := s.path
+	if path == "" {
+		s.mu.RUnlock()
+		return nil
+	}
+	data, err := json.Marshal(s.receipts)
+	s.mu.RUnlock()
+	if err != nil {
+		logrus.Errorf("[%s]序列化存储承诺收据失败: %v", debug.WhereAmI(), err)
+		return err
+	}
+
+	return afero.WriteFileAtomic(afero.NewOsFs(), path, data, 0644)
+}
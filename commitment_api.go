@@ -0,0 +1,69 @@
+package defs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bpfs/defs/commitment"
+	"github.com/bpfs/defs/debug"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+)
+
+// Receipts 获取存储节点为指定文件签发的存储承诺收据
+// 参数：
+//   - fileID: string 文件唯一标识
+//
+// 返回值：
+//   - []*commitment.Receipt: 存储承诺收据
+func (fs *FS) Receipts(fileID string) []*commitment.Receipt {
+	return fs.opt.GetReceipts().ForFile(fileID)
+}
+
+// DisputeSegment 出示收据指出存储节点未按承诺保存文件片段
+// 争议会通知通过 OnDispute 注册的回调，用于降低该节点的信誉
+// 参数：
+//   - fileID: string 文件唯一标识
+//   - segmentID: string 文件片段的唯一标识
+//   - node: peer.ID 违反承诺的存储节点
+//   - reason: string 违约原因
+//
+// 返回值：
+//   - *commitment.Dispute: 提出的争议
+//   - error: 没有有效的收据时返回错误
+func (fs *FS) DisputeSegment(fileID, segmentID string, node peer.ID, reason string) (*commitment.Dispute, error) {
+	for _, receipt := range fs.opt.GetReceipts().ForFile(fileID) {
+		if receipt.SegmentID == segmentID && receipt.Peer == node {
+			return fs.opt.GetReceipts().Dispute(receipt, reason)
+		}
+	}
+	return nil, fmt.Errorf("没有节点 %s 为文件片段 %s 签发的存储承诺收据", node, segmentID)
+}
+
+// PruneReceipts 删除已到期的存储承诺收据
+// 演练模式下只返回将要删除的收据，不修改任何数据
+// 返回值：
+//   - []*commitment.Receipt: 已删除或演练模式下将要删除的收据
+//   - error: 只读模式下返回包装了 errs.ErrReadOnly 的错误
+func (fs *FS) PruneReceipts() ([]*commitment.Receipt, error) {
+	now := time.Now()
+	expired := fs.opt.GetReceipts().Expired(now)
+	if fs.opt.GetDryRun() {
+		logrus.Infof("[%s]演练模式: 将删除 %d 条已到期的存储承诺收据", debug.WhereAmI(), len(expired))
+		return expired, nil
+	}
+	if err := fs.opt.CheckWritable("删除存储承诺收据"); err != nil {
+		return nil, err
+	}
+	if _, err := fs.opt.GetReceipts().Prune(now); err != nil {
+		return nil, err
+	}
+	return expired, nil
+}
+
+// OnDispute 注册争议处理回调
+// 参数：
+//   - handler: commitment.DisputeHandler 争议处理回调
+func (fs *FS) OnDispute(handler commitment.DisputeHandler) {
+	fs.opt.GetReceipts().OnDispute(handler)
+}
@@ -0,0 +1,66 @@
+package defs
+
+import (
+	"github.com/bpfs/defs/advertise"
+	"github.com/bpfs/defs/gate"
+	"github.com/bpfs/defs/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Connections 列出本节点正在进行传输的协议流
+// 返回值：
+//   - []network.StreamInfo: 各流的对方节点、协议、方向、已传输字节数及持续时间
+func (fs *FS) Connections() []network.StreamInfo {
+	return network.ActiveStreams()
+}
+
+// CloseStream 中止指定的协议流，用于在不重启节点的情况下结束异常的传输
+// 参数：
+//   - id: uint64 Connections 返回的流编号
+//
+// 返回值：
+//   - error: 流不存在或已结束时返回包装了 errs.ErrNotFound 的错误
+func (fs *FS) CloseStream(id uint64) error {
+	return network.CloseStream(id)
+}
+
+// ConnectionPolicy 获取连接限制策略
+func (fs *FS) ConnectionPolicy() gate.Policy {
+	return fs.opt.GetGater().Policy()
+}
+
+// SetConnectionPolicy 替换连接限制策略，策略被保存，已建立的不允许的连接随即断开
+// 参数：
+//   - policy: gate.Policy 新的策略
+//
+// 返回值：
+//   - error: 策略无效时返回包装了 errs.ErrInvalidArgument 的错误，保存失败时返回写入错误
+func (fs *FS) SetConnectionPolicy(policy gate.Policy) error {
+	return fs.opt.GetGater().SetPolicy(policy)
+}
+
+// AllowPeer 将节点加入连接允许名单
+func (fs *FS) AllowPeer(p peer.ID) error {
+	return fs.opt.GetGater().AllowPeer(p)
+}
+
+// DenyPeer 将节点加入连接拒绝名单，并断开与其已建立的连接
+func (fs *FS) DenyPeer(p peer.ID) error {
+	return fs.opt.GetGater().DenyPeer(p)
+}
+
+// AddressPolicy 获取通告地址的策略
+func (fs *FS) AddressPolicy() advertise.Policy {
+	return fs.opt.GetAdvertiser().Policy()
+}
+
+// SetAddressPolicy 替换通告地址的策略，主机随即重新通告地址
+// 仅对构建时传入了 libp2p.AddrsFactory(opt.GetAdvertiser().Factory) 的主机生效
+// 参数：
+//   - policy: advertise.Policy 新的策略
+//
+// 返回值：
+//   - error: 策略无效时返回包装了 errs.ErrInvalidArgument 的错误
+func (fs *FS) SetAddressPolicy(policy advertise.Policy) error {
+	return fs.opt.GetAdvertiser().SetPolicy(policy)
+}
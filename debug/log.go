@@ -0,0 +1,188 @@
+package debug
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 按模块过滤日志：每条日志按调用方所在包的最后一段路径(如 uploads、kbucket)归属到模块，
+// 设置了模块级别的日志按模块级别过滤，其余日志按默认级别过滤。
+// 全局日志器的级别取所有级别中最详细的一个，再由格式化器丢弃超出模块级别的日志。
+
+var logState = struct {
+	mu           sync.RWMutex
+	level        logrus.Level            // 默认级别
+	modules      map[string]logrus.Level // 模块名称到级别的映射
+	filter       *moduleFormatter        // 已安装的过滤格式化器
+	reportCaller bool                    // 安装前日志器是否已记录调用方
+}{
+	level:   logrus.GetLevel(),
+	modules: make(map[string]logrus.Level),
+}
+
+// SetLevel 设置默认日志级别，未单独设置级别的模块使用该级别
+// 参数：
+//   - level: logrus.Level 日志级别
+func SetLevel(level logrus.Level) {
+	logState.mu.Lock()
+	logState.level = level
+	logState.mu.Unlock()
+	applyLevels()
+}
+
+// SetModuleLevel 设置模块的日志级别
+// 参数：
+//   - module: string 模块名称，即包路径的最后一段，如 "uploads"、"kbucket"
+//   - level: logrus.Level 日志级别
+func SetModuleLevel(module string, level logrus.Level) {
+	logState.mu.Lock()
+	logState.modules[module] = level
+	logState.mu.Unlock()
+	applyLevels()
+}
+
+// ResetModuleLevels 清除所有模块的日志级别，全部日志按默认级别过滤
+func ResetModuleLevels() {
+	logState.mu.Lock()
+	logState.modules = make(map[string]logrus.Level)
+	logState.mu.Unlock()
+	applyLevels()
+}
+
+// LogLevels 获取默认日志级别与各模块的日志级别
+// 返回值：
+//   - logrus.Level: 默认日志级别
+//   - map[string]logrus.Level: 模块名称到级别的映射
+func LogLevels() (logrus.Level, map[string]logrus.Level) {
+	logState.mu.RLock()
+	defer logState.mu.RUnlock()
+	modules := make(map[string]logrus.Level, len(logState.modules))
+	for module, level := range logState.modules {
+		modules[module] = level
+	}
+	return logState.level, modules
+}
+
+// ParseLogLevels 解析形如 "info,uploads=debug,kbucket=warn" 的日志级别设置并应用
+// 不带模块名称的项设置默认级别
+// 参数：
+//   - spec: string 逗号分隔的日志级别设置
+//
+// 返回值：
+//   - error: 级别名称无效时返回错误，此时不修改任何级别
+func ParseLogLevels(spec string) error {
+	level, _ := LogLevels()
+	modules := make(map[string]logrus.Level)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		module, name, found := strings.Cut(item, "=")
+		if !found {
+			module, name = "", item
+		}
+		parsed, err := logrus.ParseLevel(strings.TrimSpace(name))
+		if err != nil {
+			return fmt.Errorf("无效的日志级别 %q: %w", item, err)
+		}
+		if module = strings.TrimSpace(module); module == "" {
+			level = parsed
+		} else {
+			modules[module] = parsed
+		}
+	}
+
+	logState.mu.Lock()
+	logState.level = level
+	for module, l := range modules {
+		logState.modules[module] = l
+	}
+	logState.mu.Unlock()
+	applyLevels()
+	return nil
+}
+
+// applyLevels 根据默认级别与模块级别设置全局日志器
+func applyLevels() {
+	logState.mu.Lock()
+	defer logState.mu.Unlock()
+
+	max := logState.level
+	for _, level := range logState.modules {
+		if level > max {
+			max = level
+		}
+	}
+
+	// 没有模块级别时恢复原有的格式化器，避免记录调用方的开销
+	if len(logState.modules) == 0 {
+		if logState.filter != nil {
+			logrus.SetFormatter(logState.filter.inner)
+			logrus.SetReportCaller(logState.reportCaller)
+			logState.filter = nil
+		}
+		logrus.SetLevel(max)
+		return
+	}
+
+	if logState.filter == nil {
+		logState.reportCaller = logrus.StandardLogger().ReportCaller
+		logState.filter = &moduleFormatter{inner: logrus.StandardLogger().Formatter, keepCaller: logState.reportCaller}
+		logrus.SetFormatter(logState.filter)
+		logrus.SetReportCaller(true)
+	}
+	logrus.SetLevel(max)
+}
+
+// moduleFormatter 丢弃超出模块级别的日志，其余日志交给原有的格式化器
+type moduleFormatter struct {
+	inner      logrus.Formatter // 原有的格式化器
+	keepCaller bool             // 是否在输出中保留调用方
+}
+
+// Format 实现 logrus.Formatter 接口
+func (f *moduleFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	if !moduleEnabled(callerModule(entry), entry.Level) {
+		return nil, nil
+	}
+	if !f.keepCaller {
+		e := *entry
+		e.Caller = nil
+		entry = &e
+	}
+	return f.inner.Format(entry)
+}
+
+// moduleEnabled 检查模块是否输出指定级别的日志
+func moduleEnabled(module string, level logrus.Level) bool {
+	logState.mu.RLock()
+	defer logState.mu.RUnlock()
+	if l, ok := logState.modules[module]; ok {
+		return level <= l
+	}
+	return level <= logState.level
+}
+
+// callerModule 获取日志调用方所在包的最后一段路径
+func callerModule(entry *logrus.Entry) string {
+	if entry.Caller == nil {
+		return ""
+	}
+	return moduleOf(entry.Caller.Function)
+}
+
+// moduleOf 从完整函数名称中提取包路径的最后一段
+// 如 "github.com/bpfs/defs/uploads.(*UploadTask).Run" 返回 "uploads"
+func moduleOf(funcName string) string {
+	if i := strings.LastIndex(funcName, "/"); i >= 0 {
+		funcName = funcName[i+1:]
+	}
+	if i := strings.Index(funcName, "."); i >= 0 {
+		funcName = funcName[:i]
+	}
+	return funcName
+}
@@ -0,0 +1,79 @@
+package debug
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestModuleLevels(t *testing.T) {
+	var buf bytes.Buffer
+	out, level := logrus.StandardLogger().Out, logrus.GetLevel()
+	logrus.SetOutput(&buf)
+	defer func() {
+		ResetModuleLevels()
+		SetLevel(level)
+		logrus.SetOutput(out)
+	}()
+
+	if err := ParseLogLevels("warn,debug=debug"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ParseLogLevels("bogus=loud"); err == nil {
+		t.Fatal("无效的级别应返回错误")
+	}
+	if logrus.GetLevel() != logrus.DebugLevel {
+		t.Fatalf("全局级别应为最详细的模块级别, got %v", logrus.GetLevel())
+	}
+
+	// 本测试位于 debug 包，按模块级别输出
+	logrus.Debug("module-debug")
+	if !strings.Contains(buf.String(), "module-debug") {
+		t.Fatalf("模块级别为 debug 时应输出调试日志: %q", buf.String())
+	}
+	if strings.Contains(buf.String(), "func=") {
+		t.Fatalf("不应输出调用方: %q", buf.String())
+	}
+
+	SetModuleLevel("debug", logrus.ErrorLevel)
+	buf.Reset()
+	logrus.Warn("module-warn")
+	if buf.Len() != 0 {
+		t.Fatalf("模块级别为 error 时应丢弃警告日志: %q", buf.String())
+	}
+
+	ResetModuleLevels()
+	logrus.Warn("default-warn")
+	if !strings.Contains(buf.String(), "default-warn") {
+		t.Fatalf("清除模块级别后应按默认级别输出: %q", buf.String())
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "defs.log")
+	rf, err := OpenRotatingFile(path, RotatePolicy{MaxSize: 10, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	for _, line := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, want := range map[string]string{path: "dddddddd\n", path + ".1": "cccccccc\n", path + ".2": "bbbbbbbb\n"} {
+		data, err := os.ReadFile(name)
+		if err != nil || string(data) != want {
+			t.Fatalf("%s = %q, %v; want %q", name, data, err, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatal("超过保留数量的历史文件应被删除")
+	}
+}
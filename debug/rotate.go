@@ -0,0 +1,127 @@
+package debug
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RotatePolicy 日志文件的轮转策略
+type RotatePolicy struct {
+	MaxSize    int64 // 单个日志文件的最大字节数，超过后轮转，0 表示不轮转
+	MaxBackups int   // 保留的历史日志文件数量，历史文件依次命名为 <路径>.1、<路径>.2 ...
+}
+
+// RotatingFile 按大小轮转的日志文件，实现 io.Writer 接口
+type RotatingFile struct {
+	mu     sync.Mutex
+	path   string       // 日志文件路径
+	policy RotatePolicy // 轮转策略
+	file   *os.File     // 当前写入的文件
+	size   int64        // 当前文件的大小
+}
+
+// OpenRotatingFile 打开按大小轮转的日志文件
+// 参数：
+//   - path: string 日志文件路径
+//   - policy: RotatePolicy 轮转策略
+//
+// 返回值：
+//   - *RotatingFile: 日志文件
+//   - error: 打开失败时返回错误信息
+func OpenRotatingFile(path string, policy RotatePolicy) (*RotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	rf := &RotatingFile{path: path, policy: policy}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// open 以追加方式打开当前日志文件
+func (rf *RotatingFile) open() error {
+	file, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	rf.file, rf.size = file, info.Size()
+	return nil
+}
+
+// Write 实现 io.Writer 接口，写入前文件将超过最大大小时先轮转
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		return 0, os.ErrClosed
+	}
+	if rf.policy.MaxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.policy.MaxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate 关闭当前文件，将历史文件依次后移，并重新打开空的日志文件
+func (rf *RotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+	rf.file = nil
+
+	if rf.policy.MaxBackups <= 0 {
+		os.Remove(rf.path)
+		return rf.open()
+	}
+	os.Remove(fmt.Sprintf("%s.%d", rf.path, rf.policy.MaxBackups))
+	for i := rf.policy.MaxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", rf.path, i), fmt.Sprintf("%s.%d", rf.path, i+1))
+	}
+	if err := os.Rename(rf.path, rf.path+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return rf.open()
+}
+
+// Close 关闭日志文件
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.file == nil {
+		return nil
+	}
+	err := rf.file.Close()
+	rf.file = nil
+	return err
+}
+
+// SetLogFile 将全局日志输出到按大小轮转的日志文件
+// 参数：
+//   - path: string 日志文件路径
+//   - policy: RotatePolicy 轮转策略
+//
+// 返回值：
+//   - *RotatingFile: 日志文件，调用方在退出时关闭
+//   - error: 打开失败时返回错误信息
+func SetLogFile(path string, policy RotatePolicy) (*RotatingFile, error) {
+	rf, err := OpenRotatingFile(path, policy)
+	if err != nil {
+		return nil, err
+	}
+	logrus.SetOutput(rf)
+	return rf, nil
+}
@@ -2,16 +2,38 @@ package defs
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 
+	"github.com/bpfs/defs/admin"
 	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/cluster"
+	"github.com/bpfs/defs/commitment"
 	"github.com/bpfs/defs/debug"
 	"github.com/bpfs/defs/downloads"
+	"github.com/bpfs/defs/edgecache"
+	"github.com/bpfs/defs/expiry"
+	"github.com/bpfs/defs/fastsync"
+	"github.com/bpfs/defs/identity"
+	"github.com/bpfs/defs/index"
+	"github.com/bpfs/defs/kv"
+	"github.com/bpfs/defs/middleware"
+	"github.com/bpfs/defs/network"
 	"github.com/bpfs/defs/opts"
 	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/defs/peermode"
+	"github.com/bpfs/defs/provider"
+	"github.com/bpfs/defs/rotation"
+	"github.com/bpfs/defs/scrub"
+	"github.com/bpfs/defs/space"
+	"github.com/bpfs/defs/standby"
+	"github.com/bpfs/defs/stats"
+	"github.com/bpfs/defs/supervise"
 	"github.com/bpfs/defs/uploads"
+	"github.com/bpfs/defs/versions"
+	"github.com/bpfs/defs/watch"
 	"github.com/bpfs/dep2p"
 	"github.com/bpfs/dep2p/pubsub"
 	"github.com/sirupsen/logrus"
@@ -20,30 +42,114 @@ import (
 
 // FS 是一个封装了DeFS去中心化(动态)存储的结构体
 type FS struct {
-	ctx          context.Context              // 全局上下文
-	opt          *opts.Options                // 文件存储选项配置
-	afe          afero.Afero                  // 文件系统接口
-	p2p          *dep2p.DeP2P                 // 网络主机
-	pub          *pubsub.DeP2PPubSub          // 网络订阅
-	upload       *uploads.UploadManager       // 管理上传会话
-	uploadChan   chan *uploads.UploadChan     // 上传对外通道
-	download     *downloads.DownloadManager   // 管理下载任务
-	downloadChan chan *downloads.DownloadChan // 下载对外通道
+	ctx          context.Context               // 全局上下文
+	opt          *opts.Options                 // 文件存储选项配置
+	afe          afero.Afero                   // 文件系统接口
+	p2p          *dep2p.DeP2P                  // 网络主机
+	pub          *pubsub.DeP2PPubSub           // 网络订阅
+	upload       *uploads.UploadManager        // 管理上传会话
+	uploadChan   chan *uploads.UploadChan      // 上传对外通道
+	download     *downloads.DownloadManager    // 管理下载任务
+	downloadChan chan *downloads.DownloadChan  // 下载对外通道
+	index        *index.IndexStore             // 文件元数据索引
+	peerMode     *peermode.Detector            // 节点模式检测
+	routing      map[int]*stats.RoutingTracker // 各模式路由表的跟踪器
+	kv           *kv.Store                     // 键值存储
+	kvReplicator *kv.Replicator                // 键值复制
+	watch        *watch.Service                // 自动上传文件夹监视
+	scrubber     *scrub.Scrubber               // 文件片段后台校验
+	expiry       *expiry.Collector             // 到期文件片段清理
+	edgeCache    *edgecache.Service            // 热门文件片段的边缘缓存
+	rotation     *rotation.Service             // 节点身份轮换
+	cluster      *cluster.Cluster              // 集群
+	standby      *standby.Service              // 元数据热备复制
+	versions     *versions.Tracker             // 节点软件版本记录
+	supervisor   *supervise.Supervisor         // 后台任务的崩溃恢复
+	admin        *admin.Server                 // 管理控制台
 }
 
 // Open 返回一个新的文件存储对象
 func Open(opt *opts.Options, p2p *dep2p.DeP2P, pub *pubsub.DeP2PPubSub) (*FS, error) {
-	if err := checkAndSetOptions(); err != nil {
+	if err := checkAndSetOptions(opt); err != nil {
 		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
 		return nil, err
 	}
 
+	// 设置流协议的超时与消息大小限制
+	network.SetStreamConfig(opt.GetStreamConfig())
+	// 设置上传与下载传输复用流的连接池
+	network.SetStreamPool(opt.GetStreamPool())
+	// 设置长时间传输的保活与停滞检测参数
+	network.SetKeepalive(opt.GetKeepalive())
+
 	afe, err := paths.InitDirectories(opt.GetRootPath())
 	if err != nil {
 		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
 		return nil, err
 	}
 
+	// 设置位于根路径之外的数据库与日志目录
+	dirs := opt.GetDataDirs()
+	if err := paths.SetDataDirs(dirs.DB, dirs.Logs); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return nil, err
+	}
+
+	// 备用节点已请求提升时，在加载各个存储之前用副本替换本地的元数据
+	if n, err := standby.ApplyPromotion(afe); err != nil {
+		logrus.Errorf("[%s]用副本替换本地的元数据失败: %v", debug.WhereAmI(), err)
+		return nil, err
+	} else if n > 0 {
+		logrus.Infof("[%s]已提升为主节点，从副本恢复了 %d 个元数据文件", debug.WhereAmI(), n)
+	}
+
+	// 加载存储承诺收据
+	if err := opt.GetReceipts().Open(filepath.Join(paths.GetRootPath(), paths.GetFilesPath(), "receipts")); err != nil {
+		logrus.Warnf("[%s]加载存储承诺收据失败: %v", debug.WhereAmI(), err)
+	}
+	if err := opt.GetCommitments().Open(filepath.Join(paths.GetRootPath(), paths.GetFilesPath(), "commitments")); err != nil {
+		logrus.Warnf("[%s]加载本节点签发的存储承诺收据失败: %v", debug.WhereAmI(), err)
+	}
+	// 对存储承诺提出的争议降低存储节点的信誉，此后选择存储节点时排在后面
+	opt.GetReceipts().OnDispute(func(d *commitment.Dispute) {
+		opt.GetReputation().Penalize(d.Receipt.Peer)
+	})
+
+	// 加载被固定的文件
+	if err := opt.GetPins().Open(filepath.Join(paths.GetRootPath(), paths.GetFilesPath(), "pins")); err != nil {
+		logrus.Warnf("[%s]加载固定记录失败: %v", debug.WhereAmI(), err)
+	}
+
+	// 加载自定义的上传参数组合
+	if err := opt.GetUploadProfiles().Open(filepath.Join(paths.GetRootPath(), paths.GetFilesPath(), "profiles")); err != nil {
+		logrus.Warnf("[%s]加载上传参数组合失败: %v", debug.WhereAmI(), err)
+	}
+
+	// 加载节点身份的连续性记录，并将本节点旧身份下的文件片段与下载迁移到当前身份
+	if err := opt.GetIdentities().Open(filepath.Join(paths.GetRootPath(), paths.GetFilesPath(), "identities")); err != nil {
+		logrus.Warnf("[%s]加载身份连续性记录失败: %v", debug.WhereAmI(), err)
+	}
+	if _, err := identity.Migrate(afe, opt.GetIdentities(), p2p.Host().ID(), paths.GetSlicePath(), paths.GetDownloadPath()); err != nil {
+		logrus.Warnf("[%s]迁移旧身份的数据失败: %v", debug.WhereAmI(), err)
+	}
+
+	// 统计一次已存储的文件片段大小，此后由计数器增量维护
+	go func() {
+		if err := opt.GetCounters().InitStored(afe, paths.GetSlicePath()); err != nil {
+			logrus.Warnf("[%s]统计已存储的文件片段大小失败: %v", debug.WhereAmI(), err)
+		}
+	}()
+
+	// 加载连接限制策略，并断开已建立的不允许的连接
+	if err := opt.GetGater().Open(afe, filepath.Join(paths.GetFilesPath(), "gate")); err != nil {
+		logrus.Warnf("[%s]加载连接限制策略失败: %v", debug.WhereAmI(), err)
+	}
+	network.SetGater(opt.GetGater())
+	opt.GetGater().Attach(p2p.Host())
+
+	// 通告策略变化时通知主机重新通告地址
+	opt.GetAdvertiser().Attach(p2p.Host())
+
 	ctx := context.Background()
 	fs := &FS{
 		ctx: ctx,
@@ -53,18 +159,42 @@ func Open(opt *opts.Options, p2p *dep2p.DeP2P, pub *pubsub.DeP2PPubSub) (*FS, er
 		pub: pub,
 	}
 
+	// 跟踪各模式路由表的节点加入与移除
+	fs.routing = make(map[int]*stats.RoutingTracker)
+	for _, mode := range []int{peermode.ModeClient, peermode.ModeServer} {
+		if table := p2p.RoutingTable(mode); table != nil {
+			fs.routing[mode] = stats.NewRoutingTracker(table, p2p.Host().ID())
+		}
+	}
+
 	// fx 配置项
 	opts := []fx.Option{
 		globalInit(fs),
 		fx.Provide(
 			uploads.NewUploadManager,     // 管理所有上传会话
 			downloads.NewDownloadManager, // 管理所有下载会话
+			index.NewIndexStore,          // 文件元数据索引
+			kv.NewStore,                  // 键值存储
+			kv.NewReplicator,             // 键值复制
+			peermode.NewDetector,         // 节点模式检测
+			watch.NewService,             // 自动上传文件夹监视
+			scrub.NewScrubber,            // 文件片段后台校验
+			expiry.NewCollector,          // 到期文件片段清理
+			edgecache.NewService,         // 热门文件片段的边缘缓存
+			provider.NewNotifier,         // 文件片段变更通告
+			rotation.NewService,          // 节点身份轮换
+			cluster.NewCluster,           // 集群
+			standby.NewService,           // 元数据热备复制
+			versions.NewTracker,          // 节点软件版本记录
+			supervise.NewSupervisor,      // 后台任务的崩溃恢复
 			// 管理所有片段会话
 		),
 		fx.Invoke(
 			uploads.RegisterUploadStreamProtocol,     // 注册上传流
 			downloads.RegisterPubsubProtocol,         // 注册下载订阅
 			downloads.RegisterDownloadStreamProtocol, // 注册下载流
+			index.RegisterIndexProtocol,              // 注册索引协议
+			fastsync.RegisterFastSyncProtocol,        // 注册快速同步协议
 		),
 	}
 	opts = append(opts, fx.Populate(
@@ -77,16 +207,78 @@ func Open(opt *opts.Options, p2p *dep2p.DeP2P, pub *pubsub.DeP2PPubSub) (*FS, er
 		&fs.uploadChan,
 		&fs.download,
 		&fs.downloadChan,
+		&fs.index,
+		&fs.peerMode,
+		&fs.kv,
+		&fs.kvReplicator,
+		&fs.watch,
+		&fs.scrubber,
+		&fs.expiry,
+		&fs.edgeCache,
+		&fs.rotation,
+		&fs.cluster,
+		&fs.standby,
+		&fs.versions,
+		&fs.supervisor,
 	))
 	app := fx.New(opts...)
 
+	// 流处理程序的崩溃同样记录到崩溃恢复中
+	if fs.supervisor != nil {
+		network.SetPanicHandler(fs.supervisor.StreamPanic)
+	}
+
+	// 定期统计路由表的节点变动，并驱逐已满的桶中长期没有用处的节点
+	for mode, tracker := range fs.routing {
+		tracker := tracker
+		fs.supervisor.Go("routing", fmt.Sprintf("tracker-%d", mode), func() { tracker.Run(ctx) })
+		fs.supervisor.Go("routing", fmt.Sprintf("eviction-%d", mode), func() { tracker.RunEviction(ctx, opt.GetEvictionPolicy()) })
+	}
+
 	// 启动所有长时间运行的 goroutine，例如网络服务器或消息队列消费者。
-	return fs, app.Start(fs.ctx)
+	if err := app.Start(fs.ctx); err != nil {
+		return fs, err
+	}
+
+	// 启动管理控制台
+	if config := opt.GetAdminConfig(); config != nil {
+		if err := fs.ServeAdmin(config); err != nil {
+			logrus.Errorf("[%s]启动管理控制台失败: %v", debug.WhereAmI(), err)
+			return fs, err
+		}
+	}
+
+	return fs, nil
 }
 
 // checkAndSetOptions 检查并设置选项
-func checkAndSetOptions() error {
-	return nil
+// 交叉检查相互关联的选项及磁盘空间，警告写入日志，其余问题汇总为一个错误返回
+func checkAndSetOptions(opt *opts.Options) error {
+	issues := opt.Validate()
+
+	// 最大上传大小与根路径所在磁盘的可用空间，根路径尚未创建时检查最近的已存在的上级目录
+	dir := opt.GetRootPath()
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	if free, err := space.GetAvailableSpace(dir); err == nil && opt.GetMaxUploadSize() > int64(free) {
+		issues = append(issues, opts.ConfigIssue{
+			Setting: "maxUploadSize",
+			Problem: fmt.Sprintf("最大上传大小 %d 超过根路径所在磁盘的可用空间 %d", opt.GetMaxUploadSize(), free),
+			Hint:    "调小最大上传大小或更换根路径，上传大文件时片段会先写入本地",
+			Warning: true,
+		})
+	}
+
+	for _, issue := range issues {
+		if issue.Warning {
+			logrus.Warnf("[%s]%s", debug.WhereAmI(), issue)
+		}
+	}
+	return opts.NewConfigError(issues)
 }
 
 // globalInit 全局初始化
@@ -172,6 +364,26 @@ func (fs *FS) Download() *downloads.DownloadManager {
 	return fs.download
 }
 
+// Middleware 上传与下载流程的中间件注册点
+func (fs *FS) Middleware() *middleware.Registry {
+	return fs.opt.GetMiddleware()
+}
+
+// Index 文件元数据索引(仅索引节点会接收记录)
+func (fs *FS) Index() *index.IndexStore {
+	return fs.index
+}
+
+// KV 键值存储
+func (fs *FS) KV() *kv.Store {
+	return fs.kv
+}
+
+// PeerMode 节点模式(客户端/服务端)检测
+func (fs *FS) PeerMode() *peermode.Detector {
+	return fs.peerMode
+}
+
 // Cache 获取缓存实例
 // func (fs *FS) Cache() *ristretto.Cache {
 // 	return fs.cache
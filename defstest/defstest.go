@@ -0,0 +1,637 @@
+// Package defstest 提供 DeFS 客户端接口的内存模拟实现，供嵌入 DeFS 的应用程序编写单元测试
+// 模拟实现不启动任何节点：上传的内容保存在内存中，下载时写入模拟的文件系统；
+// 任务标识、文件标识、时间与路由表中的节点都由输入与种子确定，相同的调用序列得到相同的结果。
+// 通过 Fail 与 FailFile 可以脚本化地注入失败，检查应用程序对错误的处理。
+package defstest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs"
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/downloads"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/uploads"
+	"github.com/bpfs/defs/wallets"
+	"github.com/bpfs/dep2p"
+	"github.com/bpfs/dep2p/kbucket"
+	"github.com/bpfs/dep2p/pubsub"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	pstore "github.com/libp2p/go-libp2p/p2p/host/peerstore"
+)
+
+// Epoch 模拟时钟的起始时间，每次开始任务时前进一秒
+var Epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Op 可注入失败的操作
+type Op string
+
+const (
+	OpUpload           Op = "upload"           // 开始上传
+	OpPauseUpload      Op = "pauseUpload"      // 暂停上传
+	OpContinueUpload   Op = "continueUpload"   // 继续上传
+	OpCancelUpload     Op = "cancelUpload"     // 取消上传
+	OpDownload         Op = "download"         // 开始下载
+	OpPauseDownload    Op = "pauseDownload"    // 暂停下载
+	OpContinueDownload Op = "continueDownload" // 继续下载
+	OpCancelDownload   Op = "cancelDownload"   // 取消下载
+)
+
+// Config 模拟实现的配置
+type Config struct {
+	Seed       int64         // 生成路由表节点的种子
+	Peers      int           // 路由表中的节点数量
+	BucketSize int           // 路由表的桶大小，为0时使用20
+	Source     afero.Afero   // 读取上传文件的文件系统，为 nil 时使用本地文件系统
+	Opt        *opts.Options // 文件存储选项配置，为 nil 时使用默认配置
+}
+
+// file 已上传的文件
+type file struct {
+	info  *uploads.UploadSuccessInfo
+	owner string // 所有者公钥哈希的十六进制字符串
+	data  []byte
+}
+
+// task 上传或下载任务
+type task struct {
+	fileID    string
+	paused    bool
+	createdAt int64 // 任务创建的时间戳
+}
+
+// failure 注入的失败
+type failure struct {
+	err   error
+	times int // 剩余次数，小于0时一直生效
+}
+
+// FS DeFS 客户端接口的内存模拟实现
+// Upload() 与 Download() 返回的对象分别实现 defs.Uploader 与 defs.Downloader，FS 本身实现 defs.Router
+type FS struct {
+	mu       sync.Mutex
+	opt      *opts.Options
+	afe      afero.Afero
+	source   afero.Afero
+	now      time.Time
+	seq      int
+	files    map[string]*file  // 文件唯一标识到文件的映射
+	uploads  map[string]*task  // 上传任务
+	download map[string]*task  // 下载任务
+	failures map[Op][]*failure // 按操作注入的失败，按注入顺序生效
+	fileErrs map[string]error  // 下载指定文件时返回的错误
+	calls    map[Op]int        // 各操作的调用次数
+	local    peer.ID           // 本地节点
+	peers    []peer.ID         // 路由表中的节点
+	tables   map[int]*kbucket.RoutingTable
+	bucket   int
+}
+
+var (
+	_ defs.Uploader   = (*Uploader)(nil)
+	_ defs.Downloader = (*Downloader)(nil)
+	_ defs.Router     = (*FS)(nil)
+)
+
+// New 创建模拟实现
+// 参数：
+//   - cfg: Config 模拟实现的配置
+//
+// 返回值：
+//   - *FS: 模拟实现
+//   - error: 生成节点失败时返回错误
+func New(cfg Config) (*FS, error) {
+	if cfg.Peers < 0 {
+		return nil, fmt.Errorf("%w: 节点数量不能为负数", errs.ErrInvalidArgument)
+	}
+	m := &FS{
+		opt:      cfg.Opt,
+		afe:      afero.NewMemMapFs(),
+		source:   cfg.Source,
+		now:      Epoch,
+		files:    make(map[string]*file),
+		uploads:  make(map[string]*task),
+		download: make(map[string]*task),
+		failures: make(map[Op][]*failure),
+		fileErrs: make(map[string]error),
+		calls:    make(map[Op]int),
+		tables:   make(map[int]*kbucket.RoutingTable),
+		bucket:   cfg.BucketSize,
+	}
+	if m.opt == nil {
+		m.opt = opts.DefaultOptions()
+	}
+	if m.source == nil {
+		m.source = afero.NewOsFs()
+	}
+	if m.bucket <= 0 {
+		m.bucket = 20
+	}
+
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	var err error
+	if m.local, err = peerID(rng); err != nil {
+		return nil, err
+	}
+	for i := 0; i < cfg.Peers; i++ {
+		p, err := peerID(rng)
+		if err != nil {
+			return nil, err
+		}
+		m.peers = append(m.peers, p)
+	}
+	return m, nil
+}
+
+// peerID 由随机数生成器确定性地生成节点ID
+func peerID(rng *rand.Rand) (peer.ID, error) {
+	_, pub, err := crypto.GenerateEd25519Key(rng)
+	if err != nil {
+		return "", err
+	}
+	return peer.IDFromPublicKey(pub)
+}
+
+// Opt 获取文件存储选项配置
+func (m *FS) Opt() *opts.Options {
+	return m.opt
+}
+
+// Afero 获取模拟的文件系统，下载完成的文件写入其中
+func (m *FS) Afero() afero.Afero {
+	return m.afe
+}
+
+// P2P 模拟实现没有网络主机，始终返回 nil
+func (m *FS) P2P() *dep2p.DeP2P {
+	return nil
+}
+
+// Pubsub 模拟实现没有网络订阅，始终返回 nil
+func (m *FS) Pubsub() *pubsub.DeP2PPubSub {
+	return nil
+}
+
+// Upload 管理所有上传会话
+func (m *FS) Upload() *Uploader {
+	return &Uploader{fs: m}
+}
+
+// Download 管理所有下载会话
+func (m *FS) Download() *Downloader {
+	return &Downloader{fs: m}
+}
+
+// ID 获取模拟的本地节点
+func (m *FS) ID() peer.ID {
+	return m.local
+}
+
+// Peers 获取路由表中的模拟节点
+func (m *FS) Peers() []peer.ID {
+	return append([]peer.ID(nil), m.peers...)
+}
+
+// RoutingTable 获取指定类型的路由表，首次获取时创建并加入所有模拟节点
+func (m *FS) RoutingTable(mode int) *kbucket.RoutingTable {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if rt, ok := m.tables[mode]; ok {
+		return rt
+	}
+	rt, err := kbucket.NewRoutingTable(m.bucket, kbucket.ConvertPeerID(m.local), time.Hour, pstore.NewMetrics(), 0, nil)
+	if err != nil {
+		return nil
+	}
+	for _, p := range m.peers {
+		// 桶已满的节点不会加入，与真实路由表的行为一致
+		rt.TryAddPeer(p, mode, true, false)
+	}
+	m.tables[mode] = rt
+	return rt
+}
+
+// Fail 让接下来 times 次 op 操作返回 err，times 小于0时一直返回 err
+// 同一操作多次注入时按注入顺序依次生效
+// 参数：
+//   - op: Op 操作
+//   - times: int 生效次数
+//   - err: error 返回的错误
+func (m *FS) Fail(op Op, times int, err error) {
+	if times == 0 || err == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures[op] = append(m.failures[op], &failure{err: err, times: times})
+}
+
+// FailFile 下载指定文件时返回 err，err 为 nil 时取消
+// 参数：
+//   - fileID: string 文件唯一标识
+//   - err: error 返回的错误
+func (m *FS) FailFile(fileID string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err == nil {
+		delete(m.fileErrs, fileID)
+		return
+	}
+	m.fileErrs[fileID] = err
+}
+
+// Reset 清除所有注入的失败与调用次数，已上传的文件与任务保持不变
+func (m *FS) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures = make(map[Op][]*failure)
+	m.fileErrs = make(map[string]error)
+	m.calls = make(map[Op]int)
+}
+
+// Calls 获取操作的调用次数，包括注入失败的调用
+func (m *FS) Calls(op Op) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls[op]
+}
+
+// Files 获取已上传文件的唯一标识，按名称排列
+func (m *FS) Files() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := make([]string, 0, len(m.files))
+	for id := range m.files {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Content 获取已上传文件的内容
+// 返回值：
+//   - []byte: 文件内容
+//   - bool: 文件是否存在
+func (m *FS) Content(fileID string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[fileID]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), f.data...), true
+}
+
+// DownloadPath 获取下载完成的文件在模拟文件系统中的路径，与真实下载的输出路径相同
+func (m *FS) DownloadPath(fileID string) string {
+	return filepath.Join(m.opt.GetDownloadPath(), fileID+".defs")
+}
+
+// begin 记录一次调用并返回注入的失败，调用方需持有锁
+func (m *FS) begin(op Op) error {
+	m.calls[op]++
+	queue := m.failures[op]
+	if len(queue) == 0 {
+		return nil
+	}
+	f := queue[0]
+	if f.times > 0 {
+		f.times--
+		if f.times == 0 {
+			m.failures[op] = queue[1:]
+		}
+	}
+	return f.err
+}
+
+// tick 推进模拟时钟并生成任务唯一标识，调用方需持有锁
+func (m *FS) tick(kind string) (string, int64) {
+	m.seq++
+	m.now = m.now.Add(time.Second)
+	return fmt.Sprintf("%s-%d", kind, m.seq), m.now.Unix()
+}
+
+// ownerOf 获取所有者公钥哈希，ownerPriv 为 nil 时使用默认所有者
+func (m *FS) ownerOf(ownerPriv *ecdsa.PrivateKey) (string, error) {
+	if ownerPriv == nil {
+		ownerPriv = m.opt.GetDefaultOwnerPriv()
+		if ownerPriv == nil {
+			return "", fmt.Errorf("%w: 所有者密钥不可为空", errs.ErrInvalidArgument)
+		}
+	}
+	pubKeyHash, ok := wallets.PrivateKeyToPublicKeyHash(ownerPriv)
+	if !ok {
+		return "", fmt.Errorf("通过私钥生成公钥哈希时失败")
+	}
+	return hex.EncodeToString(pubKeyHash), nil
+}
+
+// setPaused 设置任务的暂停状态
+func (m *FS) setPaused(ctx context.Context, tasks map[string]*task, op Op, kind, taskID string, paused bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.begin(op); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	t, ok := tasks[taskID]
+	if !ok {
+		return fmt.Errorf("%w: %s任务 %s", errs.ErrTaskNotFound, kind, taskID)
+	}
+	t.paused = paused
+	return nil
+}
+
+// cancel 取消任务
+func (m *FS) cancel(ctx context.Context, tasks map[string]*task, op Op, kind, taskID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.begin(op); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if _, ok := tasks[taskID]; !ok {
+		return fmt.Errorf("%w: %s任务 %s", errs.ErrTaskNotFound, kind, taskID)
+	}
+	delete(tasks, taskID)
+	return nil
+}
+
+// Uploader defs.Uploader 的模拟实现，上传立即完成
+type Uploader struct {
+	fs *FS
+}
+
+// NewUpload 新上传操作，网络相关的参数被忽略
+func (u *Uploader) NewUpload(opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, pubsub *pubsub.DeP2PPubSub, path string, ownerPriv *ecdsa.PrivateKey) (*uploads.UploadSuccessInfo, error) {
+	return u.NewUploadContext(context.Background(), opt, afe, p2p, pubsub, path, ownerPriv)
+}
+
+// NewUploadContext 新上传操作，ctx 已结束时返回其错误
+// 文件唯一标识由所有者与文件内容确定，相同所有者重复上传相同内容得到相同的文件唯一标识
+func (u *Uploader) NewUploadContext(ctx context.Context, opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, pubsub *pubsub.DeP2PPubSub, path string, ownerPriv *ecdsa.PrivateKey) (*uploads.UploadSuccessInfo, error) {
+	m := u.fs
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.begin(OpUpload); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := m.opt.CheckWritable("上传文件"); err != nil {
+		return nil, err
+	}
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, fmt.Errorf("%w: 文件路径不可为空", errs.ErrInvalidArgument)
+	}
+	owner, err := m.ownerOf(ownerPriv)
+	if err != nil {
+		return nil, err
+	}
+	data, err := afero.ReadFile(m.source, path)
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	h.Write([]byte(owner))
+	h.Write(data)
+	fileID := hex.EncodeToString(h.Sum(nil))[:32]
+	checksum := sha256.Sum256(data)
+
+	taskID, now := m.tick("upload")
+	name := filepath.Base(path)
+	info := &uploads.UploadSuccessInfo{
+		TaskID:      taskID,
+		FileID:      fileID,
+		Checksum:    hex.EncodeToString(checksum[:]),
+		Name:        name,
+		Size:        int64(len(data)),
+		TotalSlices: 1,
+		Extension:   filepath.Ext(name),
+		ContentType: "application/octet-stream",
+		UploadTime:  now,
+	}
+	m.files[fileID] = &file{info: info, owner: owner, data: data}
+	m.uploads[taskID] = &task{fileID: fileID, createdAt: now}
+
+	copied := *info
+	return &copied, nil
+}
+
+// PauseUpload 暂停上传操作
+func (u *Uploader) PauseUpload(taskID string) error {
+	return u.PauseUploadContext(context.Background(), taskID)
+}
+
+// PauseUploadContext 暂停上传操作，ctx 已结束时返回其错误
+func (u *Uploader) PauseUploadContext(ctx context.Context, taskID string) error {
+	return u.fs.setPaused(ctx, u.fs.uploads, OpPauseUpload, "上传", taskID, true)
+}
+
+// ContinueUpload 继续上传操作
+func (u *Uploader) ContinueUpload(taskID string) error {
+	return u.ContinueUploadContext(context.Background(), taskID)
+}
+
+// ContinueUploadContext 继续上传操作，ctx 已结束时返回其错误
+func (u *Uploader) ContinueUploadContext(ctx context.Context, taskID string) error {
+	return u.fs.setPaused(ctx, u.fs.uploads, OpContinueUpload, "上传", taskID, false)
+}
+
+// CancelUpload 取消上传操作，已上传的文件仍可下载
+func (u *Uploader) CancelUpload(taskID string) error {
+	return u.CancelUploadContext(context.Background(), taskID)
+}
+
+// CancelUploadContext 取消上传操作，ctx 已结束时返回其错误
+func (u *Uploader) CancelUploadContext(ctx context.Context, taskID string) error {
+	return u.fs.cancel(ctx, u.fs.uploads, OpCancelUpload, "上传", taskID)
+}
+
+// UploadDetailContext 获取上传任务的详细进度，上传立即完成，只有一个片段
+func (u *Uploader) UploadDetailContext(ctx context.Context, taskID string) (*uploads.UploadDetail, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m := u.fs
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.uploads[taskID]
+	if !ok {
+		return nil, fmt.Errorf("%w: 上传任务 %s", errs.ErrTaskNotFound, taskID)
+	}
+	return uploadDetail(taskID, t), nil
+}
+
+// ListUploadDetailsContext 列出所有上传任务的详细进度，按任务ID排列
+func (u *Uploader) ListUploadDetailsContext(ctx context.Context) ([]*uploads.UploadDetail, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m := u.fs
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	details := make([]*uploads.UploadDetail, 0, len(m.uploads))
+	for taskID, t := range m.uploads {
+		details = append(details, uploadDetail(taskID, t))
+	}
+	sort.Slice(details, func(i, j int) bool { return details[i].TaskID < details[j].TaskID })
+	return details, nil
+}
+
+// uploadDetail 生成模拟上传任务的详细进度
+func uploadDetail(taskID string, t *task) *uploads.UploadDetail {
+	status := uploads.StatusCompleted
+	if t.paused {
+		status = uploads.StatusPaused
+	}
+	return &uploads.UploadDetail{TaskID: taskID, FileID: t.fileID, Status: status, TotalSegments: 1, CompletedSegments: 1}
+}
+
+// Downloader defs.Downloader 的模拟实现，下载立即完成并写入模拟的文件系统
+type Downloader struct {
+	fs *FS
+}
+
+// NewDownload 新下载操作，网络相关的参数与文件片段所在节点被忽略
+func (d *Downloader) NewDownload(opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, pubsub *pubsub.DeP2PPubSub, fileID string, ownerPriv *ecdsa.PrivateKey, segmentNodes ...map[int][]peer.ID) (*downloads.DownloadSuccessInfo, error) {
+	return d.NewDownloadContext(context.Background(), opt, afe, p2p, pubsub, fileID, ownerPriv, segmentNodes...)
+}
+
+// NewDownloadContext 新下载操作，ctx 已结束时返回其错误
+// 只有文件的所有者可以下载，文件不存在时返回包装了 errs.ErrNotFound 的错误
+func (d *Downloader) NewDownloadContext(ctx context.Context, opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, pubsub *pubsub.DeP2PPubSub, fileID string, ownerPriv *ecdsa.PrivateKey, segmentNodes ...map[int][]peer.ID) (*downloads.DownloadSuccessInfo, error) {
+	m := d.fs
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.begin(OpDownload); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if fileID == "" {
+		return nil, fmt.Errorf("%w: 文件唯一标识不可为空", errs.ErrInvalidArgument)
+	}
+	if err := m.fileErrs[fileID]; err != nil {
+		return nil, err
+	}
+	owner, err := m.ownerOf(ownerPriv)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := m.files[fileID]
+	if !ok {
+		return nil, fmt.Errorf("%w: 文件 %s", errs.ErrNotFound, fileID)
+	}
+	if f.owner != owner {
+		return nil, fmt.Errorf("%w: 文件 %s", errs.ErrUnauthorized, fileID)
+	}
+
+	path := m.DownloadPath(fileID)
+	if err := m.afe.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := afero.WriteFile(m.afe, path, f.data, 0644); err != nil {
+		return nil, err
+	}
+
+	taskID, now := m.tick("download")
+	m.download[taskID] = &task{fileID: fileID, createdAt: now}
+	return &downloads.DownloadSuccessInfo{
+		TaskID:       taskID,
+		FileID:       fileID,
+		DownloadTime: now,
+	}, nil
+}
+
+// PauseDownload 暂停下载操作
+func (d *Downloader) PauseDownload(taskID string) error {
+	return d.PauseDownloadContext(context.Background(), taskID)
+}
+
+// PauseDownloadContext 暂停下载操作，ctx 已结束时返回其错误
+func (d *Downloader) PauseDownloadContext(ctx context.Context, taskID string) error {
+	return d.fs.setPaused(ctx, d.fs.download, OpPauseDownload, "下载", taskID, true)
+}
+
+// ContinueDownload 继续下载操作
+func (d *Downloader) ContinueDownload(taskID string) error {
+	return d.ContinueDownloadContext(context.Background(), taskID)
+}
+
+// ContinueDownloadContext 继续下载操作，ctx 已结束时返回其错误
+func (d *Downloader) ContinueDownloadContext(ctx context.Context, taskID string) error {
+	return d.fs.setPaused(ctx, d.fs.download, OpContinueDownload, "下载", taskID, false)
+}
+
+// CancelDownload 取消下载操作
+func (d *Downloader) CancelDownload(taskID string) error {
+	return d.CancelDownloadContext(context.Background(), taskID)
+}
+
+// CancelDownloadContext 取消下载操作，ctx 已结束时返回其错误
+func (d *Downloader) CancelDownloadContext(ctx context.Context, taskID string) error {
+	return d.fs.cancel(ctx, d.fs.download, OpCancelDownload, "下载", taskID)
+}
+
+// ListDownloadsContext 列出所有下载任务的摘要，按创建时间排列
+func (d *Downloader) ListDownloadsContext(ctx context.Context) ([]*downloads.DownloadSummary, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m := d.fs
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	summaries := make([]*downloads.DownloadSummary, 0, len(m.download))
+	for taskID, t := range m.download {
+		status := downloads.StatusCompleted
+		if t.paused {
+			status = downloads.StatusPaused
+		}
+		summary := &downloads.DownloadSummary{
+			TaskID:          taskID,
+			FileID:          t.fileID,
+			Status:          status,
+			TotalPieces:     1,
+			DataPieces:      1,
+			CompletedPieces: 1,
+			CreatedAt:       t.createdAt,
+			UpdatedAt:       t.createdAt,
+		}
+		if f, ok := m.files[t.fileID]; ok {
+			summary.Name, summary.Size = f.info.Name, f.info.Size
+			summary.DownloadedBytes = f.info.Size
+		}
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].CreatedAt != summaries[j].CreatedAt {
+			return summaries[i].CreatedAt < summaries[j].CreatedAt
+		}
+		return summaries[i].TaskID < summaries[j].TaskID
+	})
+	return summaries, nil
+}
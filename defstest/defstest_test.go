@@ -0,0 +1,100 @@
+package defstest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/bpfs/defs"
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/uploads"
+)
+
+// transfer 应用程序中典型的集成代码：上传后立即下载
+func transfer(ctx context.Context, m *FS, up defs.Uploader, down defs.Downloader, path string, owner *ecdsa.PrivateKey) (string, error) {
+	info, err := up.NewUploadContext(ctx, m.Opt(), m.Afero(), m.P2P(), m.Pubsub(), path, owner)
+	if err != nil {
+		return "", err
+	}
+	if _, err := down.NewDownloadContext(ctx, m.Opt(), m.Afero(), m.P2P(), m.Pubsub(), info.FileID, owner); err != nil {
+		return "", err
+	}
+	return info.FileID, nil
+}
+
+func TestFS(t *testing.T) {
+	source := afero.NewMemMapFs()
+	afero.WriteFile(source, "docs/a.txt", []byte("hello"), 0644)
+	owner, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	stranger, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	m, err := New(Config{Seed: 1, Peers: 8, Source: source})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// 注入的失败按次数生效
+	boom := errors.New("boom")
+	m.Fail(OpUpload, 1, boom)
+	if _, err := transfer(ctx, m, m.Upload(), m.Download(), "docs/a.txt", owner); !errors.Is(err, boom) {
+		t.Fatalf("应返回注入的错误: %v", err)
+	}
+	fileID, err := transfer(ctx, m, m.Upload(), m.Download(), "docs/a.txt", owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := afero.ReadFile(m.Afero(), m.DownloadPath(fileID)); string(data) != "hello" {
+		t.Fatalf("下载的内容不符: %q", data)
+	}
+	if m.Calls(OpUpload) != 2 || m.Calls(OpDownload) != 1 {
+		t.Fatalf("调用次数不符: %d, %d", m.Calls(OpUpload), m.Calls(OpDownload))
+	}
+
+	// 非所有者与未知文件
+	if _, err := m.Download().NewDownload(nil, nil, nil, nil, fileID, stranger); !errors.Is(err, errs.ErrUnauthorized) {
+		t.Fatalf("非所有者应被拒绝: %v", err)
+	}
+	if _, err := m.Download().NewDownload(nil, nil, nil, nil, "missing", owner); !errors.Is(err, errs.ErrNotFound) {
+		t.Fatalf("未知文件应返回 ErrNotFound: %v", err)
+	}
+	m.FailFile(fileID, boom)
+	if _, err := m.Download().NewDownload(nil, nil, nil, nil, fileID, owner); !errors.Is(err, boom) {
+		t.Fatalf("应返回为文件注入的错误: %v", err)
+	}
+	m.Reset()
+
+	// 任务管理
+	info, _ := m.Upload().NewUpload(nil, nil, nil, nil, "docs/a.txt", owner)
+	if err := m.Upload().PauseUpload(info.TaskID); err != nil {
+		t.Fatal(err)
+	}
+	if detail, err := m.Upload().UploadDetailContext(ctx, info.TaskID); err != nil || detail.Status != uploads.StatusPaused {
+		t.Fatalf("上传详情不符: %+v, %v", detail, err)
+	}
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := m.Upload().ContinueUploadContext(canceled, info.TaskID); !errors.Is(err, context.Canceled) {
+		t.Fatalf("已结束的上下文应返回其错误: %v", err)
+	}
+	if err := m.Upload().CancelUpload(info.TaskID); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Upload().ContinueUpload(info.TaskID); !errors.Is(err, errs.ErrTaskNotFound) {
+		t.Fatalf("已取消的任务应不存在: %v", err)
+	}
+
+	// 相同的种子得到相同的节点与路由表
+	other, _ := New(Config{Seed: 1, Peers: 8, Source: source})
+	if other.ID() != m.ID() || other.RoutingTable(0).Size() != m.RoutingTable(0).Size() || m.RoutingTable(0).Size() == 0 {
+		t.Fatal("相同种子的模拟结果不一致")
+	}
+	again, _ := other.Upload().NewUpload(nil, nil, nil, nil, "docs/a.txt", owner)
+	if again.FileID != fileID || again.TaskID != "upload-1" {
+		t.Fatalf("文件与任务标识应确定: %s %s", again.FileID, again.TaskID)
+	}
+}
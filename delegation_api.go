@@ -0,0 +1,80 @@
+package defs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"time"
+
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/downloads"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+)
+
+// DelegateDownload 签发委托下载令牌，允许另一身份代所有者下载指定文件
+// 参数：
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥
+//   - fileID: string 文件唯一标识
+//   - delegate: *ecdsa.PublicKey 被委托身份的公钥
+//   - scope: downloads.DelegationScope 权限范围
+//   - ttl: time.Duration 有效时长
+//   - node: peer.ID 限定发起下载的节点，为空时不限定
+//
+// 返回值：
+//   - []byte: 编码后的委托下载令牌，交给被委托身份使用
+//   - error: 签发失败时返回错误
+func (fs *FS) DelegateDownload(ownerPriv *ecdsa.PrivateKey, fileID string, delegate *ecdsa.PublicKey, scope downloads.DelegationScope, ttl time.Duration, node peer.ID) ([]byte, error) {
+	if ownerPriv == nil {
+		ownerPriv = fs.opt.GetDefaultOwnerPriv()
+	}
+	delegation, err := downloads.NewDelegationWithProvider(fs.opt.GetKeyProvider(), ownerPriv, fileID, delegate, scope, ttl, node)
+	if err != nil {
+		return nil, err
+	}
+	// 保存签发的令牌，同一身份的新节点可通过快速同步取回
+	if err := downloads.SaveGrant(fs.afe, delegation); err != nil {
+		logrus.Warnf("[%s]保存委托下载令牌失败: %v", debug.WhereAmI(), err)
+	}
+	return delegation.Encode()
+}
+
+// DownloadDelegated 使用委托下载令牌代所有者下载文件
+// 参数：
+//   - token: []byte 委托下载令牌
+//   - delegatePriv: *ecdsa.PrivateKey 被委托身份的私钥
+//
+// 返回值：
+//   - *downloads.DownloadSuccessInfo: 文件下载成功后的返回信息
+//   - error: 令牌无效或未授予该身份时返回错误
+func (fs *FS) DownloadDelegated(token []byte, delegatePriv *ecdsa.PrivateKey) (*downloads.DownloadSuccessInfo, error) {
+	return fs.DownloadDelegatedContext(context.Background(), token, delegatePriv)
+}
+
+// DownloadDelegatedContext 使用委托下载令牌代所有者下载文件，ctx 结束时下载任务随之取消
+func (fs *FS) DownloadDelegatedContext(ctx context.Context, token []byte, delegatePriv *ecdsa.PrivateKey) (*downloads.DownloadSuccessInfo, error) {
+	if delegatePriv == nil {
+		delegatePriv = fs.opt.GetDefaultOwnerPriv()
+	}
+	return fs.download.NewDelegatedDownload(ctx, fs.opt, fs.afe, fs.p2p, fs.pub, token, delegatePriv)
+}
+
+// RevokeAccess 撤销此前签发给指定身份的委托下载令牌
+// 撤销列表保存在本地并发送给存储节点，此后存储节点拒绝该身份在撤销之前获得的令牌；
+// 撤销之后重新签发的令牌不受影响
+// 参数：
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥，为空时使用默认所有者
+//   - fileID: string 文件唯一标识
+//   - delegate: *ecdsa.PublicKey 被委托身份的公钥
+//
+// 返回值：
+//   - error: 撤销失败时返回错误；撤销列表已保存但发送失败时同样返回错误，可重试
+func (fs *FS) RevokeAccess(ownerPriv *ecdsa.PrivateKey, fileID string, delegate *ecdsa.PublicKey) error {
+	if ownerPriv == nil {
+		ownerPriv = fs.opt.GetDefaultOwnerPriv()
+	}
+	list, err := downloads.Revoke(fs.afe, ownerPriv, fileID, delegate)
+	if err != nil {
+		return err
+	}
+	return downloads.PublishRevocations(fs.p2p, fs.pub, list)
+}
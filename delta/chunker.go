@@ -0,0 +1,116 @@
+// Package delta 实现了基于内容定义分块的增量上传。
+// 文件按滚动哈希切分为块，新版本与上一版本的块清单比较后，只保留发生变化的块，
+// 未变化的块以偏移量引用上一版本的内容。
+package delta
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"io"
+)
+
+const (
+	minChunkSize = 2 * 1024  // 块的最小大小
+	maxChunkSize = 64 * 1024 // 块的最大大小
+	chunkMask    = 1<<13 - 1 // 切分掩码，平均块大小约为 8KB
+)
+
+// gearTable 滚动哈希使用的随机表，由固定种子生成，保证所有节点切分结果一致
+var gearTable = func() (table [256]uint64) {
+	seed := uint64(0x9e3779b97f4a7c15)
+	for i := range table {
+		// splitmix64
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// Chunk 描述文件中的一个内容块
+type Chunk struct {
+	Offset int64  // 块在文件中的偏移量
+	Size   int    // 块的大小
+	Hash   []byte // 块内容的 SHA-256 哈希
+}
+
+// Manifest 文件某一版本的块清单
+type Manifest struct {
+	FileID   string  // 文件唯一标识
+	Size     int64   // 文件大小
+	Checksum []byte  // 文件内容的 SHA-256 哈希
+	Chunks   []Chunk // 按偏移量排列的内容块
+}
+
+// NewManifest 对文件内容分块并生成块清单
+// 参数：
+//   - fileID: string 文件唯一标识
+//   - r: io.Reader 文件内容
+//
+// 返回值：
+//   - *Manifest: 块清单
+//   - error: 读取失败时返回错误
+func NewManifest(fileID string, r io.Reader) (*Manifest, error) {
+	manifest := &Manifest{FileID: fileID}
+	sum, err := split(r, func(chunk Chunk, data []byte) error {
+		manifest.Chunks = append(manifest.Chunks, chunk)
+		manifest.Size += int64(chunk.Size)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	manifest.Checksum = sum
+	return manifest, nil
+}
+
+// split 使用 Gear 滚动哈希按内容切分数据，对每个块调用 fn，并返回全部内容的哈希
+// 传给 fn 的 data 仅在调用期间有效
+func split(r io.Reader, fn func(chunk Chunk, data []byte) error) ([]byte, error) {
+	br := bufio.NewReaderSize(r, maxChunkSize)
+	whole := sha256.New()
+	buf := make([]byte, 0, maxChunkSize)
+
+	var offset int64
+	var hash uint64
+	emit := func() error {
+		if len(buf) == 0 {
+			return nil
+		}
+		sum := sha256.Sum256(buf)
+		whole.Write(buf)
+		chunk := Chunk{Offset: offset, Size: len(buf), Hash: sum[:]}
+		if err := fn(chunk, buf); err != nil {
+			return err
+		}
+		offset += int64(len(buf))
+		buf = buf[:0]
+		hash = 0
+		return nil
+	}
+
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, b)
+		hash = hash<<1 + gearTable[b]
+
+		// 达到切分点或最大块大小时结束当前块
+		if (len(buf) >= minChunkSize && hash&chunkMask == 0) || len(buf) >= maxChunkSize {
+			if err := emit(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := emit(); err != nil {
+		return nil, err
+	}
+	return whole.Sum(nil), nil
+}
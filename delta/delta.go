@@ -0,0 +1,231 @@
+// Package delta 按内容分块比较文件的两个版本，生成只包含变化内容的增量清单，并据此重建新版本。
+// 增量清单本身是普通文件：上传与下载流程不识别其格式，持有上一版本的一方通过 IsDelta 判断后调用 ApplyFile 合并
+package delta
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Op 重建新版本的一个步骤
+// Data 为空时从上一版本的 ParentOffset 处复制 Size 字节，否则直接写入 Data
+type Op struct {
+	ParentOffset int64  // 引用上一版本内容的偏移量
+	Size         int    // 引用上一版本内容的大小
+	Data         []byte // 新增或修改的内容
+}
+
+// Header 增量清单的开头
+type Header struct {
+	Parent string // 上一版本的文件唯一标识
+}
+
+// Trailer 增量清单的结尾，用于校验重建的新版本
+type Trailer struct {
+	Size     int64  // 新版本的文件大小
+	Checksum []byte // 新版本内容的 SHA-256 哈希
+}
+
+// record 增量清单中的一条记录，Op 与 Trailer 只设置其一
+type record struct {
+	Op      *Op
+	Trailer *Trailer
+}
+
+// 增量清单的格式：标识头之后是 gob 编码的 Header、按顺序排列的重建步骤和 Trailer。
+// 新增的内容按块写出，生成与重建时都不需要在内存中保存整个增量清单。
+
+// magic 增量清单文件的标识头
+var magic = []byte("DEFSDELTA2")
+
+// Diff 比较新版本内容与上一版本的块清单，将增量清单写入 w
+// 参数：
+//   - parent: *Manifest 上一版本的块清单
+//   - r: io.Reader 新版本的内容
+//   - w: io.Writer 增量清单的写入目标
+//
+// 返回值：
+//   - *Manifest: 新版本的块清单(FileID 为空，由调用方在上传后填写)
+//   - int64: 增量清单中新增内容的总大小，即实际需要上传的数据量
+//   - error: 读取或写入失败时返回错误
+func Diff(parent *Manifest, r io.Reader, w io.Writer) (*Manifest, int64, error) {
+	known := make(map[string]Chunk, len(parent.Chunks))
+	for _, chunk := range parent.Chunks {
+		known[string(chunk.Hash)] = chunk
+	}
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(magic); err != nil {
+		return nil, 0, err
+	}
+	enc := gob.NewEncoder(bw)
+	if err := enc.Encode(Header{Parent: parent.FileID}); err != nil {
+		return nil, 0, err
+	}
+
+	// 连续的引用合并为一个步骤，遇到新增内容或引用不连续时写出
+	var pending *Op
+	flush := func() error {
+		if pending == nil {
+			return nil
+		}
+		op := pending
+		pending = nil
+		return enc.Encode(record{Op: op})
+	}
+
+	manifest := new(Manifest)
+	var dataSize int64
+	sum, err := split(r, func(chunk Chunk, data []byte) error {
+		manifest.Chunks = append(manifest.Chunks, chunk)
+		manifest.Size += int64(chunk.Size)
+
+		ref, ok := known[string(chunk.Hash)]
+		if ok && pending != nil && pending.ParentOffset+int64(pending.Size) == ref.Offset {
+			pending.Size += ref.Size
+			return nil
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		if ok {
+			pending = &Op{ParentOffset: ref.Offset, Size: ref.Size}
+			return nil
+		}
+		dataSize += int64(len(data))
+		return enc.Encode(record{Op: &Op{Data: data}})
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := flush(); err != nil {
+		return nil, 0, err
+	}
+
+	manifest.Checksum = sum
+	if err := enc.Encode(record{Trailer: &Trailer{Size: manifest.Size, Checksum: sum}}); err != nil {
+		return nil, 0, err
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, 0, err
+	}
+	return manifest, dataSize, nil
+}
+
+// Apply 使用上一版本的内容和增量清单重建新版本
+// 参数：
+//   - parent: io.ReaderAt 上一版本的内容
+//   - r: io.Reader 增量清单
+//   - w: io.Writer 新版本的写入目标
+//
+// 返回值：
+//   - error: 增量清单无效、读取失败或重建内容的校验和不一致时返回错误
+func Apply(parent io.ReaderAt, r io.Reader, w io.Writer) error {
+	br := bufio.NewReader(r)
+	head := make([]byte, len(magic))
+	if _, err := io.ReadFull(br, head); err != nil || !bytes.Equal(head, magic) {
+		return fmt.Errorf("数据不是增量清单")
+	}
+	dec := gob.NewDecoder(br)
+	var header Header
+	if err := dec.Decode(&header); err != nil {
+		return err
+	}
+
+	hasher := sha256.New()
+	out := io.MultiWriter(w, hasher)
+
+	var written int64
+	for {
+		var rec record
+		if err := dec.Decode(&rec); err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("增量清单不完整")
+			}
+			return err
+		}
+
+		if t := rec.Trailer; t != nil {
+			if written != t.Size {
+				return fmt.Errorf("重建的文件大小 %d 与预期 %d 不一致", written, t.Size)
+			}
+			if !bytes.Equal(hasher.Sum(nil), t.Checksum) {
+				return fmt.Errorf("重建的文件校验和不一致")
+			}
+			return nil
+		}
+
+		op := rec.Op
+		if op == nil {
+			return fmt.Errorf("增量清单格式错误")
+		}
+		if op.Data != nil {
+			if len(op.Data) > maxChunkSize {
+				return fmt.Errorf("增量清单中的新增内容 %d 字节超过块的最大大小", len(op.Data))
+			}
+			if _, err := out.Write(op.Data); err != nil {
+				return err
+			}
+			written += int64(len(op.Data))
+			continue
+		}
+		section := io.NewSectionReader(parent, op.ParentOffset, int64(op.Size))
+		n, err := io.Copy(out, section)
+		if err != nil {
+			return err
+		}
+		if n != int64(op.Size) {
+			return fmt.Errorf("上一版本的内容不完整: 偏移量 %d 处需要 %d 字节，实际读取 %d 字节", op.ParentOffset, op.Size, n)
+		}
+		written += n
+	}
+}
+
+// ApplyFile 使用上一版本的文件和增量清单文件重建新版本
+// 参数：
+//   - parentPath: string 上一版本的文件路径
+//   - deltaPath: string 已下载的增量清单文件路径
+//   - outPath: string 新版本的输出路径
+//
+// 返回值：
+//   - error: 如果发生错误，返回错误信息
+func ApplyFile(parentPath, deltaPath, outPath string) error {
+	d, err := os.Open(deltaPath)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	parent, err := os.Open(parentPath)
+	if err != nil {
+		return err
+	}
+	defer parent.Close()
+
+	// 先写入临时文件，校验通过后再重命名
+	tempPath := outPath + ".tmp"
+	out, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	if err := Apply(parent, d, out); err != nil {
+		out.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return os.Rename(tempPath, outPath)
+}
+
+// IsDelta 检查数据是否为增量清单，data 只需包含文件开头的内容
+func IsDelta(data []byte) bool {
+	return bytes.HasPrefix(data, magic)
+}
@@ -0,0 +1,57 @@
+package delta
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestDiffAndApply(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	parent := make([]byte, 1<<20)
+	rng.Read(parent)
+
+	manifest, err := NewManifest("v1", bytes.NewReader(parent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Size != int64(len(parent)) || len(manifest.Chunks) < 2 {
+		t.Fatalf("manifest size = %d, chunks = %d", manifest.Size, len(manifest.Chunks))
+	}
+
+	// 修改中间的一段内容并在开头插入数据，其余内容保持不变
+	child := append([]byte("inserted header"), parent...)
+	copy(child[500000:], bytes.Repeat([]byte{0xff}, 100))
+
+	var d bytes.Buffer
+	next, dataSize, err := Diff(manifest, bytes.NewReader(child), &d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Size != int64(len(child)) || !IsDelta(d.Bytes()) {
+		t.Fatalf("manifest size = %d", next.Size)
+	}
+	if dataSize > int64(len(child))/10 || int64(d.Len()) > int64(len(child))/10 {
+		t.Fatalf("delta carries %d of %d bytes (encoded %d)", dataSize, len(child), d.Len())
+	}
+
+	var out bytes.Buffer
+	if err := Apply(bytes.NewReader(parent), bytes.NewReader(d.Bytes()), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), child) {
+		t.Fatal("rebuilt content differs")
+	}
+
+	// 上一版本内容错误时重建失败
+	wrong := append([]byte(nil), parent...)
+	wrong[300000] ^= 1
+	if err := Apply(bytes.NewReader(wrong), bytes.NewReader(d.Bytes()), new(bytes.Buffer)); err == nil {
+		t.Fatal("Apply accepted a mismatched parent")
+	}
+
+	// 增量清单被截断时重建失败
+	if err := Apply(bytes.NewReader(parent), bytes.NewReader(d.Bytes()[:d.Len()-8]), new(bytes.Buffer)); err == nil {
+		t.Fatal("Apply accepted a truncated delta")
+	}
+}
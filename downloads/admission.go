@@ -0,0 +1,225 @@
+package downloads
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/qos"
+	"github.com/sirupsen/logrus"
+)
+
+// 同时进行的下载任务达到上限后，新建或继续的任务进入等待名额状态，而不是立即开始；
+// 任务完成、失败、暂停或取消时释放名额，并按配置的顺序启动等待队列中的任务。
+// 等待队列只保存在内存中，重启后排队的任务转为暂停，由调用方继续下载。
+
+// admission 下载任务的准入状态，零值可直接使用
+type admission struct {
+	mu     sync.Mutex
+	active map[string]bool // 占用名额的任务
+	queue  []*queuedTask   // 等待名额的任务，按加入的先后排列
+	seq    uint64          // 加入等待队列的序号
+}
+
+// queuedTask 等待名额的下载任务
+type queuedTask struct {
+	task  *DownloadTask
+	seq   uint64 // 加入等待队列的序号
+	start func() // 获得名额后启动任务
+}
+
+// classRank 服务等级在等待队列中的优先顺序，值越小越先启动
+func classRank(class qos.Class) int {
+	switch class {
+	case qos.ClassInteractive:
+		return 0
+	case qos.ClassBackground:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// admissionConfig 获取下载任务的准入控制，为 nil 时不限制
+func (manager *DownloadManager) admissionConfig() *opts.DownloadAdmission {
+	if manager.opt == nil {
+		return nil
+	}
+	return manager.opt.GetDownloadAdmission()
+}
+
+// full 判断是否已没有空闲名额
+func (a *admission) full(config *opts.DownloadAdmission) bool {
+	return config != nil && config.MaxConcurrent > 0 && len(a.active) >= config.MaxConcurrent
+}
+
+// ordered 按启动顺序排列等待队列
+func (a *admission) ordered(config *opts.DownloadAdmission) []*queuedTask {
+	queue := append([]*queuedTask(nil), a.queue...)
+	if config != nil && config.Order == opts.QueuePriority {
+		sort.SliceStable(queue, func(i, j int) bool {
+			queue[i].task.rwmu.RLock()
+			ri := classRank(queue[i].task.QoS)
+			queue[i].task.rwmu.RUnlock()
+			queue[j].task.rwmu.RLock()
+			rj := classRank(queue[j].task.QoS)
+			queue[j].task.rwmu.RUnlock()
+			if ri != rj {
+				return ri < rj
+			}
+			return queue[i].seq < queue[j].seq
+		})
+	}
+	return queue
+}
+
+// dequeue 从等待队列中移除任务
+func (a *admission) dequeue(taskID string) *queuedTask {
+	for i, queued := range a.queue {
+		if queued.task.TaskID == taskID {
+			a.queue = append(a.queue[:i], a.queue[i+1:]...)
+			return queued
+		}
+	}
+	return nil
+}
+
+// promote 为等待队列中的任务分配空闲名额，已取消的任务直接移出队列
+// 返回值：
+//   - []func(): 获得名额的任务的启动函数，需在释放锁后调用
+func (a *admission) promote(config *opts.DownloadAdmission) []func() {
+	var starts []func()
+	for len(a.queue) > 0 && !a.full(config) {
+		next := a.ordered(config)[0]
+		a.dequeue(next.task.TaskID)
+		if next.task.ctx != nil && next.task.ctx.Err() != nil {
+			continue
+		}
+		a.active[next.task.TaskID] = true
+		starts = append(starts, next.start)
+	}
+	return starts
+}
+
+// reset 清空占用名额的任务与等待队列
+func (a *admission) reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.active = nil
+	a.queue = nil
+}
+
+// admit 为下载任务申请名额，有空闲名额时立即启动，否则进入等待名额状态
+// 参数：
+//   - task: *DownloadTask 下载任务
+//   - start: func() 获得名额后启动任务的函数
+//
+// 返回值：
+//   - bool: 是否立即启动
+func (manager *DownloadManager) admit(task *DownloadTask, start func()) bool {
+	// 从文件恢复的任务没有上下文
+	if task.ctx == nil {
+		task.ctx, task.cancel = context.WithCancel(manager.ctx)
+	}
+
+	// 首次申请时监听任务的状态与取消，以便释放名额
+	task.rwmu.Lock()
+	watched := task.onStatus != nil
+	if !watched {
+		task.onStatus = func(status DownloadStatus) {
+			switch status {
+			case StatusCompleted, StatusFailed, StatusPaused:
+				manager.release(task.TaskID)
+			}
+		}
+	}
+	task.rwmu.Unlock()
+	if !watched {
+		id := task.TaskID
+		context.AfterFunc(task.ctx, func() { manager.release(id) })
+	}
+
+	config := manager.admissionConfig()
+	a := &manager.admission
+	a.mu.Lock()
+	if a.active == nil {
+		a.active = make(map[string]bool)
+	}
+
+	// 已在等待队列中的任务保持原有位置
+	for _, queued := range a.queue {
+		if queued.task == task {
+			queued.start = start
+			a.mu.Unlock()
+			return false
+		}
+	}
+
+	if a.active[task.TaskID] || !a.full(config) {
+		a.active[task.TaskID] = true
+		a.mu.Unlock()
+		start()
+		return true
+	}
+
+	a.seq++
+	a.queue = append(a.queue, &queuedTask{task: task, seq: a.seq, start: start})
+	task.SetDownloadStatus(StatusQueued)
+	a.mu.Unlock()
+
+	logrus.Infof("[%s]同时进行的下载任务已达上限 %d，下载任务 %s 等待名额", debug.WhereAmI(), config.MaxConcurrent, task.TaskID)
+	return false
+}
+
+// release 释放下载任务的名额或将其移出等待队列，并启动等待队列中的任务
+// 参数：
+//   - taskID: string 任务唯一标识
+func (manager *DownloadManager) release(taskID string) {
+	a := &manager.admission
+	a.mu.Lock()
+	delete(a.active, taskID)
+	a.dequeue(taskID)
+	starts := a.promote(manager.admissionConfig())
+	a.mu.Unlock()
+
+	for _, start := range starts {
+		start()
+	}
+}
+
+// queuePositions 获取等待名额的任务在队列中的位置
+// 返回值：
+//   - map[string]int: 任务唯一标识到位置的映射，位置从1开始
+func (manager *DownloadManager) queuePositions() map[string]int {
+	a := &manager.admission
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	positions := make(map[string]int, len(a.queue))
+	for i, queued := range a.ordered(manager.admissionConfig()) {
+		positions[queued.task.TaskID] = i + 1
+	}
+	return positions
+}
+
+// QueuePosition 获取下载任务在等待名额队列中的位置
+// 参数：
+//   - taskID: string 任务唯一标识
+//
+// 返回值：
+//   - int: 位置，从1开始；未在排队时为 0
+func (manager *DownloadManager) QueuePosition(taskID string) int {
+	return manager.queuePositions()[taskID]
+}
+
+// ActiveDownloads 获取占用名额的下载任务数量
+func (manager *DownloadManager) ActiveDownloads() int {
+	a := &manager.admission
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return len(a.active)
+}
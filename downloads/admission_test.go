@@ -0,0 +1,112 @@
+package downloads
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/qos"
+)
+
+func TestAdmission(t *testing.T) {
+	opt := opts.DefaultOptions()
+	if err := opt.BuildDownloadAdmission(&opts.DownloadAdmission{MaxConcurrent: 2, Order: opts.QueuePriority}); err != nil {
+		t.Fatal(err)
+	}
+	manager := &DownloadManager{
+		ctx:   context.Background(),
+		Tasks: make(map[string]*DownloadTask),
+		opt:   opt,
+	}
+
+	var mu sync.Mutex
+	var started []string
+	newTask := func(id string, class qos.Class) *DownloadTask {
+		task := &DownloadTask{TaskID: id, File: &DownloadFile{FileID: id}, QoS: class, DownloadStatus: StatusPending}
+		task.StatusCond = sync.NewCond(&task.rwmu)
+		return task
+	}
+	admit := func(task *DownloadTask) bool {
+		return manager.admit(task, func() {
+			mu.Lock()
+			started = append(started, task.TaskID)
+			mu.Unlock()
+			task.SetDownloadStatus(StatusDownloading)
+		})
+	}
+
+	a, b := newTask("a", qos.ClassNormal), newTask("b", qos.ClassNormal)
+	c, d, e := newTask("c", qos.ClassBackground), newTask("d", qos.ClassNormal), newTask("e", qos.ClassInteractive)
+	for _, task := range []*DownloadTask{a, b, c, d, e} {
+		want := task == a || task == b
+		if got := admit(task); got != want {
+			t.Fatalf("admit %s = %v, want %v", task.TaskID, got, want)
+		}
+	}
+	if n := manager.ActiveDownloads(); n != 2 {
+		t.Fatalf("active = %d, want 2", n)
+	}
+
+	// 交互优先、后台最后，同一等级按先后排列
+	wantPos := map[string]int{"e": 1, "d": 2, "c": 3}
+	for id, pos := range wantPos {
+		if got := manager.QueuePosition(id); got != pos {
+			t.Errorf("position of %s = %d, want %d", id, got, pos)
+		}
+		if got := map[string]*DownloadTask{"c": c, "d": d, "e": e}[id].GetDownloadStatus(); got != StatusQueued {
+			t.Errorf("%s status = %s, want %s", id, got, StatusQueued)
+		}
+	}
+
+	// 已在队列中的任务再次申请时保持原有位置
+	if admit(c) || manager.QueuePosition("c") != 3 {
+		t.Fatalf("re-admitted queued task moved to %d", manager.QueuePosition("c"))
+	}
+
+	// 暂停释放名额，队首的任务随即启动
+	a.SetDownloadStatus(StatusPaused)
+	if manager.QueuePosition("e") != 0 || e.GetDownloadStatus() != StatusDownloading {
+		t.Fatalf("e not started: status %s", e.GetDownloadStatus())
+	}
+
+	// 取消排队的任务后移出队列
+	d.cancel()
+	deadline := time.Now().Add(time.Second)
+	for manager.QueuePosition("d") != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if pos := manager.QueuePosition("c"); pos != 1 {
+		t.Fatalf("position of c = %d, want 1", pos)
+	}
+
+	// 摘要中附带队列位置
+	manager.Tasks["c"] = c
+	if summaries := manager.ListDownloads(); len(summaries) != 1 || summaries[0].QueuePosition != 1 {
+		t.Fatalf("summaries = %+v", summaries)
+	}
+
+	// 完成释放名额；已取消的任务不再启动
+	b.SetDownloadStatus(StatusCompleted)
+	mu.Lock()
+	got := append([]string(nil), started...)
+	mu.Unlock()
+	want := []string{"a", "b", "e", "c"}
+	if len(got) != len(want) {
+		t.Fatalf("started = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("started = %v, want %v", got, want)
+		}
+	}
+
+	// 不限制时立即启动
+	if err := opt.BuildDownloadAdmission(nil); err != nil {
+		t.Fatal(err)
+	}
+	if !admit(newTask("f", qos.ClassNormal)) {
+		t.Fatal("unlimited admission queued a task")
+	}
+}
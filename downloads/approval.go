@@ -0,0 +1,494 @@
+package downloads
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/network"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/defs/util"
+	"github.com/bpfs/defs/wallets"
+	"github.com/bpfs/dep2p"
+	"github.com/bpfs/dep2p/streams"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+)
+
+// 所有者可将文件标记为受限。其他身份下载受限文件前需向所有者节点提交下载申请，
+// 申请在所有者批准前处于等待状态，批准时所有者签发限定申请节点的委托下载令牌，
+// 申请方取得令牌后才开始下载。等待超时的申请自动失效，申请的每次状态变化都会发出通知。
+// 受限文件随所有者签名的撤销列表发送给存储节点，存储节点只向持有限定其节点令牌的请求方提供片段；
+// 申请与查询的请求方均为流连接上经过认证的对方节点。
+
+var (
+	// 提交下载申请
+	StreamApprovalRequestProtocol = fmt.Sprintf("defs@stream/approval/request/%s", version)
+
+	// 查询下载申请的状态
+	StreamApprovalStatusProtocol = fmt.Sprintf("defs@stream/approval/status/%s", version)
+)
+
+// ApprovalStatus 下载申请的状态
+type ApprovalStatus int
+
+const (
+	ApprovalPending  ApprovalStatus = iota // 等待所有者处理
+	ApprovalApproved                       // 已批准
+	ApprovalDenied                         // 已拒绝
+	ApprovalExpired                        // 等待超时，已失效
+)
+
+// String 返回状态的名称
+func (s ApprovalStatus) String() string {
+	switch s {
+	case ApprovalPending:
+		return "pending"
+	case ApprovalApproved:
+		return "approved"
+	case ApprovalDenied:
+		return "denied"
+	case ApprovalExpired:
+		return "expired"
+	default:
+		return fmt.Sprintf("ApprovalStatus(%d)", int(s))
+	}
+}
+
+// ApprovalRequest 所有者节点收到的下载申请
+type ApprovalRequest struct {
+	RequestID string         // 申请的唯一标识
+	FileID    string         // 文件唯一标识
+	Requester peer.ID        // 提交申请的节点
+	Delegate  []byte         // 申请身份的公钥
+	Note      string         // 申请说明
+	CreatedAt time.Time      // 提交时间
+	ExpiresAt time.Time      // 等待的截止时间
+	Status    ApprovalStatus // 状态
+	token     []byte         // 批准时签发的委托下载令牌
+}
+
+// ApprovalReq 提交下载申请的请求消息
+type ApprovalReq struct {
+	FileID   string // 文件唯一标识
+	Delegate []byte // 申请身份的公钥
+	Note     string // 申请说明
+}
+
+// ApprovalStatusReq 查询下载申请状态的请求消息
+type ApprovalStatusReq struct {
+	RequestID string // 申请的唯一标识
+}
+
+// ApprovalStatusRes 查询下载申请状态的响应消息
+type ApprovalStatusRes struct {
+	Status ApprovalStatus // 状态
+	Token  []byte         // 批准时签发的委托下载令牌
+}
+
+// approvals 所有者节点的受限文件与下载申请
+type approvals struct {
+	mu         sync.Mutex
+	restricted map[string]bool             // 受限的文件
+	requests   map[string]*ApprovalRequest // 申请的唯一标识到申请的映射
+	events     chan ApprovalRequest        // 申请状态变化的通知
+}
+
+// newApprovals 创建下载申请记录
+func newApprovals() *approvals {
+	return &approvals{
+		restricted: make(map[string]bool),
+		requests:   make(map[string]*ApprovalRequest),
+		events:     make(chan ApprovalRequest, 64),
+	}
+}
+
+// notify 发出申请状态变化的通知，接收方处理不及时时丢弃通知，不阻塞申请处理
+func (a *approvals) notify(request *ApprovalRequest) {
+	event := *request
+	event.token = nil
+	select {
+	case a.events <- event:
+	default:
+		logrus.Warnf("[%s]下载申请通知已满，丢弃申请 %s 的通知", debug.WhereAmI(), request.RequestID)
+	}
+}
+
+// expire 使等待超时的申请失效，并移除处理完毕且超过保留期的申请
+// 处理完毕的申请保留至截止时间之后一个等待时长，便于申请方查询结果
+func (a *approvals) expire(now time.Time, pendingTTL time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for id, request := range a.requests {
+		if request.Status == ApprovalPending && now.After(request.ExpiresAt) {
+			request.Status = ApprovalExpired
+			a.notify(request)
+			continue
+		}
+		if request.Status != ApprovalPending && now.After(request.ExpiresAt.Add(pendingTTL)) {
+			delete(a.requests, id)
+		}
+	}
+}
+
+// submit 记录下载申请，同一节点与身份对同一文件的等待中申请只保留一个
+// 返回值：
+//   - string: 申请的唯一标识
+//   - error: 文件未受限时返回包装了 errs.ErrUnauthorized 的错误
+func (a *approvals) submit(fileID string, requester peer.ID, delegate []byte, note string, pendingTTL time.Duration) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.restricted[fileID] {
+		return "", fmt.Errorf("%w: 文件 %s 不接受下载申请", errs.ErrUnauthorized, fileID)
+	}
+	for id, request := range a.requests {
+		if request.Status == ApprovalPending && request.FileID == fileID &&
+			request.Requester == requester && string(request.Delegate) == string(delegate) {
+			return id, nil
+		}
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	request := &ApprovalRequest{
+		RequestID: hex.EncodeToString(id),
+		FileID:    fileID,
+		Requester: requester,
+		Delegate:  delegate,
+		Note:      note,
+		CreatedAt: now,
+		ExpiresAt: now.Add(pendingTTL),
+		Status:    ApprovalPending,
+	}
+	a.requests[request.RequestID] = request
+	a.notify(request)
+	return request.RequestID, nil
+}
+
+// resolve 处理等待中的申请
+// 参数：
+//   - requestID: string 申请的唯一标识
+//   - sign: func(*ApprovalRequest) ([]byte, error) 批准时签发令牌，拒绝时为 nil
+//
+// 返回值：
+//   - error: 申请不存在或已处理时返回错误信息
+func (a *approvals) resolve(requestID string, sign func(*ApprovalRequest) ([]byte, error)) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	request, ok := a.requests[requestID]
+	if !ok {
+		return fmt.Errorf("%w: 下载申请 %s", errs.ErrNotFound, requestID)
+	}
+	if request.Status == ApprovalPending && time.Now().After(request.ExpiresAt) {
+		request.Status = ApprovalExpired
+		a.notify(request)
+	}
+	if request.Status != ApprovalPending {
+		return fmt.Errorf("%w: 下载申请 %s 已处于 %s 状态", errs.ErrInvalidArgument, requestID, request.Status)
+	}
+
+	if sign == nil {
+		request.Status = ApprovalDenied
+	} else {
+		token, err := sign(request)
+		if err != nil {
+			return err
+		}
+		request.Status, request.token = ApprovalApproved, token
+	}
+	a.notify(request)
+	return nil
+}
+
+// status 获取申请的状态，只有提交申请的节点可以查询
+func (a *approvals) status(requestID string, requester peer.ID) (*ApprovalStatusRes, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	request, ok := a.requests[requestID]
+	if !ok || request.Requester != requester {
+		return nil, fmt.Errorf("%w: 下载申请 %s", errs.ErrNotFound, requestID)
+	}
+	return &ApprovalStatusRes{Status: request.Status, Token: request.token}, nil
+}
+
+// restrictedPath 获取受限文件列表的保存路径
+func restrictedPath() string {
+	return filepath.Join(paths.GetManifestPath(), "approvals", "restricted")
+}
+
+// load 加载保存的受限文件列表
+func (a *approvals) load(afe afero.Afero) error {
+	data, err := afero.ReadFile(afe, restrictedPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var fileIDs []string
+	if err := util.DecodeFromBytes(data, &fileIDs); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, fileID := range fileIDs {
+		a.restricted[fileID] = true
+	}
+	return nil
+}
+
+// save 保存受限文件列表，调用方需持有锁
+func (a *approvals) save(afe afero.Afero) error {
+	fileIDs := make([]string, 0, len(a.restricted))
+	for fileID := range a.restricted {
+		fileIDs = append(fileIDs, fileID)
+	}
+	sort.Strings(fileIDs)
+	data, err := util.EncodeToBytes(fileIDs)
+	if err != nil {
+		return err
+	}
+	if err := afe.MkdirAll(filepath.Dir(restrictedPath()), 0755); err != nil {
+		return err
+	}
+	return afero.WriteFileAtomic(afe, restrictedPath(), data, 0644)
+}
+
+// runExpiry 定期使等待超时的申请失效，直到 ctx 结束
+func (a *approvals) runExpiry(ctx context.Context, opt *opts.Options, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			a.expire(now, opt.GetApprovalConfig().PendingTTL)
+		}
+	}
+}
+
+// RestrictDownloads 设置文件是否受限，受限文件只能通过所有者批准的下载申请下载
+// 参数：
+//   - afe: afero.Afero 文件系统接口
+//   - fileID: string 文件唯一标识
+//   - restricted: bool 是否受限
+//
+// 返回值：
+//   - error: 保存失败时返回错误信息
+func (manager *DownloadManager) RestrictDownloads(afe afero.Afero, fileID string, restricted bool) error {
+	a := manager.approvals
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if restricted {
+		a.restricted[fileID] = true
+	} else {
+		delete(a.restricted, fileID)
+	}
+	return a.save(afe)
+}
+
+// PendingApprovals 获取等待所有者处理的下载申请，按提交时间排序
+func (manager *DownloadManager) PendingApprovals() []ApprovalRequest {
+	a := manager.approvals
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	var pending []ApprovalRequest
+	for _, request := range a.requests {
+		if request.Status == ApprovalPending && !now.After(request.ExpiresAt) {
+			item := *request
+			item.token = nil
+			pending = append(pending, item)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].CreatedAt.Before(pending[j].CreatedAt) })
+	return pending
+}
+
+// ApprovalEvents 获取下载申请状态变化的通知通道
+// 新申请、批准、拒绝及失效时各发出一次通知，通道已满时通知被丢弃
+func (manager *DownloadManager) ApprovalEvents() <-chan ApprovalRequest {
+	return manager.approvals.events
+}
+
+// Approve 批准下载申请，签发限定申请节点的委托下载令牌
+// 参数：
+//   - opt: *opts.Options 文件存储选项配置
+//   - afe: afero.Afero 文件系统接口
+//   - requestID: string 申请的唯一标识
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥
+//
+// 返回值：
+//   - error: 申请不存在、已处理或签发失败时返回错误信息
+func (manager *DownloadManager) Approve(opt *opts.Options, afe afero.Afero, requestID string, ownerPriv *ecdsa.PrivateKey) error {
+	return manager.approvals.resolve(requestID, func(request *ApprovalRequest) ([]byte, error) {
+		delegate, err := wallets.UnmarshalPublicKey(request.Delegate)
+		if err != nil {
+			return nil, fmt.Errorf("%w: 无效的申请身份公钥", errs.ErrInvalidArgument)
+		}
+		d, err := NewDelegationWithProvider(opt.GetKeyProvider(), ownerPriv, request.FileID, &delegate, ScopeSegments|ScopeMetadata, opt.GetApprovalConfig().GrantTTL, request.Requester)
+		if err != nil {
+			return nil, err
+		}
+		if err := SaveGrant(afe, d); err != nil {
+			logrus.Warnf("[%s]保存委托下载令牌失败: %v", debug.WhereAmI(), err)
+		}
+		return d.Encode()
+	})
+}
+
+// Deny 拒绝下载申请
+// 参数：
+//   - requestID: string 申请的唯一标识
+//
+// 返回值：
+//   - error: 申请不存在或已处理时返回错误信息
+func (manager *DownloadManager) Deny(requestID string) error {
+	return manager.approvals.resolve(requestID, nil)
+}
+
+// handleApprovalRequest 所有者节点处理下载申请
+func (sp *StreamProtocol) handleApprovalRequest(req *streams.RequestMessage, res *streams.ResponseMessage) (int32, string) {
+	payload := new(ApprovalReq)
+	if err := util.DecodeFromBytes(req.Payload, payload); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return 6603, "解码错误"
+	}
+	requester, err := peer.Decode(req.Message.GetSender())
+	if err != nil {
+		return 6603, "解码错误"
+	}
+	if _, err := wallets.UnmarshalPublicKey(payload.Delegate); err != nil {
+		return 6603, "无效的申请身份公钥"
+	}
+
+	requestID, err := sp.Download.approvals.submit(payload.FileID, requester, payload.Delegate, payload.Note, sp.Opt.GetApprovalConfig().PendingTTL)
+	if err != nil {
+		logrus.Warnf("[%s]拒绝节点 %s 的下载申请: %v", debug.WhereAmI(), requester, err)
+		return 6620, "文件不接受下载申请"
+	}
+	logrus.Infof("[%s]节点 %s 申请下载文件 %s，申请 %s 等待批准", debug.WhereAmI(), requester, payload.FileID, requestID)
+
+	res.Data = []byte(requestID)
+	return 200, "成功"
+}
+
+// handleApprovalStatus 所有者节点处理下载申请的状态查询
+func (sp *StreamProtocol) handleApprovalStatus(req *streams.RequestMessage, res *streams.ResponseMessage) (int32, string) {
+	payload := new(ApprovalStatusReq)
+	if err := util.DecodeFromBytes(req.Payload, payload); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return 6603, "解码错误"
+	}
+	requester, err := peer.Decode(req.Message.GetSender())
+	if err != nil {
+		return 6603, "解码错误"
+	}
+
+	status, err := sp.Download.approvals.status(payload.RequestID, requester)
+	if err != nil {
+		return 6621, "下载申请不存在"
+	}
+	statusBytes, err := util.EncodeToBytes(status)
+	if err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return 6605, "编码错误"
+	}
+	res.Data = statusBytes
+	return 200, "成功"
+}
+
+// RequestApproval 向所有者节点提交下载申请
+// 参数：
+//   - ctx: context.Context 上下文，取消时中止请求
+//   - p2p: *dep2p.DeP2P 网络主机
+//   - owner: peer.ID 所有者节点
+//   - fileID: string 文件唯一标识
+//   - delegate: *ecdsa.PublicKey 申请身份的公钥，批准后令牌授予该身份
+//   - note: string 申请说明
+//
+// 返回值：
+//   - string: 申请的唯一标识
+//   - error: 文件未受限时返回包装了 errs.ErrUnauthorized 的错误，请求失败时返回节点错误
+func RequestApproval(ctx context.Context, p2p *dep2p.DeP2P, owner peer.ID, fileID string, delegate *ecdsa.PublicKey, note string) (string, error) {
+	delegateKey, err := wallets.MarshalPublicKey(*delegate)
+	if err != nil {
+		return "", err
+	}
+	res, err := network.SendStreamContext(ctx, p2p, StreamApprovalRequestProtocol, "", owner, &ApprovalReq{
+		FileID:   fileID,
+		Delegate: delegateKey,
+		Note:     note,
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errs.ErrPeerUnreachable, err)
+	}
+	if res == nil || res.Code != 200 {
+		msg := "无响应"
+		if res != nil {
+			msg = res.Msg
+		}
+		return "", fmt.Errorf("%w: 节点 %s 拒绝下载申请: %s", errs.ErrUnauthorized, owner, msg)
+	}
+	return string(res.Data), nil
+}
+
+// AwaitApproval 定期查询下载申请的状态，直到所有者批准或拒绝
+// 参数：
+//   - ctx: context.Context 上下文，取消时停止等待
+//   - p2p: *dep2p.DeP2P 网络主机
+//   - owner: peer.ID 所有者节点
+//   - requestID: string 申请的唯一标识
+//   - interval: time.Duration 查询间隔
+//
+// 返回值：
+//   - []byte: 批准时签发的委托下载令牌
+//   - error: 申请被拒绝或失效时返回包装了 errs.ErrUnauthorized 的错误
+func AwaitApproval(ctx context.Context, p2p *dep2p.DeP2P, owner peer.ID, requestID string, interval time.Duration) ([]byte, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		res, err := network.SendStreamContext(ctx, p2p, StreamApprovalStatusProtocol, "", owner, &ApprovalStatusReq{RequestID: requestID})
+		switch {
+		case err != nil:
+			// 所有者节点暂时不可达时继续等待
+			logrus.Debugf("[%s]查询下载申请 %s 失败: %v", debug.WhereAmI(), requestID, err)
+		case res == nil || res.Code != 200:
+			return nil, fmt.Errorf("%w: 下载申请 %s", errs.ErrNotFound, requestID)
+		default:
+			status := new(ApprovalStatusRes)
+			if err := util.DecodeFromBytes(res.Data, status); err != nil {
+				return nil, err
+			}
+			switch status.Status {
+			case ApprovalApproved:
+				return status.Token, nil
+			case ApprovalDenied:
+				return nil, fmt.Errorf("%w: 下载申请 %s 已被拒绝", errs.ErrUnauthorized, requestID)
+			case ApprovalExpired:
+				return nil, fmt.Errorf("%w: 下载申请 %s 已失效", errs.ErrUnauthorized, requestID)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package downloads
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/wallets"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestApproval(t *testing.T) {
+	afe := afero.NewMemMapFs()
+	opt := opts.DefaultOptions()
+	owner, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	delegate, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	delegateKey, _ := wallets.MarshalPublicKey(delegate.PublicKey)
+	requester, _ := peer.Decode("QmbvZMNyx4nTEL5fp8Aw58Gv37JPrdR6zeHLsYC5gWGDPN")
+
+	manager := &DownloadManager{approvals: newApprovals()}
+	a := manager.approvals
+
+	if _, err := a.submit("file-1", requester, delegateKey, "", time.Hour); !errors.Is(err, errs.ErrUnauthorized) {
+		t.Fatalf("未受限的文件不应接受申请: %v", err)
+	}
+	if err := manager.RestrictDownloads(afe, "file-1", true); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := a.submit("file-1", requester, delegateKey, "渲染", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := a.submit("file-1", requester, delegateKey, "渲染", time.Hour); again != id {
+		t.Fatalf("重复的申请应返回同一标识: %s != %s", again, id)
+	}
+	if pending := manager.PendingApprovals(); len(pending) != 1 || pending[0].RequestID != id {
+		t.Fatalf("应有一个等待中的申请: %+v", pending)
+	}
+	if event := <-manager.ApprovalEvents(); event.RequestID != id || event.Status != ApprovalPending {
+		t.Fatalf("新申请应发出通知: %+v", event)
+	}
+
+	// 批准前查询不到令牌，其他节点无法查询
+	if status, err := a.status(id, requester); err != nil || status.Status != ApprovalPending || status.Token != nil {
+		t.Fatalf("批准前应处于等待状态: %+v, %v", status, err)
+	}
+	if _, err := a.status(id, peer.ID("other")); !errors.Is(err, errs.ErrNotFound) {
+		t.Fatalf("其他节点不应能查询申请: %v", err)
+	}
+
+	if err := manager.Approve(opt, afe, id, owner); err != nil {
+		t.Fatal(err)
+	}
+	status, _ := a.status(id, requester)
+	d, err := DecodeDelegation(status.Token)
+	if status.Status != ApprovalApproved || err != nil {
+		t.Fatalf("批准后应返回令牌: %+v, %v", status, err)
+	}
+	if d.Peer != requester || d.FileID != "file-1" || d.Verify() != nil {
+		t.Fatalf("令牌应限定申请节点: %+v", d)
+	}
+	if err := manager.Deny(id); !errors.Is(err, errs.ErrInvalidArgument) {
+		t.Fatalf("已处理的申请不能再次处理: %v", err)
+	}
+
+	// 等待超时的申请失效
+	expiring, _ := a.submit("file-1", requester, delegateKey, "", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	a.expire(time.Now(), time.Hour)
+	if status, _ := a.status(expiring, requester); status.Status != ApprovalExpired {
+		t.Fatalf("超时的申请应失效: %+v", status)
+	}
+	if err := manager.Approve(opt, afe, expiring, owner); !errors.Is(err, errs.ErrInvalidArgument) {
+		t.Fatalf("已失效的申请不能批准: %v", err)
+	}
+
+	// 受限文件列表在重启后保留
+	reloaded := newApprovals()
+	if err := reloaded.load(afe); err != nil || !reloaded.restricted["file-1"] {
+		t.Fatalf("应加载受限文件列表: %v", err)
+	}
+}
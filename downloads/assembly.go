@@ -0,0 +1,240 @@
+package downloads
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/segment"
+	"github.com/bpfs/defs/util"
+	"github.com/sirupsen/logrus"
+)
+
+// codecGzip 上传方在分片前使用 gzip 压缩了文件内容，与 uploads.CodecGzip 一致
+const codecGzip = "gzip"
+
+// decodedSuffix 解压输出文件时临时文件的后缀
+const decodedSuffix = ".decoded"
+
+// 数据片段在到达时直接写入预分配输出文件中对应的位置，纠删码片段仍单独保存。
+// 这样数据片段可以乱序到达，合并时只需恢复缺失的数据片段，不再需要额外的完整副本。
+
+// assemblyPath 获取下载过程中输出文件的路径
+// 参数：
+//   - opt: *opts.Options 文件存储选项配置
+//
+// 返回值：
+//   - string 输出文件路径
+func (task *DownloadTask) assemblyPath(opt *opts.Options) string {
+	return filepath.Join(opt.GetDownloadPath(), task.File.FileID+".defs")
+}
+
+// shardSize 获取每个数据片段的大小(与纠删码切分时的大小一致)
+// 返回值：
+//   - int64 数据片段的大小
+func (task *DownloadTask) shardSize() int64 {
+	if task.DataPieces == 0 {
+		return 0
+	}
+	return (task.File.Size + int64(task.DataPieces) - 1) / int64(task.DataPieces)
+}
+
+// isAssembledShard 检查文件片段是否直接写入输出文件
+// 参数：
+//   - index: int 文件片段的索引
+//
+// 返回值：
+//   - bool 数据片段返回 true，纠删码片段返回 false
+func (task *DownloadTask) isAssembledShard(index int) bool {
+	return index < task.DataPieces && !task.File.IsRsCodes(index)
+}
+
+// writeShardAt 将已验证的数据片段写入输出文件中对应的位置
+// 输出文件在首次写入时预分配为文件的最终大小，超出文件大小的填充部分不会写入
+// 参数：
+//   - opt: *opts.Options 文件存储选项配置
+//   - index: int 文件片段的索引
+//   - content: []byte 文件片段的内容
+//
+// 返回值：
+//   - error 错误信息
+func (task *DownloadTask) writeShardAt(opt *opts.Options, index int, content []byte) error {
+	task.assemblyMu.Lock()
+	defer task.assemblyMu.Unlock()
+
+	if err := os.MkdirAll(opt.GetDownloadPath(), 0755); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return err
+	}
+
+	task.temp.trackFile(task.assemblyPath(opt))
+	file, err := os.OpenFile(task.assemblyPath(opt), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return err
+	}
+	defer file.Close()
+
+	// 预分配输出文件
+	info, err := file.Stat()
+	if err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return err
+	}
+	if info.Size() != task.File.Size {
+		if err := file.Truncate(task.File.Size); err != nil {
+			logrus.Errorf("[%s]预分配输出文件失败: %v", debug.WhereAmI(), err)
+			return err
+		}
+	}
+
+	offset := int64(index) * task.shardSize()
+	if offset >= task.File.Size {
+		return nil // 片段完全由填充组成
+	}
+	if remain := task.File.Size - offset; int64(len(content)) > remain {
+		content = content[:remain]
+	}
+
+	if err := task.writeAssembly(file, task.diskIOConfig(opt), content, offset); err != nil {
+		logrus.Errorf("[%s]写入输出文件失败: %v", debug.WhereAmI(), err)
+		return err
+	}
+	return nil
+}
+
+// readShardAt 从输出文件中读取数据片段，超出文件大小的部分以0填充
+// 参数：
+//   - opt: *opts.Options 文件存储选项配置
+//   - index: int 文件片段的索引
+//
+// 返回值：
+//   - []byte 文件片段的内容
+//   - error 错误信息
+func (task *DownloadTask) readShardAt(opt *opts.Options, index int) ([]byte, error) {
+	task.assemblyMu.Lock()
+	defer task.assemblyMu.Unlock()
+
+	file, err := os.Open(task.assemblyPath(opt))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	shard := make([]byte, task.shardSize())
+	offset := int64(index) * task.shardSize()
+	if offset >= task.File.Size {
+		return shard, nil
+	}
+
+	n := int64(len(shard))
+	if remain := task.File.Size - offset; n > remain {
+		n = remain
+	}
+	if _, err := file.ReadAt(shard[:n], offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return shard, nil
+}
+
+// signedCodec 从文件片段的字段中读取压缩算法与压缩前的大小，两个字段须同时存在或同时缺失
+// 参数：
+//   - results: map[string]*segment.SegmentReadResult 文件片段的字段
+//
+// 返回值：
+//   - string: 压缩算法，未压缩时为空
+//   - int64: 压缩前的文件大小，未压缩时为 0
+//   - error: 字段不完整或无效时返回错误信息
+func signedCodec(results map[string]*segment.SegmentReadResult) (string, int64, error) {
+	codec, rawSize := results["CODEC"], results["RAWSIZE"]
+	hasCodec := codec != nil && codec.Error == nil
+	hasSize := rawSize != nil && rawSize.Error == nil
+	if !hasCodec && !hasSize {
+		return "", 0, nil
+	}
+	if !hasCodec || !hasSize || len(codec.Data) == 0 {
+		return "", 0, fmt.Errorf("压缩算法与压缩前的大小不完整")
+	}
+	size, err := util.FromBytes[int64](rawSize.Data)
+	if err != nil {
+		return "", 0, err
+	}
+	if size <= 0 {
+		return "", 0, fmt.Errorf("压缩前的大小无效: %d", size)
+	}
+	return string(codec.Data), size, nil
+}
+
+// setCodec 记录已验证签名的文件片段中的压缩信息
+// 参数：
+//   - codec: string 压缩算法，未压缩时为空
+//   - rawSize: int64 压缩前的文件大小
+func (task *DownloadTask) setCodec(codec string, rawSize int64) {
+	task.assemblyMu.Lock()
+	defer task.assemblyMu.Unlock()
+
+	task.File.Codec = codec
+	task.File.RawSize = rawSize
+}
+
+// decodeContent 还原上传方在分片前压缩的输出文件
+// 解压到临时文件后替换输出文件，未压缩的文件保持不变
+// 解压后的大小不能超过签名的压缩前大小，避免恶意构造的压缩内容耗尽磁盘
+// 参数：
+//   - path: string 输出文件路径
+//
+// 返回值：
+//   - error 错误信息
+func (task *DownloadTask) decodeContent(path string) error {
+	task.assemblyMu.Lock()
+	defer task.assemblyMu.Unlock()
+
+	switch task.File.Codec {
+	case "":
+		return nil
+	case codecGzip:
+	default:
+		return fmt.Errorf("不支持的压缩算法: %s", task.File.Codec)
+	}
+	rawSize := task.File.RawSize
+	if rawSize <= 0 {
+		return fmt.Errorf("缺少签名的压缩前大小")
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	r, err := gzip.NewReader(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	decodedPath := path + decodedSuffix
+	dst, err := os.Create(decodedPath)
+	if err != nil {
+		return err
+	}
+	// 多读一个字节，以判断解压后的内容是否超过压缩前的大小
+	n, err := io.Copy(dst, io.LimitReader(r, rawSize+1))
+	if err == nil && n != rawSize {
+		err = fmt.Errorf("解压后的大小 %d 与签名的压缩前大小 %d 不一致", n, rawSize)
+	}
+	if err != nil {
+		dst.Close()
+		os.Remove(decodedPath)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(decodedPath)
+		return err
+	}
+	return os.Rename(decodedPath, path)
+}
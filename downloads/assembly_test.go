@@ -0,0 +1,86 @@
+package downloads
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bpfs/defs/segment"
+	"github.com/bpfs/defs/util"
+	"github.com/bpfs/defs/zip/gzip"
+)
+
+func TestDecodeContent(t *testing.T) {
+	original := bytes.Repeat([]byte("defs "), 1024)
+	compressed, err := gzip.CompressData(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "file.defs")
+	if err := os.WriteFile(path, compressed, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	task := &DownloadTask{File: &DownloadFile{FileID: "file-1", Codec: codecGzip, RawSize: int64(len(original))}}
+	if err := task.decodeContent(path); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded, original) {
+		t.Fatal("还原后的内容与原始内容不一致")
+	}
+
+	// 解压后超过签名的压缩前大小时拒绝，输出文件保持不变
+	if err := os.WriteFile(path, compressed, 0644); err != nil {
+		t.Fatal(err)
+	}
+	task.File.RawSize = int64(len(original)) / 2
+	if err := task.decodeContent(path); err == nil {
+		t.Fatal("解压后的大小超过压缩前大小时应返回错误")
+	}
+	if kept, _ := os.ReadFile(path); !bytes.Equal(kept, compressed) {
+		t.Fatal("解压失败时不应修改输出文件")
+	}
+	if _, err := os.Stat(path + decodedSuffix); !os.IsNotExist(err) {
+		t.Fatal("解压失败时应删除临时文件")
+	}
+
+	// 缺少签名的压缩前大小时拒绝
+	task.File.RawSize = 0
+	if err := task.decodeContent(path); err == nil {
+		t.Fatal("缺少压缩前大小时应返回错误")
+	}
+
+	task.File.Codec = "lz4"
+	if err := task.decodeContent(path); err == nil {
+		t.Fatal("不支持的压缩算法应返回错误")
+	}
+}
+
+func TestSignedCodec(t *testing.T) {
+	rawSize, _ := util.ToBytes[int64](4096)
+	codec, size, err := signedCodec(map[string]*segment.SegmentReadResult{
+		"CODEC":   {Data: []byte(codecGzip)},
+		"RAWSIZE": {Data: rawSize},
+	})
+	if err != nil || codec != codecGzip || size != 4096 {
+		t.Fatalf("codec = %q, size = %d, err = %v", codec, size, err)
+	}
+
+	// 未压缩的文件片段没有这两个段
+	missing := &segment.SegmentReadResult{Error: errors.New("ErrNoSuchField")}
+	if codec, _, err := signedCodec(map[string]*segment.SegmentReadResult{"CODEC": missing, "RAWSIZE": missing}); err != nil || codec != "" {
+		t.Fatalf("codec = %q, err = %v", codec, err)
+	}
+
+	// 只有其中一个段时无效
+	if _, _, err := signedCodec(map[string]*segment.SegmentReadResult{"CODEC": {Data: []byte(codecGzip)}, "RAWSIZE": missing}); err == nil {
+		t.Fatal("缺少压缩前大小时应返回错误")
+	}
+}
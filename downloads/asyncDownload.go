@@ -7,6 +7,8 @@ import (
 
 	"github.com/bpfs/defs/afero"
 	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/middleware"
 	"github.com/bpfs/defs/opts"
 	"github.com/bpfs/defs/paths"
 	"github.com/bpfs/defs/util"
@@ -68,6 +70,7 @@ func (manager *DownloadManager) handleAsyncDownload(opt *opts.Options, afe afero
 		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
 		return
 	}
+	opt.GetCounters().AddServed(int64(segmentInfoSize(reply.SegmentInfo)))
 
 	if res == nil {
 		return
@@ -103,7 +106,7 @@ func localHandleAsyncDownload(
 ) (*StreamAsyncDownloadResponse, error) {
 	task, exists := download.Tasks[taskID]
 	if !exists {
-		return nil, fmt.Errorf("任务不存在")
+		return nil, fmt.Errorf("%w: 下载任务 %s", errs.ErrTaskNotFound, taskID)
 	}
 
 	receiver, err := peer.Decode(requesterAddress)
@@ -179,16 +182,26 @@ func processSegmentInfo(
 		// 获取文件片段的唯一标识
 		segmentID := task.File.GetSegmentID(index)
 		// 写入本地文件
-		if err := writeToLocalFile(opt, afe, p2p, task.Secret, task.File.FileID, segmentID, sliceContent); err != nil {
+		receiveCtx := &middleware.SegmentReceiveContext{
+			TaskID:    task.TaskID,
+			FileID:    task.File.FileID,
+			SegmentID: segmentID,
+			Index:     index,
+			Sender:    receiver,
+		}
+		if err := writeToLocalFile(opt, afe, p2p, task, segmentID, sliceContent, receiveCtx); err != nil {
 			logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+			task.recordSegmentFault(index, segmentID, receiver, err)
 			return false, err
 		}
+		task.provenance.record(index, segmentID, receiver, len(sliceContent), time.Now())
 
 		// 更新下载进度，并检查是否需要合并文件
 		// ok := updateDownloadProgress(task, index)
-		updateDownloadProgress(task, index)
+		updateDownloadProgress(task, index, len(sliceContent))
 
 		isComplete := task.Progress.All()
+		rate, eta := task.throughput.estimate(task.remainingPieces(), time.Now())
 
 		// 对外通道
 		go func() {
@@ -203,6 +216,8 @@ func processSegmentInfo(
 				UsesErasureCodes: task.File.IsRsCodes(index),        // 是否使用纠删码技术
 				NodeID:           receiver,                          // 存储该文件片段的节点ID
 				DownloadTime:     time.Now().UTC().Unix(),           // 下载完成时间的时间戳
+				Throughput:       rate,                              // 平滑后的下载速度
+				ETA:              eta,                               // 预计剩余时间
 			}
 		}()
 
@@ -248,6 +263,11 @@ func ProcessDownloadRequest(
 		SegmentInfo: make(map[int][]byte), // 初始化文件片段的索引和内容的映射
 	}
 
+	// 记录请求热度，供边缘缓存发现热门片段
+	for _, segmentID := range segmentInfo {
+		opt.GetPopularity().Record(fileID, segmentID)
+	}
+
 	// 处理优先下载的文件片段
 	currentSize, err := processPrioritySegment(opt, afe, p2p, downloadMaximumSize, fileID, prioritySegment, segmentInfo, reply.SegmentInfo)
 	if err != nil {
@@ -0,0 +1,362 @@
+package downloads
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/crypto/gcm"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/keys"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/defs/script"
+	"github.com/bpfs/defs/segment"
+	"github.com/bpfs/defs/util"
+	"github.com/bpfs/defs/wallets"
+
+	"github.com/bpfs/dep2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// DelegationScope 委托下载的权限范围
+type DelegationScope uint8
+
+const (
+	ScopeSegments DelegationScope = 1 << iota // 下载文件片段
+	ScopeMetadata                             // 获取文件名、MIME类型等元数据
+)
+
+// Delegation 委托下载令牌
+// 所有者签发令牌，允许另一身份(例如渲染农场的节点)代其下载指定文件；
+// 存储节点通过签名及文件的 P2PKH 脚本确认令牌由文件所有者签发，文件加密密钥则只有被委托身份能够解密
+type Delegation struct {
+	FileID    string          // 文件唯一标识
+	Owner     []byte          // 所有者的公钥
+	Delegate  []byte          // 被委托身份的公钥
+	Peer      peer.ID         // 限定发起下载的节点，为空时不限定
+	Scope     DelegationScope // 权限范围
+	ExpiresAt int64           // 过期时间(Unix 秒)
+	IssuedAt  int64           // 签发时间(Unix 纳秒)，用于判断令牌是否在撤销之前签发
+	Secret    []byte          // 文件加密密钥，使用所有者与被委托身份的 ECDH 共享密钥加密
+	Signature []byte          // 所有者的签名
+}
+
+// NewDelegation 签发委托下载令牌
+// 参数：
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥
+//   - fileID: string 文件唯一标识
+//   - delegate: *ecdsa.PublicKey 被委托身份的公钥
+//   - scope: DelegationScope 权限范围
+//   - ttl: time.Duration 有效时长
+//   - node: peer.ID 限定发起下载的节点，为空时不限定
+//
+// 返回值：
+//   - *Delegation: 委托下载令牌
+//   - error: 签发失败时返回错误
+func NewDelegation(ownerPriv *ecdsa.PrivateKey, fileID string, delegate *ecdsa.PublicKey, scope DelegationScope, ttl time.Duration, node peer.ID) (*Delegation, error) {
+	return NewDelegationWithProvider(keys.Local{}, ownerPriv, fileID, delegate, scope, ttl, node)
+}
+
+// NewDelegationWithProvider 签发委托下载令牌，文件加密密钥由指定的方式获取
+// 上传时更换过文件加密密钥的获取方式时使用，参数与 NewDelegation 相同
+func NewDelegationWithProvider(provider keys.KeyProvider, ownerPriv *ecdsa.PrivateKey, fileID string, delegate *ecdsa.PublicKey, scope DelegationScope, ttl time.Duration, node peer.ID) (*Delegation, error) {
+	if ownerPriv == nil || delegate == nil || fileID == "" || ttl <= 0 {
+		return nil, fmt.Errorf("%w: 委托下载令牌的参数不完整", errs.ErrInvalidArgument)
+	}
+
+	owner, err := wallets.MarshalPublicKey(ownerPriv.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	delegateKey, err := wallets.MarshalPublicKey(*delegate)
+	if err != nil {
+		return nil, err
+	}
+
+	// 文件加密密钥默认由所有者私钥及文件唯一标识派生，被委托身份无法自行获取
+	secret, err := provider.FileKey(ownerPriv, fileID)
+	if err != nil {
+		return nil, err
+	}
+	priv, err := ownerPriv.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	pub, err := delegate.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	wrapKey, err := delegationWrapKey(priv, pub)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := gcm.EncryptData(secret, wrapKey)
+	if err != nil {
+		return nil, fmt.Errorf("加密文件密钥时失败: %v", err)
+	}
+
+	d := &Delegation{
+		FileID:    fileID,
+		Owner:     owner,
+		Delegate:  delegateKey,
+		Peer:      node,
+		Scope:     scope,
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+		IssuedAt:  time.Now().UnixNano(),
+		Secret:    sealed,
+	}
+
+	digest, err := d.digest()
+	if err != nil {
+		return nil, err
+	}
+	if d.Signature, err = ecdsa.SignASN1(rand.Reader, ownerPriv, digest); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// DecodeDelegation 解码委托下载令牌
+func DecodeDelegation(token []byte) (*Delegation, error) {
+	d := new(Delegation)
+	if err := util.DecodeFromBytes(token, d); err != nil {
+		return nil, fmt.Errorf("%w: 无效的委托下载令牌: %v", errs.ErrInvalidArgument, err)
+	}
+	return d, nil
+}
+
+// Encode 编码委托下载令牌，用于交给被委托身份
+func (d *Delegation) Encode() ([]byte, error) {
+	return util.EncodeToBytes(d)
+}
+
+// Verify 验证令牌的签名及有效期
+func (d *Delegation) Verify() error {
+	owner, err := wallets.UnmarshalPublicKey(d.Owner)
+	if err != nil {
+		return fmt.Errorf("%w: 无效的所有者公钥", errs.ErrUnauthorized)
+	}
+	digest, err := d.digest()
+	if err != nil {
+		return err
+	}
+	if !ecdsa.VerifyASN1(&owner, digest, d.Signature) {
+		return fmt.Errorf("%w: 委托下载令牌的签名无效", errs.ErrUnauthorized)
+	}
+	if time.Now().Unix() > d.ExpiresAt {
+		return fmt.Errorf("%w: 委托下载令牌已过期", errs.ErrUnauthorized)
+	}
+	return nil
+}
+
+// Authorize 存储节点校验令牌是否允许请求方访问文件
+// 参数：
+//   - fileID: string 请求的文件唯一标识
+//   - p2pkhScript: []byte 文件的 P2PKH 脚本，用于确认令牌由文件所有者签发
+//   - sender: peer.ID 发起请求的节点
+//   - scope: DelegationScope 请求所需的权限
+//
+// 返回值：
+//   - error: 未被授权时返回错误
+func (d *Delegation) Authorize(fileID string, p2pkhScript []byte, sender peer.ID, scope DelegationScope) error {
+	if err := d.Verify(); err != nil {
+		return err
+	}
+	if d.FileID != fileID {
+		return fmt.Errorf("%w: 委托下载令牌不适用于文件 %s", errs.ErrUnauthorized, fileID)
+	}
+	if d.Scope&scope != scope {
+		return fmt.Errorf("%w: 委托下载令牌的权限不足", errs.ErrUnauthorized)
+	}
+	if d.Peer != "" && d.Peer != sender {
+		return fmt.Errorf("%w: 委托下载令牌限定了其他节点", errs.ErrUnauthorized)
+	}
+	if d.Peer == "" && revocations.restricted(fileID, p2pkhScript) {
+		return fmt.Errorf("%w: 受限文件的委托下载令牌必须限定请求节点", errs.ErrUnauthorized)
+	}
+	if revocations.revoked(d) {
+		return fmt.Errorf("%w: 委托下载令牌已被所有者撤销", errs.ErrUnauthorized)
+	}
+	ownerHash, ok := wallets.PublicKeyBytesToPublicKeyHash(d.Owner)
+	if !ok || !script.VerifyScriptPubKeyHash(p2pkhScript, ownerHash) {
+		return fmt.Errorf("%w: 委托下载令牌并非由文件所有者签发", errs.ErrUnauthorized)
+	}
+	return nil
+}
+
+// OpenSecret 被委托身份解密文件加密密钥
+// 参数：
+//   - delegatePriv: *ecdsa.PrivateKey 被委托身份的私钥
+//
+// 返回值：
+//   - []byte: 文件加密密钥
+//   - error: 私钥与令牌不匹配或解密失败时返回错误
+func (d *Delegation) OpenSecret(delegatePriv *ecdsa.PrivateKey) ([]byte, error) {
+	self, err := wallets.MarshalPublicKey(delegatePriv.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if string(self) != string(d.Delegate) {
+		return nil, fmt.Errorf("%w: 委托下载令牌未授予该身份", errs.ErrUnauthorized)
+	}
+
+	priv, err := delegatePriv.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	owner, err := ecdh.P256().NewPublicKey(d.Owner)
+	if err != nil {
+		return nil, err
+	}
+	wrapKey, err := delegationWrapKey(priv, owner)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := gcm.DecryptData(d.Secret, wrapKey)
+	if err != nil {
+		return nil, fmt.Errorf("解密文件密钥时失败: %v", err)
+	}
+	return secret, nil
+}
+
+// digest 计算签名内容的摘要
+func (d *Delegation) digest() ([]byte, error) {
+	unsigned := *d
+	unsigned.Signature = nil
+	data, err := util.EncodeToBytes(unsigned)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+// delegationWrapKey 通过 ECDH 共享密钥派生用于加密文件密钥的密钥
+func delegationWrapKey(priv *ecdh.PrivateKey, pub *ecdh.PublicKey) ([]byte, error) {
+	shared, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(append([]byte("defs-delegation"), shared...))
+	return sum[:], nil
+}
+
+// authorizeSegments 存储节点检查请求方能否获取文件的片段
+// 共享文件任何节点都可以获取；非共享或受限文件要求请求方为所有者，或持有由所有者签发的有效委托下载令牌，
+// 受限文件的令牌还必须限定请求节点。sender 必须是流连接上经过认证的对方节点ID
+// 参数：
+//   - opt: *opts.Options 文件存储选项配置
+//   - afe: afero.Afero 文件系统接口
+//   - p2p: *dep2p.DeP2P 网络主机
+//   - fileID: string 文件唯一标识
+//   - userPubHash: []byte 请求方的公钥哈希
+//   - token: []byte 委托下载令牌，非代所有者下载时为空
+//   - sender: peer.ID 请求方节点ID
+//
+// 返回值：
+//   - error: 无权获取时返回错误
+func authorizeSegments(opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, fileID string, userPubHash, token []byte, sender peer.ID) error {
+	subDir := filepath.Join(paths.GetSlicePath(), p2p.Host().ID().String(), fileID)
+	slices, err := afero.ListFileNamesRecursively(afe, subDir)
+	if err != nil || len(slices) == 0 {
+		return fmt.Errorf("%w: 文件 %s", errs.ErrNotFound, fileID)
+	}
+	sliceFile, err := util.OpenFile(opt, afe, subDir, slices[0])
+	if err != nil {
+		return err
+	}
+	defer sliceFile.Close()
+
+	results, _, err := segment.ReadFileSegments(sliceFile, []string{"SHARED", "P2PKHSCRIPT"})
+	if err != nil {
+		return err
+	}
+	result, ok := results["P2PKHSCRIPT"]
+	if !ok || result.Error != nil {
+		return fmt.Errorf("读取文件 %s 的 P2PKH 脚本失败", fileID)
+	}
+	// 受限文件不按共享文件提供
+	if shared, ok := results["SHARED"]; ok && shared.Error == nil && !revocations.restricted(fileID, result.Data) {
+		if shared, err := util.FromBytes[bool](shared.Data); err == nil && shared {
+			return nil
+		}
+	}
+	if script.VerifyScriptPubKeyHash(result.Data, userPubHash) {
+		return nil
+	}
+	if len(token) == 0 {
+		return fmt.Errorf("%w: 文件 %s 需要委托下载令牌", errs.ErrUnauthorized, fileID)
+	}
+	d, err := DecodeDelegation(token)
+	if err != nil {
+		return err
+	}
+	return d.Authorize(fileID, result.Data, sender, ScopeSegments)
+}
+
+// grantsPath 获取已签发委托下载令牌的保存目录
+func grantsPath() string {
+	return filepath.Join(paths.GetManifestPath(), "grants")
+}
+
+// SaveGrant 保存所有者签发的委托下载令牌，供同一身份的其他节点同步
+// 参数：
+//   - afe: afero.Afero 文件系统接口
+//   - d: *Delegation 委托下载令牌
+//
+// 返回值：
+//   - error: 保存失败时返回错误
+func SaveGrant(afe afero.Afero, d *Delegation) error {
+	token, err := d.Encode()
+	if err != nil {
+		return err
+	}
+	if err := afe.MkdirAll(grantsPath(), 0755); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(d.Signature)
+	path := filepath.Join(grantsPath(), d.FileID+"-"+hex.EncodeToString(sum[:8])+".grant")
+	return afero.WriteFileAtomic(afe, path, token, 0644)
+}
+
+// ListGrants 列出本节点保存的委托下载令牌，已过期或无效的令牌被跳过
+// 参数：
+//   - afe: afero.Afero 文件系统接口
+//
+// 返回值：
+//   - []*Delegation: 仍然有效的委托下载令牌
+//   - error: 读取目录失败时返回错误
+func ListGrants(afe afero.Afero) ([]*Delegation, error) {
+	entries, err := afero.ReadDir(afe, grantsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var grants []*Delegation
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".grant" {
+			continue
+		}
+		token, err := afero.ReadFile(afe, filepath.Join(grantsPath(), entry.Name()))
+		if err != nil {
+			continue
+		}
+		d, err := DecodeDelegation(token)
+		if err != nil || d.Verify() != nil {
+			continue
+		}
+		grants = append(grants, d)
+	}
+	return grants, nil
+}
@@ -0,0 +1,206 @@
+package downloads
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/script"
+	"github.com/bpfs/defs/util"
+	"github.com/bpfs/defs/wallets"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestDelegation(t *testing.T) {
+	owner, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	delegate, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	stranger, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	ownerHash, _ := wallets.PrivateKeyToPublicKeyHash(owner)
+	p2pkh, err := script.NewScriptBuilder().
+		AddOp(script.OP_DUP).AddOp(script.OP_HASH160).
+		AddData(ownerHash).
+		AddOp(script.OP_EQUALVERIFY).AddOp(script.OP_CHECKSIG).
+		Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewDelegation(owner, "file-1", &delegate.PublicKey, ScopeSegments, time.Hour, "")
+	if err != nil {
+		t.Fatalf("签发委托下载令牌失败: %v", err)
+	}
+	token, err := d.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err = DecodeDelegation(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender := peer.ID("render-node")
+	if err := d.Authorize("file-1", p2pkh, sender, ScopeSegments); err != nil {
+		t.Fatalf("有效的令牌应被接受: %v", err)
+	}
+	if err := d.Authorize("file-2", p2pkh, sender, ScopeSegments); !errors.Is(err, errs.ErrUnauthorized) {
+		t.Fatalf("其他文件应被拒绝: %v", err)
+	}
+	if err := d.Authorize("file-1", p2pkh, sender, ScopeMetadata); !errors.Is(err, errs.ErrUnauthorized) {
+		t.Fatalf("未授予的权限应被拒绝: %v", err)
+	}
+
+	// 非所有者签发的令牌
+	forged, _ := NewDelegation(stranger, "file-1", &delegate.PublicKey, ScopeSegments, time.Hour, "")
+	if err := forged.Authorize("file-1", p2pkh, sender, ScopeSegments); !errors.Is(err, errs.ErrUnauthorized) {
+		t.Fatalf("非所有者签发的令牌应被拒绝: %v", err)
+	}
+
+	// 篡改过期时间
+	d.ExpiresAt += 3600
+	if err := d.Verify(); !errors.Is(err, errs.ErrUnauthorized) {
+		t.Fatalf("篡改的令牌应被拒绝: %v", err)
+	}
+	d.ExpiresAt -= 3600
+
+	// 限定节点
+	bound, _ := NewDelegation(owner, "file-1", &delegate.PublicKey, ScopeSegments, time.Hour, sender)
+	if err := bound.Authorize("file-1", p2pkh, peer.ID("other"), ScopeSegments); !errors.Is(err, errs.ErrUnauthorized) {
+		t.Fatalf("限定节点之外的请求应被拒绝: %v", err)
+	}
+
+	// 只有被委托身份能解密文件加密密钥
+	want, _ := util.GenerateSecretFromPrivateKeyAndChecksum(owner, []byte("file-1"))
+	secret, err := d.OpenSecret(delegate)
+	if err != nil || string(secret) != string(want) {
+		t.Fatalf("被委托身份解密文件密钥失败: %v", err)
+	}
+	if _, err := d.OpenSecret(stranger); err == nil {
+		t.Fatal("其他身份不应能解密文件密钥")
+	}
+}
+
+func TestRevocation(t *testing.T) {
+	afe := afero.NewMemMapFs()
+	owner, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	delegate, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	ownerHash, _ := wallets.PrivateKeyToPublicKeyHash(owner)
+	p2pkh, _ := script.NewScriptBuilder().
+		AddOp(script.OP_DUP).AddOp(script.OP_HASH160).
+		AddData(ownerHash).
+		AddOp(script.OP_EQUALVERIFY).AddOp(script.OP_CHECKSIG).
+		Script()
+	sender := peer.ID("render-node")
+
+	d, _ := NewDelegation(owner, "file-revoke", &delegate.PublicKey, ScopeSegments, time.Hour, "")
+	kept, _ := NewDelegation(owner, "file-revoke", &other.PublicKey, ScopeSegments, time.Hour, "")
+
+	first, err := Revoke(afe, owner, "file-revoke", &delegate.PublicKey)
+	if err != nil {
+		t.Fatalf("撤销委托下载令牌失败: %v", err)
+	}
+	if err := d.Authorize("file-revoke", p2pkh, sender, ScopeSegments); !errors.Is(err, errs.ErrUnauthorized) {
+		t.Fatalf("已撤销的令牌应被拒绝: %v", err)
+	}
+	if err := kept.Authorize("file-revoke", p2pkh, sender, ScopeSegments); err != nil {
+		t.Fatalf("其他身份的令牌不应受影响: %v", err)
+	}
+
+	// 撤销之后重新签发的令牌有效
+	renewed, _ := NewDelegation(owner, "file-revoke", &delegate.PublicKey, ScopeSegments, time.Hour, "")
+	if err := renewed.Authorize("file-revoke", p2pkh, sender, ScopeSegments); err != nil {
+		t.Fatalf("重新签发的令牌应被接受: %v", err)
+	}
+
+	// 序号更大的列表覆盖旧列表，旧列表重放不被采用
+	second, err := Revoke(afe, owner, "file-revoke", &other.PublicKey)
+	if err != nil || second.Seq != first.Seq+1 || len(second.Entries) != 2 {
+		t.Fatalf("撤销列表应包含全部记录且序号递增: %+v, %v", second, err)
+	}
+	if applied, err := ApplyRevocations(afe, first); err != nil || applied {
+		t.Fatalf("序号较小的列表不应被采用: %v, %v", applied, err)
+	}
+
+	// 篡改的列表被拒绝
+	forged := *second
+	forged.Seq += 10
+	forged.Entries = nil
+	if _, err := ApplyRevocations(afe, &forged); !errors.Is(err, errs.ErrUnauthorized) {
+		t.Fatalf("篡改的撤销列表应被拒绝: %v", err)
+	}
+
+	// 重启后从文件加载
+	revocations.mu.Lock()
+	delete(revocations.lists, string(second.Owner))
+	revocations.mu.Unlock()
+	if err := LoadRevocations(afe); err != nil {
+		t.Fatal(err)
+	}
+	if err := kept.Authorize("file-revoke", p2pkh, sender, ScopeSegments); !errors.Is(err, errs.ErrUnauthorized) {
+		t.Fatalf("加载的撤销列表应生效: %v", err)
+	}
+
+	// 同步时只返回请求方缺少或序号较小的列表
+	known := revocations.known()
+	if known[string(second.Owner)] != second.Seq {
+		t.Fatalf("已知序号 = %d，期望 %d", known[string(second.Owner)], second.Seq)
+	}
+	for _, list := range revocations.newer(known) {
+		if string(list.Owner) == string(second.Owner) {
+			t.Fatal("请求方已有最新列表时不应返回")
+		}
+	}
+	known[string(second.Owner)] = first.Seq
+	found := false
+	for _, list := range revocations.newer(known) {
+		found = found || (string(list.Owner) == string(second.Owner) && list.Seq == second.Seq)
+	}
+	if !found {
+		t.Fatal("请求方的列表过期时应返回最新列表")
+	}
+}
+
+func TestRestrict(t *testing.T) {
+	afe := afero.NewMemMapFs()
+	owner, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	delegate, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	ownerHash, _ := wallets.PrivateKeyToPublicKeyHash(owner)
+	p2pkh, _ := script.NewScriptBuilder().
+		AddOp(script.OP_DUP).AddOp(script.OP_HASH160).
+		AddData(ownerHash).
+		AddOp(script.OP_EQUALVERIFY).AddOp(script.OP_CHECKSIG).
+		Script()
+	sender := peer.ID("render-node")
+
+	open, _ := NewDelegation(owner, "file-restrict", &delegate.PublicKey, ScopeSegments, time.Hour, "")
+	bound, _ := NewDelegation(owner, "file-restrict", &delegate.PublicKey, ScopeSegments, time.Hour, sender)
+
+	list, err := Restrict(afe, owner, "file-restrict", true)
+	if err != nil || len(list.Restricted) != 1 {
+		t.Fatalf("设置受限文件失败: %+v, %v", list, err)
+	}
+	if !revocations.restricted("file-restrict", p2pkh) {
+		t.Fatal("文件应被标记为受限")
+	}
+	if err := open.Authorize("file-restrict", p2pkh, sender, ScopeSegments); !errors.Is(err, errs.ErrUnauthorized) {
+		t.Fatalf("受限文件应拒绝未限定节点的令牌: %v", err)
+	}
+	if err := bound.Authorize("file-restrict", p2pkh, sender, ScopeSegments); err != nil {
+		t.Fatalf("受限文件应接受限定请求节点的令牌: %v", err)
+	}
+
+	if _, err := Restrict(afe, owner, "file-restrict", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := open.Authorize("file-restrict", p2pkh, sender, ScopeSegments); err != nil {
+		t.Fatalf("取消受限后未限定节点的令牌应有效: %v", err)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build linux
+
+package downloads
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// openDirect 以 O_DIRECT 打开输出文件，写入绕过页缓存
+func openDirect(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|unix.O_DIRECT, 0644)
+}
+
+// dropCache 提示内核释放文件指定范围的页缓存，length 为 0 时表示到文件末尾
+// 只有已写回磁盘的页会被释放，提示失败不影响下载
+func dropCache(file *os.File, offset, length int64) {
+	_ = unix.Fadvise(int(file.Fd()), offset, length, unix.FADV_DONTNEED)
+}
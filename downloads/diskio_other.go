@@ -0,0 +1,16 @@
+//go:build !linux
+
+package downloads
+
+import (
+	"errors"
+	"os"
+)
+
+// openDirect 当前平台不支持 O_DIRECT，调用方回退到普通写入
+func openDirect(path string) (*os.File, error) {
+	return nil, errors.New("当前平台不支持 O_DIRECT")
+}
+
+// dropCache 当前平台不支持 fadvise，忽略提示
+func dropCache(file *os.File, offset, length int64) {}
@@ -0,0 +1,57 @@
+package downloads
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"testing"
+
+	"github.com/bpfs/defs/opts"
+)
+
+func TestWriteShardAtDiskIO(t *testing.T) {
+	opt := opts.DefaultOptions()
+	opt.BuildDownloadPath(t.TempDir())
+	if err := opt.BuildDiskIOConfig(&opts.DiskIOConfig{SyncBytes: -1}); err == nil {
+		t.Fatal("负数的 fsync 字节数应被拒绝")
+	}
+
+	content := make([]byte, 3*directAlign+777) // 片段大小与偏移均不对齐
+	rand.Read(content)
+	task := &DownloadTask{
+		File:       &DownloadFile{FileID: "file-1", Size: int64(len(content))},
+		DataPieces: 3,
+		DiskIO:     &opts.DiskIOConfig{DirectIO: true, DropCache: true, SyncBytes: 2 * directAlign},
+	}
+
+	size := task.shardSize()
+	for index := 0; index < task.DataPieces; index++ {
+		end := int64(index+1) * size
+		if end > int64(len(content)) {
+			end = int64(len(content))
+		}
+		if err := task.writeShardAt(opt, index, content[int64(index)*size:end]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := task.flushAssembly(opt); err != nil {
+		t.Fatal(err)
+	}
+	if task.disk.unsynced != 0 || task.disk.lastSync.IsZero() {
+		t.Fatalf("完成时应写回全部内容: %+v", task.disk)
+	}
+
+	got, err := os.ReadFile(task.assemblyPath(opt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatal("写入的内容不一致")
+	}
+
+	// 任务未单独设置时使用全局参数
+	task.DiskIO = nil
+	if cfg := task.diskIOConfig(opt); cfg != opt.GetDiskIOConfig() {
+		t.Fatal("应使用全局磁盘参数")
+	}
+}
@@ -1,6 +1,10 @@
 package downloads
 
-import "github.com/libp2p/go-libp2p/core/peer"
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
 
 const (
 	version = "1.0.0"
@@ -15,6 +19,9 @@ const (
 	StatusCompleted   DownloadStatus = "completed"   // 下载完成
 	StatusFailed      DownloadStatus = "failed"      // 下载失败
 	StatusPaused      DownloadStatus = "paused"      // 下载暂停
+
+	StatusWaitingForNetwork DownloadStatus = "waiting_for_network" // 等待网络，离线或文件片段所在节点不可达时排队
+	StatusQueued            DownloadStatus = "queued"              // 等待名额，同时进行的下载任务达到上限时排队
 )
 
 // 文件片段的下载状态
@@ -39,6 +46,9 @@ type DownloadChan struct {
 	UsesErasureCodes bool    // 是否使用纠删码技术
 	NodeID           peer.ID // 存储该文件片段的节点ID
 	DownloadTime     int64   // 下载完成时间的时间戳
+
+	Throughput float64       // 平滑后的下载速度，单位为字节/秒
+	ETA        time.Duration // 预计剩余时间，无法估计时为 -1
 }
 
 type DownloadToLocal struct {
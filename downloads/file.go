@@ -1,6 +1,7 @@
 package downloads
 
 import (
+	"sort"
 	"sync"
 
 	"github.com/bpfs/defs/afero"
@@ -17,6 +18,9 @@ type DownloadFile struct {
 	Name        string   // 文件名，包括扩展名，描述文件的名称
 	Size        int64    // 文件大小，单位为字节，描述文件的总大小
 	ContentType string   // MIME类型，表示文件的内容类型，如"text/plain"
+	Codec       string   // 分片前使用的压缩算法，为空表示未压缩；此时 Size 为压缩后的大小
+	RawSize     int64    // 压缩前的文件大小，与 Codec 一同取自已验证签名的文件片段
+	Checksum    []byte   // 上传时原始文件的校验和，用于完整校验还原后的文件
 	Segments    sync.Map // 使用并发安全的 sync.Map 存储文件分片信息，键是分片索引 (int)，值是指向 FileSegment 结构体的指针 (*FileSegment)
 }
 
@@ -87,6 +91,7 @@ func (df *DownloadFile) ListAllSegments() map[int]*FileSegment {
 }
 
 // GetSegmentsToDownload 获取需要下载的文件片段索引
+// 纠删码片段只在数据片段不可用时按缺口数量加入，用于重建缺失的数据片段
 // 返回值：
 //   - []int: 需要下载的文件片段索引数组
 func (df *DownloadFile) GetSegmentsToDownload() []int {
@@ -95,6 +100,9 @@ func (df *DownloadFile) GetSegmentsToDownload() []int {
 	df.Segments.Range(func(key, value interface{}) bool {
 		index := key.(int)
 		segment := value.(*FileSegment)
+		if segment.IsRsCodes {
+			return true
+		}
 		if segment.IsStatus(SegmentStatusPending) || segment.IsStatus(SegmentStatusFailed) {
 			if segment.HasActiveNodes() {
 				segmentsToDownload = append(segmentsToDownload, index)
@@ -103,7 +111,58 @@ func (df *DownloadFile) GetSegmentsToDownload() []int {
 		return true
 	})
 
-	return segmentsToDownload
+	return append(segmentsToDownload, df.GetParityToDownload()...)
+}
+
+// ParityShortfall 获取需要由纠删码片段补足的数据片段数量
+// 下载失败或没有可用节点的未完成数据片段，减去已在下载或已完成的纠删码片段
+// 返回值：
+//   - int: 还需下载的纠删码片段数量
+func (df *DownloadFile) ParityShortfall() int {
+	shortfall := 0
+	df.Segments.Range(func(key, value interface{}) bool {
+		segment := value.(*FileSegment)
+		switch {
+		case segment.IsRsCodes:
+			if segment.IsStatus(SegmentStatusDownloading) || segment.IsStatus(SegmentStatusCompleted) {
+				shortfall--
+			}
+		case segment.IsStatus(SegmentStatusCompleted):
+		case segment.IsStatus(SegmentStatusFailed) || !segment.HasActiveNodes():
+			shortfall++
+		}
+		return true
+	})
+
+	if shortfall < 0 {
+		return 0
+	}
+	return shortfall
+}
+
+// GetParityToDownload 获取用于补足不可用数据片段的纠删码片段索引
+// 返回值：
+//   - []int: 需要下载的纠删码片段索引数组，按索引升序排列
+func (df *DownloadFile) GetParityToDownload() []int {
+	shortfall := df.ParityShortfall()
+	if shortfall == 0 {
+		return nil
+	}
+
+	var candidates []int
+	df.Segments.Range(func(key, value interface{}) bool {
+		segment := value.(*FileSegment)
+		if segment.IsRsCodes && (segment.IsStatus(SegmentStatusPending) || segment.IsStatus(SegmentStatusFailed)) && segment.HasActiveNodes() {
+			candidates = append(candidates, key.(int))
+		}
+		return true
+	})
+
+	sort.Ints(candidates)
+	if len(candidates) > shortfall {
+		candidates = candidates[:shortfall]
+	}
+	return candidates
 }
 
 // GetPendingSegmentsForNode 获取特定节点下的待下载文件片段索引和唯一标识的映射
@@ -186,6 +245,11 @@ func (df *DownloadFile) IsSegmentCompleted(opt *opts.Options, afe afero.Afero, i
 		return true, false, nil
 	}
 
+	// 数据片段已直接写入输出文件，没有单独的片段文件
+	if !segment.IsRsCodes {
+		return true, true, nil
+	}
+
 	// 读取文件
 	sliceContent, err := util.Read(opt, afe, subDir, segment.SegmentID)
 	if err != nil {
@@ -203,20 +267,23 @@ func (df *DownloadFile) IsSegmentCompleted(opt *opts.Options, afe afero.Afero, i
 }
 
 // CheckMissingNodes 检查文件信息中不是纠删码片段的片段，是否存在节点ID是空的
-// 如果有存在节点ID为空的片段，返回true，表示还有切片的节点ID没有拿到，否则返回false
+// 缺少节点的数据片段可由已有节点的纠删码片段重建时，不视为缺失
+// 如果有无法补足的片段，返回true，表示还有切片的节点ID没有拿到，否则返回false
 // 返回值：
-//   - bool: 是否存在节点ID为空的片段
+//   - bool: 是否存在无法由纠删码片段补足的缺失节点
 func (df *DownloadFile) CheckMissingNodes() bool {
-	missingNodes := false
+	missing, parity := 0, 0
 	df.Segments.Range(func(key, value interface{}) bool {
 		segment := value.(*FileSegment)
-		if !segment.IsRsCodes && !segment.HasNodes() {
-			missingNodes = true
-			return false
+		switch {
+		case segment.IsRsCodes && segment.HasNodes():
+			parity++
+		case !segment.IsRsCodes && !segment.HasNodes():
+			missing++
 		}
 		return true
 	})
-	return missingNodes
+	return missing > parity
 }
 
 // AddSegmentNodes 添加文件片段所在的节点信息
@@ -0,0 +1,51 @@
+package downloads
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/test"
+)
+
+func TestParityFallback(t *testing.T) {
+	node := test.RandPeerIDFatal(t)
+	file := &DownloadFile{FileID: "file-1"}
+	// 0-3 为数据片段，4-6 为纠删码片段
+	for i := 0; i < 7; i++ {
+		segment := &FileSegment{Index: i, IsRsCodes: i >= 4, Status: SegmentStatusPending}
+		if i != 1 && i != 2 {
+			segment.AddNode(node, true)
+		}
+		file.AddSegment(i, segment)
+	}
+
+	if file.CheckMissingNodes() {
+		t.Fatal("纠删码片段足以补足缺少节点的数据片段")
+	}
+	got := file.GetSegmentsToDownload()
+	sort.Ints(got)
+	if !reflect.DeepEqual(got, []int{0, 3, 4, 5}) {
+		t.Fatalf("应下载可用的数据片段及两个纠删码片段, 实际 %v", got)
+	}
+
+	file.SetSegmentStatus(4, SegmentStatusCompleted)
+	file.SetSegmentStatus(0, SegmentStatusFailed)
+	if got = file.GetParityToDownload(); !reflect.DeepEqual(got, []int{5, 6}) {
+		t.Fatalf("数据片段 0 下载失败后应再补一个纠删码片段, 实际 %v", got)
+	}
+
+	file.SetSegmentStatus(0, SegmentStatusCompleted)
+	file.SetSegmentStatus(5, SegmentStatusDownloading)
+	if n := file.ParityShortfall(); n != 0 {
+		t.Fatalf("缺口已补足, 实际 %d", n)
+	}
+}
+
+func TestReconstructedRoundTrip(t *testing.T) {
+	task := &DownloadTask{TaskID: "task-1", File: &DownloadFile{FileID: "file-1"}}
+	task.provenance.reconstruct([]int{2, 1})
+	if got := task.Provenance().Reconstructed; !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Fatalf("重建片段记录不符: %v", got)
+	}
+}
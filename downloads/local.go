@@ -4,16 +4,19 @@ import (
 	"bytes"
 	"crypto/md5"
 	"fmt"
-	"path/filepath"
+	"time"
 
 	"github.com/bpfs/defs/afero"
 	"github.com/bpfs/defs/crypto/gcm"
 	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/middleware"
 	"github.com/bpfs/defs/opts"
-	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/defs/qos"
 	"github.com/bpfs/defs/script"
 	"github.com/bpfs/defs/segment"
 	"github.com/bpfs/defs/sign/ecdsa"
+	"github.com/bpfs/defs/stats"
 	"github.com/bpfs/defs/util"
 	"github.com/bpfs/defs/zip/gzip"
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -45,8 +48,16 @@ func (task *DownloadTask) sendDownloadRequest(
 	prioritySegment int,
 	segmentInfo map[int]string,
 ) bool {
+	// 按任务的服务等级获取传输槽位
+	release, err := opt.GetScheduler().Acquire(task.ctx, task.QoS)
+	if err != nil {
+		return false
+	}
+	defer release()
+
 	// 向指定的节点发送请求以下载文件片段
-	reply, err := RequestStreamGetSliceToLocal(p2p, receiver, downloadMaximumSize, task.UserPubHash, task.TaskID, task.File.FileID, prioritySegment, segmentInfo)
+	start := time.Now()
+	reply, err := RequestStreamGetSliceToLocal(qos.WithClass(task.ctx, task.QoS), p2p, receiver, downloadMaximumSize, task.UserPubHash, task.TaskID, task.File.FileID, prioritySegment, segmentInfo, task.Delegation)
 	if err != nil {
 		logrus.Errorf("[%s]向指定的节点发送请求以下载文件片段失败: %v", debug.WhereAmI(), err)
 		return false
@@ -56,6 +67,15 @@ func (task *DownloadTask) sendDownloadRequest(
 		return false
 	}
 
+	// 按实际接收的字节数占用带宽份额，限制后续请求的速率
+	received := segmentInfoSize(reply.SegmentInfo)
+	opt.GetCounters().AddFetched(int64(received))
+	opt.GetBandwidth().Record(receiver, received, time.Since(start))
+	stats.MarkUseful(receiver, p2p.RoutingTable(1), p2p.RoutingTable(2))
+	if err := opt.GetScheduler().WaitN(task.ctx, task.QoS, received); err != nil {
+		return false
+	}
+
 	// 处理下载文件片段的回复信息
 	if _, err := processSegmentInfo(opt, afe, p2p, task, receiver, reply.SegmentInfo, downloadChan); err != nil {
 		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
@@ -69,15 +89,28 @@ func (task *DownloadTask) sendDownloadRequest(
 // 参数：
 //   - task: *DownloadTask 下载任务
 //   - index: int 文件片段的索引
+//   - size: int 文件片段的大小，用于统计下载速度
 //
 // 返回值：
 //   - bool: 是否触发了合并操作
-func updateDownloadProgress(task *DownloadTask, index int) {
+func updateDownloadProgress(task *DownloadTask, index int, size int) {
 	// func updateDownloadProgress(task *DownloadTask, index int) bool {
 	// 设置文件片段的下载状态: 下载完成
 	task.File.SetSegmentStatus(index, SegmentStatusCompleted)
 	task.Progress.Set(index)
 
+	// 更新下载速度与最后一次下载成功的时间
+	now := time.Now()
+	task.throughput.add(size, now)
+	task.rwmu.Lock()
+	task.UpdatedAt = now.Unix()
+	task.rwmu.Unlock()
+
+	// 合并保存进度，崩溃时未保存的片段在启动核对后重新下载
+	if task.onProgress != nil {
+		task.onProgress()
+	}
+
 	// 检查已完成的片段数量并触发合并操作
 	// return task.CheckAndTriggerMerge()
 }
@@ -89,16 +122,10 @@ func updateDownloadProgress(task *DownloadTask, index int) {
 func requestErasureCodeDownload(task *DownloadTask, index int) {
 	// 检查指定索引的片段状态是否为下载失败
 	if segment, ok := task.File.GetSegment(index); ok && segment.IsStatus(SegmentStatusFailed) {
-		// 遍历所有文件片段，查找纠删码片段
-		task.File.Segments.Range(func(key, value interface{}) bool {
-			segment := value.(*FileSegment)
-			// 如果片段是纠删码片段并且状态为待下载，触发下载事件
-			if segment.IsRsCodes && segment.IsStatus(SegmentStatusPending) {
-				task.EventDownSnippetChan(segment.Index) // 传递需要下载的片段索引
-				return false                             // 终止遍历
-			}
-			return true // 继续遍历
-		})
+		// 按不可用数据片段的缺口数量触发纠删码片段的下载
+		for _, parity := range task.File.GetParityToDownload() {
+			task.EventDownSnippetChan(parity) // 传递需要下载的片段索引
+		}
 	}
 }
 
@@ -118,16 +145,21 @@ func requestErasureCodeDownload(task *DownloadTask, index int) {
 // }
 
 // writeToLocalFile 写入本地文件
+// 数据片段直接写入输出文件中对应的位置，纠删码片段单独保存在下载目录中
 // 参数：
-//   - fs: *afero.FileStore 文件存储对象，用于文件的读写操作
-//   - secret: []byte 文件加密密钥
-//   - fileID: string 文件唯一标识
+//   - opt: *opts.Options 文件存储选项配置
+//   - afe: afero.Afero 文件系统接口
+//   - p2p: *dep2p.DeP2P 网络主机
+//   - task: *DownloadTask 当前下载任务
 //   - segmentID: string 文件片段的唯一标识
 //   - data: []byte 文件片段数据
+//   - receiveCtx: *middleware.SegmentReceiveContext 片段接收上下文，用于执行片段接收后的中间件
 //
 // 返回值：
 //   - error: 如果发生错误，返回错误信息
-func writeToLocalFile(opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, secret []byte, fileID, segmentID string, data []byte) error {
+func writeToLocalFile(opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, task *DownloadTask, segmentID string, data []byte, receiveCtx *middleware.SegmentReceiveContext) error {
+	fileID := task.File.FileID
+
 	// 创建一个字节读取器
 	bytesReader := bytes.NewReader(data)
 
@@ -150,17 +182,22 @@ func writeToLocalFile(opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, secr
 		"SEGMENTCHECKSUM", // 分片的校验和
 		"CONTENT",         // 文件片段的内容(加密)
 		"SIGNATURE",       // 文件和文件片段的数据签名
+		"CODEC",           // 分片前使用的压缩算法，未压缩时没有该段
+		"RAWSIZE",         // 压缩前的文件大小，未压缩时没有该段
 	}
 
 	// 从字节数据中读取字段
 	segmentResults, err := segment.ReadFieldsFromBytes(data, segmentTypes, xref)
 	if err != nil {
 		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
-		return fmt.Errorf("非法文件片段")
+		return fmt.Errorf("%w: %s", errs.ErrSegmentCorrupt, segmentID)
 	}
 
 	// 检查并提取每个段的数据
-	for _, result := range segmentResults {
+	for segmentType, result := range segmentResults {
+		if result.Error != nil && (segmentType == "CODEC" || segmentType == "RAWSIZE") {
+			continue // 未压缩的文件片段没有该段
+		}
 		if result.Error != nil {
 			logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
 			return err
@@ -176,8 +213,8 @@ func writeToLocalFile(opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, secr
 
 	// 检查文件ID和片段ID是否匹配
 	if fileID != string(fileIDData) || segmentID != string(segmentIDData) {
-		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
-		return err
+		logrus.Errorf("[%s]文件片段 %s 的标识不匹配", debug.WhereAmI(), segmentID)
+		return fmt.Errorf("%w: %s 的标识不匹配", errs.ErrSegmentCorrupt, segmentID)
 	}
 
 	// 从脚本中提取公钥
@@ -187,8 +224,8 @@ func writeToLocalFile(opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, secr
 		return err
 	}
 
-	// 组装签名数据
-	merged, err := util.MergeFieldsForSigning(
+	// 组装签名数据，压缩的文件同时签名了压缩算法与压缩前的大小
+	fields := []interface{}{
 		segmentResults["FILEID"].Data,
 		segmentResults["CONTENTTYPE"].Data,
 		segmentResults["CHECKSUM"].Data,
@@ -197,7 +234,16 @@ func writeToLocalFile(opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, secr
 		segmentResults["INDEX"].Data,
 		segmentResults["SEGMENTCHECKSUM"].Data,
 		segmentResults["CONTENT"].Data,
-	)
+	}
+	codec, rawSize, err := signedCodec(segmentResults)
+	if err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return fmt.Errorf("%w: %s 的压缩信息无效", errs.ErrSegmentCorrupt, segmentID)
+	}
+	if codec != "" {
+		fields = append(fields, segmentResults["CODEC"].Data, segmentResults["RAWSIZE"].Data)
+	}
+	merged, err := util.MergeFieldsForSigning(fields...)
 	if err != nil {
 		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
 		return err
@@ -207,9 +253,12 @@ func writeToLocalFile(opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, secr
 	valid, err := ecdsa.VerifySignature(pubKey, merged, signatureData)
 	if err != nil || !valid {
 		logrus.Errorf("[%s]使用ECDSA公钥验证数据的签名时失败: %v", debug.WhereAmI(), err)
-		return fmt.Errorf("验证数据的签名时失败") // 签名验证失败
+		return fmt.Errorf("%w: %s 的签名无效", errs.ErrSegmentCorrupt, segmentID) // 签名验证失败
 	}
 
+	// 以签名的压缩信息为准，不采用其他节点在清单中提供的值
+	task.setCodec(codec, rawSize)
+
 	// 解压数据
 	decompressData, err := gzip.DecompressData(contentData)
 	if err != nil {
@@ -218,16 +267,29 @@ func writeToLocalFile(opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, secr
 	}
 
 	// 使用密钥对数据进行解密
-	key := md5.Sum(secret)
+	key := md5.Sum(task.Secret)
 	content, err := gcm.DecryptData(decompressData, key[:])
 	if err != nil {
 		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
 		return err
 	}
 
+	// 执行片段接收后的中间件
+	receiveCtx.Data = content
+	if err := opt.GetMiddleware().RunAfterSegmentReceive(receiveCtx); err != nil {
+		logrus.Errorf("[%s]中间件拒绝写入文件片段 %s: %v", debug.WhereAmI(), segmentID, err)
+		return err
+	}
+
+	// 数据片段写入输出文件中对应的位置
+	if task.isAssembledShard(receiveCtx.Index) {
+		return task.writeShardAt(opt, receiveCtx.Index, receiveCtx.Data)
+	}
+
 	// 写入本地文件
-	subDir := filepath.Join(paths.GetDownloadPath(), p2p.Host().ID().String(), fileID)
-	if err := util.Write(opt, afe, subDir, segmentID, content); err != nil {
+	subDir := segmentDir(p2p.Host().ID(), fileID)
+	task.temp.trackDir(subDir)
+	if err := util.Write(opt, afe, subDir, segmentID, receiveCtx.Data); err != nil {
 		logrus.Errorf("[%s]写入本地文件失败: %v", debug.WhereAmI(), err)
 		return err
 	}
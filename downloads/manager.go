@@ -10,6 +10,8 @@ import (
 	"github.com/bpfs/defs/debug"
 	"github.com/bpfs/defs/opts"
 	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/defs/supervise"
+	"github.com/bpfs/defs/util"
 	"github.com/bpfs/dep2p"
 	"github.com/bpfs/dep2p/pubsub"
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -27,15 +29,28 @@ type DownloadManager struct {
 	DownloadChan    chan *DownloadChan       // 下载状态更新通道，用于通知外部下载进度和状态
 	SaveTasksToFile chan struct{}            // 保存任务至文件通道
 	AsyncDownload   chan *AsyncDownload      // 需要异步下载的文件片段信息
+	recovery        *RecoveryReport          // 启动时核对任务状态的结果
+	approvals       *approvals               // 受限文件与下载申请
+	progress        *util.Coalescer          // 合并片段完成后的任务保存
+	admission       admission                // 同时进行的下载任务与等待名额的任务
+
+	// 续传前核对已完成片段时使用
+	opt  *opts.Options // 文件存储选项配置
+	afe  afero.Afero   // 文件系统接口
+	self peer.ID       // 本节点的ID
+
+	supervisor *supervise.Supervisor // 后台任务的崩溃恢复
 }
 
 type NewDownloadManagerInput struct {
 	fx.In
-	LC  fx.Lifecycle
-	Ctx context.Context // 全局上下文
-	Opt *opts.Options   // 文件存储选项配置
-	Afe afero.Afero     // 文件系统接口
-	P2P *dep2p.DeP2P    // 网络主机
+	LC         fx.Lifecycle
+	Ctx        context.Context       // 全局上下文
+	Opt        *opts.Options         // 文件存储选项配置
+	Afe        afero.Afero           // 文件系统接口
+	P2P        *dep2p.DeP2P          // 网络主机
+	PubSub     *pubsub.DeP2PPubSub   // 网络订阅
+	Supervisor *supervise.Supervisor // 后台任务的崩溃恢复
 }
 
 type NewDownloadManagerOutput struct {
@@ -59,6 +74,18 @@ func NewDownloadManager(input NewDownloadManagerInput) (out NewDownloadManagerOu
 		DownloadChan:    make(chan *DownloadChan),       // 下载状态更新通道
 		SaveTasksToFile: make(chan struct{}, 1),         // 保存任务至文件通道，缓冲区大小为1，只保存最新的信息
 		AsyncDownload:   make(chan *AsyncDownload, 10),  // 需要异步下载的文件片段信息
+		approvals:       newApprovals(),                 // 受限文件与下载申请
+		opt:             input.Opt,                      // 文件存储选项配置
+		afe:             input.Afe,                      // 文件系统接口
+		self:            input.P2P.Host().ID(),          // 本节点的ID
+		supervisor:      input.Supervisor,               // 后台任务的崩溃恢复
+	}
+	flush := input.Opt.GetProgressFlushConfig()
+	download.progress = util.NewCoalescer(flush.Interval, flush.MaxPending, download.SaveTasksToFileSingleChan)
+
+	// 加载受限文件列表
+	if err := download.approvals.load(input.Afe); err != nil {
+		logrus.Errorf("[%s]加载受限文件列表失败: %v", debug.WhereAmI(), err)
 	}
 
 	filePath := filepath.Join(paths.GetRootPath(), paths.GetDownloadPath(), "tasks") // 设置子目录
@@ -77,20 +104,45 @@ func NewDownloadManager(input NewDownloadManagerInput) (out NewDownloadManagerOu
 		}
 	}
 
+	// 核对崩溃前声称下载中的任务
+	download.recovery = download.Recover(input.Opt, input.Afe, input.P2P.Host().ID())
+	download.recovery.log()
+
 	out.Download = download
 
+	// 后台任务崩溃时保存任务，重启后从保存的状态继续
+	input.Supervisor.OnCrash("downloads", func() { download.saveTasks(filePath) })
+
 	input.LC.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
 			// 应用启动时的逻辑，例如初始化资源、启动后台服务等
 			logrus.Println("下载管理器已启动")
+
+			// 回收崩溃遗留的临时空间
+			if n := out.Download.SweepTempSpace(input.Opt, input.Afe, input.P2P.Host().ID()); n > 0 {
+				logrus.Infof("回收了 %d 个遗留的下载临时文件", n)
+			}
 			// 启动定时保存任务的定时器
-			go out.Download.PeriodicSave(filePath, time.Minute)
+			input.Supervisor.Go("downloads", "periodic-save", func() { out.Download.PeriodicSave(filePath, time.Minute) })
 
 			// 启动通道事件
-			go out.Download.ChannelEvents(input.Opt, input.Afe, input.P2P)
+			input.Supervisor.Go("downloads", "channel-events", func() { out.Download.ChannelEvents(input.Opt, input.Afe, input.P2P) })
 
 			// 保存任务至文件
-			go out.Download.SaveTasksToFileSingleChan()
+			input.Supervisor.Spawn("downloads", "save-tasks", out.Download.SaveTasksToFileSingleChan)
+
+			// 定期使等待超时的下载申请失效
+			input.Supervisor.Go("downloads", "approval-expiry", func() { out.Download.approvals.runExpiry(out.Download.ctx, input.Opt, time.Minute) })
+
+			// 同步离线期间错过的撤销列表
+			input.Supervisor.Go("downloads", "revocation-sync", func() {
+				runRevocationSync(out.Download.ctx, input.Afe, input.P2P, RevocationSyncInterval)
+			})
+
+			// 网络恢复后启动等待网络的下载任务
+			input.Supervisor.Go("downloads", "offline-queue", func() {
+				out.Download.runOfflineQueue(input.Opt, input.Afe, input.P2P, input.PubSub, OfflineQueueCheckInterval)
+			})
 
 			return nil
 		},
@@ -100,8 +152,8 @@ func NewDownloadManager(input NewDownloadManagerInput) (out NewDownloadManagerOu
 			logrus.Println("下载管理器正在停止")
 			out.Download.cancel() // 调用取消函数，确保所有协程被正确终止
 
-			// 保存任务至文件
-			go out.Download.SaveTasksToFileSingleChan()
+			// 保存任务至文件，包括尚未保存的进度
+			out.Download.saveTasks(filePath)
 
 			return nil
 		},
@@ -124,30 +176,42 @@ func (manager *DownloadManager) PeriodicSave(filePath string, interval time.Dura
 			return
 		case <-ticker.C:
 			// 保存任务数据到文件
-			go manager.saveTasks(filePath)
+			manager.supervisor.Spawn("downloads", "save-tasks", func() { manager.saveTasks(filePath) })
 
 		case <-manager.SaveTasksToFile:
 			// 保存任务数据到文件
-			go manager.saveTasks(filePath)
+			manager.supervisor.Spawn("downloads", "save-tasks", func() { manager.saveTasks(filePath) })
 		}
 	}
 }
 
-// ChannelEvents 通道事件
+// ChannelEvents 处理通道事件，直到管理器停止
 func (manager *DownloadManager) ChannelEvents(opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P) {
-	go func() {
-		for {
-			select {
-			case asyncDownload := <-manager.AsyncDownload:
+	for {
+		select {
+		case asyncDownload := <-manager.AsyncDownload:
 
-				// 处理异步下载
-				go manager.handleAsyncDownload(opt, afe, p2p, asyncDownload)
+			// 处理异步下载
+			manager.supervisor.Spawn("downloads", "async-download", func() { manager.handleAsyncDownload(opt, afe, p2p, asyncDownload) })
 
-			case <-manager.ctx.Done():
-				return
-			}
+		case <-manager.ctx.Done():
+			return
 		}
-	}()
+	}
+}
+
+// TaskStatusCounts 获取各状态的下载任务数量
+// 返回值：
+//   - map[string]int: 下载任务状态到任务数量的映射
+func (manager *DownloadManager) TaskStatusCounts() map[string]int {
+	manager.Mu.Lock()
+	defer manager.Mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, task := range manager.Tasks {
+		counts[string(task.GetDownloadStatus())]++
+	}
+	return counts
 }
 
 // RegisterTask 向管理器注册一个新的下载任务。
@@ -161,27 +225,51 @@ func (manager *DownloadManager) RegisterTask(opt *opts.Options, afe afero.Afero,
 		manager.Tasks[task.TaskID] = task
 		logrus.Printf("添加任务: %s 成功。\n", task.TaskID)
 
-		// 启动通道事件处理
-		go task.ChannelEvents(opt, afe, p2p, pubsub, manager)
+		// 达到并发上限时进入等待队列，获得名额后启动
+		manager.admit(task, func() {
+			if task.GetDownloadStatus() == StatusQueued {
+				task.SetDownloadStatus(StatusPending)
+			}
+			manager.startTask(opt, afe, p2p, pubsub, task)
+		})
+	} else {
+		logrus.Printf("任务: %s 已存在。\n", task.TaskID)
+	}
+}
 
-		// 启动定时任务，检查是否需要下载新的索引清单
-		go task.CheckForNewChecklist()
+// startTask 启动下载任务的通道事件与定时任务
+func (manager *DownloadManager) startTask(opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, pubsub *pubsub.DeP2PPubSub, task *DownloadTask) {
+	// 从文件恢复的任务没有上下文
+	if task.ctx == nil {
+		task.ctx, task.cancel = context.WithCancel(manager.ctx)
+	}
 
-		// 启动定时任务，检查是否需要下载文件片段
-		go task.CheckForDownSnippet()
+	// 片段完成后合并保存任务
+	task.onProgress = manager.progress.Mark
+	task.supervisor = manager.supervisor
 
-		// 启动定时任务，检查是否需要合并文件
-		go task.CheckForMergeFiles()
+	// 启动通道事件处理
+	task.spawn("channel-events", func() { task.ChannelEvents(opt, afe, p2p, pubsub, manager) })
 
-	} else {
-		logrus.Printf("任务: %s 已存在。\n", task.TaskID)
-	}
+	// 启动定时任务，检查是否需要下载新的索引清单
+	task.spawn("check-checklist", task.CheckForNewChecklist)
+
+	// 启动定时任务，检查是否需要下载文件片段
+	task.spawn("check-snippet", task.CheckForDownSnippet)
+
+	// 启动定时任务，检查是否需要合并文件
+	task.spawn("check-merge", task.CheckForMergeFiles)
 }
 
 // saveTasks 保存任务数据到文件
 // 参数：
 //   - filePath: string 文件路径
 func (manager *DownloadManager) saveTasks(filePath string) {
+	// 只读模式下不写入任务文件，任务状态只保存在内存中
+	if manager.opt != nil && manager.opt.GetReadOnly() {
+		return
+	}
+
 	manager.Mu.Lock()
 	tasks := make(map[string]*DownloadTaskSerializable)
 	for id, task := range manager.Tasks {
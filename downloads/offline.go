@@ -0,0 +1,194 @@
+package downloads
+
+import (
+	"context"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/dep2p"
+	"github.com/bpfs/dep2p/pubsub"
+	libp2pnetwork "github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+)
+
+// 节点离线或文件片段所在节点均不可达时，新的下载任务不立即开始，而是进入等待网络状态并保存；
+// 之后在建立新连接时及每隔一段时间检查一次，网络恢复后自动开始下载，超过截止时间仍未恢复的任务标记为失败。
+
+const (
+	OfflineQueueCheckInterval = 30 * time.Second // 检查等待网络的下载任务的间隔
+	OfflineQueueDialTimeout   = 10 * time.Second // 检查时连接文件片段所在节点的超时时间
+)
+
+// providers 获取文件片段所在的全部节点
+func (df *DownloadFile) providers() []peer.ID {
+	seen := make(map[peer.ID]bool)
+	var result []peer.ID
+	for _, segment := range df.ListAllSegments() {
+		for id := range segment.GetNodes() {
+			if !seen[id] {
+				seen[id] = true
+				result = append(result, id)
+			}
+		}
+	}
+	return result
+}
+
+// providersReachable 判断下载任务能否开始
+// 本节点至少连接了一个节点，且已知文件片段所在节点时，其中至少一个节点可以连接
+// 参数：
+//   - ctx: context.Context 上下文
+//   - p2p: *dep2p.DeP2P 网络主机
+//   - task: *DownloadTask 下载任务
+//
+// 返回值：
+//   - bool: 是否可以开始下载
+func providersReachable(ctx context.Context, p2p *dep2p.DeP2P, task *DownloadTask) bool {
+	h := p2p.Host()
+	if len(h.Network().Peers()) == 0 {
+		return false
+	}
+
+	providers := task.File.providers()
+	if len(providers) == 0 {
+		// 未知文件片段所在节点时，通过已连接的节点查找
+		return true
+	}
+	for _, id := range providers {
+		if h.Network().Connectedness(id) == libp2pnetwork.Connected {
+			return true
+		}
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, OfflineQueueDialTimeout)
+	defer cancel()
+	for _, id := range providers {
+		if err := h.Connect(dialCtx, peer.AddrInfo{ID: id}); err == nil {
+			return true
+		}
+		if dialCtx.Err() != nil {
+			break
+		}
+	}
+	return false
+}
+
+// queueOffline 将下载任务加入管理器并进入等待网络状态
+// 参数：
+//   - task: *DownloadTask 下载任务
+//   - ttl: time.Duration 等待网络的最长时间
+func (manager *DownloadManager) queueOffline(task *DownloadTask, ttl time.Duration) {
+	task.rwmu.Lock()
+	task.WaitUntil = time.Now().Add(ttl).Unix()
+	task.rwmu.Unlock()
+	task.SetDownloadStatus(StatusWaitingForNetwork)
+
+	manager.Mu.Lock()
+	manager.Tasks[task.TaskID] = task
+	manager.Mu.Unlock()
+
+	logrus.Infof("[%s]网络不可用，下载任务 %s 等待网络恢复", debug.WhereAmI(), task.TaskID)
+}
+
+// waitingTasks 获取等待网络的下载任务
+func (manager *DownloadManager) waitingTasks() []*DownloadTask {
+	manager.Mu.Lock()
+	defer manager.Mu.Unlock()
+
+	var tasks []*DownloadTask
+	for _, task := range manager.Tasks {
+		if task.GetDownloadStatus() == StatusWaitingForNetwork {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// checkOfflineQueue 检查等待网络的下载任务：过期的标记为失败，网络恢复的开始下载
+// 参数：
+//   - opt: *opts.Options 文件存储选项配置
+//   - afe: afero.Afero 文件系统接口
+//   - p2p: *dep2p.DeP2P 网络主机
+//   - pubsub: *pubsub.DeP2PPubSub 网络订阅
+//   - now: time.Time 当前时间
+//
+// 返回值：
+//   - int: 开始下载的任务数量，不包括因达到并发上限而进入等待队列的任务
+func (manager *DownloadManager) checkOfflineQueue(opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, pubsub *pubsub.DeP2PPubSub, now time.Time) int {
+	started, changed := 0, false
+	for _, task := range manager.waitingTasks() {
+		task.rwmu.RLock()
+		waitUntil := task.WaitUntil
+		task.rwmu.RUnlock()
+
+		// 调用方已取消或等待超时
+		if (task.ctx != nil && task.ctx.Err() != nil) || now.Unix() > waitUntil {
+			logrus.Warnf("[%s]下载任务 %s 等待网络超时或已取消", debug.WhereAmI(), task.TaskID)
+			task.SetDownloadStatus(StatusFailed)
+			if task.cancel != nil {
+				task.cancel()
+			}
+			changed = true
+			continue
+		}
+
+		if p2p == nil || !providersReachable(manager.ctx, p2p, task) {
+			continue
+		}
+
+		logrus.Infof("[%s]网络已恢复，开始下载任务 %s", debug.WhereAmI(), task.TaskID)
+		task.SetDownloadStatus(StatusPending)
+		if manager.admit(task, func() {
+			if task.GetDownloadStatus() == StatusQueued {
+				task.SetDownloadStatus(StatusPending)
+			}
+			manager.startTask(opt, afe, p2p, pubsub, task)
+		}) {
+			started++
+		}
+		changed = true
+	}
+
+	if changed {
+		go manager.SaveTasksToFileSingleChan()
+	}
+	return started
+}
+
+// runOfflineQueue 定期及在建立新连接时检查等待网络的下载任务，直到管理器停止
+// 参数：
+//   - opt: *opts.Options 文件存储选项配置
+//   - afe: afero.Afero 文件系统接口
+//   - p2p: *dep2p.DeP2P 网络主机
+//   - pubsub: *pubsub.DeP2PPubSub 网络订阅
+//   - interval: time.Duration 检查间隔
+func (manager *DownloadManager) runOfflineQueue(opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, pubsub *pubsub.DeP2PPubSub, interval time.Duration) {
+	wake := make(chan struct{}, 1)
+	notifee := &libp2pnetwork.NotifyBundle{
+		ConnectedF: func(libp2pnetwork.Network, libp2pnetwork.Conn) {
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		},
+	}
+	p2p.Host().Network().Notify(notifee)
+	defer p2p.Host().Network().StopNotify(notifee)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		manager.checkOfflineQueue(opt, afe, p2p, pubsub, time.Now())
+
+		select {
+		case <-manager.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
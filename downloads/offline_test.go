@@ -0,0 +1,57 @@
+package downloads
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCheckOfflineQueue(t *testing.T) {
+	now := time.Now()
+	owner, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	newTask := func(id string) *DownloadTask {
+		task := &DownloadTask{TaskID: id, File: &DownloadFile{FileID: id}, OwnerPriv: owner}
+		task.ctx, task.cancel = context.WithCancel(context.Background())
+		task.StatusCond = sync.NewCond(&task.rwmu)
+		return task
+	}
+
+	manager := &DownloadManager{
+		ctx:             context.Background(),
+		Tasks:           make(map[string]*DownloadTask),
+		SaveTasksToFile: make(chan struct{}, 1),
+	}
+	waiting, expired, canceled := newTask("waiting"), newTask("expired"), newTask("canceled")
+	for _, task := range []*DownloadTask{waiting, expired, canceled} {
+		manager.queueOffline(task, time.Hour)
+	}
+	expired.WaitUntil = now.Add(-time.Second).Unix()
+	canceled.cancel()
+
+	// 截止时间随任务一起保存
+	serializable, err := waiting.ToSerializable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serializable.WaitUntil != waiting.WaitUntil || serializable.Status != StatusWaitingForNetwork {
+		t.Fatalf("serialized status = %s, wait until = %d", serializable.Status, serializable.WaitUntil)
+	}
+
+	// 没有网络时不开始任何任务，过期与已取消的任务标记为失败
+	if n := manager.checkOfflineQueue(nil, nil, nil, nil, now); n != 0 {
+		t.Fatalf("started = %d, want 0", n)
+	}
+	want := map[*DownloadTask]DownloadStatus{waiting: StatusWaitingForNetwork, expired: StatusFailed, canceled: StatusFailed}
+	for task, status := range want {
+		if got := task.GetDownloadStatus(); got != status {
+			t.Errorf("%s status = %s, want %s", task.TaskID, got, status)
+		}
+	}
+	if tasks := manager.waitingTasks(); len(tasks) != 1 || tasks[0] != waiting {
+		t.Fatalf("waiting tasks = %d, want 1", len(tasks))
+	}
+}
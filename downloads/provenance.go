@@ -0,0 +1,221 @@
+package downloads
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/defs/util"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// SegmentSource 记录单个文件片段由哪个节点提供
+type SegmentSource struct {
+	Index      int     // 分片索引
+	SegmentID  string  // 文件片段的唯一标识
+	Peer       peer.ID // 提供该片段的节点
+	Size       int     // 片段大小，单位为字节
+	ReceivedAt int64   // 接收并验证通过的时间戳
+}
+
+// PeerFault 记录节点提供的未通过验证的文件片段
+type PeerFault struct {
+	Index     int     // 分片索引
+	SegmentID string  // 文件片段的唯一标识
+	Peer      peer.ID // 提供该片段的节点
+	Reason    string  // 验证失败的原因
+	At        int64   // 发生的时间戳
+}
+
+// Provenance 下载任务的来源记录，列出各文件片段的提供节点及验证失败的片段
+// 下载的文件出现问题时，可据此追溯到提供错误数据的节点
+type Provenance struct {
+	TaskID        string           // 任务唯一标识
+	FileID        string           // 文件唯一标识
+	Segments      []*SegmentSource // 各文件片段的来源，按分片索引排列
+	Faults        []*PeerFault     // 未通过验证的片段，按发生时间排列
+	Reconstructed []int            // 未下载而由纠删码重建的数据片段索引
+	CompletedAt   int64            // 下载完成的时间戳，未完成时为 0
+}
+
+// FaultCounts 统计各节点提供的未通过验证的片段数量
+// 返回值：
+//   - map[peer.ID]int: 节点到验证失败次数的映射
+func (p *Provenance) FaultCounts() map[peer.ID]int {
+	counts := make(map[peer.ID]int)
+	for _, fault := range p.Faults {
+		counts[fault.Peer]++
+	}
+	return counts
+}
+
+// provenance 记录下载任务中各文件片段的来源
+type provenance struct {
+	mu      sync.Mutex
+	sources map[int]*SegmentSource // 分片索引到来源的映射
+	faults  []*PeerFault           // 未通过验证的片段
+
+	reconstructed []int // 由纠删码重建的数据片段索引
+}
+
+// record 记录文件片段的提供节点，同一片段以最后一次接收为准
+func (pv *provenance) record(index int, segmentID string, node peer.ID, size int, now time.Time) {
+	pv.mu.Lock()
+	defer pv.mu.Unlock()
+	if pv.sources == nil {
+		pv.sources = make(map[int]*SegmentSource)
+	}
+	pv.sources[index] = &SegmentSource{
+		Index:      index,
+		SegmentID:  segmentID,
+		Peer:       node,
+		Size:       size,
+		ReceivedAt: now.Unix(),
+	}
+}
+
+// fault 记录节点提供的未通过验证的文件片段
+func (pv *provenance) fault(index int, segmentID string, node peer.ID, reason error, now time.Time) {
+	pv.mu.Lock()
+	defer pv.mu.Unlock()
+	pv.faults = append(pv.faults, &PeerFault{
+		Index:     index,
+		SegmentID: segmentID,
+		Peer:      node,
+		Reason:    reason.Error(),
+		At:        now.Unix(),
+	})
+}
+
+// reconstruct 记录由纠删码重建的数据片段
+func (pv *provenance) reconstruct(indexes []int) {
+	pv.mu.Lock()
+	defer pv.mu.Unlock()
+	pv.reconstructed = append([]int(nil), indexes...)
+	sort.Ints(pv.reconstructed)
+}
+
+// reconstructedIndexes 返回由纠删码重建的数据片段索引
+func (pv *provenance) reconstructedIndexes() []int {
+	pv.mu.Lock()
+	defer pv.mu.Unlock()
+	return append([]int(nil), pv.reconstructed...)
+}
+
+// snapshot 返回来源记录的副本
+func (pv *provenance) snapshot(taskID, fileID string) *Provenance {
+	pv.mu.Lock()
+	defer pv.mu.Unlock()
+
+	p := &Provenance{
+		TaskID:   taskID,
+		FileID:   fileID,
+		Segments: make([]*SegmentSource, 0, len(pv.sources)),
+		Faults:   make([]*PeerFault, 0, len(pv.faults)),
+
+		Reconstructed: append([]int(nil), pv.reconstructed...),
+	}
+	for _, source := range pv.sources {
+		s := *source
+		p.Segments = append(p.Segments, &s)
+	}
+	sort.Slice(p.Segments, func(i, j int) bool { return p.Segments[i].Index < p.Segments[j].Index })
+	for _, fault := range pv.faults {
+		f := *fault
+		p.Faults = append(p.Faults, &f)
+	}
+	return p
+}
+
+// recordSegmentFault 记录未通过验证的文件片段，并将该节点标记为不再提供此片段
+// 仅记录数据损坏或签名无效的片段，网络错误不计入
+func (task *DownloadTask) recordSegmentFault(index int, segmentID string, node peer.ID, err error) {
+	if !errors.Is(err, errs.ErrSegmentCorrupt) {
+		return
+	}
+	task.provenance.fault(index, segmentID, node, err, time.Now())
+	if segment, ok := task.File.GetSegment(index); ok {
+		segment.SetNodeInactive(node)
+	}
+}
+
+// Provenance 获取下载任务当前的来源记录
+// 返回值：
+//   - *Provenance: 来源记录
+func (task *DownloadTask) Provenance() *Provenance {
+	return task.provenance.snapshot(task.TaskID, task.File.FileID)
+}
+
+// provenancePath 获取下载来源记录的保存路径
+func provenancePath(taskID string) string {
+	return filepath.Join(paths.GetDownloadPath(), "provenance", taskID+".json")
+}
+
+// SaveProvenance 保存下载任务的来源记录
+// 参数：
+//   - afe: afero.Afero 文件系统接口
+//   - p: *Provenance 来源记录
+//
+// 返回值：
+//   - error: 保存失败时返回错误
+func SaveProvenance(afe afero.Afero, p *Provenance) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	path := provenancePath(p.TaskID)
+	if err := afe.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(afe, path, data, 0644)
+}
+
+// LoadProvenance 加载下载任务的来源记录
+// 参数：
+//   - afe: afero.Afero 文件系统接口
+//   - taskID: string 任务唯一标识
+//
+// 返回值：
+//   - *Provenance: 来源记录
+//   - error: 记录不存在时返回包装了 errs.ErrNotFound 的错误
+func LoadProvenance(afe afero.Afero, taskID string) (*Provenance, error) {
+	data, err := afero.ReadFile(afe, provenancePath(taskID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: 下载任务 %s 的来源记录", errs.ErrNotFound, taskID)
+		}
+		return nil, err
+	}
+	p := new(Provenance)
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// GetProvenance 获取下载任务的来源记录，任务仍在管理器中时返回当前记录，否则读取已保存的记录
+// 参数：
+//   - afe: afero.Afero 文件系统接口
+//   - taskID: string 任务唯一标识
+//
+// 返回值：
+//   - *Provenance: 来源记录
+//   - error: 记录不存在时返回包装了 errs.ErrNotFound 的错误
+func (manager *DownloadManager) GetProvenance(afe afero.Afero, taskID string) (*Provenance, error) {
+	manager.Mu.Lock()
+	task, ok := manager.Tasks[taskID]
+	manager.Mu.Unlock()
+
+	if saved, err := LoadProvenance(afe, taskID); err == nil || !ok {
+		return saved, err
+	}
+	return task.Provenance(), nil
+}
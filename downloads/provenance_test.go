@@ -0,0 +1,53 @@
+package downloads
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/errs"
+	"github.com/libp2p/go-libp2p/core/test"
+)
+
+func TestProvenance(t *testing.T) {
+	task := &DownloadTask{TaskID: "task-1", File: &DownloadFile{FileID: "file-1"}}
+	good, bad := test.RandPeerIDFatal(t), test.RandPeerIDFatal(t)
+	now := time.Unix(1700000000, 0)
+
+	segment := &FileSegment{Index: 1, SegmentID: "seg-1"}
+	segment.AddNode(bad, true)
+	task.File.Segments.Store(1, segment)
+
+	task.provenance.record(2, "seg-2", good, 100, now)
+	task.recordSegmentFault(1, "seg-1", bad, fmt.Errorf("%w: seg-1 的签名无效", errs.ErrSegmentCorrupt))
+	task.recordSegmentFault(1, "seg-1", good, errors.New("连接已断开")) // 网络错误不计入
+	task.provenance.record(1, "seg-1", good, 100, now)
+
+	p := task.Provenance()
+	if len(p.Segments) != 2 || p.Segments[0].Index != 1 || p.Segments[1].Peer != good {
+		t.Fatalf("片段来源不符: %+v", p.Segments)
+	}
+	if counts := p.FaultCounts(); len(counts) != 1 || counts[bad] != 1 {
+		t.Fatalf("验证失败记录不符: %v", counts)
+	}
+	if segment.IsNodeActive(bad) {
+		t.Fatal("提供损坏片段的节点应被标记为不可用")
+	}
+
+	afe := afero.NewMemMapFs()
+	if _, err := LoadProvenance(afe, "task-1"); !errors.Is(err, errs.ErrNotFound) {
+		t.Fatalf("未保存时应返回 ErrNotFound, 实际 %v", err)
+	}
+	if err := SaveProvenance(afe, p); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadProvenance(afe, "task-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.FileID != "file-1" || len(loaded.Segments) != 2 || len(loaded.Faults) != 1 || loaded.Faults[0].Peer != bad {
+		t.Fatalf("加载的来源记录不符: %+v", loaded)
+	}
+}
@@ -0,0 +1,131 @@
+package downloads
+
+import (
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/provider"
+	"github.com/bpfs/defs/util"
+	"github.com/bpfs/dep2p/streams"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+)
+
+// rebalance 提供节点变更后需要重新调度的文件片段
+type rebalance struct {
+	requeue   []int // 需要重新发起下载的片段索引
+	orphaned  bool  // 是否有未完成的片段失去了全部节点，需要重新请求索引清单
+	unchanged bool  // 通告没有涉及任务中的任何片段
+}
+
+// HandleProviderUpdatePubSub 处理存储节点通告的文件片段变更，更新进行中的下载任务
+func HandleProviderUpdatePubSub(download *DownloadManager, res *streams.RequestMessage) {
+	if res.Message.Type != "update" {
+		return
+	}
+	u := new(provider.Update)
+	if err := util.DecodeFromBytes(res.Payload, u); err != nil {
+		logrus.Errorf("[%s]解码错误: %v", debug.WhereAmI(), err)
+		return
+	}
+	// 只接受存储节点对自身片段的通告
+	if u.FileID == "" || u.Peer.String() != res.Message.Sender {
+		return
+	}
+
+	download.Mu.Lock()
+	var tasks []*DownloadTask
+	for _, task := range download.Tasks {
+		if task.File != nil && task.File.FileID == u.FileID {
+			tasks = append(tasks, task)
+		}
+	}
+	download.Mu.Unlock()
+
+	for _, task := range tasks {
+		switch task.GetDownloadStatus() {
+		case StatusCompleted, StatusFailed:
+			continue
+		}
+		task.ApplyProviderUpdate(u.Peer, u.Added, u.Removed)
+	}
+}
+
+// ApplyProviderUpdate 按存储节点的片段变更重新分配剩余片段的下载节点
+// 同一任务的变更串行应用，且在全部片段的节点更新完成后才重新调度，
+// 下载流程不会看到只更新了一部分的节点集合
+// 参数：
+//   - p: peer.ID 发生变更的存储节点
+//   - added: []string 该节点新增的文件片段唯一标识
+//   - removed: []string 该节点移除的文件片段唯一标识
+func (task *DownloadTask) ApplyProviderUpdate(p peer.ID, added, removed []string) {
+	r := task.applyProviderUpdate(p, added, removed)
+	if r.unchanged {
+		return
+	}
+	if len(r.requeue) > 0 {
+		logrus.Infof("[%s]节点 %s 的片段变更，任务 %s 重新调度 %d 个片段", debug.WhereAmI(), p, task.TaskID, len(r.requeue))
+	}
+	for _, index := range r.requeue {
+		task.EventDownSnippetChan(index)
+	}
+	if r.orphaned {
+		task.EventChecklistSingleChan()
+	}
+}
+
+// applyProviderUpdate 更新片段的节点集合并计算需要重新调度的片段
+func (task *DownloadTask) applyProviderUpdate(p peer.ID, added, removed []string) rebalance {
+	task.rebalanceMu.Lock()
+	defer task.rebalanceMu.Unlock()
+
+	// 片段唯一标识到片段的映射
+	byID := make(map[string]*FileSegment)
+	task.File.Segments.Range(func(key, value interface{}) bool {
+		segment := value.(*FileSegment)
+		if id := segment.GetSegmentID(); id != "" {
+			byID[id] = segment
+		}
+		return true
+	})
+
+	r := rebalance{unchanged: true}
+	requeue := make(map[int]bool)
+
+	// 先加入新节点再移除旧节点，片段在更新过程中不会短暂地没有节点
+	for _, id := range added {
+		segment, ok := byID[id]
+		if !ok {
+			continue
+		}
+		r.unchanged = false
+		segment.AddNode(p, true)
+		if !segment.IsCompleted() && !segment.IsStatus(SegmentStatusDownloading) {
+			requeue[segment.Index] = true
+		}
+	}
+	for _, id := range removed {
+		segment, ok := byID[id]
+		if !ok || !segment.NodeExists(p) {
+			continue
+		}
+		r.unchanged = false
+		segment.DeleteNode(p)
+		if segment.IsCompleted() {
+			continue
+		}
+		// 正在进行的请求失败后会自行换用其他节点
+		if segment.IsStatus(SegmentStatusDownloading) {
+			continue
+		}
+		if segment.HasActiveNodes() {
+			requeue[segment.Index] = true
+		} else {
+			delete(requeue, segment.Index)
+			r.orphaned = true
+		}
+	}
+
+	for index := range requeue {
+		r.requeue = append(r.requeue, index)
+	}
+	return r
+}
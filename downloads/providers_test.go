@@ -0,0 +1,59 @@
+package downloads
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/test"
+)
+
+func TestApplyProviderUpdate(t *testing.T) {
+	oldNode, newNode, other := test.RandPeerIDFatal(t), test.RandPeerIDFatal(t), test.RandPeerIDFatal(t)
+	file := &DownloadFile{FileID: "file-1"}
+	statuses := []SegmentDownloadStatus{SegmentStatusPending, SegmentStatusFailed, SegmentStatusDownloading, SegmentStatusCompleted, SegmentStatusPending}
+	for i, status := range statuses {
+		segment := &FileSegment{Index: i, SegmentID: string(rune('a' + i)), Status: status}
+		segment.AddNode(oldNode, true)
+		if i == 1 {
+			segment.AddNode(other, true)
+		}
+		file.AddSegment(i, segment)
+	}
+	task := &DownloadTask{TaskID: "task-1", File: file}
+
+	// 修复把片段 a、b、c、d 迁移到新节点
+	r := task.applyProviderUpdate(newNode, []string{"a", "b", "c", "d"}, nil)
+	sort.Ints(r.requeue)
+	if r.unchanged || r.orphaned || !reflect.DeepEqual(r.requeue, []int{0, 1}) {
+		t.Fatalf("新增节点后应重新调度待下载与失败的片段: %+v", r)
+	}
+	for i := 0; i < 4; i++ {
+		if segment, _ := file.GetSegment(i); !segment.NodeExists(newNode) {
+			t.Fatalf("片段 %d 缺少新节点", i)
+		}
+	}
+
+	// 旧节点移除片段
+	r = task.applyProviderUpdate(oldNode, nil, []string{"a", "b", "c", "d", "e"})
+	sort.Ints(r.requeue)
+	if !reflect.DeepEqual(r.requeue, []int{0, 1}) {
+		t.Fatalf("移除旧节点后应重新调度仍有节点的片段: %+v", r)
+	}
+	if !r.orphaned {
+		t.Fatal("片段 e 失去了全部节点，应重新请求索引清单")
+	}
+	for i := 0; i < 5; i++ {
+		if segment, _ := file.GetSegment(i); segment.NodeExists(oldNode) {
+			t.Fatalf("片段 %d 仍保留旧节点", i)
+		}
+	}
+	if segment, _ := file.GetSegment(1); !segment.NodeExists(other) {
+		t.Fatal("其他节点不应受影响")
+	}
+
+	// 与任务无关的通告
+	if r := task.applyProviderUpdate(oldNode, []string{"z"}, []string{"a"}); !r.unchanged {
+		t.Fatalf("不涉及任务片段的通告应视为无变化: %+v", r)
+	}
+}
@@ -10,8 +10,10 @@ import (
 	"github.com/bpfs/defs/network"
 	"github.com/bpfs/defs/opts"
 	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/defs/provider"
 	"github.com/bpfs/defs/script"
 	"github.com/bpfs/defs/segment"
+	"github.com/bpfs/defs/supervise"
 	"github.com/bpfs/defs/util"
 	"github.com/bpfs/dep2p"
 	"github.com/bpfs/dep2p/pubsub"
@@ -31,28 +33,59 @@ var (
 
 type RegisterPubsubProtocolInput struct {
 	fx.In
-	Ctx      context.Context     // 全局上下文
-	Opt      *opts.Options       // 文件存储选项配置
-	Afe      afero.Afero         // 文件系统接口
-	P2P      *dep2p.DeP2P        // DeP2P网络主机
-	PubSub   *pubsub.DeP2PPubSub // DeP2P网络订阅
-	Download *DownloadManager    // 管理所有下载任务
+	Ctx        context.Context       // 全局上下文
+	Opt        *opts.Options         // 文件存储选项配置
+	Afe        afero.Afero           // 文件系统接口
+	P2P        *dep2p.DeP2P          // DeP2P网络主机
+	PubSub     *pubsub.DeP2PPubSub   // DeP2P网络订阅
+	Download   *DownloadManager      // 管理所有下载任务
+	Supervisor *supervise.Supervisor // 后台任务的崩溃恢复
 }
 
 // RegisterPubsubProtocol 注册订阅
 func RegisterPubsubProtocol(lc fx.Lifecycle, input RegisterPubsubProtocolInput) {
-	// 文件下载请求主题
-	if err := input.PubSub.SubscribeWithTopic(PubSubDownloadChecklistRequestTopic, func(res *streams.RequestMessage) {
-		HandleFileDownloadRequestPubSub(input.Opt, input.Afe, input.P2P, input.PubSub, res)
-	}, true); err != nil {
-		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+	// 文件下载请求主题，分片时只订阅本节点位置及存储文件所在的分片
+	shards := input.Opt.GetAnnounceShards()
+	if shards <= 1 {
+		if err := input.PubSub.SubscribeWithTopic(PubSubDownloadChecklistRequestTopic, network.PubSubHandler(PubSubDownloadChecklistRequestTopic, func(res *streams.RequestMessage) {
+			HandleFileDownloadRequestPubSub(input.Opt, input.Afe, input.P2P, input.PubSub, res)
+		}), true); err != nil {
+			logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
 
+		}
+	} else {
+		subscriber := &shardSubscriber{
+			opt:        input.Opt,
+			afe:        input.Afe,
+			p2p:        input.P2P,
+			pubsub:     input.PubSub,
+			shards:     shards,
+			subscribed: make(map[int]bool),
+		}
+		input.Supervisor.Go("downloads", "shard-subscriber", func() { subscriber.run(input.Ctx) })
 	}
 
 	// 文件下载回应主题
-	if err := input.PubSub.SubscribeWithTopic(PubSubDownloadChecklistResponseTopic, func(res *streams.RequestMessage) {
+	if err := input.PubSub.SubscribeWithTopic(PubSubDownloadChecklistResponseTopic, network.PubSubHandler(PubSubDownloadChecklistResponseTopic, func(res *streams.RequestMessage) {
 		HandleFileDownloadResponsePubSub(input.P2P, input.PubSub, input.Download, res)
-	}, true); err != nil {
+	}), true); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+	}
+
+	// 委托下载令牌撤销列表主题
+	if err := LoadRevocations(input.Afe); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+	}
+	if err := input.PubSub.SubscribeWithTopic(PubSubDelegationRevocationTopic, network.PubSubHandler(PubSubDelegationRevocationTopic, func(res *streams.RequestMessage) {
+		HandleRevocationPubSub(input.Afe, res)
+	}), true); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+	}
+
+	// 文件片段所在节点的变更通告主题
+	if err := input.PubSub.SubscribeWithTopic(provider.PubSubProviderUpdateTopic, network.PubSubHandler(provider.PubSubProviderUpdateTopic, func(res *streams.RequestMessage) {
+		HandleProviderUpdatePubSub(input.Download, res)
+	}), true); err != nil {
 		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
 	}
 
@@ -69,6 +102,7 @@ type SegmentListRequest struct {
 	FileID       string            // 文件唯一标识
 	UserPubHash  []byte            // 用户的公钥哈希
 	SegmentNodes map[int][]peer.ID // 文件片段所在节点
+	Delegated    bool              // 是否代所有者下载，委托下载令牌只通过流发送给存储文件的节点
 }
 
 // HandleFileDownloadRequestPubSub 处理文件下载请求
@@ -92,45 +126,45 @@ func HandleFileDownloadRequestPubSub(opt *opts.Options, afe afero.Afero, p2p *de
 
 		logrus.Infof("[ %s ]请求[ %s ]的索引清单", res.Message.Sender, payload.FileID)
 
-		// 从指定文件中读取一个或多个段
-		segmentList, err := processSlice(opt, afe, p2p, payload.FileID, payload.UserPubHash)
-		if err != nil || segmentList == nil {
-			if err != nil {
-				logrus.Errorf("[%s]从指定文件中读取一个或多个段时失败: %v", debug.WhereAmI(), err)
+		var responseChecklistPayload FileDownloadResponseChecklistPayload
+		if payload.Delegated {
+			// 委托下载令牌只通过流发送，先告知请求方本节点存储了该文件，由请求方携带令牌获取清单
+			if !hasSlices(afe, p2p, payload.FileID) {
+				return
+			}
+			responseChecklistPayload = FileDownloadResponseChecklistPayload{
+				TaskID:          payload.TaskID,
+				FileID:          payload.FileID,
+				NeedsDelegation: true,
+			}
+		} else {
+			// 从指定文件中读取一个或多个段
+			segmentList, err := processSlice(opt, afe, p2p, payload.FileID, payload.UserPubHash, nil, receiver)
+			if err != nil || segmentList == nil {
+				if err != nil {
+					logrus.Errorf("[%s]从指定文件中读取一个或多个段时失败: %v", debug.WhereAmI(), err)
+				}
+				return
 			}
-			return
-		}
-
-		// 文件下载响应(清单)
-		responseChecklistPayload := FileDownloadResponseChecklistPayload{
-			TaskID:          payload.TaskID,              // 任务唯一标识
-			FileID:          segmentList.fileID,          // 文件的唯一标识
-			Name:            segmentList.name,            // 文件名
-			Size:            segmentList.size,            // 文件大小
-			ContentType:     segmentList.contentType,     // MIME类型
-			SliceTable:      segmentList.sliceTable,      // 文件片段的哈希表
-			AvailableSlices: segmentList.availableSlices, // 本地存储的文件片段信息
-		}
 
-		// 本地存储的文件片段信息为空
-		if len(responseChecklistPayload.AvailableSlices) == 0 {
-			logrus.Errorf("[%s]本地存储的文件片段信息为空", debug.WhereAmI())
-			return
-		}
+			// 本地存储的文件片段信息为空
+			if len(segmentList.availableSlices) == 0 {
+				logrus.Errorf("[%s]本地存储的文件片段信息为空", debug.WhereAmI())
+				return
+			}
 
-		localNodeID := p2p.Host().ID()
-		// 检查是否需要发送响应
-		if !shouldSendResponse(localNodeID, payload.SegmentNodes, responseChecklistPayload.AvailableSlices) {
-			logrus.Info("所有片段信息都已存在，无需发送响应")
-			return
+			// 检查是否需要发送响应
+			if !shouldSendResponse(p2p.Host().ID(), payload.SegmentNodes, segmentList.availableSlices) {
+				logrus.Info("所有片段信息都已存在，无需发送响应")
+				return
+			}
+			responseChecklistPayload = newChecklistPayload(payload.TaskID, segmentList, nil)
 		}
 
 		usePubSub := false
 
 		// 发送获取片段到目标节点
-		network.StreamMutex.Lock()
 		res, err := network.SendStream(p2p, StreamDownloadChecklistResponseProtocol, "", receiver, responseChecklistPayload)
-		// network.StreamMutex.Unlock()
 		if err != nil || res == nil || res.Code != 200 {
 			if res != nil && res.Code == 6604 {
 				logrus.Warnf("[%s]发送获取片段到目标节点时，下载任务不存在", debug.WhereAmI())
@@ -191,6 +225,12 @@ func HandleFileDownloadResponsePubSub(p2p *dep2p.DeP2P, pubsub *pubsub.DeP2PPubS
 			return
 		}
 
+		// 代所有者下载时，携带委托下载令牌向存储节点获取清单
+		if payload.NeedsDelegation {
+			task.spawn("delegated-checklist", func() { requestDelegatedChecklist(p2p, task, receiver) })
+			return
+		}
+
 		// 更新下载任务中特定片段的节点信息
 		task.UpdateDownloadPieceInfo(payload, receiver)
 
@@ -199,10 +239,47 @@ func HandleFileDownloadResponsePubSub(p2p *dep2p.DeP2P, pubsub *pubsub.DeP2PPubS
 	}
 }
 
+// newChecklistPayload 根据读取的片段信息创建文件下载响应清单
+// 委托下载令牌未授予元数据权限时，不返回文件名等元数据
+// 参数：
+//   - taskID: string 任务唯一标识
+//   - segmentList: *segmentListResult 读取的片段信息
+//   - delegation: *Delegation 请求方携带的委托下载令牌，可以为空
+//
+// 返回值：
+//   - FileDownloadResponseChecklistPayload: 文件下载响应清单
+func newChecklistPayload(taskID string, segmentList *segmentListResult, delegation *Delegation) FileDownloadResponseChecklistPayload {
+	payload := FileDownloadResponseChecklistPayload{
+		TaskID:          taskID,                      // 任务唯一标识
+		FileID:          segmentList.fileID,          // 文件的唯一标识
+		Name:            segmentList.name,            // 文件名
+		Size:            segmentList.size,            // 文件大小
+		ContentType:     segmentList.contentType,     // MIME类型
+		Checksum:        segmentList.checksum,        // 文件的校验和
+		SliceTable:      segmentList.sliceTable,      // 文件片段的哈希表
+		AvailableSlices: segmentList.availableSlices, // 本地存储的文件片段信息
+		Metadata:        segmentList.metadata,        // 加密的文件元数据
+	}
+	if segmentList.delegated && delegation.Scope&ScopeMetadata == 0 {
+		payload.Name = ""
+		payload.ContentType = ""
+		payload.Metadata = nil
+	}
+	return payload
+}
+
+// hasSlices 检查本节点是否存储了文件的片段
+func hasSlices(afe afero.Afero, p2p *dep2p.DeP2P, fileID string) bool {
+	subDir := filepath.Join(paths.GetSlicePath(), p2p.Host().ID().String(), fileID)
+	slices, err := afero.ListFileNamesRecursively(afe, subDir)
+	return err == nil && len(slices) > 0
+}
+
 // segmentListResult 定义了从片段文件读取的结果数据结构。
 type segmentListResult struct {
 	fileID          string             // 文件唯一标识
 	name            string             // 文件名
+	metadata        []byte             // 加密的文件元数据
 	size            int64              // 文件大小
 	contentType     string             // MIME类型
 	checksum        []byte             // 文件的校验和
@@ -210,10 +287,12 @@ type segmentListResult struct {
 	p2pkhScript     []byte             // P2PKH 脚本
 	sliceTable      map[int]*HashTable // 文件片段的哈希表
 	availableSlices []int              // 本地存储的文件片段信息
+	delegated       bool               // 是否通过委托下载令牌获得授权
 }
 
 // processSlice 从指定文件中读取一个或多个段，将其赋值给回传参数。
-func processSlice(opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, fileID string, userPubHash []byte) (*segmentListResult, error) {
+// 非共享或受限文件仅所有者或持有有效委托下载令牌的请求方可以获取。
+func processSlice(opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, fileID string, userPubHash []byte, delegation *Delegation, sender peer.ID) (*segmentListResult, error) {
 	subDir := filepath.Join(paths.GetSlicePath(), p2p.Host().ID().String(), fileID)
 
 	// 检查目录是否存在
@@ -287,6 +366,9 @@ SLICESLOOP:
 		if segmentList.sliceTable == nil {
 			segmentTypes = append(segmentTypes, "SLICETABLE") // 文件片段的哈希表
 		}
+		if segmentList.name == "" && len(segmentList.metadata) == 0 {
+			segmentTypes = append(segmentTypes, "METADATA") // 加密的文件元数据
+		}
 		// 从指定文件中读取一个或多个段
 		segmentResults, _, err := segment.ReadFileSegments(sliceFile, segmentTypes)
 		if err != nil {
@@ -308,6 +390,9 @@ SLICESLOOP:
 
 		// 处理每个段的结果
 		for segmentType, result := range segmentResults {
+			if result.Error != nil && segmentType == "METADATA" {
+				continue // 未开启元数据加密的文件片段没有该段
+			}
 			if result.Error != nil {
 				// 出现任何错误，立即继续下一个 sliceHash
 				continue SLICESLOOP
@@ -330,6 +415,10 @@ SLICESLOOP:
 			case "NAME":
 				segmentList.name = string(result.Data)
 
+			// 加密的文件元数据
+			case "METADATA":
+				segmentList.metadata = result.Data
+
 			// 文件的长度
 			case "SIZE":
 				if segmentList.size, err = util.FromBytes[int64](result.Data); err != nil {
@@ -369,11 +458,19 @@ SLICESLOOP:
 			}
 		}
 
-		// 共享与权限校验
-		if !segmentList.shared {
+		// 共享与权限校验，受限文件不按共享文件提供
+		if !segmentList.shared || revocations.restricted(fileID, segmentList.p2pkhScript) {
 			// 验证脚本中所有者的公钥哈希
 			if !script.VerifyScriptPubKeyHash(segmentList.p2pkhScript, userPubHash) {
-				continue SLICESLOOP
+				// 验证委托下载令牌
+				if delegation == nil {
+					continue SLICESLOOP
+				}
+				if err := delegation.Authorize(fileID, segmentList.p2pkhScript, sender, ScopeSegments); err != nil {
+					logrus.Warnf("[%s]: %v", debug.WhereAmI(), err)
+					continue SLICESLOOP
+				}
+				segmentList.delegated = true
 			}
 		}
 
@@ -0,0 +1,104 @@
+package downloads
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/opts"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+)
+
+// RecoveryReport 启动时核对下载任务状态的结果
+type RecoveryReport struct {
+	Paused        []string // 声称下载中或等待名额、已转为暂停的任务
+	Failed        []string // 缺少文件信息、无法继续下载的任务
+	ResetSegments int      // 重置为待下载的片段数量
+}
+
+// Recover 核对从文件加载的下载任务与本地实际状态
+// 进程崩溃后任务可能仍声称正在下载而实际没有任何协程在运行：
+// 正在下载的片段重置为待下载，进度中已完成但本地数据已丢失的片段重新下载，
+// 任务转为暂停，可恢复下载；尚未获取文件信息的任务无法核对，转为失败
+// 参数：
+//   - opt: *opts.Options 文件存储选项配置
+//   - afe: afero.Afero 文件系统接口
+//   - self: peer.ID 本节点的ID
+//
+// 返回值：
+//   - *RecoveryReport: 核对结果
+func (manager *DownloadManager) Recover(opt *opts.Options, afe afero.Afero, self peer.ID) *RecoveryReport {
+	manager.Mu.Lock()
+	defer manager.Mu.Unlock()
+
+	report := new(RecoveryReport)
+	for id, task := range manager.Tasks {
+		// 等待名额的队列只保存在内存中，排队的任务同样转为暂停
+		if status := task.GetDownloadStatus(); status != StatusDownloading && status != StatusQueued {
+			continue
+		}
+
+		if task.File == nil || task.File.FileID == "" {
+			task.SetDownloadStatus(StatusFailed)
+			report.Failed = append(report.Failed, id)
+			continue
+		}
+
+		report.ResetSegments += task.reconcile(opt, afe, self)
+		task.SetDownloadStatus(StatusPaused)
+		report.Paused = append(report.Paused, id)
+	}
+	sort.Strings(report.Paused)
+	sort.Strings(report.Failed)
+	return report
+}
+
+// reconcile 按本地数据核对片段状态与进度
+// 数据片段应已写入输出文件，其余片段应保存在片段目录中
+// 返回值：
+//   - int: 重置为待下载的片段数量
+func (task *DownloadTask) reconcile(opt *opts.Options, afe afero.Afero, self peer.ID) int {
+	_, err := os.Stat(task.assemblyPath(opt))
+	assembled := err == nil
+	dir := segmentDir(self, task.File.FileID)
+
+	reset := 0
+	for index, segment := range task.File.ListAllSegments() {
+		if index < task.TotalPieces && task.Progress.IsSet(index) {
+			present := assembled
+			if !task.isAssembledShard(index) {
+				present, _ = afero.Exists(afe, filepath.Join(dir, segment.SegmentID))
+			}
+			if present {
+				task.File.SetSegmentStatus(index, SegmentStatusCompleted)
+				continue
+			}
+			task.Progress.Clear(index)
+		}
+
+		if segment.Status != SegmentStatusPending {
+			task.File.SetSegmentStatus(index, SegmentStatusPending)
+			reset++
+		}
+	}
+	return reset
+}
+
+// RecoveryReport 获取启动时核对下载任务状态的结果
+func (manager *DownloadManager) RecoveryReport() *RecoveryReport {
+	return manager.recovery
+}
+
+// log 记录核对结果
+func (report *RecoveryReport) log() {
+	if len(report.Paused) == 0 && len(report.Failed) == 0 {
+		return
+	}
+	logrus.Infof("[%s]下载任务恢复：%d 个转为暂停，%d 个转为失败，重置 %d 个片段", debug.WhereAmI(), len(report.Paused), len(report.Failed), report.ResetSegments)
+	for _, id := range report.Failed {
+		logrus.Warnf("[%s]下载任务 %s 缺少文件信息，无法继续下载", debug.WhereAmI(), id)
+	}
+}
@@ -0,0 +1,80 @@
+package downloads
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/util"
+	"github.com/libp2p/go-libp2p/core/test"
+)
+
+func TestRecover(t *testing.T) {
+	opt := opts.DefaultOptions()
+	opt.BuildDownloadPath(t.TempDir())
+	afe := afero.NewMemMapFs()
+	self := test.RandPeerIDFatal(t)
+
+	file := &DownloadFile{FileID: "file-1"}
+	statuses := []SegmentDownloadStatus{SegmentStatusCompleted, SegmentStatusDownloading, SegmentStatusCompleted, SegmentStatusCompleted}
+	for i, status := range statuses {
+		file.Segments.Store(i, &FileSegment{Index: i, SegmentID: "seg-" + string(rune('0'+i)), IsRsCodes: i >= 2, Status: status})
+	}
+	progress := util.NewBitSet(4)
+	for _, i := range []int{0, 2, 3} {
+		progress.Set(i)
+	}
+	// 只有纠删码片段 3 保存在本地，输出文件与片段 2 已丢失
+	if err := afero.WriteFile(afe, filepath.Join(segmentDir(self, file.FileID), "seg-3"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	task := &DownloadTask{TaskID: "task-1", File: file, TotalPieces: 4, DataPieces: 2, Progress: *progress, DownloadStatus: StatusDownloading}
+	task.StatusCond = sync.NewCond(&task.rwmu)
+	orphan := &DownloadTask{TaskID: "task-2", DownloadStatus: StatusDownloading}
+	orphan.StatusCond = sync.NewCond(&orphan.rwmu)
+	done := &DownloadTask{TaskID: "task-3", DownloadStatus: StatusCompleted}
+
+	manager := &DownloadManager{Tasks: map[string]*DownloadTask{task.TaskID: task, orphan.TaskID: orphan, done.TaskID: done}}
+	report := manager.Recover(opt, afe, self)
+
+	want := &RecoveryReport{Paused: []string{"task-1"}, Failed: []string{"task-2"}, ResetSegments: 3}
+	if !reflect.DeepEqual(report, want) {
+		t.Fatalf("report = %+v, want %+v", report, want)
+	}
+	if task.GetDownloadStatus() != StatusPaused || orphan.GetDownloadStatus() != StatusFailed || done.GetDownloadStatus() != StatusCompleted {
+		t.Fatal("任务状态未按预期转换")
+	}
+	for i, want := range []bool{false, false, false, true} {
+		if task.Progress.IsSet(i) != want {
+			t.Fatalf("片段 %d 的进度 = %v, want %v", i, !want, want)
+		}
+	}
+	if seg, _ := file.GetSegment(1); seg.Status != SegmentStatusPending {
+		t.Fatalf("下载中的片段应重置为待下载, got %s", seg.Status)
+	}
+}
+
+func TestSaveTasksReadOnly(t *testing.T) {
+	opt := opts.DefaultOptions()
+	opt.BuildReadOnly(true)
+	manager := &DownloadManager{Tasks: make(map[string]*DownloadTask), opt: opt}
+
+	// 只读模式下不写入任务文件
+	filePath := filepath.Join(t.TempDir(), "tasks")
+	manager.saveTasks(filePath)
+	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+		t.Fatalf("只读模式下写入了任务文件: %v", err)
+	}
+
+	// 运行时关闭只读模式后恢复写入
+	opt.BuildReadOnly(false)
+	manager.saveTasks(filePath)
+	if _, err := os.Stat(filePath); err != nil {
+		t.Fatalf("关闭只读模式后应写入任务文件: %v", err)
+	}
+}
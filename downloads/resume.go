@@ -0,0 +1,99 @@
+package downloads
+
+import (
+	"math/rand"
+	"path/filepath"
+	"sort"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/util"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// 续传时进度位图只说明片段曾经写入，输出文件或本地片段可能在暂停期间被外部修改。
+// 继续下载前按任务的校验级别核对已完成片段的哈希：快速校验抽查部分片段，发现不一致时改为全部核对；
+// 完整校验核对全部片段。不一致的片段重新标记为未完成，随续传重新下载，避免合并出损坏的文件。
+
+// ResumeVerifySample 快速校验级别下，续传前抽查的已完成片段数量
+const ResumeVerifySample = 8
+
+// ResumeCheck 续传前核对已完成片段的结果
+type ResumeCheck struct {
+	Checked int   // 核对的片段数量
+	Reset   []int // 内容与哈希不一致、重新标记为未完成的片段索引
+}
+
+// verifyCompleted 核对已完成片段的内容与哈希，不一致的片段重新标记为未完成
+// 参数：
+//   - opt: *opts.Options 文件存储选项配置
+//   - afe: afero.Afero 文件系统接口
+//   - self: peer.ID 本节点的ID
+//
+// 返回值：
+//   - *ResumeCheck: 核对结果
+func (task *DownloadTask) verifyCompleted(opt *opts.Options, afe afero.Afero, self peer.ID) *ResumeCheck {
+	check := new(ResumeCheck)
+	level := task.verifyLevel(opt)
+	if level == opts.VerifyNone || task.File == nil {
+		return check
+	}
+
+	// 已完成且记录了哈希的片段
+	var completed []int
+	segments := task.File.ListAllSegments()
+	for index, segment := range segments {
+		if index < task.TotalPieces && task.Progress.IsSet(index) && len(segment.Checksum) > 0 {
+			completed = append(completed, index)
+		}
+	}
+	sort.Ints(completed)
+
+	candidates := completed
+	if level == opts.VerifyFast && len(completed) > ResumeVerifySample {
+		candidates = append([]int(nil), completed...)
+		rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+		candidates = candidates[:ResumeVerifySample]
+	}
+
+	checked := make(map[int]bool)
+	verify := func(indexes []int) {
+		for _, index := range indexes {
+			if checked[index] {
+				continue
+			}
+			checked[index] = true
+			if !task.shardIntact(opt, afe, self, index, segments[index]) {
+				task.Progress.Clear(index)
+				task.File.SetSegmentStatus(index, SegmentStatusPending)
+				check.Reset = append(check.Reset, index)
+			}
+		}
+	}
+	verify(candidates)
+	// 抽查发现不一致时，其余片段也可能被修改
+	if len(check.Reset) > 0 && len(candidates) < len(completed) {
+		verify(completed)
+	}
+
+	check.Checked = len(checked)
+	sort.Ints(check.Reset)
+	return check
+}
+
+// shardIntact 检查已完成片段在本地的内容与哈希是否一致
+// 数据片段从输出文件中读取，其余片段从片段目录中读取，不一致的片段文件被删除
+func (task *DownloadTask) shardIntact(opt *opts.Options, afe afero.Afero, self peer.ID, index int, segment *FileSegment) bool {
+	if task.isAssembledShard(index) {
+		content, err := task.readShardAt(opt, index)
+		return err == nil && util.CompareHashes(util.CalculateHash(content), segment.Checksum)
+	}
+
+	dir := segmentDir(self, task.File.FileID)
+	content, err := util.Read(opt, afe, dir, segment.SegmentID)
+	if err == nil && len(content) > 0 && util.CompareHashes(util.CalculateHash(content), segment.Checksum) {
+		return true
+	}
+	afe.Remove(filepath.Join(dir, segment.SegmentID))
+	return false
+}
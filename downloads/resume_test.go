@@ -0,0 +1,112 @@
+package downloads
+
+import (
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/util"
+	"github.com/libp2p/go-libp2p/core/test"
+)
+
+func TestVerifyCompleted(t *testing.T) {
+	opt := opts.DefaultOptions()
+	opt.BuildDownloadPath(t.TempDir())
+	afe := afero.NewMemMapFs()
+	self := test.RandPeerIDFatal(t)
+
+	content := make([]byte, 3000)
+	rand.Read(content)
+	parity := []byte("parity")
+	file := &DownloadFile{FileID: "file-1", Size: int64(len(content))}
+	task := &DownloadTask{TaskID: "task-1", File: file, TotalPieces: 4, DataPieces: 3, Progress: *util.NewBitSet(4), Verify: opts.VerifyFull}
+
+	for i := 0; i < 3; i++ {
+		shard := content[i*1000 : (i+1)*1000]
+		file.Segments.Store(i, &FileSegment{Index: i, SegmentID: "seg-" + string(rune('0'+i)), Checksum: util.CalculateHash(shard), Status: SegmentStatusCompleted})
+		if err := task.writeShardAt(opt, i, shard); err != nil {
+			t.Fatal(err)
+		}
+		task.Progress.Set(i)
+	}
+	file.Segments.Store(3, &FileSegment{Index: 3, SegmentID: "seg-3", Checksum: util.CalculateHash(parity), IsRsCodes: true, Status: SegmentStatusCompleted})
+	parityPath := filepath.Join(segmentDir(self, file.FileID), "seg-3")
+	afero.WriteFile(afe, parityPath, parity, 0644)
+	task.Progress.Set(3)
+
+	// 未被修改时全部保持完成
+	if check := task.verifyCompleted(opt, afe, self); check.Checked != 4 || len(check.Reset) != 0 {
+		t.Fatalf("check = %+v", check)
+	}
+
+	// 外部修改输出文件中的片段 1 与本地的纠删码片段
+	out, err := os.OpenFile(task.assemblyPath(opt), os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.WriteAt([]byte("tampered"), 1500)
+	out.Close()
+	afero.WriteFile(afe, parityPath, []byte("other"), 0644)
+
+	// 不校验时信任进度
+	task.Verify = opts.VerifyNone
+	if check := task.verifyCompleted(opt, afe, self); check.Checked != 0 {
+		t.Fatalf("不校验时不应核对片段: %+v", check)
+	}
+
+	task.Verify = opts.VerifyFast
+	check := task.verifyCompleted(opt, afe, self)
+	if !reflect.DeepEqual(check.Reset, []int{1, 3}) {
+		t.Fatalf("Reset = %v, want [1 3]", check.Reset)
+	}
+	for i, want := range []bool{true, false, true, false} {
+		if task.Progress.IsSet(i) != want {
+			t.Fatalf("片段 %d 的进度 = %v, want %v", i, !want, want)
+		}
+	}
+	if seg, _ := file.GetSegment(1); seg.Status != SegmentStatusPending {
+		t.Fatalf("不一致的片段应重置为待下载, got %s", seg.Status)
+	}
+	if exists, _ := afero.Exists(afe, parityPath); exists {
+		t.Fatal("不一致的片段文件应被删除")
+	}
+}
+
+func TestRequeueShards(t *testing.T) {
+	file := &DownloadFile{FileID: "file-1"}
+	task := &DownloadTask{TaskID: "task-1", File: file, TotalPieces: 3, DataPieces: 2, Progress: *util.NewBitSet(3), EventDownSnippet: make(chan int, 3)}
+	for i := 0; i < 3; i++ {
+		file.Segments.Store(i, &FileSegment{Index: i, SegmentID: "seg", Status: SegmentStatusCompleted})
+		task.Progress.Set(i)
+	}
+	if !task.CheckDataSegmentsCompleted() {
+		t.Fatal("all segments completed")
+	}
+
+	// 两个片段损坏后只剩一个片段，不足以恢复，需等待重新下载
+	task.requeueShards([]int{0, 2})
+	if task.CheckDataSegmentsCompleted() {
+		t.Fatal("corrupt segments still counted as completed")
+	}
+	for _, index := range []int{0, 2} {
+		if task.Progress.IsSet(index) {
+			t.Errorf("progress bit %d still set", index)
+		}
+		if segment, _ := file.GetSegment(index); !segment.IsStatus(SegmentStatusPending) {
+			t.Errorf("segment %d status = %s, want pending", index, segment.Status)
+		}
+	}
+
+	// 损坏的片段重新请求下载
+	requested := map[int]bool{}
+	for len(requested) < 2 {
+		requested[<-task.EventDownSnippet] = true
+	}
+	if !requested[0] || !requested[2] {
+		t.Fatalf("requested = %v", requested)
+	}
+}
@@ -0,0 +1,475 @@
+package downloads
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	mathrand "math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/network"
+	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/defs/script"
+	"github.com/bpfs/defs/util"
+	"github.com/bpfs/defs/wallets"
+	"github.com/bpfs/dep2p"
+	"github.com/bpfs/dep2p/pubsub"
+	"github.com/bpfs/dep2p/streams"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+)
+
+// 委托下载令牌签发后在有效期内始终有效。所有者撤销授权时签发新的撤销列表，
+// 撤销列表包含该所有者全部的撤销记录、受限文件及递增的序号，通过订阅发送给存储节点；
+// 存储节点只接受签名有效且序号更大的列表，因此消息乱序或重放不会恢复已撤销的授权，
+// 错过的中间版本也会被之后的完整列表覆盖。
+// 订阅消息不保证送达，节点启动时及之后定期向已连接的节点查询各所有者的最新序号，
+// 取回序号更大的列表，离线期间错过的撤销也能生效。
+
+var (
+	// 委托下载令牌撤销列表的主题
+	PubSubDelegationRevocationTopic = fmt.Sprintf("defs@pubsub/delegation/revocation/%s", version)
+
+	// 同步委托下载令牌撤销列表
+	StreamRevocationSyncProtocol = fmt.Sprintf("defs@stream/delegation/revocation/sync/%s", version)
+)
+
+const (
+	RevocationSyncInterval = 10 * time.Minute // 同步撤销列表的间隔
+	revocationSyncPeers    = 3                // 每次同步查询的节点数
+)
+
+// RevocationSyncReq 同步撤销列表的请求
+type RevocationSyncReq struct {
+	Known map[string]uint64 // 请求方已知的所有者公钥及其撤销列表序号
+}
+
+// Revocation 一条撤销记录，撤销时间之前签发给该身份的令牌全部失效
+type Revocation struct {
+	FileID    string // 文件唯一标识
+	Delegate  []byte // 被委托身份的公钥
+	RevokedAt int64  // 撤销时间(Unix 纳秒)
+}
+
+// RevocationList 所有者签发的撤销列表
+type RevocationList struct {
+	Owner      []byte       // 所有者的公钥
+	Seq        uint64       // 序号，每次撤销或设置受限文件时递增
+	Entries    []Revocation // 全部撤销记录
+	Restricted []string     // 受限的文件，只能使用限定节点的委托下载令牌下载
+	Signature  []byte       // 所有者的签名
+}
+
+// Verify 验证撤销列表的签名
+func (l *RevocationList) Verify() error {
+	owner, err := wallets.UnmarshalPublicKey(l.Owner)
+	if err != nil {
+		return fmt.Errorf("%w: 无效的所有者公钥", errs.ErrUnauthorized)
+	}
+	digest, err := l.digest()
+	if err != nil {
+		return err
+	}
+	if !ecdsa.VerifyASN1(&owner, digest, l.Signature) {
+		return fmt.Errorf("%w: 撤销列表的签名无效", errs.ErrUnauthorized)
+	}
+	return nil
+}
+
+// digest 计算签名内容的摘要
+func (l *RevocationList) digest() ([]byte, error) {
+	unsigned := *l
+	unsigned.Signature = nil
+	data, err := util.EncodeToBytes(unsigned)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+// revocationStore 本节点已知的撤销列表，以所有者公钥为键
+type revocationStore struct {
+	mu    sync.RWMutex
+	lists map[string]*RevocationList
+}
+
+// revocations 本节点已知的撤销列表，校验委托下载令牌时使用
+var revocations = &revocationStore{lists: make(map[string]*RevocationList)}
+
+// revoked 判断令牌是否已被撤销，未记录签发时间的令牌视为在撤销之前签发
+func (rs *revocationStore) revoked(d *Delegation) bool {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	list, ok := rs.lists[string(d.Owner)]
+	if !ok {
+		return false
+	}
+	for _, entry := range list.Entries {
+		if entry.FileID == d.FileID && bytes.Equal(entry.Delegate, d.Delegate) && d.IssuedAt < entry.RevokedAt {
+			return true
+		}
+	}
+	return false
+}
+
+// restricted 判断文件是否被所有者设为受限，所有者以文件的 P2PKH 脚本确定
+func (rs *revocationStore) restricted(fileID string, p2pkhScript []byte) bool {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	for _, list := range rs.lists {
+		for _, id := range list.Restricted {
+			if id != fileID {
+				continue
+			}
+			ownerHash, ok := wallets.PublicKeyBytesToPublicKeyHash(list.Owner)
+			if ok && script.VerifyScriptPubKeyHash(p2pkhScript, ownerHash) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// apply 记录序号更大的撤销列表
+// 返回值：
+//   - bool: 列表是否被采用，序号不大于已知序号时为 false
+func (rs *revocationStore) apply(list *RevocationList) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if known, ok := rs.lists[string(list.Owner)]; ok && known.Seq >= list.Seq {
+		return false
+	}
+	rs.lists[string(list.Owner)] = list
+	return true
+}
+
+// get 获取所有者当前的撤销列表
+func (rs *revocationStore) get(owner []byte) *RevocationList {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	return rs.lists[string(owner)]
+}
+
+// known 获取已知的所有者及其撤销列表序号
+func (rs *revocationStore) known() map[string]uint64 {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	known := make(map[string]uint64, len(rs.lists))
+	for owner, list := range rs.lists {
+		known[owner] = list.Seq
+	}
+	return known
+}
+
+// newer 获取序号大于请求方已知序号的撤销列表，请求方未知的所有者同样返回
+func (rs *revocationStore) newer(known map[string]uint64) []*RevocationList {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	var lists []*RevocationList
+	for owner, list := range rs.lists {
+		if seq, ok := known[owner]; !ok || seq < list.Seq {
+			lists = append(lists, list)
+		}
+	}
+	return lists
+}
+
+// revocationsPath 获取撤销列表的保存目录
+func revocationsPath() string {
+	return filepath.Join(paths.GetManifestPath(), "revocations")
+}
+
+// saveRevocations 保存撤销列表，节点重启后仍然生效
+func saveRevocations(afe afero.Afero, list *RevocationList) error {
+	data, err := util.EncodeToBytes(list)
+	if err != nil {
+		return err
+	}
+	if err := afe.MkdirAll(revocationsPath(), 0755); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(list.Owner)
+	path := filepath.Join(revocationsPath(), hex.EncodeToString(sum[:8])+".rev")
+	return util.WriteFileAtomic(afe, path, data, 0644)
+}
+
+// LoadRevocations 加载本节点保存的撤销列表，签名无效的列表被跳过
+// 参数：
+//   - afe: afero.Afero 文件系统接口
+//
+// 返回值：
+//   - error: 读取目录失败时返回错误
+func LoadRevocations(afe afero.Afero) error {
+	entries, err := afero.ReadDir(afe, revocationsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".rev" {
+			continue
+		}
+		data, err := afero.ReadFile(afe, filepath.Join(revocationsPath(), entry.Name()))
+		if err != nil {
+			continue
+		}
+		list := new(RevocationList)
+		if err := util.DecodeFromBytes(data, list); err != nil || list.Verify() != nil {
+			continue
+		}
+		revocations.apply(list)
+	}
+	return nil
+}
+
+// ApplyRevocations 验证并记录其他节点发送的撤销列表
+// 参数：
+//   - afe: afero.Afero 文件系统接口
+//   - list: *RevocationList 撤销列表
+//
+// 返回值：
+//   - bool: 列表是否被采用
+//   - error: 签名无效或保存失败时返回错误
+func ApplyRevocations(afe afero.Afero, list *RevocationList) (bool, error) {
+	if err := list.Verify(); err != nil {
+		return false, err
+	}
+	if !revocations.apply(list) {
+		return false, nil
+	}
+	return true, saveRevocations(afe, list)
+}
+
+// Revoke 撤销所有者此前签发给指定身份的委托下载令牌
+// 参数：
+//   - afe: afero.Afero 文件系统接口
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥
+//   - fileID: string 文件唯一标识
+//   - delegate: *ecdsa.PublicKey 被委托身份的公钥
+//
+// 返回值：
+//   - *RevocationList: 包含本次撤销的新撤销列表，需发送给存储节点
+//   - error: 签名或保存失败时返回错误
+func Revoke(afe afero.Afero, ownerPriv *ecdsa.PrivateKey, fileID string, delegate *ecdsa.PublicKey) (*RevocationList, error) {
+	if ownerPriv == nil || delegate == nil || fileID == "" {
+		return nil, fmt.Errorf("%w: 撤销委托下载令牌的参数不完整", errs.ErrInvalidArgument)
+	}
+	delegateKey, err := wallets.MarshalPublicKey(*delegate)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := nextRevocationList(ownerPriv)
+	if err != nil {
+		return nil, err
+	}
+	entries := list.Entries[:0]
+	for _, entry := range list.Entries {
+		if entry.FileID != fileID || !bytes.Equal(entry.Delegate, delegateKey) {
+			entries = append(entries, entry)
+		}
+	}
+	list.Entries = append(entries, Revocation{
+		FileID:    fileID,
+		Delegate:  delegateKey,
+		RevokedAt: time.Now().UnixNano(),
+	})
+	return signRevocations(afe, ownerPriv, list)
+}
+
+// Restrict 设置所有者的文件是否受限
+// 存储节点收到列表后，受限文件不再按共享文件提供，委托下载令牌也必须限定请求节点
+// 参数：
+//   - afe: afero.Afero 文件系统接口
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥
+//   - fileID: string 文件唯一标识
+//   - restricted: bool 是否受限
+//
+// 返回值：
+//   - *RevocationList: 包含最新受限文件的新撤销列表，需发送给存储节点
+//   - error: 签名或保存失败时返回错误
+func Restrict(afe afero.Afero, ownerPriv *ecdsa.PrivateKey, fileID string, restricted bool) (*RevocationList, error) {
+	if ownerPriv == nil || fileID == "" {
+		return nil, fmt.Errorf("%w: 设置受限文件的参数不完整", errs.ErrInvalidArgument)
+	}
+	list, err := nextRevocationList(ownerPriv)
+	if err != nil {
+		return nil, err
+	}
+	files := list.Restricted[:0]
+	for _, id := range list.Restricted {
+		if id != fileID {
+			files = append(files, id)
+		}
+	}
+	if restricted {
+		files = append(files, fileID)
+	}
+	list.Restricted = files
+	return signRevocations(afe, ownerPriv, list)
+}
+
+// nextRevocationList 基于所有者当前的撤销列表创建序号递增的新列表
+func nextRevocationList(ownerPriv *ecdsa.PrivateKey) (*RevocationList, error) {
+	owner, err := wallets.MarshalPublicKey(ownerPriv.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	list := &RevocationList{Owner: owner, Seq: 1}
+	if known := revocations.get(owner); known != nil {
+		list.Seq = known.Seq + 1
+		list.Entries = append(list.Entries, known.Entries...)
+		list.Restricted = append(list.Restricted, known.Restricted...)
+	}
+	return list, nil
+}
+
+// signRevocations 签名并记录新的撤销列表
+func signRevocations(afe afero.Afero, ownerPriv *ecdsa.PrivateKey, list *RevocationList) (*RevocationList, error) {
+	digest, err := list.digest()
+	if err != nil {
+		return nil, err
+	}
+	if list.Signature, err = ecdsa.SignASN1(rand.Reader, ownerPriv, digest); err != nil {
+		return nil, err
+	}
+	if _, err := ApplyRevocations(afe, list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// PublishRevocations 将撤销列表发送给存储节点
+func PublishRevocations(p2p *dep2p.DeP2P, pubsub *pubsub.DeP2PPubSub, list *RevocationList) error {
+	return network.SendPubSub(p2p, pubsub, PubSubDelegationRevocationTopic, "revocation", "", list)
+}
+
+// HandleRevocationPubSub 处理其他节点发送的撤销列表
+func HandleRevocationPubSub(afe afero.Afero, res *streams.RequestMessage) {
+	list := new(RevocationList)
+	if err := util.DecodeFromBytes(res.Payload, list); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return
+	}
+	applied, err := ApplyRevocations(afe, list)
+	if err != nil {
+		logrus.Warnf("[%s]忽略节点 %s 发送的撤销列表: %v", debug.WhereAmI(), res.Message.Sender, err)
+		return
+	}
+	if applied {
+		logrus.Infof("[%s]更新撤销列表，序号 %d，共 %d 条记录", debug.WhereAmI(), list.Seq, len(list.Entries))
+	}
+}
+
+// handleRevocationSync 处理其他节点的撤销列表同步请求，返回对方缺少或过期的列表
+func (sp *StreamProtocol) handleRevocationSync(req *streams.RequestMessage, res *streams.ResponseMessage) (int32, string) {
+	payload := new(RevocationSyncReq)
+	if err := util.DecodeFromBytes(req.Payload, payload); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return 6603, "解码错误"
+	}
+	lists := revocations.newer(payload.Known)
+	if len(lists) == 0 {
+		return 200, "成功"
+	}
+	data, err := util.EncodeToBytes(lists)
+	if err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return 6605, "编码错误"
+	}
+	res.Data = data
+	return 200, "成功"
+}
+
+// SyncRevocations 向指定节点查询撤销列表，记录序号更大的列表
+// 返回的列表同样需要所有者签名有效，同步的节点无法伪造或回退撤销记录
+// 参数：
+//   - ctx: context.Context 上下文，取消时中止请求
+//   - afe: afero.Afero 文件系统接口
+//   - p2p: *dep2p.DeP2P 网络主机
+//   - node: peer.ID 查询的节点
+//
+// 返回值：
+//   - int: 采用的撤销列表数量
+//   - error: 请求失败时返回错误
+func SyncRevocations(ctx context.Context, afe afero.Afero, p2p *dep2p.DeP2P, node peer.ID) (int, error) {
+	res, err := network.SendStreamContext(ctx, p2p, StreamRevocationSyncProtocol, "", node, &RevocationSyncReq{Known: revocations.known()})
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errs.ErrPeerUnreachable, err)
+	}
+	if res == nil || res.Code != 200 {
+		msg := "无响应"
+		if res != nil {
+			msg = res.Msg
+		}
+		return 0, fmt.Errorf("节点 %s 拒绝同步撤销列表: %s", node, msg)
+	}
+	if len(res.Data) == 0 {
+		return 0, nil
+	}
+
+	var lists []*RevocationList
+	if err := util.DecodeFromBytes(res.Data, &lists); err != nil {
+		return 0, err
+	}
+	applied := 0
+	for _, list := range lists {
+		ok, err := ApplyRevocations(afe, list)
+		if err != nil {
+			logrus.Warnf("[%s]忽略节点 %s 同步的撤销列表: %v", debug.WhereAmI(), node, err)
+			continue
+		}
+		if ok {
+			applied++
+		}
+	}
+	return applied, nil
+}
+
+// runRevocationSync 启动时及之后定期向随机选取的已连接节点同步撤销列表，直到上下文结束
+// 参数：
+//   - ctx: context.Context 上下文
+//   - afe: afero.Afero 文件系统接口
+//   - p2p: *dep2p.DeP2P 网络主机
+//   - interval: time.Duration 同步间隔
+func runRevocationSync(ctx context.Context, afe afero.Afero, p2p *dep2p.DeP2P, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		peers := p2p.Host().Network().Peers()
+		mathrand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+		if len(peers) > revocationSyncPeers {
+			peers = peers[:revocationSyncPeers]
+		}
+		for _, node := range peers {
+			applied, err := SyncRevocations(ctx, afe, p2p, node)
+			if err != nil {
+				logrus.Debugf("[%s]向节点 %s 同步撤销列表失败: %v", debug.WhereAmI(), node, err)
+				continue
+			}
+			if applied > 0 {
+				logrus.Infof("[%s]从节点 %s 同步了 %d 个撤销列表", debug.WhereAmI(), node, applied)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package downloads
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"fmt"
 	"os"
@@ -10,7 +11,9 @@ import (
 
 	"github.com/bpfs/defs/afero"
 	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
 	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/qos"
 	"github.com/bpfs/defs/util"
 	"github.com/bpfs/dep2p"
 	"github.com/bpfs/dep2p/pubsub"
@@ -47,21 +50,107 @@ func (manager *DownloadManager) NewDownload(
 	ownerPriv *ecdsa.PrivateKey, // 所有者的私钥
 	segmentNodes ...map[int][]peer.ID, // 文件片段所在节点
 ) (*DownloadSuccessInfo, error) {
+	return manager.NewDownloadContext(context.Background(), opt, afe, p2p, pubsub, fileID, ownerPriv, segmentNodes...)
+}
+
+// NewDownloadContext 新下载操作，ctx 结束时下载任务随之取消
+// 下载任务在返回后继续在后台执行，ctx 应覆盖整个下载过程，而不仅是本次调用
+// 参数：
+//   - ctx: context.Context 下载任务的上下文，可设置截止时间或用于取消任务。
+//   - opt: *opts.Options 文件存储选项配置。
+//   - afe: afero.Afero 文件系统接口。
+//   - p2p: *dep2p.DeP2P 网络主机。
+//   - pubsub: *pubsub.DeP2PPubSub 网络订阅。
+//   - fileID: string 文件唯一标识。
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥。
+//   - segmentNodes: ...map[int][]peer.ID 文件片段所在节点。
+//
+// 返回值：
+//   - *DownloadSuccessInfo: 文件下载成功后的返回信息。
+//   - error: 如果发生错误，返回错误信息。
+func (manager *DownloadManager) NewDownloadContext(
+	ctx context.Context, // 下载任务的上下文
+	opt *opts.Options, // 文件存储选项配置
+	afe afero.Afero, // 文件系统接口
+	p2p *dep2p.DeP2P, // 网络主机
+	pubsub *pubsub.DeP2PPubSub, // 网络订阅
+	fileID string, // 文件唯一标识
+	ownerPriv *ecdsa.PrivateKey, // 所有者的私钥
+	segmentNodes ...map[int][]peer.ID, // 文件片段所在节点
+) (*DownloadSuccessInfo, error) {
+	return manager.newDownload(ctx, opt, afe, p2p, pubsub, fileID, ownerPriv, nil, segmentNodes...)
+}
+
+// NewDelegatedDownload 使用所有者签发的委托下载令牌，代所有者下载文件
+// 参数：
+//   - ctx: context.Context 下载任务的上下文，可设置截止时间或用于取消任务。
+//   - opt: *opts.Options 文件存储选项配置。
+//   - afe: afero.Afero 文件系统接口。
+//   - p2p: *dep2p.DeP2P 网络主机。
+//   - pubsub: *pubsub.DeP2PPubSub 网络订阅。
+//   - token: []byte 编码后的委托下载令牌。
+//   - delegatePriv: *ecdsa.PrivateKey 被委托身份的私钥。
+//   - segmentNodes: ...map[int][]peer.ID 文件片段所在节点。
+//
+// 返回值：
+//   - *DownloadSuccessInfo: 文件下载成功后的返回信息。
+//   - error: 令牌无效或未授予该身份时返回错误。
+func (manager *DownloadManager) NewDelegatedDownload(
+	ctx context.Context, // 下载任务的上下文
+	opt *opts.Options, // 文件存储选项配置
+	afe afero.Afero, // 文件系统接口
+	p2p *dep2p.DeP2P, // 网络主机
+	pubsub *pubsub.DeP2PPubSub, // 网络订阅
+	token []byte, // 委托下载令牌
+	delegatePriv *ecdsa.PrivateKey, // 被委托身份的私钥
+	segmentNodes ...map[int][]peer.ID, // 文件片段所在节点
+) (*DownloadSuccessInfo, error) {
+	delegation, err := DecodeDelegation(token)
+	if err != nil {
+		return nil, err
+	}
+	if err := delegation.Verify(); err != nil {
+		return nil, err
+	}
+	if delegatePriv == nil {
+		return nil, fmt.Errorf("%w: 被委托身份的密钥不可为空", errs.ErrInvalidArgument)
+	}
+	return manager.newDownload(ctx, opt, afe, p2p, pubsub, delegation.FileID, delegatePriv, delegation, segmentNodes...)
+}
+
+// newDownload 创建下载任务，delegation 不为空时代所有者下载
+func (manager *DownloadManager) newDownload(
+	ctx context.Context,
+	opt *opts.Options,
+	afe afero.Afero,
+	p2p *dep2p.DeP2P,
+	pubsub *pubsub.DeP2PPubSub,
+	fileID string,
+	ownerPriv *ecdsa.PrivateKey,
+	delegation *Delegation,
+	segmentNodes ...map[int][]peer.ID,
+) (*DownloadSuccessInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := opt.CheckWritable("下载文件"); err != nil {
+		return nil, err
+	}
 	fileID = strings.TrimSpace(fileID) // 删除了所有前导和尾随空格
 	if fileID == "" {
-		return nil, fmt.Errorf("文件唯一标识不可为空")
+		return nil, fmt.Errorf("%w: 文件唯一标识不可为空", errs.ErrInvalidArgument)
 	}
 	if ownerPriv == nil {
 		ownerPriv = opt.GetDefaultOwnerPriv() // 获取默认所有者的私钥
 		if ownerPriv == nil {
-			return nil, fmt.Errorf("所有者密钥不可为空")
+			return nil, fmt.Errorf("%w: 所有者密钥不可为空", errs.ErrInvalidArgument)
 		}
 	}
 
 	// 过滤重复下载
 	for _, task := range manager.Tasks {
 		if task.File.FileID == fileID {
-			return nil, fmt.Errorf("文件 %s 正在下载中", fileID)
+			return nil, fmt.Errorf("%w: 文件 %s 正在下载中", errs.ErrTaskExists, fileID)
 		}
 	}
 
@@ -86,12 +175,26 @@ func (manager *DownloadManager) NewDownload(
 	}
 
 	// 创建并初始化一个新的文件下载任务实例
-	task, err := NewDownloadTask(manager.ctx, taskID, fileID, ownerPriv)
+	task, err := NewDownloadTask(manager.ctx, opt, taskID, fileID, ownerPriv)
 	if err != nil {
 		logrus.Errorf("[%s]初始化下载实例时失败: %v", debug.WhereAmI(), err)
 		return nil, err
 	}
 
+	// 代所有者下载时，文件加密密钥来自委托下载令牌
+	if delegation != nil {
+		secret, err := delegation.OpenSecret(ownerPriv)
+		if err != nil {
+			return nil, err
+		}
+		token, err := delegation.Encode()
+		if err != nil {
+			return nil, err
+		}
+		task.Secret = secret
+		task.Delegation = token
+	}
+
 	// 更新节点ID
 	if len(segmentNodes) > 0 {
 		for idx, peers := range segmentNodes[0] {
@@ -100,8 +203,16 @@ func (manager *DownloadManager) NewDownload(
 		}
 	}
 
-	// 向管理器注册一个新的下载任务
-	go manager.RegisterTask(opt, afe, p2p, pubsub, task)
+	// 调用方的上下文结束时取消任务
+	context.AfterFunc(ctx, task.cancel)
+
+	if ttl := opt.GetOfflineQueueTTL(); ttl > 0 && !providersReachable(ctx, p2p, task) {
+		// 离线或文件片段所在节点不可达，等待网络恢复后自动开始
+		manager.queueOffline(task, ttl)
+	} else {
+		// 向管理器注册一个新的下载任务
+		go manager.RegisterTask(opt, afe, p2p, pubsub, task)
+	}
 
 	// 保存任务至文件
 	go manager.SaveTasksToFileSingleChan()
@@ -117,10 +228,24 @@ func (manager *DownloadManager) NewDownload(
 func (manager *DownloadManager) PauseDownload(
 	taskID string, // 任务唯一标识，用于区分和管理不同的上传任务
 ) error {
+	return manager.PauseDownloadContext(context.Background(), taskID)
+}
+
+// PauseDownloadContext 暂停下载操作，ctx 已结束时不暂停并返回其错误
+// 参数：
+//   - ctx: context.Context 调用的上下文
+//   - taskID: string 任务唯一标识
+//
+// 返回值：
+//   - error: 如果发生错误，返回错误信息
+func (manager *DownloadManager) PauseDownloadContext(ctx context.Context, taskID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	task, ok := manager.Tasks[taskID]
 	if !ok {
 		logrus.Errorf("[%s]找不到下载任务: %s", debug.WhereAmI(), taskID)
-		return fmt.Errorf("下载任务不存在")
+		return fmt.Errorf("%w: 下载任务 %s", errs.ErrTaskNotFound, taskID)
 	}
 
 	task.SetDownloadStatus(StatusPaused) // 设置下载任务的状态为"下载暂停"
@@ -129,14 +254,54 @@ func (manager *DownloadManager) PauseDownload(
 	return nil
 }
 
+// SetDownloadQoS 设置下载任务的服务等级
+// 参数：
+//   - taskID: string 任务唯一标识
+//   - class: qos.Class 服务等级
+//
+// 返回值：
+//   - error: 如果发生错误，返回错误信息
+func (manager *DownloadManager) SetDownloadQoS(taskID string, class qos.Class) error {
+	if !class.Valid() {
+		return fmt.Errorf("%w: 无效的服务等级 %d", errs.ErrInvalidArgument, class)
+	}
+	manager.Mu.Lock()
+	task, ok := manager.Tasks[taskID]
+	manager.Mu.Unlock()
+	if !ok {
+		logrus.Errorf("[%s]找不到下载任务: %s", debug.WhereAmI(), taskID)
+		return fmt.Errorf("%w: 下载任务 %s", errs.ErrTaskNotFound, taskID)
+	}
+	task.rwmu.Lock()
+	task.QoS = class
+	task.rwmu.Unlock()
+
+	go manager.SaveTasksToFileSingleChan() // 保存任务至文件的通知通道
+	return nil
+}
+
 // CancelDownload 取消下载操作
 func (manager *DownloadManager) CancelDownload(
 	taskID string, // 任务唯一标识，用于区分和管理不同的上传任务
 ) error {
+	return manager.CancelDownloadContext(context.Background(), taskID)
+}
+
+// CancelDownloadContext 取消下载操作，ctx 已结束时不取消并返回其错误
+// 参数：
+//   - ctx: context.Context 调用的上下文
+//   - taskID: string 任务唯一标识
+//
+// 返回值：
+//   - error: 如果发生错误，返回错误信息
+func (manager *DownloadManager) CancelDownloadContext(ctx context.Context, taskID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	task, ok := manager.Tasks[taskID]
 	if !ok {
 		logrus.Errorf("[%s]找不到下载任务: %s", debug.WhereAmI(), taskID)
-		return fmt.Errorf("下载任务不存在")
+		return fmt.Errorf("%w: 下载任务 %s", errs.ErrTaskNotFound, taskID)
 	}
 
 	task.cancel() // 取消任务
@@ -154,15 +319,55 @@ func (manager *DownloadManager) CancelDownload(
 // 返回值：
 //   - error 如果发生错误，返回错误信息
 func (manager *DownloadManager) ContinueDownload(taskID string) error {
+	return manager.ContinueDownloadContext(context.Background(), taskID)
+}
+
+// ContinueDownloadContext 继续下载操作，ctx 已结束时不继续并返回其错误
+// 继续后的下载在后台执行，不随 ctx 结束而暂停
+// 参数：
+//   - ctx: context.Context 调用的上下文
+//   - taskID: string 任务唯一标识
+//
+// 返回值：
+//   - error 如果发生错误，返回错误信息
+func (manager *DownloadManager) ContinueDownloadContext(ctx context.Context, taskID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	// 从下载任务管理器中获取任务
 	task, ok := manager.Tasks[taskID]
 	if !ok {
 		logrus.Errorf("[%s]找不到下载任务: %s", debug.WhereAmI(), taskID)
-		return fmt.Errorf("下载任务不存在")
+		return fmt.Errorf("%w: 下载任务 %s", errs.ErrTaskNotFound, taskID)
 	}
 
-	// 启动协程继续下载
-	go func() {
+	// 达到并发上限时进入等待队列，获得名额后继续下载
+	manager.admit(task, func() {
+		manager.resume(task)
+		task.SetDownloadStatus(StatusDownloading) // 设置下载任务的状态为"下载中"
+		go manager.SaveTasksToFileSingleChan()
+	})
+
+	// 启动协程保存任务状态至文件
+	go manager.SaveTasksToFileSingleChan()
+
+	return nil
+}
+
+// resume 启动协程核对已完成的片段，并重新请求未完成的数据片段
+// 参数：
+//   - task: *DownloadTask 继续下载的任务
+func (manager *DownloadManager) resume(task *DownloadTask) {
+	taskID := task.TaskID
+	manager.supervisor.Spawn("downloads", "resume", func() {
+		// 暂停期间输出文件或本地片段可能被修改，先核对已完成的片段
+		if manager.opt != nil {
+			if check := task.verifyCompleted(manager.opt, manager.afe, manager.self); len(check.Reset) > 0 {
+				logrus.Warnf("[%s]下载任务 %s 有 %d 个已完成片段的内容与哈希不一致，重新下载: %v", debug.WhereAmI(), taskID, len(check.Reset), check.Reset)
+				go manager.SaveTasksToFileSingleChan()
+			}
+		}
+
 		// 更新每个文件片段的节点信息和纠删码信息
 		task.File.Segments.Range(func(key, value interface{}) bool {
 			index := key.(int)
@@ -174,14 +379,7 @@ func (manager *DownloadManager) ContinueDownload(taskID string) error {
 			}
 			return true
 		})
-	}()
-
-	task.SetDownloadStatus(StatusDownloading) // 设置下载任务的状态为"下载中"
-
-	// 启动协程保存任务状态至文件
-	go manager.SaveTasksToFileSingleChan()
-
-	return nil
+	})
 }
 
 // // ContinueDownload 继续下载操作
@@ -218,12 +416,18 @@ func (manager *DownloadManager) ContinueDownload(taskID string) error {
 // 	return nil
 // }
 
-// ClearDownloadTask 清空文件的下载任务
+// ClearDownloadTask 清空文件的下载任务，演练模式下只报告将要清空的任务数量
 func (manager *DownloadManager) ClearDownloadTask() {
 	manager.Mu.Lock()
 	defer manager.Mu.Unlock()
 
+	if manager.opt.GetDryRun() {
+		logrus.Infof("[%s]演练模式: 将清空 %d 个下载任务", debug.WhereAmI(), len(manager.Tasks))
+		return
+	}
+
 	manager.Tasks = make(map[string]*DownloadTask)
+	manager.admission.reset()
 
 	go manager.SaveTasksToFileSingleChan() // 保存任务至文件的通知通道
 }
@@ -0,0 +1,133 @@
+package downloads
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/network"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/dep2p"
+	"github.com/bpfs/dep2p/kbucket"
+	"github.com/bpfs/dep2p/pubsub"
+	"github.com/bpfs/dep2p/streams"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+)
+
+// 文件下载请求主题按文件唯一标识的前缀分片，每个节点只订阅：
+//   - 本节点在 DHT 中位置对应的分片
+//   - 本节点存储的文件所在的分片
+// 请求方不订阅分片主题，只向文件所在的分片发布请求。
+
+// shardRescanInterval 重新扫描本地存储文件所在分片的间隔
+const shardRescanInterval = time.Minute
+
+// ChecklistShard 获取文件所在的下载请求分片
+// 参数：
+//   - fileID: string 文件唯一标识
+//   - shards: int 分片数量
+//
+// 返回值：
+//   - int: 分片编号，范围为 [0, shards)
+func ChecklistShard(fileID string, shards int) int {
+	if shards <= 1 {
+		return 0
+	}
+	prefix, err := hex.DecodeString(fmt.Sprintf("%.4s", fileID))
+	if err != nil || len(prefix) < 2 {
+		// 文件唯一标识不是十六进制时，按 DHT 键的前缀分片
+		prefix = kbucket.ConvertKey(fileID)
+	}
+	return int(binary.BigEndian.Uint16(prefix) % uint16(shards))
+}
+
+// ChecklistTopic 获取文件下载请求应发送的主题
+// 参数：
+//   - fileID: string 文件唯一标识
+//   - shards: int 分片数量，不大于 1 时返回单一的全局主题
+//
+// 返回值：
+//   - string: 主题名称
+func ChecklistTopic(fileID string, shards int) string {
+	if shards <= 1 {
+		return PubSubDownloadChecklistRequestTopic
+	}
+	return shardTopic(ChecklistShard(fileID, shards), shards)
+}
+
+// shardTopic 获取分片主题的名称，名称包含分片数量，避免分片数量不同的节点混用主题
+func shardTopic(shard, shards int) string {
+	return fmt.Sprintf("%s/%d-%d", PubSubDownloadChecklistRequestTopic, shards, shard)
+}
+
+// homeShard 获取节点在 DHT 中位置对应的分片
+func homeShard(self peer.ID, shards int) int {
+	return int(binary.BigEndian.Uint16(kbucket.ConvertPeerID(self)) % uint16(shards))
+}
+
+// shardSubscriber 管理本节点订阅的下载请求分片
+type shardSubscriber struct {
+	mu         sync.Mutex
+	opt        *opts.Options
+	afe        afero.Afero
+	p2p        *dep2p.DeP2P
+	pubsub     *pubsub.DeP2PPubSub
+	shards     int
+	subscribed map[int]bool // 已订阅的分片
+}
+
+// subscribe 订阅指定的分片
+func (s *shardSubscriber) subscribe(shard int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subscribed[shard] {
+		return
+	}
+	topic := shardTopic(shard, s.shards)
+	if err := s.pubsub.SubscribeWithTopic(topic, network.PubSubHandler(topic, func(res *streams.RequestMessage) {
+		HandleFileDownloadRequestPubSub(s.opt, s.afe, s.p2p, s.pubsub, res)
+	}), true); err != nil {
+		logrus.Errorf("[%s]订阅下载请求分片 %d 失败: %v", debug.WhereAmI(), shard, err)
+		return
+	}
+	s.subscribed[shard] = true
+}
+
+// scan 订阅本节点存储的文件所在的分片
+func (s *shardSubscriber) scan() {
+	root := filepath.Join(paths.GetSlicePath(), s.p2p.Host().ID().String())
+	entries, err := afero.ReadDir(s.afe, root)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			s.subscribe(ChecklistShard(entry.Name(), s.shards))
+		}
+	}
+}
+
+// run 订阅本节点位置对应的分片，并定时订阅新存储的文件所在的分片
+func (s *shardSubscriber) run(ctx context.Context) {
+	s.subscribe(homeShard(s.p2p.Host().ID(), s.shards))
+	s.scan()
+
+	ticker := time.NewTicker(shardRescanInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.scan()
+		}
+	}
+}
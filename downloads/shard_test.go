@@ -0,0 +1,24 @@
+package downloads
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChecklistTopic(t *testing.T) {
+	fileID := "00ff" + strings.Repeat("0", 60)
+	if got := ChecklistShard(fileID, 16); got != 0xff%16 {
+		t.Fatalf("分片应由文件唯一标识的前缀决定, 实际 %d", got)
+	}
+	if got := ChecklistTopic(fileID, 1); got != PubSubDownloadChecklistRequestTopic {
+		t.Fatalf("不分片时应使用全局主题, 实际 %s", got)
+	}
+	if a, b := ChecklistTopic(fileID, 16), ChecklistTopic(fileID, 32); a == b {
+		t.Fatal("分片数量不同的主题不应相同")
+	}
+	for _, id := range []string{"", "xyz", "not-hex-file-id"} {
+		if shard := ChecklistShard(id, 7); shard < 0 || shard >= 7 {
+			t.Fatalf("%q 的分片 %d 超出范围", id, shard)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package downloads
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/sirupsen/logrus"
+)
+
+// 下载完成时，写入磁盘的最终文件可同时输出到多个附加的目标，
+// 例如计算外部校验和或交给转码程序。附加目标各自独立：某个目标写入失败只记录其错误，
+// 不影响其他目标，也不影响下载任务本身的完成。
+
+// SinkResult 附加输出目标的写入结果
+type SinkResult struct {
+	Name    string // 目标名称
+	Written int64  // 写入的字节数
+	Err     error  // 写入或关闭失败的原因，成功时为 nil
+}
+
+// sinks 下载任务的附加输出目标
+type sinks struct {
+	mu      sync.Mutex
+	names   []string                  // 按添加顺序排列的目标名称
+	writers map[string]io.WriteCloser // 目标名称到写入器的映射
+	results []SinkResult              // 最近一次输出的结果
+}
+
+// add 添加附加输出目标
+func (s *sinks) add(name string, w io.WriteCloser) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writers == nil {
+		s.writers = make(map[string]io.WriteCloser)
+	}
+	if _, ok := s.writers[name]; ok {
+		return fmt.Errorf("%w: 输出目标 %s 已存在", errs.ErrInvalidArgument, name)
+	}
+	s.names = append(s.names, name)
+	s.writers[name] = w
+	return nil
+}
+
+// sinkWriter 记录单个目标的写入量与首个错误，出错后丢弃后续数据，避免影响其他目标
+type sinkWriter struct {
+	w       io.Writer
+	written int64
+	err     error
+}
+
+// Write 实现 io.Writer 接口，始终报告写入成功
+func (sw *sinkWriter) Write(p []byte) (int, error) {
+	if sw.err != nil {
+		return len(p), nil
+	}
+	n, err := sw.w.Write(p)
+	sw.written += int64(n)
+	if err == nil && n < len(p) {
+		err = io.ErrShortWrite
+	}
+	sw.err = err
+	return len(p), nil
+}
+
+// tee 读取一次文件，同时写入所有附加输出目标，完成后关闭各目标并移除
+// 参数：
+//   - path: string 下载完成的文件路径
+//
+// 返回值：
+//   - []SinkResult: 各目标的写入结果，没有附加目标时为 nil
+func (s *sinks) tee(path string) []SinkResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.names) == 0 {
+		return nil
+	}
+
+	writers := make([]*sinkWriter, len(s.names))
+	multi := make([]io.Writer, len(s.names))
+	for i, name := range s.names {
+		writers[i] = &sinkWriter{w: s.writers[name]}
+		multi[i] = writers[i]
+	}
+
+	var readErr error
+	if file, err := os.Open(path); err != nil {
+		readErr = err
+	} else {
+		_, readErr = io.Copy(io.MultiWriter(multi...), file)
+		file.Close()
+	}
+
+	results := make([]SinkResult, len(s.names))
+	for i, name := range s.names {
+		err := writers[i].err
+		if err == nil {
+			err = readErr
+		}
+		if closeErr := s.writers[name].Close(); err == nil {
+			err = closeErr
+		}
+		results[i] = SinkResult{Name: name, Written: writers[i].written, Err: err}
+	}
+
+	s.names, s.writers, s.results = nil, nil, results
+	return results
+}
+
+// abort 下载任务取消或失败时关闭所有附加目标，支持 CloseWithError 的目标(如 io.PipeWriter)会收到失败原因
+func (s *sinks) abort(cause error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.names) == 0 {
+		return
+	}
+
+	results := make([]SinkResult, len(s.names))
+	for i, name := range s.names {
+		if w, ok := s.writers[name].(interface{ CloseWithError(error) error }); ok {
+			w.CloseWithError(cause)
+		} else {
+			s.writers[name].Close()
+		}
+		results[i] = SinkResult{Name: name, Err: cause}
+	}
+	s.names, s.writers, s.results = nil, nil, results
+}
+
+// AddDownloadSink 为下载任务添加附加输出目标
+// 文件下载完成后，其内容会在写入磁盘的同时输出到该目标，随后关闭目标
+// 参数：
+//   - taskID: string 任务唯一标识
+//   - name: string 目标名称，同一任务中不能重复
+//   - sink: io.WriteCloser 输出目标
+//
+// 返回值：
+//   - error: 任务不存在或名称重复时返回错误信息
+func (manager *DownloadManager) AddDownloadSink(taskID, name string, sink io.WriteCloser) error {
+	manager.Mu.Lock()
+	task, ok := manager.Tasks[taskID]
+	manager.Mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: 下载任务 %s", errs.ErrTaskNotFound, taskID)
+	}
+	if task.GetDownloadStatus() == StatusCompleted {
+		return fmt.Errorf("%w: 下载任务 %s 已完成", errs.ErrInvalidArgument, taskID)
+	}
+	return task.sinks.add(name, sink)
+}
+
+// SinkResults 获取下载任务附加输出目标的写入结果
+// 参数：
+//   - taskID: string 任务唯一标识
+//
+// 返回值：
+//   - []SinkResult: 按添加顺序排列的结果，尚未输出时为 nil
+//   - error: 任务不存在时返回错误信息
+func (manager *DownloadManager) SinkResults(taskID string) ([]SinkResult, error) {
+	manager.Mu.Lock()
+	task, ok := manager.Tasks[taskID]
+	manager.Mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: 下载任务 %s", errs.ErrTaskNotFound, taskID)
+	}
+	task.sinks.mu.Lock()
+	defer task.sinks.mu.Unlock()
+	return append([]SinkResult(nil), task.sinks.results...), nil
+}
+
+// teeToSinks 将下载完成的文件输出到附加目标，并记录失败的目标
+func (task *DownloadTask) teeToSinks(path string) {
+	for _, result := range task.sinks.tee(path) {
+		if result.Err != nil {
+			logrus.Warnf("[%s]下载任务 %s 输出到 %s 失败: %v", debug.WhereAmI(), task.TaskID, result.Name, result.Err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package downloads
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// nopSink 记录写入内容的输出目标
+type nopSink struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (s *nopSink) Close() error { s.closed = true; return nil }
+
+// brokenSink 第一次写入即失败的输出目标
+type brokenSink struct{ closed bool }
+
+func (s *brokenSink) Write(p []byte) (int, error) { return 0, errors.New("broken") }
+func (s *brokenSink) Close() error                { s.closed = true; return nil }
+
+func TestSinksTee(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out")
+	content := bytes.Repeat([]byte("defs"), 10000)
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var s sinks
+	good, bad := new(nopSink), new(brokenSink)
+	if err := s.add("checksum", good); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.add("checksum", good); err == nil {
+		t.Fatal("重复的目标名称应返回错误")
+	}
+	if err := s.add("transcoder", bad); err != nil {
+		t.Fatal(err)
+	}
+
+	results := s.tee(path)
+	if len(results) != 2 || results[0].Err != nil || results[0].Written != int64(len(content)) || results[1].Err == nil {
+		t.Fatalf("results = %+v", results)
+	}
+	if !bytes.Equal(good.Bytes(), content) || !good.closed || !bad.closed {
+		t.Fatal("失败的目标不应影响其他目标，且所有目标都应关闭")
+	}
+	if s.tee(path) != nil {
+		t.Fatal("输出后目标应被移除")
+	}
+}
+
+func TestSinksAbort(t *testing.T) {
+	var s sinks
+	r, w := io.Pipe()
+	if err := s.add("pipe", w); err != nil {
+		t.Fatal(err)
+	}
+	cause := errors.New("canceled")
+	s.abort(cause)
+	if _, err := r.Read(make([]byte, 1)); err != cause {
+		t.Fatalf("读取端应收到失败原因, got %v", err)
+	}
+	if len(s.results) != 1 || s.results[0].Err != cause {
+		t.Fatalf("results = %+v", s.results)
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/bpfs/defs/afero"
 	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/middleware"
 	"github.com/bpfs/defs/opts"
 	"github.com/bpfs/defs/paths"
 	"github.com/bpfs/defs/reedsolomon"
@@ -102,18 +103,6 @@ func (task *DownloadTask) CheckDataSegmentsCompleted() bool {
 // 	return false
 // }
 
-// hasEnoughDataPieces 检查是否有足够的数据片段进行合并
-// 参数：
-//   - task: *DownloadTask 当前下载任务
-//   - fileList: []string 文件列表
-//
-// 返回值：
-//   - bool 是否有足够的数据片段
-func (task *DownloadTask) hasEnoughDataPieces(fileList []string) bool {
-	// 检查数据片段数量是否足够
-	return task.DataPieces != 0 && len(fileList) >= task.DataPieces
-}
-
 // handleShardError 处理切片读取错误
 // 参数：
 //   - task: *DownloadTask 当前下载任务
@@ -131,10 +120,11 @@ func (task *DownloadTask) handleShardError() {
 // 参数：
 //   - task: *DownloadTask 当前下载任务
 //   - shards: [][]byte 切片数据
+//   - level: opts.VerifyLevel 校验级别，完整校验时检查校验片段与数据片段是否一致
 //
 // 返回值：
 //   - bool 是否恢复成功
-func (task *DownloadTask) recoverShards(shards [][]byte) bool {
+func (task *DownloadTask) recoverShards(shards [][]byte, level opts.VerifyLevel) bool {
 	// 创建纠删码编码器
 	enc, err := reedsolomon.New(task.DataPieces, task.TotalPieces-task.DataPieces)
 	if err != nil {
@@ -143,6 +133,20 @@ func (task *DownloadTask) recoverShards(shards [][]byte) bool {
 		return false
 	}
 
+	// 非完整校验时只重建缺失的数据片段
+	if level != opts.VerifyFull {
+		for i := 0; i < task.DataPieces; i++ {
+			if shards[i] == nil {
+				if err := enc.ReconstructData(shards); err != nil {
+					logrus.Errorf("[%s]: %v", utils.WhereAmI(), err)
+					return false
+				}
+				break
+			}
+		}
+		return true
+	}
+
 	// 验证数据
 	ok, _ := enc.Verify(shards)
 	if !ok {
@@ -162,35 +166,80 @@ func (task *DownloadTask) recoverShards(shards [][]byte) bool {
 	return true
 }
 
-// combineAndDecodeData 合并和解码数据
+// combineAndDecodeData 将恢复出的数据片段写入输出文件，并移动到下载目录
 // 参数：
 //   - opt: *opts.Options 文件存储选项配置
-//   - task: *DownloadTask 当前下载任务
 //   - shards: [][]byte 切片数据
+//   - missing: []int 恢复前缺失的数据片段索引
+//   - level: opts.VerifyLevel 校验级别，完整校验时检查还原后整个文件的哈希
 //
 // 返回值：
 //   - bool 是否合并和解码成功
-func (task *DownloadTask) combineAndDecodeData(opt *opts.Options, shards [][]byte) bool {
-	// 设置临时文件路径
-	tempFilePath := filepath.Join(opt.GetDownloadPath(), task.File.FileID+".defs")
-	// 创建纠删码编码器
-	enc, _ := reedsolomon.New(task.DataPieces, task.TotalPieces-task.DataPieces)
-	// 合并和解码数据
-	if err := combineAndDecode(tempFilePath, enc, shards, int(task.File.Size)); err != nil {
-		// 如果发生错误，记录错误日志
+func (task *DownloadTask) combineAndDecodeData(opt *opts.Options, shards [][]byte, missing []int, level opts.VerifyLevel) bool {
+	// 输出文件路径
+	tempFilePath := task.assemblyPath(opt)
+
+	// 写入恢复出的数据片段
+	for _, index := range missing {
+		if err := task.writeShardAt(opt, index, shards[index]); err != nil {
+			logrus.Errorf("[%s]: %v", utils.WhereAmI(), err)
+			return false
+		}
+	}
+
+	// 写回尚未 fsync 的内容
+	if err := task.flushAssembly(opt); err != nil {
 		logrus.Errorf("[%s]: %v", utils.WhereAmI(), err)
 		return false
 	}
 
+	// 还原分片前压缩的内容，压缩内容无效时重新合并也无法还原，任务失败
+	if err := task.decodeContent(tempFilePath); err != nil {
+		logrus.Errorf("[%s]还原压缩的文件内容时失败: %v", utils.WhereAmI(), err)
+		os.Remove(tempFilePath) // 清理临时文件
+		task.SetDownloadStatus(StatusFailed)
+		return false
+	}
+
+	// 完整校验还原后的文件，内容已经还原，校验失败时无法重试
+	if level == opts.VerifyFull {
+		if err := task.verifyFileChecksum(tempFilePath); err != nil {
+			logrus.Errorf("[%s]下载任务 %s 校验失败: %v", utils.WhereAmI(), task.TaskID, err)
+			os.Remove(tempFilePath) // 清理临时文件
+			task.SetDownloadStatus(StatusFailed)
+			return false
+		}
+	}
+
+	// 执行任务完成前的中间件
+	if err := opt.GetMiddleware().RunBeforeTaskComplete(&middleware.TaskCompleteContext{
+		Kind:     middleware.TaskDownload,
+		TaskID:   task.TaskID,
+		FileID:   task.File.FileID,
+		Name:     task.File.Name,
+		Size:     task.File.Size,
+		FilePath: tempFilePath,
+	}); err != nil {
+		logrus.Errorf("[%s]中间件拒绝完成下载任务 %s: %v", utils.WhereAmI(), task.TaskID, err)
+		os.Remove(tempFilePath) // 清理临时文件
+		task.SetDownloadStatus(StatusFailed)
+		return false
+	}
+
 	// 获取最终文件路径
 	finalFilePath := task.getFinalFilePath(opt)
 	// 重命名临时文件为最终文件
 	if err := os.Rename(tempFilePath, finalFilePath); err != nil {
-		// 如果发生错误，记录错误日志
+		// 输出文件已经还原，重新合并会再次解压，因此不再重试
 		logrus.Errorf("[%s]重命名文件时发生错误: %v", utils.WhereAmI(), err)
+		os.Remove(tempFilePath) // 清理临时文件
+		task.SetDownloadStatus(StatusFailed)
 		return false
 	}
 
+	// 输出到附加目标，目标失败不影响任务完成
+	task.teeToSinks(finalFilePath)
+
 	return true
 }
 
@@ -202,8 +251,15 @@ func (task *DownloadTask) combineAndDecodeData(opt *opts.Options, shards [][]byt
 // 返回值：
 //   - string 最终文件路径
 func (task *DownloadTask) getFinalFilePath(opt *opts.Options) string {
+	// 文件名来自其他节点提供的元数据，只保留最后一个路径元素，避免写到下载目录之外
+	// 无法解密文件元数据或文件名无效时，使用文件唯一标识作为文件名
+	name := filepath.Base(filepath.Clean("/" + strings.ReplaceAll(task.File.Name, "\\", "/")))
+	if name == "" || name == "." || name == ".." || name == "/" {
+		name = filepath.Base(task.File.FileID)
+	}
+
 	// 设置初始的最终文件路径
-	finalFilePath := filepath.Join(opt.GetDownloadPath(), task.File.Name)
+	finalFilePath := filepath.Join(opt.GetDownloadPath(), name)
 	counter := 1
 	for {
 		// 检查文件是否存在
@@ -212,7 +268,7 @@ func (task *DownloadTask) getFinalFilePath(opt *opts.Options) string {
 			break
 		} else {
 			// 文件存在，生成新的文件名
-			newFileName := generateNewFileName(task.File.Name, counter)
+			newFileName := generateNewFileName(name, counter)
 			finalFilePath = filepath.Join(opt.GetDownloadPath(), newFileName)
 			counter++
 		}
@@ -235,39 +291,105 @@ func (task *DownloadTask) setTaskStatusAndNotify() {
 }
 
 // readAllShards 读取所有片段数据
-func (task *DownloadTask) readAllShards(opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P) ([][]byte, error) {
+// 返回值：
+//   - [][]byte: 各片段的数据，缺失或损坏的片段为 nil
+//   - []int: 已标记为完成、但无法读取或哈希值不一致的片段索引
+//   - error: 如果发生错误，返回错误信息
+func (task *DownloadTask) readAllShards(opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P) ([][]byte, []int, error) {
+	// 信任传输层时不校验片段的哈希
+	checkHash := task.verifyLevel(opt) != opts.VerifyNone
 	subDir := filepath.Join(paths.GetDownloadPath(), p2p.Host().ID().String(), task.File.FileID) // 设置子目录
 	shards := make([][]byte, task.TotalPieces)
+	var corrupt []int
 	for i := range shards {
-		if segment, ok := task.File.GetSegment(i); ok {
-			content, err := util.Read(opt, afe, subDir, segment.SegmentID)
-			if err != nil || len(content) == 0 {
-				if err != nil {
-					logrus.Warnf("[%s]: %v", debug.WhereAmI(), err)
-				}
-				shards[i] = nil // 报错的片段用nil表示
-				continue
-			}
-			// 计算 content 的哈希值是否与 segment.Checksum 一致，如果不一致，删除并置为nil
-			hash := util.CalculateHash(content)
-			if !util.CompareHashes(hash, segment.Checksum) {
-				err := afe.Remove(filepath.Join(subDir, segment.GetSegmentID()))
+		segment, ok := task.File.GetSegment(i)
+		if !ok || !segment.IsCompleted() {
+			shards[i] = nil // 缺失或尚未下载的片段用nil表示
+			continue
+		}
+
+		// 数据片段从输出文件中读取
+		if task.isAssembledShard(i) {
+			content, err := task.readShardAt(opt, i)
+			if err != nil || checkHash && !util.CompareHashes(util.CalculateHash(content), segment.Checksum) {
 				if err != nil {
 					logrus.Warnf("[%s]: %v", debug.WhereAmI(), err)
 				}
-				shards[i] = nil // 哈希值不一致的片段用nil表示
+				shards[i] = nil // 报错或哈希值不一致的片段用nil表示，重新下载或恢复后重新写入
+				corrupt = append(corrupt, i)
 				continue
 			}
 			shards[i] = content
-		} else {
-			shards[i] = nil // 缺失的片段用nil表示
+			continue
 		}
+
+		content, err := util.Read(opt, afe, subDir, segment.SegmentID)
+		if err != nil || len(content) == 0 {
+			if err != nil {
+				logrus.Warnf("[%s]: %v", debug.WhereAmI(), err)
+			}
+			shards[i] = nil // 报错的片段用nil表示
+			corrupt = append(corrupt, i)
+			continue
+		}
+		// 计算 content 的哈希值是否与 segment.Checksum 一致，如果不一致，删除并置为nil
+		if checkHash && !util.CompareHashes(util.CalculateHash(content), segment.Checksum) {
+			if err := afe.Remove(filepath.Join(subDir, segment.GetSegmentID())); err != nil {
+				logrus.Warnf("[%s]: %v", debug.WhereAmI(), err)
+			}
+			shards[i] = nil // 哈希值不一致的片段用nil表示
+			corrupt = append(corrupt, i)
+			continue
+		}
+		shards[i] = content
 	}
 
-	return shards, nil
+	return shards, corrupt, nil
+}
+
+// requeueShards 将损坏的片段重新标记为待下载并重新下载
+// 参数：
+//   - indexes: []int 损坏的片段索引
+func (task *DownloadTask) requeueShards(indexes []int) {
+	task.rwmu.Lock()
+	for _, index := range indexes {
+		task.Progress.Clear(index)
+	}
+	task.rwmu.Unlock()
+
+	for _, index := range indexes {
+		task.File.SetSegmentStatus(index, SegmentStatusPending)
+		task.EventDownSnippetChan(index)
+	}
+}
+
+// failMerge 合并失败不再重试时，将任务标记为失败并释放占用的临时空间
+// 参数：
+//   - opt: *opts.Options 文件存储选项配置
+//   - afe: afero.Afero 文件系统接口
+//   - p2p: *dep2p.DeP2P 网络主机
+func (task *DownloadTask) failMerge(opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P) {
+	task.SetDownloadStatus(StatusFailed)
+	task.releaseTempSpace(opt, afe, p2p.Host().ID())
+	task.sinks.abort(fmt.Errorf("下载任务 %s 失败", task.TaskID))
+}
+
+// retryMerge 记录一次合并失败，等待下一次合并检查时重试；连续失败达到上限时任务失败
+// 参数：
+//   - opt: *opts.Options 文件存储选项配置
+//   - afe: afero.Afero 文件系统接口
+//   - p2p: *dep2p.DeP2P 网络主机
+func (task *DownloadTask) retryMerge(opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P) {
+	task.mergeFailures++
+	if task.mergeFailures >= MergeRetryLimit {
+		logrus.Errorf("[%s]下载任务 %s 连续 %d 次合并失败", debug.WhereAmI(), task.TaskID, task.mergeFailures)
+		task.failMerge(opt, afe, p2p)
+	}
+	task.handleShardError()
 }
 
 // recoverDataFromSlices 从下载的切片中恢复文件数据
+// 已完成但内容损坏的片段重新下载；可用片段不足时等待重新下载完成后再次合并
 // 参数：
 //   - opt: *opts.Options 文件存储选项配置
 //   - afe: afero.Afero 文件系统接口
@@ -278,96 +400,78 @@ func (task *DownloadTask) readAllShards(opt *opts.Options, afe afero.Afero, p2p
 // 返回值：
 //   - bool 恢复数据是否成功
 func (task *DownloadTask) recoverDataFromSlices(opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, subDir string) bool {
-	for {
-		// 检查任务状态是否已完成
-		if task.GetDownloadStatus() == StatusCompleted {
-			return false
-		}
-
-		// 增加合并计数器
-		task.MergeCounter++
-		if task.MergeCounter > 1 {
-			// 如果存在其他并行合并请求，则跳过本次合并
-			return false
-		}
+	// 检查任务状态是否已完成或已失败
+	if status := task.GetDownloadStatus(); status == StatusCompleted || status == StatusFailed {
+		return false
+	}
 
-		// 获取文件列表
-		fileList, err := getFileList(afe, subDir)
-		if err != nil || len(fileList) == 0 {
-			// 如果文件列表获取失败或者文件列表为空，则重置任务
-			task.resetTask()
-			return false
-		}
+	// 增加合并计数器
+	task.MergeCounter++
+	if task.MergeCounter > 1 {
+		// 如果存在其他并行合并请求，则跳过本次合并
+		return false
+	}
 
-		// 检查是否有足够的数据片段进行合并
-		if !task.hasEnoughDataPieces(fileList) {
-			//task.RWMu.Unlock()
-			return false
-		}
+	// 检查是否有足够的片段进行合并
+	if !task.CheckDataSegmentsCompleted() {
+		task.MergeCounter = 0
+		return false
+	}
 
-		// 读取所有切片
-		shards, err := task.readAllShards(opt, afe, p2p)
-		if err != nil {
-			// 处理切片读取错误
-			task.handleShardError()
-			continue
-		}
+	// 读取所有切片
+	shards, corrupt, err := task.readAllShards(opt, afe, p2p)
+	if err != nil {
+		// 处理切片读取错误
+		task.retryMerge(opt, afe, p2p)
+		return false
+	}
 
-		// 使用纠删码进行恢复
-		if !task.recoverShards(shards) {
-			// 处理切片恢复错误
+	// 损坏的片段重新下载，可用片段不足以恢复时等待下载完成
+	if len(corrupt) > 0 {
+		logrus.Warnf("[%s]下载任务 %s 有 %d 个已完成片段损坏，重新下载: %v", debug.WhereAmI(), task.TaskID, len(corrupt), corrupt)
+		task.requeueShards(corrupt)
+		if !task.CheckDataSegmentsCompleted() {
 			task.handleShardError()
-			continue
+			return false
 		}
+	}
 
-		// 合并和解码数据
-		if !task.combineAndDecodeData(opt, shards) {
-			// 处理数据合并和解码错误
-			task.handleShardError()
-			continue
+	// 记录缺失的数据片段，恢复后写入输出文件
+	var missing []int
+	for i := 0; i < task.DataPieces; i++ {
+		if shards[i] == nil {
+			missing = append(missing, i)
 		}
-
-		// 设置下载任务状态和发送通知
-		task.setTaskStatusAndNotify()
-
-		return true
 	}
-}
 
-// getFileList 获取文件列表
-// 参数：
-//   - afe: afero.Afero 文件系统接口
-//   - subDir: string 子目录路径
-//
-// 返回值：
-//   - []string 文件列表
-//   - error 错误信息
-func getFileList(afe afero.Afero, subDir string) ([]string, error) {
-	// 获取子目录下的所有文件名
-	fileList, err := afero.ListFileNamesRecursively(afe, subDir)
-	if err != nil {
-		// 如果发生错误，记录错误日志
-		logrus.Errorf("[%s]: %v", utils.WhereAmI(), err)
+	// 使用纠删码进行恢复
+	level := task.verifyLevel(opt)
+	if !task.recoverShards(shards, level) {
+		// 处理切片恢复错误
+		task.retryMerge(opt, afe, p2p)
+		return false
 	}
-	return fileList, err
-}
 
-// combineAndDecode 将分片数据合并为原始数据并进行解码。
-func combineAndDecode(path string, enc reedsolomon.Encoder, split [][]byte, size int) error {
-	// func combineAndDecode(path string, enc reedsolomon.Encoder, split [][]byte, dataShards, parityShards, size int) error {
-	file, err := os.Create(path)
-	if err != nil {
-		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
-		return err
-	}
-	defer file.Close()
+	// 记录由纠删码重建而非下载的数据片段
+	task.provenance.reconstruct(missing)
 
-	// 还原数据
-	if err := enc.Join(file, split, size); err != nil {
-		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
-		return err
+	// 合并和解码数据
+	if !task.combineAndDecodeData(opt, shards, missing, level) {
+		// 还原失败、中间件拒绝或校验失败时不再重试，释放任务占用的临时空间
+		if task.GetDownloadStatus() == StatusFailed {
+			task.failMerge(opt, afe, p2p)
+			return false
+		}
+		// 处理数据合并和解码错误
+		task.retryMerge(opt, afe, p2p)
+		return false
 	}
-	return nil
+
+	// 设置下载任务状态和发送通知
+	task.mergeFailures = 0
+	task.setTaskStatusAndNotify()
+
+	return true
 }
 
 // generateNewFileName 生成新文件名
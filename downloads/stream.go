@@ -6,6 +6,7 @@ import (
 
 	"github.com/bpfs/defs/afero"
 	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
 	"github.com/bpfs/defs/network"
 	"github.com/bpfs/defs/opts"
 	"github.com/bpfs/defs/util"
@@ -20,6 +21,9 @@ import (
 )
 
 var (
+	// 文件下载请求清单（携带委托下载令牌请求）
+	StreamDownloadChecklistRequestProtocol = fmt.Sprintf("defs@stream/download/checklist/request/%s", version)
+
 	// 文件下载请求清单（回应）
 	StreamDownloadChecklistResponseProtocol = fmt.Sprintf("defs@stream/download/checklist/response/%s", version)
 
@@ -66,13 +70,24 @@ func RegisterDownloadStreamProtocol(input RegisterStreamProtocolInput) {
 	input.LC.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
 			// 注册文件下载请求清单（回应）
-			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamDownloadChecklistResponseProtocol), streams.HandlerWithRW(usp.handleDownloadChecklistResponse))
+			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamDownloadChecklistResponseProtocol), network.HandlerWithLimits(StreamDownloadChecklistResponseProtocol, network.HandlerWithRW(usp.handleDownloadChecklistResponse)))
+
+			// 注册携带委托下载令牌的文件下载请求清单
+			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamDownloadChecklistRequestProtocol), network.HandlerWithLimits(StreamDownloadChecklistRequestProtocol, network.HandlerWithRW(usp.handleDelegatedChecklist)))
 
 			// 注册文件下载本地
-			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamDownloadLocalProtocol), streams.HandlerWithRW(usp.handleStreamGetSliceToLocal))
+			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamDownloadLocalProtocol), network.HandlerWithLimits(StreamDownloadLocalProtocol, network.HandlerWithRW(usp.handleStreamGetSliceToLocal)))
+			network.RegisterReusableHandler(input.P2P.Host(), StreamDownloadLocalProtocol, usp.handleStreamGetSliceToLocal)
 
 			// 注册文件下载本地
-			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamAsyncDownloadProtocol), streams.HandlerWithRW(usp.handleStreamAsyncDownload))
+			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamAsyncDownloadProtocol), network.HandlerWithLimits(StreamAsyncDownloadProtocol, network.HandlerWithRW(usp.handleStreamAsyncDownload)))
+
+			// 注册下载申请
+			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamApprovalRequestProtocol), network.HandlerWithLimits(StreamApprovalRequestProtocol, network.HandlerWithRW(usp.handleApprovalRequest)))
+			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamApprovalStatusProtocol), network.HandlerWithLimits(StreamApprovalStatusProtocol, network.HandlerWithRW(usp.handleApprovalStatus)))
+
+			// 注册撤销列表同步
+			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamRevocationSyncProtocol), network.HandlerWithLimits(StreamRevocationSyncProtocol, network.HandlerWithRW(usp.handleRevocationSync)))
 
 			return nil
 		},
@@ -93,6 +108,8 @@ type FileDownloadResponseChecklistPayload struct {
 	Checksum        []byte             // 文件的校验和
 	SliceTable      map[int]*HashTable // 文件片段的哈希表，记录每个片段的哈希值，支持纠错和数据完整性验证
 	AvailableSlices []int              // 本地存储的文件片段信息
+	Metadata        []byte             // 加密的文件元数据，开启元数据加密时文件名和MIME类型为空
+	NeedsDelegation bool               // 本节点存储了文件，请求方需通过流携带委托下载令牌获取清单
 }
 
 // handleDownloadChecklistResponse 处理下载请求清单（响应）
@@ -127,9 +144,93 @@ func (sp *StreamProtocol) handleDownloadChecklistResponse(req *streams.RequestMe
 		return 6603, "解码错误"
 	}
 
+	// 代所有者下载时，携带委托下载令牌向存储节点获取清单
+	if payload.NeedsDelegation {
+		task.spawn("delegated-checklist", func() { requestDelegatedChecklist(sp.P2P, task, receiver) })
+		return 200, "成功"
+	}
+
 	// 更新下载任务中特定片段的节点信息
-	go task.UpdateDownloadPieceInfo(payload, receiver)
+	task.spawn("update-piece-info", func() { task.UpdateDownloadPieceInfo(payload, receiver) })
+
+	return 200, "成功"
+}
+
+// DelegatedChecklistRequest 携带委托下载令牌请求文件下载清单的请求消息
+type DelegatedChecklistRequest struct {
+	TaskID      string // 任务唯一标识
+	FileID      string // 文件唯一标识
+	UserPubHash []byte // 用户的公钥哈希
+	Delegation  []byte // 委托下载令牌
+}
+
+// requestDelegatedChecklist 携带委托下载令牌向存储文件的节点请求下载清单，并更新下载任务
+// 令牌只通过流发送给声明存储了该文件的节点，不在订阅消息中广播
+// 参数：
+//   - p2p: *dep2p.DeP2P 网络主机
+//   - task: *DownloadTask 下载任务
+//   - receiver: peer.ID 存储文件的节点ID
+func requestDelegatedChecklist(p2p *dep2p.DeP2P, task *DownloadTask, receiver peer.ID) {
+	if len(task.Delegation) == 0 {
+		return
+	}
+	ask := DelegatedChecklistRequest{
+		TaskID:      task.TaskID,
+		FileID:      task.File.FileID,
+		UserPubHash: task.UserPubHash,
+		Delegation:  task.Delegation,
+	}
+	res, err := network.SendStreamContext(task.ctx, p2p, StreamDownloadChecklistRequestProtocol, "", receiver, ask)
+	if err != nil || res == nil || res.Code != 200 {
+		if err != nil {
+			logrus.Errorf("[%s]请求下载清单时失败: %v", debug.WhereAmI(), err)
+		} else if res != nil {
+			logrus.Warnf("[%s]节点 %s 拒绝了下载清单请求: %d %s", debug.WhereAmI(), receiver, res.Code, res.Msg)
+		}
+		return
+	}
+
+	payload := new(FileDownloadResponseChecklistPayload)
+	if err := util.DecodeFromBytes(res.Data, payload); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return
+	}
+	task.UpdateDownloadPieceInfo(payload, receiver)
+}
+
+// handleDelegatedChecklist 处理携带委托下载令牌的下载清单请求
+// 令牌校验时使用流连接上经过认证的请求方节点ID
+func (sp *StreamProtocol) handleDelegatedChecklist(req *streams.RequestMessage, res *streams.ResponseMessage) (int32, string) {
+	payload := new(DelegatedChecklistRequest)
+	if err := util.DecodeFromBytes(req.Payload, payload); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return 6603, "解码错误"
+	}
+	sender, err := peer.Decode(req.Message.Sender)
+	if err != nil {
+		return 6603, "解码错误"
+	}
+	delegation, err := DecodeDelegation(payload.Delegation)
+	if err != nil {
+		logrus.Warnf("[%s]: %v", debug.WhereAmI(), err)
+		return 403, "委托下载令牌无效"
+	}
 
+	segmentList, err := processSlice(sp.Opt, sp.Afe, sp.P2P, payload.FileID, payload.UserPubHash, delegation, sender)
+	if err != nil {
+		logrus.Errorf("[%s]从指定文件中读取一个或多个段时失败: %v", debug.WhereAmI(), err)
+		return 500, "读取文件片段失败"
+	}
+	if segmentList == nil || len(segmentList.availableSlices) == 0 {
+		return 403, "无权获取文件片段"
+	}
+
+	data, err := util.EncodeToBytes(newChecklistPayload(payload.TaskID, segmentList, delegation))
+	if err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return 6605, "编码错误"
+	}
+	res.Data = data
 	return 200, "成功"
 }
 
@@ -141,6 +242,7 @@ type StreamGetSliceToLocalRequest struct {
 	FileID              string         // 文件唯一标识，用于在系统内部唯一区分文件
 	PrioritySegment     int            // 优先下载的文件片段索引
 	SegmentInfo         map[int]string // 文件片段的索引和唯一标识的映射
+	Delegation          []byte         // 委托下载令牌，代所有者下载时携带
 }
 
 // StreamGetSliceToLocalResponse 发送下载文件片段的任务到网络的响应消息
@@ -150,6 +252,7 @@ type StreamGetSliceToLocalResponse struct {
 
 // RequestStreamGetSliceToLocal 向指定的节点发送请求以下载文件片段
 // 参数：
+//   - ctx: context.Context 上下文，任务取消时中止请求
 //   - p2p: *dep2p.DeP2P 表示 DeP2P 网络主机
 //   - receiver: peer.ID 目标节点的 ID
 //   - downloadMaximumSize: int64 下载最大回复大小
@@ -157,11 +260,12 @@ type StreamGetSliceToLocalResponse struct {
 //   - fileID: string 文件唯一标识
 //   - prioritySegment: int 优先下载的文件片段索引
 //   - segmentInfo: map[int]string 文件片段的索引和唯一标识的映射
+//   - delegation: []byte 委托下载令牌，非代所有者下载时为空
 //
 // 返回值：
 //   - *StreamGetSliceToLocalResponse: 下载文件片段的响应消息
 //   - error: 如果发生错误，返回错误信息
-func RequestStreamGetSliceToLocal(p2p *dep2p.DeP2P, receiver peer.ID, downloadMaximumSize int64, userPubHash []byte, taskID, fileID string, prioritySegment int, segmentInfo map[int]string) (*StreamGetSliceToLocalResponse, error) {
+func RequestStreamGetSliceToLocal(ctx context.Context, p2p *dep2p.DeP2P, receiver peer.ID, downloadMaximumSize int64, userPubHash []byte, taskID, fileID string, prioritySegment int, segmentInfo map[int]string, delegation []byte) (*StreamGetSliceToLocalResponse, error) {
 	ask := StreamGetSliceToLocalRequest{
 		DownloadMaximumSize: downloadMaximumSize,
 		UserPubHash:         userPubHash,
@@ -169,14 +273,14 @@ func RequestStreamGetSliceToLocal(p2p *dep2p.DeP2P, receiver peer.ID, downloadMa
 		FileID:              fileID,
 		PrioritySegment:     prioritySegment,
 		SegmentInfo:         segmentInfo,
+		Delegation:          delegation,
 	}
 
-	network.StreamMutex.Lock()
 	// 发送获取片段到目标节点
-	res, err := network.SendStream(p2p, StreamDownloadLocalProtocol, "", receiver, ask)
+	res, err := network.SendStreamContext(ctx, p2p, StreamDownloadLocalProtocol, "", receiver, ask)
 	if err != nil {
 		logrus.Errorf("[%s]发送请求时失败: %v", utils.WhereAmI(), err)
-		return nil, err
+		return nil, errs.Unreachable(receiver, StreamDownloadLocalProtocol, err)
 	}
 
 	if res != nil && res.Code == 200 && res.Data != nil {
@@ -207,6 +311,16 @@ func (sp *StreamProtocol) handleStreamGetSliceToLocal(req *streams.RequestMessag
 		return 6603, "解码错误"
 	}
 
+	// 非共享文件只提供给所有者或持有委托下载令牌的节点
+	sender, err := peer.Decode(req.Message.Sender)
+	if err != nil {
+		return 6603, "解码错误"
+	}
+	if err := authorizeSegments(sp.Opt, sp.Afe, sp.P2P, payload.FileID, payload.UserPubHash, payload.Delegation, sender); err != nil {
+		logrus.Warnf("[%s]: %v", debug.WhereAmI(), err)
+		return 403, "无权获取文件片段"
+	}
+
 	// 处理下载请求
 	reply, err := ProcessDownloadRequest(sp.Opt, sp.Afe, sp.P2P, sp.PubSub, sp.Download, payload.DownloadMaximumSize, payload.TaskID, payload.FileID, payload.PrioritySegment, payload.SegmentInfo, req.Message.Sender)
 	if err != nil {
@@ -219,6 +333,7 @@ func (sp *StreamProtocol) handleStreamGetSliceToLocal(req *streams.RequestMessag
 		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
 		return 300, "交易信息编码时失败"
 	}
+	sp.Opt.GetCounters().AddServed(int64(segmentInfoSize(reply.SegmentInfo)))
 
 	res.Data = replyBytes
 	return 200, "成功"
@@ -243,16 +358,18 @@ func RequestStreamAsyncDownload(p2p *dep2p.DeP2P, receiver peer.ID, taskID, file
 		SegmentInfo: segmentInfo,
 	}
 
-	network.StreamMutex.Lock()
 	// 发送获取片段到目标节点
 	res, err := network.SendStream(p2p, StreamAsyncDownloadProtocol, "", receiver, ask)
 	if err != nil {
 		logrus.Errorf("[%s]发送请求时失败: %v", utils.WhereAmI(), err)
-		return nil, err
+		return nil, errs.Unreachable(receiver, StreamAsyncDownloadProtocol, err)
 	}
 
-	if res == nil || res.Code != 200 {
-		return nil, fmt.Errorf("发送失败")
+	if res == nil {
+		return nil, errs.Unreachable(receiver, StreamAsyncDownloadProtocol, nil)
+	}
+	if res.Code != 200 {
+		return nil, errs.Rejected(receiver, StreamAsyncDownloadProtocol, res.Code, res.Msg)
 	}
 
 	// 请求方已触发合并操作
@@ -278,6 +395,8 @@ func (sp *StreamProtocol) handleStreamAsyncDownload(req *streams.RequestMessage,
 		return 6603, "解码错误"
 	}
 
+	sp.Opt.GetCounters().AddFetched(int64(segmentInfoSize(payload.SegmentInfo)))
+
 	// 本地处理异步下载文件片段
 	reply, err := localHandleAsyncDownload(sp.Opt, sp.Afe, sp.P2P, sp.Download, req.Message.Sender, payload.TaskID, payload.SegmentInfo)
 	if err != nil {
@@ -300,3 +419,12 @@ func (sp *StreamProtocol) handleStreamAsyncDownload(req *streams.RequestMessage,
 
 	return 200, "成功"
 }
+
+// segmentInfoSize 获取文件片段内容的总字节数
+func segmentInfoSize(segmentInfo map[int][]byte) int {
+	size := 0
+	for _, data := range segmentInfo {
+		size += len(data)
+	}
+	return size
+}
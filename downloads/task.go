@@ -13,6 +13,8 @@ import (
 	"github.com/bpfs/defs/network"
 	"github.com/bpfs/defs/opts"
 	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/defs/qos"
+	"github.com/bpfs/defs/supervise"
 	"github.com/bpfs/defs/util"
 	"github.com/bpfs/defs/wallets"
 	"github.com/bpfs/dep2p"
@@ -46,24 +48,46 @@ const (
 	TokenBucketRefillInterval   = 100 * time.Millisecond // 令牌桶补充间隔
 )
 
+// MergeRetryLimit 合并文件连续失败的次数上限
+// 合并失败时等待下一次合并检查重试，连续失败达到上限后任务失败，不再无限重试
+const MergeRetryLimit = 3
+
 // DownloadTask 描述一个文件下载任务
 type DownloadTask struct {
 	ctx    context.Context    // 上下文用于管理协程的生命周期
 	cancel context.CancelFunc // 取消函数
 
-	rwmu sync.RWMutex // 控制对Progress的并发访问的读写互斥锁
-
-	TaskID       string            // 任务唯一标识
-	File         *DownloadFile     // 待下载的文件信息
-	TotalPieces  int               // 文件总片数（数据片段和纠删码片段的总数）
-	DataPieces   int               // 数据片段的数量
-	OwnerPriv    *ecdsa.PrivateKey // 所有者的私钥
-	Secret       []byte            // 文件加密密钥
-	UserPubHash  []byte            // 用户的公钥哈希
-	Progress     util.BitSet       // 下载任务的进度，表示为0到100之间的百分比
-	CreatedAt    int64             // 任务创建的时间戳
-	UpdatedAt    int64             // 最后一次下载成功的时间戳
-	MergeCounter int               // 用于跟踪文件合并操作的计数器
+	rwmu       sync.RWMutex // 控制对Progress的并发访问的读写互斥锁
+	assemblyMu sync.Mutex   // 控制对输出文件的并发写入
+
+	TaskID       string             // 任务唯一标识
+	File         *DownloadFile      // 待下载的文件信息
+	TotalPieces  int                // 文件总片数（数据片段和纠删码片段的总数）
+	DataPieces   int                // 数据片段的数量
+	OwnerPriv    *ecdsa.PrivateKey  // 所有者的私钥
+	Secret       []byte             // 文件加密密钥
+	UserPubHash  []byte             // 用户的公钥哈希
+	Delegation   []byte             // 委托下载令牌，代所有者下载时携带
+	Progress     util.BitSet        // 下载任务的进度，表示为0到100之间的百分比
+	CreatedAt    int64              // 任务创建的时间戳
+	UpdatedAt    int64              // 最后一次下载成功的时间戳
+	MergeCounter int                // 用于跟踪文件合并操作的计数器
+	QoS          qos.Class          // 任务的服务等级，决定任务可以使用的带宽与并发份额
+	WaitUntil    int64              // 等待网络的截止时间戳，仅在等待网络状态下有效
+	DiskIO       *opts.DiskIOConfig // 写入输出文件时的磁盘参数，为 nil 时使用全局参数
+	Verify       opts.VerifyLevel   // 合并文件前的校验级别，创建时记录全局默认值
+
+	throughput    throughput            // 平滑后的下载速度，用于估计剩余时间
+	provenance    provenance            // 各文件片段的提供节点及验证失败的片段
+	temp          tempSpace             // 任务分配的临时文件与目录，取消或失败时释放
+	sinks         sinks                 // 下载完成时同时输出的附加目标
+	onProgress    func()                // 片段完成后通知保存任务，保存操作由管理器合并
+	onStatus      func(DownloadStatus)  // 状态变化后通知管理器，用于释放准入名额
+	supervisor    *supervise.Supervisor // 后台任务的崩溃恢复，由管理器启动任务时设置
+	disk          diskSync              // 输出文件分批 fsync 的状态
+	mergeFailures int                   // 连续合并失败的次数，达到 MergeRetryLimit 时任务失败
+
+	rebalanceMu sync.Mutex // 串行应用存储节点的片段变更
 
 	TickerChecklist   chan struct{} // 定时任务，通知检查是否需要下载新的索引清单的通道
 	TickerDownSnippet chan struct{} // 定时任务，通知检查是否需要下载新的文件片段的通道
@@ -92,7 +116,7 @@ type DownloadTask struct {
 // NewDownloadTask 创建并初始化一个新的DownloadTask实例。
 // 参数：
 //   - ctx: context.Context 上下文用于管理协程的生命周期。
-//   - mu: *sync.Mutex 互斥锁用于保护状态。
+//   - opt: *opts.Options 文件存储选项配置。
 //   - taskID: string 任务的唯一标识符。
 //   - fileID: string 待下载的文件信息。
 //   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥。
@@ -100,9 +124,9 @@ type DownloadTask struct {
 // 返回值：
 //   - *DownloadTask: 新创建的DownloadTask实例。
 //   - error: 如果发生错误，返回错误信息。
-func NewDownloadTask(ctx context.Context, taskID string, fileID string, ownerPriv *ecdsa.PrivateKey) (*DownloadTask, error) {
-	// 使用私钥和文件校验和生成秘密
-	secret, err := util.GenerateSecretFromPrivateKeyAndChecksum(ownerPriv, []byte(fileID))
+func NewDownloadTask(ctx context.Context, opt *opts.Options, taskID string, fileID string, ownerPriv *ecdsa.PrivateKey) (*DownloadTask, error) {
+	// 获取文件加密密钥，默认由私钥和文件唯一标识生成
+	secret, err := opt.GetKeyProvider().FileKey(ownerPriv, fileID)
 	if err != nil {
 		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
 		return nil, err
@@ -127,17 +151,18 @@ func NewDownloadTask(ctx context.Context, taskID string, fileID string, ownerPri
 
 		rwmu: sync.RWMutex{}, // 初始化读写互斥锁
 
-		TaskID:       taskID,             // 任务唯一标识
-		File:         downloadFile,       // 待下载的文件信息
-		TotalPieces:  0,                  // 文件总片数，初始时未知
-		DataPieces:   0,                  // 数据片段的数量，初始时未知
-		OwnerPriv:    ownerPriv,          // 所有者的私钥
-		Secret:       secret,             // 文件加密密钥
-		UserPubHash:  pubKeyHash,         // 用户的公钥哈希
-		Progress:     *util.NewBitSet(0), // 下载任务的进度
-		CreatedAt:    time.Now().Unix(),  // 任务创建的时间戳
-		UpdatedAt:    time.Time{}.Unix(), // 最后一次下载成功的时间戳
-		MergeCounter: 0,                  // 用于跟踪文件合并操作的计数器
+		TaskID:       taskID,               // 任务唯一标识
+		File:         downloadFile,         // 待下载的文件信息
+		TotalPieces:  0,                    // 文件总片数，初始时未知
+		DataPieces:   0,                    // 数据片段的数量，初始时未知
+		OwnerPriv:    ownerPriv,            // 所有者的私钥
+		Secret:       secret,               // 文件加密密钥
+		UserPubHash:  pubKeyHash,           // 用户的公钥哈希
+		Progress:     *util.NewBitSet(0),   // 下载任务的进度
+		CreatedAt:    time.Now().Unix(),    // 任务创建的时间戳
+		UpdatedAt:    time.Time{}.Unix(),   // 最后一次下载成功的时间戳
+		MergeCounter: 0,                    // 用于跟踪文件合并操作的计数器
+		Verify:       opt.GetVerifyLevel(), // 合并文件前的校验级别
 
 		TickerChecklist:   make(chan struct{}, TickerChannelBufferSize), // 初始化用于检查是否需要下载新的索引清单的通道，缓冲区大小为1，只保存最新的信息
 		TickerDownSnippet: make(chan struct{}, TickerChannelBufferSize), // 初始化用于检查是否需要下载新的文件片段的通道，缓冲区大小为1，只保存最新的信息
@@ -181,6 +206,11 @@ func (task *DownloadTask) ChannelEvents(
 	for {
 		select {
 		case <-task.ctx.Done():
+			// 任务被取消时释放临时空间，节点停止时保留以便重启后继续下载
+			if manager.ctx.Err() == nil && task.GetDownloadStatus() != StatusCompleted {
+				task.releaseTempSpace(opt, afe, p2p.Host().ID())
+				task.sinks.abort(context.Canceled)
+			}
 			return
 
 		case <-task.TickerChecklist:
@@ -197,7 +227,7 @@ func (task *DownloadTask) ChannelEvents(
 
 		case <-task.EventChecklist:
 			// 通知下载新的索引清单的通道
-			task.ChannelEventsEventChecklist(p2p, pubsub)
+			task.ChannelEventsEventChecklist(opt, p2p, pubsub)
 
 		case index := <-task.EventDownSnippet:
 			// 通知下载新的文件片段的通道
@@ -210,6 +240,12 @@ func (task *DownloadTask) ChannelEvents(
 		case <-task.DownloadTaskDone:
 			manager.SaveTasksToFileSingleChan() // 保存任务至文件的通知通道
 
+			// 文件已合并，删除保存纠删码片段的目录
+			task.temp.trackDir(segmentDir(p2p.Host().ID(), task.File.FileID))
+			if err := task.temp.release(afe, false); err != nil {
+				logrus.Warnf("[%s]删除下载任务 %s 的片段目录失败: %v", debug.WhereAmI(), task.TaskID, err)
+			}
+
 			// 通知文件下载任务完成
 			task.cancel()                      // 取消任务，确保所有子 Goroutine 退出
 			time.Sleep(100 * time.Millisecond) // 适当延时退出
@@ -218,6 +254,14 @@ func (task *DownloadTask) ChannelEvents(
 	}
 }
 
+// spawn 在新的协程中运行任务的一次性操作，panic 时只结束该协程而不影响节点
+// 参数：
+//   - name: string 协程名称
+//   - run: func() 一次性操作
+func (task *DownloadTask) spawn(name string, run func()) {
+	task.supervisor.Spawn("downloads", name, run)
+}
+
 // CheckForNewChecklist 定时任务，检查是否需要下载新的索引清单。
 func (task *DownloadTask) CheckForNewChecklist() {
 	// 创建一个60分钟超时的上下文
@@ -541,10 +585,14 @@ func (task *DownloadTask) DownloadTaskDoneSingleChan() {
 // SetDownloadStatus 设置下载任务的状态，并通知所有等待区块同步状态变化的goroutine。
 func (task *DownloadTask) SetDownloadStatus(status DownloadStatus) {
 	task.rwmu.Lock() // 使用写锁
-	defer task.rwmu.Unlock()
-
 	task.DownloadStatus = status
 	task.StatusCond.Broadcast()
+	onStatus := task.onStatus
+	task.rwmu.Unlock()
+
+	if onStatus != nil {
+		onStatus(status)
+	}
 }
 
 // GetDownloadStatus 获取当前下载任务的状态
@@ -744,9 +792,11 @@ func (task *DownloadTask) ChannelEventsTickerMergeFile() {
 
 // ChannelEventsEventChecklist 通道事件处理下载新的索引清单
 // 参数：
+//   - opt: *opts.Options 文件存储选项配置
 //   - p2p: *dep2p.DeP2P 表示 DeP2P 网络主机。
 //   - pubsub: *pubsub.DeP2PPubSub 表示 DeP2P 网络订阅系统。
 func (task *DownloadTask) ChannelEventsEventChecklist(
+	opt *opts.Options, // 文件存储选项配置
 	p2p *dep2p.DeP2P, // DeP2P网络主机
 	pubsub *pubsub.DeP2PPubSub, // DeP2P网络订阅
 ) {
@@ -770,14 +820,22 @@ func (task *DownloadTask) ChannelEventsEventChecklist(
 
 	// 描述请求文件片段清单的参数
 	segmentListRequest := SegmentListRequest{
-		TaskID:       task.TaskID,      // 任务唯一标识
-		FileID:       task.File.FileID, // 文件唯一标识
-		UserPubHash:  task.UserPubHash, // 用户的公钥哈希
-		SegmentNodes: segmentNodes,     // 文件片段所在节点
+		TaskID:       task.TaskID,              // 任务唯一标识
+		FileID:       task.File.FileID,         // 文件唯一标识
+		UserPubHash:  task.UserPubHash,         // 用户的公钥哈希
+		SegmentNodes: segmentNodes,             // 文件片段所在节点
+		Delegated:    len(task.Delegation) > 0, // 是否代所有者下载
 	}
 
-	// 向指定的全网节点发送文件下载请求订阅消息
-	if err := network.SendPubSub(p2p, pubsub, PubSubDownloadChecklistRequestTopic, "requestList", "", segmentListRequest); err != nil {
+	// 向全网节点发送文件下载请求订阅消息，分片时发送到文件所在的分片主题
+	shards := opt.GetAnnounceShards()
+	if shards <= 1 {
+		if err := network.SendPubSub(p2p, pubsub, PubSubDownloadChecklistRequestTopic, "requestList", "", segmentListRequest); err != nil {
+			logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		}
+		return
+	}
+	if err := network.PublishPubSub(p2p, pubsub, ChecklistTopic(task.File.FileID, shards), "requestList", "", segmentListRequest); err != nil {
 		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
 	}
 }
@@ -806,11 +864,26 @@ func (task *DownloadTask) ChannelEventsEventDownSnippet(
 		return
 	}
 
-	// 遍历节点信息
+	// 遍历节点信息，按估计的带宽从高到低尝试
 	nodes := segment.GetNodes()
 	// logrus.Warnf("[测试] %v", nodes)
+	// 已轮换身份的节点以新身份继续提供原有的文件片段
+	for nodeID, active := range segment.GetNodes() {
+		if next := opt.GetIdentities().Resolve(nodeID); next != nodeID {
+			if _, ok := nodes[next]; !ok {
+				segment.AddNode(next, active)
+				nodes[next] = active
+			}
+		}
+	}
+	candidates := make([]peer.ID, 0, len(nodes))
+	for nodeID := range nodes {
+		candidates = append(candidates, nodeID)
+	}
+	opt.GetBandwidth().Rank(candidates)
 
-	for nodeID, active := range nodes {
+	for _, nodeID := range candidates {
+		active := nodes[nodeID]
 		switch task.DownloadStatus {
 		case StatusCompleted, StatusFailed, StatusPaused:
 			return
@@ -841,6 +914,8 @@ func (task *DownloadTask) ChannelEventsEventDownSnippet(
 
 		// 向指定的节点发送下载请求
 		if !task.sendDownloadRequest(opt, afe, p2p, downloadChan, nodeID, downloadMaximumSize, index, segmentInfo) {
+			// 恢复为下载失败，继续尝试其他节点
+			task.File.SetSegmentStatus(index, SegmentStatusFailed)
 			continue
 		}
 
@@ -853,6 +928,11 @@ func (task *DownloadTask) ChannelEventsEventDownSnippet(
 		task.File.SetSegmentStatus(index, SegmentStatusFailed)
 	}
 
+	// 没有可用节点时同样视为下载失败
+	if !segment.IsStatus(SegmentStatusCompleted) && !segment.IsStatus(SegmentStatusDownloading) {
+		task.File.SetSegmentStatus(index, SegmentStatusFailed)
+	}
+
 	// 如果所有节点尝试后仍未成功下载，请求下载纠删码
 	requestErasureCodeDownload(task, index)
 }
@@ -865,24 +945,20 @@ func (task *DownloadTask) ChannelEventsEventMergeFile(opt *opts.Options, afe afe
 	// 子目录当前主机+文件hash
 	subDir := filepath.Join(paths.GetDownloadPath(), p2p.Host().ID().String(), task.File.FileID) // 设置子目录
 
-	// 检查目录是否存在
-	exists, err := afero.DirExists(afe, subDir)
-	if err != nil {
-		logrus.Errorf("[%s]检查目录是否存在时失败: %v", debug.WhereAmI(), err)
-		return
-	}
-
-	// 目录不存在
-	if !exists {
-		logrus.Errorf("[%s]目录不存在: %s", debug.WhereAmI(), subDir)
-		return
-	}
+	// 仅下载了数据片段时子目录可能不存在，数据片段已直接写入输出文件
 
 	// 从下载的切片中恢复文件数据
 	if task.recoverDataFromSlices(opt, afe, p2p, subDir) {
 		// 更新文件下载数据对象的状态
 		logrus.Printf("文件合并成功！！！！！")
 
+		// 保存各文件片段的来源记录
+		provenance := task.Provenance()
+		provenance.CompletedAt = time.Now().Unix()
+		if err := SaveProvenance(afe, provenance); err != nil {
+			logrus.Errorf("[%s]保存下载来源记录失败: %v", debug.WhereAmI(), err)
+		}
+
 		// 通知文件合并已完成
 		task.MergeFileDoneSingleChan()
 
@@ -919,6 +995,18 @@ func (task *DownloadTask) updateFileInfo(payload *FileDownloadResponseChecklistP
 	if task.File.ContentType == "" {
 		task.File.ContentType = payload.ContentType // MIME类型
 	}
+	if len(task.File.Checksum) == 0 {
+		task.File.Checksum = payload.Checksum // 文件的校验和
+	}
+	if task.File.Name == "" && len(payload.Metadata) > 0 {
+		// 解密文件元数据，仅所有者及被授权的身份可以解密
+		if meta, err := util.OpenMetadata(task.OwnerPriv, payload.Metadata); err != nil {
+			logrus.Warnf("[%s]解密文件元数据时失败: %v", debug.WhereAmI(), err)
+		} else {
+			task.File.Name = meta.Name               // 文件名
+			task.File.ContentType = meta.ContentType // MIME类型
+		}
+	}
 	if task.TotalPieces == 0 {
 		task.TotalPieces = len(payload.SliceTable) // 通过哈希表获取文件总片数
 		// 初始化 BitSet
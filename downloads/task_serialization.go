@@ -7,6 +7,8 @@ import (
 	"sync"
 
 	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/qos"
 	"github.com/bpfs/defs/util"
 	"github.com/bpfs/defs/wallets"
 	"github.com/sirupsen/logrus"
@@ -14,18 +16,25 @@ import (
 
 // DownloadTaskSerializable 是 DownloadTask 的可序列化版本
 type DownloadTaskSerializable struct {
-	TaskID       string         `json:"task_id"`       // 任务唯一标识
-	File         *DownloadFile  `json:"file"`          // 待下载的文件信息
-	TotalPieces  int            `json:"total_pieces"`  // 文件总片数（数据片段和纠删码片段的总数）
-	DataPieces   int            `json:"data_pieces"`   // 数据片段的数量
-	OwnerPriv    []byte         `json:"owner_priv"`    // 所有者的私钥
-	Secret       []byte         `json:"secret"`        // 文件加密密钥
-	UserPubHash  []byte         `json:"user_pub_hash"` // 用户的公钥哈希
-	Progress     util.BitSet    `json:"progress"`      // 下载任务的进度，表示为0到100之间的百分比
-	CreatedAt    int64          `json:"created_at"`    // 任务创建的时间戳
-	UpdatedAt    int64          `json:"updated_at"`    // 最后一次下载成功的时间戳
-	MergeCounter int            `json:"merge_counter"` // 用于跟踪文件合并操作的计数器
-	Status       DownloadStatus `json:"status"`        // 下载任务的状态
+	TaskID       string             `json:"task_id"`           // 任务唯一标识
+	File         *DownloadFile      `json:"file"`              // 待下载的文件信息
+	TotalPieces  int                `json:"total_pieces"`      // 文件总片数（数据片段和纠删码片段的总数）
+	DataPieces   int                `json:"data_pieces"`       // 数据片段的数量
+	OwnerPriv    []byte             `json:"owner_priv"`        // 所有者的私钥
+	Secret       []byte             `json:"secret"`            // 文件加密密钥
+	UserPubHash  []byte             `json:"user_pub_hash"`     // 用户的公钥哈希
+	Delegation   []byte             `json:"delegation"`        // 委托下载令牌
+	Progress     util.BitSet        `json:"progress"`          // 下载任务的进度，表示为0到100之间的百分比
+	CreatedAt    int64              `json:"created_at"`        // 任务创建的时间戳
+	UpdatedAt    int64              `json:"updated_at"`        // 最后一次下载成功的时间戳
+	MergeCounter int                `json:"merge_counter"`     // 用于跟踪文件合并操作的计数器
+	Status       DownloadStatus     `json:"status"`            // 下载任务的状态
+	QoS          qos.Class          `json:"qos"`               // 任务的服务等级
+	WaitUntil    int64              `json:"wait_until"`        // 等待网络的截止时间戳
+	DiskIO       *opts.DiskIOConfig `json:"disk_io,omitempty"` // 写入输出文件时的磁盘参数
+	Verify       opts.VerifyLevel   `json:"verify,omitempty"`  // 合并文件前的校验级别
+
+	Reconstructed []int `json:"reconstructed,omitempty"` // 由纠删码重建的数据片段索引，其余已完成片段均为下载所得
 }
 
 // ToSerializable 将 DownloadTask 转换为可序列化的结构体
@@ -46,11 +55,18 @@ func (task *DownloadTask) ToSerializable() (*DownloadTaskSerializable, error) {
 		OwnerPriv:    privKeyBytes,
 		Secret:       task.Secret,
 		UserPubHash:  task.UserPubHash,
+		Delegation:   task.Delegation,
 		Progress:     task.Progress,
 		CreatedAt:    task.CreatedAt,
 		UpdatedAt:    task.UpdatedAt,
 		MergeCounter: task.MergeCounter,
 		Status:       task.DownloadStatus,
+		QoS:          task.QoS,
+		WaitUntil:    task.WaitUntil,
+		DiskIO:       task.DiskIO,
+		Verify:       task.Verify,
+
+		Reconstructed: task.provenance.reconstructedIndexes(),
 	}, nil
 }
 
@@ -72,11 +88,17 @@ func (task *DownloadTask) FromSerializable(serializable *DownloadTaskSerializabl
 	task.OwnerPriv = privateKey
 	task.Secret = serializable.Secret
 	task.UserPubHash = serializable.UserPubHash
+	task.Delegation = serializable.Delegation
 	task.Progress = serializable.Progress
 	task.CreatedAt = serializable.CreatedAt
 	task.UpdatedAt = serializable.UpdatedAt
 	task.MergeCounter = serializable.MergeCounter
 	task.DownloadStatus = serializable.Status
+	task.QoS = serializable.QoS
+	task.WaitUntil = serializable.WaitUntil
+	task.DiskIO = serializable.DiskIO
+	task.Verify = serializable.Verify
+	task.provenance.reconstruct(serializable.Reconstructed)
 
 	// 重新初始化通道
 	task.TickerChecklist = make(chan struct{}, 20)
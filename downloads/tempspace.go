@@ -0,0 +1,175 @@
+package downloads
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/paths"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+)
+
+// 下载任务在本地占用两类临时空间：
+// 预分配的输出文件(下载目录中的 <文件唯一标识>.defs)，以及文件系统接口中保存纠删码片段的子目录。
+// 任务取消或失败时释放这些空间；进程崩溃遗留的空间在下次启动时回收。
+
+// tempSpace 记录下载任务分配的临时文件与目录
+type tempSpace struct {
+	mu    sync.Mutex
+	files map[string]struct{} // 本地文件路径，如预分配的输出文件
+	dirs  map[string]struct{} // 文件系统接口中的子目录，如保存纠删码片段的目录
+}
+
+// trackFile 记录分配的临时文件
+func (ts *tempSpace) trackFile(path string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.files == nil {
+		ts.files = make(map[string]struct{})
+	}
+	ts.files[path] = struct{}{}
+}
+
+// trackDir 记录分配的临时目录
+func (ts *tempSpace) trackDir(dir string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.dirs == nil {
+		ts.dirs = make(map[string]struct{})
+	}
+	ts.dirs[dir] = struct{}{}
+}
+
+// release 删除记录的临时目录，withFiles 为 true 时同时删除临时文件
+func (ts *tempSpace) release(afe afero.Afero, withFiles bool) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	var errList []error
+	for dir := range ts.dirs {
+		if err := afe.RemoveAll(dir); err != nil {
+			errList = append(errList, err)
+			continue
+		}
+		delete(ts.dirs, dir)
+	}
+	if !withFiles {
+		return errors.Join(errList...)
+	}
+	for path := range ts.files {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			errList = append(errList, err)
+			continue
+		}
+		delete(ts.files, path)
+	}
+	return errors.Join(errList...)
+}
+
+// segmentDir 获取保存纠删码片段的子目录
+func segmentDir(self peer.ID, fileID string) string {
+	return filepath.Join(paths.GetDownloadPath(), self.String(), fileID)
+}
+
+// releaseTempSpace 释放下载任务占用的全部临时空间
+// 除记录的分配外，还包括按任务推算的输出文件与片段目录，覆盖从文件恢复的任务
+// 参数：
+//   - opt: *opts.Options 文件存储选项配置
+//   - afe: afero.Afero 文件系统接口
+//   - self: peer.ID 本节点的ID
+func (task *DownloadTask) releaseTempSpace(opt *opts.Options, afe afero.Afero, self peer.ID) {
+	if task.File.FileID != "" {
+		assembly := task.assemblyPath(opt)
+		task.temp.trackFile(assembly)
+		task.temp.trackFile(assembly + decodedSuffix)
+		task.temp.trackDir(segmentDir(self, task.File.FileID))
+	}
+
+	task.assemblyMu.Lock()
+	defer task.assemblyMu.Unlock()
+	if err := task.temp.release(afe, true); err != nil {
+		logrus.Warnf("[%s]释放下载任务 %s 的临时空间失败: %v", debug.WhereAmI(), task.TaskID, err)
+	}
+}
+
+// isFileID 检查名称是否为文件唯一标识(SHA-256 的十六进制编码)
+func isFileID(name string) bool {
+	if len(name) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+// SweepTempSpace 回收不属于任何未完成下载任务的临时空间，用于清理崩溃遗留的文件
+// 演练模式下只统计将要回收的文件和目录，不删除任何数据
+// 参数：
+//   - opt: *opts.Options 文件存储选项配置
+//   - afe: afero.Afero 文件系统接口
+//   - self: peer.ID 本节点的ID
+//
+// 返回值：
+//   - int: 回收或演练模式下将要回收的文件和目录数量
+func (manager *DownloadManager) SweepTempSpace(opt *opts.Options, afe afero.Afero, self peer.ID) int {
+	manager.Mu.Lock()
+	active := make(map[string]bool, len(manager.Tasks))
+	for _, task := range manager.Tasks {
+		if task.GetDownloadStatus() != StatusCompleted {
+			active[task.File.FileID] = true
+		}
+	}
+	manager.Mu.Unlock()
+
+	dryRun := opt.GetDryRun()
+	reclaimed := 0
+
+	// 预分配的输出文件
+	if entries, err := os.ReadDir(opt.GetDownloadPath()); err == nil {
+		for _, entry := range entries {
+			name := entry.Name()
+			fileID := strings.TrimSuffix(strings.TrimSuffix(name, decodedSuffix), ".defs")
+			if entry.IsDir() || fileID == name || !isFileID(fileID) || active[fileID] {
+				continue
+			}
+			if dryRun {
+				logrus.Infof("[%s]演练模式: 将删除遗留的输出文件 %s", debug.WhereAmI(), name)
+				reclaimed++
+				continue
+			}
+			if err := os.Remove(filepath.Join(opt.GetDownloadPath(), name)); err != nil {
+				logrus.Warnf("[%s]删除遗留的输出文件 %s 失败: %v", debug.WhereAmI(), name, err)
+				continue
+			}
+			reclaimed++
+		}
+	}
+
+	// 保存纠删码片段的子目录
+	root := filepath.Join(paths.GetDownloadPath(), self.String())
+	if entries, err := afero.ReadDir(afe, root); err == nil {
+		for _, entry := range entries {
+			if !entry.IsDir() || active[entry.Name()] {
+				continue
+			}
+			if dryRun {
+				logrus.Infof("[%s]演练模式: 将删除遗留的片段目录 %s", debug.WhereAmI(), entry.Name())
+				reclaimed++
+				continue
+			}
+			if err := afe.RemoveAll(filepath.Join(root, entry.Name())); err != nil {
+				logrus.Warnf("[%s]删除遗留的片段目录 %s 失败: %v", debug.WhereAmI(), entry.Name(), err)
+				continue
+			}
+			reclaimed++
+		}
+	}
+
+	return reclaimed
+}
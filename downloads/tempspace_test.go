@@ -0,0 +1,51 @@
+package downloads
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/opts"
+	"github.com/libp2p/go-libp2p/core/test"
+)
+
+func TestTempSpace(t *testing.T) {
+	opt := opts.DefaultOptions()
+	opt.BuildDownloadPath(t.TempDir())
+	afe := afero.NewMemMapFs()
+	self := test.RandPeerIDFatal(t)
+
+	activeID, orphanID := strings.Repeat("a", 64), strings.Repeat("b", 64)
+	for _, name := range []string{activeID + ".defs", orphanID + ".defs", orphanID + ".defs" + decodedSuffix, "notes.defs"} {
+		if err := os.WriteFile(filepath.Join(opt.GetDownloadPath(), name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, fileID := range []string{activeID, orphanID} {
+		if err := afero.WriteFile(afe, filepath.Join(segmentDir(self, fileID), "seg"), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	task := &DownloadTask{TaskID: "task-1", File: &DownloadFile{FileID: activeID}, DownloadStatus: StatusDownloading}
+	manager := &DownloadManager{Tasks: map[string]*DownloadTask{task.TaskID: task}}
+	if n := manager.SweepTempSpace(opt, afe, self); n != 3 {
+		t.Fatalf("应回收遗留的两个输出文件和一个片段目录, 实际 %d", n)
+	}
+	if _, err := os.Stat(filepath.Join(opt.GetDownloadPath(), "notes.defs")); err != nil {
+		t.Fatal("不是文件唯一标识的文件不应被删除")
+	}
+	if ok, _ := afero.DirExists(afe, segmentDir(self, activeID)); !ok {
+		t.Fatal("未完成任务的片段目录不应被删除")
+	}
+
+	task.releaseTempSpace(opt, afe, self)
+	if _, err := os.Stat(task.assemblyPath(opt)); !os.IsNotExist(err) {
+		t.Fatal("取消任务后输出文件应被删除")
+	}
+	if ok, _ := afero.DirExists(afe, segmentDir(self, activeID)); ok {
+		t.Fatal("取消任务后片段目录应被删除")
+	}
+}
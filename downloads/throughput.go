@@ -0,0 +1,183 @@
+package downloads
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// throughputWindow 下载速度指数加权移动平均的时间常数
+// 越早的采样对速度的影响按 exp(-Δt/throughputWindow) 衰减
+const throughputWindow = 10 * time.Second
+
+// throughput 以指数加权移动平均平滑的下载速度
+// 零值可直接使用，第一个片段完成时开始计时
+type throughput struct {
+	mu     sync.Mutex
+	rate   float64   // 平滑后的速度，单位为字节/秒
+	last   time.Time // 最近一次采样的时间
+	total  int64     // 已下载的字节数
+	pieces int       // 已下载的片段数量
+}
+
+// add 记录完成下载的片段
+// 参数：
+//   - n: int 片段大小，单位为字节
+//   - now: time.Time 完成时间
+func (t *throughput) add(n int, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.total += int64(n)
+	t.pieces++
+	if t.last.IsZero() {
+		t.last = now
+		return
+	}
+
+	dt := now.Sub(t.last).Seconds()
+	if dt <= 0 {
+		// 同一时刻完成的片段计入下一次采样的间隔
+		t.rate += float64(n) / throughputWindow.Seconds()
+		return
+	}
+	alpha := 1 - math.Exp(-dt/throughputWindow.Seconds())
+	t.rate += alpha * (float64(n)/dt - t.rate)
+	t.last = now
+}
+
+// snapshot 获取当前的速度与已下载的数据量
+// 自最近一次采样以来没有新的片段完成时，速度随空闲时间衰减
+func (t *throughput) snapshot(now time.Time) (rate float64, total int64, pieces int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rate = t.rate
+	if idle := now.Sub(t.last).Seconds(); !t.last.IsZero() && idle > 0 {
+		rate *= math.Exp(-idle / throughputWindow.Seconds())
+	}
+	return rate, t.total, t.pieces
+}
+
+// estimate 根据剩余片段数量与平均片段大小估计剩余时间
+// 参数：
+//   - remaining: int 完成下载还需要的片段数量
+//   - now: time.Time 当前时间
+//
+// 返回值：
+//   - float64: 平滑后的速度，单位为字节/秒
+//   - time.Duration: 预计剩余时间，无法估计时为 -1
+func (t *throughput) estimate(remaining int, now time.Time) (float64, time.Duration) {
+	rate, total, pieces := t.snapshot(now)
+	if remaining <= 0 {
+		return rate, 0
+	}
+	if rate <= 0 || pieces == 0 {
+		return rate, -1
+	}
+	bytes := float64(total) / float64(pieces) * float64(remaining)
+	return rate, time.Duration(bytes / rate * float64(time.Second))
+}
+
+// DownloadSummary 下载任务的摘要
+type DownloadSummary struct {
+	TaskID          string         // 任务唯一标识
+	FileID          string         // 文件唯一标识
+	Name            string         // 文件名
+	Size            int64          // 文件大小，单位为字节
+	Status          DownloadStatus // 下载任务的状态
+	QueuePosition   int            // 在等待名额队列中的位置，从1开始；未在排队时为 0
+	TotalPieces     int            // 文件总片数
+	DataPieces      int            // 数据片段的数量
+	CompletedPieces int            // 已完成下载的片段数量
+	DownloadedBytes int64          // 本次运行以来已下载的字节数
+	Throughput      float64        // 平滑后的下载速度，单位为字节/秒
+	ETA             time.Duration  // 预计剩余时间，无法估计时为 -1
+	CreatedAt       int64          // 任务创建的时间戳
+	UpdatedAt       int64          // 最后一次下载成功的时间戳
+}
+
+// remainingPieces 完成下载还需要的片段数量
+// 任意数据片段数量的片段即可恢复文件，因此只需再下载数据片段数量减去已完成数量的片段
+func (task *DownloadTask) remainingPieces() int {
+	if task.Progress.All() && task.TotalPieces > 0 {
+		return 0
+	}
+	remaining := task.DataPieces - task.File.DownloadCompleteCount()
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// Summary 获取下载任务的摘要，包括平滑后的下载速度与预计剩余时间
+// 返回值：
+//   - *DownloadSummary: 下载任务的摘要
+func (task *DownloadTask) Summary() *DownloadSummary {
+	now := time.Now()
+	rate, eta := task.throughput.estimate(task.remainingPieces(), now)
+	_, total, _ := task.throughput.snapshot(now)
+
+	task.rwmu.RLock()
+	updatedAt := task.UpdatedAt
+	task.rwmu.RUnlock()
+
+	return &DownloadSummary{
+		TaskID:          task.TaskID,
+		FileID:          task.File.FileID,
+		Name:            task.File.Name,
+		Size:            task.File.Size,
+		Status:          task.GetDownloadStatus(),
+		TotalPieces:     task.TotalPieces,
+		DataPieces:      task.DataPieces,
+		CompletedPieces: task.File.DownloadCompleteCount(),
+		DownloadedBytes: total,
+		Throughput:      rate,
+		ETA:             eta,
+		CreatedAt:       task.CreatedAt,
+		UpdatedAt:       updatedAt,
+	}
+}
+
+// ListDownloadsContext 列出所有下载任务的摘要，ctx 已结束时返回其错误
+// 参数：
+//   - ctx: context.Context 调用的上下文
+//
+// 返回值：
+//   - []*DownloadSummary: 按创建时间排列的下载任务摘要
+//   - error: ctx 已结束时返回其错误
+func (manager *DownloadManager) ListDownloadsContext(ctx context.Context) ([]*DownloadSummary, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return manager.ListDownloads(), nil
+}
+
+// ListDownloads 列出所有下载任务的摘要，等待名额的任务附带在队列中的位置
+// 返回值：
+//   - []*DownloadSummary: 按创建时间排列的下载任务摘要
+func (manager *DownloadManager) ListDownloads() []*DownloadSummary {
+	manager.Mu.Lock()
+	tasks := make([]*DownloadTask, 0, len(manager.Tasks))
+	for _, task := range manager.Tasks {
+		tasks = append(tasks, task)
+	}
+	manager.Mu.Unlock()
+
+	positions := manager.queuePositions()
+	summaries := make([]*DownloadSummary, 0, len(tasks))
+	for _, task := range tasks {
+		summary := task.Summary()
+		summary.QueuePosition = positions[task.TaskID]
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].CreatedAt != summaries[j].CreatedAt {
+			return summaries[i].CreatedAt < summaries[j].CreatedAt
+		}
+		return summaries[i].TaskID < summaries[j].TaskID
+	})
+	return summaries
+}
@@ -0,0 +1,42 @@
+package downloads
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestThroughputEstimate(t *testing.T) {
+	var tp throughput
+	start := time.Unix(1700000000, 0)
+
+	if _, eta := tp.estimate(5, start); eta != -1 {
+		t.Fatalf("没有采样时无法估计剩余时间, 实际 %v", eta)
+	}
+
+	// 每秒完成一个 1MB 的片段，平滑后的速度收敛到 1MB/s
+	now := start
+	for i := 0; i < 100; i++ {
+		tp.add(1<<20, now)
+		now = now.Add(time.Second)
+	}
+	now = now.Add(-time.Second)
+
+	rate, eta := tp.estimate(10, now)
+	if math.Abs(rate-(1<<20))/(1<<20) > 0.01 {
+		t.Fatalf("速度应接近 1MB/s, 实际 %.0f", rate)
+	}
+	if eta < 9*time.Second || eta > 11*time.Second {
+		t.Fatalf("剩余 10 个片段应约需 10 秒, 实际 %v", eta)
+	}
+
+	// 长时间没有新的片段时速度衰减，剩余时间变长
+	stalled, stalledETA := tp.estimate(10, now.Add(30*time.Second))
+	if stalled >= rate/10 || stalledETA <= eta {
+		t.Fatalf("停滞后速度应衰减: %.0f, %v", stalled, stalledETA)
+	}
+
+	if _, eta := tp.estimate(0, now); eta != 0 {
+		t.Fatalf("没有剩余片段时剩余时间应为 0, 实际 %v", eta)
+	}
+}
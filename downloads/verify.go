@@ -0,0 +1,76 @@
+package downloads
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/util"
+)
+
+// verifyLevel 获取任务的校验级别，任务未记录时使用全局默认值
+func (task *DownloadTask) verifyLevel(opt *opts.Options) opts.VerifyLevel {
+	task.rwmu.RLock()
+	level := task.Verify
+	task.rwmu.RUnlock()
+	if level == "" {
+		level = opt.GetVerifyLevel()
+	}
+	return level
+}
+
+// verifyFileChecksum 校验还原后的文件与上传时的文件校验和是否一致
+// 存储节点未提供文件校验和时(旧版本)跳过校验
+// 参数：
+//   - path: string 还原后的文件路径
+//
+// 返回值：
+//   - error: 校验和不一致时返回包装了 errs.ErrSegmentCorrupt 的错误
+func (task *DownloadTask) verifyFileChecksum(path string) error {
+	if len(task.File.Checksum) == 0 {
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return err
+	}
+	if !util.CompareHashes(hasher.Sum(nil), task.File.Checksum) {
+		return fmt.Errorf("%w: 文件 %s 的校验和不一致", errs.ErrSegmentCorrupt, task.File.FileID)
+	}
+	return nil
+}
+
+// SetDownloadVerifyLevel 设置下载任务的校验级别，在合并文件前生效
+// 参数：
+//   - taskID: string 任务唯一标识
+//   - level: opts.VerifyLevel 校验级别
+//
+// 返回值：
+//   - error: 如果发生错误，返回错误信息
+func (manager *DownloadManager) SetDownloadVerifyLevel(taskID string, level opts.VerifyLevel) error {
+	level, err := opts.ParseVerifyLevel(string(level))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errs.ErrInvalidArgument, err)
+	}
+	manager.Mu.Lock()
+	task, ok := manager.Tasks[taskID]
+	manager.Mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: 下载任务 %s", errs.ErrTaskNotFound, taskID)
+	}
+	task.rwmu.Lock()
+	task.Verify = level
+	task.rwmu.Unlock()
+
+	go manager.SaveTasksToFileSingleChan() // 保存任务至文件的通知通道
+	return nil
+}
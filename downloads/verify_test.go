@@ -0,0 +1,93 @@
+package downloads
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/reedsolomon"
+)
+
+func TestRecoverShardsVerifyLevel(t *testing.T) {
+	task := &DownloadTask{DataPieces: 3, TotalPieces: 5}
+	enc, err := reedsolomon.New(3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func() [][]byte {
+		shards, err := enc.Split(bytes.Repeat([]byte("defs verify level "), 10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := enc.Encode(shards); err != nil {
+			t.Fatal(err)
+		}
+		return shards
+	}
+
+	// 缺失数据片段时各级别都能重建
+	for _, level := range []opts.VerifyLevel{opts.VerifyNone, opts.VerifyFast, opts.VerifyFull} {
+		shards := encode()
+		want := append([]byte(nil), shards[1]...)
+		shards[1] = nil
+		if !task.recoverShards(shards, level) || !bytes.Equal(shards[1], want) {
+			t.Fatalf("%s 级别未能重建缺失的数据片段", level)
+		}
+	}
+
+	// 只有完整校验检查校验片段的一致性
+	corrupt := func() [][]byte {
+		shards := encode()
+		shards[4][0] ^= 0xff
+		return shards
+	}
+	if !task.recoverShards(corrupt(), opts.VerifyFast) {
+		t.Fatal("快速校验不应检查校验片段")
+	}
+	if task.recoverShards(corrupt(), opts.VerifyFull) {
+		t.Fatal("完整校验应发现不一致的校验片段")
+	}
+}
+
+func TestVerifyFileChecksum(t *testing.T) {
+	content := []byte("restored file content")
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(content)
+
+	task := &DownloadTask{File: &DownloadFile{FileID: "file-1"}}
+	if err := task.verifyFileChecksum(path); err != nil {
+		t.Fatalf("未提供校验和时应跳过校验: %v", err)
+	}
+	task.File.Checksum = sum[:]
+	if err := task.verifyFileChecksum(path); err != nil {
+		t.Fatalf("校验和一致时不应报错: %v", err)
+	}
+	task.File.Checksum = append([]byte{sum[0] ^ 0xff}, sum[1:]...)
+	if err := task.verifyFileChecksum(path); !errors.Is(err, errs.ErrSegmentCorrupt) {
+		t.Fatalf("校验和不一致时应报错: %v", err)
+	}
+
+	// 任务未记录校验级别时使用全局默认值
+	opt := opts.DefaultOptions()
+	if err := opt.BuildVerifyLevel("strict"); err == nil {
+		t.Fatal("无效的校验级别应被拒绝")
+	}
+	if err := opt.BuildVerifyLevel(opts.VerifyFast); err != nil {
+		t.Fatal(err)
+	}
+	if level := task.verifyLevel(opt); level != opts.VerifyFast {
+		t.Fatalf("应使用全局默认的校验级别，实际 %s", level)
+	}
+	task.Verify = opts.VerifyNone
+	if level := task.verifyLevel(opt); level != opts.VerifyNone {
+		t.Fatalf("应使用任务记录的校验级别，实际 %s", level)
+	}
+}
@@ -0,0 +1,531 @@
+// Package edgecache 将热门的文件片段主动复制到自愿充当缓存的节点
+// 存储节点按请求热度发现热门片段，复制到通告了缓存意愿的节点；缓存节点把片段放在存储目录中直接响应下载请求，
+// 长时间没有请求或超出空间上限时清理。热点文件的下载请求因此分散到更多节点，减轻原始存储节点的负载。
+package edgecache
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/network"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/defs/provider"
+	"github.com/bpfs/defs/scrub"
+	"github.com/bpfs/defs/stats"
+	"github.com/bpfs/defs/supervise"
+	"github.com/bpfs/defs/util"
+	"github.com/bpfs/dep2p"
+	"github.com/bpfs/dep2p/pubsub"
+	"github.com/bpfs/dep2p/streams"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+)
+
+const version = "1.0.0"
+
+var (
+	// 缓存节点通告缓存意愿
+	PubSubEdgeCacheAnnounceTopic = fmt.Sprintf("defs@pubsub/edgecache/announce/%s", version)
+
+	// 复制热门片段到缓存节点
+	StreamEdgeCachePushProtocol = fmt.Sprintf("defs@stream/edgecache/push/%s", version)
+)
+
+const (
+	// announceStale 缓存意愿的有效期(检查间隔的倍数)，超过后不再向该节点复制
+	announceStale = 3
+	// maxHotPerRound 每轮最多复制的热门片段数量
+	maxHotPerRound = 32
+	// usedScore 缓存片段的热度不低于该值时视为仍在被请求
+	usedScore = 1
+)
+
+// Announce 缓存节点通告的缓存意愿
+type Announce struct {
+	Free int64 // 剩余的缓存空间，单位为字节
+}
+
+// PushReq 复制热门片段的请求消息
+type PushReq struct {
+	FileID    string // 文件唯一标识
+	SegmentID string // 文件片段的唯一标识
+	SliceByte []byte // 文件片段的内容
+}
+
+// Report 边缘缓存的累计结果
+type Report struct {
+	Pushed      int64 // 作为存储节点复制到缓存节点的片段数量
+	Cached      int64 // 作为缓存节点接收的片段数量
+	Evicted     int64 // 作为缓存节点清理的片段数量
+	CachedBytes int64 // 当前缓存片段占用的字节数
+	Volunteers  int   // 当前有效的缓存节点数量
+}
+
+// volunteer 通告了缓存意愿的节点
+type volunteer struct {
+	free int64     // 剩余的缓存空间
+	seen time.Time // 最近一次通告的时间
+}
+
+// Service 边缘缓存服务，同时承担存储节点的复制与缓存节点的接收、清理
+type Service struct {
+	ctx    context.Context    // 上下文用于管理协程的生命周期
+	cancel context.CancelFunc // 取消函数
+	mu     sync.Mutex         // 用于保护状态的互斥锁
+
+	opt    *opts.Options       // 文件存储选项配置
+	afe    afero.Afero         // 文件系统接口
+	p2p    *dep2p.DeP2P        // 网络主机
+	pubsub *pubsub.DeP2PPubSub // 网络订阅
+
+	index      *Index                                     // 本节点缓存的片段
+	volunteers map[peer.ID]*volunteer                     // 通告了缓存意愿的节点
+	pushed     map[stats.SegmentKey]map[peer.ID]time.Time // 已复制的片段及其缓存节点
+	report     Report                                     // 累计结果
+	providers  *provider.Notifier                         // 文件片段变更通告
+}
+
+type NewServiceInput struct {
+	fx.In
+	LC         fx.Lifecycle
+	Ctx        context.Context       // 全局上下文
+	Opt        *opts.Options         // 文件存储选项配置
+	Afe        afero.Afero           // 文件系统接口
+	P2P        *dep2p.DeP2P          // 网络主机
+	PubSub     *pubsub.DeP2PPubSub   // 网络订阅
+	Providers  *provider.Notifier    // 文件片段变更通告
+	Supervisor *supervise.Supervisor // 后台任务的崩溃恢复
+}
+
+type NewServiceOutput struct {
+	fx.Out
+	EdgeCache *Service // 边缘缓存
+}
+
+// NewService 创建边缘缓存服务，未设置边缘缓存策略时只清理此前缓存的片段
+// 参数：
+//   - input: NewServiceInput 用于初始化 Service 的输入结构体。
+//
+// 返回值：
+//   - NewServiceOutput: 包含 Service 的输出结构体。
+func NewService(input NewServiceInput) (out NewServiceOutput) {
+	ctx, cancel := context.WithCancel(input.Ctx)
+	s := &Service{
+		ctx:        ctx,
+		cancel:     cancel,
+		opt:        input.Opt,
+		afe:        input.Afe,
+		p2p:        input.P2P,
+		pubsub:     input.PubSub,
+		index:      NewIndex(),
+		volunteers: make(map[peer.ID]*volunteer),
+		pushed:     make(map[stats.SegmentKey]map[peer.ID]time.Time),
+		providers:  input.Providers,
+	}
+	out.EdgeCache = s
+
+	input.LC.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			// 缓存索引在未启用缓存时也要加载，以便清理此前缓存的片段
+			if err := s.index.Open(filepath.Join(paths.GetRootPath(), paths.GetFilesPath(), "edgecache")); err != nil {
+				logrus.Errorf("[%s]加载缓存索引失败: %v", debug.WhereAmI(), err)
+			}
+
+			policy := s.opt.GetEdgeCachePolicy()
+			if policy == nil {
+				input.Supervisor.Go("edgecache", "sweep", func() { s.Sweep(time.Now()) })
+				return nil
+			}
+
+			// 注册复制热门片段
+			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamEdgeCachePushProtocol), network.HandlerWithLimits(StreamEdgeCachePushProtocol, network.HandlerWithRW(s.handlePush)))
+
+			// 订阅缓存意愿
+			if err := input.PubSub.SubscribeWithTopic(PubSubEdgeCacheAnnounceTopic, network.PubSubHandler(PubSubEdgeCacheAnnounceTopic, s.handleAnnouncePubSub), true); err != nil {
+				logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+			}
+
+			input.Supervisor.Go("edgecache", "run", func() { s.run(policy.Interval) })
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			s.cancel()
+			return nil
+		},
+	})
+
+	return out
+}
+
+// Report 获取边缘缓存的累计结果
+func (s *Service) Report() Report {
+	s.mu.Lock()
+	report := s.report
+	report.Volunteers = len(s.activeVolunteers(time.Now()))
+	s.mu.Unlock()
+	report.CachedBytes = s.index.Size()
+	return report
+}
+
+// Cached 获取本节点缓存的片段，最久未被请求的在前
+func (s *Service) Cached() []*Entry {
+	return s.index.List()
+}
+
+// run 定时通告缓存意愿、复制热门片段并清理过期的缓存
+func (s *Service) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case now := <-ticker.C:
+			policy := s.opt.GetEdgeCachePolicy()
+			if policy == nil {
+				continue
+			}
+			s.Sweep(now)
+			if policy.Serve && !s.opt.GetReadOnly() {
+				s.announce(policy)
+			}
+			if policy.Replicate {
+				s.ReplicateHot(now)
+			}
+		}
+	}
+}
+
+// announce 广播本节点的缓存意愿
+func (s *Service) announce(policy *opts.EdgeCachePolicy) {
+	free := policy.Capacity - s.index.Size()
+	if free <= 0 {
+		return
+	}
+	if err := network.SendSignedPubSub(s.p2p, s.pubsub, PubSubEdgeCacheAnnounceTopic, "announce", "", &Announce{Free: free}); err != nil {
+		logrus.Debugf("[%s]通告缓存意愿失败: %v", debug.WhereAmI(), err)
+	}
+}
+
+// handleAnnouncePubSub 处理缓存节点通告的缓存意愿
+func (s *Service) handleAnnouncePubSub(res *streams.RequestMessage) {
+	if res.Message.Type != "announce" || res.Message.Sender == s.p2p.Host().ID().String() {
+		return
+	}
+	// 通告由缓存节点签名，只记录签名节点的缓存意愿，避免替其他节点通告
+	a := new(Announce)
+	sender, err := network.VerifyPubSub(res, PubSubEdgeCacheAnnounceTopic, a)
+	if err != nil {
+		logrus.Warnf("[%s]拒绝缓存意愿通告: %v", debug.WhereAmI(), err)
+		return
+	}
+
+	s.mu.Lock()
+	if a.Free > 0 {
+		s.volunteers[sender] = &volunteer{free: a.Free, seen: time.Now()}
+	} else {
+		delete(s.volunteers, sender)
+	}
+	s.mu.Unlock()
+}
+
+// activeVolunteers 获取缓存意愿仍有效的节点，调用方需持有锁
+func (s *Service) activeVolunteers(now time.Time) map[peer.ID]*volunteer {
+	active := make(map[peer.ID]*volunteer, len(s.volunteers))
+	policy := s.opt.GetEdgeCachePolicy()
+	if policy == nil {
+		return active
+	}
+	for p, v := range s.volunteers {
+		if now.Sub(v.seen) > announceStale*policy.Interval {
+			delete(s.volunteers, p)
+			continue
+		}
+		active[p] = v
+	}
+	return active
+}
+
+// ReplicateHot 将热度超过阈值的片段复制到尚未缓存该片段的缓存节点
+// 参数：
+//   - now: time.Time 当前时间
+//
+// 返回值：
+//   - int: 本轮复制的次数
+func (s *Service) ReplicateHot(now time.Time) int {
+	policy := s.opt.GetEdgeCachePolicy()
+	if policy == nil || !policy.Replicate {
+		return 0
+	}
+
+	// 清理过期的复制记录
+	s.mu.Lock()
+	for seg, holders := range s.pushed {
+		for p, at := range holders {
+			if now.Sub(at) > policy.TTL {
+				delete(holders, p)
+			}
+		}
+		if len(holders) == 0 {
+			delete(s.pushed, seg)
+		}
+	}
+	s.mu.Unlock()
+
+	pushed := 0
+	for _, hot := range s.opt.GetPopularity().Hot(policy.Threshold, maxHotPerRound) {
+		if s.ctx.Err() != nil {
+			break
+		}
+		// 缓存的片段不再向外复制，避免缓存之间相互扩散
+		if s.index.Has(hot.FileID, hot.SegmentID) {
+			continue
+		}
+		pushed += s.replicate(policy, hot.SegmentKey, now)
+	}
+	return pushed
+}
+
+// replicate 将一个热门片段复制到缓存节点，直到达到缓存节点数量上限
+// 返回值：
+//   - int: 复制成功的次数
+func (s *Service) replicate(policy *opts.EdgeCachePolicy, seg stats.SegmentKey, now time.Time) int {
+	// 缓存节点在没有请求时会清理片段，复制记录在 ReplicateHot 中过期后允许重新复制
+	s.mu.Lock()
+	holders := s.pushed[seg]
+	need := policy.Replicas - len(holders)
+	if need <= 0 {
+		s.mu.Unlock()
+		return 0
+	}
+	var candidates []peer.ID
+	for p := range s.activeVolunteers(now) {
+		if _, ok := holders[p]; !ok {
+			candidates = append(candidates, p)
+		}
+	}
+	s.mu.Unlock()
+	if len(candidates) == 0 {
+		return 0
+	}
+
+	subDir := filepath.Join(paths.GetSlicePath(), s.p2p.Host().ID().String(), seg.FileID)
+	data, err := util.Read(s.opt, s.afe, subDir, seg.SegmentID)
+	if err != nil || len(data) == 0 {
+		// 片段已不在本节点
+		return 0
+	}
+
+	// 随机选择缓存节点，使热点分散
+	rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+
+	done := 0
+	for _, p := range candidates {
+		if done >= need {
+			break
+		}
+		s.mu.Lock()
+		v, ok := s.volunteers[p]
+		fits := ok && v.free >= int64(len(data))
+		s.mu.Unlock()
+		if !fits {
+			continue
+		}
+
+		if err := s.push(p, seg, data); err != nil {
+			logrus.Debugf("[%s]复制热门片段 %s 到节点 %s 失败: %v", debug.WhereAmI(), seg.SegmentID, p, err)
+			continue
+		}
+		done++
+
+		s.mu.Lock()
+		if s.pushed[seg] == nil {
+			s.pushed[seg] = make(map[peer.ID]time.Time)
+		}
+		s.pushed[seg][p] = now
+		if v, ok := s.volunteers[p]; ok {
+			v.free -= int64(len(data))
+		}
+		s.report.Pushed++
+		s.mu.Unlock()
+		s.opt.GetCounters().AddServed(int64(len(data)))
+	}
+	if done > 0 {
+		logrus.Infof("[%s]热门片段 %s 已复制到 %d 个缓存节点", debug.WhereAmI(), seg.SegmentID, done)
+	}
+	return done
+}
+
+// push 向缓存节点发送片段
+func (s *Service) push(receiver peer.ID, seg stats.SegmentKey, data []byte) error {
+	res, err := network.SendStreamContext(s.ctx, s.p2p, StreamEdgeCachePushProtocol, "", receiver, &PushReq{
+		FileID:    seg.FileID,
+		SegmentID: seg.SegmentID,
+		SliceByte: data,
+	})
+	if err != nil {
+		return err
+	}
+	if res == nil || res.Code != 200 {
+		if res != nil {
+			return fmt.Errorf("缓存节点拒绝: %s", res.Msg)
+		}
+		return fmt.Errorf("缓存节点没有响应")
+	}
+	return nil
+}
+
+// handlePush 处理存储节点复制的热门片段
+// 通过 network.HandlerWithRW 注册，请求的 Sender 为流连接上经过认证的对方节点，可作为片段来源记录
+func (s *Service) handlePush(req *streams.RequestMessage, res *streams.ResponseMessage) (int32, string) {
+	policy := s.opt.GetEdgeCachePolicy()
+	if policy == nil || !policy.Serve || s.opt.GetReadOnly() {
+		return 6610, "未启用缓存"
+	}
+
+	payload := new(PushReq)
+	if err := util.DecodeFromBytes(req.Payload, payload); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return 6603, "解码错误"
+	}
+	if payload.FileID == "" || filepath.Base(payload.FileID) != payload.FileID {
+		return 6603, "文件标识无效"
+	}
+	size := int64(len(payload.SliceByte))
+	if size > policy.Capacity {
+		return 6611, "片段超出缓存空间"
+	}
+
+	// 只缓存经上传者签名的片段，伪造的片段不会被用来响应下载请求
+	if _, err := scrub.VerifySegment(payload.FileID, payload.SegmentID, payload.SliceByte); err != nil {
+		logrus.Warnf("[%s]拒绝缓存节点 %s 复制的片段: %v", debug.WhereAmI(), req.Message.Sender, err)
+		return 6612, "片段校验失败"
+	}
+
+	subDir := filepath.Join(paths.GetSlicePath(), s.p2p.Host().ID().String(), payload.FileID)
+	if exists, _ := afero.Exists(s.afe, filepath.Join(subDir, payload.SegmentID)); exists {
+		// 已作为存储节点或缓存节点保存该片段
+		return 200, "已存储"
+	}
+
+	// 超出空间上限时清理最久未被请求的缓存
+	s.evict(policy.Capacity - size)
+
+	if err := util.Write(s.opt, s.afe, subDir, payload.SegmentID, payload.SliceByte); err != nil {
+		logrus.Errorf("[%s]缓存片段失败: %v", debug.WhereAmI(), err)
+		return 500, "缓存片段失败"
+	}
+	s.opt.GetCounters().AddStored(size)
+	s.providers.Added(payload.FileID, payload.SegmentID)
+
+	now := time.Now().Unix()
+	if err := s.index.Add(&Entry{
+		FileID:    payload.FileID,
+		SegmentID: payload.SegmentID,
+		Size:      size,
+		Source:    req.Message.Sender,
+		CachedAt:  now,
+		LastUsed:  now,
+	}); err != nil {
+		// 条目已记录在内存中，下次保存索引时一并写入
+		logrus.Errorf("[%s]保存缓存索引失败: %v", debug.WhereAmI(), err)
+	}
+	s.mu.Lock()
+	s.report.Cached++
+	s.mu.Unlock()
+
+	logrus.Infof("[%s]已缓存节点 %s 复制的热门片段 %s", debug.WhereAmI(), req.Message.Sender, payload.SegmentID)
+	return 200, "成功"
+}
+
+// Sweep 清理长时间没有请求的缓存片段，仍被请求的片段延长保留
+// 参数：
+//   - now: time.Time 当前时间
+//
+// 返回值：
+//   - int: 清理的片段数量
+func (s *Service) Sweep(now time.Time) int {
+	policy := s.opt.GetEdgeCachePolicy()
+	ttl := time.Duration(0)
+	if policy != nil && policy.Serve {
+		ttl = policy.TTL
+	}
+
+	removed, touched := 0, false
+	for _, e := range s.index.List() {
+		if s.opt.GetPopularity().Score(e.FileID, e.SegmentID) >= usedScore {
+			s.index.Touch(e.FileID, e.SegmentID, now)
+			touched = true
+			continue
+		}
+		// 不再充当缓存节点时清理全部缓存
+		if ttl == 0 || now.Sub(time.Unix(e.LastUsed, 0)) > ttl {
+			if s.remove(e) {
+				removed++
+			}
+		}
+	}
+	if touched && removed == 0 {
+		if err := s.index.save(); err != nil {
+			logrus.Errorf("[%s]保存缓存索引失败: %v", debug.WhereAmI(), err)
+		}
+	}
+	return removed
+}
+
+// evict 按最久未被请求的顺序清理缓存片段，直到占用的空间不超过上限
+// 参数：
+//   - limit: int64 空间上限
+func (s *Service) evict(limit int64) {
+	used := s.index.Size()
+	for _, e := range s.index.List() {
+		if used <= limit {
+			return
+		}
+		if s.remove(e) {
+			used -= e.Size
+		}
+	}
+}
+
+// remove 删除缓存的片段，文件被固定或演练模式下只移出索引
+func (s *Service) remove(e *Entry) bool {
+	path := filepath.Join(paths.GetSlicePath(), s.p2p.Host().ID().String(), e.FileID, e.SegmentID)
+	switch {
+	case s.opt.GetPins().IsPinned(e.FileID):
+		// 被固定的文件转为长期保存
+		logrus.Infof("[%s]文件已被固定，保留缓存的片段 %s", debug.WhereAmI(), path)
+	case s.opt.GetDryRun():
+		logrus.Infof("[%s]演练模式，保留缓存的片段 %s", debug.WhereAmI(), path)
+		return false
+	default:
+		if err := s.afe.Remove(path); err != nil {
+			if exists, _ := afero.Exists(s.afe, path); exists {
+				logrus.Errorf("[%s]删除缓存的片段 %s 失败: %v", debug.WhereAmI(), path, err)
+				return false
+			}
+			// 片段已被其他清理流程删除，只移出索引
+		} else {
+			s.opt.GetCounters().AddStored(-e.Size)
+			s.providers.Removed(e.FileID, e.SegmentID)
+		}
+	}
+
+	if _, err := s.index.Remove(e.FileID, e.SegmentID); err != nil {
+		logrus.Errorf("[%s]保存缓存索引失败: %v", debug.WhereAmI(), err)
+	}
+	s.mu.Lock()
+	s.report.Evicted++
+	s.mu.Unlock()
+	return true
+}
@@ -0,0 +1,195 @@
+package edgecache
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/util"
+	"github.com/sirupsen/logrus"
+)
+
+// Entry 缓存节点上一个缓存的文件片段
+// 缓存的片段与存储节点保存的片段放在同一目录下，以便直接响应下载请求；
+// 只有记录在索引中的片段才会被当作缓存清理，本节点作为存储节点保存的片段不受影响
+type Entry struct {
+	FileID    string `json:"file_id"`    // 文件唯一标识
+	SegmentID string `json:"segment_id"` // 文件片段的唯一标识
+	Size      int64  `json:"size"`       // 片段的字节数
+	Source    string `json:"source"`     // 复制该片段的存储节点
+	CachedAt  int64  `json:"cached_at"`  // 缓存的时间(Unix 秒)
+	LastUsed  int64  `json:"last_used"`  // 最近一次被请求的时间(Unix 秒)
+}
+
+// key 缓存条目的键
+func key(fileID, segmentID string) string {
+	return fileID + "/" + segmentID
+}
+
+// Index 缓存节点上缓存的文件片段集合
+// 零值不可用，通过 NewIndex 创建；所有方法在 nil 接收者上均为空操作
+type Index struct {
+	mu      sync.RWMutex
+	entries map[string]*Entry // 文件与片段标识到缓存条目的映射
+	path    string            // 持久化文件路径，为空时不持久化
+}
+
+// NewIndex 创建一个空的缓存索引
+func NewIndex() *Index {
+	return &Index{entries: make(map[string]*Entry)}
+}
+
+// Open 设置持久化文件路径并加载已保存的缓存条目
+// 参数：
+//   - path: string 持久化文件路径
+//
+// 返回值：
+//   - error: 文件存在但解析失败时返回错误
+func (x *Index) Open(path string) error {
+	if x == nil {
+		return nil
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.path = path
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var entries []*Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		x.entries[key(e.FileID, e.SegmentID)] = e
+	}
+	return nil
+}
+
+// Add 记录一个缓存的文件片段
+// 参数：
+//   - e: *Entry 缓存条目
+//
+// 返回值：
+//   - error: 保存失败时返回错误
+func (x *Index) Add(e *Entry) error {
+	if x == nil {
+		return nil
+	}
+	x.mu.Lock()
+	c := *e
+	x.entries[key(e.FileID, e.SegmentID)] = &c
+	x.mu.Unlock()
+	return x.save()
+}
+
+// Has 检查文件片段是否为缓存的片段
+func (x *Index) Has(fileID, segmentID string) bool {
+	if x == nil {
+		return false
+	}
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	_, ok := x.entries[key(fileID, segmentID)]
+	return ok
+}
+
+// Remove 删除缓存条目
+// 返回值：
+//   - bool: 条目是否存在
+//   - error: 保存失败时返回错误
+func (x *Index) Remove(fileID, segmentID string) (bool, error) {
+	if x == nil {
+		return false, nil
+	}
+	x.mu.Lock()
+	k := key(fileID, segmentID)
+	_, ok := x.entries[k]
+	delete(x.entries, k)
+	x.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	return true, x.save()
+}
+
+// Touch 更新缓存条目最近一次被请求的时间
+// 参数：
+//   - fileID: string 文件唯一标识
+//   - segmentID: string 文件片段的唯一标识
+//   - at: time.Time 被请求的时间
+func (x *Index) Touch(fileID, segmentID string, at time.Time) {
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if e, ok := x.entries[key(fileID, segmentID)]; ok && at.Unix() > e.LastUsed {
+		e.LastUsed = at.Unix()
+	}
+}
+
+// Size 获取缓存片段占用的总字节数
+func (x *Index) Size() int64 {
+	if x == nil {
+		return 0
+	}
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	var total int64
+	for _, e := range x.entries {
+		total += e.Size
+	}
+	return total
+}
+
+// List 获取所有缓存条目，最久未被请求的在前
+func (x *Index) List() []*Entry {
+	if x == nil {
+		return nil
+	}
+	x.mu.RLock()
+	entries := make([]*Entry, 0, len(x.entries))
+	for _, e := range x.entries {
+		c := *e
+		entries = append(entries, &c)
+	}
+	x.mu.RUnlock()
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].LastUsed != entries[j].LastUsed {
+			return entries[i].LastUsed < entries[j].LastUsed
+		}
+		return key(entries[i].FileID, entries[i].SegmentID) < key(entries[j].FileID, entries[j].SegmentID)
+	})
+	return entries
+}
+
+// save 将缓存条目保存到持久化文件
+// 返回值：
+//   - error: 写入失败时返回错误
+func (x *Index) save() error {
+	entries := x.List()
+	x.mu.RLock()
+	path := x.path
+	x.mu.RUnlock()
+	if path == "" {
+		return nil
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		logrus.Errorf("[%s]序列化缓存索引失败: %v", debug.WhereAmI(), err)
+		return err
+	}
+
+	return util.WriteFileAtomic(afero.NewOsFs(), path, data, 0644)
+}
@@ -0,0 +1,61 @@
+package edgecache
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "edgecache")
+	x := NewIndex()
+	if err := x.Open(path); err != nil {
+		t.Fatal(err)
+	}
+
+	x.Add(&Entry{FileID: "file-1", SegmentID: "a", Size: 100, LastUsed: 30})
+	x.Add(&Entry{FileID: "file-1", SegmentID: "b", Size: 200, LastUsed: 10})
+	x.Add(&Entry{FileID: "file-2", SegmentID: "a", Size: 300, LastUsed: 20})
+
+	if !x.Has("file-1", "a") || x.Has("file-2", "b") {
+		t.Fatal("Has 的结果不符")
+	}
+	if size := x.Size(); size != 600 {
+		t.Fatalf("Size() = %d", size)
+	}
+
+	// 最久未被请求的在前
+	list := x.List()
+	if len(list) != 3 || list[0].SegmentID != "b" || list[1].FileID != "file-2" || list[2].SegmentID != "a" {
+		t.Fatalf("List() 的顺序不符: %v", list)
+	}
+
+	// 只前移最近一次被请求的时间
+	x.Touch("file-1", "b", time.Unix(40, 0))
+	x.Touch("file-2", "a", time.Unix(5, 0))
+	if list := x.List(); list[0].FileID != "file-2" || list[2].SegmentID != "b" {
+		t.Fatalf("Touch 后 List() 的顺序不符: %v", list)
+	}
+
+	if ok, err := x.Remove("file-1", "a"); !ok || err != nil {
+		t.Fatalf("Remove 的结果不符: %v, %v", ok, err)
+	}
+	if ok, _ := x.Remove("file-1", "a"); ok {
+		t.Fatal("Remove 的结果不符")
+	}
+
+	// 重新加载持久化的条目
+	reloaded := NewIndex()
+	if err := reloaded.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Size() != 500 || reloaded.Has("file-1", "a") || !reloaded.Has("file-1", "b") {
+		t.Fatalf("重新加载后的条目不符: %v", reloaded.List())
+	}
+
+	var nilIndex *Index
+	nilIndex.Add(&Entry{FileID: "file-1", SegmentID: "a"})
+	if nilIndex.Has("file-1", "a") || nilIndex.Size() != 0 {
+		t.Fatal("nil 索引应为空操作")
+	}
+}
@@ -0,0 +1,35 @@
+package defs
+
+import (
+	"time"
+
+	"github.com/bpfs/defs/edgecache"
+	"github.com/bpfs/defs/stats"
+)
+
+// HotSegments 获取本节点存储的热门文件片段，按请求热度从高到低排列
+// 参数：
+//   - limit: int 返回的最大数量，不大于 0 时不限制
+//
+// 返回值：
+//   - []stats.SegmentHeat: 有请求记录的文件片段及其热度
+func (fs *FS) HotSegments(limit int) []stats.SegmentHeat {
+	return fs.opt.GetPopularity().Hot(0, limit)
+}
+
+// ReplicateHotSegments 立即将热度超过阈值的片段复制到缓存节点，而不必等待下一次检查
+// 返回值：
+//   - int: 本轮复制的次数
+func (fs *FS) ReplicateHotSegments() int {
+	return fs.edgeCache.ReplicateHot(time.Now())
+}
+
+// EdgeCached 获取本节点作为缓存节点缓存的文件片段
+func (fs *FS) EdgeCached() []*edgecache.Entry {
+	return fs.edgeCache.Cached()
+}
+
+// EdgeCacheReport 获取边缘缓存的累计结果
+func (fs *FS) EdgeCacheReport() edgecache.Report {
+	return fs.edgeCache.Report()
+}
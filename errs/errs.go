@@ -0,0 +1,115 @@
+// Package errs 定义了文件存储各模块共用的错误类型。
+// 各模块返回的错误通过 %w 包装这些错误，调用方可以使用 errors.Is 与 errors.As 判断错误类别，
+// 而不必解析错误信息。
+package errs
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+var (
+	// ErrInvalidArgument 参数无效，如文件路径或文件唯一标识为空
+	ErrInvalidArgument = errors.New("参数无效")
+
+	// ErrTaskNotFound 上传或下载任务不存在
+	ErrTaskNotFound = errors.New("任务不存在")
+
+	// ErrTaskExists 相同文件的任务已存在
+	ErrTaskExists = errors.New("任务已存在")
+
+	// ErrConcurrencyLimit 已达到允许的最大并发数
+	ErrConcurrencyLimit = errors.New("已达到允许的最大并发数")
+
+	// ErrQuotaExceeded 超过大小或容量的限制
+	ErrQuotaExceeded = errors.New("超过大小或容量的限制")
+
+	// ErrInsufficientPeers 可用的节点不足
+	ErrInsufficientPeers = errors.New("可用的节点不足")
+
+	// ErrPeerUnreachable 无法与节点建立连接或通信中断
+	ErrPeerUnreachable = errors.New("节点不可达")
+
+	// ErrPeerRejected 节点响应了错误码
+	ErrPeerRejected = errors.New("节点拒绝了请求")
+
+	// ErrSegmentCorrupt 文件片段的内容、校验和或签名无效
+	ErrSegmentCorrupt = errors.New("文件片段已损坏")
+
+	// ErrNotFound 请求的记录不存在
+	ErrNotFound = errors.New("记录不存在")
+
+	// ErrUnauthorized 没有执行操作的权限
+	ErrUnauthorized = errors.New("未被授权")
+
+	// ErrReadOnly 节点处于只读模式，拒绝写入操作
+	ErrReadOnly = errors.New("节点处于只读模式")
+)
+
+// PeerError 与指定节点通信时发生的错误
+type PeerError struct {
+	Peer peer.ID // 目标节点
+	Op   string  // 执行的操作或协议
+	Code int32   // 节点响应的错误码，未收到响应时为 0
+	Err  error   // 底层错误，通常为 ErrPeerUnreachable 或 ErrPeerRejected
+}
+
+// Error 实现 error 接口
+func (e *PeerError) Error() string {
+	if e.Code != 0 {
+		return fmt.Sprintf("节点 %s 执行 %s 时响应错误码 %d: %v", e.Peer, e.Op, e.Code, e.Err)
+	}
+	return fmt.Sprintf("节点 %s 执行 %s 时失败: %v", e.Peer, e.Op, e.Err)
+}
+
+// Unwrap 返回底层错误
+func (e *PeerError) Unwrap() error {
+	return e.Err
+}
+
+// Unreachable 创建无法与节点通信的错误
+// 参数：
+//   - p: peer.ID 目标节点
+//   - op: string 执行的操作或协议
+//   - err: error 通信时的原始错误，可为 nil
+//
+// 返回值：
+//   - *PeerError: 同时匹配 ErrPeerUnreachable 与原始错误的节点错误
+func Unreachable(p peer.ID, op string, err error) *PeerError {
+	if err == nil {
+		return &PeerError{Peer: p, Op: op, Err: ErrPeerUnreachable}
+	}
+	return &PeerError{Peer: p, Op: op, Err: fmt.Errorf("%w: %w", ErrPeerUnreachable, err)}
+}
+
+// Rejected 创建节点响应错误码的错误
+// 参数：
+//   - p: peer.ID 目标节点
+//   - op: string 执行的操作或协议
+//   - code: int32 节点响应的错误码
+//   - msg: string 节点响应的错误信息
+//
+// 返回值：
+//   - *PeerError: 匹配 ErrPeerRejected 的节点错误
+func Rejected(p peer.ID, op string, code int32, msg string) *PeerError {
+	return &PeerError{Peer: p, Op: op, Code: code, Err: fmt.Errorf("%w: %s", ErrPeerRejected, msg)}
+}
+
+// SegmentError 处理指定文件片段时发生的错误
+type SegmentError struct {
+	FileID string // 文件唯一标识
+	Index  int    // 文件片段索引
+	Err    error  // 底层错误，通常为 ErrSegmentCorrupt
+}
+
+// Error 实现 error 接口
+func (e *SegmentError) Error() string {
+	return fmt.Sprintf("文件 %s 的片段 %d: %v", e.FileID, e.Index, e.Err)
+}
+
+// Unwrap 返回底层错误
+func (e *SegmentError) Unwrap() error {
+	return e.Err
+}
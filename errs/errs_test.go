@@ -0,0 +1,30 @@
+package errs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestPeerError(t *testing.T) {
+	err := fmt.Errorf("上传失败: %w", Unreachable("peer", "send", context.DeadlineExceeded))
+	if !errors.Is(err, ErrPeerUnreachable) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("errors.Is failed for %v", err)
+	}
+
+	var peerErr *PeerError
+	if !errors.As(err, &peerErr) || peerErr.Peer != "peer" || peerErr.Op != "send" {
+		t.Fatalf("errors.As = %+v", peerErr)
+	}
+
+	rejected := Rejected("peer", "publish", 6606, "验证失败")
+	if !errors.Is(rejected, ErrPeerRejected) || errors.Is(rejected, ErrPeerUnreachable) || rejected.Code != 6606 {
+		t.Fatalf("rejected = %v", rejected)
+	}
+
+	segErr := error(&SegmentError{FileID: "file", Index: 3, Err: ErrSegmentCorrupt})
+	if !errors.Is(segErr, ErrSegmentCorrupt) {
+		t.Fatalf("errors.Is failed for %v", segErr)
+	}
+}
@@ -0,0 +1,374 @@
+package expiry
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/network"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/defs/provider"
+	"github.com/bpfs/defs/supervise"
+	"github.com/bpfs/defs/util"
+	"github.com/bpfs/dep2p"
+	"github.com/bpfs/dep2p/pubsub"
+	"github.com/bpfs/dep2p/streams"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+)
+
+// ScheduleCheckInterval 所有者节点检查待广播的到期通知的间隔
+const ScheduleCheckInterval = time.Minute
+
+// Report 清理到期文件片段的累计结果
+type Report struct {
+	Removed      int64 // 已清理的片段数量
+	RemovedBytes int64 // 已清理的字节数
+	Retained     int64 // 已到期但因文件被固定、只读或演练模式而保留的片段数量
+	Published    int64 // 作为所有者广播的到期通知数量
+}
+
+// Collector 清理到期的文件片段，并在所有者节点上按时广播到期通知
+type Collector struct {
+	ctx    context.Context    // 上下文用于管理协程的生命周期
+	cancel context.CancelFunc // 取消函数
+	mu     sync.Mutex         // 用于保护状态的互斥锁
+	passMu sync.Mutex         // 同一时间只进行一轮清理
+
+	opt       *opts.Options       // 文件存储选项配置
+	afe       afero.Afero         // 文件系统接口
+	self      peer.ID             // 本节点的ID
+	publish   func(*Notice) error // 广播到期通知
+	providers *provider.Notifier  // 文件片段变更通告
+	report    Report              // 累计结果
+}
+
+type NewCollectorInput struct {
+	fx.In
+	LC         fx.Lifecycle
+	Ctx        context.Context       // 全局上下文
+	Opt        *opts.Options         // 文件存储选项配置
+	Afe        afero.Afero           // 文件系统接口
+	P2P        *dep2p.DeP2P          // 网络主机
+	PubSub     *pubsub.DeP2PPubSub   // 网络订阅
+	Providers  *provider.Notifier    // 文件片段变更通告
+	Supervisor *supervise.Supervisor // 后台任务的崩溃恢复
+}
+
+type NewCollectorOutput struct {
+	fx.Out
+	Collector *Collector // 到期清理
+}
+
+// NewCollector 创建并初始化一个新的 Collector 实例
+// 参数：
+//   - input: NewCollectorInput 用于初始化 Collector 的输入结构体。
+//
+// 返回值：
+//   - NewCollectorOutput: 包含 Collector 的输出结构体。
+func NewCollector(input NewCollectorInput) (out NewCollectorOutput) {
+	c := newCollector(input.Ctx, input.Opt, input.Afe, input.P2P.Host().ID())
+	c.publish = func(n *Notice) error {
+		return network.SendPubSub(input.P2P, input.PubSub, PubSubExpiryTopic, "expiry", "", n)
+	}
+	c.providers = input.Providers
+	out.Collector = c
+
+	input.LC.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			// 订阅到期通知
+			if err := input.PubSub.SubscribeWithTopic(PubSubExpiryTopic, network.PubSubHandler(PubSubExpiryTopic, c.handleNoticePubSub), true); err != nil {
+				logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+			}
+
+			input.Supervisor.Go("expiry", "run", func() { c.run(c.opt.GetExpirySweepInterval()) })
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			c.cancel()
+			return nil
+		},
+	})
+
+	return out
+}
+
+// newCollector 创建到期清理服务
+func newCollector(ctx context.Context, opt *opts.Options, afe afero.Afero, self peer.ID) *Collector {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Collector{ctx: ctx, cancel: cancel, opt: opt, afe: afe, self: self}
+}
+
+// Report 获取清理到期文件片段的累计结果
+func (c *Collector) Report() Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.report
+}
+
+// run 定时广播到期通知并清理到期的文件片段，清理间隔为 0 时只广播到期通知
+func (c *Collector) run(sweepInterval time.Duration) {
+	ticker := time.NewTicker(ScheduleCheckInterval)
+	defer ticker.Stop()
+	lastSweep := time.Now()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case now := <-ticker.C:
+			c.PublishDue(now)
+			if sweepInterval > 0 && now.Sub(lastSweep) >= sweepInterval {
+				lastSweep = now
+				if _, err := c.Sweep(c.ctx, now); err != nil && c.ctx.Err() == nil {
+					logrus.Warnf("[%s]清理到期的文件片段失败: %v", debug.WhereAmI(), err)
+				}
+			}
+		}
+	}
+}
+
+// Sweep 清理本节点存储的所有到期文件片段
+// 参数：
+//   - ctx: context.Context 上下文，可用于中止本轮清理
+//   - now: time.Time 当前时间
+//
+// 返回值：
+//   - int: 本轮清理的片段数量
+//   - error: 本轮清理被中止时返回错误
+func (c *Collector) Sweep(ctx context.Context, now time.Time) (int, error) {
+	c.passMu.Lock()
+	defer c.passMu.Unlock()
+
+	// 删除本节点签发的已到期的存储承诺收据
+	if !c.opt.GetReadOnly() && !c.opt.GetDryRun() {
+		if _, err := c.opt.GetCommitments().Prune(now); err != nil {
+			logrus.Warnf("[%s]删除到期的存储承诺收据失败: %v", debug.WhereAmI(), err)
+		}
+	}
+
+	root := filepath.Join(paths.GetSlicePath(), c.self.String())
+	entries, err := afero.ReadDir(c.afe, root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return removed, err
+		}
+		if entry.IsDir() {
+			removed += c.sweepFile(entry.Name(), now)
+		}
+	}
+	return removed, nil
+}
+
+// sweepFile 清理一个文件的到期片段
+// 返回值：
+//   - int: 清理的片段数量
+func (c *Collector) sweepFile(fileID string, now time.Time) int {
+	dir := filepath.Join(paths.GetSlicePath(), c.self.String(), fileID)
+	entries, err := afero.ReadDir(c.afe, dir)
+	if err != nil {
+		return 0
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		// 只信任片段中经过签名的到期时间
+		notice, err := c.readNotice(fileID, path, entry.Size())
+		if err != nil || notice == nil || !notice.Expired(now) {
+			continue
+		}
+		if c.remove(fileID, path, entry.Size()) {
+			removed++
+		}
+	}
+
+	// 文件的片段全部清理后删除空目录
+	if removed > 0 {
+		if rest, err := afero.ReadDir(c.afe, dir); err == nil && len(rest) == 0 {
+			c.afe.Remove(dir)
+		}
+	}
+	return removed
+}
+
+// readNotice 读取文件片段中的到期声明，只读取 xref 表与所需字段，不把整个片段读入内存
+func (c *Collector) readNotice(fileID, path string, size int64) (*Notice, error) {
+	file, err := c.afe.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadNoticeAt(fileID, file, size)
+}
+
+// remove 删除到期的文件片段，文件被固定、本节点的存储承诺未到期、节点只读或演练模式下保留
+func (c *Collector) remove(fileID, path string, size int64) bool {
+	retain := ""
+	switch {
+	case c.opt.GetPins().IsPinned(fileID):
+		retain = "文件已被固定"
+	case c.opt.GetCommitments().Committed(fileID, filepath.Base(path), time.Now()):
+		retain = "存储承诺未到期"
+	case c.opt.GetReadOnly():
+		retain = "只读节点"
+	case c.opt.GetDryRun():
+		retain = "演练模式"
+	}
+	if retain != "" {
+		logrus.Infof("[%s]%s，保留到期的文件片段 %s", debug.WhereAmI(), retain, path)
+		c.mu.Lock()
+		c.report.Retained++
+		c.mu.Unlock()
+		return false
+	}
+
+	if err := c.afe.Remove(path); err != nil {
+		logrus.Errorf("[%s]删除到期的文件片段 %s 失败: %v", debug.WhereAmI(), path, err)
+		return false
+	}
+	c.opt.GetCounters().AddStored(-size)
+	c.providers.Removed(fileID, filepath.Base(path))
+	logrus.Infof("[%s]已删除到期的文件片段 %s", debug.WhereAmI(), path)
+
+	c.mu.Lock()
+	c.report.Removed++
+	c.report.RemovedBytes += size
+	c.mu.Unlock()
+	return true
+}
+
+// PublishDue 广播已到期文件的到期通知，广播后移除到期计划
+// 参数：
+//   - now: time.Time 当前时间
+//
+// 返回值：
+//   - int: 广播的通知数量
+func (c *Collector) PublishDue(now time.Time) int {
+	notices, err := Scheduled(c.afe)
+	if err != nil {
+		logrus.Errorf("[%s]读取到期计划失败: %v", debug.WhereAmI(), err)
+		return 0
+	}
+
+	published := 0
+	for _, n := range notices {
+		if !n.Expired(now) {
+			continue
+		}
+		if c.publish != nil {
+			if err := c.publish(n); err != nil {
+				logrus.Errorf("[%s]广播文件 %s 的到期通知失败: %v", debug.WhereAmI(), n.FileID, err)
+				continue // 下次检查时重试
+			}
+		}
+		logrus.Infof("[%s]文件 %s 已到期，广播到期通知", debug.WhereAmI(), n.FileID)
+		if err := Unschedule(c.afe, n.FileID); err != nil {
+			logrus.Errorf("[%s]移除文件 %s 的到期计划失败: %v", debug.WhereAmI(), n.FileID, err)
+		}
+		// 本节点也可能存储了该文件的片段
+		c.sweepFile(n.FileID, now)
+		published++
+	}
+
+	c.mu.Lock()
+	c.report.Published += int64(published)
+	c.mu.Unlock()
+	return published
+}
+
+// handleNoticePubSub 处理所有者广播的到期通知
+// 通知只用于提前触发清理，是否删除仍以片段中经过签名的到期时间为准
+func (c *Collector) handleNoticePubSub(res *streams.RequestMessage) {
+	if res.Message.Type != "expiry" {
+		return
+	}
+	n := new(Notice)
+	if err := util.DecodeFromBytes(res.Payload, n); err != nil {
+		logrus.Errorf("[%s]解码错误: %v", debug.WhereAmI(), err)
+		return
+	}
+	now := time.Now()
+	if n.FileID == "" || !n.Expired(now) || filepath.Base(n.FileID) != n.FileID {
+		return
+	}
+	c.sweepFile(n.FileID, now)
+}
+
+// scheduleDir 获取到期计划的保存目录
+func scheduleDir() string {
+	return filepath.Join(paths.GetManifestPath(), "expiry")
+}
+
+// Schedule 记录所有者签发的到期声明，到期时由 Collector 广播
+// 参数：
+//   - afe: afero.Afero 文件系统接口
+//   - n: *Notice 到期声明
+//
+// 返回值：
+//   - error: 保存失败时返回错误
+func Schedule(afe afero.Afero, n *Notice) error {
+	data, err := util.EncodeToBytes(n)
+	if err != nil {
+		return err
+	}
+	if err := afe.MkdirAll(scheduleDir(), 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(scheduleDir(), n.FileID+".exp")
+	return util.WriteFileAtomic(afe, path, data, 0644)
+}
+
+// Unschedule 移除文件的到期计划
+func Unschedule(afe afero.Afero, fileID string) error {
+	err := afe.Remove(filepath.Join(scheduleDir(), fileID+".exp"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Scheduled 列出所有尚未广播的到期声明
+func Scheduled(afe afero.Afero) ([]*Notice, error) {
+	entries, err := afero.ReadDir(afe, scheduleDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var notices []*Notice
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".exp" {
+			continue
+		}
+		data, err := afero.ReadFile(afe, filepath.Join(scheduleDir(), entry.Name()))
+		if err != nil {
+			continue
+		}
+		n := new(Notice)
+		if err := util.DecodeFromBytes(data, n); err != nil {
+			continue
+		}
+		notices = append(notices, n)
+	}
+	return notices, nil
+}
@@ -0,0 +1,161 @@
+// Package expiry 文件到期后在全网自动清理
+// 上传时设置的到期时间由文件签名密钥签名后写入每个文件片段，存储节点据此独立清理到期的片段，
+// 即使所有者已经离线也能保证清理；所有者节点在到期时广播到期通知，存储节点收到后立即清理，而不必等待下一轮定期清理。
+package expiry
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/script"
+	"github.com/bpfs/defs/segment"
+	sign "github.com/bpfs/defs/sign/ecdsa"
+	"github.com/bpfs/defs/util"
+)
+
+const version = "1.0.0"
+
+var (
+	// 所有者节点在文件到期时广播的到期通知
+	PubSubExpiryTopic = fmt.Sprintf("defs@pubsub/expiry/%s", version)
+)
+
+// 文件片段中记录到期时间的字段
+const (
+	FieldExpiresAt       = "EXPIRESAT"       // 到期时间(Unix 秒)
+	FieldExpirySignature = "EXPIRYSIGNATURE" // 文件签名密钥对文件唯一标识与到期时间的签名
+)
+
+// Notice 文件的到期声明
+type Notice struct {
+	FileID    string // 文件唯一标识
+	ExpiresAt int64  // 到期时间(Unix 秒)
+	Signature []byte // 文件签名密钥的签名
+}
+
+// signingData 返回参与签名的数据
+func signingData(fileID string, expiresAt []byte) ([]byte, error) {
+	return util.MergeFieldsForSigning([]byte(fileID), expiresAt)
+}
+
+// Sign 使用文件签名密钥签发到期声明
+// 参数：
+//   - priv: *ecdsa.PrivateKey 文件签名密钥，与写入文件片段 P2PKSCRIPT 的公钥对应
+//   - fileID: string 文件唯一标识
+//   - expiresAt: time.Time 到期时间
+//
+// 返回值：
+//   - *Notice: 到期声明
+//   - error: 签名失败时返回错误
+func Sign(priv *ecdsa.PrivateKey, fileID string, expiresAt time.Time) (*Notice, error) {
+	if priv == nil || fileID == "" {
+		return nil, fmt.Errorf("%w: 签发到期声明的参数不完整", errs.ErrInvalidArgument)
+	}
+	n := &Notice{FileID: fileID, ExpiresAt: expiresAt.Unix()}
+	at, err := util.ToBytes[int64](n.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	data, err := signingData(fileID, at)
+	if err != nil {
+		return nil, err
+	}
+	if n.Signature, err = sign.SignData(priv, data); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// Fields 返回写入文件片段的到期字段
+func (n *Notice) Fields() (map[string][]byte, error) {
+	at, err := util.ToBytes[int64](n.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{
+		FieldExpiresAt:       at,
+		FieldExpirySignature: n.Signature,
+	}, nil
+}
+
+// Verify 使用文件签名公钥验证到期声明
+func (n *Notice) Verify(pub *ecdsa.PublicKey) error {
+	at, err := util.ToBytes[int64](n.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	data, err := signingData(n.FileID, at)
+	if err != nil {
+		return err
+	}
+	if valid, err := sign.VerifySignature(pub, data, n.Signature); err != nil || !valid {
+		return fmt.Errorf("%w: 文件 %s 的到期声明签名无效", errs.ErrUnauthorized, n.FileID)
+	}
+	return nil
+}
+
+// Expired 判断是否已经到期
+func (n *Notice) Expired(now time.Time) bool {
+	return n.ExpiresAt > 0 && now.Unix() >= n.ExpiresAt
+}
+
+// ReadNotice 读取并验证文件片段中的到期声明
+// 参数：
+//   - fileID: string 片段所属文件的唯一标识
+//   - data: []byte 文件片段的内容
+//
+// 返回值：
+//   - *Notice: 到期声明，片段未设置到期时间时为 nil
+//   - error: 片段无法解析、标识不匹配或签名无效时返回错误
+func ReadNotice(fileID string, data []byte) (*Notice, error) {
+	return ReadNoticeAt(fileID, bytes.NewReader(data), int64(len(data)))
+}
+
+// ReadNoticeAt 读取并验证文件片段中的到期声明，只读取 xref 表与到期声明所需的字段
+// 参数：
+//   - fileID: string 片段所属文件的唯一标识
+//   - reader: io.ReaderAt 文件片段
+//   - size: int64 文件片段的大小
+//
+// 返回值：
+//   - *Notice: 到期声明，片段未设置到期时间时为 nil
+//   - error: 片段无法解析、标识不匹配或签名无效时返回错误
+func ReadNoticeAt(fileID string, reader io.ReaderAt, size int64) (*Notice, error) {
+	xref, err := segment.LoadXrefFromReaderAt(reader, size)
+	if err != nil {
+		return nil, err
+	}
+	results, err := segment.ReadFieldsFromReaderAt(reader, size, []string{"FILEID", "P2PKSCRIPT", FieldExpiresAt, FieldExpirySignature}, xref)
+	if err != nil {
+		return nil, err
+	}
+	if results[FieldExpiresAt] == nil || results[FieldExpiresAt].Error != nil {
+		return nil, nil // 未设置到期时间
+	}
+	for field, result := range results {
+		if result.Error != nil {
+			return nil, fmt.Errorf("字段 %s 无效: %v", field, result.Error)
+		}
+	}
+	if string(results["FILEID"].Data) != fileID {
+		return nil, fmt.Errorf("%w: 文件片段的标识与存储位置不匹配", errs.ErrSegmentCorrupt)
+	}
+
+	expiresAt, err := util.FromBytes[int64](results[FieldExpiresAt].Data)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := script.ExtractPubKeyFromP2PKScriptToECDSA(results["P2PKSCRIPT"].Data)
+	if err != nil {
+		return nil, err
+	}
+	n := &Notice{FileID: fileID, ExpiresAt: expiresAt, Signature: results[FieldExpirySignature].Data}
+	if err := n.Verify(pub); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
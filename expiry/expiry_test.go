@@ -0,0 +1,275 @@
+package expiry
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/commitment"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/defs/script"
+	"github.com/bpfs/defs/segment"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// newSegment 生成一个带有到期字段的文件片段，notice 为 nil 时不设置到期时间
+func newSegment(t *testing.T, priv *ecdsa.PrivateKey, fileID, segmentID string, notice *Notice) []byte {
+	t.Helper()
+	return newSegmentWithContent(t, priv, fileID, segmentID, []byte("encrypted content of the segment"), notice)
+}
+
+// newSegmentWithContent 生成一个指定内容的文件片段
+func newSegmentWithContent(t *testing.T, priv *ecdsa.PrivateKey, fileID, segmentID string, content []byte, notice *Notice) []byte {
+	t.Helper()
+
+	ecdhKey, err := priv.PublicKey.ECDH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2pk, err := script.NewScriptBuilder().AddData(ecdhKey.Bytes()).AddOp(script.OP_CHECKSIG).Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := map[string][]byte{
+		"FILEID":     []byte(fileID),
+		"SEGMENTID":  []byte(segmentID),
+		"CONTENT":    content,
+		"P2PKSCRIPT": p2pk,
+	}
+	if notice != nil {
+		fields, err := notice.Fields()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range fields {
+			data[k] = v
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), segmentID)
+	if err := segment.WriteFileSegment(path, data); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestReadNotice(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiresAt := time.Now().Add(time.Hour)
+
+	notice, err := Sign(priv, "file-1", expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadNotice("file-1", newSegment(t, priv, "file-1", "segment-1", notice))
+	if err != nil {
+		t.Fatalf("读取到期声明失败: %v", err)
+	}
+	if got.ExpiresAt != expiresAt.Unix() || got.Expired(time.Now()) || !got.Expired(expiresAt) {
+		t.Fatalf("到期时间不符: %+v", got)
+	}
+
+	// 未设置到期时间
+	if got, err := ReadNotice("file-1", newSegment(t, priv, "file-1", "segment-2", nil)); err != nil || got != nil {
+		t.Fatalf("未设置到期时间的片段应返回 nil: %v, %v", got, err)
+	}
+
+	// 由其他密钥签名的到期声明
+	forged, err := Sign(other, "file-1", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadNotice("file-1", newSegment(t, priv, "file-1", "segment-3", forged)); !errors.Is(err, errs.ErrUnauthorized) {
+		t.Fatalf("伪造的到期声明应被拒绝: %v", err)
+	}
+
+	// 片段的标识与存储位置不匹配
+	if _, err := ReadNotice("file-2", newSegment(t, priv, "file-1", "segment-4", notice)); !errors.Is(err, errs.ErrSegmentCorrupt) {
+		t.Fatalf("标识不匹配的片段应被拒绝: %v", err)
+	}
+}
+
+// countingReaderAt 统计读取的字节数
+type countingReaderAt struct {
+	r    *bytes.Reader
+	read int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.read += int64(n)
+	return n, err
+}
+
+func TestReadNoticeAtSkipsContent(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notice, err := Sign(priv, "file-1", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := newSegmentWithContent(t, priv, "file-1", "segment-1", make([]byte, 1<<20), notice)
+
+	reader := &countingReaderAt{r: bytes.NewReader(data)}
+	got, err := ReadNoticeAt("file-1", reader, int64(len(data)))
+	if err != nil || got == nil || !got.Expired(time.Now()) {
+		t.Fatalf("读取到期声明失败: %+v, %v", got, err)
+	}
+	if reader.read > 64<<10 {
+		t.Fatalf("读取到期声明不应读取片段内容，读取了 %d 字节", reader.read)
+	}
+}
+
+func TestCollectorSweep(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	afe := afero.NewMemMapFs()
+	opt := opts.DefaultOptions()
+	c := newCollector(context.Background(), opt, afe, peer.ID("storage-node"))
+
+	expired, err := Sign(priv, "file-expired", now.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	live, err := Sign(priv, "file-live", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(fileID, segmentID string, notice *Notice) string {
+		dir := filepath.Join(paths.GetSlicePath(), c.self.String(), fileID)
+		if err := afe.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, segmentID)
+		if err := afero.WriteFile(afe, path, newSegment(t, priv, fileID, segmentID, notice), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	expiredPath := write("file-expired", "segment-1", expired)
+	livePath := write("file-live", "segment-1", live)
+	foreverPath := write("file-forever", "segment-1", nil)
+
+	removed, err := c.Sweep(context.Background(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Fatalf("应清理 1 个片段，实际 %d", removed)
+	}
+	if ok, _ := afero.Exists(afe, expiredPath); ok {
+		t.Fatal("到期的片段未被清理")
+	}
+	if ok, _ := afero.Exists(afe, filepath.Dir(expiredPath)); ok {
+		t.Fatal("清空后的文件目录未被删除")
+	}
+	for _, path := range []string{livePath, foreverPath} {
+		if ok, _ := afero.Exists(afe, path); !ok {
+			t.Fatalf("未到期的片段 %s 被误删", path)
+		}
+	}
+
+	// 被固定的文件到期后仍保留
+	pinnedPath := write("file-expired", "segment-2", expired)
+	if _, err := opt.GetPins().Pin("file-expired", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if removed, _ := c.Sweep(context.Background(), now); removed != 0 {
+		t.Fatalf("被固定的文件不应被清理，实际清理 %d", removed)
+	}
+	if ok, _ := afero.Exists(afe, pinnedPath); !ok {
+		t.Fatal("被固定的片段被误删")
+	}
+
+	// 本节点签发的存储承诺未到期时保留片段
+	nodePriv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	committedNotice, err := Sign(priv, "file-committed", now.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	committedPath := write("file-committed", "segment-1", committedNotice)
+	receipt, err := commitment.NewReceipt(nodePriv, peer.ID("uploader"), "file-committed", "segment-1", []byte("data"), now.Add(time.Hour).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := opt.GetCommitments().Add(receipt); err != nil {
+		t.Fatal(err)
+	}
+	if removed, _ := c.Sweep(context.Background(), now); removed != 0 {
+		t.Fatalf("存储承诺未到期的片段不应被清理，实际清理 %d", removed)
+	}
+	if ok, _ := afero.Exists(afe, committedPath); !ok {
+		t.Fatal("存储承诺未到期的片段被误删")
+	}
+	if report := c.Report(); report.Removed != 1 || report.Retained != 3 {
+		t.Fatalf("累计结果不符: %+v", report)
+	}
+}
+
+func TestPublishDue(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	afe := afero.NewMemMapFs()
+	c := newCollector(context.Background(), opts.DefaultOptions(), afe, peer.ID("owner-node"))
+	var published []*Notice
+	c.publish = func(n *Notice) error {
+		published = append(published, n)
+		return nil
+	}
+
+	due, _ := Sign(priv, "file-due", now.Add(-time.Second))
+	later, _ := Sign(priv, "file-later", now.Add(time.Hour))
+	for _, n := range []*Notice{due, later} {
+		if err := Schedule(afe, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := c.PublishDue(now); n != 1 || len(published) != 1 || published[0].FileID != "file-due" {
+		t.Fatalf("应只广播到期的通知: %d, %v", n, published)
+	}
+	scheduled, err := Scheduled(afe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scheduled) != 1 || scheduled[0].FileID != "file-later" {
+		t.Fatalf("广播后应移除到期计划: %v", scheduled)
+	}
+}
@@ -0,0 +1,41 @@
+package defs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"time"
+
+	"github.com/bpfs/defs/expiry"
+	"github.com/bpfs/defs/uploads"
+)
+
+// UploadWithExpiry 上传文件，文件在到期时间后从全网清理
+// 到期时间写入每个文件片段，即使本节点离线，存储节点也会在到期后独立清理
+// 参数：
+//   - ctx: context.Context 上传任务的上下文
+//   - path: string 文件路径
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥，为 nil 时使用默认所有者
+//   - expiresAt: time.Time 到期时间，必须晚于当前时间
+//
+// 返回值：
+//   - *uploads.UploadSuccessInfo: 文件上传成功后的返回信息
+//   - error: 如果发生错误，返回错误信息
+func (fs *FS) UploadWithExpiry(ctx context.Context, path string, ownerPriv *ecdsa.PrivateKey, expiresAt time.Time) (*uploads.UploadSuccessInfo, error) {
+	return fs.upload.NewUploadWithExpiry(ctx, fs.opt, fs.afe, fs.p2p, fs.pub, path, ownerPriv, expiresAt)
+}
+
+// SweepExpired 立即清理本节点存储的所有到期文件片段
+// 参数：
+//   - ctx: context.Context 上下文，可用于中止本轮清理
+//
+// 返回值：
+//   - int: 本轮清理的片段数量
+//   - error: 本轮清理被中止或无法遍历存储目录时返回错误
+func (fs *FS) SweepExpired(ctx context.Context) (int, error) {
+	return fs.expiry.Sweep(ctx, time.Now())
+}
+
+// ExpiryReport 获取到期清理的累计结果
+func (fs *FS) ExpiryReport() expiry.Report {
+	return fs.expiry.Report()
+}
@@ -0,0 +1,242 @@
+// Package fastsync 实现冷启动时从受信任节点快速同步元数据。
+// 同一身份的新节点向指定的受信任节点出示所有者签名的请求，取回该身份的文件完整性报告、
+// 已签发的委托下载令牌以及元数据与名称记录，逐条验证所有者签名后才写入本地。
+package fastsync
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/downloads"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/index"
+	sign "github.com/bpfs/defs/sign/ecdsa"
+	"github.com/bpfs/defs/uploads"
+	"github.com/bpfs/defs/util"
+	"github.com/bpfs/defs/wallets"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	version = "1.0.0" // 快速同步协议版本
+
+	// maxRequestAge 同步请求签名的有效时长，超过后受信任节点拒绝请求
+	maxRequestAge = 5 * time.Minute
+)
+
+var (
+	// StreamFastSyncProtocol 快速同步元数据的协议
+	StreamFastSyncProtocol = fmt.Sprintf("defs@stream/fastsync/%s", version)
+)
+
+// Request 快速同步请求，由所有者签名以证明请求方持有该身份
+type Request struct {
+	PublicKey []byte // 所有者公钥
+	Timestamp int64  // 请求的时间戳(Unix 秒)
+	Signature []byte // 所有者对请求的签名
+}
+
+// NewRequest 创建并签名快速同步请求
+// 参数：
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥
+//
+// 返回值：
+//   - *Request: 签名后的同步请求
+//   - error: 如果发生错误，返回错误信息
+func NewRequest(ownerPriv *ecdsa.PrivateKey) (*Request, error) {
+	if ownerPriv == nil {
+		return nil, fmt.Errorf("%w: 所有者私钥不能为空", errs.ErrInvalidArgument)
+	}
+	publicKey, err := wallets.MarshalPublicKey(ownerPriv.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	req := &Request{PublicKey: publicKey, Timestamp: time.Now().Unix()}
+	data, err := req.signingData()
+	if err != nil {
+		return nil, err
+	}
+	if req.Signature, err = sign.SignData(ownerPriv, data); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return nil, err
+	}
+	return req, nil
+}
+
+// Verify 验证同步请求的签名及时效
+// 参数：
+//   - now: time.Time 当前时间
+//
+// 返回值：
+//   - string: 所有者公钥哈希的十六进制字符串
+//   - error: 验证失败时返回包装了 errs.ErrUnauthorized 的错误
+func (r *Request) Verify(now time.Time) (string, error) {
+	if age := now.Sub(time.Unix(r.Timestamp, 0)); age > maxRequestAge || age < -maxRequestAge {
+		return "", fmt.Errorf("%w: 同步请求已过期", errs.ErrUnauthorized)
+	}
+	publicKey, err := wallets.UnmarshalPublicKey(r.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errs.ErrUnauthorized, err)
+	}
+	data, err := r.signingData()
+	if err != nil {
+		return "", err
+	}
+	valid, err := sign.VerifySignature(&publicKey, data, r.Signature)
+	if err != nil || !valid {
+		return "", fmt.Errorf("%w: 同步请求签名无效", errs.ErrUnauthorized)
+	}
+	pubKeyHash, ok := wallets.PublicKeyToPublicKeyHash(publicKey)
+	if !ok {
+		return "", fmt.Errorf("%w: 无法生成公钥哈希", errs.ErrUnauthorized)
+	}
+	return hex.EncodeToString(pubKeyHash), nil
+}
+
+// signingData 返回请求中参与签名的字段
+func (r *Request) signingData() ([]byte, error) {
+	return util.MergeFieldsForSigning(StreamFastSyncProtocol, r.PublicKey, r.Timestamp)
+}
+
+// Catalog 受信任节点返回的单个身份的元数据
+type Catalog struct {
+	Reports []*uploads.IntegrityReport // 文件完整性报告，即该身份上传的文件
+	Grants  [][]byte                   // 该身份签发的委托下载令牌
+	Records []*index.IndexRecord       // 该身份的元数据记录
+	Names   []*index.NameRecord        // 该身份的名称记录
+}
+
+// Result 快速同步的结果
+type Result struct {
+	Reports  int // 写入的完整性报告数量
+	Grants   int // 写入的委托下载令牌数量
+	Records  int // 写入的元数据记录数量
+	Names    int // 写入的名称记录数量
+	Rejected int // 未通过验证而被丢弃的条目数量
+}
+
+// BuildCatalog 收集本节点保存的属于指定身份的元数据
+// 参数：
+//   - afe: afero.Afero 文件系统接口
+//   - store: *index.IndexStore 元数据索引
+//   - owner: string 所有者公钥哈希的十六进制字符串
+//
+// 返回值：
+//   - *Catalog: 该身份的元数据
+//   - error: 读取失败时返回错误
+func BuildCatalog(afe afero.Afero, store *index.IndexStore, owner string) (*Catalog, error) {
+	catalog := new(Catalog)
+
+	reports, err := uploads.ListReports(afe)
+	if err != nil {
+		return nil, err
+	}
+	for _, report := range reports {
+		if report.Owner == owner {
+			catalog.Reports = append(catalog.Reports, report)
+		}
+	}
+
+	grants, err := downloads.ListGrants(afe)
+	if err != nil {
+		return nil, err
+	}
+	for _, grant := range grants {
+		if grantOwner(grant) != owner {
+			continue
+		}
+		token, err := grant.Encode()
+		if err != nil {
+			return nil, err
+		}
+		catalog.Grants = append(catalog.Grants, token)
+	}
+
+	if store != nil {
+		records, _ := store.Since(0)
+		for _, record := range records {
+			if record.Owner == owner {
+				catalog.Records = append(catalog.Records, record)
+			}
+		}
+		names, _ := store.NamesSince(0)
+		for _, record := range names {
+			if record.Owner == owner {
+				catalog.Names = append(catalog.Names, record)
+			}
+		}
+	}
+	return catalog, nil
+}
+
+// Apply 逐条验证受信任节点返回的元数据并写入本地
+// 只接受由指定身份签名的条目，受信任节点无法借此注入其他身份或伪造的数据
+// 参数：
+//   - afe: afero.Afero 文件系统接口
+//   - store: *index.IndexStore 元数据索引
+//   - owner: string 所有者公钥哈希的十六进制字符串
+//   - catalog: *Catalog 受信任节点返回的元数据
+//
+// 返回值：
+//   - *Result: 同步的结果
+//   - error: 写入失败时返回错误
+func Apply(afe afero.Afero, store *index.IndexStore, owner string, catalog *Catalog) (*Result, error) {
+	result := new(Result)
+
+	for _, report := range catalog.Reports {
+		if report.Owner != owner || report.Verify() != nil {
+			result.Rejected++
+			continue
+		}
+		if err := uploads.SaveReport(afe, report); err != nil {
+			return result, err
+		}
+		result.Reports++
+	}
+
+	for _, token := range catalog.Grants {
+		grant, err := downloads.DecodeDelegation(token)
+		if err != nil || grantOwner(grant) != owner || grant.Verify() != nil {
+			result.Rejected++
+			continue
+		}
+		if err := downloads.SaveGrant(afe, grant); err != nil {
+			return result, err
+		}
+		result.Grants++
+	}
+
+	for _, record := range catalog.Records {
+		if record.Owner != owner || record.Verify() != nil {
+			result.Rejected++
+			continue
+		}
+		if store != nil && store.Put(record) {
+			result.Records++
+		}
+	}
+
+	for _, record := range catalog.Names {
+		if record.Owner != owner || record.Verify() != nil {
+			result.Rejected++
+			continue
+		}
+		if store != nil && store.PutName(record) {
+			result.Names++
+		}
+	}
+	return result, nil
+}
+
+// grantOwner 获取委托下载令牌签发者的公钥哈希
+func grantOwner(grant *downloads.Delegation) string {
+	pubKeyHash, ok := wallets.PublicKeyBytesToPublicKeyHash(grant.Owner)
+	if !ok {
+		return ""
+	}
+	return hex.EncodeToString(pubKeyHash)
+}
@@ -0,0 +1,121 @@
+package fastsync
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/downloads"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/index"
+	"github.com/bpfs/defs/uploads"
+)
+
+func newStore() *index.IndexStore {
+	return &index.IndexStore{
+		Records:    make(map[string]*index.IndexRecord),
+		Names:      make(map[string]*index.NameRecord),
+		SaveToFile: make(chan struct{}, 1),
+	}
+}
+
+// hashOf 获取私钥对应的公钥哈希
+func hashOf(t *testing.T, priv *ecdsa.PrivateKey) string {
+	t.Helper()
+	req, err := NewRequest(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner, err := req.Verify(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return owner
+}
+
+func TestRequestVerify(t *testing.T) {
+	owner, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	req, err := NewRequest(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := req.Verify(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := req.Verify(time.Now().Add(time.Hour)); !errors.Is(err, errs.ErrUnauthorized) {
+		t.Fatalf("过期的请求应被拒绝, 实际 %v", err)
+	}
+
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	forged, _ := NewRequest(other)
+	forged.PublicKey = req.PublicKey
+	if _, err := forged.Verify(time.Now()); !errors.Is(err, errs.ErrUnauthorized) {
+		t.Fatalf("签名与公钥不匹配的请求应被拒绝, 实际 %v", err)
+	}
+}
+
+func TestBuildAndApply(t *testing.T) {
+	owner, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ownerHash := hashOf(t, owner)
+
+	// 受信任节点保存了两个身份的元数据
+	src := afero.NewMemMapFs()
+	srcStore := newStore()
+	for i, priv := range []*ecdsa.PrivateKey{owner, other} {
+		report := &uploads.IntegrityReport{FileID: []string{"file-a", "file-b"}[i], Name: "a.txt"}
+		if err := report.Sign(priv); err != nil {
+			t.Fatal(err)
+		}
+		if err := uploads.SaveReport(src, report); err != nil {
+			t.Fatal(err)
+		}
+		grant, err := downloads.NewDelegation(priv, report.FileID, &other.PublicKey, downloads.ScopeSegments, time.Hour, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := downloads.SaveGrant(src, grant); err != nil {
+			t.Fatal(err)
+		}
+		record, err := index.NewIndexRecord(priv, report.FileID, report.Name, 1, "text/plain")
+		if err != nil {
+			t.Fatal(err)
+		}
+		srcStore.Put(record)
+	}
+
+	catalog, err := BuildCatalog(src, srcStore, ownerHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(catalog.Reports) != 1 || len(catalog.Grants) != 1 || len(catalog.Records) != 1 {
+		t.Fatalf("只应返回请求方身份的元数据: %d %d %d", len(catalog.Reports), len(catalog.Grants), len(catalog.Records))
+	}
+
+	// 受信任节点夹带的其他身份的条目与被篡改的条目都被丢弃
+	foreign, _ := BuildCatalog(src, srcStore, hashOf(t, other))
+	catalog.Reports = append(catalog.Reports, foreign.Reports...)
+	tampered := *catalog.Reports[0]
+	tampered.Name = "b.txt"
+	catalog.Reports = append(catalog.Reports, &tampered)
+
+	dst := afero.NewMemMapFs()
+	dstStore := newStore()
+	result, err := Apply(dst, dstStore, ownerHash, catalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Reports != 1 || result.Grants != 1 || result.Records != 1 || result.Rejected != 2 {
+		t.Fatalf("同步结果不符: %+v", result)
+	}
+	if report, err := uploads.LoadReport(dst, "file-a"); err != nil || report.Name != "a.txt" {
+		t.Fatalf("应写入完整性报告: %v", err)
+	}
+	if _, err := uploads.LoadReport(dst, "file-b"); !errors.Is(err, errs.ErrNotFound) {
+		t.Fatalf("不应写入其他身份的报告, 实际 %v", err)
+	}
+}
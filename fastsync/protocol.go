@@ -0,0 +1,134 @@
+package fastsync
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/index"
+	"github.com/bpfs/defs/network"
+	"github.com/bpfs/defs/util"
+	"github.com/bpfs/dep2p"
+	"github.com/bpfs/dep2p/streams"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+)
+
+// 快速同步协议
+type FastSyncProtocol struct {
+	Afe   afero.Afero       // 文件系统接口
+	Index *index.IndexStore // 元数据索引
+}
+
+type RegisterFastSyncProtocolInput struct {
+	fx.In
+	LC    fx.Lifecycle
+	Afe   afero.Afero       // 文件系统接口
+	P2P   *dep2p.DeP2P      // 网络主机
+	Index *index.IndexStore // 元数据索引
+}
+
+// RegisterFastSyncProtocol 注册快速同步协议
+// 任何节点都可以作为受信任节点，但只向能够证明持有对应身份的请求方返回该身份的元数据
+func RegisterFastSyncProtocol(input RegisterFastSyncProtocolInput) {
+	fp := &FastSyncProtocol{
+		Afe:   input.Afe,
+		Index: input.Index,
+	}
+
+	input.LC.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			// 注册快速同步元数据
+			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamFastSyncProtocol), network.HandlerWithLimits(StreamFastSyncProtocol, network.HandlerWithRW(fp.handleFastSync)))
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			return nil
+		},
+	})
+}
+
+// handleFastSync 处理快速同步请求，返回请求方身份的元数据
+func (fp *FastSyncProtocol) handleFastSync(req *streams.RequestMessage, res *streams.ResponseMessage) (int32, string) {
+	payload := new(Request)
+	if err := util.DecodeFromBytes(req.Payload, payload); err != nil {
+		logrus.Errorf("[%s]解码错误: %v", debug.WhereAmI(), err)
+		return 6603, "解码错误"
+	}
+
+	owner, err := payload.Verify(time.Now())
+	if err != nil {
+		logrus.Warnf("[%s]拒绝快速同步请求: %v", debug.WhereAmI(), err)
+		return 403, "同步请求验证失败"
+	}
+
+	catalog, err := BuildCatalog(fp.Afe, fp.Index, owner)
+	if err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return 500, "读取元数据失败"
+	}
+	catalogBytes, err := util.EncodeToBytes(catalog)
+	if err != nil {
+		return 6605, err.Error()
+	}
+
+	res.Data = catalogBytes
+	return 200, "成功"
+}
+
+// Pull 从受信任节点拉取身份的元数据，验证后写入本地
+// 参数：
+//   - ctx: context.Context 上下文，取消时中止请求
+//   - p2p: *dep2p.DeP2P 网络主机
+//   - afe: afero.Afero 文件系统接口
+//   - store: *index.IndexStore 元数据索引
+//   - trusted: peer.ID 受信任节点
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥
+//
+// 返回值：
+//   - *Result: 同步的结果
+//   - error: 如果发生错误，返回错误信息
+func Pull(ctx context.Context, p2p *dep2p.DeP2P, afe afero.Afero, store *index.IndexStore, trusted peer.ID, ownerPriv *ecdsa.PrivateKey) (*Result, error) {
+	req, err := NewRequest(ownerPriv)
+	if err != nil {
+		return nil, err
+	}
+	owner, err := req.Verify(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := network.SendStreamContext(ctx, p2p, StreamFastSyncProtocol, "", trusted, req)
+	if err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return nil, errs.Unreachable(trusted, StreamFastSyncProtocol, err)
+	}
+	if res == nil {
+		return nil, errs.Unreachable(trusted, StreamFastSyncProtocol, nil)
+	}
+	if res.Code != 200 {
+		return nil, errs.Rejected(trusted, StreamFastSyncProtocol, res.Code, res.Msg)
+	}
+
+	catalog := new(Catalog)
+	if len(res.Data) > 0 {
+		if err := util.DecodeFromBytes(res.Data, catalog); err != nil {
+			logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+			return nil, err
+		}
+	}
+
+	result, err := Apply(afe, store, owner, catalog)
+	if err != nil {
+		return result, err
+	}
+	if result.Rejected > 0 {
+		logrus.Warnf("[%s]受信任节点 %s 返回了 %d 条未通过验证的元数据", debug.WhereAmI(), trusted, result.Rejected)
+	}
+	return result, nil
+}
@@ -0,0 +1,29 @@
+package defs
+
+import (
+	"context"
+	"crypto/ecdsa"
+
+	"github.com/bpfs/defs/fastsync"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// FastSync 从受信任节点快速同步身份的元数据，用于同一身份的新节点冷启动
+// 同步的内容包括文件完整性报告、已签发的委托下载令牌以及元数据与名称记录，每条都需通过所有者签名验证
+// 参数：
+//   - ctx: context.Context 上下文，取消时中止请求
+//   - trusted: peer.ID 受信任节点，通常是同一身份的旧节点
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥，为 nil 时使用默认所有者
+//
+// 返回值：
+//   - *fastsync.Result: 同步的结果
+//   - error: 只读模式下返回包装了 errs.ErrReadOnly 的错误，请求失败时返回节点错误
+func (fs *FS) FastSync(ctx context.Context, trusted peer.ID, ownerPriv *ecdsa.PrivateKey) (*fastsync.Result, error) {
+	if err := fs.opt.CheckWritable("快速同步元数据"); err != nil {
+		return nil, err
+	}
+	if ownerPriv == nil {
+		ownerPriv = fs.opt.GetDefaultOwnerPriv()
+	}
+	return fastsync.Pull(ctx, fs.p2p, fs.afe, fs.index, trusted, ownerPriv)
+}
@@ -0,0 +1,357 @@
+// Package gate 按节点ID与 IP 段限制本节点的连接
+// Gater 实现 libp2p 的 ConnectionGater 接口，构建主机时通过 libp2p.ConnectionGater 传入，
+// 在协议握手之前拒绝不允许的连接；主机构建时未传入的，可通过 Attach 在连接建立后立即断开。
+// 策略可在运行时修改并持久化，修改后已建立的不允许的连接随即断开
+package gate
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"github.com/sirupsen/logrus"
+)
+
+// Mode 连接限制的模式
+type Mode int
+
+const (
+	ModeOpen      Mode = iota // 允许除拒绝名单外的所有节点
+	ModeAllowList             // 只允许名单中的节点或 IP 段
+)
+
+// Policy 连接限制策略，拒绝名单优先于允许名单
+type Policy struct {
+	Mode       Mode      // 模式
+	AllowPeers []peer.ID // 允许的节点，仅在 ModeAllowList 模式下生效
+	DenyPeers  []peer.ID // 拒绝的节点
+	AllowCIDRs []string  // 允许的 IP 段，仅在 ModeAllowList 模式下生效
+	DenyCIDRs  []string  // 拒绝的 IP 段
+}
+
+// compiled 解析后的策略
+type compiled struct {
+	mode       Mode
+	allowPeers map[peer.ID]bool
+	denyPeers  map[peer.ID]bool
+	allowNets  []*net.IPNet
+	denyNets   []*net.IPNet
+}
+
+// compile 解析策略
+// 返回值：
+//   - error: IP 段无效时返回包装了 errs.ErrInvalidArgument 的错误
+func compile(p Policy) (*compiled, error) {
+	if p.Mode != ModeOpen && p.Mode != ModeAllowList {
+		return nil, fmt.Errorf("%w: 无效的连接限制模式 %d", errs.ErrInvalidArgument, p.Mode)
+	}
+	c := &compiled{
+		mode:       p.Mode,
+		allowPeers: make(map[peer.ID]bool),
+		denyPeers:  make(map[peer.ID]bool),
+	}
+	for _, id := range p.AllowPeers {
+		c.allowPeers[id] = true
+	}
+	for _, id := range p.DenyPeers {
+		c.denyPeers[id] = true
+	}
+	for _, cidr := range p.AllowCIDRs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: 无效的 IP 段 %s", errs.ErrInvalidArgument, cidr)
+		}
+		c.allowNets = append(c.allowNets, ipNet)
+	}
+	for _, cidr := range p.DenyCIDRs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: 无效的 IP 段 %s", errs.ErrInvalidArgument, cidr)
+		}
+		c.denyNets = append(c.denyNets, ipNet)
+	}
+	return c, nil
+}
+
+// contains 判断 IP 是否属于任一 IP 段
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// allow 判断是否允许与节点在指定地址上的连接
+// 节点或地址未知时传入空值，此时只按已知的部分判断，仅在确定被拒绝时返回 false
+func (c *compiled) allow(p peer.ID, addr ma.Multiaddr) bool {
+	var ip net.IP
+	if addr != nil {
+		ip, _ = manet.ToIP(addr)
+	}
+	if p != "" && c.denyPeers[p] {
+		return false
+	}
+	if ip != nil && contains(c.denyNets, ip) {
+		return false
+	}
+	if c.mode == ModeOpen {
+		return true
+	}
+	if p != "" && c.allowPeers[p] {
+		return true
+	}
+	if ip != nil && contains(c.allowNets, ip) {
+		return true
+	}
+	// 尚未知道节点ID或地址时不能断定被拒绝，留待之后的阶段判断
+	return p == "" || (ip == nil && len(c.allowNets) > 0)
+}
+
+// Gater 连接限制
+// 零值不可用，通过 NewGater 创建；所有方法在 nil 接收者上均允许连接
+type Gater struct {
+	updateMu sync.Mutex // 串行化策略的读取、修改与保存，避免并发修改相互覆盖
+	mu       sync.RWMutex
+	policy   Policy      // 当前策略
+	c        *compiled   // 解析后的当前策略
+	afe      afero.Afero // 持久化使用的文件系统
+	path     string      // 持久化文件路径，为空时不持久化
+	hosts    []host.Host // 通过 Attach 关联的主机，策略变化时断开不允许的连接
+}
+
+var _ connmgr.ConnectionGater = (*Gater)(nil)
+
+// NewGater 创建允许所有连接的连接限制
+func NewGater() *Gater {
+	c, _ := compile(Policy{})
+	return &Gater{c: c}
+}
+
+// Open 设置持久化文件路径并加载已保存的策略
+// 参数：
+//   - afe: afero.Afero 文件系统接口
+//   - path: string 持久化文件路径
+//
+// 返回值：
+//   - error: 文件存在但解析失败时返回错误
+func (g *Gater) Open(afe afero.Afero, path string) error {
+	if g == nil {
+		return nil
+	}
+
+	g.mu.Lock()
+	g.afe, g.path = afe, path
+	g.mu.Unlock()
+
+	if exists, err := afero.Exists(afe, path); err != nil || !exists {
+		return err
+	}
+	data, err := afero.ReadFile(afe, path)
+	if err != nil {
+		return err
+	}
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return err
+	}
+	c, err := compile(policy)
+	if err != nil {
+		return err
+	}
+	g.apply(policy, c)
+	return nil
+}
+
+// Policy 获取当前策略
+func (g *Gater) Policy() Policy {
+	if g == nil {
+		return Policy{}
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	p := g.policy
+	p.AllowPeers = append([]peer.ID(nil), p.AllowPeers...)
+	p.DenyPeers = append([]peer.ID(nil), p.DenyPeers...)
+	p.AllowCIDRs = append([]string(nil), p.AllowCIDRs...)
+	p.DenyCIDRs = append([]string(nil), p.DenyCIDRs...)
+	return p
+}
+
+// SetPolicy 替换策略，保存后断开已建立的不允许的连接
+// 参数：
+//   - policy: Policy 新的策略
+//
+// 返回值：
+//   - error: 策略无效时返回包装了 errs.ErrInvalidArgument 的错误，保存失败时返回写入错误且策略不变
+func (g *Gater) SetPolicy(policy Policy) error {
+	return g.update(func(p *Policy) { *p = policy })
+}
+
+// AllowPeer 将节点加入允许名单，并移出拒绝名单
+func (g *Gater) AllowPeer(p peer.ID) error {
+	return g.update(func(policy *Policy) {
+		policy.DenyPeers = without(policy.DenyPeers, p)
+		policy.AllowPeers = append(without(policy.AllowPeers, p), p)
+	})
+}
+
+// DenyPeer 将节点加入拒绝名单，并移出允许名单
+func (g *Gater) DenyPeer(p peer.ID) error {
+	return g.update(func(policy *Policy) {
+		policy.AllowPeers = without(policy.AllowPeers, p)
+		policy.DenyPeers = append(without(policy.DenyPeers, p), p)
+	})
+}
+
+// ForgetPeer 将节点移出允许与拒绝名单
+func (g *Gater) ForgetPeer(p peer.ID) error {
+	return g.update(func(policy *Policy) {
+		policy.AllowPeers = without(policy.AllowPeers, p)
+		policy.DenyPeers = without(policy.DenyPeers, p)
+	})
+}
+
+// update 在当前策略的副本上修改，保存成功后生效并断开已建立的不允许的连接
+// 整个读取、修改与保存的过程串行执行，并发的修改不会相互覆盖
+func (g *Gater) update(modify func(*Policy)) error {
+	if g == nil {
+		return nil
+	}
+	g.updateMu.Lock()
+	defer g.updateMu.Unlock()
+
+	policy := g.Policy()
+	modify(&policy)
+	c, err := compile(policy)
+	if err != nil {
+		return err
+	}
+	if err := g.save(policy); err != nil {
+		return err
+	}
+	g.apply(policy, c)
+	return nil
+}
+
+// apply 使策略生效，并断开已建立的不允许的连接
+func (g *Gater) apply(policy Policy, c *compiled) {
+	g.mu.Lock()
+	g.policy, g.c = policy, c
+	hosts := append([]host.Host(nil), g.hosts...)
+	g.mu.Unlock()
+
+	for _, h := range hosts {
+		g.prune(h)
+	}
+}
+
+// without 返回移除指定节点后的名单
+func without(ids []peer.ID, p peer.ID) []peer.ID {
+	result := ids[:0]
+	for _, id := range ids {
+		if id != p {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// Allowed 判断是否允许与节点在指定地址上的连接
+// 参数：
+//   - p: peer.ID 对方节点
+//   - addr: ma.Multiaddr 对方地址，未知时为 nil
+func (g *Gater) Allowed(p peer.ID, addr ma.Multiaddr) bool {
+	if g == nil {
+		return true
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.c.allow(p, addr)
+}
+
+// Attach 关联未在构建时传入 Gater 的主机：连接建立后立即断开不允许的连接，并断开现有的不允许的连接
+func (g *Gater) Attach(h host.Host) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	g.hosts = append(g.hosts, h)
+	g.mu.Unlock()
+
+	h.Network().Notify(&network.NotifyBundle{
+		ConnectedF: func(_ network.Network, conn network.Conn) {
+			if !g.Allowed(conn.RemotePeer(), conn.RemoteMultiaddr()) {
+				logrus.Infof("[%s]断开被限制的节点 %s (%s)", debug.WhereAmI(), conn.RemotePeer(), conn.RemoteMultiaddr())
+				go conn.Close()
+			}
+		},
+	})
+	g.prune(h)
+}
+
+// prune 断开主机上已建立的不允许的连接
+func (g *Gater) prune(h host.Host) {
+	for _, conn := range h.Network().Conns() {
+		if !g.Allowed(conn.RemotePeer(), conn.RemoteMultiaddr()) {
+			logrus.Infof("[%s]断开被限制的节点 %s (%s)", debug.WhereAmI(), conn.RemotePeer(), conn.RemoteMultiaddr())
+			conn.Close()
+		}
+	}
+}
+
+// save 将策略保存到持久化文件
+// 返回值：
+//   - error: 写入失败时返回错误
+func (g *Gater) save(policy Policy) error {
+	g.mu.RLock()
+	afe, path := g.afe, g.path
+	g.mu.RUnlock()
+	if path == "" {
+		return nil
+	}
+	data, err := json.Marshal(policy)
+	if err != nil {
+		logrus.Errorf("[%s]序列化连接限制策略失败: %v", debug.WhereAmI(), err)
+		return err
+	}
+
+	return afero.WriteFileAtomic(afe, path, data, 0644)
+}
+
+// InterceptPeerDial 实现 ConnectionGater 接口，拨号前检查节点
+func (g *Gater) InterceptPeerDial(p peer.ID) bool {
+	return g.Allowed(p, nil)
+}
+
+// InterceptAddrDial 实现 ConnectionGater 接口，拨号前检查节点与地址
+func (g *Gater) InterceptAddrDial(p peer.ID, addr ma.Multiaddr) bool {
+	return g.Allowed(p, addr)
+}
+
+// InterceptAccept 实现 ConnectionGater 接口，接受连接时只检查地址
+func (g *Gater) InterceptAccept(addrs network.ConnMultiaddrs) bool {
+	return g.Allowed("", addrs.RemoteMultiaddr())
+}
+
+// InterceptSecured 实现 ConnectionGater 接口，加密握手后检查节点与地址
+func (g *Gater) InterceptSecured(_ network.Direction, p peer.ID, addrs network.ConnMultiaddrs) bool {
+	return g.Allowed(p, addrs.RemoteMultiaddr())
+}
+
+// InterceptUpgraded 实现 ConnectionGater 接口，此前的阶段已完成检查
+func (g *Gater) InterceptUpgraded(network.Conn) (bool, control.DisconnectReason) {
+	return true, 0
+}
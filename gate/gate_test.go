@@ -0,0 +1,106 @@
+package gate
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/errs"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestGater(t *testing.T) {
+	known, _ := peer.Decode("QmbvZMNyx4nTEL5fp8Aw58Gv37JPrdR6zeHLsYC5gWGDPN")
+	other, _ := peer.Decode("QmXwcDBQHptKogLKa5NW7NRoDuvDLJ9xMRkLqCu5prTL1k")
+	lan := ma.StringCast("/ip4/10.0.0.5/tcp/4001")
+	wan := ma.StringCast("/ip4/203.0.113.9/tcp/4001")
+
+	g := NewGater()
+	if !g.Allowed(other, wan) {
+		t.Fatal("默认应允许所有连接")
+	}
+	if err := g.DenyPeer(other); err != nil {
+		t.Fatal(err)
+	}
+	if g.Allowed(other, lan) || !g.Allowed(known, wan) {
+		t.Fatal("拒绝名单只应拒绝指定节点")
+	}
+
+	afe := afero.NewOsFs()
+	path := filepath.Join(t.TempDir(), "gate")
+	if err := g.Open(afe, path); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.SetPolicy(Policy{
+		Mode:       ModeAllowList,
+		AllowPeers: []peer.ID{known},
+		AllowCIDRs: []string{"10.0.0.0/8"},
+		DenyCIDRs:  []string{"10.0.0.5/32"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !g.Allowed(known, wan) {
+		t.Fatal("允许名单中的节点应被允许")
+	}
+	if g.Allowed(other, wan) {
+		t.Fatal("允许名单模式下名单外的节点应被拒绝")
+	}
+	if !g.Allowed(other, ma.StringCast("/ip4/10.1.2.3/tcp/4001")) {
+		t.Fatal("允许的 IP 段中的节点应被允许")
+	}
+	if g.Allowed(known, lan) {
+		t.Fatal("拒绝的 IP 段优先于允许名单")
+	}
+
+	// 接受连接时尚不知道节点ID，不能提前拒绝
+	if !g.Allowed("", wan) {
+		t.Fatal("节点ID未知时不应提前拒绝")
+	}
+
+	if err := g.SetPolicy(Policy{DenyCIDRs: []string{"not-a-cidr"}}); !errors.Is(err, errs.ErrInvalidArgument) {
+		t.Fatalf("无效的 IP 段应被拒绝: %v", err)
+	}
+
+	// 重启后加载保存的策略
+	reloaded := NewGater()
+	if err := reloaded.Open(afe, path); err != nil {
+		t.Fatal(err)
+	}
+	if policy := reloaded.Policy(); policy.Mode != ModeAllowList || len(policy.AllowPeers) != 1 || policy.AllowPeers[0] != known {
+		t.Fatalf("应加载保存的策略: %+v", policy)
+	}
+	if reloaded.Allowed(other, wan) {
+		t.Fatal("加载的策略应生效")
+	}
+
+	// 并发修改名单时不会相互覆盖
+	var wg sync.WaitGroup
+	for _, id := range []peer.ID{known, other} {
+		wg.Add(1)
+		go func(id peer.ID) {
+			defer wg.Done()
+			if err := reloaded.DenyPeer(id); err != nil {
+				t.Error(err)
+			}
+		}(id)
+	}
+	wg.Wait()
+	if policy := reloaded.Policy(); len(policy.DenyPeers) != 2 {
+		t.Fatalf("并发修改的名单应全部保留: %+v", policy)
+	}
+
+	// 保存失败时返回错误，策略保持不变
+	readOnly := NewGater()
+	if err := readOnly.Open(afero.NewReadOnlyFs(afe), path); err != nil {
+		t.Fatal(err)
+	}
+	if err := readOnly.AllowPeer(other); err == nil {
+		t.Fatal("保存失败时应返回错误")
+	}
+	if readOnly.Allowed(other, wan) {
+		t.Fatal("保存失败时策略不应生效")
+	}
+}
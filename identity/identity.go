@@ -0,0 +1,159 @@
+// Package identity 实现了节点身份的轮换与连续性证明。
+// 轮换时生成新的节点密钥，由旧密钥与新密钥共同签署连续性记录：旧密钥的签名授权这次轮换，新密钥的签名证明持有新身份。
+// 记录在网络中广播，其他节点据此将旧身份上的文件片段、路由与订阅关系延续到新身份，密钥泄露后不必从零开始。
+package identity
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/gob"
+	"fmt"
+	"time"
+
+	"github.com/bpfs/defs/errs"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const version = "1.0.0"
+
+var (
+	// 节点轮换身份后广播的连续性记录
+	PubSubIdentityTopic = fmt.Sprintf("defs@pubsub/identity/%s", version)
+)
+
+// rsaBits 旧密钥为 RSA 时新密钥的长度
+const rsaBits = 2048
+
+// Continuity 节点身份的连续性记录，证明新身份由旧身份的持有者授权
+type Continuity struct {
+	OldID        peer.ID // 旧身份
+	NewID        peer.ID // 新身份
+	OldPubKey    []byte  // 旧身份的公钥，RSA 等无法从节点ID中提取公钥的密钥需要携带
+	NewPubKey    []byte  // 新身份的公钥
+	IssuedAt     int64   // 签发时间(Unix 秒)
+	Reason       string  // 轮换原因，如定期轮换或密钥泄露
+	OldSignature []byte  // 旧密钥的签名
+	NewSignature []byte  // 新密钥的签名
+}
+
+// Rotate 生成与旧密钥类型相同的新密钥，并签署连续性记录
+// 参数：
+//   - oldPriv: crypto.PrivKey 当前节点的私钥
+//   - reason: string 轮换原因
+//
+// 返回值：
+//   - crypto.PrivKey: 新的节点私钥，调用方需妥善保存并用其重新创建网络主机
+//   - *Continuity: 连续性记录
+//   - error: 如果发生错误，返回错误信息
+func Rotate(oldPriv crypto.PrivKey, reason string) (crypto.PrivKey, *Continuity, error) {
+	if oldPriv == nil {
+		return nil, nil, fmt.Errorf("%w: 当前节点的私钥不可为空", errs.ErrInvalidArgument)
+	}
+	keyType := oldPriv.Type()
+	switch keyType {
+	case crypto.RSA, crypto.Ed25519, crypto.Secp256k1, crypto.ECDSA:
+	default:
+		keyType = crypto.Ed25519
+	}
+	newPriv, _, err := crypto.GenerateKeyPairWithReader(int(keyType), rsaBits, rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := NewContinuity(oldPriv, newPriv, reason)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newPriv, c, nil
+}
+
+// NewContinuity 由旧密钥与新密钥共同签署连续性记录
+// 参数：
+//   - oldPriv: crypto.PrivKey 旧身份的私钥
+//   - newPriv: crypto.PrivKey 新身份的私钥
+//   - reason: string 轮换原因
+//
+// 返回值：
+//   - *Continuity: 签名后的连续性记录
+//   - error: 如果发生错误，返回错误信息
+func NewContinuity(oldPriv, newPriv crypto.PrivKey, reason string) (*Continuity, error) {
+	if oldPriv == nil || newPriv == nil {
+		return nil, fmt.Errorf("%w: 新旧身份的私钥不可为空", errs.ErrInvalidArgument)
+	}
+	c := &Continuity{IssuedAt: time.Now().Unix(), Reason: reason}
+
+	var err error
+	if c.OldID, err = peer.IDFromPrivateKey(oldPriv); err != nil {
+		return nil, err
+	}
+	if c.NewID, err = peer.IDFromPrivateKey(newPriv); err != nil {
+		return nil, err
+	}
+	if c.OldID == c.NewID {
+		return nil, fmt.Errorf("%w: 新身份与旧身份相同", errs.ErrInvalidArgument)
+	}
+	if c.OldPubKey, err = crypto.MarshalPublicKey(oldPriv.GetPublic()); err != nil {
+		return nil, err
+	}
+	if c.NewPubKey, err = crypto.MarshalPublicKey(newPriv.GetPublic()); err != nil {
+		return nil, err
+	}
+
+	data, err := c.signingData()
+	if err != nil {
+		return nil, err
+	}
+	if c.OldSignature, err = oldPriv.Sign(data); err != nil {
+		return nil, err
+	}
+	if c.NewSignature, err = newPriv.Sign(data); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Verify 验证连续性记录的两个签名
+// 返回值：
+//   - error: 公钥与节点ID不符或签名无效时返回包装了 errs.ErrUnauthorized 的错误
+func (c *Continuity) Verify() error {
+	data, err := c.signingData()
+	if err != nil {
+		return err
+	}
+	for _, k := range []struct {
+		id        peer.ID
+		pubKey    []byte
+		signature []byte
+	}{
+		{c.OldID, c.OldPubKey, c.OldSignature},
+		{c.NewID, c.NewPubKey, c.NewSignature},
+	} {
+		pub, err := crypto.UnmarshalPublicKey(k.pubKey)
+		if err != nil {
+			return fmt.Errorf("%w: 无法解析节点 %s 的公钥: %v", errs.ErrUnauthorized, k.id, err)
+		}
+		if !k.id.MatchesPublicKey(pub) {
+			return fmt.Errorf("%w: 公钥与节点 %s 不符", errs.ErrUnauthorized, k.id)
+		}
+		if valid, err := pub.Verify(data, k.signature); err != nil || !valid {
+			return fmt.Errorf("%w: 节点 %s 的连续性签名无效", errs.ErrUnauthorized, k.id)
+		}
+	}
+	if c.OldID == c.NewID {
+		return fmt.Errorf("%w: 新身份与旧身份相同", errs.ErrUnauthorized)
+	}
+	return nil
+}
+
+// signingData 返回连续性记录中参与签名的字段
+// 与 util.MergeFieldsForSigning 的编码方式相同，opts 依赖本包，因此不能直接引用 util
+func (c *Continuity) signingData() ([]byte, error) {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	for _, field := range []interface{}{c.OldID.String(), c.NewID.String(), c.OldPubKey, c.NewPubKey, c.IssuedAt, c.Reason} {
+		if err := enc.Encode(field); err != nil {
+			return nil, err
+		}
+	}
+	return buffer.Bytes(), nil
+}
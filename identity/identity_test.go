@@ -0,0 +1,160 @@
+package identity
+
+import (
+	"crypto/rand"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/errs"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// newKey 生成一个节点私钥
+func newKey(t *testing.T) crypto.PrivKey {
+	t.Helper()
+	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv
+}
+
+func TestRotateVerify(t *testing.T) {
+	oldPriv := newKey(t)
+	newPriv, c, err := Rotate(oldPriv, "定期轮换")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldID, _ := peer.IDFromPrivateKey(oldPriv)
+	newID, _ := peer.IDFromPrivateKey(newPriv)
+	if c.OldID != oldID || c.NewID != newID || oldID == newID {
+		t.Fatalf("连续性记录的身份不符: %s -> %s", c.OldID, c.NewID)
+	}
+	if newPriv.Type() != oldPriv.Type() {
+		t.Fatalf("新密钥的类型应与旧密钥相同: %v", newPriv.Type())
+	}
+	if err := c.Verify(); err != nil {
+		t.Fatalf("验证连续性记录失败: %v", err)
+	}
+
+	// 篡改记录
+	tampered := *c
+	tampered.Reason = "篡改"
+	if err := tampered.Verify(); !errors.Is(err, errs.ErrUnauthorized) {
+		t.Fatalf("篡改的记录应被拒绝: %v", err)
+	}
+
+	// 冒用他人的新身份
+	other := newKey(t)
+	otherID, _ := peer.IDFromPrivateKey(other)
+	forged := *c
+	forged.NewID = otherID
+	if err := forged.Verify(); !errors.Is(err, errs.ErrUnauthorized) {
+		t.Fatalf("新身份与公钥不匹配的记录应被拒绝: %v", err)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	k1 := newKey(t)
+	k2, c1, err := Rotate(k1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	k3, c2, err := Rotate(k2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id1, _ := peer.IDFromPrivateKey(k1)
+	id3, _ := peer.IDFromPrivateKey(k3)
+
+	path := filepath.Join(t.TempDir(), "identities")
+	r := NewRegistry()
+	if err := r.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	var notified []*Continuity
+	r.OnRotate(func(c *Continuity) { notified = append(notified, c) })
+
+	for _, c := range []*Continuity{c1, c2} {
+		if added, err := r.Add(c); err != nil || !added {
+			t.Fatalf("添加连续性记录失败: %v, %v", added, err)
+		}
+	}
+	if added, err := r.Add(c1); err != nil || added {
+		t.Fatalf("重复的记录不应视为新记录: %v, %v", added, err)
+	}
+	if len(notified) != 2 {
+		t.Fatalf("应通知 2 条新记录，实际 %d", len(notified))
+	}
+
+	// 旧密钥泄露后签署的另一次轮换
+	_, conflict, err := Rotate(k1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Add(conflict); !errors.Is(err, errs.ErrUnauthorized) {
+		t.Fatalf("冲突的记录应被拒绝: %v", err)
+	}
+
+	if got := r.Resolve(id1); got != id3 {
+		t.Fatalf("应解析到最新身份 %s，实际 %s", id3, got)
+	}
+	if chain := r.Chain(id3); len(chain) != 2 || chain[0] != c1 || chain[1] != c2 {
+		t.Fatalf("身份链不符: %v", chain)
+	}
+
+	// 重新加载持久化的记录
+	reloaded := NewRegistry()
+	if err := reloaded.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.Resolve(id1); got != id3 {
+		t.Fatalf("重新加载后应解析到 %s，实际 %s", id3, got)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	oldPriv := newKey(t)
+	newPriv, c, err := Rotate(oldPriv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newID, _ := peer.IDFromPrivateKey(newPriv)
+	r := NewRegistry()
+	if _, err := r.Add(c); err != nil {
+		t.Fatal(err)
+	}
+
+	afe := afero.NewMemMapFs()
+	write := func(path, content string) {
+		if err := afe.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := afero.WriteFile(afe, path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldDir := filepath.Join("slices", c.OldID.String())
+	newDir := filepath.Join("slices", newID.String())
+	write(filepath.Join(oldDir, "file-1", "segment-1"), "old")
+	write(filepath.Join(oldDir, "file-2", "segment-1"), "old")
+	write(filepath.Join(newDir, "file-2", "segment-1"), "new")
+	write(filepath.Join(newDir, "file-2", "segment-2"), "new")
+
+	moved, err := Migrate(afe, r, newID, "slices", "downloads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != 1 {
+		t.Fatalf("应迁移 1 个条目，实际 %d", moved)
+	}
+	if data, _ := afero.ReadFile(afe, filepath.Join(newDir, "file-1", "segment-1")); string(data) != "old" {
+		t.Fatal("旧身份的文件片段未迁移")
+	}
+	if data, _ := afero.ReadFile(afe, filepath.Join(newDir, "file-2", "segment-1")); string(data) != "new" {
+		t.Fatal("新身份已有的文件片段被覆盖")
+	}
+}
@@ -0,0 +1,81 @@
+package identity
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+)
+
+// Migrate 节点以新身份启动后，将旧身份名下的本地目录并入新身份的目录
+// 文件片段与下载临时文件按节点ID分目录保存，轮换身份后需要迁移才能继续提供与使用
+// 参数：
+//   - afe: afero.Afero 文件系统接口
+//   - registry: *Registry 连续性记录
+//   - self: peer.ID 节点当前的身份
+//   - roots: ...string 按节点ID分目录的根目录，如切片目录与下载目录
+//
+// 返回值：
+//   - int: 迁移的条目数量
+//   - error: 迁移失败时返回错误，已迁移的条目保持迁移后的状态
+func Migrate(afe afero.Afero, registry *Registry, self peer.ID, roots ...string) (int, error) {
+	moved := 0
+	for _, c := range registry.Chain(self) {
+		for _, root := range roots {
+			n, err := mergeDir(afe, filepath.Join(root, c.OldID.String()), filepath.Join(root, self.String()))
+			moved += n
+			if err != nil {
+				return moved, err
+			}
+		}
+	}
+	if moved > 0 {
+		logrus.Infof("[%s]已将旧身份的 %d 个条目迁移到新身份 %s", debug.WhereAmI(), moved, self)
+	}
+	return moved, nil
+}
+
+// mergeDir 将 src 下的条目移动到 dst，dst 中已存在的同名条目保持不变，移动后删除空的 src
+func mergeDir(afe afero.Afero, src, dst string) (int, error) {
+	entries, err := afero.ReadDir(afe, src)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if err := afe.MkdirAll(dst, 0755); err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, entry := range entries {
+		from, to := filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())
+		exists, err := afero.Exists(afe, to)
+		if err != nil {
+			return moved, err
+		}
+		if !exists {
+			if err := afe.Rename(from, to); err != nil {
+				return moved, err
+			}
+			moved++
+			continue
+		}
+		if entry.IsDir() {
+			n, err := mergeDir(afe, from, to)
+			moved += n
+			if err != nil {
+				return moved, err
+			}
+		}
+	}
+
+	if rest, err := afero.ReadDir(afe, src); err == nil && len(rest) == 0 {
+		afe.Remove(src)
+	}
+	return moved, nil
+}
@@ -0,0 +1,219 @@
+package identity
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+)
+
+// maxChain 解析身份链的最大长度，防止环形记录导致死循环
+const maxChain = 64
+
+// RotationHandler 收到新的连续性记录时的回调
+type RotationHandler func(c *Continuity)
+
+// Registry 已验证的连续性记录，记录各节点从旧身份到新身份的延续关系
+// 零值不可用，通过 NewRegistry 创建；所有方法在 nil 接收者上均为空操作
+type Registry struct {
+	mu       sync.RWMutex
+	records  map[peer.ID]*Continuity // 旧身份到连续性记录的映射
+	path     string                  // 持久化文件路径，为空时不持久化
+	handlers []RotationHandler       // 收到新记录时的回调
+}
+
+// NewRegistry 创建一个空的连续性记录表
+func NewRegistry() *Registry {
+	return &Registry{records: make(map[peer.ID]*Continuity)}
+}
+
+// Open 设置持久化文件路径并加载已保存的记录，签名无效的记录被丢弃
+// 参数：
+//   - path: string 持久化文件路径
+//
+// 返回值：
+//   - error: 文件存在但解析失败时返回错误
+func (r *Registry) Open(path string) error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.path = path
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var records []*Continuity
+	if err := json.Unmarshal(data, &records); err != nil {
+		return err
+	}
+	for _, c := range records {
+		if err := c.Verify(); err != nil {
+			logrus.Warnf("[%s]丢弃无效的连续性记录: %v", debug.WhereAmI(), err)
+			continue
+		}
+		if _, ok := r.records[c.OldID]; !ok {
+			r.records[c.OldID] = c
+		}
+	}
+	return nil
+}
+
+// Add 验证并保存连续性记录，通知所有回调
+// 同一旧身份只接受最先收到的记录：旧密钥泄露后，攻击者签署的后续轮换不能覆盖所有者已发布的轮换
+// 参数：
+//   - c: *Continuity 连续性记录
+//
+// 返回值：
+//   - bool: 是否为新记录
+//   - error: 记录无效、与已有记录冲突或保存失败时返回错误
+func (r *Registry) Add(c *Continuity) (bool, error) {
+	if r == nil || c == nil {
+		return false, nil
+	}
+	if err := c.Verify(); err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	if existing, ok := r.records[c.OldID]; ok {
+		r.mu.Unlock()
+		if existing.NewID == c.NewID {
+			return false, nil
+		}
+		return false, fmt.Errorf("%w: 节点 %s 已轮换到 %s，拒绝轮换到 %s", errs.ErrUnauthorized, c.OldID, existing.NewID, c.NewID)
+	}
+	r.records[c.OldID] = c
+	handlers := append([]RotationHandler(nil), r.handlers...)
+	r.mu.Unlock()
+
+	// 未能持久化的记录不生效，避免重启后丢失已经对外宣告的轮换
+	if err := r.save(); err != nil {
+		r.mu.Lock()
+		if r.records[c.OldID] == c {
+			delete(r.records, c.OldID)
+		}
+		r.mu.Unlock()
+		return false, err
+	}
+	for _, handler := range handlers {
+		handler(c)
+	}
+	return true, nil
+}
+
+// Successor 获取旧身份直接轮换到的新身份
+func (r *Registry) Successor(id peer.ID) (peer.ID, bool) {
+	if r == nil {
+		return "", false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.records[id]
+	if !ok {
+		return "", false
+	}
+	return c.NewID, true
+}
+
+// Resolve 沿连续性记录获取节点当前的身份，未轮换的节点返回自身
+func (r *Registry) Resolve(id peer.ID) peer.ID {
+	if r == nil {
+		return id
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for i := 0; i < maxChain; i++ {
+		c, ok := r.records[id]
+		if !ok {
+			break
+		}
+		id = c.NewID
+	}
+	return id
+}
+
+// Chain 获取最终轮换到指定身份的全部连续性记录，按从旧到新的顺序排列
+func (r *Registry) Chain(id peer.ID) []*Continuity {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	byNew := make(map[peer.ID]*Continuity, len(r.records))
+	for _, c := range r.records {
+		byNew[c.NewID] = c
+	}
+	var chain []*Continuity
+	for i := 0; i < maxChain; i++ {
+		c, ok := byNew[id]
+		if !ok {
+			break
+		}
+		chain = append([]*Continuity{c}, chain...)
+		id = c.OldID
+	}
+	return chain
+}
+
+// All 获取全部连续性记录
+func (r *Registry) All() []*Continuity {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	records := make([]*Continuity, 0, len(r.records))
+	for _, c := range r.records {
+		records = append(records, c)
+	}
+	return records
+}
+
+// OnRotate 注册收到新的连续性记录时的回调
+func (r *Registry) OnRotate(handler RotationHandler) {
+	if r == nil || handler == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers = append(r.handlers, handler)
+}
+
+// save 将记录保存到持久化文件
+// 返回值：
+//   - error: 写入失败时返回错误
+func (r *Registry) save() error {
+	r.mu.RLock()
+	path := r.path
+	if path == "" {
+		r.mu.RUnlock()
+		return nil
+	}
+	records := make([]*Continuity, 0, len(r.records))
+	for _, c := range r.records {
+		records = append(records, c)
+	}
+	data, err := json.Marshal(records)
+	r.mu.RUnlock()
+	if err != nil {
+		logrus.Errorf("[%s]序列化连续性记录失败: %v", debug.WhereAmI(), err)
+		return err
+	}
+
+	return afero.WriteFileAtomic(afero.NewOsFs(), path, data, 0644)
+}
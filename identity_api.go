@@ -0,0 +1,29 @@
+package defs
+
+import (
+	"github.com/bpfs/defs/identity"
+	"github.com/libp2p/go-libp2p/core/crypto"
+)
+
+// RotateIdentity 轮换本节点的身份，签署并广播连续性记录
+// 新身份在使用返回的私钥重新创建网络主机并重新打开文件存储后生效，旧身份下的文件片段会在打开时迁移
+// 参数：
+//   - reason: string 轮换原因，如定期轮换或密钥泄露
+//
+// 返回值：
+//   - crypto.PrivKey: 新的节点私钥，调用方需妥善保存
+//   - *identity.Continuity: 连续性记录
+//   - error: 如果发生错误，返回错误信息
+func (fs *FS) RotateIdentity(reason string) (crypto.PrivKey, *identity.Continuity, error) {
+	return fs.rotation.Rotate(reason)
+}
+
+// IdentityChain 获取本节点的身份链，按从旧到新的顺序排列
+func (fs *FS) IdentityChain() []*identity.Continuity {
+	return fs.rotation.Chain()
+}
+
+// Identities 获取已知的全部节点身份连续性记录
+func (fs *FS) Identities() []*identity.Continuity {
+	return fs.opt.GetIdentities().All()
+}
@@ -0,0 +1,150 @@
+package index
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/bpfs/defs/errs"
+)
+
+// Change 描述同一所有者对一个文件的一组元数据与名称变更
+// 重命名或移动文件时，元数据记录、新名称与释放的旧名称作为一个整体发布，
+// 索引节点要么全部采纳，要么全部拒绝，并作为一条复制消息传播，不会出现只有部分记录生效的中间状态
+type Change struct {
+	FileID string        // 文件唯一标识
+	Record *IndexRecord  // 更新后的元数据记录，为空表示元数据不变
+	Names  []*NameRecord // 更新的名称记录，包括指向文件的新名称以及释放的旧名称
+}
+
+// ChangeHandler 处理已采纳的变更的回调，每个变更只通知一次
+type ChangeHandler func(change *Change)
+
+// Verify 验证变更中所有记录的签名，以及记录是否属于同一所有者和同一文件
+// 返回值：
+//   - error: 验证失败时返回错误信息
+func (c *Change) Verify() error {
+	if c.FileID == "" {
+		return fmt.Errorf("%w: 文件唯一标识不能为空", errs.ErrInvalidArgument)
+	}
+	if c.Record == nil && len(c.Names) == 0 {
+		return fmt.Errorf("%w: 变更不包含任何记录", errs.ErrInvalidArgument)
+	}
+
+	owner := ""
+	if c.Record != nil {
+		if c.Record.FileID != c.FileID {
+			return fmt.Errorf("元数据记录的文件 %s 与变更的文件 %s 不一致", c.Record.FileID, c.FileID)
+		}
+		if err := c.Record.Verify(); err != nil {
+			return err
+		}
+		owner = c.Record.Owner
+	}
+
+	seen := make(map[string]bool, len(c.Names))
+	for _, name := range c.Names {
+		if name == nil {
+			return fmt.Errorf("%w: 名称记录为空", errs.ErrInvalidArgument)
+		}
+		if !name.Released() && name.FileID != c.FileID {
+			return fmt.Errorf("名称 %s 指向的文件 %s 与变更的文件 %s 不一致", name.Name(), name.FileID, c.FileID)
+		}
+		if seen[name.Name()] {
+			return fmt.Errorf("名称 %s 在变更中重复出现", name.Name())
+		}
+		seen[name.Name()] = true
+
+		if err := name.Verify(); err != nil {
+			return err
+		}
+		if owner == "" {
+			owner = name.Owner
+		} else if name.Owner != owner {
+			return fmt.Errorf("变更中的记录不属于同一所有者")
+		}
+	}
+	return nil
+}
+
+// ApplyChange 合并一组已验证的变更
+// 参数：
+//   - change: *Change 变更
+//
+// 返回值：
+//   - bool: 所有记录都被采纳返回 true；任意一条记录被拒绝时不修改任何记录并返回 false
+func (s *IndexStore) ApplyChange(change *Change) bool {
+	s.Mu.Lock()
+	accepted := s.acceptsChange(change)
+	if accepted {
+		if change.Record != nil {
+			s.put(change.Record)
+		}
+		for _, name := range change.Names {
+			s.putName(name)
+		}
+	}
+	handlers := append([]ChangeHandler(nil), s.changeHandlers...)
+	s.Mu.Unlock()
+
+	if accepted {
+		s.SaveToFileSingleChan()
+		for _, handler := range handlers {
+			handler(change)
+		}
+	}
+	return accepted
+}
+
+// OnChange 注册变更的处理回调，变更被整体采纳后调用
+func (s *IndexStore) OnChange(handler ChangeHandler) {
+	if handler == nil {
+		return
+	}
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	s.changeHandlers = append(s.changeHandlers, handler)
+}
+
+// acceptsChange 在持有锁的情况下检查变更中的每条记录是否都会被采纳，不修改任何状态
+func (s *IndexStore) acceptsChange(change *Change) bool {
+	if record := change.Record; record != nil {
+		if existing, ok := s.Records[record.FileID]; ok {
+			if existing.Owner != record.Owner || !record.newerThan(existing) {
+				return false
+			}
+		}
+	}
+	for _, name := range change.Names {
+		if !name.ownNamespace() {
+			if claim, ok := s.namespaces[name.Namespace]; ok && claim.Owner != name.Owner {
+				return false
+			}
+		}
+		if existing, ok := s.Names[name.Name()]; ok {
+			if existing.Owner != name.Owner || !name.newerThan(existing) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// NamesOf 返回指向文件的所有名称记录，不包括已释放的名称
+// 参数：
+//   - fileID: string 文件唯一标识
+//
+// 返回值：
+//   - []*NameRecord: 指向文件的名称记录，按名称排列
+func (s *IndexStore) NamesOf(fileID string) []*NameRecord {
+	s.Mu.RLock()
+	defer s.Mu.RUnlock()
+
+	var result []*NameRecord
+	for _, record := range s.Names {
+		if record.FileID == fileID && !record.Released() {
+			result = append(result, record)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name() < result[j].Name() })
+	return result
+}
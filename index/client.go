@@ -0,0 +1,230 @@
+package index
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/network"
+	"github.com/bpfs/defs/util"
+	"github.com/bpfs/dep2p"
+	"github.com/bpfs/dep2p/streams"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+)
+
+// Publish 向索引节点发布一条元数据记录
+// 参数：
+//   - p2p: *dep2p.DeP2P 网络主机
+//   - indexPeer: peer.ID 索引节点
+//   - record: *IndexRecord 签名后的元数据记录
+//
+// 返回值：
+//   - error: 如果发生错误，返回错误信息
+func Publish(p2p *dep2p.DeP2P, indexPeer peer.ID, record *IndexRecord) error {
+	return PublishContext(p2p.Context(), p2p, indexPeer, record)
+}
+
+// PublishContext 向索引节点发布一条元数据记录，ctx 结束时中止请求
+func PublishContext(ctx context.Context, p2p *dep2p.DeP2P, indexPeer peer.ID, record *IndexRecord) error {
+	res, err := network.SendStreamContext(ctx, p2p, StreamIndexPublishProtocol, "", indexPeer, record)
+	if err := checkResponse(indexPeer, StreamIndexPublishProtocol, res, err); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Search 向索引节点搜索元数据记录
+// 参数：
+//   - p2p: *dep2p.DeP2P 网络主机
+//   - indexPeer: peer.ID 索引节点
+//   - query: *Query 搜索条件
+//
+// 返回值：
+//   - []*IndexRecord: 满足条件且签名有效的元数据记录
+//   - error: 如果发生错误，返回错误信息
+func Search(p2p *dep2p.DeP2P, indexPeer peer.ID, query *Query) ([]*IndexRecord, error) {
+	return SearchContext(p2p.Context(), p2p, indexPeer, query)
+}
+
+// SearchContext 向索引节点搜索元数据记录，ctx 结束时中止请求
+func SearchContext(ctx context.Context, p2p *dep2p.DeP2P, indexPeer peer.ID, query *Query) ([]*IndexRecord, error) {
+	records, err := requestRecords(ctx, p2p, StreamIndexSearchProtocol, indexPeer, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// 不信任索引节点，逐条验证签名
+	verified := records[:0]
+	for _, record := range records {
+		if err := record.Verify(); err != nil {
+			logrus.Warnf("[%s]索引节点返回了无效的记录 %s: %v", debug.WhereAmI(), record.FileID, err)
+			continue
+		}
+		verified = append(verified, record)
+	}
+	return verified, nil
+}
+
+// requestRecords 向索引节点发送请求并解码返回的记录
+func requestRecords(ctx context.Context, p2p *dep2p.DeP2P, protocol string, receiver peer.ID, data interface{}) ([]*IndexRecord, error) {
+	res, err := network.SendStreamContext(ctx, p2p, protocol, "", receiver, data)
+	if err := checkResponse(receiver, protocol, res, err); err != nil {
+		return nil, err
+	}
+
+	var records []*IndexRecord
+	if len(res.Data) == 0 {
+		return records, nil
+	}
+	if err := util.DecodeFromBytes(res.Data, &records); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return nil, err
+	}
+	return records, nil
+}
+
+// PublishName 向索引节点发布一条名称记录
+// 参数：
+//   - p2p: *dep2p.DeP2P 网络主机
+//   - indexPeer: peer.ID 索引节点
+//   - record: *NameRecord 签名后的名称记录
+//
+// 返回值：
+//   - error: 如果发生错误，返回错误信息
+func PublishName(p2p *dep2p.DeP2P, indexPeer peer.ID, record *NameRecord) error {
+	return PublishNameContext(p2p.Context(), p2p, indexPeer, record)
+}
+
+// PublishNameContext 向索引节点发布一条名称记录，ctx 结束时中止请求
+func PublishNameContext(ctx context.Context, p2p *dep2p.DeP2P, indexPeer peer.ID, record *NameRecord) error {
+	res, err := network.SendStreamContext(ctx, p2p, StreamNamePublishProtocol, "", indexPeer, record)
+	if err := checkResponse(indexPeer, StreamNamePublishProtocol, res, err); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ResolveName 向索引节点解析名称
+// 参数：
+//   - p2p: *dep2p.DeP2P 网络主机
+//   - indexPeer: peer.ID 索引节点
+//   - name: string "命名空间/路径"形式的名称
+//
+// 返回值：
+//   - *NameRecord: 签名有效的名称记录，名称已释放时 FileID 为空
+//   - error: 名称不存在或记录无效时返回错误
+func ResolveName(p2p *dep2p.DeP2P, indexPeer peer.ID, name string) (*NameRecord, error) {
+	return ResolveNameContext(p2p.Context(), p2p, indexPeer, name)
+}
+
+// ResolveNameContext 向索引节点解析名称，ctx 结束时中止请求
+func ResolveNameContext(ctx context.Context, p2p *dep2p.DeP2P, indexPeer peer.ID, name string) (*NameRecord, error) {
+	if _, _, err := ParseName(name); err != nil {
+		return nil, err
+	}
+
+	res, err := network.SendStreamContext(ctx, p2p, StreamNameResolveProtocol, "", indexPeer, ResolveNameReq{Name: name})
+	if err := checkResponse(indexPeer, StreamNameResolveProtocol, res, err); err != nil {
+		if res != nil && res.Code == 404 {
+			return nil, fmt.Errorf("%w: 名称 %s: %w", errs.ErrNotFound, name, err)
+		}
+		return nil, err
+	}
+
+	record := new(NameRecord)
+	if err := util.DecodeFromBytes(res.Data, record); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return nil, err
+	}
+
+	// 不信任索引节点，验证签名及名称是否一致
+	if err := record.Verify(); err != nil {
+		return nil, err
+	}
+	if record.Name() != name {
+		return nil, fmt.Errorf("%w: 索引节点返回的名称 %s 与请求的名称 %s 不一致", errs.ErrUnauthorized, record.Name(), name)
+	}
+	return record, nil
+}
+
+// NamesOf 向索引节点查询指向文件的名称
+// 参数：
+//   - p2p: *dep2p.DeP2P 网络主机
+//   - indexPeer: peer.ID 索引节点
+//   - fileID: string 文件唯一标识
+//
+// 返回值：
+//   - []*NameRecord: 指向文件且签名有效的名称记录
+//   - error: 如果发生错误，返回错误信息
+func NamesOf(p2p *dep2p.DeP2P, indexPeer peer.ID, fileID string) ([]*NameRecord, error) {
+	return NamesOfContext(p2p.Context(), p2p, indexPeer, fileID)
+}
+
+// NamesOfContext 向索引节点查询指向文件的名称，ctx 结束时中止请求
+func NamesOfContext(ctx context.Context, p2p *dep2p.DeP2P, indexPeer peer.ID, fileID string) ([]*NameRecord, error) {
+	res, err := network.SendStreamContext(ctx, p2p, StreamNameLookupProtocol, "", indexPeer, NameLookupReq{FileID: fileID})
+	if err := checkResponse(indexPeer, StreamNameLookupProtocol, res, err); err != nil {
+		return nil, err
+	}
+
+	var records []*NameRecord
+	if len(res.Data) == 0 {
+		return records, nil
+	}
+	if err := util.DecodeFromBytes(res.Data, &records); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return nil, err
+	}
+
+	// 不信任索引节点，逐条验证签名及指向的文件
+	verified := records[:0]
+	for _, record := range records {
+		if record.FileID != fileID {
+			continue
+		}
+		if err := record.Verify(); err != nil {
+			logrus.Warnf("[%s]索引节点返回了无效的名称 %s: %v", debug.WhereAmI(), record.Name(), err)
+			continue
+		}
+		verified = append(verified, record)
+	}
+	return verified, nil
+}
+
+// PublishChange 向索引节点整体发布一组元数据与名称变更
+// 参数：
+//   - p2p: *dep2p.DeP2P 网络主机
+//   - indexPeer: peer.ID 索引节点
+//   - change: *Change 签名后的变更
+//
+// 返回值：
+//   - error: 如果发生错误，返回错误信息
+func PublishChange(p2p *dep2p.DeP2P, indexPeer peer.ID, change *Change) error {
+	return PublishChangeContext(p2p.Context(), p2p, indexPeer, change)
+}
+
+// PublishChangeContext 向索引节点整体发布一组元数据与名称变更，ctx 结束时中止请求
+func PublishChangeContext(ctx context.Context, p2p *dep2p.DeP2P, indexPeer peer.ID, change *Change) error {
+	res, err := network.SendStreamContext(ctx, p2p, StreamIndexChangeProtocol, "", indexPeer, change)
+	if err := checkResponse(indexPeer, StreamIndexChangeProtocol, res, err); err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkResponse 将发送失败或索引节点的错误响应转换为节点错误
+func checkResponse(receiver peer.ID, protocol string, res *streams.ResponseMessage, err error) error {
+	if err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return errs.Unreachable(receiver, protocol, err)
+	}
+	if res == nil {
+		return errs.Unreachable(receiver, protocol, nil)
+	}
+	if res.Code != 200 {
+		return errs.Rejected(receiver, protocol, res.Code, res.Msg)
+	}
+	return nil
+}
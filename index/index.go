@@ -0,0 +1,97 @@
+// Package index 实现了文件元数据的分布式索引服务。
+// 指定的索引节点接收经过签名的文件元数据记录，在索引节点之间相互复制并最终达成一致，
+// 并通过专用协议响应按文件名、标签、所有者的搜索请求。
+package index
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	version = "1.0.0" // 索引协议版本
+
+	defaultSearchLimit = 100  // 搜索结果的默认最大数量
+	maxSearchLimit     = 1000 // 搜索结果的最大数量上限
+)
+
+var (
+	// 发布元数据记录
+	StreamIndexPublishProtocol = fmt.Sprintf("defs@stream/index/publish/%s", version)
+
+	// 搜索元数据记录
+	StreamIndexSearchProtocol = fmt.Sprintf("defs@stream/index/search/%s", version)
+
+	// 索引节点之间同步元数据记录
+	StreamIndexSyncProtocol = fmt.Sprintf("defs@stream/index/sync/%s", version)
+
+	// 发布名称记录
+	StreamNamePublishProtocol = fmt.Sprintf("defs@stream/index/name/publish/%s", version)
+
+	// 解析名称
+	StreamNameResolveProtocol = fmt.Sprintf("defs@stream/index/name/resolve/%s", version)
+
+	// 索引节点之间同步名称记录
+	StreamNameSyncProtocol = fmt.Sprintf("defs@stream/index/name/sync/%s", version)
+
+	// 查询指向文件的名称
+	StreamNameLookupProtocol = fmt.Sprintf("defs@stream/index/name/lookup/%s", version)
+
+	// 整体发布元数据与名称的变更
+	StreamIndexChangeProtocol = fmt.Sprintf("defs@stream/index/change/%s", version)
+
+	// 索引节点之间复制元数据记录
+	PubSubIndexReplicateTopic = fmt.Sprintf("defs@pubsub/index/replicate/%s", version)
+)
+
+// Query 描述搜索元数据记录的条件
+// 多个条件之间为"与"的关系，空条件表示不限制
+type Query struct {
+	FileID string // 文件唯一标识(精确匹配)
+	Name   string // 文件名关键字(不区分大小写的子串匹配)
+	Label  string // 标签(精确匹配)
+	Owner  string // 所有者公钥哈希的十六进制字符串
+	Limit  int    // 返回结果的最大数量
+}
+
+// Match 检查元数据记录是否满足搜索条件
+// 参数：
+//   - record: *IndexRecord 元数据记录
+//
+// 返回值：
+//   - bool: 满足条件返回 true，否则返回 false
+func (q *Query) Match(record *IndexRecord) bool {
+	if q.FileID != "" && q.FileID != record.FileID {
+		return false
+	}
+	if q.Name != "" && !strings.Contains(strings.ToLower(record.Name), strings.ToLower(q.Name)) {
+		return false
+	}
+	if q.Owner != "" && !strings.EqualFold(q.Owner, record.Owner) {
+		return false
+	}
+	if q.Label != "" {
+		found := false
+		for _, label := range record.Labels {
+			if label == q.Label {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// limit 返回规范化后的结果数量上限
+func (q *Query) limit() int {
+	if q.Limit <= 0 {
+		return defaultSearchLimit
+	}
+	if q.Limit > maxSearchLimit {
+		return maxSearchLimit
+	}
+	return q.Limit
+}
@@ -0,0 +1,290 @@
+package index
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	sign "github.com/bpfs/defs/sign/ecdsa"
+	"github.com/bpfs/defs/util"
+)
+
+func TestIndexRecordMerge(t *testing.T) {
+	owner, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := NewIndexRecord(owner, "file-1", "Report.pdf", 1024, "application/pdf", "work")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 经过网络编码后签名仍然有效
+	data, err := util.EncodeToBytes(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := new(IndexRecord)
+	if err := util.DecodeFromBytes(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.Verify(); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	// 篡改内容后签名失效
+	decoded.Name = "Other.pdf"
+	if err := decoded.Verify(); err == nil {
+		t.Fatal("Verify accepted a tampered record")
+	}
+
+	// 时间戳超前本地时钟的记录即使签名有效也被拒绝
+	future := *record
+	future.UpdatedAt = time.Now().Add(time.Hour).UnixNano()
+	signing, err := future.signingData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if future.Signature, err = sign.SignData(owner, signing); err != nil {
+		t.Fatal(err)
+	}
+	if err := future.Verify(); err == nil {
+		t.Fatal("Verify accepted a record dated in the future")
+	}
+
+	store := &IndexStore{Records: make(map[string]*IndexRecord), SaveToFile: make(chan struct{}, 1)}
+	if !store.Put(record) {
+		t.Fatal("Put rejected the first record")
+	}
+
+	// 其他用户无法覆盖记录
+	hijack, err := NewIndexRecord(other, "file-1", "Evil.pdf", 1, "application/pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Put(hijack) {
+		t.Fatal("Put accepted a record from another owner")
+	}
+
+	// 所有者的新记录覆盖旧记录，旧记录不会回滚
+	update, err := NewIndexRecord(owner, "file-1", "Report-v2.pdf", 2048, "application/pdf", "work", "final")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store.Put(update) || store.Put(record) {
+		t.Fatal("last writer did not win")
+	}
+
+	if got := store.Search(&Query{Name: "report", Label: "final"}); len(got) != 1 || got[0] != update {
+		t.Fatalf("Search = %v", got)
+	}
+	if got := store.Search(&Query{Owner: hijack.Owner}); len(got) != 0 {
+		t.Fatalf("Search by other owner = %v", got)
+	}
+}
+
+func TestNameRecordPut(t *testing.T) {
+	owner, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"", "alice", "/photos", "alice/", "alice/my photos"} {
+		if _, _, err := ParseName(name); err == nil {
+			t.Fatalf("ParseName accepted %q", name)
+		}
+	}
+
+	record, err := NewNameRecord(owner, "alice/photos", "file-1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := record.Verify(); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	// 篡改指向的文件后签名失效
+	tampered := *record
+	tampered.FileID = "file-2"
+	if err := tampered.Verify(); err == nil {
+		t.Fatal("Verify accepted a tampered record")
+	}
+
+	store := &IndexStore{
+		Names:      make(map[string]*NameRecord),
+		namespaces: make(map[string]*namespaceClaim),
+		SaveToFile: make(chan struct{}, 1),
+	}
+	if !store.PutName(record) {
+		t.Fatal("PutName rejected the first record")
+	}
+
+	// 命名空间已被声明，其他用户无法在其中发布名称
+	squat, err := NewNameRecord(other, "alice/docs", "file-3", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.PutName(squat) {
+		t.Fatal("PutName accepted a name in a namespace claimed by another owner")
+	}
+	// 提前时间戳不能夺取已声明的命名空间
+	squat.UpdatedAt = record.UpdatedAt - 1
+	if store.PutName(squat) {
+		t.Fatal("PutName let a backdated record take over a claimed namespace")
+	}
+
+	// 所有者更新名称，旧版本不会回滚
+	update, err := NewNameRecord(owner, "alice/photos", "file-2", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store.PutName(update) || store.PutName(record) {
+		t.Fatal("newer version did not win")
+	}
+	if got, ok := store.ResolveName("alice/photos"); !ok || got.FileID != "file-2" {
+		t.Fatalf("ResolveName = %v, %v", got, ok)
+	}
+
+	// 以公钥哈希为命名空间时始终归所有者所有
+	own, err := NewNameRecord(other, squat.Owner+"/docs", "file-3", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store.PutName(own) {
+		t.Fatal("PutName rejected a name in the owner's own namespace")
+	}
+
+	// 同步按本节点采纳的顺序进行，之后采纳的记录即使时间戳更早也会返回
+	late, err := NewNameRecord(other, squat.Owner+"/late", "file-4", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	late.UpdatedAt = record.UpdatedAt - 1
+	if !store.PutName(late) {
+		t.Fatal("PutName rejected a new name")
+	}
+	if got, seq := store.NamesSince(1); len(got) != 3 || seq != 4 {
+		t.Fatalf("NamesSince = %v, %d", got, seq)
+	}
+}
+
+func TestApplyChange(t *testing.T) {
+	owner, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &IndexStore{
+		Records:    make(map[string]*IndexRecord),
+		Names:      make(map[string]*NameRecord),
+		namespaces: make(map[string]*namespaceClaim),
+		SaveToFile: make(chan struct{}, 1),
+	}
+	record, err := NewIndexRecord(owner, "file-1", "a.txt", 10, "text/plain", "work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := NewNameRecord(owner, "alice/a.txt", "file-1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	taken, err := NewNameRecord(other, "bob/b.txt", "file-2", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store.Put(record) || !store.PutName(name) || !store.PutName(taken) {
+		t.Fatal("failed to seed the store")
+	}
+
+	// 重命名：元数据、新名称与释放的旧名称一起生效
+	renamed, err := NewIndexRecord(owner, "file-1", "b.txt", 10, "text/plain", "work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newName, err := NewNameRecord(owner, "alice/b.txt", "file-1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	released, err := NewNameRecord(owner, "alice/a.txt", "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	change := &Change{FileID: "file-1", Record: renamed, Names: []*NameRecord{newName, released}}
+
+	// 经过网络编码后签名仍然有效
+	data, err := util.EncodeToBytes(change)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := new(Change)
+	if err := util.DecodeFromBytes(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.Verify(); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	var events []*Change
+	store.OnChange(func(c *Change) { events = append(events, c) })
+	if !store.ApplyChange(decoded) {
+		t.Fatal("ApplyChange rejected a valid change")
+	}
+	// 重复收到同一变更时不会再次通知
+	if store.ApplyChange(decoded) || len(events) != 1 {
+		t.Fatalf("change events = %d, want 1", len(events))
+	}
+	if got := store.Records["file-1"]; got.Name != "b.txt" {
+		t.Fatalf("record name = %q", got.Name)
+	}
+	if names := store.NamesOf("file-1"); len(names) != 1 || names[0].Name() != "alice/b.txt" {
+		t.Fatalf("NamesOf = %v", names)
+	}
+	if got, ok := store.ResolveName("alice/a.txt"); !ok || !got.Released() {
+		t.Fatalf("old name not released: %v, %v", got, ok)
+	}
+
+	// 任意一条记录被拒绝时整个变更都不生效
+	moved, err := NewIndexRecord(owner, "file-1", "c.txt", 10, "text/plain", "work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	squat, err := NewNameRecord(owner, "bob/b.txt", "file-1", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.ApplyChange(&Change{FileID: "file-1", Record: moved, Names: []*NameRecord{squat}}) {
+		t.Fatal("ApplyChange accepted a name in a namespace claimed by another owner")
+	}
+	if got := store.Records["file-1"]; got.Name != "b.txt" {
+		t.Fatalf("rejected change modified the record: %q", got.Name)
+	}
+	if len(events) != 1 {
+		t.Fatal("rejected change emitted an event")
+	}
+
+	// 变更中的记录必须属于同一所有者并指向同一文件
+	foreign, err := NewNameRecord(other, "bob/c.txt", "file-1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Change{FileID: "file-1", Record: moved, Names: []*NameRecord{foreign}}).Verify(); err == nil {
+		t.Fatal("Verify accepted records from different owners")
+	}
+	if err := (&Change{FileID: "file-2", Names: []*NameRecord{newName}}).Verify(); err == nil {
+		t.Fatal("Verify accepted a name pointing to another file")
+	}
+}
@@ -0,0 +1,186 @@
+package index
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bpfs/defs/debug"
+	sign "github.com/bpfs/defs/sign/ecdsa"
+	"github.com/bpfs/defs/util"
+	"github.com/bpfs/defs/wallets"
+	"github.com/sirupsen/logrus"
+)
+
+// maxNameLength 名称的最大长度
+const maxNameLength = 256
+
+// maxClockSkew 允许元数据与名称记录时间戳超前本地时钟的最大时长
+const maxClockSkew = 5 * time.Minute
+
+// NameRecord 描述一条经过所有者签名的名称映射，将"命名空间/路径"形式的名称解析为文件唯一标识
+// 命名空间可以是所有者公钥哈希的十六进制字符串(始终属于该所有者)，也可以是别名(先声明者获得)
+type NameRecord struct {
+	Namespace string // 命名空间，如 "alice"
+	Path      string // 命名空间内的路径，如 "photos-2024"
+	FileID    string // 名称指向的文件唯一标识，为空表示名称已被所有者释放
+	Owner     string // 所有者公钥哈希的十六进制字符串
+	PublicKey []byte // 所有者公钥
+	Version   uint64 // 名称映射的版本号，每次更新递增
+	UpdatedAt int64  // 记录更新的时间戳(纳秒)
+	Signature []byte // 所有者对记录的签名
+}
+
+// ParseName 将名称拆分为命名空间和路径
+// 参数：
+//   - name: string "命名空间/路径"形式的名称
+//
+// 返回值：
+//   - string: 命名空间
+//   - string: 路径
+//   - error: 名称格式无效时返回错误
+func ParseName(name string) (string, string, error) {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 || len(name) > maxNameLength {
+		return "", "", fmt.Errorf("名称长度无效: %q", name)
+	}
+	namespace, path, ok := strings.Cut(name, "/")
+	if !ok || namespace == "" || path == "" {
+		return "", "", fmt.Errorf("名称必须为\"命名空间/路径\"的形式: %q", name)
+	}
+	if strings.ContainsAny(name, " \t\r\n") {
+		return "", "", fmt.Errorf("名称不能包含空白字符: %q", name)
+	}
+	return namespace, path, nil
+}
+
+// NewNameRecord 创建并签名一条新的名称记录
+// 参数：
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥
+//   - name: string "命名空间/路径"形式的名称
+//   - fileID: string 名称指向的文件唯一标识，为空时释放名称
+//   - version: uint64 名称映射的版本号，必须大于已发布的版本
+//
+// 返回值：
+//   - *NameRecord: 签名后的名称记录
+//   - error: 如果发生错误，返回错误信息
+func NewNameRecord(ownerPriv *ecdsa.PrivateKey, name, fileID string, version uint64) (*NameRecord, error) {
+	if ownerPriv == nil {
+		return nil, fmt.Errorf("所有者私钥不能为空")
+	}
+	namespace, path, err := ParseName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// 提取所有者公钥
+	publicKey, err := wallets.MarshalPublicKey(ownerPriv.PublicKey)
+	if err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return nil, err
+	}
+
+	// 通过私钥生成公钥哈希
+	pubKeyHash, ok := wallets.PrivateKeyToPublicKeyHash(ownerPriv)
+	if !ok {
+		return nil, fmt.Errorf("通过私钥生成公钥哈希时失败")
+	}
+
+	record := &NameRecord{
+		Namespace: namespace,
+		Path:      path,
+		FileID:    fileID,
+		Owner:     hex.EncodeToString(pubKeyHash),
+		PublicKey: publicKey,
+		Version:   version,
+		UpdatedAt: time.Now().UnixNano(),
+	}
+
+	// 待签名数据
+	data, err := record.signingData()
+	if err != nil {
+		return nil, err
+	}
+
+	// 使用所有者私钥签名
+	record.Signature, err = sign.SignData(ownerPriv, data)
+	if err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// Name 获取记录的完整名称
+func (r *NameRecord) Name() string {
+	return r.Namespace + "/" + r.Path
+}
+
+// Verify 验证名称记录的签名及所有者
+// 返回值：
+//   - error: 验证失败时返回错误信息
+func (r *NameRecord) Verify() error {
+	if _, _, err := ParseName(r.Name()); err != nil {
+		return err
+	}
+	if r.UpdatedAt > time.Now().Add(maxClockSkew).UnixNano() {
+		return fmt.Errorf("名称记录的时间戳超前")
+	}
+
+	publicKey, err := wallets.UnmarshalPublicKey(r.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	// 所有者必须与公钥一致
+	pubKeyHash, ok := wallets.PublicKeyToPublicKeyHash(publicKey)
+	if !ok || hex.EncodeToString(pubKeyHash) != r.Owner {
+		return fmt.Errorf("记录所有者与公钥不匹配")
+	}
+
+	data, err := r.signingData()
+	if err != nil {
+		return err
+	}
+
+	valid, err := sign.VerifySignature(&publicKey, data, r.Signature)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return fmt.Errorf("名称记录签名无效")
+	}
+
+	return nil
+}
+
+// Released 检查名称是否已被所有者释放
+// 释放后的记录仍然保留，使名称的版本号继续递增，旧的映射不会被复制回来
+func (r *NameRecord) Released() bool {
+	return r.FileID == ""
+}
+
+// ownNamespace 检查命名空间是否为所有者公钥哈希，这样的命名空间始终属于该所有者
+func (r *NameRecord) ownNamespace() bool {
+	return r.Namespace == r.Owner
+}
+
+// newerThan 检查记录是否比另一条记录更新
+// 先比较版本号，版本号相同时比较时间戳，再按签名字节序比较，保证所有索引节点得到相同的结果
+func (r *NameRecord) newerThan(other *NameRecord) bool {
+	if r.Version != other.Version {
+		return r.Version > other.Version
+	}
+	if r.UpdatedAt != other.UpdatedAt {
+		return r.UpdatedAt > other.UpdatedAt
+	}
+	return string(r.Signature) > string(other.Signature)
+}
+
+// signingData 返回记录中参与签名的字段
+func (r *NameRecord) signingData() ([]byte, error) {
+	return util.MergeFieldsForSigning(r.Namespace, r.Path, r.FileID, r.Owner, r.PublicKey, r.Version, r.UpdatedAt)
+}
@@ -0,0 +1,152 @@
+package index
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/util"
+	"github.com/sirupsen/logrus"
+)
+
+// namespaceClaim 别名命名空间的归属
+// 别名由本节点最先收到的声明者获得
+type namespaceClaim struct {
+	Owner     string // 所有者公钥哈希的十六进制字符串
+	ClaimedAt int64  // 本节点收到声明的时间戳(纳秒)
+}
+
+// PutName 合并一条已验证的名称记录
+// 参数：
+//   - record: *NameRecord 名称记录
+//
+// 返回值：
+//   - bool: 记录被采纳返回 true；已存在相同或更新的记录，或命名空间属于其他所有者时返回 false
+func (s *IndexStore) PutName(record *NameRecord) bool {
+	s.Mu.Lock()
+	accepted := s.putName(record)
+	s.Mu.Unlock()
+
+	if accepted {
+		s.SaveToFileSingleChan()
+	}
+	return accepted
+}
+
+// putName 在持有锁的情况下合并名称记录
+func (s *IndexStore) putName(record *NameRecord) bool {
+	if !record.ownNamespace() && !s.claimNamespace(record) {
+		return false
+	}
+
+	key := record.Name()
+	if existing, ok := s.Names[key]; ok {
+		// 只有所有者本人可以更新记录
+		if existing.Owner != record.Owner || !record.newerThan(existing) {
+			return false
+		}
+	}
+	s.Names[key] = record
+	if s.nameSeqs == nil {
+		s.nameSeqs = make(map[string]uint64)
+	}
+	s.seq++
+	s.nameSeqs[key] = s.seq
+	return true
+}
+
+// claimNamespace 检查记录的所有者能否使用别名命名空间
+// 命名空间归本节点最先收到的声明者所有，之后不再转移：记录中的时间戳由所有者自行签名，
+// 可以任意提前，不能用来决定归属
+func (s *IndexStore) claimNamespace(record *NameRecord) bool {
+	claim, ok := s.namespaces[record.Namespace]
+	if !ok {
+		s.namespaces[record.Namespace] = &namespaceClaim{Owner: record.Owner, ClaimedAt: time.Now().UnixNano()}
+		return true
+	}
+	return claim.Owner == record.Owner
+}
+
+// ResolveName 解析名称
+// 参数：
+//   - name: string "命名空间/路径"形式的名称
+//
+// 返回值：
+//   - *NameRecord: 名称记录
+//   - bool: 名称是否存在
+func (s *IndexStore) ResolveName(name string) (*NameRecord, bool) {
+	s.Mu.RLock()
+	defer s.Mu.RUnlock()
+	record, ok := s.Names[name]
+	return record, ok
+}
+
+// NamesSince 返回本节点在指定序号之后采纳的所有名称记录
+// 参数：
+//   - seq: uint64 对方上次同步得到的序号，为 0 时返回全部名称记录
+//
+// 返回值：
+//   - []*NameRecord: 满足条件的名称记录
+//   - uint64: 当前的序号，对方下次同步时使用
+func (s *IndexStore) NamesSince(seq uint64) ([]*NameRecord, uint64) {
+	s.Mu.RLock()
+	defer s.Mu.RUnlock()
+
+	var result []*NameRecord
+	for key, record := range s.Names {
+		if s.nameSeqs[key] > seq {
+			result = append(result, record)
+		}
+	}
+	return result, s.seq
+}
+
+// namesFilePath 获取名称记录的文件路径，与元数据记录保存在同一目录
+func namesFilePath(filePath string) string {
+	return filepath.Join(filepath.Dir(filePath), "names")
+}
+
+// saveNames 保存名称记录到文件
+// 参数：
+//   - filePath: string 文件路径
+//
+// 返回值：
+//   - error: 如果发生错误，返回错误信息
+func (s *IndexStore) saveNames(filePath string) error {
+	s.Mu.RLock()
+	names := make([]*NameRecord, 0, len(s.Names))
+	for _, record := range s.Names {
+		names = append(names, record)
+	}
+	s.Mu.RUnlock()
+
+	data, err := json.Marshal(names)
+	if err != nil {
+		logrus.Errorf("[%s]序列化名称记录时失败: %v", debug.WhereAmI(), err)
+		return err
+	}
+
+	return util.WriteFileAtomic(afero.NewOsFs(), filePath, data, 0644)
+}
+
+// loadNames 从文件加载名称记录
+// 参数：
+//   - filePath: string 文件路径
+func (s *IndexStore) loadNames(filePath string) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return
+	}
+
+	var names []*NameRecord
+	if err := json.Unmarshal(data, &names); err != nil {
+		logrus.Errorf("[%s]反序列化名称记录时失败: %v", debug.WhereAmI(), err)
+		return
+	}
+	for _, record := range names {
+		s.putName(record)
+	}
+}
@@ -0,0 +1,450 @@
+package index
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/network"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/supervise"
+	"github.com/bpfs/defs/util"
+	"github.com/bpfs/dep2p"
+	"github.com/bpfs/dep2p/pubsub"
+	"github.com/bpfs/dep2p/streams"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+)
+
+// syncInterval 索引节点之间发起同步的间隔
+const syncInterval = 5 * time.Minute
+
+// 索引协议
+type IndexProtocol struct {
+	Ctx    context.Context     // 全局上下文
+	Opt    *opts.Options       // 文件存储选项配置
+	P2P    *dep2p.DeP2P        // 网络主机
+	PubSub *pubsub.DeP2PPubSub // 网络订阅
+	Index  *IndexStore         // 元数据索引
+
+	cursorsMu sync.Mutex
+	cursors   map[peer.ID]*syncCursor // 各索引节点上次同步得到的序号
+}
+
+// syncCursor 从一个索引节点同步时的位置
+type syncCursor struct {
+	Epoch   string // 对方的运行标识
+	Records uint64 // 元数据记录同步到的序号
+	Names   uint64 // 名称记录同步到的序号
+}
+
+type RegisterIndexProtocolInput struct {
+	fx.In
+	LC         fx.Lifecycle
+	Ctx        context.Context       // 全局上下文
+	Opt        *opts.Options         // 文件存储选项配置
+	P2P        *dep2p.DeP2P          // 网络主机
+	PubSub     *pubsub.DeP2PPubSub   // 网络订阅
+	Index      *IndexStore           // 元数据索引
+	Supervisor *supervise.Supervisor // 后台任务的崩溃恢复
+}
+
+// RegisterIndexProtocol 注册索引协议
+// 只有被指定为索引节点的主机才会接收、复制并响应元数据记录的请求
+func RegisterIndexProtocol(input RegisterIndexProtocolInput) {
+	if !input.Opt.GetIndexNode() {
+		return
+	}
+
+	ip := &IndexProtocol{
+		Ctx:     input.Ctx,
+		Opt:     input.Opt,
+		P2P:     input.P2P,
+		PubSub:  input.PubSub,
+		Index:   input.Index,
+		cursors: make(map[peer.ID]*syncCursor),
+	}
+
+	input.LC.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			// 注册发布元数据记录
+			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamIndexPublishProtocol), network.HandlerWithLimits(StreamIndexPublishProtocol, network.HandlerWithRW(ip.handlePublish)))
+
+			// 注册搜索元数据记录
+			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamIndexSearchProtocol), network.HandlerWithLimits(StreamIndexSearchProtocol, network.HandlerWithRW(ip.handleSearch)))
+
+			// 注册同步元数据记录
+			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamIndexSyncProtocol), network.HandlerWithLimits(StreamIndexSyncProtocol, network.HandlerWithRW(ip.handleSync)))
+
+			// 注册发布名称记录
+			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamNamePublishProtocol), network.HandlerWithLimits(StreamNamePublishProtocol, network.HandlerWithRW(ip.handleNamePublish)))
+
+			// 注册解析名称
+			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamNameResolveProtocol), network.HandlerWithLimits(StreamNameResolveProtocol, network.HandlerWithRW(ip.handleNameResolve)))
+
+			// 注册同步名称记录
+			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamNameSyncProtocol), network.HandlerWithLimits(StreamNameSyncProtocol, network.HandlerWithRW(ip.handleNameSync)))
+
+			// 注册查询指向文件的名称
+			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamNameLookupProtocol), network.HandlerWithLimits(StreamNameLookupProtocol, network.HandlerWithRW(ip.handleNameLookup)))
+
+			// 注册发布变更
+			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamIndexChangeProtocol), network.HandlerWithLimits(StreamIndexChangeProtocol, network.HandlerWithRW(ip.handleChange)))
+
+			// 订阅索引节点之间的复制主题
+			if err := input.PubSub.SubscribeWithTopic(PubSubIndexReplicateTopic, network.PubSubHandler(PubSubIndexReplicateTopic, ip.handleReplicatePubSub), true); err != nil {
+				logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+				return err
+			}
+
+			// 定时向其他索引节点请求遗漏的记录
+			input.Supervisor.Go("index", "periodic-sync", ip.periodicSync)
+
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			return nil
+		},
+	})
+}
+
+// handlePublish 处理发布元数据记录
+func (ip *IndexProtocol) handlePublish(req *streams.RequestMessage, res *streams.ResponseMessage) (int32, string) {
+	record := new(IndexRecord)
+	if err := util.DecodeFromBytes(req.Payload, record); err != nil {
+		logrus.Errorf("[%s]解码错误: %v", debug.WhereAmI(), err)
+		return 6603, "解码错误"
+	}
+	if ip.Opt.GetReadOnly() {
+		return 6610, "只读节点不接受写入"
+	}
+
+	// 验证记录签名
+	if err := record.Verify(); err != nil {
+		logrus.Warnf("[%s]元数据记录验证失败: %v", debug.WhereAmI(), err)
+		return 6606, "元数据记录验证失败"
+	}
+
+	// 合并并复制到其他索引节点
+	if ip.Index.Put(record) {
+		if err := network.SendPubSub(ip.P2P, ip.PubSub, PubSubIndexReplicateTopic, "replicate", "", record); err != nil {
+			logrus.Errorf("[%s]复制元数据记录失败: %v", debug.WhereAmI(), err)
+		}
+	}
+
+	return 200, "成功"
+}
+
+// handleSearch 处理搜索元数据记录
+func (ip *IndexProtocol) handleSearch(req *streams.RequestMessage, res *streams.ResponseMessage) (int32, string) {
+	query := new(Query)
+	if err := util.DecodeFromBytes(req.Payload, query); err != nil {
+		logrus.Errorf("[%s]解码错误: %v", debug.WhereAmI(), err)
+		return 6603, "解码错误"
+	}
+
+	recordsBytes, err := util.EncodeToBytes(ip.Index.Search(query))
+	if err != nil {
+		return 6605, err.Error()
+	}
+
+	res.Data = recordsBytes
+	return 200, "成功"
+}
+
+// 同步元数据记录的请求消息
+type SyncReq struct {
+	Epoch string // 上次同步时对方的运行标识，与对方当前标识不同时从头同步
+	Since uint64 // 上次同步得到的序号
+}
+
+// 同步元数据记录的响应消息
+type SyncRes struct {
+	Epoch   string         // 本节点的运行标识
+	Seq     uint64         // 本节点当前的序号
+	Records []*IndexRecord // 同步的元数据记录
+	Names   []*NameRecord  // 同步的名称记录
+}
+
+// syncSince 获取请求的起始序号，对方记录的运行标识与本节点不同时从头同步
+func (ip *IndexProtocol) syncSince(payload *SyncReq) uint64 {
+	if payload.Epoch != ip.Index.Epoch() {
+		return 0
+	}
+	return payload.Since
+}
+
+// handleSync 处理同步元数据记录，返回本节点在请求序号之后采纳的记录
+func (ip *IndexProtocol) handleSync(req *streams.RequestMessage, res *streams.ResponseMessage) (int32, string) {
+	payload := new(SyncReq)
+	if err := util.DecodeFromBytes(req.Payload, payload); err != nil {
+		logrus.Errorf("[%s]解码错误: %v", debug.WhereAmI(), err)
+		return 6603, "解码错误"
+	}
+
+	reply := &SyncRes{Epoch: ip.Index.Epoch()}
+	reply.Records, reply.Seq = ip.Index.Since(ip.syncSince(payload))
+	replyBytes, err := util.EncodeToBytes(reply)
+	if err != nil {
+		return 6605, err.Error()
+	}
+
+	res.Data = replyBytes
+	return 200, "成功"
+}
+
+// handleNamePublish 处理发布名称记录
+func (ip *IndexProtocol) handleNamePublish(req *streams.RequestMessage, res *streams.ResponseMessage) (int32, string) {
+	record := new(NameRecord)
+	if err := util.DecodeFromBytes(req.Payload, record); err != nil {
+		logrus.Errorf("[%s]解码错误: %v", debug.WhereAmI(), err)
+		return 6603, "解码错误"
+	}
+	if ip.Opt.GetReadOnly() {
+		return 6610, "只读节点不接受写入"
+	}
+
+	// 验证记录签名
+	if err := record.Verify(); err != nil {
+		logrus.Warnf("[%s]名称记录验证失败: %v", debug.WhereAmI(), err)
+		return 6606, "名称记录验证失败"
+	}
+
+	// 合并并复制到其他索引节点
+	if !ip.Index.PutName(record) {
+		return 6607, "名称已被占用或版本过旧"
+	}
+	if err := network.SendPubSub(ip.P2P, ip.PubSub, PubSubIndexReplicateTopic, "replicateName", "", record); err != nil {
+		logrus.Errorf("[%s]复制名称记录失败: %v", debug.WhereAmI(), err)
+	}
+
+	return 200, "成功"
+}
+
+// 解析名称的请求消息
+type ResolveNameReq struct {
+	Name string // "命名空间/路径"形式的名称
+}
+
+// handleNameResolve 处理解析名称
+func (ip *IndexProtocol) handleNameResolve(req *streams.RequestMessage, res *streams.ResponseMessage) (int32, string) {
+	payload := new(ResolveNameReq)
+	if err := util.DecodeFromBytes(req.Payload, payload); err != nil {
+		logrus.Errorf("[%s]解码错误: %v", debug.WhereAmI(), err)
+		return 6603, "解码错误"
+	}
+
+	record, ok := ip.Index.ResolveName(payload.Name)
+	if !ok {
+		return 404, "名称不存在"
+	}
+
+	recordBytes, err := util.EncodeToBytes(record)
+	if err != nil {
+		return 6605, err.Error()
+	}
+
+	res.Data = recordBytes
+	return 200, "成功"
+}
+
+// handleNameSync 处理同步名称记录，返回本节点在请求序号之后采纳的名称记录
+func (ip *IndexProtocol) handleNameSync(req *streams.RequestMessage, res *streams.ResponseMessage) (int32, string) {
+	payload := new(SyncReq)
+	if err := util.DecodeFromBytes(req.Payload, payload); err != nil {
+		logrus.Errorf("[%s]解码错误: %v", debug.WhereAmI(), err)
+		return 6603, "解码错误"
+	}
+
+	reply := &SyncRes{Epoch: ip.Index.Epoch()}
+	reply.Names, reply.Seq = ip.Index.NamesSince(ip.syncSince(payload))
+	replyBytes, err := util.EncodeToBytes(reply)
+	if err != nil {
+		return 6605, err.Error()
+	}
+
+	res.Data = replyBytes
+	return 200, "成功"
+}
+
+// 查询指向文件的名称的请求消息
+type NameLookupReq struct {
+	FileID string // 文件唯一标识
+}
+
+// handleNameLookup 处理查询指向文件的名称
+func (ip *IndexProtocol) handleNameLookup(req *streams.RequestMessage, res *streams.ResponseMessage) (int32, string) {
+	payload := new(NameLookupReq)
+	if err := util.DecodeFromBytes(req.Payload, payload); err != nil {
+		logrus.Errorf("[%s]解码错误: %v", debug.WhereAmI(), err)
+		return 6603, "解码错误"
+	}
+
+	recordsBytes, err := util.EncodeToBytes(ip.Index.NamesOf(payload.FileID))
+	if err != nil {
+		return 6605, err.Error()
+	}
+
+	res.Data = recordsBytes
+	return 200, "成功"
+}
+
+// handleChange 处理整体发布的元数据与名称变更
+func (ip *IndexProtocol) handleChange(req *streams.RequestMessage, res *streams.ResponseMessage) (int32, string) {
+	change := new(Change)
+	if err := util.DecodeFromBytes(req.Payload, change); err != nil {
+		logrus.Errorf("[%s]解码错误: %v", debug.WhereAmI(), err)
+		return 6603, "解码错误"
+	}
+	if ip.Opt.GetReadOnly() {
+		return 6610, "只读节点不接受写入"
+	}
+
+	// 验证变更中所有记录的签名
+	if err := change.Verify(); err != nil {
+		logrus.Warnf("[%s]变更验证失败: %v", debug.WhereAmI(), err)
+		return 6606, "变更验证失败"
+	}
+
+	// 整体合并并作为一条消息复制到其他索引节点
+	if !ip.Index.ApplyChange(change) {
+		return 6607, "名称已被占用或版本过旧"
+	}
+	if err := network.SendPubSub(ip.P2P, ip.PubSub, PubSubIndexReplicateTopic, "replicateChange", "", change); err != nil {
+		logrus.Errorf("[%s]复制变更失败: %v", debug.WhereAmI(), err)
+	}
+
+	return 200, "成功"
+}
+
+// handleReplicatePubSub 处理其他索引节点复制的元数据记录
+func (ip *IndexProtocol) handleReplicatePubSub(res *streams.RequestMessage) {
+	if res.Message.Sender == ip.P2P.Host().ID().String() || ip.Opt.GetReadOnly() {
+		return
+	}
+
+	switch res.Message.Type {
+	case "replicate":
+		record := new(IndexRecord)
+		if err := util.DecodeFromBytes(res.Payload, record); err != nil {
+			logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+			return
+		}
+		if err := record.Verify(); err != nil {
+			logrus.Warnf("[%s]元数据记录验证失败: %v", debug.WhereAmI(), err)
+			return
+		}
+		ip.Index.Put(record)
+
+	case "replicateName":
+		record := new(NameRecord)
+		if err := util.DecodeFromBytes(res.Payload, record); err != nil {
+			logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+			return
+		}
+		if err := record.Verify(); err != nil {
+			logrus.Warnf("[%s]名称记录验证失败: %v", debug.WhereAmI(), err)
+			return
+		}
+		ip.Index.PutName(record)
+
+	case "replicateChange":
+		change := new(Change)
+		if err := util.DecodeFromBytes(res.Payload, change); err != nil {
+			logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+			return
+		}
+		if err := change.Verify(); err != nil {
+			logrus.Warnf("[%s]变更验证失败: %v", debug.WhereAmI(), err)
+			return
+		}
+		ip.Index.ApplyChange(change)
+
+	default:
+		return
+	}
+}
+
+// periodicSync 定时从订阅复制主题的索引节点拉取遗漏的记录，弥补丢失的订阅消息
+func (ip *IndexProtocol) periodicSync() {
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ip.Ctx.Done():
+			return
+		case <-ticker.C:
+			for _, peerID := range ip.PubSub.ListPeers(PubSubIndexReplicateTopic) {
+				if err := ip.syncFrom(peerID); err != nil {
+					logrus.Debugf("[%s]从索引节点 %s 同步失败: %v", debug.WhereAmI(), peerID, err)
+				}
+			}
+		}
+	}
+}
+
+// syncFrom 从指定的索引节点同步元数据记录与名称记录
+func (ip *IndexProtocol) syncFrom(receiver peer.ID) error {
+	if ip.Opt.GetReadOnly() {
+		return nil
+	}
+	ip.cursorsMu.Lock()
+	cursor, ok := ip.cursors[receiver]
+	if !ok {
+		cursor = new(syncCursor)
+		ip.cursors[receiver] = cursor
+	}
+	known := *cursor
+	ip.cursorsMu.Unlock()
+
+	records, err := requestSync(ip.Ctx, ip.P2P, StreamIndexSyncProtocol, receiver, &SyncReq{Epoch: known.Epoch, Since: known.Records})
+	if err != nil {
+		return err
+	}
+	for _, record := range records.Records {
+		if err := record.Verify(); err != nil {
+			continue
+		}
+		ip.Index.Put(record)
+	}
+
+	// 对方重启后序号从头开始，名称记录同样从头同步
+	nameSince := known.Names
+	if records.Epoch != known.Epoch {
+		nameSince = 0
+	}
+	names, err := requestSync(ip.Ctx, ip.P2P, StreamNameSyncProtocol, receiver, &SyncReq{Epoch: records.Epoch, Since: nameSince})
+	if err != nil {
+		return err
+	}
+	for _, record := range names.Names {
+		if err := record.Verify(); err != nil {
+			continue
+		}
+		ip.Index.PutName(record)
+	}
+
+	ip.cursorsMu.Lock()
+	if names.Epoch == records.Epoch {
+		*cursor = syncCursor{Epoch: records.Epoch, Records: records.Seq, Names: names.Seq}
+	}
+	ip.cursorsMu.Unlock()
+	return nil
+}
+
+// requestSync 向索引节点请求同步
+func requestSync(ctx context.Context, p2p *dep2p.DeP2P, protocol string, receiver peer.ID, req *SyncReq) (*SyncRes, error) {
+	res, err := network.SendStreamContext(ctx, p2p, protocol, "", receiver, req)
+	if err := checkResponse(receiver, protocol, res, err); err != nil {
+		return nil, err
+	}
+	reply := new(SyncRes)
+	if err := util.DecodeFromBytes(res.Data, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
@@ -0,0 +1,136 @@
+package index
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/bpfs/defs/debug"
+	sign "github.com/bpfs/defs/sign/ecdsa"
+	"github.com/bpfs/defs/util"
+	"github.com/bpfs/defs/wallets"
+	"github.com/sirupsen/logrus"
+)
+
+// IndexRecord 描述一条经过所有者签名的文件元数据记录
+type IndexRecord struct {
+	FileID      string   // 文件唯一标识
+	Name        string   // 文件名
+	Labels      []string // 文件标签
+	Size        int64    // 文件大小，单位为字节
+	ContentType string   // MIME类型
+	Owner       string   // 所有者公钥哈希的十六进制字符串
+	PublicKey   []byte   // 所有者公钥
+	UpdatedAt   int64    // 记录更新的时间戳(纳秒)，用于解决复制冲突
+	Signature   []byte   // 所有者对记录的签名
+}
+
+// NewIndexRecord 创建并签名一条新的元数据记录
+// 参数：
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥
+//   - fileID: string 文件唯一标识
+//   - name: string 文件名
+//   - size: int64 文件大小
+//   - contentType: string MIME类型
+//   - labels: ...string 文件标签
+//
+// 返回值：
+//   - *IndexRecord: 签名后的元数据记录
+//   - error: 如果发生错误，返回错误信息
+func NewIndexRecord(ownerPriv *ecdsa.PrivateKey, fileID, name string, size int64, contentType string, labels ...string) (*IndexRecord, error) {
+	if ownerPriv == nil {
+		return nil, fmt.Errorf("所有者私钥不能为空")
+	}
+
+	// 提取所有者公钥
+	publicKey, err := wallets.MarshalPublicKey(ownerPriv.PublicKey)
+	if err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return nil, err
+	}
+
+	// 通过私钥生成公钥哈希
+	pubKeyHash, ok := wallets.PrivateKeyToPublicKeyHash(ownerPriv)
+	if !ok {
+		return nil, fmt.Errorf("通过私钥生成公钥哈希时失败")
+	}
+
+	record := &IndexRecord{
+		FileID:      fileID,
+		Name:        name,
+		Labels:      labels,
+		Size:        size,
+		ContentType: contentType,
+		Owner:       hex.EncodeToString(pubKeyHash),
+		PublicKey:   publicKey,
+		UpdatedAt:   time.Now().UnixNano(),
+	}
+
+	// 待签名数据
+	data, err := record.signingData()
+	if err != nil {
+		return nil, err
+	}
+
+	// 使用所有者私钥签名
+	record.Signature, err = sign.SignData(ownerPriv, data)
+	if err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// Verify 验证元数据记录的签名及所有者
+// 返回值：
+//   - error: 验证失败时返回错误信息
+func (r *IndexRecord) Verify() error {
+	if r.FileID == "" {
+		return fmt.Errorf("文件唯一标识不能为空")
+	}
+	if r.UpdatedAt > time.Now().Add(maxClockSkew).UnixNano() {
+		return fmt.Errorf("元数据记录的时间戳超前")
+	}
+
+	publicKey, err := wallets.UnmarshalPublicKey(r.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	// 所有者必须与公钥一致
+	pubKeyHash, ok := wallets.PublicKeyToPublicKeyHash(publicKey)
+	if !ok || hex.EncodeToString(pubKeyHash) != r.Owner {
+		return fmt.Errorf("记录所有者与公钥不匹配")
+	}
+
+	data, err := r.signingData()
+	if err != nil {
+		return err
+	}
+
+	valid, err := sign.VerifySignature(&publicKey, data, r.Signature)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return fmt.Errorf("元数据记录签名无效")
+	}
+
+	return nil
+}
+
+// newerThan 检查记录是否比另一条记录更新
+// 时间戳相同时按签名字节序比较，保证所有索引节点得到相同的结果
+func (r *IndexRecord) newerThan(other *IndexRecord) bool {
+	if r.UpdatedAt != other.UpdatedAt {
+		return r.UpdatedAt > other.UpdatedAt
+	}
+	return string(r.Signature) > string(other.Signature)
+}
+
+// signingData 返回记录中参与签名的字段
+func (r *IndexRecord) signingData() ([]byte, error) {
+	return util.MergeFieldsForSigning(r.FileID, r.Name, r.Labels, r.Size, r.ContentType, r.Owner, r.PublicKey, r.UpdatedAt)
+}
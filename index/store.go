@@ -0,0 +1,299 @@
+package index
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/defs/supervise"
+	"github.com/bpfs/defs/util"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+)
+
+// IndexStore 保存索引节点接收到的元数据记录
+// 同一文件的多条记录按"最后写入者获胜"的规则合并，索引节点之间最终达成一致
+type IndexStore struct {
+	ctx        context.Context         // 上下文用于管理协程的生命周期
+	cancel     context.CancelFunc      // 取消函数
+	Mu         sync.RWMutex            // 用于保护状态的读写锁
+	Records    map[string]*IndexRecord // 元数据记录的映射表，键为文件唯一标识
+	SaveToFile chan struct{}           // 保存记录至文件通道
+
+	Names      map[string]*NameRecord     // 名称记录的映射表，键为"命名空间/路径"
+	namespaces map[string]*namespaceClaim // 别名命名空间的归属
+
+	// 记录按本节点采纳的顺序编号，同步时对方以上次得到的序号请求之后采纳的记录，
+	// 不依赖记录中由所有者签名的时间戳，以任意顺序采纳的记录都不会遗漏
+	epoch      string            // 本次运行的标识，重启后序号从头开始，对方据此重新完整同步
+	seq        uint64            // 最近采纳的记录的序号
+	recordSeqs map[string]uint64 // 元数据记录的采纳序号，键为文件唯一标识
+	nameSeqs   map[string]uint64 // 名称记录的采纳序号，键为"命名空间/路径"
+
+	changeHandlers []ChangeHandler // 变更的处理回调
+}
+
+type NewIndexStoreInput struct {
+	fx.In
+	LC         fx.Lifecycle
+	Ctx        context.Context       // 全局上下文
+	Supervisor *supervise.Supervisor // 后台任务的崩溃恢复
+}
+
+type NewIndexStoreOutput struct {
+	fx.Out
+	Index *IndexStore // 元数据索引
+}
+
+// NewIndexStore 创建并初始化一个新的 IndexStore 实例。
+// 参数：
+//   - input: NewIndexStoreInput 用于初始化 IndexStore 的输入结构体。
+//
+// 返回值：
+//   - NewIndexStoreOutput: 包含 IndexStore 的输出结构体。
+func NewIndexStore(input NewIndexStoreInput) (out NewIndexStoreOutput) {
+	ctx, cancel := context.WithCancel(input.Ctx)
+	store := &IndexStore{
+		ctx:        ctx,                           // 初始化上下文
+		cancel:     cancel,                        // 初始化取消函数
+		Records:    make(map[string]*IndexRecord), // 初始化记录映射表
+		SaveToFile: make(chan struct{}, 1),        // 缓冲区大小为1，只保存最新的信息
+		Names:      make(map[string]*NameRecord),  // 初始化名称映射表
+		namespaces: make(map[string]*namespaceClaim),
+		epoch:      newEpoch(),
+	}
+
+	filePath := filepath.Join(paths.GetDBDir(), "index") // 设置文件路径
+	// 加载记录
+	records, err := LoadRecordsFromFile(filePath)
+	if err == nil {
+		for _, record := range records {
+			store.put(record)
+		}
+	}
+	// 加载名称记录
+	store.loadNames(namesFilePath(filePath))
+
+	out.Index = store
+
+	// 后台任务崩溃时保存记录
+	input.Supervisor.OnCrash("index", func() { store.saveRecords(filePath) })
+
+	input.LC.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			// 启动定时保存记录的定时器
+			input.Supervisor.Go("index", "periodic-save", func() { store.PeriodicSave(filePath, time.Minute) })
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			store.cancel()
+			store.saveRecords(filePath)
+			return nil
+		},
+	})
+
+	return out
+}
+
+// Put 合并一条已验证的元数据记录
+// 参数：
+//   - record: *IndexRecord 元数据记录
+//
+// 返回值：
+//   - bool: 记录被采纳返回 true；已存在相同或更新的记录返回 false
+func (s *IndexStore) Put(record *IndexRecord) bool {
+	s.Mu.Lock()
+	accepted := s.put(record)
+	s.Mu.Unlock()
+
+	if accepted {
+		s.SaveToFileSingleChan()
+	}
+	return accepted
+}
+
+// put 在持有锁的情况下合并记录
+func (s *IndexStore) put(record *IndexRecord) bool {
+	if existing, ok := s.Records[record.FileID]; ok {
+		// 只有所有者本人可以更新记录
+		if existing.Owner != record.Owner || !record.newerThan(existing) {
+			return false
+		}
+	}
+	s.Records[record.FileID] = record
+	if s.recordSeqs == nil {
+		s.recordSeqs = make(map[string]uint64)
+	}
+	s.seq++
+	s.recordSeqs[record.FileID] = s.seq
+	return true
+}
+
+// Search 按条件搜索元数据记录，结果按更新时间倒序排列
+// 参数：
+//   - query: *Query 搜索条件
+//
+// 返回值：
+//   - []*IndexRecord: 满足条件的元数据记录
+func (s *IndexStore) Search(query *Query) []*IndexRecord {
+	s.Mu.RLock()
+	var result []*IndexRecord
+	for _, record := range s.Records {
+		if query.Match(record) {
+			result = append(result, record)
+		}
+	}
+	s.Mu.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].newerThan(result[j])
+	})
+	if limit := query.limit(); len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// Since 返回本节点在指定序号之后采纳的所有记录
+// 参数：
+//   - seq: uint64 对方上次同步得到的序号，为 0 时返回全部记录
+//
+// 返回值：
+//   - []*IndexRecord: 满足条件的元数据记录
+//   - uint64: 当前的序号，对方下次同步时使用
+func (s *IndexStore) Since(seq uint64) ([]*IndexRecord, uint64) {
+	s.Mu.RLock()
+	defer s.Mu.RUnlock()
+
+	var result []*IndexRecord
+	for fileID, record := range s.Records {
+		if s.recordSeqs[fileID] > seq {
+			result = append(result, record)
+		}
+	}
+	return result, s.seq
+}
+
+// Epoch 获取本次运行的标识，标识变化时对方需从序号 0 重新同步
+func (s *IndexStore) Epoch() string {
+	return s.epoch
+}
+
+// newEpoch 生成运行标识
+func newEpoch() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// SaveToFileSingleChan 保存记录至文件的唯一通道
+func (s *IndexStore) SaveToFileSingleChan() {
+	select {
+	case s.SaveToFile <- struct{}{}:
+	default:
+		// 如果通道已满，先清空再发送
+		select {
+		case <-s.SaveToFile:
+		default:
+		}
+		s.SaveToFile <- struct{}{}
+	}
+}
+
+// PeriodicSave 定时保存记录到文件
+// 参数：
+//   - filePath: string 文件路径
+//   - interval: time.Duration 保存间隔
+func (s *IndexStore) PeriodicSave(filePath string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.saveRecords(filePath)
+		case <-s.SaveToFile:
+			s.saveRecords(filePath)
+		}
+	}
+}
+
+// saveRecords 保存记录到文件
+// 参数：
+//   - filePath: string 文件路径
+func (s *IndexStore) saveRecords(filePath string) {
+	s.Mu.RLock()
+	records := make([]*IndexRecord, 0, len(s.Records))
+	for _, record := range s.Records {
+		records = append(records, record)
+	}
+	s.Mu.RUnlock()
+
+	if err := SaveRecordsToFile(filePath, records); err != nil {
+		logrus.Errorf("[%s]保存元数据记录失败: %v", debug.WhereAmI(), err)
+	}
+	if err := s.saveNames(namesFilePath(filePath)); err != nil {
+		logrus.Errorf("[%s]保存名称记录失败: %v", debug.WhereAmI(), err)
+	}
+}
+
+// LoadRecordsFromFile 从文件加载元数据记录
+// 参数：
+//   - filePath: string 文件路径
+//
+// 返回值：
+//   - []*IndexRecord: 元数据记录
+//   - error: 如果发生错误，返回错误信息
+func LoadRecordsFromFile(filePath string) ([]*IndexRecord, error) {
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		logrus.Errorf("[%s]读取文件内容时失败: %v", debug.WhereAmI(), err)
+		return nil, err
+	}
+
+	var records []*IndexRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		logrus.Errorf("[%s]反序列化元数据记录时失败: %v", debug.WhereAmI(), err)
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// SaveRecordsToFile 将元数据记录保存到文件
+// 参数：
+//   - filePath: string 文件路径
+//   - records: []*IndexRecord 元数据记录
+//
+// 返回值：
+//   - error: 如果发生错误，返回错误信息
+func SaveRecordsToFile(filePath string, records []*IndexRecord) error {
+	data, err := json.Marshal(records)
+	if err != nil {
+		logrus.Errorf("[%s]序列化元数据记录时失败: %v", debug.WhereAmI(), err)
+		return err
+	}
+
+	// 确保文件目录存在
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		logrus.Errorf("[%s]创建目录失败: %v", debug.WhereAmI(), err)
+		return err
+	}
+
+	return util.WriteFileAtomic(afero.NewOsFs(), filePath, data, 0644)
+}
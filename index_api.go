@@ -0,0 +1,137 @@
+package defs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+
+	"github.com/bpfs/defs/downloads"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/index"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// PublishMetadata 签名文件元数据并发布到索引节点
+// 参数：
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥
+//   - indexPeer: peer.ID 索引节点
+//   - fileID: string 文件唯一标识
+//   - name: string 文件名
+//   - size: int64 文件大小
+//   - contentType: string MIME类型
+//   - labels: ...string 文件标签
+//
+// 返回值：
+//   - *index.IndexRecord: 已发布的元数据记录
+//   - error: 如果发生错误，返回错误信息
+func (fs *FS) PublishMetadata(ownerPriv *ecdsa.PrivateKey, indexPeer peer.ID, fileID, name string, size int64, contentType string, labels ...string) (*index.IndexRecord, error) {
+	return fs.PublishMetadataContext(fs.ctx, ownerPriv, indexPeer, fileID, name, size, contentType, labels...)
+}
+
+// PublishMetadataContext 签名文件元数据并发布到索引节点，ctx 结束时中止请求
+func (fs *FS) PublishMetadataContext(ctx context.Context, ownerPriv *ecdsa.PrivateKey, indexPeer peer.ID, fileID, name string, size int64, contentType string, labels ...string) (*index.IndexRecord, error) {
+	record, err := index.NewIndexRecord(ownerPriv, fileID, name, size, contentType, labels...)
+	if err != nil {
+		return nil, err
+	}
+	if err := index.PublishContext(ctx, fs.p2p, indexPeer, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// SearchMetadata 在索引节点中搜索文件元数据
+// 参数：
+//   - indexPeer: peer.ID 索引节点
+//   - query: *index.Query 搜索条件(按文件名、标签、所有者)
+//
+// 返回值：
+//   - []*index.IndexRecord: 满足条件的元数据记录
+//   - error: 如果发生错误，返回错误信息
+func (fs *FS) SearchMetadata(indexPeer peer.ID, query *index.Query) ([]*index.IndexRecord, error) {
+	return fs.SearchMetadataContext(fs.ctx, indexPeer, query)
+}
+
+// SearchMetadataContext 在索引节点中搜索文件元数据，ctx 结束时中止请求
+func (fs *FS) SearchMetadataContext(ctx context.Context, indexPeer peer.ID, query *index.Query) ([]*index.IndexRecord, error) {
+	return index.SearchContext(ctx, fs.p2p, indexPeer, query)
+}
+
+// PublishName 发布或更新名称到文件唯一标识的映射
+// 名称形如"命名空间/路径"，以所有者公钥哈希为命名空间时始终归所有者所有，
+// 其他命名空间归索引节点最先收到的声明者所有；更新时版本号在索引节点已有记录的基础上递增
+// 参数：
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥
+//   - indexPeer: peer.ID 索引节点
+//   - name: string 名称
+//   - fileID: string 名称指向的文件唯一标识
+//
+// 返回值：
+//   - *index.NameRecord: 已发布的名称记录
+//   - error: 如果发生错误，返回错误信息
+func (fs *FS) PublishName(ownerPriv *ecdsa.PrivateKey, indexPeer peer.ID, name, fileID string) (*index.NameRecord, error) {
+	return fs.PublishNameContext(fs.ctx, ownerPriv, indexPeer, name, fileID)
+}
+
+// PublishNameContext 发布或更新名称到文件唯一标识的映射，ctx 结束时中止请求
+func (fs *FS) PublishNameContext(ctx context.Context, ownerPriv *ecdsa.PrivateKey, indexPeer peer.ID, name, fileID string) (*index.NameRecord, error) {
+	version := uint64(1)
+	if existing, err := index.ResolveNameContext(ctx, fs.p2p, indexPeer, name); err == nil {
+		version = existing.Version + 1
+	}
+
+	record, err := index.NewNameRecord(ownerPriv, name, fileID, version)
+	if err != nil {
+		return nil, err
+	}
+	if err := index.PublishNameContext(ctx, fs.p2p, indexPeer, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// ResolveName 通过索引节点将名称解析为文件唯一标识
+// 参数：
+//   - indexPeer: peer.ID 索引节点
+//   - name: string "命名空间/路径"形式的名称
+//
+// 返回值：
+//   - string: 文件唯一标识
+//   - error: 如果发生错误，返回错误信息
+func (fs *FS) ResolveName(indexPeer peer.ID, name string) (string, error) {
+	return fs.ResolveNameContext(fs.ctx, indexPeer, name)
+}
+
+// ResolveNameContext 通过索引节点将名称解析为文件唯一标识，ctx 结束时中止请求
+func (fs *FS) ResolveNameContext(ctx context.Context, indexPeer peer.ID, name string) (string, error) {
+	record, err := index.ResolveNameContext(ctx, fs.p2p, indexPeer, name)
+	if err != nil {
+		return "", err
+	}
+	if record.Released() {
+		return "", fmt.Errorf("%w: 名称 %s 已被释放", errs.ErrNotFound, name)
+	}
+	return record.FileID, nil
+}
+
+// DownloadByName 解析名称并下载其指向的文件
+// 参数：
+//   - indexPeer: peer.ID 索引节点
+//   - name: string "命名空间/路径"形式的名称
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥，为空时使用默认所有者
+//
+// 返回值：
+//   - *downloads.DownloadSuccessInfo: 文件下载成功后的返回信息
+//   - error: 如果发生错误，返回错误信息
+func (fs *FS) DownloadByName(indexPeer peer.ID, name string, ownerPriv *ecdsa.PrivateKey) (*downloads.DownloadSuccessInfo, error) {
+	return fs.DownloadByNameContext(context.Background(), indexPeer, name, ownerPriv)
+}
+
+// DownloadByNameContext 解析名称并下载其指向的文件，ctx 结束时中止解析并取消下载任务
+func (fs *FS) DownloadByNameContext(ctx context.Context, indexPeer peer.ID, name string, ownerPriv *ecdsa.PrivateKey) (*downloads.DownloadSuccessInfo, error) {
+	fileID, err := fs.ResolveNameContext(ctx, indexPeer, name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.download.NewDownloadContext(ctx, fs.opt, fs.afe, fs.p2p, fs.pub, fileID, ownerPriv)
+}
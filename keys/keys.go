@@ -0,0 +1,110 @@
+// Package keys 提供文件加密密钥的获取方式
+// 默认由所有者私钥与文件唯一标识派生；也可由口令派生，或通过回调交给外部的密钥管理系统(KMS/HSM)，
+// 使文件加密密钥不必依赖传入上传接口的原始私钥
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/wallets"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// KeySize 文件加密密钥的长度
+const KeySize = 32
+
+// passphraseIterations 口令派生主密钥的迭代次数
+const passphraseIterations = 210000
+
+// KeyProvider 获取文件加密密钥
+// 同一所有者与文件必须始终返回相同的密钥，否则此前上传的文件无法解密
+type KeyProvider interface {
+	// FileKey 获取文件加密密钥
+	// 参数：
+	//   - owner: *ecdsa.PrivateKey 文件所有者的私钥
+	//   - fileID: string 文件唯一标识
+	//
+	// 返回值：
+	//   - []byte: 长度为 KeySize 的文件加密密钥
+	//   - error: 获取失败时返回错误
+	FileKey(owner *ecdsa.PrivateKey, fileID string) ([]byte, error)
+}
+
+// Local 由所有者私钥与文件唯一标识派生文件加密密钥，是默认的获取方式
+type Local struct{}
+
+// FileKey 实现 KeyProvider 接口
+func (Local) FileKey(owner *ecdsa.PrivateKey, fileID string) ([]byte, error) {
+	if owner == nil {
+		return nil, fmt.Errorf("%w: 所有者密钥不可为空", errs.ErrInvalidArgument)
+	}
+	return DeriveLocal(owner, []byte(fileID)), nil
+}
+
+// DeriveLocal 由私钥的 D 值与校验和(文件唯一标识)计算 SHA-256 作为文件加密密钥
+func DeriveLocal(owner *ecdsa.PrivateKey, checksum []byte) []byte {
+	hasher := sha256.New()
+	hasher.Write(owner.D.Bytes())
+	hasher.Write(checksum)
+	return hasher.Sum(nil)
+}
+
+// Passphrase 由口令派生文件加密密钥
+// 口令与盐值经 PBKDF2 派生主密钥，再以所有者公钥和文件唯一标识派生各文件的密钥，
+// 同一口令用于不同身份时得到不同的密钥
+type Passphrase struct {
+	master []byte // 主密钥
+}
+
+// NewPassphrase 由口令创建文件加密密钥的获取方式
+// 参数：
+//   - passphrase: []byte 口令
+//   - salt: []byte 盐值，需与口令一同妥善保存
+//
+// 返回值：
+//   - *Passphrase: 文件加密密钥的获取方式
+//   - error: 口令或盐值为空时返回错误
+func NewPassphrase(passphrase, salt []byte) (*Passphrase, error) {
+	if len(passphrase) == 0 || len(salt) == 0 {
+		return nil, fmt.Errorf("%w: 口令与盐值不可为空", errs.ErrInvalidArgument)
+	}
+	return &Passphrase{master: pbkdf2.Key(passphrase, salt, passphraseIterations, KeySize, sha256.New)}, nil
+}
+
+// FileKey 实现 KeyProvider 接口
+func (p *Passphrase) FileKey(owner *ecdsa.PrivateKey, fileID string) ([]byte, error) {
+	if owner == nil {
+		return nil, fmt.Errorf("%w: 所有者密钥不可为空", errs.ErrInvalidArgument)
+	}
+	pub, err := wallets.MarshalPublicKey(owner.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, p.master)
+	mac.Write(pub)
+	mac.Write([]byte(fileID))
+	return mac.Sum(nil), nil
+}
+
+// Func 通过回调从外部的密钥管理系统获取文件加密密钥
+// 回调只收到所有者的公钥，私钥不会交给外部系统
+type Func func(owner *ecdsa.PublicKey, fileID string) ([]byte, error)
+
+// FileKey 实现 KeyProvider 接口，并检查回调返回的密钥长度
+func (f Func) FileKey(owner *ecdsa.PrivateKey, fileID string) ([]byte, error) {
+	if owner == nil {
+		return nil, fmt.Errorf("%w: 所有者密钥不可为空", errs.ErrInvalidArgument)
+	}
+	key, err := f(&owner.PublicKey, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("从密钥管理系统获取文件 %s 的密钥失败: %w", fileID, err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("%w: 密钥管理系统返回的密钥长度为 %d 字节，应为 %d 字节", errs.ErrInvalidArgument, len(key), KeySize)
+	}
+	return key, nil
+}
@@ -0,0 +1,57 @@
+package keys
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"github.com/bpfs/defs/errs"
+)
+
+func TestProviders(t *testing.T) {
+	alice, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	bob, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	// 默认方式与此前的派生结果一致
+	sum := sha256.Sum256(append(alice.D.Bytes(), "file-1"...))
+	want := sum[:]
+	if got, err := (Local{}).FileKey(alice, "file-1"); err != nil || !bytes.Equal(got, want) {
+		t.Fatalf("默认方式的密钥应保持不变: %v", err)
+	}
+
+	p, err := NewPassphrase([]byte("correct horse"), []byte("salt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k1, _ := p.FileKey(alice, "file-1")
+	k2, _ := p.FileKey(alice, "file-1")
+	k3, _ := p.FileKey(bob, "file-1")
+	k4, _ := p.FileKey(alice, "file-2")
+	if len(k1) != KeySize || !bytes.Equal(k1, k2) {
+		t.Fatal("同一所有者与文件应得到相同的密钥")
+	}
+	if bytes.Equal(k1, k3) || bytes.Equal(k1, k4) {
+		t.Fatal("不同所有者或文件应得到不同的密钥")
+	}
+	if _, err := NewPassphrase(nil, []byte("salt")); !errors.Is(err, errs.ErrInvalidArgument) {
+		t.Fatalf("空口令应被拒绝: %v", err)
+	}
+
+	kms := Func(func(owner *ecdsa.PublicKey, fileID string) ([]byte, error) {
+		if !owner.Equal(&alice.PublicKey) {
+			t.Fatal("回调应收到所有者的公钥")
+		}
+		return bytes.Repeat([]byte{1}, KeySize), nil
+	})
+	if key, err := kms.FileKey(alice, "file-1"); err != nil || len(key) != KeySize {
+		t.Fatalf("回调返回的密钥应被使用: %v", err)
+	}
+	short := Func(func(*ecdsa.PublicKey, string) ([]byte, error) { return []byte{1}, nil })
+	if _, err := short.FileKey(alice, "file-1"); !errors.Is(err, errs.ErrInvalidArgument) {
+		t.Fatalf("长度错误的密钥应被拒绝: %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package kv
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/bpfs/defs/crypto/gcm"
+	"github.com/bpfs/defs/debug"
+	sign "github.com/bpfs/defs/sign/ecdsa"
+	"github.com/bpfs/defs/util"
+	"github.com/bpfs/defs/wallets"
+	"github.com/sirupsen/logrus"
+)
+
+// Entry 描述一条经过所有者签名的键值记录
+// 删除以墓碑记录表示，保证删除操作同样可以复制并参与合并
+type Entry struct {
+	Owner     string // 所有者公钥哈希的十六进制字符串
+	PublicKey []byte // 所有者公钥
+	Key       string // 键
+	Value     []byte // 加密后的值，删除时为空
+	Deleted   bool   // 是否为删除记录
+	UpdatedAt int64  // 记录更新的时间戳(纳秒)，用于解决复制冲突
+	Signature []byte // 所有者对记录的签名
+}
+
+// NewEntry 创建并签名一条新的键值记录
+// 参数：
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥
+//   - key: string 键
+//   - value: []byte 值的明文，deleted 为 true 时忽略
+//   - deleted: bool 是否为删除记录
+//   - after: int64 本地已有同一键记录的更新时间戳，新记录的时间戳至少比它大 1，避免时钟回拨导致写入被丢弃
+//
+// 返回值：
+//   - *Entry: 签名后的键值记录
+//   - error: 如果发生错误，返回错误信息
+func NewEntry(ownerPriv *ecdsa.PrivateKey, key string, value []byte, deleted bool, after int64) (*Entry, error) {
+	if ownerPriv == nil {
+		return nil, fmt.Errorf("所有者私钥不能为空")
+	}
+	if key == "" || len(key) > MaxKeyLength {
+		return nil, fmt.Errorf("键的长度须在 1 到 %d 之间", MaxKeyLength)
+	}
+
+	publicKey, err := wallets.MarshalPublicKey(ownerPriv.PublicKey)
+	if err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return nil, err
+	}
+	pubKeyHash, ok := wallets.PrivateKeyToPublicKeyHash(ownerPriv)
+	if !ok {
+		return nil, fmt.Errorf("通过私钥生成公钥哈希时失败")
+	}
+
+	updatedAt := time.Now().UnixNano()
+	if updatedAt <= after {
+		updatedAt = after + 1
+	}
+
+	entry := &Entry{
+		Owner:     hex.EncodeToString(pubKeyHash),
+		PublicKey: publicKey,
+		Key:       key,
+		Deleted:   deleted,
+		UpdatedAt: updatedAt,
+	}
+
+	// 值使用所有者私钥派生的密钥加密，复制到的节点无法读取明文
+	if !deleted {
+		if entry.Value, err = gcm.EncryptData(value, valueKey(ownerPriv)); err != nil {
+			return nil, fmt.Errorf("加密值时失败: %v", err)
+		}
+	}
+
+	data, err := entry.signingData()
+	if err != nil {
+		return nil, err
+	}
+	if entry.Signature, err = sign.SignData(ownerPriv, data); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// Verify 验证键值记录的签名及所有者
+// 返回值：
+//   - error: 验证失败时返回错误信息
+func (e *Entry) Verify() error {
+	if e.Key == "" || len(e.Key) > MaxKeyLength {
+		return fmt.Errorf("无效的键")
+	}
+
+	publicKey, err := wallets.UnmarshalPublicKey(e.PublicKey)
+	if err != nil {
+		return err
+	}
+	pubKeyHash, ok := wallets.PublicKeyToPublicKeyHash(publicKey)
+	if !ok || hex.EncodeToString(pubKeyHash) != e.Owner {
+		return fmt.Errorf("记录所有者与公钥不匹配")
+	}
+
+	data, err := e.signingData()
+	if err != nil {
+		return err
+	}
+	valid, err := sign.VerifySignature(&publicKey, data, e.Signature)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return fmt.Errorf("键值记录签名无效")
+	}
+	return nil
+}
+
+// Open 使用所有者私钥解密值
+// 参数：
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥
+//
+// 返回值：
+//   - []byte: 值的明文
+//   - error: 解密失败时返回错误信息
+func (e *Entry) Open(ownerPriv *ecdsa.PrivateKey) ([]byte, error) {
+	if e.Deleted {
+		return nil, nil
+	}
+	value, err := gcm.DecryptData(e.Value, valueKey(ownerPriv))
+	if err != nil {
+		return nil, fmt.Errorf("解密值时失败: %v", err)
+	}
+	return value, nil
+}
+
+// newerThan 检查记录是否比另一条记录更新
+// 时间戳相同时按签名字节序比较，保证所有节点得到相同的结果
+func (e *Entry) newerThan(other *Entry) bool {
+	if e.UpdatedAt != other.UpdatedAt {
+		return e.UpdatedAt > other.UpdatedAt
+	}
+	return string(e.Signature) > string(other.Signature)
+}
+
+// signingData 返回记录中参与签名的字段
+func (e *Entry) signingData() ([]byte, error) {
+	return util.MergeFieldsForSigning(e.Owner, e.PublicKey, e.Key, e.Value, e.Deleted, e.UpdatedAt)
+}
+
+// valueKey 由所有者私钥派生加密值的密钥
+func valueKey(ownerPriv *ecdsa.PrivateKey) []byte {
+	hasher := sha256.New()
+	hasher.Write([]byte("defs-kv"))
+	hasher.Write(ownerPriv.D.Bytes())
+	return hasher.Sum(nil)
+}
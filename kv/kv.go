@@ -0,0 +1,23 @@
+// Package kv 实现了按身份划分的小型可变键值存储。
+// 每个身份(所有者公钥)拥有独立的命名空间，值使用由所有者私钥派生的密钥加密并经所有者签名，
+// 在持有同一身份的节点之间通过订阅复制、定时同步，按"最后写入者获胜"的规则合并。
+// 适用于应用设置、命名记录、分享链接状态等小型可变数据，不适用于大文件。
+package kv
+
+import "fmt"
+
+const (
+	version = "1.0.0" // 键值协议版本
+
+	MaxKeyLength = 256 // 键的最大长度
+)
+
+var (
+	// 同步键值记录
+	StreamKVSyncProtocol = fmt.Sprintf("defs@stream/kv/sync/%s", version)
+)
+
+// replicateTopic 返回指定身份的键值复制主题，只有持有该身份的节点订阅
+func replicateTopic(owner string) string {
+	return fmt.Sprintf("defs@pubsub/kv/replicate/%s/%s", owner, version)
+}
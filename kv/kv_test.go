@@ -0,0 +1,136 @@
+package kv
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/opts"
+)
+
+func TestEntryMerge(t *testing.T) {
+	owner, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	store := newStore(context.Background(), 1024, 2)
+
+	first, err := NewEntry(owner, "theme", []byte("dark"), false, 0)
+	if err != nil {
+		t.Fatalf("创建键值记录失败: %v", err)
+	}
+	if err := first.Verify(); err != nil {
+		t.Fatalf("验证键值记录失败: %v", err)
+	}
+	if ok, _ := store.Put(first); !ok {
+		t.Fatal("新记录应被采纳")
+	}
+
+	// 更新的记录覆盖旧记录，旧记录不能回滚
+	second, _ := NewEntry(owner, "theme", []byte("light"), false, store.UpdatedAt(first.Owner, "theme"))
+	if ok, _ := store.Put(second); !ok {
+		t.Fatal("更新的记录应被采纳")
+	}
+	if ok, _ := store.Put(first); ok {
+		t.Fatal("旧记录不应覆盖新记录")
+	}
+	entry, ok := store.Get(first.Owner, "theme")
+	if !ok {
+		t.Fatal("记录应存在")
+	}
+	value, err := entry.Open(owner)
+	if err != nil || string(value) != "light" {
+		t.Fatalf("解密值失败: %q %v", value, err)
+	}
+	if _, err := entry.Open(other); err == nil {
+		t.Fatal("其他身份不应能解密值")
+	}
+
+	// 删除记录
+	tombstone, _ := NewEntry(owner, "theme", nil, true, store.UpdatedAt(first.Owner, "theme"))
+	store.Put(tombstone)
+	if _, ok := store.Get(first.Owner, "theme"); ok {
+		t.Fatal("删除后记录不应存在")
+	}
+	if len(store.Diff(first.Owner, nil)) != 1 {
+		t.Fatal("删除记录应参与同步")
+	}
+
+	// 篡改的记录
+	forged := *second
+	forged.Key = "other"
+	if err := forged.Verify(); err == nil {
+		t.Fatal("篡改的记录不应通过验证")
+	}
+
+	// 大小与数量上限
+	large, _ := NewEntry(owner, "large", make([]byte, 2048), false, 0)
+	if _, err := store.Put(large); !errors.Is(err, errs.ErrQuotaExceeded) {
+		t.Fatalf("超过大小上限的值应被拒绝: %v", err)
+	}
+	// 删除记录不占用键的数量
+	a, _ := NewEntry(owner, "a", []byte("1"), false, 0)
+	b, _ := NewEntry(owner, "b", []byte("2"), false, 0)
+	c, _ := NewEntry(owner, "c", []byte("3"), false, 0)
+	store.Put(a)
+	if _, err := store.Put(b); err != nil {
+		t.Fatalf("删除记录不应计入键数量: %v", err)
+	}
+	if _, err := store.Put(c); !errors.Is(err, errs.ErrQuotaExceeded) {
+		t.Fatalf("超过键数量上限应被拒绝: %v", err)
+	}
+
+	// 超过保留时间的删除记录被移除
+	if n := store.Collect(time.Now().Add(time.Hour)); n != 1 {
+		t.Fatalf("应移除 1 条删除记录: %d", n)
+	}
+	if store.UpdatedAt(first.Owner, "theme") != 0 {
+		t.Fatal("删除记录应被移除")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	owner, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	local := newStore(context.Background(), 1024, 16)
+	remote := newStore(context.Background(), 1024, 16)
+
+	// 远端先写入较新的键，随后收到较旧的键：按最新更新时间同步会遗漏较旧的键
+	newer, _ := NewEntry(owner, "newer", []byte("1"), false, 0)
+	older, _ := NewEntry(owner, "older", []byte("2"), false, 0)
+	older.UpdatedAt = newer.UpdatedAt - int64(time.Hour)
+	local.Put(newer)
+	remote.Put(newer)
+	remote.Put(older)
+
+	diff := remote.Diff(newer.Owner, local.Versions(newer.Owner))
+	if len(diff) != 1 || diff[0].Key != "older" {
+		t.Fatalf("应只返回本地缺少的记录: %v", diff)
+	}
+	if len(remote.Diff(newer.Owner, remote.Versions(newer.Owner))) != 0 {
+		t.Fatal("版本相同时不应返回记录")
+	}
+}
+
+func TestReadOnlyStore(t *testing.T) {
+	owner, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	store := newStore(context.Background(), 1024, 2)
+	store.opt = opts.DefaultOptions()
+	store.opt.BuildReadOnly(true)
+
+	entry, _ := NewEntry(owner, "theme", []byte("dark"), false, 0)
+	if _, err := store.Put(entry); !errors.Is(err, errs.ErrReadOnly) {
+		t.Fatalf("只读模式下应拒绝写入: %v", err)
+	}
+	if _, ok := store.Get(entry.Owner, "theme"); ok {
+		t.Fatal("只读模式下不应写入记录")
+	}
+
+	// 运行时关闭只读模式后恢复写入
+	store.opt.BuildReadOnly(false)
+	if ok, err := store.Put(entry); !ok || err != nil {
+		t.Fatalf("关闭只读模式后应允许写入: %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,267 @@
+package kv
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/network"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/supervise"
+	"github.com/bpfs/defs/util"
+	"github.com/bpfs/defs/wallets"
+	"github.com/bpfs/dep2p"
+	"github.com/bpfs/dep2p/pubsub"
+	"github.com/bpfs/dep2p/streams"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+)
+
+// syncInterval 持有同一身份的节点之间发起同步的间隔
+const syncInterval = 5 * time.Minute
+
+// Replicator 在持有同一身份的节点之间复制键值记录
+type Replicator struct {
+	Ctx    context.Context     // 全局上下文
+	Opt    *opts.Options       // 文件存储选项配置
+	P2P    *dep2p.DeP2P        // 网络主机
+	PubSub *pubsub.DeP2PPubSub // 网络订阅
+	KV     *Store              // 键值存储
+
+	supervisor *supervise.Supervisor // 后台任务的崩溃恢复
+
+	mu     sync.Mutex
+	joined map[string]bool // 已加入复制的身份
+}
+
+type NewReplicatorInput struct {
+	fx.In
+	LC         fx.Lifecycle
+	Ctx        context.Context       // 全局上下文
+	Opt        *opts.Options         // 文件存储选项配置
+	P2P        *dep2p.DeP2P          // 网络主机
+	PubSub     *pubsub.DeP2PPubSub   // 网络订阅
+	KV         *Store                // 键值存储
+	Supervisor *supervise.Supervisor // 后台任务的崩溃恢复
+}
+
+type NewReplicatorOutput struct {
+	fx.Out
+	Replicator *Replicator // 键值复制
+}
+
+// NewReplicator 创建键值复制并注册同步协议
+// 启动时自动加入默认所有者身份的复制，其他身份在首次写入或调用 Join 时加入
+func NewReplicator(input NewReplicatorInput) (out NewReplicatorOutput) {
+	r := &Replicator{
+		Ctx:        input.Ctx,
+		Opt:        input.Opt,
+		P2P:        input.P2P,
+		PubSub:     input.PubSub,
+		KV:         input.KV,
+		supervisor: input.Supervisor,
+		joined:     make(map[string]bool),
+	}
+	out.Replicator = r
+
+	input.LC.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			// 注册同步键值记录
+			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamKVSyncProtocol), network.HandlerWithLimits(StreamKVSyncProtocol, network.HandlerWithRW(r.handleSync)))
+
+			// 加入默认所有者身份的复制
+			if priv := input.Opt.GetDefaultOwnerPriv(); priv != nil {
+				if pubKeyHash, ok := wallets.PrivateKeyToPublicKeyHash(priv); ok {
+					if err := r.Join(hex.EncodeToString(pubKeyHash)); err != nil {
+						logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+					}
+				}
+			}
+
+			// 定时向持有同一身份的节点请求遗漏的记录
+			input.Supervisor.Go("kv", "periodic-sync", r.periodicSync)
+
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			return nil
+		},
+	})
+
+	return out
+}
+
+// Join 加入指定身份的复制，订阅其复制主题并立即从已订阅的节点同步
+// 参数：
+//   - owner: string 所有者公钥哈希的十六进制字符串
+//
+// 返回值：
+//   - error: 订阅失败时返回错误
+func (r *Replicator) Join(owner string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.joined[owner] {
+		return nil
+	}
+
+	if err := r.PubSub.SubscribeWithTopic(replicateTopic(owner), network.PubSubHandler(replicateTopic(owner), func(res *streams.RequestMessage) { r.handleReplicatePubSub(owner, res) }), true); err != nil {
+		return err
+	}
+	r.joined[owner] = true
+
+	r.supervisor.Spawn("kv", "sync-owner", func() { r.syncOwner(owner) })
+	return nil
+}
+
+// Publish 保存一条本地签名的键值记录并复制到持有同一身份的其他节点
+// 参数：
+//   - entry: *Entry 签名后的键值记录
+//
+// 返回值：
+//   - error: 超过大小上限或复制失败时返回错误
+func (r *Replicator) Publish(entry *Entry) error {
+	if err := entry.Verify(); err != nil {
+		return err
+	}
+	if err := r.Join(entry.Owner); err != nil {
+		return err
+	}
+	accepted, err := r.KV.Put(entry)
+	if err != nil {
+		return err
+	}
+	if !accepted {
+		return fmt.Errorf("已存在更新的键值记录")
+	}
+	return network.SendPubSub(r.P2P, r.PubSub, replicateTopic(entry.Owner), "replicate", "", entry)
+}
+
+// 同步键值记录的请求消息
+// 请求方列出已有的每个键的版本，对方返回请求方缺少或版本不同的记录，
+// 因此以任意顺序写入的记录都能同步，不依赖最新的更新时间
+type SyncReq struct {
+	Owner    string             // 所有者公钥哈希的十六进制字符串
+	Versions map[string]Version // 请求方每个键的版本
+}
+
+// handleSync 处理同步键值记录，返回请求方缺少或版本不同的记录
+// 值已加密，因此无需验证请求方的身份
+func (r *Replicator) handleSync(req *streams.RequestMessage, res *streams.ResponseMessage) (int32, string) {
+	payload := new(SyncReq)
+	if err := util.DecodeFromBytes(req.Payload, payload); err != nil {
+		logrus.Errorf("[%s]解码错误: %v", debug.WhereAmI(), err)
+		return 6603, "解码错误"
+	}
+
+	entriesBytes, err := util.EncodeToBytes(r.KV.Diff(payload.Owner, payload.Versions))
+	if err != nil {
+		return 6605, err.Error()
+	}
+
+	res.Data = entriesBytes
+	return 200, "成功"
+}
+
+// handleReplicatePubSub 处理持有同一身份的其他节点复制的键值记录
+// 只接受已加入复制的身份在其复制主题上的记录，其他身份的签名记录不能借用该主题写入
+// 参数：
+//   - owner: string 复制主题所属的身份
+//   - res: *streams.RequestMessage 订阅消息
+func (r *Replicator) handleReplicatePubSub(owner string, res *streams.RequestMessage) {
+	if res.Message.Sender == r.P2P.Host().ID().String() || r.Opt.GetReadOnly() {
+		return
+	}
+	r.mu.Lock()
+	joined := r.joined[owner]
+	r.mu.Unlock()
+	if !joined {
+		return
+	}
+
+	switch res.Message.Type {
+	case "replicate":
+		entry := new(Entry)
+		if err := util.DecodeFromBytes(res.Payload, entry); err != nil {
+			logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+			return
+		}
+		if entry.Owner != owner {
+			logrus.Warnf("[%s]忽略身份 %s 复制主题上身份 %s 的键值记录", debug.WhereAmI(), owner, entry.Owner)
+			return
+		}
+		if err := entry.Verify(); err != nil {
+			logrus.Warnf("[%s]键值记录验证失败: %v", debug.WhereAmI(), err)
+			return
+		}
+		if _, err := r.KV.Put(entry); err != nil {
+			logrus.Warnf("[%s]: %v", debug.WhereAmI(), err)
+		}
+
+	default:
+		return
+	}
+}
+
+// periodicSync 定时从持有同一身份的节点拉取遗漏的记录，弥补丢失的订阅消息
+func (r *Replicator) periodicSync() {
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Ctx.Done():
+			return
+		case <-ticker.C:
+			r.mu.Lock()
+			owners := make([]string, 0, len(r.joined))
+			for owner := range r.joined {
+				owners = append(owners, owner)
+			}
+			r.mu.Unlock()
+
+			for _, owner := range owners {
+				r.syncOwner(owner)
+			}
+		}
+	}
+}
+
+// syncOwner 从订阅了身份复制主题的所有节点同步该身份的记录
+func (r *Replicator) syncOwner(owner string) {
+	for _, peerID := range r.PubSub.ListPeers(replicateTopic(owner)) {
+		if err := r.syncFrom(peerID, owner); err != nil {
+			logrus.Debugf("[%s]从节点 %s 同步键值记录失败: %v", debug.WhereAmI(), peerID, err)
+		}
+	}
+}
+
+// syncFrom 从指定节点同步身份的键值记录
+func (r *Replicator) syncFrom(receiver peer.ID, owner string) error {
+	if r.Opt.GetReadOnly() {
+		return nil
+	}
+	res, err := network.SendStreamContext(r.Ctx, r.P2P, StreamKVSyncProtocol, "", receiver, SyncReq{Owner: owner, Versions: r.KV.Versions(owner)})
+	if err != nil {
+		return err
+	}
+	if res == nil || res.Code != 200 || len(res.Data) == 0 {
+		return nil
+	}
+
+	var entries []*Entry
+	if err := util.DecodeFromBytes(res.Data, &entries); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Owner != owner || entry.Verify() != nil {
+			continue
+		}
+		r.KV.Put(entry)
+	}
+	return nil
+}
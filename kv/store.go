@@ -0,0 +1,385 @@
+package kv
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/defs/supervise"
+	"github.com/bpfs/defs/util"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+)
+
+// TombstoneTTL 删除记录的保留时间，超过后删除记录被移除，不再占用键的数量
+const TombstoneTTL = 30 * 24 * time.Hour
+
+// Store 保存各身份的键值记录
+// 同一键的多条记录按"最后写入者获胜"的规则合并，持有同一身份的节点之间最终达成一致
+type Store struct {
+	ctx        context.Context              // 上下文用于管理协程的生命周期
+	cancel     context.CancelFunc           // 取消函数
+	Mu         sync.RWMutex                 // 用于保护状态的读写锁
+	Entries    map[string]map[string]*Entry // 键值记录，第一层键为所有者公钥哈希，第二层为键
+	SaveToFile chan struct{}                // 保存记录至文件通道
+
+	maxValueSize int           // 单个值的大小上限
+	maxKeys      int           // 单个身份未删除的键数量上限
+	opt          *opts.Options // 文件存储选项配置，写入时检查是否处于只读模式
+}
+
+type NewStoreInput struct {
+	fx.In
+	LC         fx.Lifecycle
+	Ctx        context.Context       // 全局上下文
+	Opt        *opts.Options         // 文件存储选项配置
+	Supervisor *supervise.Supervisor // 后台任务的崩溃恢复
+}
+
+type NewStoreOutput struct {
+	fx.Out
+	KV *Store // 键值存储
+}
+
+// NewStore 创建并初始化一个新的键值存储
+// 参数：
+//   - input: NewStoreInput 用于初始化 Store 的输入结构体。
+//
+// 返回值：
+//   - NewStoreOutput: 包含 Store 的输出结构体。
+func NewStore(input NewStoreInput) (out NewStoreOutput) {
+	maxValueSize, maxKeys := input.Opt.GetKVLimits()
+	store := newStore(input.Ctx, maxValueSize, maxKeys)
+	store.opt = input.Opt
+
+	filePath := filepath.Join(paths.GetDBDir(), "kv") // 设置文件路径
+	// 加载记录
+	entries, err := LoadEntriesFromFile(filePath)
+	if err == nil {
+		for _, entry := range entries {
+			store.put(entry)
+		}
+	}
+
+	out.KV = store
+
+	// 后台任务崩溃时保存键值
+	input.Supervisor.OnCrash("kv", func() { store.saveEntries(filePath) })
+
+	input.LC.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			// 启动定时保存记录的定时器
+			input.Supervisor.Go("kv", "periodic-save", func() { store.PeriodicSave(filePath, time.Minute) })
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			store.cancel()
+			store.saveEntries(filePath)
+			return nil
+		},
+	})
+
+	return out
+}
+
+// newStore 创建键值存储
+func newStore(ctx context.Context, maxValueSize, maxKeys int) *Store {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Store{
+		ctx:          ctx,
+		cancel:       cancel,
+		Entries:      make(map[string]map[string]*Entry),
+		SaveToFile:   make(chan struct{}, 1), // 缓冲区大小为1，只保存最新的信息
+		maxValueSize: maxValueSize,
+		maxKeys:      maxKeys,
+	}
+}
+
+// Put 合并一条已验证的键值记录
+// 参数：
+//   - entry: *Entry 键值记录
+//
+// 返回值：
+//   - bool: 记录被采纳返回 true；已存在相同或更新的记录返回 false
+//   - error: 值或未删除的键数量超过上限时返回包装了 errs.ErrQuotaExceeded 的错误，只读模式下返回包装了 errs.ErrReadOnly 的错误
+func (s *Store) Put(entry *Entry) (bool, error) {
+	if s.opt != nil {
+		if err := s.opt.CheckWritable("写入键值记录"); err != nil {
+			return false, err
+		}
+	}
+	if s.maxValueSize > 0 && len(entry.Value) > s.maxValueSize {
+		return false, fmt.Errorf("%w: 值的大小 %d 超过上限 %d", errs.ErrQuotaExceeded, len(entry.Value), s.maxValueSize)
+	}
+
+	s.Mu.Lock()
+	if existing := s.Entries[entry.Owner][entry.Key]; s.maxKeys > 0 && !entry.Deleted && (existing == nil || existing.Deleted) && s.liveKeys(entry.Owner) >= s.maxKeys {
+		s.Mu.Unlock()
+		return false, fmt.Errorf("%w: 键的数量超过上限 %d", errs.ErrQuotaExceeded, s.maxKeys)
+	}
+	accepted := s.put(entry)
+	s.Mu.Unlock()
+
+	if accepted {
+		s.SaveToFileSingleChan()
+	}
+	return accepted, nil
+}
+
+// put 在持有锁的情况下合并记录
+func (s *Store) put(entry *Entry) bool {
+	keys, ok := s.Entries[entry.Owner]
+	if !ok {
+		keys = make(map[string]*Entry)
+		s.Entries[entry.Owner] = keys
+	}
+	if existing, ok := keys[entry.Key]; ok && !entry.newerThan(existing) {
+		return false
+	}
+	keys[entry.Key] = entry
+	return true
+}
+
+// Get 获取键值记录，删除记录视为不存在
+// 参数：
+//   - owner: string 所有者公钥哈希的十六进制字符串
+//   - key: string 键
+//
+// 返回值：
+//   - *Entry: 键值记录
+//   - bool: 记录是否存在
+func (s *Store) Get(owner, key string) (*Entry, bool) {
+	s.Mu.RLock()
+	defer s.Mu.RUnlock()
+	entry, ok := s.Entries[owner][key]
+	if !ok || entry.Deleted {
+		return nil, false
+	}
+	return entry, true
+}
+
+// Keys 返回身份下所有未删除的键，按字典序排列
+func (s *Store) Keys(owner string) []string {
+	s.Mu.RLock()
+	keys := make([]string, 0, len(s.Entries[owner]))
+	for key, entry := range s.Entries[owner] {
+		if !entry.Deleted {
+			keys = append(keys, key)
+		}
+	}
+	s.Mu.RUnlock()
+
+	sort.Strings(keys)
+	return keys
+}
+
+// UpdatedAt 返回键的最新记录的更新时间戳(含删除记录)，不存在时返回 0
+func (s *Store) UpdatedAt(owner, key string) int64 {
+	s.Mu.RLock()
+	defer s.Mu.RUnlock()
+	if entry, ok := s.Entries[owner][key]; ok {
+		return entry.UpdatedAt
+	}
+	return 0
+}
+
+// Version 键的最新记录的版本，同步时用于比较双方的记录
+type Version struct {
+	UpdatedAt int64  // 更新时间戳(纳秒)
+	Digest    string // 签名摘要，更新时间相同时区分不同的记录
+}
+
+// versionOf 获取记录的版本
+func versionOf(entry *Entry) Version {
+	sum := sha256.Sum256(entry.Signature)
+	return Version{UpdatedAt: entry.UpdatedAt, Digest: hex.EncodeToString(sum[:8])}
+}
+
+// Versions 返回身份下每个键的最新记录的版本(含删除记录)
+// 参数：
+//   - owner: string 所有者公钥哈希的十六进制字符串
+//
+// 返回值：
+//   - map[string]Version: 键到版本的映射
+func (s *Store) Versions(owner string) map[string]Version {
+	s.Mu.RLock()
+	defer s.Mu.RUnlock()
+
+	versions := make(map[string]Version, len(s.Entries[owner]))
+	for key, entry := range s.Entries[owner] {
+		versions[key] = versionOf(entry)
+	}
+	return versions
+}
+
+// Diff 返回身份下对方缺少或版本不同的记录(含删除记录)
+// 更新时间早于对方版本的记录不会返回，版本相同但记录不同的由对方按"最后写入者获胜"的规则合并
+// 参数：
+//   - owner: string 所有者公钥哈希的十六进制字符串
+//   - versions: map[string]Version 对方每个键的版本
+//
+// 返回值：
+//   - []*Entry: 对方需要合并的键值记录
+func (s *Store) Diff(owner string, versions map[string]Version) []*Entry {
+	s.Mu.RLock()
+	defer s.Mu.RUnlock()
+
+	var result []*Entry
+	for key, entry := range s.Entries[owner] {
+		theirs, ok := versions[key]
+		if !ok || entry.UpdatedAt > theirs.UpdatedAt || (entry.UpdatedAt == theirs.UpdatedAt && versionOf(entry) != theirs) {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// Collect 移除删除时间早于指定时间的删除记录，释放其占用的键
+// 删除记录需保留足够长的时间复制到持有同一身份的所有节点，否则离线更久的节点会将已删除的值同步回来
+// 参数：
+//   - before: time.Time 截止时间
+//
+// 返回值：
+//   - int: 移除的删除记录数量
+func (s *Store) Collect(before time.Time) int {
+	s.Mu.Lock()
+	collected := 0
+	for owner, keys := range s.Entries {
+		for key, entry := range keys {
+			if entry.Deleted && entry.UpdatedAt < before.UnixNano() {
+				delete(keys, key)
+				collected++
+			}
+		}
+		if len(keys) == 0 {
+			delete(s.Entries, owner)
+		}
+	}
+	s.Mu.Unlock()
+
+	if collected > 0 {
+		s.SaveToFileSingleChan()
+	}
+	return collected
+}
+
+// liveKeys 在持有锁的情况下统计身份下未删除的键数量
+func (s *Store) liveKeys(owner string) int {
+	count := 0
+	for _, entry := range s.Entries[owner] {
+		if !entry.Deleted {
+			count++
+		}
+	}
+	return count
+}
+
+// SaveToFileSingleChan 保存记录至文件的唯一通道
+func (s *Store) SaveToFileSingleChan() {
+	select {
+	case s.SaveToFile <- struct{}{}:
+	default:
+		// 如果通道已满，先清空再发送
+		select {
+		case <-s.SaveToFile:
+		default:
+		}
+		s.SaveToFile <- struct{}{}
+	}
+}
+
+// PeriodicSave 定时保存记录到文件
+// 参数：
+//   - filePath: string 文件路径
+//   - interval: time.Duration 保存间隔
+func (s *Store) PeriodicSave(filePath string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			if s.opt == nil || !s.opt.GetReadOnly() {
+				s.Collect(time.Now().Add(-TombstoneTTL))
+			}
+			s.saveEntries(filePath)
+		case <-s.SaveToFile:
+			s.saveEntries(filePath)
+		}
+	}
+}
+
+// saveEntries 保存记录到文件
+func (s *Store) saveEntries(filePath string) {
+	s.Mu.RLock()
+	var entries []*Entry
+	for _, keys := range s.Entries {
+		for _, entry := range keys {
+			entries = append(entries, entry)
+		}
+	}
+	s.Mu.RUnlock()
+
+	if err := SaveEntriesToFile(filePath, entries); err != nil {
+		logrus.Errorf("[%s]保存键值记录失败: %v", debug.WhereAmI(), err)
+	}
+}
+
+// LoadEntriesFromFile 从文件加载键值记录
+// 参数：
+//   - filePath: string 文件路径
+//
+// 返回值：
+//   - []*Entry: 键值记录
+//   - error: 如果发生错误，返回错误信息
+func LoadEntriesFromFile(filePath string) ([]*Entry, error) {
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		logrus.Errorf("[%s]读取文件内容时失败: %v", debug.WhereAmI(), err)
+		return nil, err
+	}
+
+	var entries []*Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		logrus.Errorf("[%s]反序列化键值记录时失败: %v", debug.WhereAmI(), err)
+		return nil, err
+	}
+	return entries, nil
+}
+
+// SaveEntriesToFile 将键值记录保存到文件
+// 参数：
+//   - filePath: string 文件路径
+//   - entries: []*Entry 键值记录
+//
+// 返回值：
+//   - error: 如果发生错误，返回错误信息
+func SaveEntriesToFile(filePath string, entries []*Entry) error {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+
+	return util.WriteFileAtomic(afero.NewOsFs(), filePath, data, 0644)
+}
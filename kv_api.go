@@ -0,0 +1,111 @@
+package defs
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/kv"
+	"github.com/bpfs/defs/wallets"
+	"github.com/sirupsen/logrus"
+)
+
+// KVPut 写入键值，并复制到持有同一身份的其他节点
+// 参数：
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥，为 nil 时使用默认所有者
+//   - key: string 键
+//   - value: []byte 值
+//
+// 返回值：
+//   - error: 值或键数量超过上限时返回包装了 errs.ErrQuotaExceeded 的错误
+func (fs *FS) KVPut(ownerPriv *ecdsa.PrivateKey, key string, value []byte) error {
+	return fs.kvWrite(ownerPriv, key, value, false)
+}
+
+// KVDelete 删除键值，删除同样会复制到持有同一身份的其他节点
+// 演练模式下只检查键是否存在，不删除也不复制
+// 参数：
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥，为 nil 时使用默认所有者
+//   - key: string 键
+//
+// 返回值：
+//   - error: 如果发生错误，返回错误信息；演练模式下键不存在时返回包装了 errs.ErrNotFound 的错误
+func (fs *FS) KVDelete(ownerPriv *ecdsa.PrivateKey, key string) error {
+	if fs.opt.GetDryRun() {
+		_, owner, err := fs.kvOwner(ownerPriv)
+		if err != nil {
+			return err
+		}
+		if _, ok := fs.kv.Get(owner, key); !ok {
+			return fmt.Errorf("%w: 键 %s", errs.ErrNotFound, key)
+		}
+		logrus.Infof("[%s]演练模式: 将删除键 %s", debug.WhereAmI(), key)
+		return nil
+	}
+	return fs.kvWrite(ownerPriv, key, nil, true)
+}
+
+// KVGet 读取键值
+// 参数：
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥，为 nil 时使用默认所有者
+//   - key: string 键
+//
+// 返回值：
+//   - []byte: 值
+//   - error: 键不存在时返回包装了 errs.ErrNotFound 的错误
+func (fs *FS) KVGet(ownerPriv *ecdsa.PrivateKey, key string) ([]byte, error) {
+	ownerPriv, owner, err := fs.kvOwner(ownerPriv)
+	if err != nil {
+		return nil, err
+	}
+	entry, ok := fs.kv.Get(owner, key)
+	if !ok {
+		return nil, fmt.Errorf("%w: 键 %s", errs.ErrNotFound, key)
+	}
+	return entry.Open(ownerPriv)
+}
+
+// KVKeys 列出身份下的所有键
+// 参数：
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥，为 nil 时使用默认所有者
+//
+// 返回值：
+//   - []string: 按字典序排列的键
+//   - error: 如果发生错误，返回错误信息
+func (fs *FS) KVKeys(ownerPriv *ecdsa.PrivateKey) ([]string, error) {
+	_, owner, err := fs.kvOwner(ownerPriv)
+	if err != nil {
+		return nil, err
+	}
+	return fs.kv.Keys(owner), nil
+}
+
+// kvWrite 签名并发布一条键值记录
+func (fs *FS) kvWrite(ownerPriv *ecdsa.PrivateKey, key string, value []byte, deleted bool) error {
+	ownerPriv, owner, err := fs.kvOwner(ownerPriv)
+	if err != nil {
+		return err
+	}
+	entry, err := kv.NewEntry(ownerPriv, key, value, deleted, fs.kv.UpdatedAt(owner, key))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errs.ErrInvalidArgument, err)
+	}
+	return fs.kvReplicator.Publish(entry)
+}
+
+// kvOwner 返回所有者的私钥及公钥哈希
+func (fs *FS) kvOwner(ownerPriv *ecdsa.PrivateKey) (*ecdsa.PrivateKey, string, error) {
+	if ownerPriv == nil {
+		ownerPriv = fs.opt.GetDefaultOwnerPriv()
+		if ownerPriv == nil {
+			return nil, "", fmt.Errorf("%w: 所有者密钥不可为空", errs.ErrInvalidArgument)
+		}
+	}
+	pubKeyHash, ok := wallets.PrivateKeyToPublicKeyHash(ownerPriv)
+	if !ok {
+		return nil, "", fmt.Errorf("通过私钥生成公钥哈希时失败")
+	}
+	return ownerPriv, hex.EncodeToString(pubKeyHash), nil
+}
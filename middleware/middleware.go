@@ -0,0 +1,166 @@
+// Package middleware 提供上传与下载流程中的中间件注册点。
+// 集成方可以在片段发送前、片段接收后以及任务完成前插入自定义逻辑(如病毒扫描、合规检查、数据转换)，
+// 而无需修改流程代码。任一中间件返回错误时，当前操作会被中止。
+package middleware
+
+import (
+	"context"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// TaskKind 任务类型
+type TaskKind string
+
+const (
+	TaskUpload   TaskKind = "upload"   // 上传任务
+	TaskDownload TaskKind = "download" // 下载任务
+)
+
+// SegmentSendContext 描述即将发送到网络的文件片段
+type SegmentSendContext struct {
+	Ctx       context.Context // 任务上下文
+	TaskID    string          // 任务唯一标识
+	FileID    string          // 文件唯一标识
+	SegmentID string          // 文件片段的唯一标识
+	Index     int             // 分片索引
+	IsRsCodes bool            // 是否为纠删码片段
+	Receiver  peer.ID         // 接收该片段的节点
+	Data      []byte          // 即将发送的片段数据，中间件可以替换
+}
+
+// SegmentReceiveContext 描述下载后已解密、尚未写入本地的文件片段
+type SegmentReceiveContext struct {
+	TaskID    string  // 任务唯一标识
+	FileID    string  // 文件唯一标识
+	SegmentID string  // 文件片段的唯一标识
+	Index     int     // 分片索引
+	Sender    peer.ID // 提供该片段的节点
+	Data      []byte  // 片段明文数据，中间件可以替换
+}
+
+// TaskCompleteContext 描述即将完成的任务
+type TaskCompleteContext struct {
+	Kind     TaskKind // 任务类型
+	TaskID   string   // 任务唯一标识
+	FileID   string   // 文件唯一标识
+	Name     string   // 文件名
+	Size     int64    // 文件大小
+	FilePath string   // 下载任务中已合并但尚未移动到下载目录的文件路径，上传任务为空
+}
+
+// BeforeSegmentSendFunc 片段发送前的中间件
+type BeforeSegmentSendFunc func(c *SegmentSendContext) error
+
+// AfterSegmentReceiveFunc 片段接收后的中间件
+type AfterSegmentReceiveFunc func(c *SegmentReceiveContext) error
+
+// BeforeTaskCompleteFunc 任务完成前的中间件
+type BeforeTaskCompleteFunc func(c *TaskCompleteContext) error
+
+// Registry 保存已注册的中间件，按注册顺序执行
+type Registry struct {
+	mu                  sync.RWMutex
+	beforeSegmentSend   []BeforeSegmentSendFunc   // 片段发送前的中间件
+	afterSegmentReceive []AfterSegmentReceiveFunc // 片段接收后的中间件
+	beforeTaskComplete  []BeforeTaskCompleteFunc  // 任务完成前的中间件
+}
+
+// NewRegistry 创建一个空的中间件注册表
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// BeforeSegmentSend 注册片段发送前的中间件
+// 参数：
+//   - fn: BeforeSegmentSendFunc 中间件，返回错误时片段不会被发送，上传任务失败
+func (r *Registry) BeforeSegmentSend(fn BeforeSegmentSendFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.beforeSegmentSend = append(r.beforeSegmentSend, fn)
+}
+
+// AfterSegmentReceive 注册片段接收后的中间件
+// 参数：
+//   - fn: AfterSegmentReceiveFunc 中间件，返回错误时片段不会写入本地
+func (r *Registry) AfterSegmentReceive(fn AfterSegmentReceiveFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.afterSegmentReceive = append(r.afterSegmentReceive, fn)
+}
+
+// BeforeTaskComplete 注册任务完成前的中间件
+// 参数：
+//   - fn: BeforeTaskCompleteFunc 中间件，返回错误时任务被标记为失败
+func (r *Registry) BeforeTaskComplete(fn BeforeTaskCompleteFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.beforeTaskComplete = append(r.beforeTaskComplete, fn)
+}
+
+// RunBeforeSegmentSend 依次执行片段发送前的中间件
+// 参数：
+//   - c: *SegmentSendContext 片段发送上下文
+//
+// 返回值：
+//   - error: 第一个返回错误的中间件的错误信息
+func (r *Registry) RunBeforeSegmentSend(c *SegmentSendContext) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	fns := r.beforeSegmentSend
+	r.mu.RUnlock()
+
+	for _, fn := range fns {
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunAfterSegmentReceive 依次执行片段接收后的中间件
+// 参数：
+//   - c: *SegmentReceiveContext 片段接收上下文
+//
+// 返回值：
+//   - error: 第一个返回错误的中间件的错误信息
+func (r *Registry) RunAfterSegmentReceive(c *SegmentReceiveContext) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	fns := r.afterSegmentReceive
+	r.mu.RUnlock()
+
+	for _, fn := range fns {
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunBeforeTaskComplete 依次执行任务完成前的中间件
+// 参数：
+//   - c: *TaskCompleteContext 任务完成上下文
+//
+// 返回值：
+//   - error: 第一个返回错误的中间件的错误信息
+func (r *Registry) RunBeforeTaskComplete(c *TaskCompleteContext) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	fns := r.beforeTaskComplete
+	r.mu.RUnlock()
+
+	for _, fn := range fns {
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRegistryOrderAndAbort(t *testing.T) {
+	r := NewRegistry()
+	var calls []int
+	errReject := errors.New("rejected")
+
+	r.BeforeSegmentSend(func(c *SegmentSendContext) error {
+		calls = append(calls, 1)
+		c.Data = append(c.Data, '!')
+		return nil
+	})
+	r.BeforeSegmentSend(func(c *SegmentSendContext) error {
+		calls = append(calls, 2)
+		return errReject
+	})
+	r.BeforeSegmentSend(func(c *SegmentSendContext) error {
+		calls = append(calls, 3)
+		return nil
+	})
+
+	c := &SegmentSendContext{Data: []byte("data")}
+	if err := r.RunBeforeSegmentSend(c); err != errReject {
+		t.Fatalf("got %v, want %v", err, errReject)
+	}
+	if len(calls) != 2 || calls[0] != 1 || calls[1] != 2 {
+		t.Fatalf("calls = %v, want [1 2]", calls)
+	}
+	if string(c.Data) != "data!" {
+		t.Fatalf("Data = %q, want %q", c.Data, "data!")
+	}
+
+	// 未配置注册表时不执行任何中间件
+	var empty *Registry
+	if err := empty.RunBeforeTaskComplete(&TaskCompleteContext{}); err != nil {
+		t.Fatal(err)
+	}
+}
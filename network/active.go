@@ -0,0 +1,120 @@
+package network
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bpfs/defs/errs"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// StreamInfo 正在进行传输的流
+type StreamInfo struct {
+	ID        uint64        // 流在本节点的编号，用于 CloseStream
+	Peer      peer.ID       // 对方节点
+	Protocol  string        // 协议ID
+	Direction string        // 流的方向，Inbound 为对方打开，Outbound 为本节点打开
+	BytesIn   int64         // 已读取的字节数
+	BytesOut  int64         // 已写入的字节数
+	OpenedAt  time.Time     // 开始跟踪的时间
+	Age       time.Duration // 已持续的时间
+}
+
+// trackedStream 登记在活动流列表中、统计读写字节数的流
+type trackedStream struct {
+	network.Stream
+	id       uint64
+	openedAt time.Time
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+}
+
+// Read 读取数据并统计字节数
+func (s *trackedStream) Read(p []byte) (int, error) {
+	n, err := s.Stream.Read(p)
+	s.bytesIn.Add(int64(n))
+	return n, err
+}
+
+// Write 写入数据并统计字节数
+func (s *trackedStream) Write(p []byte) (int, error) {
+	n, err := s.Stream.Write(p)
+	s.bytesOut.Add(int64(n))
+	return n, err
+}
+
+var (
+	activeMu      sync.Mutex
+	activeNext    uint64                            // 下一个流编号
+	activeStreams = make(map[uint64]*trackedStream) // 正在进行传输的流
+)
+
+// trackStream 将流登记到活动流列表中
+// 参数：
+//   - stream: network.Stream 被跟踪的流
+//
+// 返回值：
+//   - *trackedStream: 统计读写字节数的流
+//   - func(): 传输结束时从列表中移除的函数
+func trackStream(stream network.Stream) (*trackedStream, func()) {
+	activeMu.Lock()
+	activeNext++
+	s := &trackedStream{Stream: stream, id: activeNext, openedAt: time.Now()}
+	activeStreams[s.id] = s
+	activeMu.Unlock()
+
+	return s, func() {
+		activeMu.Lock()
+		delete(activeStreams, s.id)
+		activeMu.Unlock()
+	}
+}
+
+// ActiveStreams 列出本节点正在进行传输的流
+// 返回值：
+//   - []StreamInfo: 正在进行传输的流，按编号排列
+func ActiveStreams() []StreamInfo {
+	activeMu.Lock()
+	tracked := make([]*trackedStream, 0, len(activeStreams))
+	for _, s := range activeStreams {
+		tracked = append(tracked, s)
+	}
+	activeMu.Unlock()
+
+	now := time.Now()
+	infos := make([]StreamInfo, 0, len(tracked))
+	for _, s := range tracked {
+		infos = append(infos, StreamInfo{
+			ID:        s.id,
+			Peer:      s.Conn().RemotePeer(),
+			Protocol:  string(s.Protocol()),
+			Direction: s.Stat().Direction.String(),
+			BytesIn:   s.bytesIn.Load(),
+			BytesOut:  s.bytesOut.Load(),
+			OpenedAt:  s.openedAt,
+			Age:       now.Sub(s.openedAt),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// CloseStream 重置正在进行传输的流，中止其上的传输
+// 参数：
+//   - id: uint64 流编号
+//
+// 返回值：
+//   - error: 流不存在或已结束时返回包装了 errs.ErrNotFound 的错误
+func CloseStream(id uint64) error {
+	activeMu.Lock()
+	s, ok := activeStreams[id]
+	activeMu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: 流 %d", errs.ErrNotFound, id)
+	}
+	return s.Reset()
+}
@@ -0,0 +1,53 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bpfs/defs/errs"
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+func TestCloseStream(t *testing.T) {
+	client, receiver := newStallPair(t, func(s network.Stream, hold <-chan struct{}) { <-hold })
+
+	done := make(chan error, 1)
+	go func() { done <- stallRoundTrip(context.Background(), t, client, receiver) }()
+
+	// 等待传输出现在活动流列表中
+	var id uint64
+	for deadline := time.Now().Add(5 * time.Second); id == 0; {
+		for _, info := range ActiveStreams() {
+			if info.Protocol == testStallProtocol && info.Peer == receiver && info.Direction == "Outbound" && info.BytesOut > 0 {
+				id = info.ID
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("活动流列表中没有正在进行的传输")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := CloseStream(id); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("被关闭的传输应返回错误")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("关闭流后传输应立即结束")
+	}
+
+	for _, info := range ActiveStreams() {
+		if info.ID == id {
+			t.Fatal("结束的流应从列表中移除")
+		}
+	}
+	if err := CloseStream(id); !errors.Is(err, errs.ErrNotFound) {
+		t.Fatalf("应返回 ErrNotFound, 实际 %v", err)
+	}
+}
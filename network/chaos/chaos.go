@@ -0,0 +1,217 @@
+// Package chaos 提供传输层的故障注入器，用于在集成测试中模拟网络异常。
+// 故障按规则匹配消息，丢弃、延迟、损坏和乱序由固定种子的随机数决定，相同的消息顺序总是得到相同的结果，
+// 便于确定性地测试重试、纠删码恢复等容错功能。
+package chaos
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+var (
+	// ErrDropped 消息被丢弃
+	ErrDropped = errors.New("chaos: 消息被丢弃")
+
+	// ErrDisconnected 对方节点已断开
+	ErrDisconnected = errors.New("chaos: 节点已断开")
+)
+
+// reorderWindow 乱序消息最长等待后续消息的时间
+const reorderWindow = 200 * time.Millisecond
+
+// reorderGap 后续消息通过后，被推迟的消息再等待的时间
+const reorderGap = 10 * time.Millisecond
+
+// Rule 故障规则，各项故障按概率独立生效
+type Rule struct {
+	Protocol  string             // 协议ID或主题的前缀，为空时匹配所有协议
+	Direction *network.Direction // 传输方向，为 nil 时匹配所有方向
+	Peer      peer.ID            // 对方节点，为空时匹配所有节点
+	Drop      float64            // 丢弃的概率
+	Corrupt   float64            // 损坏消息内容的概率
+	Reorder   float64            // 推迟到下一条匹配消息之后的概率
+	Delay     time.Duration      // 固定延迟
+}
+
+// match 检查规则是否匹配消息
+func (r *Rule) match(msg *network.FaultMessage) bool {
+	if r.Protocol != "" && !strings.HasPrefix(msg.Protocol, r.Protocol) {
+		return false
+	}
+	if r.Direction != nil && *r.Direction != msg.Direction {
+		return false
+	}
+	if r.Peer != "" && r.Peer != msg.Peer {
+		return false
+	}
+	return true
+}
+
+// Stats 已注入的故障数量
+type Stats struct {
+	Messages     int // 经过的消息数量
+	Dropped      int // 丢弃的消息数量
+	Corrupted    int // 损坏的消息数量
+	Reordered    int // 乱序的消息数量
+	Delayed      int // 延迟的消息数量
+	Disconnected int // 因节点断开而失败的消息数量
+}
+
+// Injector 按规则注入故障的传输层故障注入器
+type Injector struct {
+	mu           sync.Mutex
+	rng          *rand.Rand           // 固定种子的随机数
+	rules        []Rule               // 故障规则
+	disconnected map[peer.ID]struct{} // 已断开的节点
+	held         chan struct{}        // 被推迟的消息的释放通道
+	stats        Stats                // 已注入的故障数量
+}
+
+// New 创建一个新的故障注入器
+// 参数：
+//   - seed: int64 随机数种子
+//
+// 返回值：
+//   - *Injector: 新创建的故障注入器
+func New(seed int64) *Injector {
+	return &Injector{
+		rng:          rand.New(rand.NewSource(seed)),
+		disconnected: make(map[peer.ID]struct{}),
+	}
+}
+
+// AddRule 添加故障规则
+func (in *Injector) AddRule(rule Rule) *Injector {
+	in.mu.Lock()
+	in.rules = append(in.rules, rule)
+	in.mu.Unlock()
+	return in
+}
+
+// Disconnect 模拟与指定节点断开，之后与该节点之间的消息都会失败
+func (in *Injector) Disconnect(p peer.ID) {
+	in.mu.Lock()
+	in.disconnected[p] = struct{}{}
+	in.mu.Unlock()
+}
+
+// Reconnect 恢复与指定节点的连接
+func (in *Injector) Reconnect(p peer.ID) {
+	in.mu.Lock()
+	delete(in.disconnected, p)
+	in.mu.Unlock()
+}
+
+// Stats 获取已注入的故障数量
+func (in *Injector) Stats() Stats {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.stats
+}
+
+// Install 将故障注入器设置为传输层的故障注入器
+// 返回值：
+//   - func(): 移除故障注入器的函数，测试结束时调用
+func (in *Injector) Install() func() {
+	network.SetFaultInjector(in)
+	return func() {
+		network.SetFaultInjector(nil)
+	}
+}
+
+// Inject 实现 network.FaultInjector 接口
+func (in *Injector) Inject(msg *network.FaultMessage) error {
+	in.mu.Lock()
+	in.stats.Messages++
+
+	if _, ok := in.disconnected[msg.Peer]; ok && msg.Peer != "" {
+		in.stats.Disconnected++
+		in.mu.Unlock()
+		return ErrDisconnected
+	}
+
+	var (
+		delay   time.Duration
+		reorder bool
+	)
+	matched := false
+	for i := range in.rules {
+		rule := &in.rules[i]
+		if !rule.match(msg) {
+			continue
+		}
+		matched = true
+
+		// 每条规则固定消耗三个随机数，保证结果只取决于消息顺序
+		dropRoll, corruptRoll, reorderRoll := in.rng.Float64(), in.rng.Float64(), in.rng.Float64()
+		if dropRoll < rule.Drop {
+			in.stats.Dropped++
+			in.mu.Unlock()
+			return ErrDropped
+		}
+		if corruptRoll < rule.Corrupt && len(msg.Payload) > 0 {
+			msg.Payload = in.corrupt(msg.Payload)
+			in.stats.Corrupted++
+		}
+		if reorderRoll < rule.Reorder {
+			reorder = true
+		}
+		delay += rule.Delay
+	}
+
+	// 后续匹配的消息通过时释放被推迟的消息
+	var release chan struct{}
+	if matched && in.held != nil && !reorder {
+		release, in.held = in.held, nil
+	}
+
+	var wait chan struct{}
+	if reorder && in.held == nil {
+		wait = make(chan struct{})
+		in.held = wait
+		in.stats.Reordered++
+	}
+	if delay > 0 {
+		in.stats.Delayed++
+	}
+	in.mu.Unlock()
+
+	if release != nil {
+		time.AfterFunc(reorderGap, func() { close(release) })
+	}
+	if wait != nil {
+		select {
+		case <-wait:
+		case <-time.After(reorderWindow):
+			in.mu.Lock()
+			if in.held == wait {
+				in.held = nil
+			}
+			in.mu.Unlock()
+		}
+	}
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	return nil
+}
+
+// corrupt 翻转消息中的一个随机字节，返回新的消息内容
+func (in *Injector) corrupt(payload []byte) []byte {
+	corrupted := make([]byte, len(payload))
+	copy(corrupted, payload)
+	i := in.rng.Intn(len(corrupted))
+	corrupted[i] ^= 0xff
+	return corrupted
+}
+
+// Direction 返回传输方向的指针，用于设置规则的方向
+func Direction(d network.Direction) *network.Direction {
+	return &d
+}
@@ -0,0 +1,115 @@
+package chaos
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bpfs/defs/network"
+)
+
+func send(in *Injector, protocol string, payload []byte) (*network.FaultMessage, error) {
+	msg := &network.FaultMessage{Direction: network.Outbound, Protocol: protocol, Peer: "peer", Payload: payload}
+	return msg, in.Inject(msg)
+}
+
+func TestDropIsDeterministic(t *testing.T) {
+	run := func() []bool {
+		in := New(42).AddRule(Rule{Protocol: "defs@stream/", Drop: 0.5})
+		var results []bool
+		for i := 0; i < 50; i++ {
+			_, err := send(in, "defs@stream/test/1.0.0", []byte("x"))
+			results = append(results, err == ErrDropped)
+		}
+		return results
+	}
+
+	first, second := run(), run()
+	dropped := 0
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("相同种子的第 %d 条消息结果不一致", i)
+		}
+		if first[i] {
+			dropped++
+		}
+	}
+	if dropped == 0 || dropped == len(first) {
+		t.Fatalf("丢弃数量不符合概率: %d", dropped)
+	}
+}
+
+func TestCorruptDoesNotModifyOriginal(t *testing.T) {
+	in := New(1).AddRule(Rule{Corrupt: 1})
+	original := []byte("segment")
+	msg, err := send(in, "any", original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(msg.Payload, original) {
+		t.Fatal("消息内容应被损坏")
+	}
+	if string(original) != "segment" {
+		t.Fatal("不应修改原始消息")
+	}
+}
+
+func TestRuleMatching(t *testing.T) {
+	in := New(1).AddRule(Rule{Protocol: "defs@stream/sending/", Direction: Direction(network.Inbound), Drop: 1})
+	if _, err := send(in, "defs@stream/sending/network/1.0.0", nil); err != nil {
+		t.Fatalf("出站消息不应匹配入站规则: %v", err)
+	}
+	msg := &network.FaultMessage{Direction: network.Inbound, Protocol: "defs@stream/sending/network/1.0.0"}
+	if err := in.Inject(msg); err != ErrDropped {
+		t.Fatalf("入站消息应被丢弃: %v", err)
+	}
+}
+
+func TestDisconnect(t *testing.T) {
+	in := New(1)
+	in.Disconnect("peer")
+	if _, err := send(in, "any", nil); err != ErrDisconnected {
+		t.Fatalf("期望节点断开错误，实际 %v", err)
+	}
+	in.Reconnect("peer")
+	if _, err := send(in, "any", nil); err != nil {
+		t.Fatalf("恢复连接后不应失败: %v", err)
+	}
+	if got := in.Stats().Disconnected; got != 1 {
+		t.Fatalf("期望断开次数 1，实际 %d", got)
+	}
+}
+
+func TestReorder(t *testing.T) {
+	in := New(1).AddRule(Rule{Protocol: "p", Reorder: 1})
+
+	var (
+		mu    sync.Mutex
+		order []string
+		wg    sync.WaitGroup
+	)
+	deliver := func(name string) {
+		defer wg.Done()
+		send(in, "p", []byte(name))
+		mu.Lock()
+		order = append(order, name)
+		mu.Unlock()
+	}
+
+	wg.Add(1)
+	go deliver("first")
+	time.Sleep(20 * time.Millisecond)
+
+	// 第二条消息不再被推迟，释放第一条消息
+	in.mu.Lock()
+	in.rules[0].Reorder = 0
+	in.mu.Unlock()
+	wg.Add(1)
+	go deliver("second")
+	wg.Wait()
+
+	if len(order) != 2 || order[0] != "second" {
+		t.Fatalf("期望第二条消息先到达，实际 %v", order)
+	}
+}
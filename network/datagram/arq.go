@@ -0,0 +1,444 @@
+// Package datagram 实现了基于不可靠数据报的文件片段传输。
+// 数据被切分为小于路径 MTU 的数据包，通过 QUIC 数据报发送，
+// 接收方周期性地回复缺失数据包的列表，发送方据此选择性重传(应用层 ARQ)。
+// 适用于高延迟、高丢包的链路(移动网络、卫星链路)，避免流传输在丢包时的队头阻塞。
+package datagram
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// 数据包类型
+const (
+	packetHello  byte = iota + 1 // 连接建立后的第一个数据包，携带传输令牌
+	packetData                   // 数据
+	packetAck                    // 确认，携带缺失的数据包序号
+	packetParity                 // 校验，一组数据包内容的异或
+)
+
+const (
+	dataHeaderSize = 1 + 4 + 4 // 类型、序号、总数
+	ackHeaderSize  = 1 + 1 + 2 // 类型、完成标记、缺失数量
+	maxMissing     = 256       // 单个确认包中携带的缺失序号的最大数量
+)
+
+var (
+	// ErrTooLarge 数据超过接收方允许的大小
+	ErrTooLarge = errors.New("数据报传输的数据超过允许的大小")
+
+	// ErrGaveUp 重传次数超过上限
+	ErrGaveUp = errors.New("数据报传输超过最大重传次数")
+)
+
+// Conn 不可靠的数据报连接，quic.Connection 满足该接口
+type Conn interface {
+	SendMessage([]byte) error
+	ReceiveMessage(context.Context) ([]byte, error)
+}
+
+// Config 数据报传输的参数
+type Config struct {
+	PacketSize  int           // 每个数据包携带的数据大小，应小于路径 MTU
+	RTO         time.Duration // 等待确认的初始超时，超时后加倍
+	MaxRTO      time.Duration // 等待确认的最大超时
+	MaxRetries  int           // 连续超时的最大次数
+	AckInterval time.Duration // 接收方发送确认的间隔
+	Linger      time.Duration // 接收完成后继续回复确认的时长，应对确认包丢失
+	FECGroup    int           // 发送方每组数据包附加一个校验包，为 0 时不使用前向纠错
+}
+
+// DefaultConfig 返回适用于高延迟链路的默认参数
+func DefaultConfig() *Config {
+	return &Config{
+		PacketSize:  1100,
+		RTO:         time.Second,
+		MaxRTO:      8 * time.Second,
+		MaxRetries:  6,
+		AckInterval: 100 * time.Millisecond,
+		Linger:      3 * time.Second,
+	}
+}
+
+// Send 通过数据报发送数据，直到接收方确认全部收到
+// 参数：
+//   - ctx: context.Context 上下文
+//   - conn: Conn 数据报连接
+//   - payload: []byte 待发送的数据
+//   - cfg: *Config 传输参数，为 nil 时使用默认参数
+//
+// 返回值：
+//   - error: 超过重传次数或连接失败时返回错误
+func Send(ctx context.Context, conn Conn, payload []byte, cfg *Config) error {
+	_, err := SendWithStats(ctx, conn, payload, cfg)
+	return err
+}
+
+// SendWithStats 通过数据报发送数据，直到接收方确认全部收到，并返回本次发送的统计
+// 参数：
+//   - ctx: context.Context 上下文
+//   - conn: Conn 数据报连接
+//   - payload: []byte 待发送的数据
+//   - cfg: *Config 传输参数，为 nil 时使用默认参数
+//
+// 返回值：
+//   - Stats: 本次发送的统计，发送失败时为失败前的统计
+//   - error: 超过重传次数或连接失败时返回错误
+func SendWithStats(ctx context.Context, conn Conn, payload []byte, cfg *Config) (Stats, error) {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	if cfg.FECGroup < 0 || cfg.FECGroup > maxFECGroup {
+		return Stats{}, fmt.Errorf("无效的校验组大小 %d", cfg.FECGroup)
+	}
+	total := (len(payload) + cfg.PacketSize - 1) / cfg.PacketSize
+	if total == 0 {
+		total = 1
+	}
+
+	// 接收确认包
+	acks := make(chan []byte, 16)
+	recvErr := make(chan error, 1)
+	recvCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		for {
+			msg, err := conn.ReceiveMessage(recvCtx)
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			if len(msg) >= ackHeaderSize && msg[0] == packetAck {
+				select {
+				case acks <- msg:
+				default: // 丢弃积压的确认，之后的确认会携带最新的状态
+				}
+			}
+		}
+	}()
+
+	pending := make([]uint32, total)
+	for i := range pending {
+		pending[i] = uint32(i)
+	}
+	rto, retries := cfg.RTO, 0
+	stats := Stats{Packets: total}
+
+	// 首轮发送全部数据包，启用前向纠错时附带校验包
+	if err := sendFirstRound(conn, payload, uint32(total), cfg, &stats); err != nil {
+		return stats, err
+	}
+
+	for first := true; ; first = false {
+		if !first {
+			for _, seq := range pending {
+				if err := conn.SendMessage(dataPacket(payload, seq, uint32(total), cfg.PacketSize)); err != nil {
+					return stats, err
+				}
+			}
+			stats.Retransmits += len(pending)
+		}
+
+		timer := time.NewTimer(rto)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return stats, ctx.Err()
+
+		case err := <-recvErr:
+			timer.Stop()
+			return stats, err
+
+		case msg := <-acks:
+			timer.Stop()
+			done, missing := parseAck(msg)
+			if done {
+				stats.Recovered = parseRecovered(msg)
+				return stats, nil
+			}
+			pending = missing
+			rto, retries = cfg.RTO, 0
+
+		case <-timer.C:
+			// 未收到确认，重发最后一个待确认的数据包作为探测
+			retries++
+			if retries > cfg.MaxRetries {
+				return stats, ErrGaveUp
+			}
+			pending = pending[len(pending)-1:]
+			if rto *= 2; rto > cfg.MaxRTO {
+				rto = cfg.MaxRTO
+			}
+		}
+	}
+}
+
+// sendFirstRound 首轮发送全部数据包
+// 启用前向纠错时，每组的校验包在组内最后一个数据包之前发送，使接收方收到一轮的最后一个数据包时已能恢复缺失的数据包
+func sendFirstRound(conn Conn, payload []byte, total uint32, cfg *Config, stats *Stats) error {
+	group := uint32(cfg.FECGroup)
+	for seq := uint32(0); seq < total; seq++ {
+		if group > 0 {
+			if _, end := groupRange(seq/group, total, group); seq == end-1 {
+				if err := conn.SendMessage(parityPacket(payload, seq/group, total, cfg.PacketSize, cfg.FECGroup)); err != nil {
+					return err
+				}
+				stats.Parity++
+			}
+		}
+		if err := conn.SendMessage(dataPacket(payload, seq, total, cfg.PacketSize)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Receive 通过数据报接收数据，直到全部数据包到达
+// 接收完成后在后台继续回复确认 cfg.Linger 时长，调用方应在此之后再关闭连接
+// 参数：
+//   - ctx: context.Context 上下文
+//   - conn: Conn 数据报连接
+//   - maxSize: int 允许接收的最大数据大小
+//   - cfg: *Config 传输参数，为 nil 时使用默认参数
+//
+// 返回值：
+//   - []byte: 接收到的数据
+//   - error: 数据过大或连接失败时返回错误
+func Receive(ctx context.Context, conn Conn, maxSize int, cfg *Config) ([]byte, error) {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+
+	var (
+		packets   map[uint32][]byte
+		parities  map[uint32]*parity // 组序号到校验包的映射
+		groupSize uint32             // 发送方使用的组大小，未收到校验包时为 0
+		total     uint32
+		received  int
+		recovered int // 经校验包恢复的数据包数量
+		dirty     bool
+	)
+
+	msgs := make(chan []byte, 64)
+	recvErr := make(chan error, 1)
+	recvCtx, cancel := context.WithCancel(ctx)
+	go func() {
+		for {
+			msg, err := conn.ReceiveMessage(recvCtx)
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			msgs <- msg
+		}
+	}()
+
+	ticker := time.NewTicker(cfg.AckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			cancel()
+			return nil, ctx.Err()
+
+		case err := <-recvErr:
+			cancel()
+			return nil, err
+
+		case <-ticker.C:
+			if dirty && total > 0 {
+				dirty = false
+				conn.SendMessage(ackPacket(false, missingSeqs(packets, total)))
+			}
+
+		case msg := <-msgs:
+			seq, n, data, isData := parseData(msg)
+			var par *parity
+			if !isData {
+				var ok bool
+				if par, ok = parseParity(msg); !ok {
+					continue
+				}
+				n = par.total
+			}
+			if total == 0 {
+				if int64(n)*int64(cfg.PacketSize) > int64(maxSize)+int64(cfg.PacketSize) {
+					cancel()
+					return nil, ErrTooLarge
+				}
+				total = n
+				packets = make(map[uint32][]byte, total)
+				parities = make(map[uint32]*parity)
+			}
+			if n != total {
+				continue
+			}
+
+			dup := false
+			if par != nil {
+				if groupSize == 0 {
+					groupSize = par.size
+				}
+				if par.size != groupSize || uint64(par.group)*uint64(groupSize) >= uint64(total) {
+					continue
+				}
+				if _, dup = parities[par.group]; !dup {
+					parities[par.group] = par
+				}
+			} else {
+				if seq >= total {
+					continue
+				}
+				if _, dup = packets[seq]; !dup {
+					packets[seq] = append([]byte(nil), data...)
+					received++
+				}
+				if groupSize > 0 {
+					par = parities[seq/groupSize]
+				}
+			}
+
+			// 组内只缺失一个数据包时由校验包恢复
+			if par != nil {
+				if lost, data, ok := par.recover(packets); ok {
+					packets[lost] = data
+					received++
+					recovered++
+				}
+			}
+			dirty = true
+
+			if received == int(total) {
+				payload := assemble(packets, total)
+				if len(payload) > maxSize {
+					cancel()
+					return nil, ErrTooLarge
+				}
+				done := doneAckPacket(recovered)
+				conn.SendMessage(done)
+				go linger(recvCtx, cancel, msgs, conn, cfg.Linger, done)
+				return payload, nil
+			}
+
+			// 一轮发送的最后一个数据包或重复的数据包，立即回复确认以加快重传
+			if dup || isData && seq == total-1 {
+				dirty = false
+				conn.SendMessage(ackPacket(false, missingSeqs(packets, total)))
+			}
+		}
+	}
+}
+
+// linger 接收完成后继续回复完成确认，应对确认包丢失导致发送方重传
+func linger(ctx context.Context, cancel context.CancelFunc, msgs <-chan []byte, conn Conn, d time.Duration, done []byte) {
+	defer cancel()
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			return
+		case <-msgs:
+			conn.SendMessage(done)
+		}
+	}
+}
+
+// dataPacket 构造数据包
+func dataPacket(payload []byte, seq, total uint32, size int) []byte {
+	start := int(seq) * size
+	end := start + size
+	if end > len(payload) {
+		end = len(payload)
+	}
+	pkt := make([]byte, dataHeaderSize+end-start)
+	pkt[0] = packetData
+	binary.BigEndian.PutUint32(pkt[1:], seq)
+	binary.BigEndian.PutUint32(pkt[5:], total)
+	copy(pkt[dataHeaderSize:], payload[start:end])
+	return pkt
+}
+
+// parseData 解析数据包
+func parseData(pkt []byte) (seq, total uint32, data []byte, ok bool) {
+	if len(pkt) < dataHeaderSize || pkt[0] != packetData {
+		return 0, 0, nil, false
+	}
+	return binary.BigEndian.Uint32(pkt[1:]), binary.BigEndian.Uint32(pkt[5:]), pkt[dataHeaderSize:], true
+}
+
+// ackPacket 构造确认包
+func ackPacket(done bool, missing []uint32) []byte {
+	if len(missing) > maxMissing {
+		missing = missing[:maxMissing]
+	}
+	pkt := make([]byte, ackHeaderSize+4*len(missing))
+	pkt[0] = packetAck
+	if done {
+		pkt[1] = 1
+	}
+	binary.BigEndian.PutUint16(pkt[2:], uint16(len(missing)))
+	for i, seq := range missing {
+		binary.BigEndian.PutUint32(pkt[ackHeaderSize+4*i:], seq)
+	}
+	return pkt
+}
+
+// parseAck 解析确认包
+func parseAck(pkt []byte) (bool, []uint32) {
+	done := pkt[1] == 1
+	n := int(binary.BigEndian.Uint16(pkt[2:]))
+	if len(pkt) < ackHeaderSize+4*n {
+		n = (len(pkt) - ackHeaderSize) / 4
+	}
+	missing := make([]uint32, n)
+	for i := range missing {
+		missing[i] = binary.BigEndian.Uint32(pkt[ackHeaderSize+4*i:])
+	}
+	return done, missing
+}
+
+// helloPacket 构造携带传输令牌的握手包
+func helloPacket(token []byte) []byte {
+	return append([]byte{packetHello}, token...)
+}
+
+// parseHello 解析握手包
+func parseHello(pkt []byte) ([]byte, error) {
+	if len(pkt) < 2 || pkt[0] != packetHello {
+		return nil, fmt.Errorf("无效的数据报握手包")
+	}
+	return pkt[1:], nil
+}
+
+// missingSeqs 返回尚未收到的数据包序号
+func missingSeqs(packets map[uint32][]byte, total uint32) []uint32 {
+	var missing []uint32
+	for seq := uint32(0); seq < total && len(missing) < maxMissing; seq++ {
+		if _, ok := packets[seq]; !ok {
+			missing = append(missing, seq)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+	return missing
+}
+
+// assemble 按序号拼接数据包
+func assemble(packets map[uint32][]byte, total uint32) []byte {
+	size := 0
+	for _, data := range packets {
+		size += len(data)
+	}
+	payload := make([]byte, 0, size)
+	for seq := uint32(0); seq < total; seq++ {
+		payload = append(payload, packets[seq]...)
+	}
+	return payload
+}
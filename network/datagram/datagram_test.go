@@ -0,0 +1,220 @@
+package datagram
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	mrand "math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bpfs/defs/errs"
+)
+
+// lossyConn 内存中的有损数据报连接
+type lossyConn struct {
+	in   chan []byte
+	out  chan []byte
+	loss float64
+
+	mu  sync.Mutex
+	rnd *mrand.Rand
+}
+
+func newLossyPair(loss float64) (*lossyConn, *lossyConn) {
+	a, b := make(chan []byte, 4096), make(chan []byte, 4096)
+	return &lossyConn{in: a, out: b, loss: loss, rnd: mrand.New(mrand.NewSource(1))},
+		&lossyConn{in: b, out: a, loss: loss, rnd: mrand.New(mrand.NewSource(2))}
+}
+
+func (c *lossyConn) SendMessage(b []byte) error {
+	c.mu.Lock()
+	drop := c.rnd.Float64() < c.loss
+	c.mu.Unlock()
+	if !drop {
+		c.out <- append([]byte(nil), b...)
+	}
+	return nil
+}
+
+func (c *lossyConn) ReceiveMessage(ctx context.Context) ([]byte, error) {
+	select {
+	case b := <-c.in:
+		return b, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestSendReceiveLossy(t *testing.T) {
+	payload := make([]byte, 300*1024)
+	rand.Read(payload)
+
+	cfg := DefaultConfig()
+	cfg.RTO = 50 * time.Millisecond
+	cfg.MaxRTO = 200 * time.Millisecond
+	cfg.MaxRetries = 20
+	cfg.AckInterval = 10 * time.Millisecond
+	cfg.Linger = 200 * time.Millisecond
+
+	sender, receiver := newLossyPair(0.2)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- Send(ctx, sender, payload, cfg) }()
+
+	got, err := Receive(ctx, receiver, len(payload), cfg)
+	if err != nil {
+		t.Fatalf("接收失败: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Fatal("接收到的数据不一致")
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+}
+
+func TestReceiveTooLarge(t *testing.T) {
+	sender, receiver := newLossyPair(0)
+	cfg := DefaultConfig()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go Send(ctx, sender, make([]byte, 10*cfg.PacketSize), cfg)
+	if _, err := Receive(ctx, receiver, cfg.PacketSize, cfg); err != ErrTooLarge {
+		t.Fatalf("期望 ErrTooLarge，实际: %v", err)
+	}
+}
+
+func TestQUICLoopback(t *testing.T) {
+	if testing.Short() {
+		t.Skip("跳过需要网络的测试")
+	}
+	server, err := Listen("127.0.0.1:0", nil)
+	if err != nil {
+		t.Skipf("无法监听 UDP: %v", err)
+	}
+	defer server.Close()
+
+	payload := make([]byte, 64*1024)
+	rand.Read(payload)
+	token, err := server.Expect("sender", len(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := SendTo(ctx, server.listener.Addr().String(), token, payload, nil); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+	got, ok := server.Take(ctx, token)
+	if !ok || !bytes.Equal(got, payload) {
+		t.Fatal("接收端未取得一致的数据")
+	}
+	short, stop := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer stop()
+	if _, ok := server.Take(short, token); ok {
+		t.Fatal("令牌不应被重复使用")
+	}
+}
+
+func TestSendReceiveFEC(t *testing.T) {
+	payload := make([]byte, 300*1024+123) // 最后一个数据包不满
+	rand.Read(payload)
+
+	cfg := DefaultConfig()
+	cfg.RTO = 50 * time.Millisecond
+	cfg.MaxRTO = 200 * time.Millisecond
+	cfg.MaxRetries = 20
+	cfg.AckInterval = 10 * time.Millisecond
+	cfg.Linger = 200 * time.Millisecond
+	cfg.FECGroup = 8
+
+	sender, receiver := newLossyPair(0.05)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	type result struct {
+		stats Stats
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		stats, err := SendWithStats(ctx, sender, payload, cfg)
+		done <- result{stats, err}
+	}()
+
+	got, err := Receive(ctx, receiver, len(payload), cfg)
+	if err != nil {
+		t.Fatalf("接收失败: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Fatal("接收到的数据不一致")
+	}
+	res := <-done
+	if res.err != nil {
+		t.Fatalf("发送失败: %v", res.err)
+	}
+	if res.stats.Parity == 0 || res.stats.Recovered == 0 {
+		t.Fatalf("应发送校验包并恢复丢失的数据包: %+v", res.stats)
+	}
+	if res.stats.Loss() <= 0 {
+		t.Fatalf("有丢包时估计的丢包率应大于 0: %+v", res.stats)
+	}
+}
+
+func TestParityRecover(t *testing.T) {
+	const size = 16
+	payload := make([]byte, 3*size+5)
+	rand.Read(payload)
+	total := uint32(4)
+
+	p, ok := parseParity(parityPacket(payload, 0, total, size, 4))
+	if !ok {
+		t.Fatal("解析校验包失败")
+	}
+	for lost := uint32(0); lost < total; lost++ {
+		packets := make(map[uint32][]byte)
+		for seq := uint32(0); seq < total; seq++ {
+			if seq != lost {
+				packets[seq] = dataPacket(payload, seq, total, size)[dataHeaderSize:]
+			}
+		}
+		seq, data, ok := p.recover(packets)
+		if !ok || seq != lost || !bytes.Equal(data, dataPacket(payload, lost, total, size)[dataHeaderSize:]) {
+			t.Fatalf("未能恢复数据包 %d", lost)
+		}
+	}
+
+	// 缺失两个数据包时无法恢复
+	packets := map[uint32][]byte{0: dataPacket(payload, 0, total, size)[dataHeaderSize:]}
+	if _, _, ok := p.recover(packets); ok {
+		t.Fatal("缺失多个数据包时不应恢复")
+	}
+}
+
+func TestServerExpectLimits(t *testing.T) {
+	server := &Server{pending: make(map[string]*pending)}
+
+	for i := 0; i < maxPendingPerPeer; i++ {
+		if _, err := server.Expect("sender", 1024); err != nil {
+			t.Fatalf("第 %d 次登记失败: %v", i, err)
+		}
+	}
+	if _, err := server.Expect("sender", 1024); !errors.Is(err, errs.ErrQuotaExceeded) {
+		t.Fatalf("超过单个发送方的上限应被拒绝: %v", err)
+	}
+	if _, err := server.Expect("other", 1024); err != nil {
+		t.Fatalf("其他发送方不应受影响: %v", err)
+	}
+
+	// 登记的最大数据大小之和不超过上限
+	if _, err := server.Expect("large", maxBufferedBytes); !errors.Is(err, errs.ErrQuotaExceeded) {
+		t.Fatalf("超过接收端的内存上限应被拒绝: %v", err)
+	}
+}
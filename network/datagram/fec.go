@@ -0,0 +1,166 @@
+package datagram
+
+import (
+	"encoding/binary"
+)
+
+// 链路丢包严重时，发送方可为每组数据包附加一个异或校验包(前向纠错)，
+// 接收方在组内只缺失一个数据包时直接由校验包恢复，无需等待确认与重传。
+// 校验包以额外带宽换取更少的重传往返；不认识校验包的接收方会忽略它，仍按原有的确认与重传完成传输。
+
+// parityHeaderSize 校验包头部：类型、组序号、数据包总数、组大小、长度异或
+const parityHeaderSize = 1 + 4 + 4 + 2 + 2
+
+// maxFECGroup 每组数据包的最大数量
+const maxFECGroup = 1 << 15
+
+// Stats 一次发送的统计，用于评估链路的丢包情况
+type Stats struct {
+	Packets     int // 数据包数量
+	Retransmits int // 重传的数据包数量
+	Parity      int // 发送的校验包数量
+	Recovered   int // 接收方通过校验包恢复的数据包数量
+}
+
+// Loss 估计链路的丢包率：重传与经校验包恢复的数据包占数据包总数的比例
+func (s Stats) Loss() float64 {
+	if s.Packets == 0 {
+		return 0
+	}
+	return float64(s.Retransmits+s.Recovered) / float64(s.Packets)
+}
+
+// parity 解析后的校验包
+type parity struct {
+	group  uint32 // 组序号
+	total  uint32 // 数据包总数
+	size   uint32 // 组大小
+	lenXor uint16 // 组内各数据包长度的异或
+	data   []byte // 组内各数据包内容的异或，较短的数据包以 0 补齐
+}
+
+// parityPacket 构造一组数据包的校验包
+// 参数：
+//   - payload: []byte 待发送的数据
+//   - group: uint32 组序号
+//   - total: uint32 数据包总数
+//   - size: int 每个数据包携带的数据大小
+//   - groupSize: int 组大小
+func parityPacket(payload []byte, group, total uint32, size, groupSize int) []byte {
+	pkt := make([]byte, parityHeaderSize+size)
+	pkt[0] = packetParity
+	binary.BigEndian.PutUint32(pkt[1:], group)
+	binary.BigEndian.PutUint32(pkt[5:], total)
+	binary.BigEndian.PutUint16(pkt[9:], uint16(groupSize))
+
+	var lenXor uint16
+	start, end := groupRange(group, total, uint32(groupSize))
+	for seq := start; seq < end; seq++ {
+		from := int(seq) * size
+		to := from + size
+		if to > len(payload) {
+			to = len(payload)
+		}
+		lenXor ^= uint16(to - from)
+		xorInto(pkt[parityHeaderSize:], payload[from:to])
+	}
+	binary.BigEndian.PutUint16(pkt[11:], lenXor)
+	return pkt
+}
+
+// parseParity 解析校验包
+func parseParity(pkt []byte) (*parity, bool) {
+	if len(pkt) < parityHeaderSize || pkt[0] != packetParity {
+		return nil, false
+	}
+	p := &parity{
+		group:  binary.BigEndian.Uint32(pkt[1:]),
+		total:  binary.BigEndian.Uint32(pkt[5:]),
+		size:   uint32(binary.BigEndian.Uint16(pkt[9:])),
+		lenXor: binary.BigEndian.Uint16(pkt[11:]),
+		data:   append([]byte(nil), pkt[parityHeaderSize:]...),
+	}
+	if p.size == 0 {
+		return nil, false
+	}
+	return p, true
+}
+
+// recover 组内只缺失一个数据包时由校验包恢复
+// 参数：
+//   - packets: map[uint32][]byte 已收到的数据包
+//
+// 返回值：
+//   - uint32: 恢复的数据包序号
+//   - []byte: 恢复的数据包内容
+//   - bool: 是否恢复成功
+func (p *parity) recover(packets map[uint32][]byte) (uint32, []byte, bool) {
+	start, end := groupRange(p.group, p.total, p.size)
+	missing, count := uint32(0), 0
+	for seq := start; seq < end; seq++ {
+		if _, ok := packets[seq]; !ok {
+			missing = seq
+			if count++; count > 1 {
+				return 0, nil, false
+			}
+		}
+	}
+	if count != 1 {
+		return 0, nil, false
+	}
+
+	data := append([]byte(nil), p.data...)
+	length := p.lenXor
+	for seq := start; seq < end; seq++ {
+		if seq == missing {
+			continue
+		}
+		if len(packets[seq]) > len(data) {
+			return 0, nil, false
+		}
+		xorInto(data, packets[seq])
+		length ^= uint16(len(packets[seq]))
+	}
+	if int(length) > len(data) {
+		return 0, nil, false
+	}
+	return missing, data[:length], true
+}
+
+// groupRange 返回一组数据包的序号范围 [start, end)
+func groupRange(group, total, size uint32) (uint32, uint32) {
+	start := uint64(group) * uint64(size)
+	end := start + uint64(size)
+	if start > uint64(total) {
+		start = uint64(total)
+	}
+	if end > uint64(total) {
+		end = uint64(total)
+	}
+	return uint32(start), uint32(end)
+}
+
+// xorInto 将 src 按字节异或到 dst，src 不长于 dst
+func xorInto(dst, src []byte) {
+	for i := range src {
+		dst[i] ^= src[i]
+	}
+}
+
+// doneAckPacket 构造完成确认包，附带经校验包恢复的数据包数量
+// 旧版本的发送方只读取确认包头部，会忽略附加的数量
+func doneAckPacket(recovered int) []byte {
+	pkt := make([]byte, ackHeaderSize+4)
+	pkt[0] = packetAck
+	pkt[1] = 1
+	binary.BigEndian.PutUint32(pkt[ackHeaderSize:], uint32(recovered))
+	return pkt
+}
+
+// parseRecovered 读取完成确认包附带的恢复数量，旧版本的接收方不附带时为 0
+func parseRecovered(pkt []byte) int {
+	if len(pkt) < ackHeaderSize+4 || pkt[1] != 1 || binary.BigEndian.Uint16(pkt[2:]) != 0 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(pkt[ackHeaderSize:]))
+}
@@ -0,0 +1,332 @@
+package datagram
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/network"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/quic-go/quic-go"
+	"github.com/sirupsen/logrus"
+)
+
+// nextProto QUIC 连接使用的应用层协议
+const nextProto = "defs-datagram"
+
+// tokenTTL 传输令牌及接收完成的数据的有效期
+const tokenTTL = 2 * time.Minute
+
+const (
+	maxPending        = 1024      // 接收端同时登记的最多传输数量
+	maxPendingPerPeer = 32        // 单个发送方同时登记的最多传输数量
+	maxBufferedBytes  = 512 << 20 // 登记的传输最多占用的内存(512MB)，按允许接收的最大数据大小计算
+)
+
+// quicConfig 返回开启数据报扩展的 QUIC 配置
+func quicConfig() *quic.Config {
+	return &quic.Config{
+		EnableDatagrams: true,
+		MaxIdleTimeout:  30 * time.Second,
+		KeepAlivePeriod: 10 * time.Second,
+	}
+}
+
+// pending 通过协商登记的传输
+type pending struct {
+	from     peer.ID       // 协商传输的发送方
+	maxSize  int           // 允许接收的最大数据大小
+	deadline time.Time     // 令牌过期时间
+	payload  []byte        // 接收完成的数据
+	active   bool          // 是否已有连接在使用该令牌
+	ready    chan struct{} // 接收完成时关闭
+}
+
+// Server 数据报传输的接收端
+// 发送方先通过 libp2p 流协商获得传输令牌，再建立 QUIC 连接发送携带令牌的握手包及数据；
+// 身份认证由令牌及片段自身的签名保证，因此 QUIC 层使用自签名证书
+type Server struct {
+	listener *quic.Listener
+	cfg      *Config
+
+	mu      sync.Mutex
+	pending map[string]*pending
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Listen 在指定的 UDP 地址上启动数据报传输的接收端
+// 参数：
+//   - addr: string 监听地址，例如 "0.0.0.0:0"
+//   - cfg: *Config 传输参数，为 nil 时使用默认参数
+//
+// 返回值：
+//   - *Server: 接收端
+//   - error: 监听失败时返回错误
+func Listen(addr string, cfg *Config) (*Server, error) {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	tlsConf, err := selfSignedTLS()
+	if err != nil {
+		return nil, err
+	}
+	listener, err := quic.ListenAddr(addr, tlsConf, quicConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		listener: listener,
+		cfg:      cfg,
+		pending:  make(map[string]*pending),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	go func() {
+		defer network.Recover(nextProto)
+		s.accept()
+	}()
+	return s, nil
+}
+
+// Port 返回接收端监听的 UDP 端口
+func (s *Server) Port() int {
+	return s.listener.Addr().(*net.UDPAddr).Port
+}
+
+// Close 关闭接收端
+func (s *Server) Close() error {
+	s.cancel()
+	return s.listener.Close()
+}
+
+// Expect 登记一次传输，返回发送方需要携带的令牌
+// 未取出的数据在令牌过期前一直占用内存，因此限制登记的传输数量及其最大数据大小之和
+// 参数：
+//   - from: peer.ID 协商传输的发送方
+//   - maxSize: int 允许接收的最大数据大小
+//
+// 返回值：
+//   - []byte: 传输令牌
+//   - error: 超过发送方或接收端的上限时返回包装了 errs.ErrQuotaExceeded 的错误，生成令牌失败时返回错误
+func (s *Server) Expect(from peer.ID, maxSize int) ([]byte, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+
+	var peerCount, buffered int
+	for _, p := range s.pending {
+		buffered += p.maxSize
+		if p.from == from {
+			peerCount++
+		}
+	}
+	if peerCount+1 > maxPendingPerPeer {
+		return nil, fmt.Errorf("%w: 节点 %s 已登记 %d 个传输", errs.ErrQuotaExceeded, from, peerCount)
+	}
+	if len(s.pending)+1 > maxPending || buffered+maxSize > maxBufferedBytes {
+		return nil, fmt.Errorf("%w: 已登记 %d 个传输共 %d 字节", errs.ErrQuotaExceeded, len(s.pending), buffered)
+	}
+
+	s.pending[hex.EncodeToString(token)] = &pending{
+		from:     from,
+		maxSize:  maxSize,
+		deadline: time.Now().Add(tokenTTL),
+		ready:    make(chan struct{}),
+	}
+	return token, nil
+}
+
+// Take 取出令牌对应的已接收完成的数据，每个令牌只能取出一次
+// 发送方收到完成确认与接收端登记数据之间存在时间差，因此会等待接收完成直到上下文结束
+// 参数：
+//   - ctx: context.Context 上下文
+//   - token: []byte 传输令牌
+//
+// 返回值：
+//   - []byte: 接收到的数据
+//   - bool: 令牌不存在或未能接收完成时返回 false
+func (s *Server) Take(ctx context.Context, token []byte) ([]byte, bool) {
+	key := hex.EncodeToString(token)
+
+	s.mu.Lock()
+	p, ok := s.pending[key]
+	s.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	select {
+	case <-p.ready:
+	case <-ctx.Done():
+		return nil, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pending[key]; !ok {
+		return nil, false
+	}
+	delete(s.pending, key)
+	return p.payload, true
+}
+
+// accept 接受 QUIC 连接
+func (s *Server) accept() {
+	for {
+		conn, err := s.listener.Accept(s.ctx)
+		if err != nil {
+			return
+		}
+		go func() {
+			defer network.Recover(nextProto)
+			s.serve(conn)
+		}()
+	}
+}
+
+// serve 处理单个 QUIC 连接上的一次传输
+func (s *Server) serve(conn quic.Connection) {
+	ctx, cancel := context.WithTimeout(s.ctx, tokenTTL)
+	defer cancel()
+
+	msg, err := conn.ReceiveMessage(ctx)
+	if err != nil {
+		conn.CloseWithError(0, "")
+		return
+	}
+	token, err := parseHello(msg)
+	if err != nil {
+		conn.CloseWithError(1, err.Error())
+		return
+	}
+	key := hex.EncodeToString(token)
+
+	s.mu.Lock()
+	p, ok := s.pending[key]
+	valid := ok && !p.active && time.Now().Before(p.deadline)
+	if valid {
+		p.active = true
+	}
+	s.mu.Unlock()
+	if !valid {
+		conn.CloseWithError(1, "无效的传输令牌")
+		return
+	}
+
+	payload, err := Receive(ctx, conn, p.maxSize, s.cfg)
+	if err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		conn.CloseWithError(1, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	p.payload = payload
+	close(p.ready)
+	s.mu.Unlock()
+
+	// 等待确认补发结束后关闭连接
+	select {
+	case <-time.After(s.cfg.Linger):
+	case <-ctx.Done():
+	}
+	conn.CloseWithError(0, "")
+}
+
+// prune 清理过期的令牌，调用方需持有锁
+func (s *Server) prune() {
+	now := time.Now()
+	for key, p := range s.pending {
+		if now.After(p.deadline.Add(tokenTTL)) {
+			delete(s.pending, key)
+		}
+	}
+}
+
+// SendTo 建立 QUIC 连接并通过数据报将数据发送到接收端
+// 参数：
+//   - ctx: context.Context 上下文
+//   - addr: string 接收端的 UDP 地址
+//   - token: []byte 通过协商获得的传输令牌
+//   - payload: []byte 待发送的数据
+//   - cfg: *Config 传输参数，为 nil 时使用默认参数
+//
+// 返回值：
+//   - error: 连接或传输失败时返回错误
+func SendTo(ctx context.Context, addr string, token, payload []byte, cfg *Config) error {
+	_, err := SendToWithStats(ctx, addr, token, payload, cfg)
+	return err
+}
+
+// SendToWithStats 建立 QUIC 连接并通过数据报将数据发送到接收端，并返回本次发送的统计
+// 参数：
+//   - ctx: context.Context 上下文
+//   - addr: string 接收端的 UDP 地址
+//   - token: []byte 通过协商获得的传输令牌
+//   - payload: []byte 待发送的数据
+//   - cfg: *Config 传输参数，为 nil 时使用默认参数
+//
+// 返回值：
+//   - Stats: 本次发送的统计
+//   - error: 连接或传输失败时返回错误
+func SendToWithStats(ctx context.Context, addr string, token, payload []byte, cfg *Config) (Stats, error) {
+	tlsConf := &tls.Config{
+		InsecureSkipVerify: true, // 身份认证由传输令牌保证
+		NextProtos:         []string{nextProto},
+	}
+	conn, err := quic.DialAddr(ctx, addr, tlsConf, quicConfig())
+	if err != nil {
+		return Stats{}, err
+	}
+	defer conn.CloseWithError(0, "")
+
+	if !conn.ConnectionState().SupportsDatagrams {
+		return Stats{}, fmt.Errorf("接收端不支持 QUIC 数据报")
+	}
+	if err := conn.SendMessage(helloPacket(token)); err != nil {
+		return Stats{}, err
+	}
+	return SendWithStats(ctx, conn, payload, cfg)
+}
+
+// selfSignedTLS 生成自签名证书的 TLS 配置
+func selfSignedTLS() (*tls.Config, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(10 * 365 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		NextProtos:   []string{nextProto},
+	}, nil
+}
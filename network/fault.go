@@ -0,0 +1,68 @@
+package network
+
+import (
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Direction 消息的传输方向
+type Direction int
+
+const (
+	Outbound Direction = iota // 本节点发出的请求或订阅消息
+	Inbound                   // 本节点收到的响应
+)
+
+// FaultMessage 经过传输层的消息
+type FaultMessage struct {
+	Direction Direction // 传输方向
+	Protocol  string    // 流协议ID或订阅主题
+	Peer      peer.ID   // 对方节点，订阅广播时为空
+	Payload   []byte    // 消息内容，故障注入器可以修改
+}
+
+// FaultInjector 在传输层注入故障，用于测试网络异常下的行为
+// 实现可以延迟返回、修改消息内容，返回错误表示丢弃消息
+type FaultInjector interface {
+	Inject(msg *FaultMessage) error
+}
+
+var (
+	faultMu       sync.RWMutex
+	faultInjector FaultInjector // 当前的故障注入器，为 nil 时不注入故障
+)
+
+// SetFaultInjector 设置传输层的故障注入器，仅用于测试
+// 参数：
+//   - injector: FaultInjector 故障注入器，为 nil 时关闭故障注入
+func SetFaultInjector(injector FaultInjector) {
+	faultMu.Lock()
+	faultInjector = injector
+	faultMu.Unlock()
+}
+
+// injectFault 对经过传输层的消息注入故障
+// 返回值：
+//   - []byte: 注入故障后的消息内容
+//   - error: 消息被丢弃时返回错误
+func injectFault(direction Direction, protocol string, p peer.ID, payload []byte) ([]byte, error) {
+	faultMu.RLock()
+	injector := faultInjector
+	faultMu.RUnlock()
+
+	if injector == nil {
+		return payload, nil
+	}
+
+	msg := &FaultMessage{
+		Direction: direction,
+		Protocol:  protocol,
+		Peer:      p,
+		Payload:   payload,
+	}
+	if err := injector.Inject(msg); err != nil {
+		return nil, err
+	}
+	return msg.Payload, nil
+}
@@ -0,0 +1,39 @@
+package network
+
+import (
+	"sync"
+
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/gate"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	gaterMu sync.RWMutex
+	gater   *gate.Gater // 连接限制，为 nil 时不限制
+)
+
+// SetGater 设置流处理程序使用的连接限制
+// 主机构建时未传入连接限制时，连接在建立后才被断开，期间到达的流在这里拒绝
+// 参数：
+//   - g: *gate.Gater 连接限制，为 nil 时不限制
+func SetGater(g *gate.Gater) {
+	gaterMu.Lock()
+	gater = g
+	gaterMu.Unlock()
+}
+
+// gated 检查流的对方是否被连接限制拒绝，被拒绝时重置流
+func gated(stream network.Stream) bool {
+	gaterMu.RLock()
+	g := gater
+	gaterMu.RUnlock()
+	conn := stream.Conn()
+	if g.Allowed(conn.RemotePeer(), conn.RemoteMultiaddr()) {
+		return false
+	}
+	logrus.Debugf("[%s]拒绝被限制的节点 %s 的流 %s", debug.WhereAmI(), conn.RemotePeer(), stream.Protocol())
+	stream.Reset()
+	return true
+}
@@ -0,0 +1,181 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/qos"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+)
+
+// ErrStalled 表示传输在允许的时间内没有任何进展，已被中止
+var ErrStalled = errors.New("传输停滞")
+
+var (
+	keepaliveMu     sync.RWMutex
+	keepaliveConfig = opts.DefaultKeepaliveConfig() // 保活与停滞检测参数
+)
+
+// SetKeepalive 设置长时间传输的保活与停滞检测参数
+// 参数：
+//   - config: *opts.KeepaliveConfig 保活与停滞检测参数，为 nil 时关闭
+func SetKeepalive(config *opts.KeepaliveConfig) {
+	keepaliveMu.Lock()
+	keepaliveConfig = config
+	keepaliveMu.Unlock()
+}
+
+// keepalive 获取保活与停滞检测参数
+func keepalive() *opts.KeepaliveConfig {
+	keepaliveMu.RLock()
+	defer keepaliveMu.RUnlock()
+	return keepaliveConfig
+}
+
+// startKeepalive 传输持续超过保活间隔后，按间隔向对方发送 ping，保持经过 NAT 的连接不被回收
+// 短于保活间隔的传输不会发送任何探测
+// 参数：
+//   - ctx: context.Context 传输的上下文
+//   - h: host.Host 网络主机
+//   - receiver: peer.ID 传输的对方
+//
+// 返回值：
+//   - func(): 传输结束时停止保活的函数
+func startKeepalive(ctx context.Context, h host.Host, receiver peer.ID) func() {
+	interval := time.Duration(0)
+	if config := keepalive(); config != nil {
+		interval = config.Interval
+	}
+	if interval <= 0 {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		// 每个间隔只读取一次结果，ping 的频率随之受限
+		results := ping.Ping(ctx, h, receiver)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case res, ok := <-results:
+				if !ok || res.Error != nil {
+					return // 对方不支持 ping 或连接已断开，由停滞检测处理
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return cancel
+}
+
+// progressStream 记录最近一次读写进展的流
+// 请求写完后到响应的首个字节到达前，对方正在处理请求，不应有数据传输，这段时间不计入停滞，
+// 等待响应的时间由协议的超时限制
+type progressStream struct {
+	network.Stream
+	last    atomic.Int64 // 最近一次读写到数据的时间(Unix 纳秒)
+	waiting atomic.Bool  // 是否正在等待对方处理请求
+}
+
+// newProgressStream 创建记录读写进展的流
+func newProgressStream(stream network.Stream) *progressStream {
+	s := &progressStream{Stream: stream}
+	s.last.Store(time.Now().UnixNano())
+	return s
+}
+
+// Read 读取数据并记录进展，读到响应的首个字节后恢复停滞检测
+func (s *progressStream) Read(p []byte) (int, error) {
+	n, err := s.Stream.Read(p)
+	if n > 0 {
+		s.last.Store(time.Now().UnixNano())
+		s.waiting.Store(false)
+	}
+	return n, err
+}
+
+// awaitResponse 标记请求已写完，在响应开始到达前暂停停滞检测
+func (s *progressStream) awaitResponse() {
+	s.waiting.Store(true)
+}
+
+// Write 写入数据并记录进展
+func (s *progressStream) Write(p []byte) (int, error) {
+	n, err := s.Stream.Write(p)
+	if n > 0 {
+		s.last.Store(time.Now().UnixNano())
+	}
+	return n, err
+}
+
+// idle 获取距最近一次进展的时间，等待对方处理请求时为 0
+func (s *progressStream) idle(now time.Time) time.Duration {
+	if s.waiting.Load() {
+		return 0
+	}
+	return now.Sub(time.Unix(0, s.last.Load()))
+}
+
+// watchStall 在流超过允许的时间没有进展时重置流
+// 参数：
+//   - ctx: context.Context 传输的上下文，携带的服务等级决定允许的无进展时间
+//   - stream: *progressStream 被监视的流
+//
+// 返回值：
+//   - func() error: 传输结束时停止监视的函数，流因停滞被重置时返回包装了 ErrStalled 的错误
+func watchStall(ctx context.Context, stream *progressStream) func() error {
+	timeout := keepalive().Stall(qos.ClassFrom(ctx))
+	if timeout <= 0 {
+		return func() error { return nil }
+	}
+
+	var stalled atomic.Bool
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(timeout / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				if stream.idle(now) > timeout {
+					stalled.Store(true)
+					stream.Reset()
+					return
+				}
+			}
+		}
+	}()
+
+	return func() error {
+		close(done)
+		if stalled.Load() {
+			return fmt.Errorf("%w: %s 内没有进展", ErrStalled, timeout)
+		}
+		return nil
+	}
+}
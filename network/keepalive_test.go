@@ -0,0 +1,127 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/qos"
+
+	"github.com/bpfs/dep2p/streams"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	protocols "github.com/libp2p/go-libp2p/core/protocol"
+)
+
+const testStallProtocol = "defs@stream/test/stall/1.0.0"
+
+// newStallPair 创建两个连接的主机，服务端读取请求后由 respond 写回响应
+func newStallPair(t *testing.T, respond func(s network.Stream, hold <-chan struct{})) (host.Host, peer.ID) {
+	var hosts [2]host.Host
+	for i := range hosts {
+		h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { h.Close() })
+		hosts[i] = h
+	}
+	client, server := hosts[0], hosts[1]
+	if err := client.Connect(context.Background(), peer.AddrInfo{ID: server.ID(), Addrs: server.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	hold := make(chan struct{})
+	t.Cleanup(func() { close(hold) })
+	server.SetStreamHandler(protocols.ID(testStallProtocol), func(s network.Stream) {
+		streams.ReadStream(s)
+		respond(s, hold)
+		s.Reset()
+	})
+	return client, server.ID()
+}
+
+// truncatedStream 写入指定字节数后阻塞，模拟连接在响应途中静默断开
+type truncatedStream struct {
+	network.Stream
+	remaining int
+	hold      <-chan struct{}
+}
+
+func (s *truncatedStream) Write(p []byte) (int, error) {
+	if s.remaining <= 0 {
+		<-s.hold
+		return 0, errors.New("held")
+	}
+	if len(p) > s.remaining {
+		p = p[:s.remaining]
+	}
+	n, err := s.Stream.Write(p)
+	s.remaining -= n
+	return n, err
+}
+
+func stallRoundTrip(ctx context.Context, t *testing.T, client host.Host, receiver peer.ID) error {
+	t.Helper()
+	req := &streams.RequestMessage{Payload: []byte("stall"), Message: &streams.Message{}}
+	requestBytes, err := req.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawStream, err := client.NewStream(ctx, receiver, protocols.ID(testStallProtocol))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rawStream.Close()
+	_, err = roundTrip(ctx, rawStream, requestBytes, streamLimit(testStallProtocol))
+	return err
+}
+
+func TestRoundTripStalled(t *testing.T) {
+	SetKeepalive(&opts.KeepaliveConfig{
+		StallTimeout: map[qos.Class]time.Duration{qos.ClassInteractive: 200 * time.Millisecond},
+	})
+	t.Cleanup(func() { SetKeepalive(opts.DefaultKeepaliveConfig()) })
+	// 服务端写出部分响应后不再写入
+	client, receiver := newStallPair(t, func(s network.Stream, hold <-chan struct{}) {
+		streams.WriteStream(bytes.Repeat([]byte("x"), 1024), &truncatedStream{Stream: s, remaining: 16, hold: hold})
+	})
+
+	start := time.Now()
+	err := stallRoundTrip(qos.WithClass(context.Background(), qos.ClassInteractive), t, client, receiver)
+	if !errors.Is(err, ErrStalled) {
+		t.Fatalf("应返回 ErrStalled, 实际 %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("停滞检测耗时过长: %s", elapsed)
+	}
+
+	// 未设置阈值的服务等级不检测停滞，由上下文结束传输
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if err := stallRoundTrip(ctx, t, client, receiver); err == nil || errors.Is(err, ErrStalled) {
+		t.Fatalf("普通等级不应检测停滞, 实际 %v", err)
+	}
+}
+
+func TestRoundTripSlowResponse(t *testing.T) {
+	SetKeepalive(&opts.KeepaliveConfig{
+		StallTimeout: map[qos.Class]time.Duration{qos.ClassInteractive: 200 * time.Millisecond},
+	})
+	t.Cleanup(func() { SetKeepalive(opts.DefaultKeepaliveConfig()) })
+	// 服务端处理请求的时间超过停滞阈值，之后完整写回响应
+	client, receiver := newStallPair(t, func(s network.Stream, hold <-chan struct{}) {
+		time.Sleep(600 * time.Millisecond)
+		streams.WriteStream([]byte("done"), s)
+		streams.ReadStream(s) // 等待客户端读完响应后关闭
+	})
+
+	if err := stallRoundTrip(qos.WithClass(context.Background(), qos.ClassInteractive), t, client, receiver); err != nil {
+		t.Fatalf("等待对方处理请求不应视为停滞: %v", err)
+	}
+}
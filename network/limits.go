@@ -0,0 +1,116 @@
+package network
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/opts"
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// 流消息头与长度前缀的最大开销(消息头17字节，varint长度前缀最多10字节)
+const streamFrameOverhead = 17 + 10
+
+// ErrMessageTooLarge 表示对方发送的消息超过了协议允许的最大大小
+var ErrMessageTooLarge = errors.New("消息超过协议允许的最大大小")
+
+var (
+	streamConfigMu sync.RWMutex
+	streamConfig   = opts.DefaultStreamConfig() // 流协议的超时与消息大小限制
+)
+
+// SetStreamConfig 设置所有流协议的超时与消息大小限制
+// 参数：
+//   - config: *opts.StreamConfig 流协议限制，为 nil 时恢复默认限制
+func SetStreamConfig(config *opts.StreamConfig) {
+	if config == nil {
+		config = opts.DefaultStreamConfig()
+	}
+	streamConfigMu.Lock()
+	streamConfig = config
+	streamConfigMu.Unlock()
+}
+
+// streamLimit 获取指定协议的限制
+func streamLimit(protocol string) opts.StreamLimit {
+	streamConfigMu.RLock()
+	defer streamConfigMu.RUnlock()
+	return streamConfig.Limit(protocol)
+}
+
+// HandlerWithLimits 为流处理程序加上协议的超时与消息大小限制
+// 超过时间的流会被截止，超过大小的消息在读取时失败，防止对方长时间占用流或发送超大消息；
+// 处理程序崩溃时重置流并交由 SetPanicHandler 设置的回调处理，而不使节点退出
+// 参数：
+//   - protocol: string 协议ID
+//   - handler: network.StreamHandler 流处理程序
+//
+// 返回值：
+//   - network.StreamHandler: 加上限制后的流处理程序
+func HandlerWithLimits(protocol string, handler network.StreamHandler) network.StreamHandler {
+	return func(stream network.Stream) {
+		if gated(stream) {
+			return
+		}
+		defer recoverStream(protocol, stream)
+		tracked, untrack := trackStream(stream)
+		defer untrack()
+		handler(newLimitedStream(tracked, streamLimit(protocol)))
+	}
+}
+
+// limitedStream 在截止时间与可读字节数上受限的流
+// 底层读写函数会自行设置或清除截止时间，这里将其限制在协议截止时间之内
+type limitedStream struct {
+	network.Stream
+	deadline  time.Time // 协议截止时间
+	remaining int64     // 剩余可读字节数
+}
+
+// newLimitedStream 创建受限的流
+func newLimitedStream(stream network.Stream, limit opts.StreamLimit) *limitedStream {
+	s := &limitedStream{
+		Stream:    stream,
+		deadline:  time.Now().Add(limit.Timeout),
+		remaining: int64(limit.MaxMessageSize) + streamFrameOverhead,
+	}
+	_ = stream.SetDeadline(s.deadline)
+	return s
+}
+
+// Read 读取数据，超过可读字节数时返回 ErrMessageTooLarge
+func (s *limitedStream) Read(p []byte) (int, error) {
+	if s.remaining <= 0 {
+		return 0, ErrMessageTooLarge
+	}
+	if int64(len(p)) > s.remaining {
+		p = p[:s.remaining]
+	}
+	n, err := s.Stream.Read(p)
+	s.remaining -= int64(n)
+	return n, err
+}
+
+// SetDeadline 设置截止时间，不晚于协议截止时间
+func (s *limitedStream) SetDeadline(t time.Time) error {
+	return s.Stream.SetDeadline(s.clamp(t))
+}
+
+// SetReadDeadline 设置读取截止时间，不晚于协议截止时间
+func (s *limitedStream) SetReadDeadline(t time.Time) error {
+	return s.Stream.SetReadDeadline(s.clamp(t))
+}
+
+// SetWriteDeadline 设置写入截止时间，不晚于协议截止时间
+func (s *limitedStream) SetWriteDeadline(t time.Time) error {
+	return s.Stream.SetWriteDeadline(s.clamp(t))
+}
+
+// clamp 将截止时间限制在协议截止时间之内，零值表示协议截止时间
+func (s *limitedStream) clamp(t time.Time) time.Time {
+	if t.IsZero() || t.After(s.deadline) {
+		return s.deadline
+	}
+	return t
+}
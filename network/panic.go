@@ -0,0 +1,84 @@
+package network
+
+import (
+	"runtime/debug"
+	"sync"
+
+	"github.com/bpfs/dep2p/streams"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/sirupsen/logrus"
+)
+
+// PanicHandler 处理流处理程序、订阅消息处理程序与网络协程中的崩溃
+// 参数：
+//   - protocol: string 协议ID
+//   - value: interface{} panic 的值
+//   - stack: []byte 崩溃时的调用栈
+type PanicHandler func(protocol string, value interface{}, stack []byte)
+
+var (
+	panicHandlerMu sync.RWMutex
+	panicHandler   PanicHandler // 流处理程序崩溃时的回调，为 nil 时只记录日志
+)
+
+// SetPanicHandler 设置流处理程序崩溃时的回调
+// 参数：
+//   - handler: PanicHandler 回调，为 nil 时只记录日志
+func SetPanicHandler(handler PanicHandler) {
+	panicHandlerMu.Lock()
+	panicHandler = handler
+	panicHandlerMu.Unlock()
+}
+
+// recoverStream 恢复流处理程序中的 panic 并重置流，避免单个请求的崩溃使节点退出
+// 用法：在流处理程序开头 defer recoverStream(协议, 流)
+// 参数：
+//   - protocol: string 协议ID
+//   - stream: network.Stream 正在处理的流
+func recoverStream(protocol string, stream network.Stream) {
+	value := recover()
+	if value == nil {
+		return
+	}
+	stack := debug.Stack()
+	_ = stream.Reset()
+	reportPanic(protocol, value, stack)
+}
+
+// Recover 恢复网络协程中的 panic，交由 SetPanicHandler 设置的回调处理
+// 用法：在协程开头 defer network.Recover(协议)
+// 参数：
+//   - protocol: string 协议ID或主题
+func Recover(protocol string) {
+	value := recover()
+	if value == nil {
+		return
+	}
+	reportPanic(protocol, value, debug.Stack())
+}
+
+// PubSubHandler 为订阅消息的处理程序加上 panic 恢复，单条消息的崩溃不会使节点退出
+// 参数：
+//   - topic: string 订阅主题
+//   - handler: func(*streams.RequestMessage) 消息处理程序
+//
+// 返回值：
+//   - func(*streams.RequestMessage): 加上恢复后的消息处理程序
+func PubSubHandler(topic string, handler func(*streams.RequestMessage)) func(*streams.RequestMessage) {
+	return func(res *streams.RequestMessage) {
+		defer Recover(topic)
+		handler(res)
+	}
+}
+
+// reportPanic 将崩溃交由回调处理，未设置回调时只记录日志
+func reportPanic(protocol string, value interface{}, stack []byte) {
+	panicHandlerMu.RLock()
+	handler := panicHandler
+	panicHandlerMu.RUnlock()
+	if handler == nil {
+		logrus.Errorf("[%s]处理程序崩溃: %v\n%s", protocol, value, stack)
+		return
+	}
+	handler(protocol, value, stack)
+}
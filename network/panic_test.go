@@ -0,0 +1,73 @@
+package network
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	protocols "github.com/libp2p/go-libp2p/core/protocol"
+)
+
+const testPanicProtocol = "defs@stream/test/panic/1.0.0"
+
+func TestHandlerWithLimitsRecoversPanic(t *testing.T) {
+	var hosts [2]host.Host
+	for i := range hosts {
+		h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { h.Close() })
+		hosts[i] = h
+	}
+	client, server := hosts[0], hosts[1]
+	if err := client.Connect(context.Background(), peer.AddrInfo{ID: server.ID(), Addrs: server.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	type report struct {
+		protocol string
+		value    interface{}
+	}
+	reports := make(chan report, 1)
+	SetPanicHandler(func(protocol string, value interface{}, stack []byte) {
+		reports <- report{protocol, value}
+	})
+	t.Cleanup(func() { SetPanicHandler(nil) })
+
+	server.SetStreamHandler(protocols.ID(testPanicProtocol), HandlerWithLimits(testPanicProtocol, func(s network.Stream) {
+		panic("boom")
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// 崩溃的处理程序重置流，对方的协商或读取失败
+	exchange := func() error {
+		stream, err := client.NewStream(ctx, server.ID(), protocols.ID(testPanicProtocol))
+		if err != nil {
+			return err
+		}
+		defer stream.Close()
+		if _, err := stream.Write([]byte("ping")); err != nil {
+			return err
+		}
+		_, err = io.ReadAll(stream)
+		return err
+	}
+	if err := exchange(); err == nil {
+		t.Fatal("exchange with a handler that panicked succeeded")
+	}
+	select {
+	case r := <-reports:
+		if r.protocol != testPanicProtocol || r.value != "boom" {
+			t.Fatalf("report = %+v", r)
+		}
+	case <-ctx.Done():
+		t.Fatal("panic was not reported")
+	}
+}
@@ -0,0 +1,384 @@
+package network
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/opts"
+
+	"github.com/bpfs/dep2p/streams"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	protocols "github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/sirupsen/logrus"
+)
+
+// reusableSuffix 可复用流协议ID的后缀，保留原协议前缀以沿用其超时与消息大小限制
+const reusableSuffix = "/pool"
+
+var (
+	poolMu      sync.RWMutex
+	pool        *StreamPool                      // 全局流连接池，为 nil 时不复用流
+	poolConfig  = opts.DefaultStreamPoolConfig() // 当前流连接池参数，决定服务端的空闲超时
+	reusableMu  sync.RWMutex
+	reusableSet = make(map[string]bool) // 已注册可复用处理程序的协议
+)
+
+// ReusableProtocol 获取协议的可复用流版本的协议ID
+// 参数：
+//   - protocol: string 协议ID
+//
+// 返回值：
+//   - string: 可复用流的协议ID
+func ReusableProtocol(protocol string) string {
+	return protocol + reusableSuffix
+}
+
+// SetStreamPool 设置全局流连接池参数，并关闭原连接池中的空闲流
+// 参数：
+//   - config: *opts.StreamPoolConfig 流连接池参数，为 nil 时关闭连接池
+func SetStreamPool(config *opts.StreamPoolConfig) {
+	var next *StreamPool
+	if config != nil {
+		next = NewStreamPool(config)
+	}
+
+	poolMu.Lock()
+	prev := pool
+	pool = next
+	if config != nil {
+		poolConfig = config
+	}
+	poolMu.Unlock()
+
+	if prev != nil {
+		prev.Close()
+	}
+}
+
+// streamPool 获取全局流连接池
+func streamPool() *StreamPool {
+	poolMu.RLock()
+	defer poolMu.RUnlock()
+	return pool
+}
+
+// serverIdleTimeout 服务端等待下一个请求的最长时间，长于客户端的空闲保留时间，避免客户端复用已被关闭的流
+func serverIdleTimeout() time.Duration {
+	poolMu.RLock()
+	defer poolMu.RUnlock()
+	return 2 * poolConfig.IdleTimeout
+}
+
+// isReusable 检查协议是否注册了可复用处理程序
+func isReusable(protocol string) bool {
+	reusableMu.RLock()
+	defer reusableMu.RUnlock()
+	return reusableSet[protocol]
+}
+
+// RegisterReusableHandler 注册协议的可复用流处理程序
+// 对方通过 ReusableProtocol(protocol) 打开的流在完成一次请求后保持打开，继续处理后续请求，
+// 直到对方关闭流或空闲超时。注册后本节点向该协议发送请求时也会优先复用流。
+// 参数：
+//   - h: host.Host 本地主机
+//   - protocol: string 协议ID
+//   - f: 请求处理函数，与 HandlerWithRW 相同，请求的 Sender 为经过认证的对方节点ID
+func RegisterReusableHandler(h host.Host, protocol string, f func(request *streams.RequestMessage, response *streams.ResponseMessage) (int32, string)) {
+	reusableMu.Lock()
+	reusableSet[protocol] = true
+	reusableMu.Unlock()
+
+	streams.RegisterStreamHandler(h, protocols.ID(ReusableProtocol(protocol)), handlerWithReuse(protocol, f))
+}
+
+// handlerWithReuse 循环处理同一个流上的多个请求，处理程序崩溃时重置流并交由 SetPanicHandler 设置的回调处理
+func handlerWithReuse(protocol string, f func(request *streams.RequestMessage, response *streams.ResponseMessage) (int32, string)) network.StreamHandler {
+	return func(rawStream network.Stream) {
+		if gated(rawStream) {
+			return
+		}
+		defer recoverStream(protocol, rawStream)
+		stream, untrack := trackStream(rawStream)
+		defer untrack()
+
+		var first [1]byte
+		for {
+			// 等待下一个请求的第一个字节，空闲超时或对方关闭时结束
+			_ = stream.SetReadDeadline(time.Now().Add(serverIdleTimeout()))
+			if _, err := io.ReadFull(stream, first[:]); err != nil {
+				return
+			}
+
+			// 每个请求单独计算协议的超时与消息大小限制
+			limited := newLimitedStream(&prefixedStream{Stream: stream, prefix: first[:]}, streamLimit(protocol))
+			if !serveRequest(limited, f) {
+				return
+			}
+		}
+	}
+}
+
+// HandlerWithRW 读取请求、调用处理函数并写回响应，与 streams.HandlerWithRW 相同，
+// 但请求的 Sender 会被替换为流连接上经过认证的对方节点ID，处理函数可以将其作为请求方身份
+// 参数：
+//   - f: 请求处理函数
+//
+// 返回值：
+//   - network.StreamHandler: 流处理程序
+func HandlerWithRW(f func(request *streams.RequestMessage, response *streams.ResponseMessage) (int32, string)) network.StreamHandler {
+	return func(stream network.Stream) {
+		serveRequest(stream, f)
+	}
+}
+
+// authenticateSender 将请求的 Sender 替换为流连接上经过认证的对方节点ID
+// 请求中的 Sender 由对方自行填写，不能作为身份使用
+func authenticateSender(stream network.Stream, req *streams.RequestMessage) {
+	if req.Message == nil {
+		req.Message = new(streams.Message)
+	}
+	req.Message.Sender = stream.Conn().RemotePeer().String()
+}
+
+// serveRequest 处理流上的一个请求，返回流是否可以继续使用
+func serveRequest(stream network.Stream, f func(request *streams.RequestMessage, response *streams.ResponseMessage) (int32, string)) bool {
+	var req streams.RequestMessage
+	var res streams.ResponseMessage
+
+	requestByte, err := streams.ReadStream(stream)
+	if err != nil || len(requestByte) == 0 {
+		return false
+	}
+	if err := req.Unmarshal(requestByte); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		streams.SendErrorResponse(stream, 400, "请求解析错误")
+		return false
+	}
+	authenticateSender(stream, &req)
+
+	res.Code, res.Msg = f(&req, &res)
+
+	responseByte, err := res.Marshal()
+	if err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		streams.SendErrorResponse(stream, 500, "响应编码失败")
+		return false
+	}
+	if err := streams.WriteStream(responseByte, stream); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return false
+	}
+	return true
+}
+
+// prefixedStream 先返回已读取的前缀字节，再从底层流读取
+type prefixedStream struct {
+	network.Stream
+	prefix []byte
+}
+
+// Read 读取数据
+func (s *prefixedStream) Read(p []byte) (int, error) {
+	if len(s.prefix) > 0 {
+		n := copy(p, s.prefix)
+		s.prefix = s.prefix[n:]
+		return n, nil
+	}
+	return s.Stream.Read(p)
+}
+
+// StreamPool 按(节点, 协议)复用流的连接池
+// 空闲的流在取出前检查连接状态与空闲时间，每个节点每个协议同时使用的流数量受上限约束
+// 同一节点的并发请求各自取出一个流并行传输，只在达到上限时等待
+type StreamPool struct {
+	mu     sync.Mutex
+	config opts.StreamPoolConfig
+	peers  map[poolKey]*peerPool
+	closed bool
+}
+
+// poolKey 连接池的键
+type poolKey struct {
+	peer     peer.ID
+	protocol string
+}
+
+// peerPool 单个节点单个协议的流
+type peerPool struct {
+	idle   []*pooledStream // 空闲的流，最近放回的在末尾
+	active int             // 正在使用的流数量
+	wait   chan struct{}   // 有流被放回时关闭
+}
+
+// pooledStream 连接池中的流
+type pooledStream struct {
+	stream    network.Stream
+	reusable  bool      // 对方是否以可复用协议接受了流
+	reused    bool      // 是否为复用的空闲流
+	idleSince time.Time // 放回连接池的时间
+}
+
+// NewStreamPool 创建流连接池
+// 参数：
+//   - config: *opts.StreamPoolConfig 流连接池参数
+//
+// 返回值：
+//   - *StreamPool: 流连接池
+func NewStreamPool(config *opts.StreamPoolConfig) *StreamPool {
+	return &StreamPool{
+		config: *config,
+		peers:  make(map[poolKey]*peerPool),
+	}
+}
+
+// get 取出一个健康的空闲流或打开新的流，达到上限时等待其他流放回
+func (p *StreamPool) get(ctx context.Context, h host.Host, receiver peer.ID, protocol string) (*pooledStream, error) {
+	key := poolKey{peer: receiver, protocol: protocol}
+
+	for {
+		p.mu.Lock()
+		p.pruneLocked(time.Now())
+		pp := p.peers[key]
+		if pp == nil {
+			pp = &peerPool{wait: make(chan struct{})}
+			p.peers[key] = pp
+		}
+
+		// 优先复用最近放回的空闲流
+		if n := len(pp.idle); n > 0 {
+			ps := pp.idle[n-1]
+			pp.idle = pp.idle[:n-1]
+			pp.active++
+			p.mu.Unlock()
+			ps.reused = true
+			return ps, nil
+		}
+
+		if pp.active < p.config.MaxPerPeer {
+			pp.active++
+			p.mu.Unlock()
+			break
+		}
+
+		wait := pp.wait
+		p.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return p.open(ctx, h, receiver, protocol)
+}
+
+// open 打开新的流，对方不支持可复用协议时使用原协议
+func (p *StreamPool) open(ctx context.Context, h host.Host, receiver peer.ID, protocol string) (*pooledStream, error) {
+	stream, err := h.NewStream(ctx, receiver, protocols.ID(ReusableProtocol(protocol)), protocols.ID(protocol))
+	if err != nil {
+		p.release(poolKey{peer: receiver, protocol: protocol}, nil)
+		return nil, err
+	}
+	return &pooledStream{
+		stream:   stream,
+		reusable: string(stream.Protocol()) == ReusableProtocol(protocol),
+	}, nil
+}
+
+// put 放回使用完的流，失败或不可复用的流被关闭
+func (p *StreamPool) put(receiver peer.ID, protocol string, ps *pooledStream, ok bool) {
+	if !ok {
+		ps.stream.Reset()
+		p.release(poolKey{peer: receiver, protocol: protocol}, nil)
+		return
+	}
+	if !ps.reusable {
+		ps.stream.Close()
+		p.release(poolKey{peer: receiver, protocol: protocol}, nil)
+		return
+	}
+	_ = ps.stream.SetDeadline(time.Time{})
+	ps.idleSince = time.Now()
+	p.release(poolKey{peer: receiver, protocol: protocol}, ps)
+}
+
+// release 归还正在使用的名额，ps 不为 nil 时将其作为空闲流保留
+func (p *StreamPool) release(key poolKey, ps *pooledStream) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pp := p.peers[key]
+	if pp == nil {
+		if ps != nil {
+			ps.stream.Close()
+		}
+		return
+	}
+	pp.active--
+	if ps != nil {
+		if p.closed || len(pp.idle) >= p.config.MaxIdlePerPeer {
+			ps.stream.Close()
+		} else {
+			pp.idle = append(pp.idle, ps)
+		}
+	}
+
+	// 唤醒等待名额的请求
+	close(pp.wait)
+	pp.wait = make(chan struct{})
+}
+
+// pruneLocked 关闭空闲超时或连接已断开的流，并移除不再使用的条目
+func (p *StreamPool) pruneLocked(now time.Time) {
+	for key, pp := range p.peers {
+		kept := pp.idle[:0]
+		for _, ps := range pp.idle {
+			if now.Sub(ps.idleSince) >= p.config.IdleTimeout || ps.stream.Conn().IsClosed() {
+				ps.stream.Close()
+				continue
+			}
+			kept = append(kept, ps)
+		}
+		clear(pp.idle[len(kept):])
+		pp.idle = kept
+
+		if len(pp.idle) == 0 && pp.active == 0 {
+			delete(p.peers, key)
+		}
+	}
+}
+
+// Idle 获取连接池中空闲流的数量
+// 返回值：
+//   - int: 空闲流的数量
+func (p *StreamPool) Idle() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pruneLocked(time.Now())
+
+	n := 0
+	for _, pp := range p.peers {
+		n += len(pp.idle)
+	}
+	return n
+}
+
+// Close 关闭连接池中所有空闲的流，之后放回的流也会被关闭
+func (p *StreamPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	for _, pp := range p.peers {
+		for _, ps := range pp.idle {
+			ps.stream.Close()
+		}
+		pp.idle = nil
+	}
+}
@@ -0,0 +1,269 @@
+package network
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bpfs/defs/opts"
+
+	"github.com/bpfs/dep2p/streams"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	protocols "github.com/libp2p/go-libp2p/core/protocol"
+)
+
+const testProtocol = "defs@stream/test/pool/1.0.0"
+
+// newPoolPair 创建两个通过本地回环地址连接的主机，服务端注册可复用的回显处理程序
+func newPoolPair(t *testing.T) (host.Host, peer.ID) {
+	client, server := newHostPair(t)
+	RegisterReusableHandler(server, testProtocol, func(req *streams.RequestMessage, res *streams.ResponseMessage) (int32, string) {
+		res.Data = req.Payload
+		return 200, "成功"
+	})
+	return client, server.ID()
+}
+
+// newHostPair 创建两个通过本地回环地址连接的主机
+func newHostPair(t *testing.T) (client, server host.Host) {
+	var hosts [2]host.Host
+	for i := range hosts {
+		h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { h.Close() })
+		hosts[i] = h
+	}
+	client, server = hosts[0], hosts[1]
+	if err := client.Connect(context.Background(), peer.AddrInfo{ID: server.ID(), Addrs: server.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+	return client, server
+}
+
+// idleStream 获取连接池中唯一的空闲流
+func idleStream(t *testing.T, pool *StreamPool) *pooledStream {
+	t.Helper()
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	for _, pp := range pool.peers {
+		if len(pp.idle) == 1 {
+			return pp.idle[0]
+		}
+	}
+	t.Fatal("应保留 1 个空闲流")
+	return nil
+}
+
+func request(t *testing.T, pool *StreamPool, client host.Host, receiver peer.ID, payload string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req := &streams.RequestMessage{Payload: []byte(payload), Message: &streams.Message{}}
+	requestBytes, err := req.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	responseByte, err := roundTripPooled(ctx, pool, client, testProtocol, receiver, requestBytes, streamLimit(testProtocol))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := new(streams.ResponseMessage)
+	if err := res.Unmarshal(responseByte); err != nil {
+		t.Fatal(err)
+	}
+	if res.Code != 200 || string(res.Data) != payload {
+		t.Fatalf("响应不符: %d %q", res.Code, res.Data)
+	}
+}
+
+func TestStreamPoolReusesStream(t *testing.T) {
+	client, receiver := newPoolPair(t)
+	pool := NewStreamPool(opts.DefaultStreamPoolConfig())
+	defer pool.Close()
+
+	request(t, pool, client, receiver, "segment")
+	first := idleStream(t, pool)
+	if !first.reusable {
+		t.Fatal("对方应以可复用协议接受流")
+	}
+	for i := 0; i < 5; i++ {
+		request(t, pool, client, receiver, "segment")
+		if idleStream(t, pool) != first {
+			t.Fatal("应复用同一个流")
+		}
+	}
+}
+
+func TestStreamPoolIdleTimeout(t *testing.T) {
+	client, receiver := newPoolPair(t)
+	pool := NewStreamPool(&opts.StreamPoolConfig{MaxPerPeer: 1, MaxIdlePerPeer: 1, IdleTimeout: 50 * time.Millisecond})
+	defer pool.Close()
+
+	request(t, pool, client, receiver, "a")
+	first := idleStream(t, pool)
+	time.Sleep(100 * time.Millisecond)
+	if pool.Idle() != 0 {
+		t.Fatal("空闲超时的流应被关闭")
+	}
+	request(t, pool, client, receiver, "b")
+	if idleStream(t, pool) == first {
+		t.Fatal("空闲超时后应打开新的流")
+	}
+}
+
+func TestStreamPoolRetriesClosedStream(t *testing.T) {
+	client, receiver := newPoolPair(t)
+	pool := NewStreamPool(opts.DefaultStreamPoolConfig())
+	defer pool.Close()
+
+	request(t, pool, client, receiver, "a")
+
+	// 空闲流被关闭后，复用失败时改用新的流
+	first := idleStream(t, pool)
+	first.stream.Reset()
+
+	request(t, pool, client, receiver, "b")
+	if idleStream(t, pool) == first {
+		t.Fatal("应重新打开流")
+	}
+}
+
+func TestStreamPoolMaxPerPeer(t *testing.T) {
+	client, receiver := newPoolPair(t)
+	pool := NewStreamPool(&opts.StreamPoolConfig{MaxPerPeer: 1, MaxIdlePerPeer: 1, IdleTimeout: time.Minute})
+	defer pool.Close()
+
+	ps, err := pool.get(context.Background(), client, receiver, testProtocol)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 名额已用完时等待
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := pool.get(ctx, client, receiver, testProtocol); err != context.DeadlineExceeded {
+		t.Fatalf("应等待名额直到超时, 实际 %v", err)
+	}
+
+	pool.put(receiver, testProtocol, ps, true)
+	again, err := pool.get(context.Background(), client, receiver, testProtocol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != ps {
+		t.Fatal("应复用放回的流")
+	}
+	pool.put(receiver, testProtocol, again, true)
+}
+
+func TestStreamPoolParallelStreams(t *testing.T) {
+	const parallel = 8
+	client, server := newHostPair(t)
+	pool := NewStreamPool(&opts.StreamPoolConfig{MaxPerPeer: parallel, MaxIdlePerPeer: parallel, IdleTimeout: time.Minute})
+	defer pool.Close()
+
+	// 服务端在同时处理的请求达到上限前阻塞，请求被串行发送时只能等到超时
+	const protocol = "defs@stream/test/pool/parallel/1.0.0"
+	var (
+		mu       sync.Mutex
+		inflight int
+		peak     int
+	)
+	all := make(chan struct{})
+	RegisterReusableHandler(server, protocol, func(req *streams.RequestMessage, res *streams.ResponseMessage) (int32, string) {
+		mu.Lock()
+		inflight++
+		if inflight > peak {
+			peak = inflight
+			if peak == parallel {
+				close(all)
+			}
+		}
+		mu.Unlock()
+
+		select {
+		case <-all:
+		case <-time.After(2 * time.Second):
+		}
+
+		mu.Lock()
+		inflight--
+		mu.Unlock()
+		res.Data = req.Payload
+		return 200, "成功"
+	})
+
+	req := &streams.RequestMessage{Payload: []byte("segment"), Message: &streams.Message{}}
+	requestBytes, err := req.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, parallel)
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if _, err := roundTripPooled(ctx, pool, client, protocol, server.ID(), requestBytes, streamLimit(protocol)); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if peak != parallel {
+		t.Fatalf("同一节点同时处理的请求数 = %d, 应为 %d", peak, parallel)
+	}
+	if n := pool.Idle(); n != parallel {
+		t.Fatalf("空闲流数量 = %d, 应为 %d", n, parallel)
+	}
+}
+
+func TestHandlerWithRWAuthenticatesSender(t *testing.T) {
+	client, server := newHostPair(t)
+	const protocol = "defs@stream/test/sender/1.0.0"
+	server.SetStreamHandler(protocols.ID(protocol), HandlerWithRW(func(req *streams.RequestMessage, res *streams.ResponseMessage) (int32, string) {
+		res.Data = []byte(req.Message.Sender)
+		return 200, "成功"
+	}))
+
+	stream, err := client.NewStream(context.Background(), server.ID(), protocols.ID(protocol))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	// 伪造的 Sender 应被替换为连接上的对方节点ID
+	req := &streams.RequestMessage{Message: &streams.Message{Sender: server.ID().String()}}
+	requestBytes, err := req.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := streams.WriteStream(requestBytes, stream); err != nil {
+		t.Fatal(err)
+	}
+	responseByte, err := streams.ReadStream(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := new(streams.ResponseMessage)
+	if err := res.Unmarshal(responseByte); err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Data) != client.ID().String() {
+		t.Fatalf("Sender 应为连接上的对方节点: %s", res.Data)
+	}
+}
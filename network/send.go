@@ -3,20 +3,25 @@ package network
 import (
 	"context"
 	"sync"
-	"time"
 
 	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/opts"
 	"github.com/bpfs/defs/util"
 
 	"github.com/bpfs/dep2p"
 	"github.com/bpfs/dep2p/pubsub"
 	"github.com/bpfs/dep2p/streams"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	protocols "github.com/libp2p/go-libp2p/core/protocol"
 	"github.com/sirupsen/logrus"
 )
 
-// 流互斥锁
+// StreamMutex 流互斥锁
+//
+// Deprecated: 发送流消息不再需要调用方持有全局锁，各服务等级的传输由 qos.Scheduler 调度；
+// 保留该变量只为兼容旧代码，锁定它不会再影响流消息的发送。
 var StreamMutex sync.Mutex
 
 // SendStream 向指定的节点发流消息
@@ -25,7 +30,20 @@ var StreamMutex sync.Mutex
 // receiver		接收方ID
 // data			内容
 func SendStream(p2p *dep2p.DeP2P, protocol, genre string, receiver peer.ID, data interface{}) (*streams.ResponseMessage, error) {
-	ctx, cancel := context.WithTimeout(p2p.Context(), time.Second*10)
+	return SendStreamContext(p2p.Context(), p2p, protocol, genre, receiver, data)
+}
+
+// SendStreamContext 向指定的节点发流消息，ctx 结束时中止建立连接及读写
+// ctx			上下文，超时不超过协议的超时限制
+// protocol		协议
+// genre		类型
+// receiver		接收方ID
+// data			内容
+func SendStreamContext(ctx context.Context, p2p *dep2p.DeP2P, protocol, genre string, receiver peer.ID, data interface{}) (*streams.ResponseMessage, error) {
+	// 协议的超时与消息大小限制
+	limit := streamLimit(protocol)
+
+	ctx, cancel := context.WithTimeout(ctx, limit.Timeout)
 	defer cancel()
 
 	// 编码
@@ -35,6 +53,12 @@ func SendStream(p2p *dep2p.DeP2P, protocol, genre string, receiver peer.ID, data
 		return nil, err
 	}
 
+	// 注入故障(仅测试时设置)
+	payloadBytes, err = injectFault(Outbound, protocol, receiver, payloadBytes)
+	if err != nil {
+		return nil, err
+	}
+
 	// 请求消息
 	request := &streams.RequestMessage{
 		Payload: payloadBytes,
@@ -54,27 +78,21 @@ func SendStream(p2p *dep2p.DeP2P, protocol, genre string, receiver peer.ID, data
 		return nil, err
 	}
 
-	//StreamMutex.Lock()
-	stream, err := p2p.Host().NewStream(ctx, receiver, protocols.ID(protocol))
-	if err != nil {
-		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
-		return nil, err
+	// 请求超过协议允许的最大大小
+	if len(requestBytes) > limit.MaxMessageSize {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), ErrMessageTooLarge)
+		return nil, ErrMessageTooLarge
 	}
-	defer func() {
-		stream.Close()       // 执行完之后关闭流
-		StreamMutex.Unlock() // 执行完之后解除锁
-	}()
 
-	_ = stream.SetDeadline(time.Now().UTC().Add(time.Second * 10))
+	// 传输时间较长时向对方发送保活探测
+	defer startKeepalive(ctx, p2p.Host(), receiver)()
 
-	// 将消息写入流
-	if err = streams.WriteStream(requestBytes, stream); err != nil {
-		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
-		return nil, err
+	var responseByte []byte
+	if pool := streamPool(); pool != nil && isReusable(protocol) {
+		responseByte, err = roundTripPooled(ctx, pool, p2p.Host(), protocol, receiver, requestBytes, limit)
+	} else {
+		responseByte, err = roundTripOnce(ctx, p2p, protocol, receiver, requestBytes, limit)
 	}
-
-	// 从流中读取返回的消息
-	responseByte, err := streams.ReadStream(stream)
 	if err != nil {
 		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
 		return nil, err
@@ -91,20 +109,130 @@ func SendStream(p2p *dep2p.DeP2P, protocol, genre string, receiver peer.ID, data
 		return nil, err
 	}
 
+	// 注入故障(仅测试时设置)
+	if response.Data, err = injectFault(Inbound, protocol, receiver, response.Data); err != nil {
+		return nil, err
+	}
+
 	return response, nil
 }
 
+// roundTripOnce 打开新的流完成一次请求，完成后关闭流
+func roundTripOnce(ctx context.Context, p2p *dep2p.DeP2P, protocol string, receiver peer.ID, requestBytes []byte, limit opts.StreamLimit) ([]byte, error) {
+	rawStream, err := p2p.Host().NewStream(ctx, receiver, protocols.ID(protocol))
+	if err != nil {
+		return nil, err
+	}
+	defer rawStream.Close() // 执行完之后关闭流
+
+	return roundTrip(ctx, rawStream, requestBytes, limit)
+}
+
+// roundTripPooled 通过连接池中的流完成一次请求
+// 复用的空闲流可能已被对方关闭，此时改用新打开的流重试一次
+func roundTripPooled(ctx context.Context, pool *StreamPool, h host.Host, protocol string, receiver peer.ID, requestBytes []byte, limit opts.StreamLimit) ([]byte, error) {
+	for {
+		ps, err := pool.get(ctx, h, receiver, protocol)
+		if err != nil {
+			return nil, err
+		}
+
+		responseByte, err := roundTrip(ctx, ps.stream, requestBytes, limit)
+		pool.put(receiver, protocol, ps, err == nil)
+		if err != nil && ps.reused && ctx.Err() == nil {
+			continue
+		}
+		return responseByte, err
+	}
+}
+
+// roundTrip 在流上写入请求并读取响应
+func roundTrip(ctx context.Context, rawStream network.Stream, requestBytes []byte, limit opts.StreamLimit) ([]byte, error) {
+	// 登记到活动流列表中，可通过 CloseStream 中止
+	tracked, untrack := trackStream(rawStream)
+	defer untrack()
+	// 记录读写进展，超过服务等级允许的时间没有进展时重置流
+	progress := newProgressStream(tracked)
+	unwatch := watchStall(ctx, progress)
+	// 限制响应的等待时间与大小
+	stream := newLimitedStream(progress, limit)
+	// 上下文结束时重置流，中止阻塞中的读写
+	stop := context.AfterFunc(ctx, func() { rawStream.Reset() })
+
+	// 将消息写入流
+	if err := streams.WriteStream(requestBytes, stream); err != nil {
+		stop()
+		if stallErr := unwatch(); stallErr != nil {
+			return nil, stallErr
+		}
+		return nil, err
+	}
+
+	// 从流中读取返回的消息，对方处理请求期间不检测停滞
+	progress.awaitResponse()
+	responseByte, err := streams.ReadStream(stream)
+	if !stop() && err == nil {
+		// 读取完成时上下文已结束，流已被重置
+		err = ctx.Err()
+	}
+	if stallErr := unwatch(); stallErr != nil && err != nil {
+		return nil, stallErr
+	}
+	return responseByte, err
+}
+
 // SendPubSub 向指定的节点发送订阅消息
 // topic		主题
 // genre		类型
 // receiver		接收方ID
 // data			内容
 func SendPubSub(p2p *dep2p.DeP2P, pubsub *pubsub.DeP2PPubSub, topic, genre string, receiver peer.ID, data interface{}) error {
+	requestBytes, err := encodePubSub(p2p, topic, genre, receiver, data)
+	if err != nil {
+		return err
+	}
+
+	// 发送请求
+	if err := pubsub.BroadcastWithTopic(topic, requestBytes); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return err
+	}
+
+	return nil
+}
+
+// PublishPubSub 向本节点未订阅的主题发布消息
+// 用于向分片主题发送请求，发送方只加入主题而不接收该主题的消息
+// topic		主题
+// genre		类型
+// receiver		接收方ID
+// data			内容
+func PublishPubSub(p2p *dep2p.DeP2P, pubsub *pubsub.DeP2PPubSub, topic, genre string, receiver peer.ID, data interface{}) error {
+	requestBytes, err := encodePubSub(p2p, topic, genre, receiver, data)
+	if err != nil {
+		return err
+	}
+
+	if err := pubsub.Publish(topic, requestBytes); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return err
+	}
+
+	return nil
+}
+
+// encodePubSub 编码订阅消息
+func encodePubSub(p2p *dep2p.DeP2P, topic, genre string, receiver peer.ID, data interface{}) ([]byte, error) {
 	// 编码
 	payloadBytes, err := util.EncodeToBytes(data)
 	if err != nil {
 		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
-		return err
+		return nil, err
+	}
+
+	// 注入故障(仅测试时设置)
+	if payloadBytes, err = injectFault(Outbound, topic, receiver, payloadBytes); err != nil {
+		return nil, err
 	}
 
 	// 请求消息
@@ -125,16 +253,9 @@ func SendPubSub(p2p *dep2p.DeP2P, pubsub *pubsub.DeP2PPubSub, topic, genre strin
 	requestBytes, err := request.Marshal()
 	if err != nil {
 		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
-		return err
-	}
-
-	// 发送请求
-	if err := pubsub.BroadcastWithTopic(topic, requestBytes); err != nil {
-		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
-		return err
+		return nil, err
 	}
-
-	return nil
+	return requestBytes, nil
 }
 
 // SendDataToPeer 尝试先通过流发送数据，失败后通过订阅发送
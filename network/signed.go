@@ -0,0 +1,127 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/util"
+
+	"github.com/bpfs/dep2p"
+	"github.com/bpfs/dep2p/pubsub"
+	"github.com/bpfs/dep2p/streams"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// MaxSignedPubSubAge 签名的订阅消息的有效时间，超出有效时间的消息被视为重放而拒绝
+const MaxSignedPubSubAge = 5 * time.Minute
+
+// SignedPubSub 使用发送节点私钥签名的订阅消息内容
+// 订阅消息的 Sender 由发送方自行填写，需要确认发送方身份的主题使用签名的内容，接收方通过 VerifyPubSub 取得发送方
+type SignedPubSub struct {
+	PublicKey []byte // 发送节点的公钥
+	SignedAt  int64  // 签名时间(Unix 秒)
+	Payload   []byte // 编码后的消息内容
+	Signature []byte // 发送节点对主题、类型、签名时间与内容的签名
+}
+
+// SignPubSub 使用节点私钥签名订阅消息内容
+// 参数：
+//   - priv: crypto.PrivKey 发送节点的私钥
+//   - topic: string 主题
+//   - genre: string 类型
+//   - data: interface{} 消息内容
+//
+// 返回值：
+//   - *SignedPubSub: 签名后的消息内容
+//   - error: 编码或签名失败时返回错误
+func SignPubSub(priv crypto.PrivKey, topic, genre string, data interface{}) (*SignedPubSub, error) {
+	if priv == nil {
+		return nil, fmt.Errorf("%w: 节点私钥不能为空", errs.ErrInvalidArgument)
+	}
+	payload, err := util.EncodeToBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := crypto.MarshalPublicKey(priv.GetPublic())
+	if err != nil {
+		return nil, err
+	}
+
+	signed := &SignedPubSub{PublicKey: publicKey, SignedAt: time.Now().Unix(), Payload: payload}
+	if signed.Signature, err = priv.Sign(signed.signingData(topic, genre)); err != nil {
+		return nil, err
+	}
+	return signed, nil
+}
+
+// signingData 获取签名的数据，包括主题与类型，避免消息被转发到其他主题或当作其他类型使用
+func (s *SignedPubSub) signingData(topic, genre string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(topic)
+	buf.WriteByte(0)
+	buf.WriteString(genre)
+	buf.WriteByte(0)
+	binary.Write(&buf, binary.BigEndian, s.SignedAt)
+	buf.Write(s.Payload)
+	return buf.Bytes()
+}
+
+// SendSignedPubSub 发送使用本节点私钥签名的订阅消息
+// topic		主题
+// genre		类型
+// receiver		接收方ID
+// data			内容
+func SendSignedPubSub(p2p *dep2p.DeP2P, pubsub *pubsub.DeP2PPubSub, topic, genre string, receiver peer.ID, data interface{}) error {
+	signed, err := SignPubSub(p2p.Host().Peerstore().PrivKey(p2p.Host().ID()), topic, genre, data)
+	if err != nil {
+		return err
+	}
+	return SendPubSub(p2p, pubsub, topic, genre, receiver, signed)
+}
+
+// VerifyPubSub 验证签名的订阅消息，并解码消息内容
+// 参数：
+//   - res: *streams.RequestMessage 收到的订阅消息
+//   - topic: string 消息所在的主题
+//   - out: interface{} 解码消息内容的目标
+//
+// 返回值：
+//   - peer.ID: 经过签名验证的发送节点
+//   - error: 签名无效、与 Sender 不一致或超出有效时间时返回包装了 errs.ErrUnauthorized 的错误
+func VerifyPubSub(res *streams.RequestMessage, topic string, out interface{}) (peer.ID, error) {
+	if res.Message == nil {
+		return "", fmt.Errorf("%w: 订阅消息缺少消息头", errs.ErrUnauthorized)
+	}
+	signed := new(SignedPubSub)
+	if err := util.DecodeFromBytes(res.Payload, signed); err != nil {
+		return "", err
+	}
+
+	pub, err := crypto.UnmarshalPublicKey(signed.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("%w: 无效的公钥: %v", errs.ErrUnauthorized, err)
+	}
+	sender, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errs.ErrUnauthorized, err)
+	}
+	if sender.String() != res.Message.Sender {
+		return "", fmt.Errorf("%w: 签名节点 %s 与发送方 %s 不一致", errs.ErrUnauthorized, sender, res.Message.Sender)
+	}
+	if age := time.Since(time.Unix(signed.SignedAt, 0)); age > MaxSignedPubSubAge || age < -MaxSignedPubSubAge {
+		return "", fmt.Errorf("%w: 节点 %s 的订阅消息已超出有效时间", errs.ErrUnauthorized, sender)
+	}
+	valid, err := pub.Verify(signed.signingData(topic, res.Message.Type), signed.Signature)
+	if err != nil || !valid {
+		return "", fmt.Errorf("%w: 节点 %s 的订阅消息签名无效", errs.ErrUnauthorized, sender)
+	}
+
+	if err := util.DecodeFromBytes(signed.Payload, out); err != nil {
+		return "", err
+	}
+	return sender, nil
+}
@@ -0,0 +1,63 @@
+package network
+
+import (
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/util"
+
+	"github.com/bpfs/dep2p/streams"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestVerifyPubSub(t *testing.T) {
+	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	self, _ := peer.IDFromPrivateKey(priv)
+	other, _, _ := crypto.GenerateEd25519Key(rand.Reader)
+	otherID, _ := peer.IDFromPrivateKey(other)
+
+	message := func(sender peer.ID, genre string, signed *SignedPubSub) *streams.RequestMessage {
+		payload, err := util.EncodeToBytes(signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &streams.RequestMessage{Payload: payload, Message: &streams.Message{Type: genre, Sender: sender.String()}}
+	}
+
+	signed, err := SignPubSub(priv, "topic", "announce", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	sender, err := VerifyPubSub(message(self, "announce", signed), "topic", &got)
+	if err != nil || sender != self || got != "hello" {
+		t.Fatalf("VerifyPubSub = %s, %q, %v", sender, got, err)
+	}
+
+	// 冒充其他节点、转发到其他主题或改变类型的消息被拒绝
+	if _, err := VerifyPubSub(message(otherID, "announce", signed), "topic", &got); !errors.Is(err, errs.ErrUnauthorized) {
+		t.Fatalf("forged sender accepted: %v", err)
+	}
+	if _, err := VerifyPubSub(message(self, "announce", signed), "other", &got); !errors.Is(err, errs.ErrUnauthorized) {
+		t.Fatalf("message replayed on another topic accepted: %v", err)
+	}
+	if _, err := VerifyPubSub(message(self, "repair", signed), "topic", &got); !errors.Is(err, errs.ErrUnauthorized) {
+		t.Fatalf("message with another type accepted: %v", err)
+	}
+
+	// 超出有效时间的消息被拒绝
+	stale := *signed
+	stale.SignedAt -= int64(2 * MaxSignedPubSubAge.Seconds())
+	if stale.Signature, err = priv.Sign(stale.signingData("topic", "announce")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyPubSub(message(self, "announce", &stale), "topic", &got); !errors.Is(err, errs.ErrUnauthorized) {
+		t.Fatalf("stale message accepted: %v", err)
+	}
+}
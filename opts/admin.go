@@ -0,0 +1,37 @@
+package opts
+
+import (
+	"fmt"
+
+	"github.com/bpfs/defs/errs"
+)
+
+// AdminConfig 描述管理控制台的监听参数
+type AdminConfig struct {
+	Socket string // unix 套接字文件路径
+	Token  string // 访问令牌，请求携带的令牌不一致时拒绝执行
+}
+
+// GetAdminConfig 获取管理控制台的监听参数，为 nil 时不启动管理控制台
+func (opt *Options) GetAdminConfig() *AdminConfig {
+	return opt.adminConfig
+}
+
+// BuildAdminConfig 设置管理控制台的监听参数
+// 参数：
+//   - config: *AdminConfig 监听参数，为 nil 时不启动管理控制台
+//
+// 返回值：
+//   - error: 参数无效时返回包装了 errs.ErrInvalidArgument 的错误
+func (opt *Options) BuildAdminConfig(config *AdminConfig) error {
+	if config != nil {
+		if config.Socket == "" {
+			return fmt.Errorf("%w: 管理控制台的套接字路径不能为空", errs.ErrInvalidArgument)
+		}
+		if len(config.Token) < 16 {
+			return fmt.Errorf("%w: 管理控制台的访问令牌至少为16个字符", errs.ErrInvalidArgument)
+		}
+	}
+	opt.adminConfig = config
+	return nil
+}
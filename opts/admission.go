@@ -0,0 +1,58 @@
+package opts
+
+import (
+	"fmt"
+)
+
+// QueueOrder 下载任务达到并发上限后，等待队列中任务的启动顺序
+type QueueOrder string
+
+const (
+	QueueFIFO     QueueOrder = "fifo"     // 按加入队列的先后启动
+	QueuePriority QueueOrder = "priority" // 按服务等级启动，交互优先、后台最后，同一等级按先后启动
+)
+
+// DownloadAdmission 下载任务的准入控制
+// 同时进行的下载任务达到上限后，新的任务进入等待队列，有任务完成、失败、暂停或取消时按顺序启动
+type DownloadAdmission struct {
+	MaxConcurrent int        // 同时进行的下载任务数量上限，为 0 时不限制
+	Order         QueueOrder // 等待队列中任务的启动顺序
+}
+
+// DefaultDownloadAdmission 返回推荐的下载准入控制参数
+// 返回值：
+//   - *DownloadAdmission: 默认的下载准入控制
+func DefaultDownloadAdmission() *DownloadAdmission {
+	return &DownloadAdmission{
+		MaxConcurrent: 8,         // 同时进行8个下载任务
+		Order:         QueueFIFO, // 先到先启动
+	}
+}
+
+// GetDownloadAdmission 获取下载任务的准入控制，为 nil 时不限制同时进行的下载任务数量
+func (opt *Options) GetDownloadAdmission() *DownloadAdmission {
+	return opt.downloadAdmission
+}
+
+// BuildDownloadAdmission 设置下载任务的准入控制
+// 参数：
+//   - admission: *DownloadAdmission 准入控制参数，为 nil 时不限制
+//
+// 返回值：
+//   - error: 参数无效时返回错误信息
+func (opt *Options) BuildDownloadAdmission(admission *DownloadAdmission) error {
+	if admission != nil {
+		if admission.MaxConcurrent < 0 {
+			return fmt.Errorf("同时进行的下载任务数量上限不能为负数: %d", admission.MaxConcurrent)
+		}
+		switch admission.Order {
+		case "":
+			admission.Order = QueueFIFO
+		case QueueFIFO, QueuePriority:
+		default:
+			return fmt.Errorf("无效的等待队列顺序: %s", admission.Order)
+		}
+	}
+	opt.downloadAdmission = admission
+	return nil
+}
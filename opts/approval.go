@@ -0,0 +1,41 @@
+package opts
+
+import (
+	"fmt"
+	"time"
+)
+
+// ApprovalConfig 描述受限文件下载申请的参数
+type ApprovalConfig struct {
+	PendingTTL time.Duration // 下载申请等待所有者处理的时长，超过后申请失效
+	GrantTTL   time.Duration // 批准申请后签发的委托下载令牌的有效时长
+}
+
+// DefaultApprovalConfig 返回推荐的下载申请参数
+// 返回值：
+//   - *ApprovalConfig: 默认的下载申请参数
+func DefaultApprovalConfig() *ApprovalConfig {
+	return &ApprovalConfig{
+		PendingTTL: 24 * time.Hour,
+		GrantTTL:   24 * time.Hour,
+	}
+}
+
+// GetApprovalConfig 获取受限文件下载申请的参数
+func (opt *Options) GetApprovalConfig() *ApprovalConfig {
+	return opt.approvalConfig
+}
+
+// BuildApprovalConfig 设置受限文件下载申请的参数
+// 参数：
+//   - config: *ApprovalConfig 下载申请参数
+//
+// 返回值：
+//   - error: 参数无效时返回错误信息
+func (opt *Options) BuildApprovalConfig(config *ApprovalConfig) error {
+	if config == nil || config.PendingTTL <= 0 || config.GrantTTL <= 0 {
+		return fmt.Errorf("下载申请的等待时长与令牌有效时长必须大于 0")
+	}
+	opt.approvalConfig = config
+	return nil
+}
@@ -0,0 +1,65 @@
+package opts
+
+import (
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ClusterConfig 描述由多个进程组成的存储集群
+// 集群成员共同存储文件片段，任一成员接收的片段按片段唯一标识分布到各成员，
+// 片段所在位置由元数据主节点统一记录，上传方将任一成员视为同一个逻辑存储节点
+type ClusterConfig struct {
+	Name    string    // 集群名称，同一集群的成员必须一致
+	Leader  peer.ID   // 元数据主节点，记录各片段所在的成员
+	Members []peer.ID // 集群成员，包括主节点与本节点
+}
+
+// Has 检查节点是否为集群成员
+// 参数：
+//   - id: peer.ID 节点ID
+//
+// 返回值：
+//   - bool: 是否为集群成员
+func (c *ClusterConfig) Has(id peer.ID) bool {
+	if c == nil {
+		return false
+	}
+	for _, member := range c.Members {
+		if member == id {
+			return true
+		}
+	}
+	return false
+}
+
+// GetCluster 获取集群配置，为 nil 时节点独立运行
+func (opt *Options) GetCluster() *ClusterConfig {
+	return opt.cluster
+}
+
+// BuildCluster 设置集群配置
+// 参数：
+//   - config: *ClusterConfig 集群配置，为 nil 时节点独立运行
+//
+// 返回值：
+//   - error: 配置无效时返回错误信息
+func (opt *Options) BuildCluster(config *ClusterConfig) error {
+	if config != nil {
+		if config.Name == "" {
+			return fmt.Errorf("集群名称不能为空")
+		}
+		seen := make(map[peer.ID]bool, len(config.Members))
+		for _, member := range config.Members {
+			if seen[member] {
+				return fmt.Errorf("集群成员 %s 重复", member)
+			}
+			seen[member] = true
+		}
+		if !seen[config.Leader] {
+			return fmt.Errorf("元数据主节点必须是集群成员")
+		}
+	}
+	opt.cluster = config
+	return nil
+}
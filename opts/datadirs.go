@@ -0,0 +1,89 @@
+package opts
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// DataDirs 描述节点数据的存放位置
+// 文件片段、上传任务、清单等始终位于根路径下的 defsdata 目录中，数据库、日志与下载输出可以单独放置
+type DataDirs struct {
+	Root      string // 数据根目录
+	DB        string // 数据库目录，为空时使用根路径下的 db
+	Logs      string // 日志目录，为空时使用根路径下的 logs
+	Downloads string // 下载文件的输出目录
+}
+
+// Validate 检查数据目录是否有效
+// 所有目录必须是绝对路径，且数据库、日志与下载目录不能位于存放文件片段的 files 目录中
+// 返回值：
+//   - error: 目录无效时返回错误信息
+func (d *DataDirs) Validate() error {
+	if d.Root == "" {
+		return fmt.Errorf("数据根目录不能为空")
+	}
+	dirs := map[string]string{"数据根目录": d.Root, "数据库目录": d.DB, "日志目录": d.Logs, "下载目录": d.Downloads}
+	for name, dir := range dirs {
+		if dir != "" && !filepath.IsAbs(dir) {
+			return fmt.Errorf("%s %q 必须是绝对路径", name, dir)
+		}
+	}
+
+	files := filepath.Join(d.Root, "defsdata", "files")
+	for name, dir := range dirs {
+		if dir == "" || dir == d.Root {
+			continue
+		}
+		if within(dir, files) {
+			return fmt.Errorf("%s %q 不能位于文件片段目录 %q 中", name, dir, files)
+		}
+	}
+	return nil
+}
+
+// within 检查 dir 是否等于 root 或位于 root 之中
+func within(dir, root string) bool {
+	rel, err := filepath.Rel(filepath.Clean(root), filepath.Clean(dir))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// GetDataDirs 获取数据目录
+func (opt *Options) GetDataDirs() *DataDirs {
+	return &DataDirs{
+		Root:      opt.rootPath,
+		DB:        opt.dbPath,
+		Logs:      opt.logsPath,
+		Downloads: opt.downloadPath,
+	}
+}
+
+// BuildDataDirs 设置数据目录，目录在节点启动时创建
+// 参数：
+//   - dirs: *DataDirs 数据目录，Root 与 Downloads 为空时保持原有设置
+//
+// 返回值：
+//   - error: 目录无效时返回错误信息
+func (opt *Options) BuildDataDirs(dirs *DataDirs) error {
+	d := *dirs
+	if d.Root == "" {
+		d.Root = opt.rootPath
+	}
+	if d.Downloads == "" {
+		d.Downloads = opt.downloadPath
+	}
+	for _, p := range []*string{&d.Root, &d.DB, &d.Logs, &d.Downloads} {
+		if *p != "" {
+			*p = filepath.Clean(*p)
+		}
+	}
+	if err := d.Validate(); err != nil {
+		return err
+	}
+
+	opt.rootPath = d.Root
+	opt.dbPath = d.DB
+	opt.logsPath = d.Logs
+	opt.downloadPath = d.Downloads
+	return nil
+}
@@ -0,0 +1,47 @@
+package opts
+
+import (
+	"fmt"
+	"time"
+)
+
+// DiskIOConfig 描述下载写入输出文件时的磁盘参数
+// 大文件下载会挤占页缓存，影响同一主机上的其他服务；零值保持普通的缓存写入
+type DiskIOConfig struct {
+	DirectIO     bool          // 对齐的部分使用 O_DIRECT 绕过页缓存写入，文件系统不支持时回退到普通写入
+	DropCache    bool          // 写入后通过 fadvise(DONTNEED) 提示内核释放输出文件的页缓存
+	SyncBytes    int64         // 累计写入多少字节后执行一次 fsync，为 0 时不分批 fsync
+	SyncInterval time.Duration // 两次分批 fsync 之间的最短间隔，用于限制 fsync 的频率
+}
+
+// Validate 检查磁盘参数是否有效
+// 返回值：
+//   - error: 参数无效时返回错误信息
+func (c *DiskIOConfig) Validate() error {
+	if c == nil {
+		return fmt.Errorf("磁盘参数不可为空")
+	}
+	if c.SyncBytes < 0 || c.SyncInterval < 0 {
+		return fmt.Errorf("fsync 的字节数与间隔不可为负数")
+	}
+	return nil
+}
+
+// GetDiskIOConfig 获取下载写入输出文件时的全局磁盘参数
+func (opt *Options) GetDiskIOConfig() *DiskIOConfig {
+	return opt.diskIO
+}
+
+// BuildDiskIOConfig 设置下载写入输出文件时的全局磁盘参数，单个任务可通过下载管理器单独设置
+// 参数：
+//   - config: *DiskIOConfig 磁盘参数
+//
+// 返回值：
+//   - error: 参数无效时返回错误信息
+func (opt *Options) BuildDiskIOConfig(config *DiskIOConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	opt.diskIO = config
+	return nil
+}
@@ -0,0 +1,68 @@
+package opts
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bpfs/defs/stats"
+)
+
+// EdgeCachePolicy 描述热门文件片段的边缘缓存策略
+// 存储节点跟踪各片段的请求热度，热度超过阈值的片段被主动复制到自愿充当缓存的节点，
+// 热点文件的下载请求因此分散到更多节点，减轻原始存储节点的负载
+type EdgeCachePolicy struct {
+	Replicate bool          // 作为存储节点时是否将热门片段复制到缓存节点
+	Threshold float64       // 触发复制的热度，近似于最近 10 分钟内的请求次数
+	Replicas  int           // 每个热门片段最多复制到的缓存节点数量
+	Interval  time.Duration // 检查热门片段和通告缓存意愿的间隔
+
+	Serve    bool          // 是否自愿充当缓存节点，接收其他节点复制的热门片段
+	Capacity int64         // 作为缓存节点时缓存片段占用的空间上限，单位为字节
+	TTL      time.Duration // 缓存的片段在没有请求时保留的时长，到期后删除
+}
+
+// DefaultEdgeCachePolicy 返回推荐的边缘缓存策略，默认只复制热门片段而不充当缓存节点
+// 返回值：
+//   - *EdgeCachePolicy: 默认的边缘缓存策略
+func DefaultEdgeCachePolicy() *EdgeCachePolicy {
+	return &EdgeCachePolicy{
+		Replicate: true,
+		Threshold: 20,
+		Replicas:  3,
+		Interval:  time.Minute,
+		Capacity:  1 << 30, // 1GB
+		TTL:       6 * time.Hour,
+	}
+}
+
+// GetPopularity 获取存储节点上各文件片段的请求热度
+func (opt *Options) GetPopularity() *stats.Popularity {
+	return opt.popularity
+}
+
+// GetEdgeCachePolicy 获取边缘缓存策略，为 nil 时不复制也不缓存热门片段
+func (opt *Options) GetEdgeCachePolicy() *EdgeCachePolicy {
+	return opt.edgeCache
+}
+
+// BuildEdgeCachePolicy 设置边缘缓存策略
+// 参数：
+//   - policy: *EdgeCachePolicy 边缘缓存策略，为 nil 时关闭边缘缓存
+//
+// 返回值：
+//   - error: 参数无效时返回错误信息
+func (opt *Options) BuildEdgeCachePolicy(policy *EdgeCachePolicy) error {
+	if policy != nil {
+		if policy.Interval <= 0 {
+			return fmt.Errorf("边缘缓存的检查间隔必须大于0")
+		}
+		if policy.Replicate && (policy.Threshold <= 0 || policy.Replicas <= 0) {
+			return fmt.Errorf("复制热门片段的热度阈值与缓存节点数量必须大于0")
+		}
+		if policy.Serve && (policy.Capacity <= 0 || policy.TTL <= 0) {
+			return fmt.Errorf("缓存节点的空间上限与保留时长必须大于0")
+		}
+	}
+	opt.edgeCache = policy
+	return nil
+}
@@ -0,0 +1,70 @@
+package opts
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bpfs/defs/qos"
+)
+
+// KeepaliveConfig 描述长时间传输的保活与停滞检测参数
+type KeepaliveConfig struct {
+	Interval     time.Duration               // 传输持续超过该时间后，按该间隔向对方发送保活探测，0 表示不发送
+	StallTimeout map[qos.Class]time.Duration // 各服务等级允许的无进展时间，超过时中止传输以便重新调度，0 表示不检测
+}
+
+// DefaultKeepaliveConfig 返回推荐的保活与停滞检测参数
+// 返回值：
+//   - *KeepaliveConfig: 默认的保活与停滞检测参数
+func DefaultKeepaliveConfig() *KeepaliveConfig {
+	return &KeepaliveConfig{
+		Interval: 15 * time.Second,
+		StallTimeout: map[qos.Class]time.Duration{
+			qos.ClassInteractive: 15 * time.Second, // 交互：尽快换节点重试
+			qos.ClassNormal:      30 * time.Second, // 普通
+			qos.ClassBackground:  60 * time.Second, // 后台：容忍较慢的节点
+		},
+	}
+}
+
+// Stall 获取服务等级允许的无进展时间
+// 参数：
+//   - class: qos.Class 服务等级
+//
+// 返回值：
+//   - time.Duration: 允许的无进展时间，0 表示不检测
+func (c *KeepaliveConfig) Stall(class qos.Class) time.Duration {
+	if c == nil {
+		return 0
+	}
+	return c.StallTimeout[class]
+}
+
+// GetKeepalive 获取保活与停滞检测参数，为 nil 时表示不保活也不检测停滞
+func (opt *Options) GetKeepalive() *KeepaliveConfig {
+	return opt.keepalive
+}
+
+// BuildKeepalive 设置保活与停滞检测参数
+// 参数：
+//   - config: *KeepaliveConfig 保活与停滞检测参数，为 nil 时关闭
+//
+// 返回值：
+//   - error: 参数无效时返回错误信息
+func (opt *Options) BuildKeepalive(config *KeepaliveConfig) error {
+	if config != nil {
+		if config.Interval < 0 {
+			return fmt.Errorf("保活间隔不能为负数")
+		}
+		for class, timeout := range config.StallTimeout {
+			if !class.Valid() {
+				return fmt.Errorf("无效的服务等级 %d", class)
+			}
+			if timeout < 0 {
+				return fmt.Errorf("服务等级 %s 的停滞时间不能为负数", class)
+			}
+		}
+	}
+	opt.keepalive = config
+	return nil
+}
@@ -5,9 +5,20 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"time"
 
+	"github.com/bpfs/defs/advertise"
+	"github.com/bpfs/defs/commitment"
+	"github.com/bpfs/defs/gate"
+	"github.com/bpfs/defs/identity"
+	"github.com/bpfs/defs/keys"
+	"github.com/bpfs/defs/middleware"
 	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/defs/pin"
+	"github.com/bpfs/defs/profile"
+	"github.com/bpfs/defs/qos"
+	"github.com/bpfs/defs/stats"
 )
 
 const (
@@ -27,49 +38,137 @@ const (
 
 // Options 是用于创建文件存储对象的参数
 type Options struct {
-	storageMode         StorageMode       // 存储模式
-	defaultBufSize      int64             // 常用缓冲区的大小(在 Go 标准库中，常常使用的缓冲区大小是 4096 或 8192 字节)
-	maxBufferSize       int64             // 最大缓冲区的大小
-	maxSliceSize        int64             // 最大片段的大小(文件大于最大片段的大小时，自动切换至'切片模式')
-	minSliceSize        int64             // 最小片段的大小(文件小于最小片段的大小时，自动切换至'文件模式')
-	dataShards          int64             // 文件数据片段的数量
-	parityShards        int64             // 奇偶校验片段的数量
-	shardSize           int64             // 文件片段的大小
-	parityRatio         float64           // 奇偶校验片段占比(根据文件大小计算并向上取整)
-	defaultOwnerPriv    *ecdsa.PrivateKey // 默认所有者私钥(ECDSA 椭圆曲线数字签名算法)
-	defaultFileKey      string            // 默认文件密钥(AES 对称加密算法)
-	rootPath            string            // 文件根路径
-	downloadPath        string            // 下载路径
-	downloadMaximumSize int64             // 下载最大回复大小
-	maxRetries          int64             // 最大重试次数
-	retryInterval       time.Duration     // 重试间隔
-	localStorage        bool              // 是否开启本地存储，上传成功后保留本地文件片段
-	routingTableLow     int64             // 路由表中连接的最小节点数量
-	maxXrefTable        int64             // Xref表中段的最大数量(限制文件无限膨胀)
-	maxUploadSize       int64             // 最大上传大小，单位为字节
-	minUploadSize       int64             // 最小上传大小，单位为字节
+	storageMode         StorageMode           // 存储模式
+	defaultBufSize      int64                 // 常用缓冲区的大小(在 Go 标准库中，常常使用的缓冲区大小是 4096 或 8192 字节)
+	maxBufferSize       int64                 // 最大缓冲区的大小
+	maxSliceSize        int64                 // 最大片段的大小(文件大于最大片段的大小时，自动切换至'切片模式')
+	minSliceSize        int64                 // 最小片段的大小(文件小于最小片段的大小时，自动切换至'文件模式')
+	dataShards          int64                 // 文件数据片段的数量
+	parityShards        int64                 // 奇偶校验片段的数量
+	shardSize           int64                 // 文件片段的大小
+	parityRatio         float64               // 奇偶校验片段占比(根据文件大小计算并向上取整)
+	defaultOwnerPriv    *ecdsa.PrivateKey     // 默认所有者私钥(ECDSA 椭圆曲线数字签名算法)
+	defaultFileKey      string                // 默认文件密钥(AES 对称加密算法)
+	rootPath            string                // 文件根路径
+	downloadPath        string                // 下载路径
+	dbPath              string                // 数据库目录，为空时使用根路径下的 db
+	logsPath            string                // 日志目录，为空时使用根路径下的 logs
+	downloadMaximumSize int64                 // 下载最大回复大小
+	maxRetries          int64                 // 最大重试次数
+	retryInterval       time.Duration         // 重试间隔
+	localStorage        bool                  // 是否开启本地存储，上传成功后保留本地文件片段
+	routingTableLow     int64                 // 路由表中连接的最小节点数量
+	maxXrefTable        int64                 // Xref表中段的最大数量(限制文件无限膨胀)
+	maxUploadSize       int64                 // 最大上传大小，单位为字节
+	minUploadSize       int64                 // 最小上传大小，单位为字节
+	indexNode           bool                  // 是否作为索引节点，接收、复制并响应文件元数据的搜索请求
+	encryptMetadata     bool                  // 是否加密文件元数据，存储节点仅能看到片段数据和大小
+	metadataGrantees    []*ecdsa.PublicKey    // 被授权解密文件元数据的身份
+	compressUploads     bool                  // 是否在分片前压缩文件内容，不可压缩的类型自动跳过
+	deltaManifests      bool                  // 是否在上传后保存块清单，供之后的新版本增量上传
+	announceShards      int                   // 文件下载请求主题按文件唯一标识前缀划分的分片数量，不大于 1 时使用单一主题
+	adminConfig         *AdminConfig          // 管理控制台的监听参数，为 nil 时不启动
+	peerModePolicy      *PeerModePolicy       // 节点模式(客户端/服务端)自动切换的条件，为 nil 时不自动切换
+	streamConfig        *StreamConfig         // 流协议的超时与消息大小限制
+	streamPool          *StreamPoolConfig     // 可复用流连接池参数
+	keepalive           *KeepaliveConfig      // 长时间传输的保活与停滞检测参数
+	readOnly            *atomic.Bool          // 节点是否处于只读模式，运行时可修改，选项副本共享同一状态
+	dryRun              *atomic.Bool          // 破坏性操作是否仅演练，运行时可修改，选项副本共享同一状态
+	scrubConfig         *ScrubConfig          // 存储节点后台校验文件片段的参数，为 nil 时不校验
+	cluster             *ClusterConfig        // 集群配置，为 nil 时节点独立运行
+	middleware          *middleware.Registry  // 上传与下载流程的中间件
+	scheduler           *qos.Scheduler        // 按服务等级分配带宽与并发的全局传输调度器
+	counters            *stats.Counters       // 传输与存储计数器
+	bandwidth           *stats.Bandwidth      // 上传与下载共享的节点带宽估计
+	reputation          *stats.Reputation     // 存储节点的信誉，由存储承诺争议累计
+	evictionPolicy      *stats.EvictionPolicy // 按有用性驱逐路由表节点的策略
+	commitmentDuration  time.Duration         // 上传时要求存储节点承诺保存片段的时长，为 0 时不要求承诺
+	maxCommitment       time.Duration         // 作为存储节点时愿意承诺的最长时长
+	reservationTTL      time.Duration         // 上传前在存储节点预留空间的有效期，为 0 时不预留
+	receipts            *commitment.Store     // 存储节点签发的存储承诺收据
+	commitments         *commitment.Store     // 本节点作为存储节点签发的存储承诺收据
+	pins                *pin.Store            // 存储节点上被固定、不可清理的文件
+	datagramAddr        string                // QUIC 数据报传输的监听地址，为空时不启用
+	placementPolicy     *PlacementPolicy      // 文件片段在存储节点间的分布约束，为 nil 时不约束
+	kvMaxValueSize      int                   // 键值存储中单个值(加密后)的大小上限
+	kvMaxKeys           int                   // 键值存储中单个身份的键数量上限
+	approvalConfig      *ApprovalConfig       // 受限文件下载申请的参数
+	keyProvider         keys.KeyProvider      // 文件加密密钥的获取方式
+	gater               *gate.Gater           // 按节点ID与 IP 段限制连接
+	offlineQueueTTL     time.Duration         // 离线时排队的下载任务等待网络恢复的最长时间，为 0 时不排队
+	progressFlush       *ProgressFlushConfig  // 传输进度写入任务记录的合并参数
+	advertiser          *advertise.Advertiser // 按策略筛选并排序通告的地址
+	expirySweepInterval time.Duration         // 存储节点清理到期文件片段的间隔，为 0 时只响应到期通知
+	wireFEC             *WireFECConfig        // 数据报传输的前向纠错参数
+	linkLoss            *stats.LinkLoss       // 数据报传输采样的节点链路丢包率估计
+	diskIO              *DiskIOConfig         // 下载写入输出文件时的磁盘参数
+	verifyLevel         VerifyLevel           // 下载任务的默认校验级别
+	uploadProfiles      *profile.Store        // 命名的上传参数组合
+	identities          *identity.Registry    // 节点身份的连续性记录
+	popularity          *stats.Popularity     // 存储节点上各文件片段的请求热度
+	edgeCache           *EdgeCachePolicy      // 热门文件片段的边缘缓存策略，为 nil 时不复制也不缓存
+	standby             *StandbyPolicy        // 元数据的热备复制策略，为 nil 时不复制
+	power               *PowerPolicy          // 后台上传的电源感知策略，为 nil 时不感知电源状态
+	versionPolicy       *VersionPolicy        // 节点软件版本的检查策略，为 nil 时只记录版本而不检查
+	downloadAdmission   *DownloadAdmission    // 下载任务的准入控制，为 nil 时不限制同时进行的下载任务数量
+	supervision         *SupervisionConfig    // 各子系统后台任务的崩溃恢复参数，为 nil 时崩溃后不重启
 }
 
 // DefaultOptions 设置一个推荐选项列表以获得良好的性能。
 func DefaultOptions() *Options {
 	return &Options{
-		storageMode:         RS_Proportion,               // 纠删码(比例)模式
-		defaultBufSize:      1 << 12,                     // 4KB
-		maxBufferSize:       1 << 30,                     // 1GB
-		maxSliceSize:        1 << 25,                     // 32M
-		minSliceSize:        1 << 10,                     // 1KB
-		shardSize:           1 << 19,                     // 512KB
-		parityRatio:         0.3,                         // 30%
-		rootPath:            paths.GetRootPath(),         // 默认根路径
-		downloadPath:        paths.DefaultDownloadPath(), // 默认下载路径
-		downloadMaximumSize: 2 * 1024 * 1024,             // 设置下载最大回复大小为 1M
-		maxRetries:          5,                           // 最大重试次数
-		retryInterval:       50 * time.Second,            // 重试间隔为50秒
-		localStorage:        true,                        // 默认开启本地存储
-		routingTableLow:     2,                           // 路由表中连接的最小连接2个节点
-		maxXrefTable:        10000,                       // Xref表中段的最大数量
-		maxUploadSize:       10 << 30,                    // 最大上传大小为10GB
-		minUploadSize:       1 << 20,                     // 最小上传大小为1MB
+		storageMode:         RS_Proportion,                 // 纠删码(比例)模式
+		defaultBufSize:      1 << 12,                       // 4KB
+		maxBufferSize:       1 << 30,                       // 1GB
+		maxSliceSize:        1 << 25,                       // 32M
+		minSliceSize:        1 << 10,                       // 1KB
+		shardSize:           1 << 19,                       // 512KB
+		parityRatio:         0.3,                           // 30%
+		rootPath:            paths.GetRootPath(),           // 默认根路径
+		downloadPath:        paths.DefaultDownloadPath(),   // 默认下载路径
+		downloadMaximumSize: 2 * 1024 * 1024,               // 设置下载最大回复大小为 1M
+		maxRetries:          5,                             // 最大重试次数
+		retryInterval:       50 * time.Second,              // 重试间隔为50秒
+		localStorage:        true,                          // 默认开启本地存储
+		routingTableLow:     2,                             // 路由表中连接的最小连接2个节点
+		maxXrefTable:        10000,                         // Xref表中段的最大数量
+		maxUploadSize:       10 << 30,                      // 最大上传大小为10GB
+		minUploadSize:       1 << 20,                       // 最小上传大小为1MB
+		streamConfig:        DefaultStreamConfig(),         // 流协议的超时与消息大小限制
+		streamPool:          DefaultStreamPoolConfig(),     // 可复用流连接池参数
+		keepalive:           DefaultKeepaliveConfig(),      // 保活与停滞检测参数
+		middleware:          middleware.NewRegistry(),      // 上传与下载流程的中间件
+		scheduler:           qos.NewScheduler(nil),         // 全局传输调度器
+		counters:            stats.NewCounters(),           // 传输与存储计数器
+		bandwidth:           stats.NewBandwidth(),          // 节点带宽估计
+		reputation:          stats.NewReputation(),         // 存储节点的信誉
+		evictionPolicy:      stats.DefaultEvictionPolicy(), // 路由表节点驱逐策略
+		maxCommitment:       30 * 24 * time.Hour,           // 最长承诺30天
+		reservationTTL:      2 * time.Minute,               // 预留空间2分钟内有效
+		receipts:            commitment.NewStore(),         // 存储承诺收据
+		commitments:         commitment.NewStore(),         // 本节点签发的存储承诺收据
+		pins:                pin.NewStore(),                // 被固定的文件
+		kvMaxValueSize:      64 << 10,                      // 单个值64KB
+		kvMaxKeys:           4096,                          // 单个身份4096个键
+		announceShards:      1,                             // 单一的文件下载请求主题
+		approvalConfig:      DefaultApprovalConfig(),       // 下载申请参数
+		keyProvider:         keys.Local{},                  // 由所有者私钥派生文件加密密钥
+		gater:               gate.NewGater(),               // 默认允许所有连接
+		readOnly:            new(atomic.Bool),              // 默认可写
+		dryRun:              new(atomic.Bool),              // 默认执行破坏性操作
+		offlineQueueTTL:     24 * time.Hour,                // 离线排队的下载任务等待24小时
+		progressFlush:       DefaultProgressFlushConfig(),  // 进度合并参数
+		advertiser:          advertise.NewAdvertiser(),     // 默认通告全部监听地址
+		expirySweepInterval: time.Hour,                     // 每小时清理到期的文件片段
+		wireFEC:             DefaultWireFECConfig(),        // 默认不启用前向纠错
+		linkLoss:            stats.NewLinkLoss(),           // 节点链路丢包率估计
+		diskIO:              &DiskIOConfig{},               // 默认使用普通的缓存写入
+		verifyLevel:         VerifyFull,                    // 默认完整校验
+		uploadProfiles:      profile.NewStore(),            // 内置的上传参数组合
+		identities:          identity.NewRegistry(),        // 节点身份的连续性记录
+		popularity:          stats.NewPopularity(0),        // 文件片段的请求热度
+		downloadAdmission:   DefaultDownloadAdmission(),    // 限制同时进行的下载任务数量
+		supervision:         DefaultSupervisionConfig(),    // 后台任务崩溃后重启
 	}
 }
 
@@ -186,6 +285,106 @@ func (opt *Options) GetMinUploadSize() int64 {
 	return opt.minUploadSize
 }
 
+// GetMiddleware 获取上传与下载流程的中间件
+func (opt *Options) GetMiddleware() *middleware.Registry {
+	return opt.middleware
+}
+
+// GetEncryptMetadata 获取是否加密文件元数据
+func (opt *Options) GetEncryptMetadata() bool {
+	return opt.encryptMetadata
+}
+
+// GetCompressUploads 获取是否在分片前压缩文件内容
+func (opt *Options) GetCompressUploads() bool {
+	return opt.compressUploads
+}
+
+// GetDeltaManifests 获取是否在上传后保存块清单
+func (opt *Options) GetDeltaManifests() bool {
+	return opt.deltaManifests
+}
+
+// GetAnnounceShards 获取文件下载请求主题的分片数量
+func (opt *Options) GetAnnounceShards() int {
+	return opt.announceShards
+}
+
+// GetMetadataGrantees 获取被授权解密文件元数据的身份
+func (opt *Options) GetMetadataGrantees() []*ecdsa.PublicKey {
+	return opt.metadataGrantees
+}
+
+// GetScheduler 获取全局传输调度器
+func (opt *Options) GetScheduler() *qos.Scheduler {
+	return opt.scheduler
+}
+
+// GetCounters 获取传输与存储计数器
+func (opt *Options) GetCounters() *stats.Counters {
+	return opt.counters
+}
+
+// GetBandwidth 获取上传与下载共享的节点带宽估计
+func (opt *Options) GetBandwidth() *stats.Bandwidth {
+	return opt.bandwidth
+}
+
+// GetReputation 获取存储节点的信誉，选择存储节点时信誉较低的节点排在后面
+func (opt *Options) GetReputation() *stats.Reputation {
+	return opt.reputation
+}
+
+// GetEvictionPolicy 获取按有用性驱逐路由表节点的策略，为 nil 时不驱逐
+func (opt *Options) GetEvictionPolicy() *stats.EvictionPolicy {
+	return opt.evictionPolicy
+}
+
+// BuildEvictionPolicy 设置按有用性驱逐路由表节点的策略，传入 nil 时不驱逐
+func (opt *Options) BuildEvictionPolicy(policy *stats.EvictionPolicy) {
+	opt.evictionPolicy = policy
+}
+
+// GetCommitmentDuration 获取上传时要求存储节点承诺保存片段的时长
+func (opt *Options) GetCommitmentDuration() time.Duration {
+	return opt.commitmentDuration
+}
+
+// GetMaxCommitment 获取作为存储节点时愿意承诺的最长时长
+func (opt *Options) GetMaxCommitment() time.Duration {
+	return opt.maxCommitment
+}
+
+// GetReceipts 获取存储承诺收据
+func (opt *Options) GetReceipts() *commitment.Store {
+	return opt.receipts
+}
+
+// GetCommitments 获取本节点作为存储节点签发的存储承诺收据，承诺期内不清理对应的片段
+func (opt *Options) GetCommitments() *commitment.Store {
+	return opt.commitments
+}
+
+// GetPins 获取存储节点上被固定的文件
+func (opt *Options) GetPins() *pin.Store {
+	return opt.pins
+}
+
+// GetDatagramTransport 获取 QUIC 数据报传输的监听地址，为空时表示未启用
+func (opt *Options) GetDatagramTransport() string {
+	return opt.datagramAddr
+}
+
+// GetKVLimits 获取键值存储中单个值的大小上限及单个身份的键数量上限
+func (opt *Options) GetKVLimits() (int, int) {
+	return opt.kvMaxValueSize, opt.kvMaxKeys
+}
+
+// GetIndexNode 获取是否作为索引节点
+func (opt *Options) GetIndexNode() bool {
+	return opt.indexNode
+}
+
 ////////////////////////////////////////////////
 
 // GetShardsOptions 获取奇偶分片大小选项
@@ -360,3 +559,147 @@ func (opt *Options) BuildMaxUploadSize(size int64) {
 func (opt *Options) BuildMinUploadSize(size int64) {
 	opt.minUploadSize = size
 }
+
+// BuildEncryptMetadata 设置是否加密文件元数据
+// 开启后文件名、MIME类型等元数据仅所有者及被授权的身份可以解密
+func (opt *Options) BuildEncryptMetadata(isEnable bool, grantees ...*ecdsa.PublicKey) {
+	opt.encryptMetadata = isEnable
+	opt.metadataGrantees = grantees
+}
+
+// BuildCompressUploads 设置是否在分片前压缩文件内容
+// 开启后图片、视频、压缩包等已压缩的内容及试压缩效果不佳的文件仍保持原样
+func (opt *Options) BuildCompressUploads(isEnable bool) {
+	opt.compressUploads = isEnable
+}
+
+// BuildDeltaManifests 设置是否在上传后保存块清单
+// 开启后每次上传都会对文件分块并保存块清单，之后可通过 NewUploadDelta 只上传新版本中变化的内容。
+// 增量版本在网络中作为普通文件存储，下载流程不会自动合并：下载方需持有上一版本，
+// 下载增量清单后调用 delta.ApplyFile 得到新版本
+func (opt *Options) BuildDeltaManifests(isEnable bool) {
+	opt.deltaManifests = isEnable
+}
+
+// BuildAnnounceShards 设置文件下载请求主题的分片数量
+// 网络中的节点应使用相同的分片数量，不大于 1 时所有请求使用单一的全局主题
+func (opt *Options) BuildAnnounceShards(shards int) {
+	opt.announceShards = shards
+}
+
+// BuildScheduler 设置全局传输调度器的总带宽与各服务等级的份额
+func (opt *Options) BuildScheduler(config *qos.Config) {
+	opt.scheduler = qos.NewScheduler(config)
+}
+
+// GetGater 获取连接限制
+// 构建主机时通过 libp2p.ConnectionGater(opt.GetGater()) 传入，可在协议握手之前拒绝连接
+func (opt *Options) GetGater() *gate.Gater {
+	return opt.gater
+}
+
+// BuildGater 设置连接限制
+// 参数：
+//   - gater: *gate.Gater 连接限制，为 nil 时不限制
+func (opt *Options) BuildGater(gater *gate.Gater) {
+	opt.gater = gater
+}
+
+// GetAdvertiser 获取地址通告控制
+// 构建主机时通过 libp2p.AddrsFactory(opt.GetAdvertiser().Factory) 传入，通告策略才会生效
+func (opt *Options) GetAdvertiser() *advertise.Advertiser {
+	return opt.advertiser
+}
+
+// BuildAddressPolicy 设置通告地址的策略
+// 参数：
+//   - policy: advertise.Policy 通告策略
+//
+// 返回值：
+//   - error: 策略无效时返回包装了 errs.ErrInvalidArgument 的错误
+func (opt *Options) BuildAddressPolicy(policy advertise.Policy) error {
+	return opt.advertiser.SetPolicy(policy)
+}
+
+// GetKeyProvider 获取文件加密密钥的获取方式
+func (opt *Options) GetKeyProvider() keys.KeyProvider {
+	return opt.keyProvider
+}
+
+// BuildKeyProvider 设置文件加密密钥的获取方式，例如由口令派生或交给外部的密钥管理系统
+// 更换获取方式后，此前上传的文件需使用原来的方式才能下载
+// 参数：
+//   - provider: keys.KeyProvider 文件加密密钥的获取方式，为 nil 时使用默认方式
+func (opt *Options) BuildKeyProvider(provider keys.KeyProvider) {
+	if provider == nil {
+		provider = keys.Local{}
+	}
+	opt.keyProvider = provider
+}
+
+// GetReservationTTL 获取上传前在存储节点预留空间的有效期
+func (opt *Options) GetReservationTTL() time.Duration {
+	return opt.reservationTTL
+}
+
+// BuildReservationTTL 设置上传前在存储节点预留空间的有效期，为 0 时不预留，直接发送片段
+func (opt *Options) BuildReservationTTL(ttl time.Duration) {
+	opt.reservationTTL = ttl
+}
+
+// GetOfflineQueueTTL 获取离线时排队的下载任务等待网络恢复的最长时间
+func (opt *Options) GetOfflineQueueTTL() time.Duration {
+	return opt.offlineQueueTTL
+}
+
+// BuildOfflineQueueTTL 设置离线时排队的下载任务等待网络恢复的最长时间，为 0 时不排队，立即开始下载
+func (opt *Options) BuildOfflineQueueTTL(ttl time.Duration) {
+	if ttl >= 0 {
+		opt.offlineQueueTTL = ttl
+	}
+}
+
+// GetIdentities 获取节点身份的连续性记录
+func (opt *Options) GetIdentities() *identity.Registry {
+	return opt.identities
+}
+
+// GetExpirySweepInterval 获取存储节点清理到期文件片段的间隔
+func (opt *Options) GetExpirySweepInterval() time.Duration {
+	return opt.expirySweepInterval
+}
+
+// BuildExpirySweepInterval 设置存储节点清理到期文件片段的间隔，为 0 时只在收到所有者的到期通知时清理
+func (opt *Options) BuildExpirySweepInterval(interval time.Duration) {
+	if interval >= 0 {
+		opt.expirySweepInterval = interval
+	}
+}
+
+// BuildCommitmentDuration 设置上传时要求存储节点承诺保存片段的时长，为 0 时不要求承诺
+func (opt *Options) BuildCommitmentDuration(duration time.Duration) {
+	opt.commitmentDuration = duration
+}
+
+// BuildMaxCommitment 设置作为存储节点时愿意承诺的最长时长，为 0 时不签发收据
+func (opt *Options) BuildMaxCommitment(duration time.Duration) {
+	opt.maxCommitment = duration
+}
+
+// BuildDatagramTransport 设置 QUIC 数据报传输的监听地址，例如 "0.0.0.0:0"，为空时不启用
+// 启用后向同样启用的节点发送片段时优先使用数据报传输，失败时回退到流传输；
+// 适用于高延迟、高丢包的链路，其他情况下流传输仍是默认方式
+func (opt *Options) BuildDatagramTransport(listenAddr string) {
+	opt.datagramAddr = listenAddr
+}
+
+// BuildKVLimits 设置键值存储中单个值(加密后)的大小上限及单个身份的键数量上限
+func (opt *Options) BuildKVLimits(maxValueSize, maxKeys int) {
+	opt.kvMaxValueSize = maxValueSize
+	opt.kvMaxKeys = maxKeys
+}
+
+// BuildIndexNode 设置是否作为索引节点
+func (opt *Options) BuildIndexNode(isEnable bool) {
+	opt.indexNode = isEnable
+}
@@ -0,0 +1,34 @@
+package opts
+
+import "time"
+
+// PeerModePolicy 描述节点自动切换客户端/服务端模式的条件
+// 同时满足所有条件的节点以服务端模式对外声明，接收其他节点的文件片段，否则以客户端模式声明
+type PeerModePolicy struct {
+	RequireReachable  bool          // 是否要求节点可以被公网访问(非NAT之后)
+	MinAvailableSpace uint64        // 最小可用磁盘空间，单位为字节
+	MinUptime         time.Duration // 最短在线时长
+	Interval          time.Duration // 重新评估的间隔
+}
+
+// DefaultPeerModePolicy 返回推荐的节点模式切换条件
+// 返回值：
+//   - *PeerModePolicy: 默认的节点模式切换条件
+func DefaultPeerModePolicy() *PeerModePolicy {
+	return &PeerModePolicy{
+		RequireReachable:  true,             // 要求公网可达
+		MinAvailableSpace: 10 << 30,         // 10GB
+		MinUptime:         10 * time.Minute, // 10分钟
+		Interval:          5 * time.Minute,  // 5分钟
+	}
+}
+
+// GetPeerModePolicy 获取节点模式自动切换的条件，未开启时返回 nil
+func (opt *Options) GetPeerModePolicy() *PeerModePolicy {
+	return opt.peerModePolicy
+}
+
+// BuildPeerModePolicy 设置节点模式自动切换的条件，传入 nil 时关闭自动切换
+func (opt *Options) BuildPeerModePolicy(policy *PeerModePolicy) {
+	opt.peerModePolicy = policy
+}
@@ -0,0 +1,87 @@
+package opts
+
+import "github.com/libp2p/go-libp2p/core/peer"
+
+// PlacementPolicy 描述文件片段在存储节点间的分布约束
+// 上传及失败重试选择存储节点时都会遵守该约束，避免同一文件的片段集中在少数节点或区域
+type PlacementPolicy struct {
+	MaxSegmentsPerPeer int                  // 同一文件在单个节点上存放的片段数上限，为 0 时不限制
+	MaxSegmentsPerZone int                  // 同一文件在单个区域内存放的片段数上限，为 0 时不限制
+	Zone               func(peer.ID) string // 返回节点所在的区域(机房、地域等)，为 nil 或返回空字符串时不按区域约束
+	SeparateParity     bool                 // 纠删码片段与数据片段放置在不相交的节点上
+	SeparateZones      bool                 // 纠删码片段与数据片段放置在不同的区域，需同时设置 Zone
+}
+
+// Allows 检查在已有分布的基础上，是否允许将片段放置到指定节点
+// 参数：
+//   - node: peer.ID 候选节点
+//   - placed: []peer.ID 同一文件其他片段已放置的节点
+//
+// 返回值：
+//   - bool: 是否满足分布约束
+func (p *PlacementPolicy) Allows(node peer.ID, placed []peer.ID) bool {
+	if p == nil {
+		return true
+	}
+
+	var zone string
+	if p.Zone != nil {
+		zone = p.Zone(node)
+	}
+
+	var onPeer, inZone int
+	for _, id := range placed {
+		if id == node {
+			onPeer++
+		}
+		if zone != "" && p.Zone(id) == zone {
+			inZone++
+		}
+	}
+
+	if p.MaxSegmentsPerPeer > 0 && onPeer >= p.MaxSegmentsPerPeer {
+		return false
+	}
+	if zone != "" && p.MaxSegmentsPerZone > 0 && inZone >= p.MaxSegmentsPerZone {
+		return false
+	}
+	return true
+}
+
+// Separates 检查将片段放置到指定节点时，是否满足数据片段与纠删码片段的分离约束
+// 数据片段所在的节点同时失效时，仍可从另一组节点上的纠删码片段恢复
+// 参数：
+//   - node: peer.ID 候选节点
+//   - opposite: []peer.ID 同一文件中另一类片段已放置的节点(放置数据片段时为纠删码片段的节点，反之亦然)
+//
+// 返回值：
+//   - bool: 是否满足分离约束
+func (p *PlacementPolicy) Separates(node peer.ID, opposite []peer.ID) bool {
+	if p == nil || (!p.SeparateParity && !p.SeparateZones) {
+		return true
+	}
+
+	var zone string
+	if p.SeparateZones && p.Zone != nil {
+		zone = p.Zone(node)
+	}
+	for _, id := range opposite {
+		if p.SeparateParity && id == node {
+			return false
+		}
+		if zone != "" && p.Zone(id) == zone {
+			return false
+		}
+	}
+	return true
+}
+
+// GetPlacementPolicy 获取文件片段的分布约束，未设置时返回 nil
+func (opt *Options) GetPlacementPolicy() *PlacementPolicy {
+	return opt.placementPolicy
+}
+
+// BuildPlacementPolicy 设置文件片段的分布约束，传入 nil 时不约束
+func (opt *Options) BuildPlacementPolicy(policy *PlacementPolicy) {
+	opt.placementPolicy = policy
+}
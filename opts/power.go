@@ -0,0 +1,77 @@
+package opts
+
+import (
+	"fmt"
+	"time"
+)
+
+// PowerState 嵌入方报告的设备电源与网络状态
+type PowerState struct {
+	OnBattery bool // 是否使用电池供电
+	Battery   int  // 剩余电量百分比(0-100)，未知时为 -1
+	Metered   bool // 当前网络连接是否按流量计费
+}
+
+// PowerPolicy 描述后台上传对设备电源与网络状态的响应
+// 电池供电且电量低于阈值，或连接按流量计费时，服务等级为后台的上传任务自动暂停，条件恢复后自动继续
+type PowerPolicy struct {
+	State          func() PowerState // 获取当前状态的平台回调，由嵌入方提供
+	MinBattery     int               // 电池供电时允许后台上传的最低电量百分比
+	PauseOnMetered bool              // 连接按流量计费时是否暂停后台上传
+	Interval       time.Duration     // 调用平台回调检查状态的间隔
+}
+
+// DefaultPowerPolicy 返回推荐的电源感知参数，使用时需设置 State
+// 返回值：
+//   - *PowerPolicy: 默认的电源感知策略
+func DefaultPowerPolicy() *PowerPolicy {
+	return &PowerPolicy{
+		MinBattery:     20,               // 电量低于20%时暂停
+		PauseOnMetered: true,             // 按流量计费时暂停
+		Interval:       30 * time.Second, // 30秒
+	}
+}
+
+// Constrained 检查状态是否要求暂停后台上传
+// 参数：
+//   - state: PowerState 设备电源与网络状态
+//
+// 返回值：
+//   - string: 需要暂停的原因，为空时不需要暂停
+func (p *PowerPolicy) Constrained(state PowerState) string {
+	switch {
+	case state.OnBattery && state.Battery >= 0 && state.Battery < p.MinBattery:
+		return fmt.Sprintf("电池电量 %d%% 低于 %d%%", state.Battery, p.MinBattery)
+	case p.PauseOnMetered && state.Metered:
+		return "网络连接按流量计费"
+	default:
+		return ""
+	}
+}
+
+// GetPowerPolicy 获取后台上传的电源感知策略，为 nil 时不感知电源状态
+func (opt *Options) GetPowerPolicy() *PowerPolicy {
+	return opt.power
+}
+
+// BuildPowerPolicy 设置后台上传的电源感知策略
+// 参数：
+//   - policy: *PowerPolicy 电源感知策略，为 nil 时关闭
+//
+// 返回值：
+//   - error: 参数无效时返回错误信息
+func (opt *Options) BuildPowerPolicy(policy *PowerPolicy) error {
+	if policy != nil {
+		if policy.State == nil {
+			return fmt.Errorf("电源感知需要提供获取电源状态的平台回调")
+		}
+		if policy.MinBattery < 0 || policy.MinBattery > 100 {
+			return fmt.Errorf("最低电量百分比必须在0到100之间")
+		}
+		if policy.Interval <= 0 {
+			return fmt.Errorf("检查电源状态的间隔必须大于0")
+		}
+	}
+	opt.power = policy
+	return nil
+}
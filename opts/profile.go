@@ -0,0 +1,61 @@
+package opts
+
+import (
+	"fmt"
+
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/profile"
+)
+
+// GetUploadProfiles 获取命名的上传参数集合
+func (opt *Options) GetUploadProfiles() *profile.Store {
+	return opt.uploadProfiles
+}
+
+// WithUploadProfile 返回应用了上传参数组合的选项副本，原选项保持不变
+// 副本与原选项共享计数器、调度器等运行时状态，只替换参数组合中设置的字段；到期时间由上传时设置
+// 参数：
+//   - p: *profile.Profile 上传参数组合
+//
+// 返回值：
+//   - *Options: 选项副本
+//   - error: 参数无效时返回包装了 errs.ErrInvalidArgument 的错误
+func (opt *Options) WithUploadProfile(p *profile.Profile) (*Options, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	derived := *opt
+
+	if p.ShardSize > 0 {
+		if p.ShardSize > opt.maxSliceSize || p.ShardSize < opt.minSliceSize {
+			return nil, fmt.Errorf("%w: 文件片段的大小 %d 超出范围 [%d, %d]", errs.ErrInvalidArgument, p.ShardSize, opt.minSliceSize, opt.maxSliceSize)
+		}
+		derived.shardSize = p.ShardSize
+	}
+	if p.ParityRatio > 0 {
+		derived.storageMode = RS_Proportion // 比例模式
+		derived.parityRatio = p.ParityRatio
+	}
+	if p.Compress != nil {
+		derived.compressUploads = *p.Compress
+	}
+
+	if p.MaxSegmentsPerPeer > 0 || p.MaxSegmentsPerZone > 0 || p.SeparateParity || p.SeparateZones {
+		// 沿用全局策略中的区域划分
+		policy := PlacementPolicy{}
+		if opt.placementPolicy != nil {
+			policy = *opt.placementPolicy
+		}
+		if p.MaxSegmentsPerPeer > 0 {
+			policy.MaxSegmentsPerPeer = p.MaxSegmentsPerPeer
+		}
+		if p.MaxSegmentsPerZone > 0 {
+			policy.MaxSegmentsPerZone = p.MaxSegmentsPerZone
+		}
+		policy.SeparateParity = policy.SeparateParity || p.SeparateParity
+		policy.SeparateZones = policy.SeparateZones || p.SeparateZones
+		derived.placementPolicy = &policy
+	}
+
+	return &derived, nil
+}
@@ -0,0 +1,42 @@
+package opts
+
+import (
+	"fmt"
+	"time"
+)
+
+// ProgressFlushConfig 描述传输进度写入任务记录的合并参数
+// 片段完成时不立即保存任务记录，而是累计到 MaxPending 个片段或距首个未保存的片段超过 Interval 时保存一次
+type ProgressFlushConfig struct {
+	Interval   time.Duration // 未保存的进度最长等待时间
+	MaxPending int           // 累计多少个未保存的片段时立即保存
+}
+
+// DefaultProgressFlushConfig 返回推荐的进度合并参数
+// 返回值：
+//   - *ProgressFlushConfig: 默认的进度合并参数
+func DefaultProgressFlushConfig() *ProgressFlushConfig {
+	return &ProgressFlushConfig{
+		Interval:   500 * time.Millisecond,
+		MaxPending: 32,
+	}
+}
+
+// GetProgressFlushConfig 获取传输进度写入任务记录的合并参数
+func (opt *Options) GetProgressFlushConfig() *ProgressFlushConfig {
+	return opt.progressFlush
+}
+
+// BuildProgressFlushConfig 设置传输进度写入任务记录的合并参数
+// 参数：
+//   - config: *ProgressFlushConfig 进度合并参数
+//
+// 返回值：
+//   - error: 参数无效时返回错误信息
+func (opt *Options) BuildProgressFlushConfig(config *ProgressFlushConfig) error {
+	if config == nil || config.Interval <= 0 || config.MaxPending <= 0 {
+		return fmt.Errorf("进度合并的等待时间与片段数量必须大于 0")
+	}
+	opt.progressFlush = config
+	return nil
+}
@@ -0,0 +1,47 @@
+package opts
+
+import (
+	"fmt"
+
+	"github.com/bpfs/defs/errs"
+)
+
+// GetReadOnly 获取节点是否处于只读模式
+// 只读模式下节点不创建上传与下载任务，不写入本地数据库，也不接受其他节点存储的文件片段，
+// 已存储的数据仍可被读取和下载
+func (opt *Options) GetReadOnly() bool {
+	return opt.readOnly.Load()
+}
+
+// BuildReadOnly 设置节点是否处于只读模式
+// 参数：
+//   - readOnly: bool 是否只读
+func (opt *Options) BuildReadOnly(readOnly bool) {
+	opt.readOnly.Store(readOnly)
+}
+
+// CheckWritable 检查节点是否允许写入
+// 参数：
+//   - op: string 将要执行的操作，用于错误信息
+//
+// 返回值：
+//   - error: 只读模式下返回包装了 errs.ErrReadOnly 的错误
+func (opt *Options) CheckWritable(op string) error {
+	if opt.readOnly.Load() {
+		return fmt.Errorf("%w: %s", errs.ErrReadOnly, op)
+	}
+	return nil
+}
+
+// GetDryRun 获取破坏性操作是否仅演练
+// 演练模式下删除、清理等破坏性操作只报告将要执行的变更，不修改任何数据
+func (opt *Options) GetDryRun() bool {
+	return opt.dryRun.Load()
+}
+
+// BuildDryRun 设置破坏性操作是否仅演练
+// 参数：
+//   - dryRun: bool 是否仅演练
+func (opt *Options) BuildDryRun(dryRun bool) {
+	opt.dryRun.Store(dryRun)
+}
@@ -0,0 +1,46 @@
+package opts
+
+import (
+	"fmt"
+	"time"
+)
+
+// ScrubConfig 描述存储节点后台校验文件片段的参数
+type ScrubConfig struct {
+	Interval       time.Duration // 两轮校验之间的间隔，每轮依次校验所有已存储的文件片段
+	BytesPerSecond int64         // 校验时每秒读取的字节数上限，为 0 时不限制
+}
+
+// DefaultScrubConfig 返回推荐的后台校验参数
+// 返回值：
+//   - *ScrubConfig: 默认的后台校验参数
+func DefaultScrubConfig() *ScrubConfig {
+	return &ScrubConfig{
+		Interval:       24 * time.Hour,
+		BytesPerSecond: 4 << 20, // 4MB/s
+	}
+}
+
+// GetScrubConfig 获取后台校验参数，为 nil 时不进行后台校验
+func (opt *Options) GetScrubConfig() *ScrubConfig {
+	return opt.scrubConfig
+}
+
+// BuildScrubConfig 设置后台校验参数
+// 参数：
+//   - config: *ScrubConfig 后台校验参数，为 nil 时关闭后台校验
+//
+// 返回值：
+//   - error: 参数无效时返回错误信息
+func (opt *Options) BuildScrubConfig(config *ScrubConfig) error {
+	if config != nil {
+		if config.Interval <= 0 {
+			return fmt.Errorf("后台校验的间隔必须大于0")
+		}
+		if config.BytesPerSecond < 0 {
+			return fmt.Errorf("后台校验的读取速度不能为负数")
+		}
+	}
+	opt.scrubConfig = config
+	return nil
+}
@@ -0,0 +1,55 @@
+package opts
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// StandbyPolicy 描述元数据的热备复制
+// 主节点持续把任务与文件的元数据变更推送到备用节点；主节点的磁盘损坏时，
+// 备用节点提升后即可带着接近最新的元数据接管
+type StandbyPolicy struct {
+	Standby  peer.ID       // 作为主节点时推送变更的备用节点，为空时不推送
+	Primary  peer.ID       // 作为备用节点时接受变更的主节点，为空时不接受
+	Interval time.Duration // 主节点检查并推送变更的间隔
+	MaxBatch int           // 单次推送的最大字节数，超出的变更在后续批次中推送
+}
+
+// DefaultStandbyPolicy 返回推荐的热备复制参数，使用时需设置 Standby 或 Primary
+// 返回值：
+//   - *StandbyPolicy: 默认的热备复制策略
+func DefaultStandbyPolicy() *StandbyPolicy {
+	return &StandbyPolicy{
+		Interval: 5 * time.Second,
+		MaxBatch: 8 << 20, // 8MB
+	}
+}
+
+// GetStandbyPolicy 获取元数据的热备复制策略，为 nil 时不复制
+func (opt *Options) GetStandbyPolicy() *StandbyPolicy {
+	return opt.standby
+}
+
+// BuildStandbyPolicy 设置元数据的热备复制策略
+// 参数：
+//   - policy: *StandbyPolicy 热备复制策略，为 nil 时关闭热备复制
+//
+// 返回值：
+//   - error: 参数无效时返回错误信息
+func (opt *Options) BuildStandbyPolicy(policy *StandbyPolicy) error {
+	if policy != nil {
+		if policy.Standby == "" && policy.Primary == "" {
+			return fmt.Errorf("热备复制需要指定备用节点或主节点")
+		}
+		if policy.Standby != "" && policy.Standby == policy.Primary {
+			return fmt.Errorf("备用节点与主节点不能相同")
+		}
+		if policy.Interval <= 0 || policy.MaxBatch <= 0 {
+			return fmt.Errorf("热备复制的推送间隔与单次推送的最大字节数必须大于0")
+		}
+	}
+	opt.standby = policy
+	return nil
+}
@@ -0,0 +1,129 @@
+package opts
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StreamLimit 描述单个流协议的超时与消息大小限制
+type StreamLimit struct {
+	Timeout        time.Duration // 单次请求的最长时间(包括读取请求、处理与写回响应)
+	MaxMessageSize int           // 单条消息的最大字节数
+}
+
+// StreamConfig 描述所有流协议的超时与消息大小限制
+type StreamConfig struct {
+	Default   StreamLimit            // 未单独配置的协议使用的默认限制
+	Protocols map[string]StreamLimit // 按协议前缀配置的限制，最长前缀优先
+}
+
+// DefaultStreamConfig 返回推荐的流协议限制
+// 返回值：
+//   - *StreamConfig: 默认的流协议限制
+func DefaultStreamConfig() *StreamConfig {
+	return &StreamConfig{
+		Default: StreamLimit{Timeout: 30 * time.Second, MaxMessageSize: 1 << 20}, // 30秒，1MB
+		Protocols: map[string]StreamLimit{
+			"defs@stream/sending/network/":    {Timeout: 2 * time.Minute, MaxMessageSize: 1 << 25},   // 片段上传：2分钟，32MB
+			"defs@stream/download/local/":     {Timeout: 2 * time.Minute, MaxMessageSize: 1 << 25},   // 片段下载：2分钟，32MB
+			"defs@stream/async/download/":     {Timeout: 2 * time.Minute, MaxMessageSize: 1 << 25},   // 异步下载：2分钟，32MB
+			"defs@stream/download/checklist/": {Timeout: 30 * time.Second, MaxMessageSize: 4 << 20},  // 下载清单：30秒，4MB
+			"defs@stream/index/":              {Timeout: 15 * time.Second, MaxMessageSize: 4 << 20},  // 元数据索引：15秒，4MB
+			"defs@stream/peer/distance/":      {Timeout: 10 * time.Second, MaxMessageSize: 64 << 10}, // 对等距离：10秒，64KB
+			"defs@stream/cluster/":            {Timeout: 2 * time.Minute, MaxMessageSize: 1 << 25},   // 集群成员间转发：2分钟，32MB
+			"defs@stream/edgecache/":          {Timeout: 2 * time.Minute, MaxMessageSize: 1 << 25},   // 热门片段复制：2分钟，32MB
+			"defs@stream/standby/":            {Timeout: 2 * time.Minute, MaxMessageSize: 1 << 25},   // 元数据热备复制：2分钟，32MB
+		},
+	}
+}
+
+// Limit 获取指定协议的限制
+// 参数：
+//   - protocol: string 协议ID
+//
+// 返回值：
+//   - StreamLimit: 与协议ID匹配的最长前缀的限制，没有匹配时返回默认限制
+func (c *StreamConfig) Limit(protocol string) StreamLimit {
+	limit := c.Default
+	matched := -1
+	for prefix, l := range c.Protocols {
+		if strings.HasPrefix(protocol, prefix) && len(prefix) > matched {
+			limit, matched = l, len(prefix)
+		}
+	}
+	return limit
+}
+
+// GetStreamConfig 获取流协议的超时与消息大小限制
+func (opt *Options) GetStreamConfig() *StreamConfig {
+	return opt.streamConfig
+}
+
+// BuildStreamLimit 设置指定协议前缀的超时与消息大小限制
+// 参数：
+//   - prefix: string 协议前缀，为空时设置默认限制
+//   - limit: StreamLimit 限制
+//
+// 返回值：
+//   - error: 限制无效时返回错误信息
+func (opt *Options) BuildStreamLimit(prefix string, limit StreamLimit) error {
+	if limit.Timeout <= 0 {
+		return fmt.Errorf("流协议超时时间必须大于0")
+	}
+	if limit.MaxMessageSize <= 0 {
+		return fmt.Errorf("流协议消息大小限制必须大于0")
+	}
+
+	if prefix == "" {
+		opt.streamConfig.Default = limit
+		return nil
+	}
+	opt.streamConfig.Protocols[prefix] = limit
+	return nil
+}
+
+// StreamPoolConfig 描述可复用流连接池的参数
+type StreamPoolConfig struct {
+	MaxPerPeer     int           // 每个节点每个协议同时使用的流上限
+	MaxIdlePerPeer int           // 每个节点每个协议保留的空闲流上限
+	IdleTimeout    time.Duration // 空闲流的最长保留时间，对方在其两倍时间后关闭空闲流
+}
+
+// DefaultStreamPoolConfig 返回推荐的流连接池参数
+// 返回值：
+//   - *StreamPoolConfig: 默认的流连接池参数
+func DefaultStreamPoolConfig() *StreamPoolConfig {
+	return &StreamPoolConfig{
+		MaxPerPeer:     8,
+		MaxIdlePerPeer: 4,
+		IdleTimeout:    30 * time.Second,
+	}
+}
+
+// GetStreamPool 获取流连接池参数，为 nil 时表示每次请求都打开新的流
+func (opt *Options) GetStreamPool() *StreamPoolConfig {
+	return opt.streamPool
+}
+
+// BuildStreamPool 设置流连接池参数
+// 参数：
+//   - config: *StreamPoolConfig 流连接池参数，为 nil 时关闭连接池
+//
+// 返回值：
+//   - error: 参数无效时返回错误信息
+func (opt *Options) BuildStreamPool(config *StreamPoolConfig) error {
+	if config != nil {
+		if config.MaxPerPeer <= 0 {
+			return fmt.Errorf("每个节点的流上限必须大于0")
+		}
+		if config.MaxIdlePerPeer < 0 || config.MaxIdlePerPeer > config.MaxPerPeer {
+			return fmt.Errorf("空闲流上限必须在0到每个节点的流上限之间")
+		}
+		if config.IdleTimeout <= 0 {
+			return fmt.Errorf("空闲流的保留时间必须大于0")
+		}
+	}
+	opt.streamPool = config
+	return nil
+}
@@ -0,0 +1,105 @@
+package opts
+
+import (
+	"fmt"
+	"time"
+)
+
+// RestartMode 后台任务崩溃后的处理方式
+type RestartMode string
+
+const (
+	RestartNever   RestartMode = "never"    // 记录崩溃后不再运行
+	RestartOnPanic RestartMode = "on_panic" // 记录崩溃后按退避间隔重新运行
+)
+
+// RestartPolicy 后台任务崩溃后的重启策略
+type RestartPolicy struct {
+	Mode        RestartMode   // 崩溃后的处理方式
+	MaxRestarts int           // 统计窗口内的最多重启次数，超过后放弃重启；为 0 时不限制
+	Window      time.Duration // 统计重启次数的时间窗口
+	Backoff     time.Duration // 首次重启前的等待时间，之后每次加倍
+	MaxBackoff  time.Duration // 重启前等待时间的上限
+}
+
+// SupervisionConfig 各子系统后台任务的崩溃恢复参数
+type SupervisionConfig struct {
+	Default    RestartPolicy            // 默认的重启策略
+	Subsystems map[string]RestartPolicy // 按子系统名称覆盖的重启策略
+}
+
+// DefaultSupervisionConfig 返回推荐的崩溃恢复参数
+// 返回值：
+//   - *SupervisionConfig: 默认的崩溃恢复参数
+func DefaultSupervisionConfig() *SupervisionConfig {
+	return &SupervisionConfig{
+		Default: RestartPolicy{
+			Mode:        RestartOnPanic,   // 崩溃后重启
+			MaxRestarts: 5,                // 10分钟内最多重启5次
+			Window:      10 * time.Minute, // 10分钟
+			Backoff:     time.Second,      // 1秒
+			MaxBackoff:  time.Minute,      // 1分钟
+		},
+	}
+}
+
+// Policy 获取子系统的重启策略
+// 参数：
+//   - subsystem: string 子系统名称
+//
+// 返回值：
+//   - RestartPolicy: 子系统的重启策略，未单独设置时返回默认策略
+func (c *SupervisionConfig) Policy(subsystem string) RestartPolicy {
+	if policy, ok := c.Subsystems[subsystem]; ok {
+		return policy
+	}
+	return c.Default
+}
+
+// validate 检查重启策略
+func (p RestartPolicy) validate() error {
+	if p.Mode != RestartNever && p.Mode != RestartOnPanic {
+		return fmt.Errorf("无效的重启方式: %s", p.Mode)
+	}
+	if p.MaxRestarts < 0 || p.Window < 0 || p.Backoff < 0 || p.MaxBackoff < 0 {
+		return fmt.Errorf("重启次数与时间参数不能为负数")
+	}
+	if p.MaxRestarts > 0 && p.Window == 0 {
+		return fmt.Errorf("限制重启次数时需设置统计窗口")
+	}
+	return nil
+}
+
+// validate 检查全部重启策略
+func (c *SupervisionConfig) validate() error {
+	if err := c.Default.validate(); err != nil {
+		return fmt.Errorf("默认策略: %w", err)
+	}
+	for name, policy := range c.Subsystems {
+		if err := policy.validate(); err != nil {
+			return fmt.Errorf("子系统 %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// GetSupervisionConfig 获取各子系统后台任务的崩溃恢复参数，为 nil 时崩溃后不重启
+func (opt *Options) GetSupervisionConfig() *SupervisionConfig {
+	return opt.supervision
+}
+
+// BuildSupervisionConfig 设置各子系统后台任务的崩溃恢复参数
+// 参数：
+//   - config: *SupervisionConfig 崩溃恢复参数，为 nil 时崩溃后只记录而不重启
+//
+// 返回值：
+//   - error: 参数无效时返回错误信息
+func (opt *Options) BuildSupervisionConfig(config *SupervisionConfig) error {
+	if config != nil {
+		if err := config.validate(); err != nil {
+			return err
+		}
+	}
+	opt.supervision = config
+	return nil
+}
@@ -0,0 +1,256 @@
+package opts
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/qos"
+)
+
+const (
+	// maxTotalShards 纠删码编码器支持的最大片段总数
+	maxTotalShards = 65536
+	// maxGF8Shards 片段总数超过该值时编码器改用 GF(2^16)，要求片段大小为 64 的倍数
+	maxGF8Shards = 256
+	// transfersPerProc 每个逻辑处理器可承载的并发传输数，超过时调度开销明显增加
+	transfersPerProc = 64
+)
+
+// ConfigIssue 一项配置问题
+type ConfigIssue struct {
+	Setting string // 涉及的选项
+	Problem string // 问题描述
+	Hint    string // 修改建议
+	Warning bool   // 仅为警告，不阻止初始化
+}
+
+// String 返回问题的描述
+func (i ConfigIssue) String() string {
+	level := "错误"
+	if i.Warning {
+		level = "警告"
+	}
+	if i.Hint == "" {
+		return fmt.Sprintf("[%s] %s: %s", level, i.Setting, i.Problem)
+	}
+	return fmt.Sprintf("[%s] %s: %s；%s", level, i.Setting, i.Problem, i.Hint)
+}
+
+// ConfigError 汇总的配置错误，包装了 errs.ErrInvalidArgument
+type ConfigError struct {
+	Issues []ConfigIssue // 阻止初始化的配置问题
+}
+
+// Error 逐行列出所有配置问题
+func (e *ConfigError) Error() string {
+	lines := make([]string, 0, len(e.Issues)+1)
+	lines = append(lines, fmt.Sprintf("配置存在 %d 个问题:", len(e.Issues)))
+	for _, issue := range e.Issues {
+		lines = append(lines, "  "+issue.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Unwrap 返回 errs.ErrInvalidArgument
+func (e *ConfigError) Unwrap() error {
+	return errs.ErrInvalidArgument
+}
+
+// NewConfigError 由配置问题生成错误，只有警告时返回 nil
+// 参数：
+//   - issues: []ConfigIssue 配置问题
+//
+// 返回值：
+//   - error: 存在非警告的问题时返回 *ConfigError
+func NewConfigError(issues []ConfigIssue) error {
+	var blocking []ConfigIssue
+	for _, issue := range issues {
+		if !issue.Warning {
+			blocking = append(blocking, issue)
+		}
+	}
+	if len(blocking) == 0 {
+		return nil
+	}
+	return &ConfigError{Issues: blocking}
+}
+
+// Validate 交叉检查相互关联的选项，一次返回所有问题，而不是在运行时由各子系统分别报错
+// 返回值：
+//   - []ConfigIssue: 发现的配置问题，可通过 NewConfigError 生成错误
+func (opt *Options) Validate() []ConfigIssue {
+	var issues []ConfigIssue
+	fail := func(setting, hint, format string, args ...interface{}) {
+		issues = append(issues, ConfigIssue{Setting: setting, Problem: fmt.Sprintf(format, args...), Hint: hint})
+	}
+	warn := func(setting, hint, format string, args ...interface{}) {
+		issues = append(issues, ConfigIssue{Setting: setting, Problem: fmt.Sprintf(format, args...), Hint: hint, Warning: true})
+	}
+
+	// 片段大小
+	if opt.minSliceSize > opt.maxSliceSize {
+		fail("minSliceSize", "调小最小片段或调大最大片段", "最小片段的大小 %d 大于最大片段的大小 %d", opt.minSliceSize, opt.maxSliceSize)
+	}
+	if opt.storageMode != RS_Size && (opt.shardSize < opt.minSliceSize || opt.shardSize > opt.maxSliceSize) {
+		fail("shardSize", fmt.Sprintf("通过 BuildSizeAndRatioOptions 设置 [%d, %d] 之间的值", opt.minSliceSize, opt.maxSliceSize),
+			"文件片段的大小 %d 超出片段大小的范围", opt.shardSize)
+	}
+	if opt.minUploadSize > opt.maxUploadSize {
+		fail("minUploadSize", "调小最小上传大小或调大最大上传大小", "最小上传大小 %d 大于最大上传大小 %d", opt.minUploadSize, opt.maxUploadSize)
+	}
+
+	// 纠删码片段数量
+	switch opt.storageMode {
+	case RS_Size:
+		switch {
+		case opt.dataShards <= 0 || opt.parityShards <= 0:
+			fail("dataShards/parityShards", "通过 BuildShardsOptions 设置正数", "纠删码(大小)模式的片段数量 %d/%d 无效", opt.dataShards, opt.parityShards)
+		case opt.parityShards > opt.dataShards/2:
+			fail("parityShards", "校验片段不超过数据片段的一半", "校验片段的数量 %d 过大", opt.parityShards)
+		case opt.dataShards+opt.parityShards > maxTotalShards:
+			fail("dataShards/parityShards", fmt.Sprintf("片段总数不超过 %d", maxTotalShards), "片段总数 %d 超出纠删码编码器的上限", opt.dataShards+opt.parityShards)
+		}
+	case RS_Proportion:
+		if opt.parityRatio <= 0 || opt.parityRatio > 0.5 {
+			fail("parityRatio", "设置 (0, 0.5] 之间的值", "校验片段占比 %v 无效", opt.parityRatio)
+		}
+		if opt.shardSize > 0 {
+			total := ceilDiv(opt.maxUploadSize, opt.shardSize)
+			if total > maxTotalShards {
+				fail("shardSize", fmt.Sprintf("将文件片段调大到至少 %d 字节，或调小最大上传大小", ceilDiv(opt.maxUploadSize, maxTotalShards)),
+					"最大上传大小 %d 的文件将被切分为 %d 个片段，超出纠删码编码器的上限 %d", opt.maxUploadSize, total, maxTotalShards)
+			} else if total > maxGF8Shards && opt.shardSize%64 != 0 {
+				fail("shardSize", "将文件片段的大小设置为 64 的倍数",
+					"超过 %d 个片段的文件要求片段大小为 64 的倍数，当前为 %d", maxGF8Shards, opt.shardSize)
+			}
+		}
+	}
+
+	// 单个片段需要能在一条消息内传输，片段大小取决于文件大小时只给出警告
+	segment, exact := opt.maxSegmentSize()
+	report := fail
+	if !exact {
+		report = warn
+	}
+	if opt.downloadMaximumSize > 0 && opt.downloadMaximumSize < segment {
+		report("downloadMaximumSize", fmt.Sprintf("调大到至少 %d 字节，或调小文件片段", segment),
+			"下载最大回复大小 %d 小于单个片段可能的大小 %d，这样的片段无法被下载", opt.downloadMaximumSize, segment)
+	}
+	if opt.streamConfig != nil {
+		protocols := []string{"defs@stream/sending/network/", "defs@stream/download/local/"}
+		if opt.edgeCache != nil {
+			protocols = append(protocols, "defs@stream/edgecache/")
+		}
+		for _, protocol := range protocols {
+			if limit := opt.streamConfig.Limit(protocol); limit.MaxMessageSize > 0 && int64(limit.MaxMessageSize) < segment {
+				report("streamConfig", fmt.Sprintf("将协议 %s 的消息大小上限调大到至少 %d 字节", protocol, segment),
+					"消息大小上限 %d 小于单个片段可能的大小 %d", limit.MaxMessageSize, segment)
+			}
+		}
+	}
+
+	// 并发传输数与逻辑处理器数量
+	if opt.scheduler != nil {
+		total, procs := 0, runtime.GOMAXPROCS(0)
+		for _, class := range []qos.Class{qos.ClassInteractive, qos.ClassNormal, qos.ClassBackground} {
+			n := opt.scheduler.MaxConcurrency(class)
+			if n == 0 {
+				warn("scheduler", "为该等级设置最大并发传输数", "服务等级 %s 不限制并发传输数", class)
+			}
+			total += n
+		}
+		if total > transfersPerProc*procs {
+			warn("scheduler", fmt.Sprintf("将各等级的并发传输数之和调小到 %d 以内，或调大 GOMAXPROCS", transfersPerProc*procs),
+				"各服务等级的并发传输数之和 %d 远超逻辑处理器数量 %d", total, procs)
+		}
+	}
+
+	// 其他选项
+	if opt.diskIO != nil {
+		if err := opt.diskIO.Validate(); err != nil {
+			fail("diskIO", "", "%v", err)
+		}
+	}
+	if _, err := ParseVerifyLevel(string(opt.verifyLevel)); err != nil {
+		fail("verifyLevel", "使用 none、fast 或 full", "%v", err)
+	}
+	if p := opt.placementPolicy; p != nil && p.Zone == nil && (p.SeparateZones || p.MaxSegmentsPerZone > 0) {
+		warn("placementPolicy", "设置 Zone 以返回节点所在的区域", "未设置区域划分，按区域的分布约束不会生效")
+	}
+	if opt.commitmentDuration > 0 && opt.maxCommitment > 0 && opt.commitmentDuration > opt.maxCommitment {
+		warn("commitmentDuration", "使用相同配置的存储节点会拒绝该承诺", "要求的承诺时长 %v 超过本节点愿意承诺的最长时长 %v", opt.commitmentDuration, opt.maxCommitment)
+	}
+	if p := opt.edgeCache; p != nil && p.Serve && opt.GetReadOnly() {
+		warn("edgeCache", "关闭只读模式或不充当缓存节点", "只读节点不接收其他节点复制的热门片段")
+	}
+	if p := opt.standby; p != nil {
+		if p.Primary != "" && opt.GetReadOnly() {
+			warn("standby", "关闭只读模式或不充当备用节点", "只读节点不接收主节点推送的元数据变更")
+		}
+		// 单次推送需要能在一条消息内传输
+		if opt.streamConfig != nil {
+			if limit := opt.streamConfig.Limit("defs@stream/standby/"); limit.MaxMessageSize > 0 && limit.MaxMessageSize < p.MaxBatch {
+				fail("standby", fmt.Sprintf("将单次推送的最大字节数调小到 %d 以内，或调大协议的消息大小上限", limit.MaxMessageSize),
+					"单次推送的最大字节数 %d 超过消息大小上限 %d", p.MaxBatch, limit.MaxMessageSize)
+			}
+		}
+	}
+	if p := opt.versionPolicy; p != nil {
+		if p.MinVersion != "" && CompareVersions(Version, p.MinVersion) < 0 {
+			fail("versionPolicy", "升级本节点或调低兼容的最低版本", "本节点的版本 %s 低于兼容的最低版本 %s", Version, p.MinVersion)
+		} else if p.DeprecateBelow != "" && CompareVersions(Version, p.DeprecateBelow) < 0 {
+			warn("versionPolicy", "升级本节点", "本节点的版本 %s 即将停止支持", Version)
+		}
+	}
+	if p := opt.power; p != nil && p.MinBattery == 0 && !p.PauseOnMetered {
+		warn("power", "设置最低电量或开启按流量计费时暂停", "电源感知策略不会暂停任何后台上传任务")
+	}
+	if a := opt.downloadAdmission; a != nil {
+		if a.MaxConcurrent < 0 {
+			fail("downloadAdmission", "设置非负数，为 0 时不限制", "同时进行的下载任务数量上限 %d 为负数", a.MaxConcurrent)
+		}
+		if a.Order != QueueFIFO && a.Order != QueuePriority {
+			fail("downloadAdmission", "使用 fifo 或 priority", "无效的等待队列顺序 %q", a.Order)
+		}
+	}
+	if c := opt.supervision; c != nil {
+		if err := c.validate(); err != nil {
+			fail("supervision", "修正重启策略", "崩溃恢复参数无效: %v", err)
+		}
+	}
+	if opt.retryInterval < 0 || opt.maxRetries < 0 {
+		fail("maxRetries/retryInterval", "设置非负数", "重试次数 %d 或重试间隔 %v 为负数", opt.maxRetries, opt.retryInterval)
+	}
+
+	return issues
+}
+
+// maxSegmentSize 估计单个文件片段可能的最大大小
+// 返回值：
+//   - int64: 片段的最大大小
+//   - bool: 是否与文件大小无关，文件模式与纠删码(大小)模式下片段大小随文件变化
+func (opt *Options) maxSegmentSize() (int64, bool) {
+	switch opt.storageMode {
+	case FileMode:
+		// 不大于最大片段的文件作为一个片段
+		return max(opt.maxSliceSize, opt.shardSize), false
+	case SliceMode:
+		// 小于最小片段的文件作为一个片段
+		return max(opt.shardSize, opt.minSliceSize), true
+	case RS_Size:
+		if opt.dataShards > 0 {
+			return ceilDiv(opt.maxUploadSize, opt.dataShards), false
+		}
+	}
+	return opt.shardSize, true
+}
+
+// ceilDiv 向上取整的除法
+func ceilDiv(a, b int64) int64 {
+	if b <= 0 {
+		return 0
+	}
+	return (a + b - 1) / b
+}
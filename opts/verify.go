@@ -0,0 +1,52 @@
+package opts
+
+import (
+	"fmt"
+)
+
+// VerifyLevel 下载完成前校验文件内容的强度
+type VerifyLevel string
+
+const (
+	VerifyNone VerifyLevel = "none" // 信任传输层，不校验片段与文件的哈希
+	VerifyFast VerifyLevel = "fast" // 只校验每个片段的哈希
+	VerifyFull VerifyLevel = "full" // 校验每个片段的哈希、纠删码校验片段的一致性，以及还原后整个文件的哈希
+)
+
+// ParseVerifyLevel 解析校验级别
+// 参数：
+//   - s: string 校验级别的名称，为空时返回 VerifyFull
+//
+// 返回值：
+//   - VerifyLevel: 校验级别
+//   - error: 名称无效时返回错误信息
+func ParseVerifyLevel(s string) (VerifyLevel, error) {
+	switch level := VerifyLevel(s); level {
+	case "":
+		return VerifyFull, nil
+	case VerifyNone, VerifyFast, VerifyFull:
+		return level, nil
+	default:
+		return "", fmt.Errorf("无效的校验级别: %s", s)
+	}
+}
+
+// GetVerifyLevel 获取下载任务的默认校验级别
+func (opt *Options) GetVerifyLevel() VerifyLevel {
+	return opt.verifyLevel
+}
+
+// BuildVerifyLevel 设置下载任务的默认校验级别，单个任务可通过下载管理器单独设置
+// 参数：
+//   - level: VerifyLevel 校验级别
+//
+// 返回值：
+//   - error: 校验级别无效时返回错误信息
+func (opt *Options) BuildVerifyLevel(level VerifyLevel) error {
+	level, err := ParseVerifyLevel(string(level))
+	if err != nil {
+		return err
+	}
+	opt.verifyLevel = level
+	return nil
+}
@@ -0,0 +1,128 @@
+package opts
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VersionPolicy 描述网络中节点软件版本的兼容范围与弃用提醒
+// 低于 MinVersion 的节点视为不兼容；不低于 MinVersion 但低于 DeprecateBelow 的节点运行即将停止支持的版本，
+// 这类节点占已知版本节点的比例达到 WarnFraction 时发出警告，便于协调全网升级
+type VersionPolicy struct {
+	MinVersion     string        // 兼容的最低版本，为空时不限制
+	DeprecateBelow string        // 低于此版本即将停止支持，为空时不提醒
+	WarnFraction   float64       // 运行即将停止支持版本的节点比例达到此值时发出警告，取值 (0, 1]
+	Window         time.Duration // 统计最近此时间内见过的节点
+	Interval       time.Duration // 检查节点版本分布的间隔
+}
+
+// DefaultVersionPolicy 返回推荐的版本检查参数，使用时按需设置 MinVersion 与 DeprecateBelow
+// 返回值：
+//   - *VersionPolicy: 默认的版本检查策略
+func DefaultVersionPolicy() *VersionPolicy {
+	return &VersionPolicy{
+		WarnFraction: 0.1,              // 10%的节点
+		Window:       24 * time.Hour,   // 最近一天
+		Interval:     10 * time.Minute, // 10分钟
+	}
+}
+
+// GetVersionPolicy 获取节点软件版本的检查策略，为 nil 时只记录版本而不检查
+func (opt *Options) GetVersionPolicy() *VersionPolicy {
+	return opt.versionPolicy
+}
+
+// BuildVersionPolicy 设置节点软件版本的检查策略
+// 参数：
+//   - policy: *VersionPolicy 版本检查策略，为 nil 时只记录版本而不检查
+//
+// 返回值：
+//   - error: 参数无效时返回错误信息
+func (opt *Options) BuildVersionPolicy(policy *VersionPolicy) error {
+	if policy != nil {
+		for _, v := range []string{policy.MinVersion, policy.DeprecateBelow} {
+			if v != "" && !ValidVersion(v) {
+				return fmt.Errorf("无效的版本号: %s", v)
+			}
+		}
+		if policy.MinVersion != "" && policy.DeprecateBelow != "" && CompareVersions(policy.DeprecateBelow, policy.MinVersion) < 0 {
+			return fmt.Errorf("弃用版本 %s 不能低于兼容的最低版本 %s", policy.DeprecateBelow, policy.MinVersion)
+		}
+		if policy.WarnFraction <= 0 || policy.WarnFraction > 1 {
+			return fmt.Errorf("发出警告的节点比例必须在 (0, 1] 之间")
+		}
+		if policy.Window <= 0 || policy.Interval <= 0 {
+			return fmt.Errorf("统计时间范围与检查间隔必须大于0")
+		}
+	}
+	opt.versionPolicy = policy
+	return nil
+}
+
+// parseVersion 解析 "主版本.次版本.修订号" 形式的版本号
+// 允许 v 前缀，省略的部分视为0，"-" 之后为预发布标识
+// 返回值：
+//   - [3]int: 主版本、次版本与修订号
+//   - bool: 是否为预发布版本
+//   - bool: 版本号是否有效
+func parseVersion(v string) ([3]int, bool, bool) {
+	var parts [3]int
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	core, pre, hasPre := strings.Cut(v, "-")
+	fields := strings.Split(core, ".")
+	if core == "" || len(fields) > 3 || (hasPre && pre == "") {
+		return parts, false, false
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return parts, false, false
+		}
+		parts[i] = n
+	}
+	return parts, hasPre, true
+}
+
+// ValidVersion 检查版本号是否有效
+func ValidVersion(v string) bool {
+	_, _, ok := parseVersion(v)
+	return ok
+}
+
+// CompareVersions 比较两个版本号，预发布版本低于同号的正式版本，无效的版本号低于任何有效的版本号
+// 参数：
+//   - a: string 版本号
+//   - b: string 版本号
+//
+// 返回值：
+//   - int: a 低于 b 时返回 -1，相同时返回 0，高于时返回 1
+func CompareVersions(a, b string) int {
+	pa, preA, okA := parseVersion(a)
+	pb, preB, okB := parseVersion(b)
+	if !okA || !okB {
+		return compareBool(okA, okB)
+	}
+	for i := range pa {
+		if pa[i] != pb[i] {
+			if pa[i] < pb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return compareBool(!preA, !preB)
+}
+
+// compareBool 比较两个布尔值，false 低于 true
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case b:
+		return -1
+	default:
+		return 1
+	}
+}
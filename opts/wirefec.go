@@ -0,0 +1,53 @@
+package opts
+
+import (
+	"fmt"
+
+	"github.com/bpfs/defs/stats"
+)
+
+// WireFECConfig 描述数据报传输的前向纠错参数
+// 与存储使用的纠删码无关：仅在传输时为高丢包链路的数据包附加校验包，以额外带宽换取更少的重传往返
+type WireFECConfig struct {
+	Enabled       bool    // 是否对高丢包的链路启用前向纠错
+	LossThreshold float64 // 链路估计的丢包率达到该值时启用，取值 (0, 1]
+	GroupSize     int     // 每组数据包附加一个校验包，越小冗余越高
+}
+
+// DefaultWireFECConfig 返回推荐的前向纠错参数，默认不启用
+// 返回值：
+//   - *WireFECConfig: 默认的前向纠错参数
+func DefaultWireFECConfig() *WireFECConfig {
+	return &WireFECConfig{
+		Enabled:       false,
+		LossThreshold: 0.05,
+		GroupSize:     8,
+	}
+}
+
+// GetWireFECConfig 获取数据报传输的前向纠错参数
+func (opt *Options) GetWireFECConfig() *WireFECConfig {
+	return opt.wireFEC
+}
+
+// BuildWireFECConfig 设置数据报传输的前向纠错参数，仅在启用数据报传输时生效
+// 参数：
+//   - config: *WireFECConfig 前向纠错参数
+//
+// 返回值：
+//   - error: 参数无效时返回错误信息
+func (opt *Options) BuildWireFECConfig(config *WireFECConfig) error {
+	if config == nil || config.LossThreshold <= 0 || config.LossThreshold > 1 {
+		return fmt.Errorf("启用前向纠错的丢包率阈值必须在 (0, 1] 之间")
+	}
+	if config.GroupSize < 2 || config.GroupSize > 1<<15 {
+		return fmt.Errorf("前向纠错的组大小必须在 [2, 32768] 之间")
+	}
+	opt.wireFEC = config
+	return nil
+}
+
+// GetLinkLoss 获取各节点链路的丢包率估计
+func (opt *Options) GetLinkLoss() *stats.LinkLoss {
+	return opt.linkLoss
+}
@@ -0,0 +1,80 @@
+package paths
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bpfs/defs/errs"
+)
+
+var (
+	dbDir   string // 数据库目录，为空时位于根路径下
+	logsDir string // 日志目录，为空时位于根路径下
+)
+
+// SetDataDirs 设置位于根路径之外的子系统目录，并确保目录存在
+// 参数：
+//   - db: string 数据库目录，为空时使用根路径下的 db
+//   - logs: string 日志目录，为空时使用根路径下的 logs
+//
+// 返回值：
+//   - error: 创建目录失败时返回错误
+func SetDataDirs(db, logs string) error {
+	dbDir, logsDir = db, logs
+	for _, dir := range []string{GetDBDir(), GetLogsDir()} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetDBDir 返回数据库目录的绝对路径
+func GetDBDir() string {
+	if dbDir != "" {
+		return dbDir
+	}
+	return filepath.Join(GetRootPath(), GetDBPath())
+}
+
+// GetLogsDir 返回日志目录的绝对路径
+func GetLogsDir() string {
+	if logsDir != "" {
+		return logsDir
+	}
+	return filepath.Join(GetRootPath(), GetLogsPath())
+}
+
+// SafeJoin 拼接路径，保证结果不会越出 base
+// 文件唯一标识、片段唯一标识及文件名可能来自其他节点，拼接前应经过检查，
+// 因此 base 与 elem 中都不允许出现 ".." 路径元素，elem 也不能是绝对路径
+// 参数：
+//   - base: string 基础目录
+//   - elem: ...string 依次拼接的路径元素
+//
+// 返回值：
+//   - string: 拼接后的路径
+//   - error: 路径越界时返回包装了 errs.ErrInvalidArgument 的错误
+func SafeJoin(base string, elem ...string) (string, error) {
+	if hasParentRef(base) {
+		return "", fmt.Errorf("%w: 路径 %q 越出数据目录", errs.ErrInvalidArgument, base)
+	}
+	for _, e := range elem {
+		if filepath.IsAbs(e) || strings.HasPrefix(e, "/") || hasParentRef(e) {
+			return "", fmt.Errorf("%w: 路径 %q 越出数据目录", errs.ErrInvalidArgument, e)
+		}
+	}
+	return filepath.Join(append([]string{base}, elem...)...), nil
+}
+
+// hasParentRef 检查路径中是否含有 ".." 元素
+func hasParentRef(p string) bool {
+	for _, part := range strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if part == ".." {
+			return true
+		}
+	}
+	return false
+}
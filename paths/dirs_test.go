@@ -0,0 +1,27 @@
+package paths
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bpfs/defs/errs"
+)
+
+func TestSafeJoin(t *testing.T) {
+	path, err := SafeJoin("slices/abc", "seg-1")
+	if err != nil || path != "slices/abc/seg-1" {
+		t.Fatalf("拼接结果不符: %q %v", path, err)
+	}
+
+	for _, tc := range []struct{ base, elem string }{
+		{"slices/..", "x"},
+		{"slices", "../x"},
+		{"slices", "a/../../x"},
+		{"slices", "/etc/passwd"},
+		{"slices", `..\x`},
+	} {
+		if _, err := SafeJoin(tc.base, tc.elem); !errors.Is(err, errs.ErrInvalidArgument) {
+			t.Fatalf("%q + %q 应被拒绝, 实际 %v", tc.base, tc.elem, err)
+		}
+	}
+}
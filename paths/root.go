@@ -28,10 +28,12 @@ func InitDirectories(path string) (afero.Afero, error) {
 	directories := []string{
 		GetFilesPath(), // 文件目录
 		// GetDBPath(),       // 数据库目录
-		GetLogsPath(),     // 日志目录
-		GetUploadPath(),   // 上传目录
-		GetSlicePath(),    // 切片目录
-		GetDownloadPath(), // 下载目录
+		GetLogsPath(),       // 日志目录
+		GetUploadPath(),     // 上传目录
+		GetSlicePath(),      // 切片目录
+		GetDownloadPath(),   // 下载目录
+		GetManifestPath(),   // 块清单目录
+		GetQuarantinePath(), // 隔离目录
 	}
 
 	// 遍历每个目录并确保它存在
@@ -81,6 +83,16 @@ func GetDownloadPath() string {
 	return filepath.Join(GetFilesPath(), "downloads")
 }
 
+// GetManifestPath 返回块清单目录路径
+func GetManifestPath() string {
+	return filepath.Join(GetFilesPath(), "manifests")
+}
+
+// GetQuarantinePath 返回隔离目录路径，存放校验失败的文件片段
+func GetQuarantinePath() string {
+	return filepath.Join(GetFilesPath(), "quarantine")
+}
+
 // GetBusinessDbPath 返回业务db目录路径
 func GetBusinessDbPath() string {
 	return filepath.Join(GetDBPath(), "businessdbs")
@@ -0,0 +1,271 @@
+package peermode
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/network"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/defs/space"
+	"github.com/bpfs/defs/supervise"
+	"github.com/bpfs/dep2p"
+	"github.com/bpfs/dep2p/pubsub"
+	"github.com/bpfs/dep2p/streams"
+	"github.com/libp2p/go-libp2p/core/event"
+	libp2pnetwork "github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+)
+
+// Detector 评估节点自身能力并动态切换节点模式
+type Detector struct {
+	ctx    context.Context    // 上下文用于管理协程的生命周期
+	cancel context.CancelFunc // 取消函数
+	mu     sync.RWMutex       // 用于保护状态的读写锁
+
+	opt    *opts.Options       // 文件存储选项配置
+	p2p    *dep2p.DeP2P        // 网络主机
+	pubsub *pubsub.DeP2PPubSub // 网络订阅
+
+	startedAt    time.Time                  // 节点启动时间
+	reachability libp2pnetwork.Reachability // 最近一次报告的网络可达性
+	mode         int                        // 当前声明的节点模式
+	assessment   Assessment                 // 最近一次的评估结果
+}
+
+type NewDetectorInput struct {
+	fx.In
+	LC         fx.Lifecycle
+	Ctx        context.Context       // 全局上下文
+	Opt        *opts.Options         // 文件存储选项配置
+	P2P        *dep2p.DeP2P          // 网络主机
+	PubSub     *pubsub.DeP2PPubSub   // 网络订阅
+	Supervisor *supervise.Supervisor // 后台任务的崩溃恢复
+}
+
+type NewDetectorOutput struct {
+	fx.Out
+	Detector *Detector // 节点模式检测
+}
+
+// NewDetector 创建并初始化一个新的 Detector 实例。
+// 未设置节点模式切换条件时不会启动检测，节点模式保持为客户端模式。
+// 参数：
+//   - input: NewDetectorInput 用于初始化 Detector 的输入结构体。
+//
+// 返回值：
+//   - NewDetectorOutput: 包含 Detector 的输出结构体。
+func NewDetector(input NewDetectorInput) (out NewDetectorOutput) {
+	ctx, cancel := context.WithCancel(input.Ctx)
+	d := &Detector{
+		ctx:          ctx,
+		cancel:       cancel,
+		opt:          input.Opt,
+		p2p:          input.P2P,
+		pubsub:       input.PubSub,
+		startedAt:    time.Now(),
+		reachability: libp2pnetwork.ReachabilityUnknown,
+		mode:         ModeClient,
+	}
+	out.Detector = d
+
+	input.LC.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			if d.opt.GetPeerModePolicy() == nil {
+				return nil
+			}
+
+			// 订阅节点模式声明
+			if err := d.pubsub.SubscribeWithTopic(PubSubPeerModeAnnounceTopic, network.PubSubHandler(PubSubPeerModeAnnounceTopic, d.handleAnnouncePubSub), true); err != nil {
+				logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+				return err
+			}
+
+			// 订阅网络可达性变化
+			sub, err := d.p2p.Host().EventBus().Subscribe(new(event.EvtLocalReachabilityChanged))
+			if err != nil {
+				logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+				return err
+			}
+			input.Supervisor.Go("peermode", "reachability", func() { d.watchReachability(sub) })
+
+			// 定时评估自身能力
+			input.Supervisor.Go("peermode", "assess", d.periodicAssess)
+
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			d.cancel()
+			return nil
+		},
+	})
+
+	return out
+}
+
+// Mode 获取当前声明的节点模式
+func (d *Detector) Mode() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.mode
+}
+
+// Assessment 获取最近一次的评估结果
+func (d *Detector) Assessment() Assessment {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.assessment
+}
+
+// Assess 评估节点的网络可达性、可用磁盘空间与在线时长
+// 返回值：
+//   - Assessment: 评估结果
+func (d *Detector) Assess() Assessment {
+	a := Assessment{
+		Uptime: time.Since(d.startedAt),
+	}
+
+	d.mu.RLock()
+	reachability := d.reachability
+	d.mu.RUnlock()
+
+	switch reachability {
+	case libp2pnetwork.ReachabilityPublic:
+		a.Reachable = true
+	case libp2pnetwork.ReachabilityPrivate:
+		a.Reachable = false
+	default:
+		// 可达性未知时，以是否监听公网地址作为判断依据
+		for _, addr := range d.p2p.Host().Addrs() {
+			if manet.IsPublicAddr(addr) {
+				a.Reachable = true
+				break
+			}
+		}
+	}
+
+	available, err := space.GetAvailableSpace(paths.GetRootPath())
+	if err != nil {
+		logrus.Warnf("[%s]获取可用磁盘空间失败: %v", debug.WhereAmI(), err)
+	}
+	a.AvailableSpace = available
+
+	return a
+}
+
+// Reassess 重新评估自身能力，模式变化时通知邻居节点
+// 返回值：
+//   - int: 评估后的节点模式
+//   - bool: 节点模式是否发生变化
+func (d *Detector) Reassess() (int, bool) {
+	a := d.Assess()
+	mode := Decide(d.opt.GetPeerModePolicy(), a)
+
+	d.mu.Lock()
+	changed := mode != d.mode
+	d.mode = mode
+	d.assessment = a
+	d.mu.Unlock()
+
+	if changed {
+		logrus.Infof("节点模式切换为: %d", mode)
+	}
+
+	// 每次评估后都声明一次，使新加入的邻居节点也能获知当前模式
+	announcement := &Announcement{Mode: mode, Assessment: a}
+	if err := network.SendSignedPubSub(d.p2p, d.pubsub, PubSubPeerModeAnnounceTopic, "announce", "", announcement); err != nil {
+		logrus.Errorf("[%s]发送节点模式声明失败: %v", debug.WhereAmI(), err)
+	}
+
+	return mode, changed
+}
+
+// periodicAssess 定时评估自身能力
+func (d *Detector) periodicAssess() {
+	interval := d.opt.GetPeerModePolicy().Interval
+	if interval <= 0 {
+		interval = opts.DefaultPeerModePolicy().Interval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	d.Reassess()
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+			d.Reassess()
+		}
+	}
+}
+
+// watchReachability 监听网络可达性变化，变化后立即重新评估
+func (d *Detector) watchReachability(sub event.Subscription) {
+	defer sub.Close()
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case e, ok := <-sub.Out():
+			if !ok {
+				return
+			}
+			evt, ok := e.(event.EvtLocalReachabilityChanged)
+			if !ok {
+				continue
+			}
+			d.mu.Lock()
+			d.reachability = evt.Reachability
+			d.mu.Unlock()
+			d.Reassess()
+		}
+	}
+}
+
+// handleAnnouncePubSub 处理邻居节点的模式声明
+// 声明由发送节点签名，只调整签名节点在路由表中的位置，不能替其他节点声明模式
+func (d *Detector) handleAnnouncePubSub(res *streams.RequestMessage) {
+	if res.Message.Sender == d.p2p.Host().ID().String() {
+		return
+	}
+
+	switch res.Message.Type {
+	case "announce":
+		announcement := new(Announcement)
+		peerID, err := network.VerifyPubSub(res, PubSubPeerModeAnnounceTopic, announcement)
+		if err != nil {
+			logrus.Warnf("[%s]拒绝模式声明: %v", debug.WhereAmI(), err)
+			return
+		}
+		if announcement.Mode != ModeClient && announcement.Mode != ModeServer {
+			return
+		}
+
+		applyPeerMode(d.p2p, peerID, announcement.Mode)
+	}
+}
+
+// applyPeerMode 将节点移动到与其声明模式对应的路由表
+// 参数：
+//   - p2p: *dep2p.DeP2P 网络主机
+//   - peerID: peer.ID 声明模式的节点
+//   - mode: int 节点声明的模式
+func applyPeerMode(p2p *dep2p.DeP2P, peerID peer.ID, mode int) {
+	if table := p2p.RoutingTable(otherMode(mode)); table != nil && table.Find(peerID) != "" {
+		table.RemovePeer(peerID)
+	}
+
+	table := p2p.RoutingTable(mode)
+	if table == nil || table.Find(peerID) != "" {
+		return
+	}
+	if _, err := table.TryAddPeer(peerID, mode, true, false); err != nil {
+		logrus.Warnf("[%s]更新路由表失败: %v", debug.WhereAmI(), err)
+	}
+}
@@ -0,0 +1,67 @@
+// Package peermode 实现了节点模式(客户端/服务端)的自动检测与动态切换。
+// 节点定期评估自身的网络可达性、可用磁盘空间与在线时长，据此决定以客户端或服务端模式对外声明，
+// 并在模式变化时通知邻居节点，邻居节点随之在对应模式的路由表之间移动该节点。
+package peermode
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bpfs/defs/opts"
+)
+
+const (
+	version = "1.0.0" // 节点模式协议版本
+
+	ModeClient = 1 // 客户端模式，只发起上传和下载
+	ModeServer = 2 // 服务端模式，存储其他节点上传的文件片段
+)
+
+var (
+	// 节点模式声明
+	PubSubPeerModeAnnounceTopic = fmt.Sprintf("defs@pubsub/peermode/announce/%s", version)
+)
+
+// Assessment 节点对自身能力的评估结果
+type Assessment struct {
+	Reachable      bool          // 是否可以被公网访问
+	AvailableSpace uint64        // 可用磁盘空间，单位为字节
+	Uptime         time.Duration // 在线时长
+}
+
+// Announcement 节点模式声明
+type Announcement struct {
+	Mode       int        // 节点声明的模式
+	Assessment Assessment // 节点对自身能力的评估结果
+}
+
+// Decide 根据切换条件和评估结果决定节点模式
+// 参数：
+//   - policy: *opts.PeerModePolicy 节点模式切换条件
+//   - a: Assessment 节点对自身能力的评估结果
+//
+// 返回值：
+//   - int: 满足所有条件时返回 ModeServer，否则返回 ModeClient
+func Decide(policy *opts.PeerModePolicy, a Assessment) int {
+	if policy == nil {
+		return ModeClient
+	}
+	if policy.RequireReachable && !a.Reachable {
+		return ModeClient
+	}
+	if a.AvailableSpace < policy.MinAvailableSpace {
+		return ModeClient
+	}
+	if a.Uptime < policy.MinUptime {
+		return ModeClient
+	}
+	return ModeServer
+}
+
+// otherMode 获取与指定模式相对的模式
+func otherMode(mode int) int {
+	if mode == ModeServer {
+		return ModeClient
+	}
+	return ModeServer
+}
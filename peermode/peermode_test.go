@@ -0,0 +1,38 @@
+package peermode
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bpfs/defs/opts"
+)
+
+func TestDecide(t *testing.T) {
+	policy := opts.DefaultPeerModePolicy()
+	capable := Assessment{
+		Reachable:      true,
+		AvailableSpace: policy.MinAvailableSpace,
+		Uptime:         policy.MinUptime,
+	}
+
+	tests := []struct {
+		name   string
+		policy *opts.PeerModePolicy
+		modify func(a *Assessment)
+		want   int
+	}{
+		{"满足所有条件", policy, func(a *Assessment) {}, ModeServer},
+		{"未开启自动切换", nil, func(a *Assessment) {}, ModeClient},
+		{"位于NAT之后", policy, func(a *Assessment) { a.Reachable = false }, ModeClient},
+		{"磁盘空间不足", policy, func(a *Assessment) { a.AvailableSpace-- }, ModeClient},
+		{"在线时长不足", policy, func(a *Assessment) { a.Uptime -= time.Second }, ModeClient},
+	}
+
+	for _, tt := range tests {
+		a := capable
+		tt.modify(&a)
+		if got := Decide(tt.policy, a); got != tt.want {
+			t.Errorf("%s: 期望模式 %d，实际 %d", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Package pin 记录存储节点上被固定(法律保留)的文件
+// 被固定文件的片段不会因存储时长、所有者是否在线或损坏隔离等原因被清理
+package pin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/sirupsen/logrus"
+)
+
+// Pin 一个被固定的文件
+type Pin struct {
+	FileID   string // 文件唯一标识
+	Reason   string // 固定原因，如法律保留的案件编号
+	PinnedAt int64  // 固定的时间(Unix 秒)
+}
+
+// Store 存储节点上被固定的文件集合
+// 零值不可用，通过 NewStore 创建；所有方法在 nil 接收者上均为空操作
+type Store struct {
+	mu   sync.RWMutex
+	pins map[string]*Pin // 文件唯一标识到固定记录的映射
+	path string          // 持久化文件路径，为空时不持久化
+}
+
+// NewStore 创建一个空的固定文件集合
+func NewStore() *Store {
+	return &Store{pins: make(map[string]*Pin)}
+}
+
+// Open 设置持久化文件路径并加载已保存的固定记录
+// 参数：
+//   - path: string 持久化文件路径
+//
+// 返回值：
+//   - error: 文件存在但解析失败时返回错误
+func (s *Store) Open(path string) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var pins []*Pin
+	if err := json.Unmarshal(data, &pins); err != nil {
+		return err
+	}
+	for _, p := range pins {
+		s.pins[p.FileID] = p
+	}
+	return nil
+}
+
+// Pin 固定文件，已固定的文件更新固定原因
+// 参数：
+//   - fileID: string 文件唯一标识
+//   - reason: string 固定原因
+//
+// 返回值：
+//   - *Pin: 固定记录
+//   - error: 文件唯一标识为空时返回包装了 errs.ErrInvalidArgument 的错误，保存失败时返回写入错误
+func (s *Store) Pin(fileID, reason string) (*Pin, error) {
+	if fileID == "" {
+		return nil, fmt.Errorf("%w: 文件唯一标识不可为空", errs.ErrInvalidArgument)
+	}
+	if s == nil {
+		return nil, nil
+	}
+
+	s.mu.Lock()
+	p, ok := s.pins[fileID]
+	if !ok {
+		p = &Pin{FileID: fileID, PinnedAt: time.Now().Unix()}
+		s.pins[fileID] = p
+	}
+	p.Reason = reason
+	result := *p
+	s.mu.Unlock()
+
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Unpin 取消固定文件
+// 参数：
+//   - fileID: string 文件唯一标识
+//
+// 返回值：
+//   - error: 文件未被固定时返回包装了 errs.ErrNotFound 的错误，保存失败时返回写入错误
+func (s *Store) Unpin(fileID string) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	_, ok := s.pins[fileID]
+	delete(s.pins, fileID)
+	s.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%w: 文件 %s 未被固定", errs.ErrNotFound, fileID)
+	}
+	return s.save()
+}
+
+// IsPinned 检查文件是否被固定，清理文件片段前应调用
+func (s *Store) IsPinned(fileID string) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.pins[fileID]
+	return ok
+}
+
+// List 获取所有固定记录，按文件唯一标识排列
+func (s *Store) List() []*Pin {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.RLock()
+	pins := make([]*Pin, 0, len(s.pins))
+	for _, p := range s.pins {
+		c := *p
+		pins = append(pins, &c)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(pins, func(i, j int) bool { return pins[i].FileID < pins[j].FileID })
+	return pins
+}
+
+// Export 将所有固定记录以 JSON 格式写出，格式与持久化文件相同，可直接用于另一节点的 Open
+// 参数：
+//   - w: io.Writer 输出
+//
+// 返回值：
+//   - error: 写出失败时返回错误
+func (s *Store) Export(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s.List())
+}
+
+// save 将固定记录保存到持久化文件
+// 返回值：
+//   - error: 写入失败时返回错误
+func (s *Store) save() error {
+	s.mu.RLock()
+	path := s.path
+	s.mu.RUnlock()
+	if path == "" {
+		return nil
+	}
+	data, err := json.Marshal(s.List())
+	if err != nil {
+		logrus.Errorf("[%s]序列化固定记录失败: %v", debug.WhereAmI(), err)
+		return err
+	}
+
+	return afero.WriteFileAtomic(afero.NewOsFs(), path, data, 0644)
+}
@@ -0,0 +1,63 @@
+package pin
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bpfs/defs/errs"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pins")
+	s := NewStore()
+	if err := s.Open(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Pin("", "case-1"); !errors.Is(err, errs.ErrInvalidArgument) {
+		t.Fatalf("空的文件唯一标识应返回 ErrInvalidArgument, 实际 %v", err)
+	}
+	if _, err := s.Pin("file-b", "case-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Pin("file-a", "case-2"); err != nil {
+		t.Fatal(err)
+	}
+	if !s.IsPinned("file-a") || s.IsPinned("file-c") {
+		t.Fatal("固定状态不正确")
+	}
+
+	// 重新打开后恢复固定记录
+	restored := NewStore()
+	if err := restored.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	pins := restored.List()
+	if len(pins) != 2 || pins[0].FileID != "file-a" || pins[1].Reason != "case-1" {
+		t.Fatalf("恢复的固定记录不正确: %+v", pins)
+	}
+
+	if err := restored.Unpin("file-a"); err != nil || restored.IsPinned("file-a") {
+		t.Fatalf("取消固定失败: %v", err)
+	}
+	if err := restored.Unpin("file-a"); !errors.Is(err, errs.ErrNotFound) {
+		t.Fatalf("未固定的文件应返回 ErrNotFound, 实际 %v", err)
+	}
+
+	// 导出的记录可以直接加载到另一节点
+	var buf bytes.Buffer
+	if err := restored.Export(&buf); err != nil {
+		t.Fatal(err)
+	}
+	other := NewStore()
+	exported := filepath.Join(t.TempDir(), "exported")
+	if err := os.WriteFile(exported, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Open(exported); err != nil || !other.IsPinned("file-b") || other.IsPinned("file-a") {
+		t.Fatalf("加载导出的固定记录失败: %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package defs
+
+import (
+	"io"
+
+	"github.com/bpfs/defs/pin"
+)
+
+// Pin 固定文件，使本节点存储的该文件片段不会因存储时长、所有者是否在线或损坏隔离等原因被清理
+// 参数：
+//   - fileID: string 文件唯一标识
+//   - reason: string 固定原因，如法律保留的案件编号
+//
+// 返回值：
+//   - *pin.Pin: 固定记录
+//   - error: 文件唯一标识为空时返回包装了 errs.ErrInvalidArgument 的错误
+func (fs *FS) Pin(fileID, reason string) (*pin.Pin, error) {
+	return fs.opt.GetPins().Pin(fileID, reason)
+}
+
+// Unpin 取消固定文件
+// 参数：
+//   - fileID: string 文件唯一标识
+//
+// 返回值：
+//   - error: 文件未被固定时返回包装了 errs.ErrNotFound 的错误
+func (fs *FS) Unpin(fileID string) error {
+	return fs.opt.GetPins().Unpin(fileID)
+}
+
+// Pins 列出所有被固定的文件
+// 返回值：
+//   - []*pin.Pin: 按文件唯一标识排列的固定记录
+func (fs *FS) Pins() []*pin.Pin {
+	return fs.opt.GetPins().List()
+}
+
+// ExportPins 以 JSON 格式导出所有固定记录
+// 参数：
+//   - w: io.Writer 输出
+//
+// 返回值：
+//   - error: 写出失败时返回错误
+func (fs *FS) ExportPins(w io.Writer) error {
+	return fs.opt.GetPins().Export(w)
+}
@@ -0,0 +1,19 @@
+package defs
+
+import (
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/uploads"
+)
+
+// PlanPlacement 按当前路由表演练文件片段的分布，不发送任何数据
+// 用于在大规模迁移或调整分布约束前，检查片段会落在哪些节点上、约束能否全部满足以及可以承受多少节点或区域失效
+// 参数：
+//   - meta: *uploads.FileMeta 文件的元数据，需设置文件唯一标识与大小
+//   - policy: *opts.PlacementPolicy 要检验的分布约束，为 nil 时不约束
+//
+// 返回值：
+//   - *uploads.PlacementPlan: 演练结果
+//   - error: 元数据无效时返回包装了 errs.ErrInvalidArgument 的错误
+func (fs *FS) PlanPlacement(meta *uploads.FileMeta, policy *opts.PlacementPolicy) (*uploads.PlacementPlan, error) {
+	return fs.upload.PlanPlacement(fs.opt, fs.p2p, meta, policy)
+}
@@ -0,0 +1,14 @@
+package defs
+
+import "github.com/bpfs/defs/uploads"
+
+// PowerChanged 通知设备的电源或网络状态已变化，立即按电源感知策略暂停或继续后台上传任务
+// 嵌入方可在平台的电池或网络状态变化回调中调用；未设置电源感知策略时不起作用
+func (fs *FS) PowerChanged() {
+	fs.upload.PowerChanged()
+}
+
+// PowerStatus 获取电源感知的当前状态，包括暂停的原因与因此暂停的上传任务
+func (fs *FS) PowerStatus() uploads.PowerStatus {
+	return fs.upload.PowerStatus()
+}
@@ -0,0 +1,243 @@
+// Package profile 记录命名的上传参数组合
+// 应用在每次上传时按名称选择一组参数(纠删码冗余、压缩、片段分布、到期时间)，而不必在每次调用时重复设置。
+// 内置 archive 与 quick-share 两组参数，可被同名的自定义参数覆盖；自定义参数持久化保存。
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/sirupsen/logrus"
+)
+
+// 内置的参数组合名称
+const (
+	Archive    = "archive"     // 长期归档：高冗余、跨区域分布、压缩
+	QuickShare = "quick-share" // 临时分享：低冗余、7 天后到期
+)
+
+// maxParityRatio 校验片段占比的上限，与全局选项的限制一致
+const maxParityRatio = 0.5
+
+// Profile 一组命名的上传参数，零值字段沿用全局选项
+type Profile struct {
+	Name               string        `json:"name"`                            // 名称
+	ParityRatio        float64       `json:"parity_ratio,omitempty"`          // 纠删码(比例)模式下校验片段的占比，为 0 时沿用全局存储模式
+	ShardSize          int64         `json:"shard_size,omitempty"`            // 文件片段的大小，为 0 时沿用全局选项
+	Compress           *bool         `json:"compress,omitempty"`              // 是否在分片前压缩，为 nil 时沿用全局选项
+	MaxSegmentsPerPeer int           `json:"max_segments_per_peer,omitempty"` // 同一文件在单个节点上存放的片段数上限，为 0 时沿用全局选项
+	MaxSegmentsPerZone int           `json:"max_segments_per_zone,omitempty"` // 同一文件在单个区域内存放的片段数上限，为 0 时沿用全局选项
+	SeparateParity     bool          `json:"separate_parity,omitempty"`       // 纠删码片段与数据片段放置在不相交的节点上
+	SeparateZones      bool          `json:"separate_zones,omitempty"`        // 纠删码片段与数据片段放置在不同的区域，需全局选项设置区域
+	TTL                time.Duration `json:"ttl,omitempty"`                   // 上传后多久到期，为 0 时永不到期
+}
+
+// Validate 检查参数是否有效
+// 返回值：
+//   - error: 参数无效时返回包装了 errs.ErrInvalidArgument 的错误
+func (p *Profile) Validate() error {
+	switch {
+	case p == nil || p.Name == "":
+		return fmt.Errorf("%w: 上传参数的名称不可为空", errs.ErrInvalidArgument)
+	case p.ParityRatio < 0 || p.ParityRatio > maxParityRatio:
+		return fmt.Errorf("%w: 校验片段占比 %f 超出范围", errs.ErrInvalidArgument, p.ParityRatio)
+	case p.ShardSize < 0 || p.MaxSegmentsPerPeer < 0 || p.MaxSegmentsPerZone < 0 || p.TTL < 0:
+		return fmt.Errorf("%w: 上传参数 %s 不可为负数", errs.ErrInvalidArgument, p.Name)
+	}
+	return nil
+}
+
+// builtins 返回内置的参数组合
+func builtins() map[string]*Profile {
+	compress := true
+	return map[string]*Profile{
+		Archive: {
+			Name:               Archive,
+			ParityRatio:        maxParityRatio,
+			Compress:           &compress,
+			MaxSegmentsPerPeer: 1,
+			SeparateParity:     true,
+			SeparateZones:      true,
+		},
+		QuickShare: {
+			Name:        QuickShare,
+			ParityRatio: 0.1,
+			TTL:         7 * 24 * time.Hour,
+		},
+	}
+}
+
+// Store 命名的上传参数集合
+// 零值不可用，通过 NewStore 创建；所有方法在 nil 接收者上均为空操作
+type Store struct {
+	mu       sync.RWMutex
+	builtins map[string]*Profile // 内置的参数组合
+	custom   map[string]*Profile // 自定义的参数组合，同名时覆盖内置参数
+	path     string              // 持久化文件路径，为空时不持久化
+}
+
+// NewStore 创建只包含内置参数组合的集合
+func NewStore() *Store {
+	return &Store{builtins: builtins(), custom: make(map[string]*Profile)}
+}
+
+// Open 设置持久化文件路径并加载已保存的自定义参数，无效的参数被丢弃
+// 参数：
+//   - path: string 持久化文件路径
+//
+// 返回值：
+//   - error: 文件存在但解析失败时返回错误
+func (s *Store) Open(path string) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var profiles []*Profile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return err
+	}
+	for _, p := range profiles {
+		if err := p.Validate(); err != nil {
+			logrus.Warnf("[%s]丢弃无效的上传参数: %v", debug.WhereAmI(), err)
+			continue
+		}
+		s.custom[p.Name] = p
+	}
+	return nil
+}
+
+// Get 按名称获取参数组合，自定义参数优先
+// 参数：
+//   - name: string 名称
+//
+// 返回值：
+//   - *Profile: 参数组合的副本
+//   - error: 名称不存在时返回包装了 errs.ErrNotFound 的错误
+func (s *Store) Get(name string) (*Profile, error) {
+	if s != nil {
+		s.mu.RLock()
+		p, ok := s.custom[name]
+		if !ok {
+			p, ok = s.builtins[name]
+		}
+		s.mu.RUnlock()
+		if ok {
+			return p.clone(), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: 上传参数 %s", errs.ErrNotFound, name)
+}
+
+// Set 保存自定义参数组合，与内置参数同名时覆盖内置参数
+// 参数：
+//   - p: *Profile 参数组合
+//
+// 返回值：
+//   - error: 参数无效时返回包装了 errs.ErrInvalidArgument 的错误，保存失败时返回写入错误
+func (s *Store) Set(p *Profile) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	s.custom[p.Name] = p.clone()
+	s.mu.Unlock()
+	return s.save()
+}
+
+// Delete 删除自定义参数组合，覆盖内置参数的自定义参数删除后恢复内置参数
+// 参数：
+//   - name: string 名称
+//
+// 返回值：
+//   - error: 不存在同名的自定义参数时返回包装了 errs.ErrNotFound 的错误，保存失败时返回写入错误
+func (s *Store) Delete(name string) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	_, ok := s.custom[name]
+	delete(s.custom, name)
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: 自定义上传参数 %s", errs.ErrNotFound, name)
+	}
+	return s.save()
+}
+
+// List 获取所有参数组合，按名称排列
+func (s *Store) List() []*Profile {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	merged := make(map[string]*Profile, len(s.builtins)+len(s.custom))
+	for name, p := range s.builtins {
+		merged[name] = p
+	}
+	for name, p := range s.custom {
+		merged[name] = p
+	}
+	profiles := make([]*Profile, 0, len(merged))
+	for _, p := range merged {
+		profiles = append(profiles, p.clone())
+	}
+	s.mu.RUnlock()
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles
+}
+
+// clone 复制参数组合
+func (p *Profile) clone() *Profile {
+	c := *p
+	if p.Compress != nil {
+		compress := *p.Compress
+		c.Compress = &compress
+	}
+	return &c
+}
+
+// save 将自定义参数保存到持久化文件
+// 返回值：
+//   - error: 写入失败时返回错误
+func (s *Store) save() error {
+	s.mu.RLock()
+	path := s.path
+	profiles := make([]*Profile, 0, len(s.custom))
+	for _, p := range s.custom {
+		profiles = append(profiles, p)
+	}
+	s.mu.RUnlock()
+	if path == "" {
+		return nil
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	data, err := json.Marshal(profiles)
+	if err != nil {
+		logrus.Errorf("[%s]序列化上传参数失败: %v", debug.WhereAmI(), err)
+		return err
+	}
+
+	return afero.WriteFileAtomic(afero.NewOsFs(), path, data, 0644)
+}
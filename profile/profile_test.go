@@ -0,0 +1,71 @@
+package profile
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/bpfs/defs/errs"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles")
+	s := NewStore()
+	if err := s.Open(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// 内置参数组合
+	archive, err := s.Get(Archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archive.ParityRatio != maxParityRatio || archive.Compress == nil || !*archive.Compress || !archive.SeparateZones {
+		t.Fatalf("内置的 archive 参数不符: %+v", archive)
+	}
+	if share, err := s.Get(QuickShare); err != nil || share.TTL == 0 {
+		t.Fatalf("内置的 quick-share 应设置到期时长: %+v, %v", share, err)
+	}
+	if _, err := s.Get("missing"); !errors.Is(err, errs.ErrNotFound) {
+		t.Fatalf("不存在的参数组合应返回 ErrNotFound, 实际 %v", err)
+	}
+
+	// 返回的是副本
+	*archive.Compress = false
+	if again, _ := s.Get(Archive); !*again.Compress {
+		t.Fatal("修改返回值不应影响已保存的参数")
+	}
+
+	if err := s.Set(&Profile{Name: "bad", ParityRatio: 0.9}); !errors.Is(err, errs.ErrInvalidArgument) {
+		t.Fatalf("无效的参数应返回 ErrInvalidArgument, 实际 %v", err)
+	}
+	if err := s.Set(&Profile{Name: "backup", ParityRatio: 0.2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set(&Profile{Name: Archive, ParityRatio: 0.4}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新加载后保留自定义参数
+	reloaded := NewStore()
+	if err := reloaded.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := reloaded.Get(Archive); err != nil || p.ParityRatio != 0.4 {
+		t.Fatalf("自定义参数应覆盖内置参数: %+v, %v", p, err)
+	}
+	if list := reloaded.List(); len(list) != 3 || list[0].Name != Archive || list[1].Name != "backup" {
+		t.Fatalf("参数列表不符: %v", list)
+	}
+
+	// 删除覆盖内置参数的自定义参数后恢复内置参数
+	if err := reloaded.Delete(Archive); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := reloaded.Get(Archive); p.ParityRatio != maxParityRatio {
+		t.Fatalf("应恢复内置参数: %+v", p)
+	}
+	if err := reloaded.Delete(QuickShare); !errors.Is(err, errs.ErrNotFound) {
+		t.Fatalf("内置参数不可删除, 实际 %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package defs
+
+import (
+	"context"
+	"crypto/ecdsa"
+
+	"github.com/bpfs/defs/profile"
+	"github.com/bpfs/defs/uploads"
+)
+
+// UploadWithProfile 使用命名的上传参数组合上传文件
+// 参数：
+//   - ctx: context.Context 上传任务的上下文
+//   - path: string 文件路径
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥，为 nil 时使用默认所有者
+//   - name: string 上传参数组合的名称，如 profile.Archive 或 profile.QuickShare
+//
+// 返回值：
+//   - *uploads.UploadSuccessInfo: 文件上传成功后的返回信息
+//   - error: 如果发生错误，返回错误信息
+func (fs *FS) UploadWithProfile(ctx context.Context, path string, ownerPriv *ecdsa.PrivateKey, name string) (*uploads.UploadSuccessInfo, error) {
+	return fs.upload.NewUploadWithProfile(ctx, fs.opt, fs.afe, fs.p2p, fs.pub, path, ownerPriv, name)
+}
+
+// UploadProfiles 获取所有上传参数组合，按名称排列
+func (fs *FS) UploadProfiles() []*profile.Profile {
+	return fs.opt.GetUploadProfiles().List()
+}
+
+// SetUploadProfile 保存自定义的上传参数组合，与内置参数同名时覆盖内置参数
+func (fs *FS) SetUploadProfile(p *profile.Profile) error {
+	return fs.opt.GetUploadProfiles().Set(p)
+}
+
+// DeleteUploadProfile 删除自定义的上传参数组合
+func (fs *FS) DeleteUploadProfile(name string) error {
+	return fs.opt.GetUploadProfiles().Delete(name)
+}
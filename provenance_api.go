@@ -0,0 +1,17 @@
+package defs
+
+import (
+	"github.com/bpfs/defs/downloads"
+)
+
+// GetDownloadProvenance 获取下载任务的来源记录
+// 记录包含各文件片段的提供节点及未通过验证的片段，用于追溯提供错误数据的节点
+// 参数：
+//   - taskID: string 任务唯一标识
+//
+// 返回值：
+//   - *downloads.Provenance: 来源记录
+//   - error: 记录不存在时返回包装了 errs.ErrNotFound 的错误
+func (fs *FS) GetDownloadProvenance(taskID string) (*downloads.Provenance, error) {
+	return fs.download.GetProvenance(fs.afe, taskID)
+}
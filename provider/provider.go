@@ -0,0 +1,196 @@
+// Package provider 通告存储节点上文件片段的增减
+// 修复、缓存复制、到期清理或损坏隔离都会改变文件片段所在的节点，进行中的下载任务订阅这些通告，
+// 把剩余片段的下载请求转向新的节点，而不是继续请求已不再保存片段的旧节点。
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/network"
+	"github.com/bpfs/defs/supervise"
+	"github.com/bpfs/dep2p"
+	"github.com/bpfs/dep2p/pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+)
+
+const version = "1.0.0"
+
+var (
+	// 文件片段所在节点的变更通告
+	PubSubProviderUpdateTopic = fmt.Sprintf("defs@pubsub/provider/update/%s", version)
+)
+
+// flushInterval 合并变更通告的间隔，同一文件在间隔内的变更合并为一条通告
+const flushInterval = time.Second
+
+// Update 存储节点上一个文件的片段变更
+type Update struct {
+	FileID  string   // 文件唯一标识
+	Peer    peer.ID  // 发生变更的存储节点，须与消息的发送方一致
+	Added   []string // 新增的文件片段唯一标识
+	Removed []string // 移除的文件片段唯一标识
+	At      int64    // 通告的时间戳
+}
+
+// change 一个文件尚未通告的片段变更，值为 true 表示新增
+type change map[string]bool
+
+// Notifier 合并并通告本节点上文件片段的增减
+// 所有方法在 nil 接收者上均为空操作
+type Notifier struct {
+	ctx    context.Context    // 上下文用于管理协程的生命周期
+	cancel context.CancelFunc // 取消函数
+	mu     sync.Mutex         // 用于保护待通告变更的互斥锁
+
+	self    peer.ID               // 本节点的ID
+	pending map[string]change     // 文件唯一标识到待通告变更的映射
+	publish func(u *Update) error // 广播变更通告
+}
+
+type NewNotifierInput struct {
+	fx.In
+	LC         fx.Lifecycle
+	Ctx        context.Context       // 全局上下文
+	P2P        *dep2p.DeP2P          // 网络主机
+	PubSub     *pubsub.DeP2PPubSub   // 网络订阅
+	Supervisor *supervise.Supervisor // 后台任务的崩溃恢复
+}
+
+type NewNotifierOutput struct {
+	fx.Out
+	Providers *Notifier // 文件片段变更通告
+}
+
+// NewNotifier 创建并初始化一个新的 Notifier 实例
+// 参数：
+//   - input: NewNotifierInput 用于初始化 Notifier 的输入结构体。
+//
+// 返回值：
+//   - NewNotifierOutput: 包含 Notifier 的输出结构体。
+func NewNotifier(input NewNotifierInput) (out NewNotifierOutput) {
+	n := newNotifier(input.Ctx, input.P2P.Host().ID(), func(u *Update) error {
+		return network.SendPubSub(input.P2P, input.PubSub, PubSubProviderUpdateTopic, "update", "", u)
+	})
+	out.Providers = n
+
+	input.LC.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			input.Supervisor.Go("provider", "run", func() { n.run() })
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			n.cancel()
+			n.Flush()
+			return nil
+		},
+	})
+
+	return out
+}
+
+// newNotifier 创建文件片段变更通告
+func newNotifier(ctx context.Context, self peer.ID, publish func(u *Update) error) *Notifier {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Notifier{
+		ctx:     ctx,
+		cancel:  cancel,
+		self:    self,
+		pending: make(map[string]change),
+		publish: publish,
+	}
+}
+
+// Added 记录本节点新增了文件片段
+// 参数：
+//   - fileID: string 文件唯一标识
+//   - segmentID: string 文件片段的唯一标识
+func (n *Notifier) Added(fileID, segmentID string) {
+	n.record(fileID, segmentID, true)
+}
+
+// Removed 记录本节点移除了文件片段
+// 参数：
+//   - fileID: string 文件唯一标识
+//   - segmentID: string 文件片段的唯一标识
+func (n *Notifier) Removed(fileID, segmentID string) {
+	n.record(fileID, segmentID, false)
+}
+
+// record 记录片段变更，同一片段在通告前的多次变更只保留最后一次
+func (n *Notifier) record(fileID, segmentID string, added bool) {
+	if n == nil || fileID == "" || segmentID == "" {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	c, ok := n.pending[fileID]
+	if !ok {
+		c = make(change)
+		n.pending[fileID] = c
+	}
+	c[segmentID] = added
+}
+
+// Flush 立即通告所有待通告的变更
+// 返回值：
+//   - int: 通告的文件数量
+func (n *Notifier) Flush() int {
+	if n == nil {
+		return 0
+	}
+	n.mu.Lock()
+	pending := n.pending
+	n.pending = make(map[string]change)
+	n.mu.Unlock()
+
+	fileIDs := make([]string, 0, len(pending))
+	for fileID := range pending {
+		fileIDs = append(fileIDs, fileID)
+	}
+	sort.Strings(fileIDs)
+
+	published := 0
+	for _, fileID := range fileIDs {
+		u := &Update{FileID: fileID, Peer: n.self, At: time.Now().Unix()}
+		for segmentID, added := range pending[fileID] {
+			if added {
+				u.Added = append(u.Added, segmentID)
+			} else {
+				u.Removed = append(u.Removed, segmentID)
+			}
+		}
+		sort.Strings(u.Added)
+		sort.Strings(u.Removed)
+
+		if n.publish != nil {
+			if err := n.publish(u); err != nil {
+				logrus.Errorf("[%s]通告文件 %s 的片段变更失败: %v", debug.WhereAmI(), fileID, err)
+				continue
+			}
+		}
+		published++
+	}
+	return published
+}
+
+// run 定时通告合并后的变更
+func (n *Notifier) run() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-ticker.C:
+			n.Flush()
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/test"
+)
+
+func TestNotifier(t *testing.T) {
+	self := test.RandPeerIDFatal(t)
+	var published []*Update
+	n := newNotifier(context.Background(), self, func(u *Update) error {
+		published = append(published, u)
+		return nil
+	})
+
+	n.Added("file-1", "b")
+	n.Added("file-1", "a")
+	n.Removed("file-1", "c")
+	n.Added("file-2", "x")
+	// 通告前先新增后移除的片段只通告移除
+	n.Removed("file-2", "x")
+	n.Added("", "ignored")
+
+	if got := n.Flush(); got != 2 {
+		t.Fatalf("Flush() = %d", got)
+	}
+	if len(published) != 2 {
+		t.Fatalf("应通告 2 个文件，实际 %d", len(published))
+	}
+	u1, u2 := published[0], published[1]
+	if u1.FileID != "file-1" || u1.Peer != self || !reflect.DeepEqual(u1.Added, []string{"a", "b"}) || !reflect.DeepEqual(u1.Removed, []string{"c"}) {
+		t.Fatalf("file-1 的通告不符: %+v", u1)
+	}
+	if u2.FileID != "file-2" || len(u2.Added) != 0 || !reflect.DeepEqual(u2.Removed, []string{"x"}) {
+		t.Fatalf("file-2 的通告不符: %+v", u2)
+	}
+
+	// 已通告的变更不再重复通告
+	if got := n.Flush(); got != 0 {
+		t.Fatalf("再次 Flush() = %d", got)
+	}
+
+	var nilNotifier *Notifier
+	nilNotifier.Added("file-1", "a")
+	if nilNotifier.Flush() != 0 {
+		t.Fatal("nil 通告应为空操作")
+	}
+}
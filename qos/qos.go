@@ -0,0 +1,277 @@
+// Package qos 实现了按服务等级分配带宽与并发的全局传输调度器。
+// 每个上传或下载任务属于一个服务等级，调度器按等级的权重分配带宽份额，并限制每个等级的并发传输数，
+// 使后台备份等低优先级任务不会影响交互式下载。
+package qos
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Class 服务等级
+type Class int
+
+const (
+	ClassNormal      Class = iota // 普通，默认的服务等级
+	ClassInteractive              // 交互，用户正在等待结果的传输
+	ClassBackground               // 后台，备份、同步等可以延后的传输
+)
+
+// classes 所有服务等级
+var classes = []Class{ClassInteractive, ClassNormal, ClassBackground}
+
+// String 返回服务等级的名称
+func (c Class) String() string {
+	switch c {
+	case ClassInteractive:
+		return "interactive"
+	case ClassNormal:
+		return "normal"
+	case ClassBackground:
+		return "background"
+	default:
+		return fmt.Sprintf("class(%d)", int(c))
+	}
+}
+
+// Valid 检查服务等级是否有效
+func (c Class) Valid() bool {
+	return c >= ClassNormal && c <= ClassBackground
+}
+
+// classKey 上下文中服务等级的键
+type classKey struct{}
+
+// WithClass 返回携带服务等级的上下文，传输层据此选择停滞检测的阈值
+// 参数：
+//   - ctx: context.Context 父上下文
+//   - class: Class 服务等级
+//
+// 返回值：
+//   - context.Context: 携带服务等级的上下文
+func WithClass(ctx context.Context, class Class) context.Context {
+	return context.WithValue(ctx, classKey{}, class)
+}
+
+// ClassFrom 获取上下文携带的服务等级
+// 参数：
+//   - ctx: context.Context 上下文
+//
+// 返回值：
+//   - Class: 服务等级，未设置或无效时返回 ClassNormal
+func ClassFrom(ctx context.Context) Class {
+	if class, ok := ctx.Value(classKey{}).(Class); ok && class.Valid() {
+		return class
+	}
+	return ClassNormal
+}
+
+// DefaultBandwidth 默认的总带宽(100Mbps)，单位为字节/秒
+// 总带宽不限制时各等级的权重不起作用，应按节点实际的上行带宽设置
+const DefaultBandwidth = 100 * 1000 * 1000 / 8
+
+// ClassShare 描述单个服务等级的份额
+type ClassShare struct {
+	Weight         int // 带宽权重，带宽按活跃等级的权重比例分配
+	MaxConcurrency int // 最大并发传输数，0 表示不限制
+}
+
+// Config 描述调度器的配置
+type Config struct {
+	Bandwidth int64                // 总带宽，单位为字节/秒，0 表示不限制
+	Shares    map[Class]ClassShare // 各服务等级的份额
+}
+
+// DefaultConfig 返回推荐的调度器配置
+// 返回值：
+//   - *Config: 默认的调度器配置
+func DefaultConfig() *Config {
+	return &Config{
+		Bandwidth: DefaultBandwidth, // 默认的总带宽
+		Shares: map[Class]ClassShare{
+			ClassInteractive: {Weight: 16, MaxConcurrency: 32}, // 交互
+			ClassNormal:      {Weight: 4, MaxConcurrency: 20},  // 普通
+			ClassBackground:  {Weight: 1, MaxConcurrency: 4},   // 后台
+		},
+	}
+}
+
+// classState 单个服务等级的调度状态
+type classState struct {
+	share    ClassShare    // 份额
+	slots    chan struct{} // 并发传输槽位
+	active   int           // 正在传输或等待传输的数量
+	nextFree time.Time     // 带宽预留到的时间点
+}
+
+// Scheduler 全局传输调度器
+type Scheduler struct {
+	mu        sync.Mutex            // 用于保护状态的互斥锁
+	bandwidth int64                 // 总带宽，单位为字节/秒
+	states    map[Class]*classState // 各服务等级的调度状态
+}
+
+// NewScheduler 创建并初始化一个新的 Scheduler 实例
+// 参数：
+//   - config: *Config 调度器配置，为 nil 时使用默认配置
+//
+// 返回值：
+//   - *Scheduler: 新创建的调度器
+func NewScheduler(config *Config) *Scheduler {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	s := &Scheduler{
+		bandwidth: config.Bandwidth,
+		states:    make(map[Class]*classState),
+	}
+	for _, class := range classes {
+		share, ok := config.Shares[class]
+		if !ok || share.Weight <= 0 {
+			share.Weight = 1
+		}
+		state := &classState{share: share}
+		if share.MaxConcurrency > 0 {
+			state.slots = make(chan struct{}, share.MaxConcurrency)
+		}
+		s.states[class] = state
+	}
+	return s
+}
+
+// state 获取服务等级的调度状态，无效的等级按普通等级处理
+func (s *Scheduler) state(class Class) *classState {
+	if !class.Valid() {
+		class = ClassNormal
+	}
+	return s.states[class]
+}
+
+// Acquire 获取一个传输槽位，达到该服务等级的最大并发数时阻塞等待
+// 参数：
+//   - ctx: context.Context 上下文，取消时停止等待
+//   - class: Class 服务等级
+//
+// 返回值：
+//   - func(): 传输完成后释放槽位的函数
+//   - error: 上下文取消时返回错误
+func (s *Scheduler) Acquire(ctx context.Context, class Class) (func(), error) {
+	if s == nil {
+		return func() {}, nil
+	}
+	state := s.state(class)
+
+	s.mu.Lock()
+	state.active++
+	s.mu.Unlock()
+
+	if state.slots != nil {
+		select {
+		case state.slots <- struct{}{}:
+		case <-ctx.Done():
+			s.mu.Lock()
+			state.active--
+			s.mu.Unlock()
+			return nil, ctx.Err()
+		}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if state.slots != nil {
+				<-state.slots
+			}
+			s.mu.Lock()
+			state.active--
+			s.mu.Unlock()
+		})
+	}, nil
+}
+
+// WaitN 按服务等级的带宽份额等待传输 n 个字节
+// 参数：
+//   - ctx: context.Context 上下文，取消时停止等待
+//   - class: Class 服务等级
+//   - n: int 传输的字节数
+//
+// 返回值：
+//   - error: 上下文取消时返回错误
+func (s *Scheduler) WaitN(ctx context.Context, class Class, n int) error {
+	if s == nil || n <= 0 {
+		return nil
+	}
+	delay := s.reserve(class, n)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reserve 为服务等级预留 n 个字节的带宽，返回需要等待的时间
+func (s *Scheduler) reserve(class Class, n int) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rate := s.rateLocked(class)
+	if rate <= 0 {
+		return 0
+	}
+
+	state := s.state(class)
+	now := time.Now()
+	start := state.nextFree
+	if start.Before(now) {
+		start = now
+	}
+	state.nextFree = start.Add(time.Duration(float64(n) / float64(rate) * float64(time.Second)))
+	return start.Sub(now)
+}
+
+// MaxConcurrency 获取服务等级的最大并发传输数
+// 参数：
+//   - class: Class 服务等级
+//
+// 返回值：
+//   - int: 最大并发传输数，0 表示不限制
+func (s *Scheduler) MaxConcurrency(class Class) int {
+	return s.state(class).share.MaxConcurrency
+}
+
+// Rate 获取服务等级当前分配到的带宽
+// 参数：
+//   - class: Class 服务等级
+//
+// 返回值：
+//   - int64: 分配到的带宽，单位为字节/秒，0 表示不限制
+func (s *Scheduler) Rate(class Class) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rateLocked(class)
+}
+
+// rateLocked 按活跃服务等级的权重比例计算带宽，调用方需持有锁
+// 没有其他活跃等级时，该等级可以使用全部带宽
+func (s *Scheduler) rateLocked(class Class) int64 {
+	if s.bandwidth <= 0 {
+		return 0
+	}
+	state := s.state(class)
+	total := state.share.Weight
+	for c, other := range s.states {
+		if c != class && other != state && other.active > 0 {
+			total += other.share.Weight
+		}
+	}
+	return s.bandwidth * int64(state.share.Weight) / int64(total)
+}
@@ -0,0 +1,99 @@
+package qos
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAcquireLimitsConcurrency(t *testing.T) {
+	s := NewScheduler(&Config{
+		Shares: map[Class]ClassShare{
+			ClassBackground: {Weight: 1, MaxConcurrency: 1},
+		},
+	})
+
+	release, err := s.Acquire(context.Background(), ClassBackground)
+	if err != nil {
+		t.Fatalf("获取槽位失败: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := s.Acquire(ctx, ClassBackground); err == nil {
+		t.Fatal("达到最大并发数时应阻塞等待")
+	}
+
+	// 其他等级不受影响
+	other, err := s.Acquire(context.Background(), ClassInteractive)
+	if err != nil {
+		t.Fatalf("获取交互等级槽位失败: %v", err)
+	}
+	other()
+
+	release()
+	release() // 重复释放不应影响计数
+	again, err := s.Acquire(context.Background(), ClassBackground)
+	if err != nil {
+		t.Fatalf("释放后获取槽位失败: %v", err)
+	}
+	again()
+}
+
+func TestRateSharesBandwidthByWeight(t *testing.T) {
+	s := NewScheduler(&Config{
+		Bandwidth: 1000,
+		Shares: map[Class]ClassShare{
+			ClassInteractive: {Weight: 9},
+			ClassBackground:  {Weight: 1},
+		},
+	})
+
+	// 只有一个等级活跃时使用全部带宽
+	release, _ := s.Acquire(context.Background(), ClassBackground)
+	if got := s.Rate(ClassBackground); got != 1000 {
+		t.Fatalf("期望带宽 1000，实际 %d", got)
+	}
+
+	// 交互等级活跃时按权重分配
+	interactive, _ := s.Acquire(context.Background(), ClassInteractive)
+	if got := s.Rate(ClassBackground); got != 100 {
+		t.Fatalf("期望后台带宽 100，实际 %d", got)
+	}
+	if got := s.Rate(ClassInteractive); got != 900 {
+		t.Fatalf("期望交互带宽 900，实际 %d", got)
+	}
+	interactive()
+	release()
+}
+
+func TestNilSchedulerIsUnlimited(t *testing.T) {
+	var s *Scheduler
+	release, err := s.Acquire(context.Background(), ClassNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if err := s.WaitN(context.Background(), ClassNormal, 1<<30); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClassFromContext(t *testing.T) {
+	if got := ClassFrom(context.Background()); got != ClassNormal {
+		t.Fatalf("未设置时应为普通等级, 实际 %s", got)
+	}
+	if got := ClassFrom(WithClass(context.Background(), ClassBackground)); got != ClassBackground {
+		t.Fatalf("ClassFrom = %s, want background", got)
+	}
+	if got := ClassFrom(WithClass(context.Background(), Class(42))); got != ClassNormal {
+		t.Fatalf("无效等级应按普通等级处理, 实际 %s", got)
+	}
+}
+
+func TestDefaultConfigLimitsBandwidth(t *testing.T) {
+	s := NewScheduler(nil)
+	if got := s.Rate(ClassNormal); got != DefaultBandwidth {
+		t.Fatalf("期望默认带宽 %d，实际 %d", DefaultBandwidth, got)
+	}
+}
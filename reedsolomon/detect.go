@@ -0,0 +1,118 @@
+package reedsolomon
+
+import "errors"
+
+// ErrTooManyCorrupted is returned by DecodeWithDetection if the shard set
+// contains more corrupted shards than can be located with the available parity.
+var ErrTooManyCorrupted = errors.New("too many corrupted shards to locate")
+
+// DecodeWithDetection will locate and repair silently corrupted shards.
+//
+// Unlike Reconstruct, which only recreates shards that are known to be
+// missing, DecodeWithDetection is given all shards that are available and
+// identifies shards whose content does not match the rest of the set.
+// Missing shards may be indicated by setting them to nil or zero-length,
+// in which case they are treated as erasures and will also be recreated.
+//
+// With p parity shards and m missing shards, up to (p-m)/2 corrupted shards
+// can be located. Corrupted shards are repaired in place and their indexes
+// are returned in ascending order. If the set already verifies, nil is returned.
+//
+// If there are more corrupted shards than can be located,
+// ErrTooManyCorrupted will be returned and the shards are left untouched.
+//
+// The cost grows combinatorially with the number of corrupted shards,
+// so this is intended for repairing stored data, not for the hot path.
+func DecodeWithDetection(enc Encoder, shards [][]byte) ([]int, error) {
+	ext, ok := enc.(Extensions)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	if len(shards) != ext.TotalShards() {
+		return nil, ErrTooFewShards
+	}
+
+	var present []int
+	for i, shard := range shards {
+		if len(shard) != 0 {
+			present = append(present, i)
+		}
+	}
+	missing := len(shards) - len(present)
+	if missing > ext.ParityShards() {
+		return nil, ErrTooFewShards
+	}
+
+	maxErrors := (ext.ParityShards() - missing) / 2
+	work := make([][]byte, len(shards))
+	for e := 0; e <= maxErrors; e++ {
+		idx := make([]int, e)
+		for i := range idx {
+			idx[i] = i
+		}
+		for {
+			candidate := make([]int, e)
+			for i, j := range idx {
+				candidate[i] = present[j]
+			}
+			repaired, err := tryErasures(enc, shards, work, candidate)
+			if err != nil {
+				return nil, err
+			}
+			if repaired {
+				for i, shard := range shards {
+					if len(shard) == 0 {
+						shards[i] = work[i]
+					}
+				}
+				for _, c := range candidate {
+					copy(shards[c], work[c])
+				}
+				if e == 0 {
+					return nil, nil
+				}
+				return candidate, nil
+			}
+			if !nextCombination(idx, len(present)) {
+				break
+			}
+		}
+	}
+	return nil, ErrTooManyCorrupted
+}
+
+// tryErasures treats the candidate shards as missing, reconstructs them
+// together with the shards that are already missing into work and
+// reports whether the resulting set verifies.
+func tryErasures(enc Encoder, shards, work [][]byte, candidate []int) (bool, error) {
+	for i, shard := range shards {
+		if len(shard) == 0 {
+			work[i] = nil
+		} else {
+			work[i] = shard
+		}
+	}
+	for _, c := range candidate {
+		work[c] = nil
+	}
+	if err := enc.Reconstruct(work); err != nil {
+		return false, err
+	}
+	return enc.Verify(work)
+}
+
+// nextCombination advances idx to the next k-combination of [0, n)
+// in lexicographic order. It returns false when idx was the last one.
+func nextCombination(idx []int, n int) bool {
+	k := len(idx)
+	for i := k - 1; i >= 0; i-- {
+		if idx[i] < n-k+i {
+			idx[i]++
+			for j := i + 1; j < k; j++ {
+				idx[j] = idx[j-1] + 1
+			}
+			return true
+		}
+	}
+	return false
+}
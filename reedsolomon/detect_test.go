@@ -0,0 +1,73 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeWithDetection(t *testing.T) {
+	enc, err := New(6, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shards := enc.(Extensions).AllocAligned(1000)
+	rng := rand.New(rand.NewSource(0))
+	for _, s := range shards[:6] {
+		fillRandom(s, rng.Int63())
+	}
+	if err := enc.Encode(shards); err != nil {
+		t.Fatal(err)
+	}
+	want := make([][]byte, len(shards))
+	for i := range shards {
+		want[i] = append([]byte(nil), shards[i]...)
+	}
+
+	// Clean set.
+	corrupted, err := DecodeWithDetection(enc, shards)
+	if err != nil || corrupted != nil {
+		t.Fatalf("clean set: got %v, %v", corrupted, err)
+	}
+
+	// Two silently corrupted shards.
+	shards[1][10] ^= 0xff
+	shards[7][999] ^= 0x01
+	corrupted, err = DecodeWithDetection(enc, shards)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(corrupted, []int{1, 7}) {
+		t.Fatalf("corrupted = %v, want [1 7]", corrupted)
+	}
+	for i := range shards {
+		if !bytes.Equal(shards[i], want[i]) {
+			t.Fatalf("shard %d not repaired", i)
+		}
+	}
+
+	// One missing shard plus one corrupted shard.
+	shards[2] = nil
+	shards[5][0] ^= 0x80
+	corrupted, err = DecodeWithDetection(enc, shards)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(corrupted, []int{5}) {
+		t.Fatalf("corrupted = %v, want [5]", corrupted)
+	}
+	for i := range shards {
+		if !bytes.Equal(shards[i], want[i]) {
+			t.Fatalf("shard %d not repaired", i)
+		}
+	}
+
+	// Three corrupted shards exceed the locating capacity of four parity shards.
+	shards[0][1] ^= 1
+	shards[3][1] ^= 1
+	shards[8][1] ^= 1
+	if _, err := DecodeWithDetection(enc, shards); err != ErrTooManyCorrupted {
+		t.Fatalf("got %v, want ErrTooManyCorrupted", err)
+	}
+}
@@ -19,8 +19,10 @@ func galMulSlice(c byte, in, out []byte, o *options) {
 		return
 	}
 	var done int
-	galMulNEON(mulTableLow[c][:], mulTableHigh[c][:], in, out)
-	done = (len(in) >> 5) << 5
+	if o.useNEON {
+		galMulNEON(mulTableLow[c][:], mulTableHigh[c][:], in, out)
+		done = (len(in) >> 5) << 5
+	}
 
 	remain := len(in) - done
 	if remain > 0 {
@@ -37,8 +39,10 @@ func galMulSliceXor(c byte, in, out []byte, o *options) {
 		return
 	}
 	var done int
-	galMulXorNEON(mulTableLow[c][:], mulTableHigh[c][:], in, out)
-	done = (len(in) >> 5) << 5
+	if o.useNEON {
+		galMulXorNEON(mulTableLow[c][:], mulTableHigh[c][:], in, out)
+		done = (len(in) >> 5) << 5
+	}
 
 	remain := len(in) - done
 	if remain > 0 {
@@ -104,6 +108,10 @@ func mulgf16(x, y []byte, log_m ffe, o *options) {
 }
 
 func mulAdd8(out, in []byte, log_m ffe8, o *options) {
+	if !o.useNEON {
+		refMulAdd8(in, out, log_m)
+		return
+	}
 	t := &multiply256LUT8[log_m]
 	galMulXorNEON(t[:16], t[16:32], in, out)
 	done := (len(in) >> 5) << 5
@@ -115,16 +123,16 @@ func mulAdd8(out, in []byte, log_m ffe8, o *options) {
 }
 
 func mulgf8(out, in []byte, log_m ffe8, o *options) {
-	var done int
-	t := &multiply256LUT8[log_m]
-	galMulNEON(t[:16], t[16:32], in, out)
-	done = (len(in) >> 5) << 5
-
-	remain := len(in) - done
-	if remain > 0 {
-		mt := mul8LUTs[log_m].Value[:]
-		for i := done; i < len(in); i++ {
-			out[i] ^= byte(mt[in[i]])
-		}
+	if o.useNEON {
+		t := &multiply256LUT8[log_m]
+		galMulNEON(t[:16], t[16:32], in, out)
+		done := (len(in) >> 5) << 5
+		in = in[done:]
+		out = out[done:]
+	}
+	out = out[:len(in)]
+	mt := mul8LUTs[log_m].Value[:]
+	for i := range in {
+		out[i] = byte(mt[in[i]])
 	}
 }
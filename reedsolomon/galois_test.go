@@ -9,6 +9,7 @@ package reedsolomon
 
 import (
 	"bytes"
+	"runtime"
 	"testing"
 )
 
@@ -180,6 +181,19 @@ func TestGalois(t *testing.T) {
 		o.useSSSE3, o.useAVX2 = false, true
 		testGalois(t, &o)
 	}
+	if defaultOptions.useNEON {
+		testGalois(t, &options{useNEON: true})
+	}
+}
+
+func TestKernel(t *testing.T) {
+	if Kernel() == "" {
+		t.Fatal("no kernel selected")
+	}
+	generic := Kernel(WithNEON(false), WithGFNI(false), WithAVX512(false), WithAVX2(false), WithSSSE3(false))
+	if runtime.GOARCH != "ppc64le" && generic != "generic" {
+		t.Fatalf("expected generic kernel with all instructions disabled, got %s", generic)
+	}
 }
 
 func TestSliceGalAdd(t *testing.T) {
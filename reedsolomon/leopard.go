@@ -268,6 +268,10 @@ func (r *leopardFF16) Update(shards [][]byte, newDatashards [][]byte) error {
 	return ErrNotSupported
 }
 
+func (r *leopardFF16) SplitInto(data []byte, shards [][]byte) error {
+	return splitInto(data, shards, r.dataShards, r.totalShards, 64)
+}
+
 func (r *leopardFF16) Split(data []byte) ([][]byte, error) {
 	if len(data) == 0 {
 		return nil, ErrShortData
@@ -308,6 +308,10 @@ func (r *leopardFF8) Update(shards [][]byte, newDatashards [][]byte) error {
 	return ErrNotSupported
 }
 
+func (r *leopardFF8) SplitInto(data []byte, shards [][]byte) error {
+	return splitInto(data, shards, r.dataShards, r.totalShards, 64)
+}
+
 func (r *leopardFF8) Split(data []byte) ([][]byte, error) {
 	if len(data) == 0 {
 		return nil, ErrShortData
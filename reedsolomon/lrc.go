@@ -0,0 +1,319 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// LRC is a systematic Local Reconstruction Code.
+//
+// Data shards are divided into local groups, each protected by a single
+// XOR local parity shard, and all data shards are additionally protected
+// by a set of global Reed-Solomon parity shards.
+//
+// A single lost shard in a group can be repaired by reading only the other
+// members of that group, instead of dataShards shards as required by
+// plain Reed-Solomon. Losses that cannot be repaired locally fall back
+// to the global parities.
+//
+// Shards are laid out as:
+//
+//	[data 0..dataShards) [local parity 0..localGroups) [global parity 0..globalParity)
+type LRC struct {
+	dataShards   int
+	localGroups  int
+	globalParity int
+	groupSize    int
+	global       Encoder
+	o            options
+}
+
+// ErrInvLRCGroups is returned by NewLRC if the number of local groups
+// is less than one or larger than the number of data shards.
+var ErrInvLRCGroups = errors.New("cannot create LRC with less than one local group or more groups than data shards")
+
+// NewLRC creates a new Local Reconstruction Code encoder.
+//
+// dataShards are split into localGroups groups of (nearly) equal size,
+// each receiving one local parity shard. globalParity Reed-Solomon parity
+// shards are computed over all data shards. The supplied options are
+// passed to the underlying Reed-Solomon encoder.
+func NewLRC(dataShards, localGroups, globalParity int, opts ...Option) (*LRC, error) {
+	if dataShards <= 0 || globalParity < 0 {
+		return nil, ErrInvShardNum
+	}
+	if localGroups <= 0 || localGroups > dataShards {
+		return nil, ErrInvLRCGroups
+	}
+	if dataShards+localGroups+globalParity > 256 {
+		return nil, ErrMaxShardNum
+	}
+
+	l := &LRC{
+		dataShards:   dataShards,
+		localGroups:  localGroups,
+		globalParity: globalParity,
+		groupSize:    (dataShards + localGroups - 1) / localGroups,
+		o:            defaultOptions,
+	}
+	for _, opt := range opts {
+		opt(&l.o)
+	}
+
+	var err error
+	l.global, err = New(dataShards, globalParity, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// DataShards returns the number of data shards.
+func (l *LRC) DataShards() int { return l.dataShards }
+
+// LocalGroups returns the number of local groups and local parity shards.
+func (l *LRC) LocalGroups() int { return l.localGroups }
+
+// GlobalParity returns the number of global parity shards.
+func (l *LRC) GlobalParity() int { return l.globalParity }
+
+// TotalShards returns the total number of shards.
+func (l *LRC) TotalShards() int { return l.dataShards + l.localGroups + l.globalParity }
+
+// Group returns the indexes of the data shards belonging to local group g,
+// followed by the index of the group's local parity shard.
+// It returns nil if g is out of range.
+func (l *LRC) Group(g int) []int {
+	if g < 0 || g >= l.localGroups {
+		return nil
+	}
+	start := g * l.groupSize
+	end := start + l.groupSize
+	if end > l.dataShards {
+		end = l.dataShards
+	}
+	idx := make([]int, 0, end-start+1)
+	for i := start; i < end; i++ {
+		idx = append(idx, i)
+	}
+	return append(idx, l.dataShards+g)
+}
+
+// groupOf returns the local group of shard idx, or -1 for global parity shards.
+func (l *LRC) groupOf(idx int) int {
+	switch {
+	case idx < l.dataShards:
+		return idx / l.groupSize
+	case idx < l.dataShards+l.localGroups:
+		return idx - l.dataShards
+	default:
+		return -1
+	}
+}
+
+// RepairSet returns the indexes of the shards that must be read to repair
+// the single shard idx. For data and local parity shards this is the rest
+// of the local group; for global parity shards it is all data shards.
+// It returns nil if idx is out of range.
+func (l *LRC) RepairSet(idx int) []int {
+	if idx < 0 || idx >= l.TotalShards() {
+		return nil
+	}
+	g := l.groupOf(idx)
+	if g < 0 {
+		idx := make([]int, l.dataShards)
+		for i := range idx {
+			idx[i] = i
+		}
+		return idx
+	}
+	members := l.Group(g)
+	set := make([]int, 0, len(members)-1)
+	for _, m := range members {
+		if m != idx {
+			set = append(set, m)
+		}
+	}
+	return set
+}
+
+// checkShards verifies the number of shards and that all non-empty
+// shards have the same size.
+func (l *LRC) checkShards(shards [][]byte, nilok bool) (int, error) {
+	if len(shards) != l.TotalShards() {
+		return 0, ErrTooFewShards
+	}
+	size := shardSize(shards)
+	if size == 0 {
+		return 0, ErrShardNoData
+	}
+	for _, shard := range shards {
+		if len(shard) != size && (len(shard) != 0 || !nilok) {
+			return 0, ErrShardSize
+		}
+	}
+	return size, nil
+}
+
+// globalShards returns the data and global parity shards in the layout
+// expected by the underlying Reed-Solomon encoder.
+func (l *LRC) globalShards(shards [][]byte) [][]byte {
+	out := make([][]byte, 0, l.dataShards+l.globalParity)
+	out = append(out, shards[:l.dataShards]...)
+	return append(out, shards[l.dataShards+l.localGroups:]...)
+}
+
+// xorGroup writes the XOR of the group members except skip into out.
+func (l *LRC) xorGroup(shards [][]byte, g, skip int, out []byte) {
+	first := true
+	for _, m := range l.Group(g) {
+		if m == skip {
+			continue
+		}
+		if first {
+			copy(out, shards[m])
+			first = false
+			continue
+		}
+		sliceXor(shards[m], out, &l.o)
+	}
+	if first {
+		clear(out)
+	}
+}
+
+// Encode computes local and global parity for the supplied data shards.
+// The number of shards must match TotalShards, and all shards must have
+// the same size. Parity shards are overwritten.
+func (l *LRC) Encode(shards [][]byte) error {
+	size, err := l.checkShards(shards, false)
+	if err != nil {
+		return err
+	}
+	for g := 0; g < l.localGroups; g++ {
+		p := l.dataShards + g
+		if len(shards[p]) != size {
+			return ErrShardSize
+		}
+		l.xorGroup(shards, g, p, shards[p])
+	}
+	if l.globalParity == 0 {
+		return nil
+	}
+	return l.global.Encode(l.globalShards(shards))
+}
+
+// Verify returns true if both the local and the global parity shards
+// contain correct data.
+func (l *LRC) Verify(shards [][]byte) (bool, error) {
+	size, err := l.checkShards(shards, false)
+	if err != nil {
+		return false, err
+	}
+	buf := make([]byte, size)
+	for g := 0; g < l.localGroups; g++ {
+		p := l.dataShards + g
+		l.xorGroup(shards, g, p, buf)
+		if !bytes.Equal(buf, shards[p]) {
+			return false, nil
+		}
+	}
+	if l.globalParity == 0 {
+		return true, nil
+	}
+	return l.global.Verify(l.globalShards(shards))
+}
+
+// ReconstructLocal repairs every local group that is missing exactly one
+// shard, using only the members of that group. Missing shards are
+// indicated by nil or zero-length slices. It returns the number of
+// shards that are still missing afterwards.
+func (l *LRC) ReconstructLocal(shards [][]byte) (int, error) {
+	size, err := l.checkShards(shards, true)
+	if err != nil {
+		return 0, err
+	}
+	for g := 0; g < l.localGroups; g++ {
+		missing := -1
+		count := 0
+		for _, m := range l.Group(g) {
+			if len(shards[m]) == 0 {
+				missing = m
+				count++
+			}
+		}
+		if count != 1 {
+			continue
+		}
+		if cap(shards[missing]) >= size {
+			shards[missing] = shards[missing][:size]
+		} else {
+			shards[missing] = make([]byte, size)
+		}
+		l.xorGroup(shards, g, missing, shards[missing])
+	}
+
+	remaining := 0
+	for _, shard := range shards {
+		if len(shard) == 0 {
+			remaining++
+		}
+	}
+	return remaining, nil
+}
+
+// Reconstruct recreates all missing shards. Single losses within a local
+// group are repaired from the group alone; remaining data losses are
+// repaired with the global parities, after which any missing local
+// parities are recomputed.
+//
+// If too few shards are available to reconstruct, ErrTooFewShards is returned.
+func (l *LRC) Reconstruct(shards [][]byte) error {
+	remaining, err := l.ReconstructLocal(shards)
+	if err != nil || remaining == 0 {
+		return err
+	}
+
+	if l.globalParity > 0 {
+		global := l.globalShards(shards)
+		if err := l.global.Reconstruct(global); err != nil {
+			return err
+		}
+		copy(shards[:l.dataShards], global[:l.dataShards])
+		copy(shards[l.dataShards+l.localGroups:], global[l.dataShards:])
+	}
+
+	remaining, err = l.ReconstructLocal(shards)
+	if err != nil {
+		return err
+	}
+	if remaining > 0 {
+		return ErrTooFewShards
+	}
+	return nil
+}
+
+// Split splits data into the data shards of the LRC and allocates empty
+// local and global parity shards. See Encoder.Split for details.
+func (l *LRC) Split(data []byte) ([][]byte, error) {
+	global, err := l.global.Split(data)
+	if err != nil {
+		return nil, err
+	}
+	size := len(global[0])
+	shards := make([][]byte, 0, l.TotalShards())
+	shards = append(shards, global[:l.dataShards]...)
+	for g := 0; g < l.localGroups; g++ {
+		shards = append(shards, make([]byte, size))
+	}
+	return append(shards, global[l.dataShards:]...), nil
+}
+
+// Join writes the data segment of the shards to dst. See Encoder.Join for details.
+func (l *LRC) Join(dst io.Writer, shards [][]byte, outSize int) error {
+	if len(shards) < l.dataShards {
+		return ErrTooFewShards
+	}
+	return l.global.Join(dst, l.globalShards(shards), outSize)
+}
@@ -0,0 +1,159 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestLRC(t *testing.T) {
+	l, err := NewLRC(12, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.TotalShards() != 17 {
+		t.Fatalf("want 17 shards, got %d", l.TotalShards())
+	}
+
+	data := make([]byte, 12*1000+17)
+	fillRandom(data)
+	shards, err := l.Split(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Encode(shards); err != nil {
+		t.Fatal(err)
+	}
+	ok, err := l.Verify(shards)
+	if err != nil || !ok {
+		t.Fatal("verification failed", err)
+	}
+
+	// A single lost data shard only needs its local group.
+	set := l.RepairSet(5)
+	if len(set) != 4 {
+		t.Fatalf("want local repair set of 4 shards, got %v", set)
+	}
+	for _, idx := range set {
+		if l.groupOf(idx) != l.groupOf(5) {
+			t.Fatalf("repair set %v leaves group of shard 5", set)
+		}
+	}
+
+	// One loss per group is repaired with local parity only.
+	lost := copyShards(shards)
+	lost[1], lost[6], lost[l.DataShards()+2] = nil, nil, nil
+	remaining, err := l.ReconstructLocal(lost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining != 0 {
+		t.Fatalf("want all shards repaired locally, %d remaining", remaining)
+	}
+	assertShardsEqual(t, shards, lost)
+
+	// Multiple losses in one group fall back to global parity.
+	lost = copyShards(shards)
+	lost[0], lost[1], lost[l.DataShards()] = nil, nil, nil
+	remaining, err = l.ReconstructLocal(lost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining != 3 {
+		t.Fatalf("want 3 shards remaining, got %d", remaining)
+	}
+	if err := l.Reconstruct(lost); err != nil {
+		t.Fatal(err)
+	}
+	assertShardsEqual(t, shards, lost)
+
+	// Lost global parity.
+	lost = copyShards(shards)
+	lost[l.TotalShards()-1] = nil
+	if err := l.Reconstruct(lost); err != nil {
+		t.Fatal(err)
+	}
+	assertShardsEqual(t, shards, lost)
+
+	// Too many losses.
+	lost = copyShards(shards)
+	lost[0], lost[1], lost[2], lost[3] = nil, nil, nil, nil
+	if err := l.Reconstruct(lost); err != ErrTooFewShards {
+		t.Fatalf("want ErrTooFewShards, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := l.Join(&buf, shards, len(data)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatal("joined data mismatch")
+	}
+
+	shards[3][0]++
+	if ok, _ := l.Verify(shards); ok {
+		t.Fatal("verification should fail after corruption")
+	}
+}
+
+func TestLRCUnevenGroups(t *testing.T) {
+	l, err := NewLRC(7, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for g := 0; g < l.LocalGroups(); g++ {
+		total += len(l.Group(g)) - 1
+	}
+	if total != 7 {
+		t.Fatalf("groups cover %d data shards, want 7", total)
+	}
+
+	shards := make([][]byte, l.TotalShards())
+	for i := range shards {
+		shards[i] = make([]byte, 64)
+		if i < l.DataShards() {
+			rand.Read(shards[i])
+		}
+	}
+	if err := l.Encode(shards); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < l.TotalShards(); i++ {
+		lost := copyShards(shards)
+		lost[i] = nil
+		if err := l.Reconstruct(lost); err != nil {
+			t.Fatalf("shard %d: %v", i, err)
+		}
+		assertShardsEqual(t, shards, lost)
+	}
+}
+
+func TestNewLRCInvalid(t *testing.T) {
+	if _, err := NewLRC(4, 0, 2); err != ErrInvLRCGroups {
+		t.Errorf("want ErrInvLRCGroups, got %v", err)
+	}
+	if _, err := NewLRC(4, 5, 2); err != ErrInvLRCGroups {
+		t.Errorf("want ErrInvLRCGroups, got %v", err)
+	}
+	if _, err := NewLRC(0, 1, 2); err != ErrInvShardNum {
+		t.Errorf("want ErrInvShardNum, got %v", err)
+	}
+}
+
+func copyShards(shards [][]byte) [][]byte {
+	out := make([][]byte, len(shards))
+	for i := range shards {
+		out[i] = append([]byte(nil), shards[i]...)
+	}
+	return out
+}
+
+func assertShardsEqual(t *testing.T, want, got [][]byte) {
+	t.Helper()
+	for i := range want {
+		if !bytes.Equal(want[i], got[i]) {
+			t.Fatalf("shard %d mismatch", i)
+		}
+	}
+}
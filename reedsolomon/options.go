@@ -16,6 +16,7 @@ type options struct {
 	perRound      int
 
 	useGFNI, useAVX512, useAVX2, useSSSE3, useSSE2 bool
+	useNEON                                        bool
 	useJerasureMatrix                              bool
 	usePAR1Matrix                                  bool
 	useCauchy                                      bool
@@ -43,6 +44,10 @@ var defaultOptions = options{
 	useAVX2:   cpuid.CPU.Supports(cpuid.AVX2),
 	useAVX512: cpuid.CPU.Supports(cpuid.AVX512F, cpuid.AVX512BW, cpuid.AVX512VL),
 	useGFNI:   cpuid.CPU.Supports(cpuid.AVX512F, cpuid.GFNI, cpuid.AVX512DQ),
+	// NEON (ASIMD) is mandatory on arm64, but detection can fail on some
+	// operating systems. Only disable it when features were detected (FP)
+	// and ASIMD was explicitly not among them.
+	useNEON: runtime.GOARCH != "arm64" || cpuid.CPU.Supports(cpuid.ASIMD) || !cpuid.CPU.Has(cpuid.FP),
 }
 
 // leopardMode controls the use of leopard GF in encoding and decoding.
@@ -190,6 +195,47 @@ func WithGFNI(enabled bool) Option {
 	}
 }
 
+// WithNEON allows to enable/disable NEON (ASIMD) instructions on arm64.
+// If not set, NEON will be turned on or off automatically based on CPU ID information.
+// Ignored on other platforms.
+func WithNEON(enabled bool) Option {
+	return func(o *options) {
+		o.useNEON = enabled
+	}
+}
+
+// Kernel returns the name of the Galois field multiplication kernel that
+// will be used with the given options on this CPU: "gfni", "avx512", "avx2",
+// "ssse3", "neon", "vsx" or "generic".
+// It can be used to confirm that a node actually runs an accelerated path.
+func Kernel(opts ...Option) string {
+	o := defaultOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	switch {
+	case !pshufb:
+		return "generic"
+	case runtime.GOARCH == "arm64":
+		if o.useNEON {
+			return "neon"
+		}
+		return "generic"
+	case runtime.GOARCH == "ppc64le":
+		return "vsx"
+	case o.useGFNI:
+		return "gfni"
+	case o.useAVX512:
+		return "avx512"
+	case o.useAVX2:
+		return "avx2"
+	case o.useSSSE3:
+		return "ssse3"
+	default:
+		return "generic"
+	}
+}
+
 // WithJerasureMatrix causes the encoder to build the Reed-Solomon-Vandermonde
 // matrix in the same way as done by the Jerasure library.
 // The first row and column of the coding matrix only contains 1's in this method
@@ -146,6 +146,20 @@ type Extensions interface {
 	// aligned to reasonable memory sizes.
 	// Provide the size of each shard.
 	AllocAligned(each int) [][]byte
+
+	// SplitInto splits data into caller-provided shard buffers,
+	// typically obtained from AllocAligned and reused between calls.
+	//
+	// shards must have TotalShards entries. Each entry is resliced to the
+	// shard size; entries that are nil or lack capacity are replaced with
+	// buffers from AllocAligned.
+	// The data is copied into the data shards and the remainder of the
+	// last data shard is zeroed. Parity shards are resized but not cleared,
+	// since Encode overwrites them.
+	//
+	// There must be at least 1 byte otherwise ErrShortData will be
+	// returned.
+	SplitInto(data []byte, shards [][]byte) error
 }
 
 const (
@@ -1654,6 +1668,55 @@ func (r *reedSolomon) Split(data []byte) ([][]byte, error) {
 	return dst, nil
 }
 
+// SplitInto splits data into caller-provided shard buffers.
+// See Extensions.SplitInto for details.
+func (r *reedSolomon) SplitInto(data []byte, shards [][]byte) error {
+	return splitInto(data, shards, r.dataShards, r.totalShards, 1)
+}
+
+// splitInto copies data into shards, each sized to a multiple of multiple bytes.
+func splitInto(data []byte, shards [][]byte, dataShards, totalShards, multiple int) error {
+	if len(data) == 0 {
+		return ErrShortData
+	}
+	if len(shards) < totalShards {
+		return ErrTooFewShards
+	}
+	if len(shards) > totalShards {
+		return ErrInvalidInput
+	}
+
+	perShard := (len(data) + dataShards - 1) / dataShards
+	perShard = ((perShard + multiple - 1) / multiple) * multiple
+
+	// Allocate all missing buffers at once.
+	missing := 0
+	for _, shard := range shards {
+		if cap(shard) < perShard {
+			missing++
+		}
+	}
+	var alloc [][]byte
+	if missing > 0 {
+		alloc = AllocAligned(missing, perShard)
+	}
+	for i, shard := range shards {
+		if cap(shard) < perShard {
+			shards[i] = alloc[0]
+			alloc = alloc[1:]
+			continue
+		}
+		shards[i] = shard[:perShard]
+	}
+
+	for i := 0; i < dataShards; i++ {
+		n := copy(shards[i], data)
+		data = data[n:]
+		clear(shards[i][n:])
+	}
+	return nil
+}
+
 // ErrReconstructRequired is returned if too few data shards are intact and a
 // reconstruction is required before you can successfully join the shards.
 var ErrReconstructRequired = errors.New("reconstruction required as one or more required data shards are nil")
@@ -1999,6 +1999,64 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestSplitInto(t *testing.T) {
+	opts := [][]Option{
+		testOptions(),
+		append(testOptions(), WithLeopardGF(true)),
+		append(testOptions(), WithLeopardGF16(true)),
+	}
+	for i, opts := range opts {
+		t.Run("opt-"+strconv.Itoa(i), func(t *testing.T) {
+			for _, dp := range [][2]int{{1, 0}, {5, 1}, {12, 4}, {17, 3}} {
+				enc, _ := New(dp[0], dp[1], opts...)
+				ext := enc.(Extensions)
+
+				if err := ext.SplitInto(nil, make([][]byte, ext.TotalShards())); err != ErrShortData {
+					t.Errorf("expected %v, got %v", ErrShortData, err)
+				}
+				if err := ext.SplitInto([]byte{1}, make([][]byte, ext.TotalShards()-1)); err != ErrTooFewShards {
+					t.Errorf("expected %v, got %v", ErrTooFewShards, err)
+				}
+
+				// Buffers sized for the largest input are reused for smaller ones.
+				shards := ext.AllocAligned(4096)
+				first := &shards[0][0]
+				for _, size := range []int{2699, 1337, ext.DataShards()} {
+					data := make([]byte, size)
+					fillRandom(data)
+					if err := ext.SplitInto(data, shards); err != nil {
+						t.Fatal(err)
+					}
+					if &shards[0][0] != first {
+						t.Fatal("expected provided buffer to be reused")
+					}
+					if err := enc.Encode(shards); err != nil {
+						t.Fatal(err)
+					}
+					buf := new(bytes.Buffer)
+					if err := enc.Join(buf, shards, size); err != nil {
+						t.Fatal(err)
+					}
+					if !bytes.Equal(buf.Bytes(), data) {
+						t.Fatalf("size %d: joined data does not match", size)
+					}
+				}
+
+				// Missing buffers are allocated.
+				shards = make([][]byte, ext.TotalShards())
+				if err := ext.SplitInto(make([]byte, 100), shards); err != nil {
+					t.Fatal(err)
+				}
+				for _, shard := range shards {
+					if len(shard) == 0 || len(shard)%ext.ShardSizeMultiple() != 0 {
+						t.Fatalf("unexpected shard size %d", len(shard))
+					}
+				}
+			}
+		})
+	}
+}
+
 func TestSplitZero(t *testing.T) {
 	data := make([]byte, 512)
 	for _, opts := range testOpts() {
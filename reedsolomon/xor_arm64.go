@@ -7,8 +7,11 @@ func xorSliceNEON(in, out []byte)
 
 // simple slice xor
 func sliceXor(in, out []byte, o *options) {
-	xorSliceNEON(in, out)
-	done := (len(in) >> 5) << 5
+	var done int
+	if o.useNEON {
+		xorSliceNEON(in, out)
+		done = (len(in) >> 5) << 5
+	}
 
 	remain := len(in) - done
 	if remain > 0 {
@@ -0,0 +1,80 @@
+package defs
+
+import (
+	"context"
+
+	"github.com/bpfs/defs/downloads"
+	"github.com/bpfs/defs/uploads"
+)
+
+// RecoveryReports 获取启动时核对上传与下载任务状态的结果
+// 崩溃前声称正在传输的任务在启动时转为暂停，无法继续的任务转为失败
+// 返回值：
+//   - *uploads.RecoveryReport: 上传任务的核对结果
+//   - *downloads.RecoveryReport: 下载任务的核对结果
+func (fs *FS) RecoveryReports() (*uploads.RecoveryReport, *downloads.RecoveryReport) {
+	return fs.upload.RecoveryReport(), fs.download.RecoveryReport()
+}
+
+// GetUploadReport 获取文件上传完成时生成的完整性报告
+// 报告包含各片段的哈希、纠删码参数、存储节点及时间戳，并由所有者签名，可通过 Verify 独立验证
+// 参数：
+//   - fileID: string 文件唯一标识
+//
+// 返回值：
+//   - *uploads.IntegrityReport: 完整性报告
+//   - error: 报告不存在时返回包装了 errs.ErrNotFound 的错误
+func (fs *FS) GetUploadReport(fileID string) (*uploads.IntegrityReport, error) {
+	return uploads.LoadReport(fs.afe, fileID)
+}
+
+// GetTaskTimeline 获取上传任务的事件记录，包括创建、片段发送、节点拒绝、重试及状态变化
+// 事件随任务一起保存，节点重启后仍可查询，每个任务最多保留 uploads.TimelineCapacity 条
+// 参数：
+//   - taskID: string 任务唯一标识
+//
+// 返回值：
+//   - []uploads.TimelineEvent: 按时间顺序排列的事件
+//   - error: 任务不存在时返回包装了 errs.ErrTaskNotFound 的错误
+func (fs *FS) GetTaskTimeline(taskID string) ([]uploads.TimelineEvent, error) {
+	return fs.upload.GetTaskTimeline(taskID)
+}
+
+// AssetHealth 探测文件各片段的存储节点，评估文件当前的冗余状况
+// 参数：
+//   - ctx: context.Context 上下文，取消时中止探测
+//   - fileID: string 文件唯一标识
+//
+// 返回值：
+//   - *uploads.AssetHealth: 文件的冗余状况、健康等级及建议的修复操作
+//   - error: 文件的完整性报告不存在时返回包装了 errs.ErrNotFound 的错误
+func (fs *FS) AssetHealth(ctx context.Context, fileID string) (*uploads.AssetHealth, error) {
+	report, err := uploads.LoadReport(fs.afe, fileID)
+	if err != nil {
+		return nil, err
+	}
+	return uploads.CheckHealth(ctx, report, uploads.HostProber(fs.p2p.Host(), uploads.DefaultProbeTimeout)), nil
+}
+
+// QueryAssets 列出本节点上传的所有文件及其冗余状况
+// 参数：
+//   - ctx: context.Context 上下文，取消时中止探测
+//
+// 返回值：
+//   - []*uploads.AssetHealth: 各文件的冗余状况，按文件唯一标识排列
+//   - error: 读取完整性报告失败时返回错误
+func (fs *FS) QueryAssets(ctx context.Context) ([]*uploads.AssetHealth, error) {
+	reports, err := uploads.ListReports(fs.afe)
+	if err != nil {
+		return nil, err
+	}
+	prober := uploads.HostProber(fs.p2p.Host(), uploads.DefaultProbeTimeout)
+	assets := make([]*uploads.AssetHealth, 0, len(reports))
+	for _, report := range reports {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		assets = append(assets, uploads.CheckHealth(ctx, report, prober))
+	}
+	return assets, nil
+}
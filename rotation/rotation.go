@@ -0,0 +1,211 @@
+// Package rotation 在网络中传播节点身份的连续性记录
+// 本节点轮换身份时广播连续性记录，其他节点收到后将旧身份的地址、路由表条目与文件片段的存储关系延续到新身份。
+// 新节点加入或记录在广播时丢失的情况下，各节点会定期重新广播自身的身份链。
+package rotation
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/identity"
+	"github.com/bpfs/defs/network"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/peermode"
+	"github.com/bpfs/defs/supervise"
+	"github.com/bpfs/defs/util"
+	"github.com/bpfs/dep2p"
+	"github.com/bpfs/dep2p/pubsub"
+	"github.com/bpfs/dep2p/streams"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+)
+
+const (
+	// RepublishInterval 重新广播本节点身份链的间隔
+	RepublishInterval = time.Hour
+	// RepublishWindow 只重新广播在此时间内签发的连续性记录，更早的记录应已被各节点接收
+	RepublishWindow = 30 * 24 * time.Hour
+)
+
+// Service 节点身份轮换服务
+type Service struct {
+	ctx    context.Context    // 上下文用于管理协程的生命周期
+	cancel context.CancelFunc // 取消函数
+
+	opt    *opts.Options       // 文件存储选项配置
+	p2p    *dep2p.DeP2P        // 网络主机
+	pubsub *pubsub.DeP2PPubSub // 网络订阅
+}
+
+type NewServiceInput struct {
+	fx.In
+	LC         fx.Lifecycle
+	Ctx        context.Context       // 全局上下文
+	Opt        *opts.Options         // 文件存储选项配置
+	P2P        *dep2p.DeP2P          // 网络主机
+	PubSub     *pubsub.DeP2PPubSub   // 网络订阅
+	Supervisor *supervise.Supervisor // 后台任务的崩溃恢复
+}
+
+type NewServiceOutput struct {
+	fx.Out
+	Service *Service // 节点身份轮换
+}
+
+// NewService 创建并初始化一个新的 Service 实例
+// 参数：
+//   - input: NewServiceInput 用于初始化 Service 的输入结构体。
+//
+// 返回值：
+//   - NewServiceOutput: 包含 Service 的输出结构体。
+func NewService(input NewServiceInput) (out NewServiceOutput) {
+	ctx, cancel := context.WithCancel(input.Ctx)
+	s := &Service{
+		ctx:    ctx,
+		cancel: cancel,
+		opt:    input.Opt,
+		p2p:    input.P2P,
+		pubsub: input.PubSub,
+	}
+	out.Service = s
+
+	input.LC.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			// 收到新的连续性记录时延续旧身份的地址与路由
+			s.opt.GetIdentities().OnRotate(s.carryOver)
+
+			// 订阅连续性记录
+			if err := input.PubSub.SubscribeWithTopic(identity.PubSubIdentityTopic, network.PubSubHandler(identity.PubSubIdentityTopic, s.handleContinuityPubSub), true); err != nil {
+				logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+			}
+
+			input.Supervisor.Go("rotation", "run", func() { s.run() })
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			s.cancel()
+			return nil
+		},
+	})
+
+	return out
+}
+
+// Rotate 轮换本节点的身份，签署并广播连续性记录
+// 新身份在网络主机使用新私钥重新创建后才生效，重新启动时旧身份下的文件片段会迁移到新身份的目录
+// 参数：
+//   - reason: string 轮换原因
+//
+// 返回值：
+//   - crypto.PrivKey: 新的节点私钥，调用方需妥善保存并用其重新创建网络主机
+//   - *identity.Continuity: 连续性记录
+//   - error: 如果发生错误，返回错误信息
+func (s *Service) Rotate(reason string) (crypto.PrivKey, *identity.Continuity, error) {
+	self := s.p2p.Host().ID()
+	oldPriv := s.p2p.Host().Peerstore().PrivKey(self)
+	if oldPriv == nil {
+		return nil, nil, fmt.Errorf("%w: 无法获取本节点的私钥", errs.ErrInvalidArgument)
+	}
+	if next := s.opt.GetIdentities().Resolve(self); next != self {
+		return nil, nil, fmt.Errorf("%w: 本节点已轮换到身份 %s", errs.ErrInvalidArgument, next)
+	}
+
+	newPriv, c, err := identity.Rotate(oldPriv, reason)
+	if err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return nil, nil, err
+	}
+	if _, err := s.opt.GetIdentities().Add(c); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return nil, nil, err
+	}
+	if err := s.publish(c); err != nil {
+		// 记录已保存，下次重新广播时仍会发出
+		logrus.Warnf("[%s]广播连续性记录失败: %v", debug.WhereAmI(), err)
+	}
+	logrus.Infof("[%s]节点身份已从 %s 轮换到 %s", debug.WhereAmI(), c.OldID, c.NewID)
+	return newPriv, c, nil
+}
+
+// Chain 获取本节点的身份链，按从旧到新的顺序排列
+func (s *Service) Chain() []*identity.Continuity {
+	return s.opt.GetIdentities().Chain(s.p2p.Host().ID())
+}
+
+// publish 广播连续性记录
+func (s *Service) publish(c *identity.Continuity) error {
+	return network.SendPubSub(s.p2p, s.pubsub, identity.PubSubIdentityTopic, "identity", "", c)
+}
+
+// run 定期重新广播本节点的身份链
+func (s *Service) run() {
+	s.republish(time.Now())
+
+	ticker := time.NewTicker(RepublishInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.republish(now)
+		}
+	}
+}
+
+// republish 重新广播本节点身份链中近期签发的记录，包括已轮换但尚未使用新身份重新启动时的最新记录
+func (s *Service) republish(now time.Time) {
+	self := s.p2p.Host().ID()
+	chain := s.opt.GetIdentities().Chain(s.opt.GetIdentities().Resolve(self))
+	for _, c := range chain {
+		if now.Sub(time.Unix(c.IssuedAt, 0)) > RepublishWindow {
+			continue
+		}
+		if err := s.publish(c); err != nil {
+			logrus.Warnf("[%s]重新广播连续性记录失败: %v", debug.WhereAmI(), err)
+		}
+	}
+}
+
+// handleContinuityPubSub 处理其他节点广播的连续性记录
+func (s *Service) handleContinuityPubSub(res *streams.RequestMessage) {
+	if res.Message.Type != "identity" {
+		return
+	}
+	c := new(identity.Continuity)
+	if err := util.DecodeFromBytes(res.Payload, c); err != nil {
+		logrus.Errorf("[%s]解码错误: %v", debug.WhereAmI(), err)
+		return
+	}
+	// 签名在 Add 中验证，新记录通过 OnRotate 回调延续旧身份
+	if _, err := s.opt.GetIdentities().Add(c); err != nil {
+		logrus.Warnf("[%s]拒绝节点 %s 的连续性记录: %v", debug.WhereAmI(), c.OldID, err)
+	}
+}
+
+// carryOver 将旧身份的地址与公钥延续到新身份，并从路由表中移除旧身份
+func (s *Service) carryOver(c *identity.Continuity) {
+	if c.OldID == s.p2p.Host().ID() {
+		return
+	}
+	ps := s.p2p.Host().Peerstore()
+	if addrs := ps.Addrs(c.OldID); len(addrs) > 0 {
+		ps.AddAddrs(c.NewID, addrs, peerstore.RecentlyConnectedAddrTTL)
+	}
+	if pub, err := crypto.UnmarshalPublicKey(c.NewPubKey); err == nil {
+		if err := ps.AddPubKey(c.NewID, pub); err != nil {
+			logrus.Debugf("[%s]: %v", debug.WhereAmI(), err)
+		}
+	}
+	for _, mode := range []int{peermode.ModeClient, peermode.ModeServer} {
+		if table := s.p2p.RoutingTable(mode); table != nil {
+			table.RemovePeer(c.OldID)
+		}
+	}
+	logrus.Infof("[%s]节点 %s 已轮换到身份 %s", debug.WhereAmI(), c.OldID, c.NewID)
+}
@@ -0,0 +1,118 @@
+// Package scrub 在存储节点上后台校验已存储的文件片段，隔离损坏的片段并请求修复
+package scrub
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/script"
+	"github.com/bpfs/defs/segment"
+	"github.com/bpfs/defs/sign/ecdsa"
+	"github.com/bpfs/defs/util"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const version = "1.0.0"
+
+var (
+	// 损坏文件片段的修复请求，文件所有者或修复服务订阅
+	PubSubScrubRepairTopic = fmt.Sprintf("defs@pubsub/scrub/repair/%s", version)
+)
+
+// RepairRequest 存储节点发现文件片段损坏后发出的修复请求
+type RepairRequest struct {
+	FileID       string  // 文件唯一标识
+	SegmentID    string  // 文件片段的唯一标识
+	OwnerPubHash []byte  // 文件所有者的公钥哈希，片段损坏到无法解析时为空
+	Peer         peer.ID // 发现损坏的存储节点
+	Reason       string  // 损坏原因
+	DetectedAt   int64   // 发现损坏的时间戳
+}
+
+// RepairHandler 处理收到的修复请求
+type RepairHandler func(req *RepairRequest)
+
+// signedFields 文件片段中参与签名的字段，顺序与签名时一致
+var signedFields = []string{
+	"FILEID",          // 文件唯一标识
+	"CONTENTTYPE",     // MIME类型
+	"CHECKSUM",        // 文件的校验和
+	"SLICETABLE",      // 文件片段的哈希表
+	"SEGMENTID",       // 文件片段的唯一标识
+	"INDEX",           // 文件片段的索引
+	"SEGMENTCHECKSUM", // 分片的校验和
+	"CONTENT",         // 文件片段的内容(加密)
+}
+
+// codecFields 压缩的文件额外签名的字段，未压缩的文件片段没有这些段
+var codecFields = []string{
+	"CODEC",   // 分片前使用的压缩算法
+	"RAWSIZE", // 压缩前的文件大小
+}
+
+// VerifySegment 校验已存储的文件片段
+// 存储节点没有文件密钥，无法校验解密后的内容，因此使用片段中的公钥校验上传者对加密内容的签名
+// 参数：
+//   - fileID: string 片段所属文件的唯一标识
+//   - segmentID: string 文件片段的唯一标识
+//   - data: []byte 文件片段的内容
+//
+// 返回值：
+//   - []byte: 文件所有者的公钥哈希，片段损坏到无法解析时为空
+//   - error: 片段损坏时返回包装了 errs.ErrSegmentCorrupt 的错误
+func VerifySegment(fileID, segmentID string, data []byte) ([]byte, error) {
+	xref, err := segment.LoadXrefFromBuffer(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s 的交叉引用表无效: %v", errs.ErrSegmentCorrupt, segmentID, err)
+	}
+
+	fields := append([]string{"P2PKSCRIPT", "P2PKHSCRIPT", "SIGNATURE"}, signedFields...)
+	results, err := segment.ReadFieldsFromBytes(data, append(fields, codecFields...), xref)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s 的字段无法读取: %v", errs.ErrSegmentCorrupt, segmentID, err)
+	}
+	for field, result := range results {
+		if result.Error != nil && (field == "CODEC" || field == "RAWSIZE") {
+			continue // 未压缩的文件片段没有该段
+		}
+		if result.Error != nil {
+			return nil, fmt.Errorf("%w: %s 的字段 %s 无效: %v", errs.ErrSegmentCorrupt, segmentID, field, result.Error)
+		}
+	}
+
+	var owner []byte
+	if hash, err := script.ExtractPubKeyHashFromScript(results["P2PKHSCRIPT"].Data); err == nil {
+		owner = hash
+	}
+
+	if string(results["FILEID"].Data) != fileID || string(results["SEGMENTID"].Data) != segmentID {
+		return owner, fmt.Errorf("%w: %s 的标识与存储位置不匹配", errs.ErrSegmentCorrupt, segmentID)
+	}
+
+	pubKey, err := script.ExtractPubKeyFromP2PKScriptToECDSA(results["P2PKSCRIPT"].Data)
+	if err != nil {
+		return owner, fmt.Errorf("%w: %s 的公钥无效: %v", errs.ErrSegmentCorrupt, segmentID, err)
+	}
+
+	signed := make([]interface{}, 0, len(signedFields))
+	for _, field := range signedFields {
+		signed = append(signed, results[field].Data)
+	}
+	// 压缩的文件同时签名了压缩算法与压缩前的大小
+	for _, field := range codecFields {
+		if result := results[field]; result != nil && result.Error == nil {
+			signed = append(signed, result.Data)
+		}
+	}
+	merged, err := util.MergeFieldsForSigning(signed...)
+	if err != nil {
+		return owner, err
+	}
+
+	valid, err := ecdsa.VerifySignature(pubKey, merged, results["SIGNATURE"].Data)
+	if err != nil || !valid {
+		return owner, fmt.Errorf("%w: %s 的签名无效", errs.ErrSegmentCorrupt, segmentID)
+	}
+	return owner, nil
+}
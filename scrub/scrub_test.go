@@ -0,0 +1,207 @@
+package scrub
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/defs/script"
+	"github.com/bpfs/defs/segment"
+	sign "github.com/bpfs/defs/sign/ecdsa"
+	"github.com/bpfs/defs/util"
+	"github.com/bpfs/defs/wallets"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// newSegment 生成一个签名有效的文件片段
+func newSegment(t *testing.T, priv *ecdsa.PrivateKey, fileID, segmentID string) []byte {
+	t.Helper()
+	return writeSegment(t, signedSegment(t, priv, fileID, segmentID, nil))
+}
+
+// signedSegment 生成文件片段的字段并签名，codec 中的压缩信息一同写入并签名
+func signedSegment(t *testing.T, priv *ecdsa.PrivateKey, fileID, segmentID string, codec map[string][]byte) map[string][]byte {
+	t.Helper()
+
+	ecdhKey, err := priv.PublicKey.ECDH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2pk, err := script.NewScriptBuilder().AddData(ecdhKey.Bytes()).AddOp(script.OP_CHECKSIG).Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKeyHash, _ := wallets.PrivateKeyToPublicKeyHash(priv)
+	p2pkh, err := script.NewScriptBuilder().
+		AddOp(script.OP_DUP).AddOp(script.OP_HASH160).
+		AddData(pubKeyHash).
+		AddOp(script.OP_EQUALVERIFY).AddOp(script.OP_CHECKSIG).
+		Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := map[string][]byte{
+		"FILEID":          []byte(fileID),
+		"CONTENTTYPE":     []byte("text/plain"),
+		"CHECKSUM":        []byte("checksum"),
+		"SLICETABLE":      []byte("table"),
+		"SEGMENTID":       []byte(segmentID),
+		"INDEX":           {0},
+		"SEGMENTCHECKSUM": []byte("segment-checksum"),
+		"CONTENT":         []byte("encrypted content of the segment"),
+		"P2PKSCRIPT":      p2pk,
+		"P2PKHSCRIPT":     p2pkh,
+	}
+	signed := []interface{}{data["FILEID"], data["CONTENTTYPE"], data["CHECKSUM"], data["SLICETABLE"],
+		data["SEGMENTID"], data["INDEX"], data["SEGMENTCHECKSUM"], data["CONTENT"]}
+	if codec != nil {
+		data["CODEC"], data["RAWSIZE"] = codec["CODEC"], codec["RAWSIZE"]
+		signed = append(signed, data["CODEC"], data["RAWSIZE"])
+	}
+	merged, err := util.MergeFieldsForSigning(signed...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["SIGNATURE"], err = sign.SignData(priv, merged); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// writeSegment 将文件片段的字段写入文件并返回文件内容
+func writeSegment(t *testing.T, data map[string][]byte) []byte {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), string(data["SEGMENTID"]))
+	if err := segment.WriteFileSegment(path, data); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestVerifySegment(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := newSegment(t, priv, "file-1", "segment-1")
+
+	owner, err := VerifySegment("file-1", "segment-1", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKeyHash, _ := wallets.PrivateKeyToPublicKeyHash(priv)
+	if string(owner) != string(pubKeyHash) {
+		t.Fatal("所有者的公钥哈希不匹配")
+	}
+
+	if _, err := VerifySegment("file-2", "segment-1", data); !errors.Is(err, errs.ErrSegmentCorrupt) {
+		t.Fatalf("存储位置不匹配时应返回 ErrSegmentCorrupt, 实际 %v", err)
+	}
+}
+
+func TestVerifySegmentCodec(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawSize, _ := util.ToBytes[int64](4096)
+	data := signedSegment(t, priv, "file-1", "segment-1", map[string][]byte{"CODEC": []byte("gzip"), "RAWSIZE": rawSize})
+
+	if _, err := VerifySegment("file-1", "segment-1", writeSegment(t, data)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 删除或篡改签名的压缩信息后签名无效
+	stripped := make(map[string][]byte)
+	for k, v := range data {
+		if k != "CODEC" {
+			stripped[k] = v
+		}
+	}
+	if _, err := VerifySegment("file-1", "segment-1", writeSegment(t, stripped)); !errors.Is(err, errs.ErrSegmentCorrupt) {
+		t.Fatalf("删除压缩算法后应返回 ErrSegmentCorrupt, 实际 %v", err)
+	}
+	bigger, _ := util.ToBytes[int64](1 << 40)
+	data["RAWSIZE"] = bigger
+	if _, err := VerifySegment("file-1", "segment-1", writeSegment(t, data)); !errors.Is(err, errs.ErrSegmentCorrupt) {
+		t.Fatalf("篡改压缩前的大小后应返回 ErrSegmentCorrupt, 实际 %v", err)
+	}
+}
+
+func TestScrubQuarantinesCorruptSegments(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	afe := afero.NewMemMapFs()
+	opt := opts.DefaultOptions()
+	s := newScrubber(context.Background(), opt, afe, nil, nil)
+	s.self = peer.ID("storage-node")
+
+	var published []*RepairRequest
+	s.publish = func(req *RepairRequest) error {
+		published = append(published, req)
+		return nil
+	}
+	var repaired []*RepairRequest
+	s.OnRepair(func(req *RepairRequest) { repaired = append(repaired, req) })
+
+	dir := filepath.Join(paths.GetSlicePath(), s.self.String(), "file-1")
+	good := newSegment(t, priv, "file-1", "segment-good")
+	bad := newSegment(t, priv, "file-1", "segment-bad")
+	// 翻转片段内容中的一个字节，模拟静默的磁盘损坏
+	for i := range bad {
+		if string(bad[i:i+9]) == "encrypted" {
+			bad[i] ^= 0xff
+			break
+		}
+	}
+	if err := afero.WriteFile(afe, filepath.Join(dir, "segment-good"), good, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(afe, filepath.Join(dir, "segment-bad"), bad, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Scrub(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	report := s.Report()
+	if report.Passes != 1 || report.Checked != 2 || report.Corrupted != 1 {
+		t.Fatalf("校验结果不正确: %+v", report)
+	}
+	if len(report.Quarantined) != 1 || report.Quarantined[0].SegmentID != "segment-bad" || !report.Quarantined[0].Moved {
+		t.Fatalf("隔离记录不正确: %+v", report.Quarantined)
+	}
+
+	if ok, _ := afero.Exists(afe, filepath.Join(dir, "segment-bad")); ok {
+		t.Fatal("损坏的片段应移出存储目录")
+	}
+	if ok, _ := afero.Exists(afe, filepath.Join(paths.GetQuarantinePath(), "file-1", "segment-bad")); !ok {
+		t.Fatal("损坏的片段应移入隔离目录")
+	}
+	if ok, _ := afero.Exists(afe, filepath.Join(dir, "segment-good")); !ok {
+		t.Fatal("完好的片段不应被移动")
+	}
+
+	if len(published) != 1 || len(repaired) != 1 || published[0].SegmentID != "segment-bad" || published[0].Peer != s.self {
+		t.Fatalf("修复请求不正确: %+v", published)
+	}
+}
@@ -0,0 +1,351 @@
+package scrub
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/network"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/defs/provider"
+	"github.com/bpfs/defs/supervise"
+	"github.com/bpfs/dep2p"
+	"github.com/bpfs/dep2p/pubsub"
+	"github.com/bpfs/dep2p/streams"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+)
+
+// maxQuarantined 报告中保留的最近隔离的片段数量
+const maxQuarantined = 100
+
+// Quarantined 校验失败被隔离的文件片段
+type Quarantined struct {
+	FileID    string // 文件唯一标识
+	SegmentID string // 文件片段的唯一标识
+	Reason    string // 损坏原因
+	Moved     bool   // 是否已移入隔离目录，只读、演练模式下或文件被固定时保留原位
+	At        int64  // 发现损坏的时间戳
+}
+
+// Report 后台校验的累计结果
+type Report struct {
+	Passes       int            // 已完成的校验轮数
+	Checked      int64          // 已校验的片段数量
+	CheckedBytes int64          // 已校验的字节数
+	Corrupted    int64          // 发现损坏的片段数量
+	LastPassAt   int64          // 最近一轮校验完成的时间戳
+	Quarantined  []*Quarantined // 最近隔离的片段，最新的在末尾
+}
+
+// Scrubber 存储节点的后台校验服务
+// 按限定的速度依次读取已存储的文件片段并校验签名，损坏的片段移入隔离目录并广播修复请求
+type Scrubber struct {
+	ctx    context.Context    // 上下文用于管理协程的生命周期
+	cancel context.CancelFunc // 取消函数
+	mu     sync.Mutex         // 用于保护状态的互斥锁
+	passMu sync.Mutex         // 同一时间只进行一轮校验
+
+	opt    *opts.Options       // 文件存储选项配置
+	afe    afero.Afero         // 文件系统接口
+	p2p    *dep2p.DeP2P        // 网络主机
+	pubsub *pubsub.DeP2PPubSub // 网络订阅
+
+	self      peer.ID                        // 本节点的ID
+	publish   func(req *RepairRequest) error // 广播修复请求
+	report    Report                         // 累计结果
+	handlers  []RepairHandler                // 修复请求的处理函数
+	providers *provider.Notifier             // 文件片段变更通告
+}
+
+type NewScrubberInput struct {
+	fx.In
+	LC         fx.Lifecycle
+	Ctx        context.Context       // 全局上下文
+	Opt        *opts.Options         // 文件存储选项配置
+	Afe        afero.Afero           // 文件系统接口
+	P2P        *dep2p.DeP2P          // 网络主机
+	PubSub     *pubsub.DeP2PPubSub   // 网络订阅
+	Providers  *provider.Notifier    // 文件片段变更通告
+	Supervisor *supervise.Supervisor // 后台任务的崩溃恢复
+}
+
+type NewScrubberOutput struct {
+	fx.Out
+	Scrubber *Scrubber // 后台校验
+}
+
+// NewScrubber 创建并初始化一个新的 Scrubber 实例
+// 未设置后台校验参数时不会定时校验，但仍会接收其他节点的修复请求
+// 参数：
+//   - input: NewScrubberInput 用于初始化 Scrubber 的输入结构体。
+//
+// 返回值：
+//   - NewScrubberOutput: 包含 Scrubber 的输出结构体。
+func NewScrubber(input NewScrubberInput) (out NewScrubberOutput) {
+	s := newScrubber(input.Ctx, input.Opt, input.Afe, input.P2P, input.PubSub)
+	s.providers = input.Providers
+	out.Scrubber = s
+
+	input.LC.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			// 订阅修复请求
+			if err := s.pubsub.SubscribeWithTopic(PubSubScrubRepairTopic, network.PubSubHandler(PubSubScrubRepairTopic, s.handleRepairPubSub), true); err != nil {
+				logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+			}
+
+			if config := s.opt.GetScrubConfig(); config != nil {
+				input.Supervisor.Go("scrub", "periodic-scrub", func() { s.periodicScrub(config.Interval) })
+			}
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			s.cancel()
+			return nil
+		},
+	})
+
+	return out
+}
+
+// newScrubber 创建后台校验服务
+func newScrubber(ctx context.Context, opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, pubsub *pubsub.DeP2PPubSub) *Scrubber {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Scrubber{
+		ctx:    ctx,
+		cancel: cancel,
+		opt:    opt,
+		afe:    afe,
+		p2p:    p2p,
+		pubsub: pubsub,
+	}
+	if p2p != nil {
+		s.self = p2p.Host().ID()
+		s.publish = func(req *RepairRequest) error {
+			return network.SendSignedPubSub(p2p, pubsub, PubSubScrubRepairTopic, "repair", "", req)
+		}
+	}
+	return s
+}
+
+// OnRepair 注册修复请求的处理函数，文件所有者或修复服务据此重新上传损坏的片段
+// 参数：
+//   - handler: RepairHandler 修复请求的处理函数
+func (s *Scrubber) OnRepair(handler RepairHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers = append(s.handlers, handler)
+}
+
+// Report 获取后台校验的累计结果
+// 返回值：
+//   - Report: 累计结果
+func (s *Scrubber) Report() Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := s.report
+	report.Quarantined = make([]*Quarantined, len(s.report.Quarantined))
+	for i, q := range s.report.Quarantined {
+		c := *q
+		report.Quarantined[i] = &c
+	}
+	return report
+}
+
+// periodicScrub 定时进行一轮校验
+func (s *Scrubber) periodicScrub(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Scrub(s.ctx); err != nil && !errors.Is(err, context.Canceled) {
+				logrus.Warnf("[%s]后台校验文件片段失败: %v", debug.WhereAmI(), err)
+			}
+		}
+	}
+}
+
+// Scrub 立即校验一轮本节点存储的所有文件片段
+// 参数：
+//   - ctx: context.Context 上下文，可用于中止本轮校验
+//
+// 返回值：
+//   - error: 本轮校验被中止或无法遍历存储目录时返回错误
+func (s *Scrubber) Scrub(ctx context.Context) error {
+	s.passMu.Lock()
+	defer s.passMu.Unlock()
+
+	var rate int64
+	if config := s.opt.GetScrubConfig(); config != nil {
+		rate = config.BytesPerSecond
+	}
+
+	root := filepath.Join(paths.GetSlicePath(), s.self.String())
+	err := afero.Walk(s.afe, root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil // 跳过无法访问的文件
+		}
+		if info.IsDir() {
+			return ctx.Err()
+		}
+		fileID := filepath.Base(filepath.Dir(path))
+		if err := s.check(fileID, info.Name(), path); err != nil {
+			logrus.Warnf("[%s]读取文件片段 %s 失败: %v", debug.WhereAmI(), path, err)
+			return nil
+		}
+		return throttle(ctx, info.Size(), rate)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.report.Passes++
+	s.report.LastPassAt = time.Now().Unix()
+	s.mu.Unlock()
+	return nil
+}
+
+// check 校验一个文件片段，损坏时隔离并广播修复请求
+func (s *Scrubber) check(fileID, segmentID, path string) error {
+	data, err := afero.ReadFile(s.afe, path)
+	if err != nil {
+		return err
+	}
+
+	owner, verr := VerifySegment(fileID, segmentID, data)
+
+	s.mu.Lock()
+	s.report.Checked++
+	s.report.CheckedBytes += int64(len(data))
+	s.mu.Unlock()
+
+	if verr == nil {
+		return nil
+	}
+	if !errors.Is(verr, errs.ErrSegmentCorrupt) {
+		return verr
+	}
+	logrus.Errorf("[%s]文件片段已损坏: %v", debug.WhereAmI(), verr)
+
+	// 演练模式下只报告，不移动片段也不广播修复请求
+	if s.opt.GetDryRun() {
+		logrus.Infof("[%s]演练模式: 将隔离文件片段 %s", debug.WhereAmI(), segmentID)
+		s.record(fileID, segmentID, verr, false)
+		return nil
+	}
+
+	moved := false
+	if s.opt.GetReadOnly() {
+		logrus.Warnf("[%s]只读节点保留损坏的文件片段 %s", debug.WhereAmI(), segmentID)
+	} else if s.opt.GetPins().IsPinned(fileID) {
+		logrus.Warnf("[%s]文件 %s 已被固定，保留损坏的文件片段 %s", debug.WhereAmI(), fileID, segmentID)
+	} else if err := s.quarantine(fileID, segmentID, path); err != nil {
+		logrus.Errorf("[%s]隔离文件片段 %s 失败: %v", debug.WhereAmI(), segmentID, err)
+	} else {
+		moved = true
+		s.opt.GetCounters().AddStored(-int64(len(data)))
+		s.providers.Removed(fileID, segmentID)
+	}
+	s.record(fileID, segmentID, verr, moved)
+
+	req := &RepairRequest{
+		FileID:       fileID,
+		SegmentID:    segmentID,
+		OwnerPubHash: owner,
+		Peer:         s.self,
+		Reason:       verr.Error(),
+		DetectedAt:   time.Now().Unix(),
+	}
+	s.dispatch(req)
+	if s.publish != nil {
+		if err := s.publish(req); err != nil {
+			logrus.Errorf("[%s]广播修复请求失败: %v", debug.WhereAmI(), err)
+		}
+	}
+	return nil
+}
+
+// quarantine 将损坏的文件片段移入隔离目录，不再对外提供下载
+func (s *Scrubber) quarantine(fileID, segmentID, path string) error {
+	dir := filepath.Join(paths.GetQuarantinePath(), fileID)
+	if err := s.afe.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return s.afe.Rename(path, filepath.Join(dir, segmentID))
+}
+
+// record 记录损坏的文件片段
+func (s *Scrubber) record(fileID, segmentID string, reason error, moved bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.report.Corrupted++
+	s.report.Quarantined = append(s.report.Quarantined, &Quarantined{
+		FileID:    fileID,
+		SegmentID: segmentID,
+		Reason:    reason.Error(),
+		Moved:     moved,
+		At:        time.Now().Unix(),
+	})
+	if n := len(s.report.Quarantined); n > maxQuarantined {
+		s.report.Quarantined = append([]*Quarantined(nil), s.report.Quarantined[n-maxQuarantined:]...)
+	}
+}
+
+// handleRepairPubSub 处理其他存储节点广播的修复请求
+func (s *Scrubber) handleRepairPubSub(res *streams.RequestMessage) {
+	if res.Message.Sender == s.self.String() || res.Message.Type != "repair" {
+		return
+	}
+
+	// 修复请求由存储节点签名，以签名节点作为发现损坏的节点，避免冒充其他存储节点
+	req := new(RepairRequest)
+	sender, err := network.VerifyPubSub(res, PubSubScrubRepairTopic, req)
+	if err != nil {
+		logrus.Warnf("[%s]拒绝修复请求: %v", debug.WhereAmI(), err)
+		return
+	}
+	req.Peer = sender
+	s.dispatch(req)
+}
+
+// dispatch 将修复请求交给已注册的处理函数
+func (s *Scrubber) dispatch(req *RepairRequest) {
+	s.mu.Lock()
+	handlers := append([]RepairHandler(nil), s.handlers...)
+	s.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(req)
+	}
+}
+
+// throttle 按限定的速度等待读取 n 个字节所需的时间
+func throttle(ctx context.Context, n, rate int64) error {
+	if rate <= 0 || n <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(time.Duration(float64(n) / float64(rate) * float64(time.Second)))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
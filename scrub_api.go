@@ -0,0 +1,32 @@
+package defs
+
+import (
+	"context"
+
+	"github.com/bpfs/defs/scrub"
+)
+
+// ScrubSegments 立即校验一轮本节点存储的所有文件片段，损坏的片段被隔离并广播修复请求
+// 参数：
+//   - ctx: context.Context 上下文，可用于中止本轮校验
+//
+// 返回值：
+//   - error: 本轮校验被中止或无法遍历存储目录时返回错误
+func (fs *FS) ScrubSegments(ctx context.Context) error {
+	return fs.scrubber.Scrub(ctx)
+}
+
+// ScrubReport 获取后台校验的累计结果
+// 返回值：
+//   - scrub.Report: 累计结果，包括最近隔离的文件片段
+func (fs *FS) ScrubReport() scrub.Report {
+	return fs.scrubber.Report()
+}
+
+// OnRepairRequest 注册修复请求的处理函数
+// 存储节点发现文件片段损坏时广播修复请求，文件所有者可据此重新上传对应的片段
+// 参数：
+//   - handler: scrub.RepairHandler 修复请求的处理函数
+func (fs *FS) OnRepairRequest(handler scrub.RepairHandler) {
+	fs.scrubber.OnRepair(handler)
+}
@@ -220,6 +220,20 @@ func ReadFieldsFromBytes(data []byte, fieldTypes []string, xref *FileXref) (map[
 	return results, nil
 }
 
+// ReadFieldsFromReaderAt 从支持随机读取的数据源中批量读取多个字段，只读取指定字段的内容
+// 参数:
+//   - reader: io.ReaderAt 输入数据源
+//   - size: int64 数据源的大小
+//   - fieldTypes: []string 要读取的字段类型列表
+//   - xref: *FileXref 文件交叉引用表
+//
+// 返回值:
+//   - map[string]*SegmentReadResult 读取结果映射
+//   - error 可能的错误
+func ReadFieldsFromReaderAt(reader io.ReaderAt, size int64, fieldTypes []string, xref *FileXref) (map[string]*SegmentReadResult, error) {
+	return readSegmentInternal(io.NewSectionReader(reader, 0, size), fieldTypes, xref)
+}
+
 // //////////////////////////////////////////////////////////////////////
 const blockSize = 1024 // 搜索块的大小
 
@@ -249,6 +249,77 @@ func LoadXrefFromBuffer(reader io.Reader) (*FileXref, error) {
 	return xref, nil
 }
 
+// LoadXrefFromReaderAt 从支持随机读取的数据源加载 xref 表
+// 只从尾部向前读取 "startxref" 标记与 xref 表，不读取段的内容，适合只需要少量字段的大文件片段
+// 参数：
+//   - reader: io.ReaderAt 要读取的数据源
+//   - size: int64 数据源的大小
+//
+// 返回值：
+//   - *FileXref 解析后的 xref 表
+//   - error 可能出现的错误
+func LoadXrefFromReaderAt(reader io.ReaderAt, size int64) (*FileXref, error) {
+	// 从尾部开始逐块向前搜索 "startxref"，相邻块重叠以免标记跨越块边界
+	marker := []byte("startxref")
+	startXrefPos := int64(-1)
+	for end := size; end > 0 && startXrefPos < 0; end -= blockSize {
+		start := end - blockSize - int64(len(marker)-1)
+		if start < 0 {
+			start = 0
+		}
+		buffer := make([]byte, end-start)
+		if _, err := reader.ReadAt(buffer, start); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("读取数据失败: %v", err)
+		}
+		if index := bytes.LastIndex(buffer, marker); index != -1 {
+			startXrefPos = start + int64(index)
+		}
+	}
+	if startXrefPos < 0 {
+		return nil, fmt.Errorf("startxref not found")
+	}
+
+	// 读取并解析 xref 表的实际偏移量
+	var xrefOffset int64
+	if err := binary.Read(io.NewSectionReader(reader, startXrefPos+int64(len(marker)), 8), binary.BigEndian, &xrefOffset); err != nil {
+		return nil, err
+	}
+	if xrefOffset < 0 || xrefOffset > startXrefPos {
+		return nil, fmt.Errorf("xref 表的偏移量 %d 无效", xrefOffset)
+	}
+
+	// xref 表位于偏移量与 "startxref" 标记之间
+	section := io.NewSectionReader(reader, xrefOffset, startXrefPos-xrefOffset)
+	xref := NewFileXref()
+	for {
+		var segmentTypeLen uint32
+		if err := binary.Read(section, binary.BigEndian, &segmentTypeLen); err == io.EOF {
+			break
+		} else if segmentTypeLen > maxSegmentTypeLen {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		segmentTypeBytes := make([]byte, segmentTypeLen)
+		if _, err := io.ReadFull(section, segmentTypeBytes); err != nil {
+			return nil, err
+		}
+
+		segmentType := string(segmentTypeBytes)
+
+		entry := XrefEntry{}
+		if err := binary.Read(section, binary.BigEndian, &entry); err != nil {
+			return nil, err
+		}
+
+		xref.XrefTable[segmentType] = entry
+	}
+	xref.StartXref = xrefOffset
+
+	return xref, nil
+}
+
 // LoadXref 从文件加载 xref 表
 // 参数：
 //   - file: *os.File 要读取的文件对象
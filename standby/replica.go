@@ -0,0 +1,327 @@
+package standby
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/paths"
+)
+
+// Root 参与热备复制的一类元数据所在的目录
+type Root struct {
+	Name string      // 名称，作为复制条目的前缀
+	Fs   afero.Afero // 目录所在的文件系统
+	Dir  string      // 目录路径
+	Only []string    // 只复制目录下这些顶层条目，为空时复制整个目录
+}
+
+// Roots 返回参与热备复制的元数据目录：文件清单与报告、下载任务以及数据库目录中的元数据索引与键值存储
+// 参数：
+//   - afe: afero.Afero 根路径下的文件系统接口
+//
+// 返回值：
+//   - []Root: 元数据目录
+func Roots(afe afero.Afero) []Root {
+	return []Root{
+		{Name: "manifests", Fs: afe, Dir: paths.GetManifestPath()},
+		{Name: "downloads", Fs: afe, Dir: paths.GetDownloadPath(), Only: []string{"tasks"}},
+		{Name: "db", Fs: afero.NewOsFs(), Dir: paths.GetDBDir()},
+	}
+}
+
+// stamp 文件的大小与修改时间，二者不变时沿用上次计算的哈希
+type stamp struct {
+	size    int64
+	modTime time.Time
+	hash    string
+}
+
+// scanner 扫描元数据目录并计算各文件的哈希
+type scanner struct {
+	roots []Root
+	cache map[string]stamp // 条目到上次扫描结果的映射
+}
+
+// newScanner 创建元数据目录的扫描器
+func newScanner(roots []Root) *scanner {
+	return &scanner{roots: roots, cache: make(map[string]stamp)}
+}
+
+// scan 扫描所有元数据目录
+// 返回值：
+//   - map[string]string: 条目("目录名称/相对路径")到文件内容哈希的映射
+//   - error: 读取失败时返回错误
+func (sc *scanner) scan() (map[string]string, error) {
+	state := make(map[string]string)
+	cache := make(map[string]stamp, len(sc.cache))
+	for _, root := range sc.roots {
+		err := afero.Walk(root.Fs, root.Dir, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			rel, err := filepath.Rel(root.Dir, p)
+			if err != nil || rel == "." {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if !root.includes(rel) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			// 跳过目录与写入中的临时文件
+			if info.IsDir() || strings.HasSuffix(rel, ".tmp") {
+				return nil
+			}
+
+			key := root.Name + "/" + rel
+			if s, ok := sc.cache[key]; ok && s.size == info.Size() && s.modTime.Equal(info.ModTime()) {
+				cache[key], state[key] = s, s.hash
+				return nil
+			}
+			data, err := afero.ReadFile(root.Fs, p)
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			hash := hashOf(data)
+			cache[key], state[key] = stamp{size: info.Size(), modTime: info.ModTime(), hash: hash}, hash
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sc.cache = cache
+	return state, nil
+}
+
+// read 读取条目的内容
+func (sc *scanner) read(key string) ([]byte, error) {
+	root, rel, err := lookup(sc.roots, key)
+	if err != nil {
+		return nil, err
+	}
+	return afero.ReadFile(root.Fs, filepath.Join(root.Dir, filepath.FromSlash(rel)))
+}
+
+// includes 检查相对路径是否属于需要复制的条目
+func (r Root) includes(rel string) bool {
+	if len(r.Only) == 0 {
+		return true
+	}
+	top, _, _ := strings.Cut(rel, "/")
+	for _, name := range r.Only {
+		if top == name {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup 按条目找到所在的元数据目录与相对路径，并检查路径不会越出目录
+func lookup(roots []Root, key string) (Root, string, error) {
+	name, rel, ok := strings.Cut(key, "/")
+	if !ok || rel == "" || path.IsAbs(rel) || path.Clean(rel) != rel || rel == ".." || strings.HasPrefix(rel, "../") {
+		return Root{}, "", fmt.Errorf("无效的条目: %q", key)
+	}
+	for _, root := range roots {
+		if root.Name == name {
+			if !root.includes(rel) {
+				return Root{}, "", fmt.Errorf("条目 %q 不在复制范围内", key)
+			}
+			return root, rel, nil
+		}
+	}
+	return Root{}, "", fmt.Errorf("未知的元数据目录: %q", name)
+}
+
+// hashOf 计算内容的哈希
+func hashOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Digest 计算元数据状态的摘要，主节点与备用节点的摘要相同即表示二者一致
+// 参数：
+//   - state: map[string]string 条目到文件内容哈希的映射
+//
+// 返回值：
+//   - string: 状态摘要
+func Digest(state map[string]string) string {
+	keys := make([]string, 0, len(state))
+	for key := range state {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, key := range keys {
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write([]byte(state[key]))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// diff 计算从 from 到 to 的变化
+// 返回值：
+//   - []string: 新增或修改的条目，按名称排列
+//   - []string: 删除的条目，按名称排列
+func diff(from, to map[string]string) ([]string, []string) {
+	var changed, removed []string
+	for key, hash := range to {
+		if from[key] != hash {
+			changed = append(changed, key)
+		}
+	}
+	for key := range from {
+		if _, ok := to[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(removed)
+	return changed, removed
+}
+
+// Replica 备用节点保存的主节点元数据副本
+// 副本存放在单独的目录中，不影响备用节点自身的元数据；提升后在下次启动时替换本地的元数据
+type Replica struct {
+	afe   afero.Afero       // 文件系统接口
+	dir   string            // 副本所在的目录
+	roots []Root            // 副本中的元数据目录，与主节点的目录一一对应
+	state map[string]string // 条目到文件内容哈希的映射
+
+	Seq       uint64 // 最近一次应用的批次序号
+	AppliedAt int64  // 最近一次应用批次的时间戳
+	Diverged  bool   // 最近一次应用后摘要与主节点不一致，等待主节点完整重新同步
+}
+
+// OpenReplica 打开备用节点保存的副本，扫描已有的条目
+// 参数：
+//   - afe: afero.Afero 文件系统接口
+//   - dir: string 副本所在的目录
+//
+// 返回值：
+//   - *Replica: 副本
+//   - error: 扫描失败时返回错误
+func OpenReplica(afe afero.Afero, dir string) (*Replica, error) {
+	r := &Replica{afe: afe, dir: dir}
+	for _, name := range []string{"manifests", "downloads", "db"} {
+		r.roots = append(r.roots, Root{Name: name, Fs: afe, Dir: filepath.Join(dir, name)})
+	}
+	state, err := newScanner(r.roots).scan()
+	if err != nil {
+		return nil, err
+	}
+	r.state = state
+	return r, nil
+}
+
+// Digest 获取副本的状态摘要
+func (r *Replica) Digest() string {
+	return Digest(r.state)
+}
+
+// Len 获取副本中的条目数量
+func (r *Replica) Len() int {
+	return len(r.state)
+}
+
+// Apply 应用主节点推送的一批变更
+// 增量批次只能应用在与主节点记录一致的基线上；应用后的摘要与主节点不一致时标记为分歧，由主节点发起完整重新同步
+// 参数：
+//   - batch: *Batch 变更批次
+//   - now: time.Time 当前时间
+//
+// 返回值：
+//   - error: 基线不一致时返回 ErrBaseMismatch，应用后摘要不一致时返回 ErrDiverged，写入失败时返回错误
+func (r *Replica) Apply(batch *Batch, now time.Time) error {
+	if batch.Full {
+		if err := r.afe.RemoveAll(r.dir); err != nil {
+			return err
+		}
+		r.state = make(map[string]string)
+	} else if batch.Base != Digest(r.state) {
+		return ErrBaseMismatch
+	}
+
+	for _, change := range batch.Changes {
+		root, rel, err := lookup(r.roots, change.Key)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(root.Dir, filepath.FromSlash(rel))
+		if change.Removed {
+			if err := r.afe.Remove(target); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			delete(r.state, change.Key)
+			continue
+		}
+		if err := r.afe.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := afero.WriteFileAtomic(r.afe, target, change.Data, 0644); err != nil {
+			return err
+		}
+		r.state[change.Key] = hashOf(change.Data)
+	}
+
+	r.Seq, r.AppliedAt = batch.Seq, now.Unix()
+	r.Diverged = Digest(r.state) != batch.Digest
+	if r.Diverged {
+		return ErrDiverged
+	}
+	return nil
+}
+
+// Promote 将副本中的元数据复制到本地的元数据目录，覆盖同名的文件
+// 参数：
+//   - live: []Root 本地的元数据目录
+//
+// 返回值：
+//   - int: 复制的文件数量
+//   - error: 复制失败时返回错误
+func (r *Replica) Promote(live []Root) (int, error) {
+	keys := make([]string, 0, len(r.state))
+	for key := range r.state {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	sc := newScanner(r.roots)
+	for i, key := range keys {
+		data, err := sc.read(key)
+		if err != nil {
+			return i, err
+		}
+		root, rel, err := lookup(live, key)
+		if err != nil {
+			return i, err
+		}
+		target := filepath.Join(root.Dir, filepath.FromSlash(rel))
+		if err := root.Fs.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return i, err
+		}
+		if err := afero.WriteFileAtomic(root.Fs, target, data, 0644); err != nil {
+			return i, err
+		}
+	}
+	return len(keys), nil
+}
@@ -0,0 +1,112 @@
+package standby
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+)
+
+func TestReplica(t *testing.T) {
+	primaryFs := afero.NewMemMapFs()
+	roots := []Root{
+		{Name: "manifests", Fs: primaryFs, Dir: "primary/manifests"},
+		{Name: "downloads", Fs: primaryFs, Dir: "primary/downloads", Only: []string{"tasks"}},
+		{Name: "db", Fs: primaryFs, Dir: "primary/db"},
+	}
+	afero.WriteFile(primaryFs, "primary/manifests/a.report.json", []byte("a"), 0644)
+	afero.WriteFile(primaryFs, "primary/manifests/grants/g1", []byte("g1"), 0644)
+	afero.WriteFile(primaryFs, "primary/downloads/tasks", []byte("tasks"), 0644)
+	afero.WriteFile(primaryFs, "primary/downloads/peer/file-1/0", []byte("data"), 0644)
+	afero.WriteFile(primaryFs, "primary/db/index", []byte("index"), 0644)
+	afero.WriteFile(primaryFs, "primary/db/index.tmp", []byte("partial"), 0644)
+
+	s := &Service{scanner: newScanner(roots), acked: make(map[string]string), resync: true}
+	standbyFs := afero.NewMemMapFs()
+	replica, err := OpenReplica(standbyFs, "standby")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// sync 推送全部变更，maxBatch 较小时分多批推送
+	sync := func(maxBatch int) int {
+		current, err := s.scanner.scan()
+		if err != nil {
+			t.Fatal(err)
+		}
+		batches := 0
+		for {
+			batch, next, _, err := s.nextBatch(current, maxBatch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if batches > 0 && len(batch.Changes) == 0 {
+				return batches
+			}
+			if err := replica.Apply(batch, time.Now()); err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			s.acked, s.seq, s.resync = next, batch.Seq, false
+			batches++
+		}
+	}
+
+	// 完整同步，只复制元数据而不复制下载的数据和临时文件
+	if n := sync(2); n != 4 {
+		t.Fatalf("应分 4 批推送，实际 %d", n)
+	}
+	if replica.Len() != 4 || replica.Digest() != Digest(s.acked) {
+		t.Fatalf("副本与主节点不一致: %d 个条目", replica.Len())
+	}
+	if data, _ := afero.ReadFile(standbyFs, "standby/downloads/tasks"); string(data) != "tasks" {
+		t.Fatalf("下载任务的副本内容不符: %q", data)
+	}
+
+	// 增量同步修改与删除
+	afero.WriteFile(primaryFs, "primary/db/index", []byte("index-2"), 0644)
+	primaryFs.Remove("primary/manifests/grants/g1")
+	if n := sync(1 << 20); n != 1 {
+		t.Fatalf("增量变更应一批推送，实际 %d", n)
+	}
+	if replica.Len() != 3 || replica.Digest() != Digest(s.acked) {
+		t.Fatal("增量同步后副本与主节点不一致")
+	}
+
+	// 基线不一致的增量批次不会被应用
+	if err := replica.Apply(&Batch{Seq: 9, Base: "other", Digest: "other"}, time.Now()); !errors.Is(err, ErrBaseMismatch) {
+		t.Fatalf("应拒绝基线不一致的批次: %v", err)
+	}
+
+	// 应用后摘要不一致时标记为分歧，完整重新同步后恢复
+	base := replica.Digest()
+	if err := replica.Apply(&Batch{Seq: 9, Base: base, Digest: "other"}, time.Now()); !errors.Is(err, ErrDiverged) || !replica.Diverged {
+		t.Fatalf("应发现分歧: %v", err)
+	}
+	s.acked, s.seq, s.resync = make(map[string]string), 0, true
+	sync(1 << 20)
+	if replica.Diverged || replica.Digest() != Digest(s.acked) {
+		t.Fatal("完整重新同步后副本仍不一致")
+	}
+
+	// 越出副本目录的条目被拒绝
+	escape := &Batch{Seq: 10, Base: replica.Digest(), Changes: []*Change{{Key: "db/../../evil", Data: []byte("x")}}}
+	if err := replica.Apply(escape, time.Now()); err == nil {
+		t.Fatal("应拒绝越出目录的条目")
+	}
+
+	// 提升时副本覆盖本地的元数据
+	liveFs := afero.NewMemMapFs()
+	afero.WriteFile(liveFs, "live/db/index", []byte("stale"), 0644)
+	live := []Root{
+		{Name: "manifests", Fs: liveFs, Dir: "live/manifests"},
+		{Name: "downloads", Fs: liveFs, Dir: "live/downloads", Only: []string{"tasks"}},
+		{Name: "db", Fs: liveFs, Dir: "live/db"},
+	}
+	if n, err := replica.Promote(live); err != nil || n != 3 {
+		t.Fatalf("Promote = %d, %v", n, err)
+	}
+	if data, _ := afero.ReadFile(liveFs, "live/db/index"); string(data) != "index-2" {
+		t.Fatalf("提升后本地的元数据内容不符: %q", data)
+	}
+}
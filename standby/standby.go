@@ -0,0 +1,432 @@
+// Package standby 将主节点的任务与文件元数据持续复制到热备节点
+// 主节点定期扫描元数据目录，把新增、修改与删除的文件按批次推送到备用节点；每个批次携带应用前后的状态摘要，
+// 备用节点只在基线一致时应用增量，应用后的摘要不一致即视为分歧，由主节点发起完整重新同步。
+// 主节点的磁盘损坏时，提升备用节点，下次启动时副本替换本地的元数据，备用节点即带着接近最新的元数据接管。
+package standby
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/network"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/defs/supervise"
+	"github.com/bpfs/defs/util"
+	"github.com/bpfs/dep2p"
+	"github.com/bpfs/dep2p/streams"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+)
+
+const version = "1.0.0"
+
+var (
+	// 主节点向备用节点推送元数据变更
+	StreamStandbyReplicateProtocol = fmt.Sprintf("defs@stream/standby/replicate/%s", version)
+)
+
+var (
+	// ErrBaseMismatch 增量批次的基线与副本不一致
+	ErrBaseMismatch = errors.New("副本的基线与主节点不一致")
+
+	// ErrDiverged 应用批次后副本的摘要与主节点不一致
+	ErrDiverged = errors.New("副本与主节点的元数据不一致")
+)
+
+// 响应码
+const (
+	codeBaseMismatch int32 = 6607 // 基线不一致，主节点应完整重新同步
+	codeDiverged     int32 = 6606 // 应用后摘要不一致，主节点应完整重新同步
+)
+
+// Change 单个元数据文件的变更
+type Change struct {
+	Key     string // 条目，"目录名称/相对路径"
+	Data    []byte // 文件内容，删除时为空
+	Removed bool   // 文件是否已删除
+}
+
+// Batch 主节点推送的一批变更
+type Batch struct {
+	Seq     uint64    // 批次序号，完整重新同步时从 1 开始
+	Full    bool      // 是否为完整重新同步的第一批，备用节点应先清空副本
+	Base    string    // 应用前主节点记录的副本摘要
+	Digest  string    // 应用后副本应有的摘要
+	Changes []*Change // 变更，按条目排列
+}
+
+// Status 热备复制的状态
+type Status struct {
+	Role string // 本节点的角色，primary、standby 或两者兼有时为 primary+standby
+
+	// 作为主节点
+	Standby   peer.ID // 备用节点
+	Seq       uint64  // 备用节点已确认的批次序号
+	Pending   int     // 上次扫描时尚未推送的变更数量
+	SyncedAt  int64   // 备用节点最近一次确认的时间戳
+	Lag       int64   // 距备用节点最近一次确认的秒数
+	Resyncs   int     // 完整重新同步的次数
+	LastError string  // 最近一次推送失败的原因
+
+	// 作为备用节点
+	Primary   peer.ID // 主节点
+	Applied   uint64  // 已应用的批次序号
+	AppliedAt int64   // 最近一次应用批次的时间戳
+	Entries   int     // 副本中的文件数量
+	Digest    string  // 副本的状态摘要
+	Diverged  bool    // 副本是否与主节点不一致
+	Promoted  bool    // 是否已请求提升，下次启动时生效
+}
+
+// Service 元数据热备复制服务
+type Service struct {
+	ctx    context.Context    // 上下文用于管理协程的生命周期
+	cancel context.CancelFunc // 取消函数
+	mu     sync.Mutex         // 用于保护推送状态的互斥锁
+
+	opt *opts.Options // 文件存储选项配置
+	afe afero.Afero   // 文件系统接口
+	p2p *dep2p.DeP2P  // 网络主机
+
+	// 作为主节点
+	scanner *scanner          // 元数据目录扫描器
+	acked   map[string]string // 备用节点已确认的状态
+	seq     uint64            // 备用节点已确认的批次序号
+	resync  bool              // 下一批是否为完整重新同步
+	status  Status            // 推送状态
+
+	// 作为备用节点
+	replicaMu sync.Mutex // 用于保护副本的互斥锁，与推送互不阻塞
+	replica   *Replica   // 主节点元数据的副本
+}
+
+type NewServiceInput struct {
+	fx.In
+	LC         fx.Lifecycle
+	Ctx        context.Context       // 全局上下文
+	Opt        *opts.Options         // 文件存储选项配置
+	Afe        afero.Afero           // 文件系统接口
+	P2P        *dep2p.DeP2P          // 网络主机
+	Supervisor *supervise.Supervisor // 后台任务的崩溃恢复
+}
+
+type NewServiceOutput struct {
+	fx.Out
+	Standby *Service // 元数据热备复制
+}
+
+// NewService 创建元数据热备复制服务，未设置热备复制策略时不做任何操作
+// 参数：
+//   - input: NewServiceInput 用于初始化 Service 的输入结构体。
+//
+// 返回值：
+//   - NewServiceOutput: 包含 Service 的输出结构体。
+func NewService(input NewServiceInput) (out NewServiceOutput) {
+	ctx, cancel := context.WithCancel(input.Ctx)
+	s := &Service{
+		ctx:     ctx,
+		cancel:  cancel,
+		opt:     input.Opt,
+		afe:     input.Afe,
+		p2p:     input.P2P,
+		scanner: newScanner(Roots(input.Afe)),
+		acked:   make(map[string]string),
+		resync:  true,
+	}
+	out.Standby = s
+
+	policy := input.Opt.GetStandbyPolicy()
+	if policy == nil {
+		return out
+	}
+
+	input.LC.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			if policy.Primary != "" {
+				replica, err := OpenReplica(input.Afe, replicaDir())
+				if err != nil {
+					logrus.Errorf("[%s]加载元数据副本失败: %v", debug.WhereAmI(), err)
+					return err
+				}
+				s.replica = replica
+
+				// 注册接收主节点推送的元数据变更
+				streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamStandbyReplicateProtocol), network.HandlerWithLimits(StreamStandbyReplicateProtocol, network.HandlerWithRW(s.handleReplicate)))
+			}
+			if policy.Standby != "" {
+				input.Supervisor.Go("standby", "run", func() { s.run(policy) })
+			}
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			s.cancel()
+			return nil
+		},
+	})
+
+	return out
+}
+
+// replicaDir 备用节点保存副本的目录
+func replicaDir() string {
+	return filepath.Join(paths.GetFilesPath(), "standby")
+}
+
+// promoteMarker 请求提升的标记文件，存在时下次启动用副本替换本地的元数据
+func promoteMarker() string {
+	return filepath.Join(paths.GetFilesPath(), "standby.promote")
+}
+
+// run 按间隔向备用节点推送变更
+func (s *Service) run(policy *opts.StandbyPolicy) {
+	ticker := time.NewTicker(policy.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Sync(s.ctx); err != nil {
+				logrus.Warnf("[%s]向备用节点 %s 推送元数据失败: %v", debug.WhereAmI(), policy.Standby, err)
+			}
+		}
+	}
+}
+
+// Sync 立即把尚未确认的变更推送到备用节点
+// 没有变更时也推送一个空批次，备用节点借此核对副本的摘要，发现分歧
+// 参数：
+//   - ctx: context.Context 上下文，取消时中止推送
+//
+// 返回值：
+//   - error: 未设置备用节点时返回包装了 errs.ErrInvalidArgument 的错误，推送失败时返回节点错误
+func (s *Service) Sync(ctx context.Context) error {
+	policy := s.opt.GetStandbyPolicy()
+	if policy == nil || policy.Standby == "" {
+		return fmt.Errorf("%w: 未设置备用节点", errs.ErrInvalidArgument)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.scanner.scan()
+	if err != nil {
+		return err
+	}
+
+	resynced := false
+	for first := true; ; first = false {
+		batch, next, pending, err := s.nextBatch(current, policy.MaxBatch)
+		if err != nil {
+			return err
+		}
+		s.status.Pending = pending
+		if !first && len(batch.Changes) == 0 {
+			return nil
+		}
+
+		err = s.push(ctx, policy.Standby, batch)
+		var rejected *errs.PeerError
+		switch {
+		case err == nil:
+			s.acked, s.seq, s.resync = next, batch.Seq, false
+			s.status.SyncedAt, s.status.LastError = time.Now().Unix(), ""
+			s.status.Pending -= len(batch.Changes)
+		case !resynced && errors.As(err, &rejected) && (rejected.Code == codeBaseMismatch || rejected.Code == codeDiverged):
+			// 备用节点的副本与记录不一致，下一批完整重新同步
+			logrus.Warnf("[%s]备用节点 %s 的副本与主节点不一致，重新完整同步: %v", debug.WhereAmI(), policy.Standby, err)
+			s.acked, s.seq, s.resync, resynced = make(map[string]string), 0, true, true
+			s.status.Resyncs++
+			s.status.LastError = err.Error()
+			continue
+		default:
+			s.status.LastError = err.Error()
+			return err
+		}
+	}
+}
+
+// nextBatch 生成下一批变更
+// 返回值：
+//   - *Batch: 变更批次
+//   - map[string]string: 备用节点应用后的状态
+//   - int: 尚未推送的变更数量
+//   - error: 读取失败时返回错误
+func (s *Service) nextBatch(current map[string]string, maxBatch int) (*Batch, map[string]string, int, error) {
+	changed, removed := diff(s.acked, current)
+	batch := &Batch{Seq: s.seq + 1, Full: s.resync, Base: Digest(s.acked)}
+	next := make(map[string]string, len(s.acked))
+	for key, hash := range s.acked {
+		next[key] = hash
+	}
+
+	for _, key := range removed {
+		batch.Changes = append(batch.Changes, &Change{Key: key, Removed: true})
+		delete(next, key)
+	}
+	size := 0
+	for _, key := range changed {
+		data, err := s.scanner.read(key)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		// 每批至少包含一个文件，超过单个批次大小的文件单独推送
+		if size > 0 && size+len(data) > maxBatch {
+			break
+		}
+		size += len(data)
+		batch.Changes = append(batch.Changes, &Change{Key: key, Data: data})
+		// 文件可能在扫描后又被修改，以实际推送的内容为准
+		next[key] = hashOf(data)
+		current[key] = next[key]
+	}
+	batch.Digest = Digest(next)
+	return batch, next, len(changed) + len(removed), nil
+}
+
+// push 向备用节点推送一批变更
+func (s *Service) push(ctx context.Context, receiver peer.ID, batch *Batch) error {
+	res, err := network.SendStreamContext(ctx, s.p2p, StreamStandbyReplicateProtocol, "", receiver, batch)
+	if err != nil {
+		return errs.Unreachable(receiver, StreamStandbyReplicateProtocol, err)
+	}
+	if res == nil {
+		return errs.Unreachable(receiver, StreamStandbyReplicateProtocol, nil)
+	}
+	if res.Code != 200 {
+		return errs.Rejected(receiver, StreamStandbyReplicateProtocol, res.Code, res.Msg)
+	}
+	return nil
+}
+
+// handleReplicate 处理主节点推送的元数据变更
+// 请求的 Sender 为流连接上经过认证的对方节点ID，只接受配置的主节点推送的变更
+func (s *Service) handleReplicate(req *streams.RequestMessage, res *streams.ResponseMessage) (int32, string) {
+	policy := s.opt.GetStandbyPolicy()
+	if policy == nil || policy.Primary == "" || req.Message.Sender != policy.Primary.String() {
+		return 403, "不是本节点的主节点"
+	}
+	if s.opt.GetReadOnly() {
+		return 6610, "只读节点不接受写入"
+	}
+	batch := new(Batch)
+	if err := util.DecodeFromBytes(req.Payload, batch); err != nil {
+		logrus.Errorf("[%s]解码错误: %v", debug.WhereAmI(), err)
+		return 6603, "解码错误"
+	}
+
+	s.replicaMu.Lock()
+	defer s.replicaMu.Unlock()
+	switch err := s.replica.Apply(batch, time.Now()); {
+	case err == nil:
+		return 200, "成功"
+	case errors.Is(err, ErrBaseMismatch):
+		return codeBaseMismatch, err.Error()
+	case errors.Is(err, ErrDiverged):
+		logrus.Warnf("[%s]副本与主节点 %s 的元数据不一致，等待完整重新同步", debug.WhereAmI(), policy.Primary)
+		return codeDiverged, err.Error()
+	default:
+		logrus.Errorf("[%s]应用主节点的元数据变更失败: %v", debug.WhereAmI(), err)
+		// 副本可能只应用了一部分，要求完整重新同步
+		s.replica.Diverged = true
+		return codeDiverged, err.Error()
+	}
+}
+
+// Status 获取热备复制的状态
+// 返回值：
+//   - *Status: 热备复制的状态，未设置热备复制策略时返回 nil
+func (s *Service) Status() *Status {
+	policy := s.opt.GetStandbyPolicy()
+	if policy == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	status := s.status
+	status.Standby, status.Primary, status.Seq = policy.Standby, policy.Primary, s.seq
+	switch {
+	case policy.Standby != "" && policy.Primary != "":
+		status.Role = "primary+standby"
+	case policy.Standby != "":
+		status.Role = "primary"
+	default:
+		status.Role = "standby"
+	}
+	if status.SyncedAt > 0 {
+		status.Lag = time.Now().Unix() - status.SyncedAt
+	}
+	s.mu.Unlock()
+
+	s.replicaMu.Lock()
+	defer s.replicaMu.Unlock()
+	if r := s.replica; r != nil {
+		status.Applied, status.AppliedAt = r.Seq, r.AppliedAt
+		status.Entries, status.Digest, status.Diverged = r.Len(), r.Digest(), r.Diverged
+	}
+	if exists, _ := afero.Exists(s.afe, promoteMarker()); exists {
+		status.Promoted = true
+	}
+	return &status
+}
+
+// Promote 请求将备用节点提升为主节点，下次启动时用副本替换本地的元数据
+// 元数据在启动时由各个存储加载，运行中替换会被内存中的状态覆盖，因此替换推迟到下次启动、加载存储之前进行
+// 参数：
+//   - force: bool 副本与主节点不一致或为空时是否仍然提升
+//
+// 返回值：
+//   - error: 本节点不是备用节点时返回包装了 errs.ErrInvalidArgument 的错误，副本不可用时返回错误
+func (s *Service) Promote(force bool) error {
+	s.replicaMu.Lock()
+	defer s.replicaMu.Unlock()
+
+	if s.replica == nil {
+		return fmt.Errorf("%w: 本节点不是备用节点", errs.ErrInvalidArgument)
+	}
+	if !force {
+		if s.replica.Len() == 0 {
+			return fmt.Errorf("%w: 副本为空", errs.ErrNotFound)
+		}
+		if s.replica.Diverged {
+			return ErrDiverged
+		}
+	}
+	return afero.WriteFile(s.afe, promoteMarker(), []byte(s.replica.Digest()), 0644)
+}
+
+// ApplyPromotion 如果已请求提升，则用副本替换本地的元数据，应在加载各个存储之前调用
+// 参数：
+//   - afe: afero.Afero 根路径下的文件系统接口
+//
+// 返回值：
+//   - int: 替换的文件数量，未请求提升时为 0
+//   - error: 替换失败时返回错误，标记保留以便下次启动重试
+func ApplyPromotion(afe afero.Afero) (int, error) {
+	if exists, _ := afero.Exists(afe, promoteMarker()); !exists {
+		return 0, nil
+	}
+	replica, err := OpenReplica(afe, replicaDir())
+	if err != nil {
+		return 0, err
+	}
+	n, err := replica.Promote(Roots(afe))
+	if err != nil {
+		return n, err
+	}
+	if err := afe.Remove(promoteMarker()); err != nil {
+		return n, err
+	}
+	return n, nil
+}
@@ -0,0 +1,35 @@
+package defs
+
+import (
+	"context"
+
+	"github.com/bpfs/defs/standby"
+)
+
+// SyncStandby 立即把尚未确认的元数据变更推送到备用节点，而不必等待下一次推送
+// 参数：
+//   - ctx: context.Context 上下文，取消时中止推送
+//
+// 返回值：
+//   - error: 未设置备用节点时返回包装了 errs.ErrInvalidArgument 的错误，推送失败时返回节点错误
+func (fs *FS) SyncStandby(ctx context.Context) error {
+	return fs.standby.Sync(ctx)
+}
+
+// StandbyStatus 获取元数据热备复制的状态，包括备用节点的确认进度与副本是否与主节点一致
+// 返回值：
+//   - *standby.Status: 热备复制的状态，未设置热备复制策略时返回 nil
+func (fs *FS) StandbyStatus() *standby.Status {
+	return fs.standby.Status()
+}
+
+// PromoteStandby 将本节点从备用节点提升为主节点
+// 副本在下次启动、加载各个存储之前替换本地的元数据，调用后应重启节点
+// 参数：
+//   - force: bool 副本与主节点不一致或为空时是否仍然提升
+//
+// 返回值：
+//   - error: 本节点不是备用节点或副本不可用时返回错误
+func (fs *FS) PromoteStandby(force bool) error {
+	return fs.standby.Promote(force)
+}
@@ -0,0 +1,137 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	// bandwidthAlpha 每个新采样在平滑速度中的权重
+	bandwidthAlpha = 0.3
+	// bandwidthSamples 置信度达到约 63% 所需的采样数量
+	bandwidthSamples = 3
+	// bandwidthStale 估计的时效，超过该时长未更新的估计置信度按 exp(-Δt/bandwidthStale) 衰减
+	bandwidthStale = 10 * time.Minute
+)
+
+// peerBandwidth 单个节点的带宽估计
+type peerBandwidth struct {
+	rate    float64   // 平滑后的速度，单位为字节/秒
+	samples int       // 采样数量
+	last    time.Time // 最近一次采样的时间
+}
+
+// Bandwidth 各节点的带宽估计，由上传与下载共同采样
+// 上传选择存储节点与下载选择片段来源时共享同一份估计，避免各自维护片面的视图
+type Bandwidth struct {
+	mu    sync.RWMutex
+	peers map[peer.ID]*peerBandwidth // 节点到带宽估计的映射
+	now   func() time.Time           // 当前时间，便于测试
+}
+
+// NewBandwidth 创建并初始化一个新的 Bandwidth 实例
+func NewBandwidth() *Bandwidth {
+	return &Bandwidth{
+		peers: make(map[peer.ID]*peerBandwidth),
+		now:   time.Now,
+	}
+}
+
+// Record 记录一次与节点之间的传输
+// 参数：
+//   - p: peer.ID 对端节点
+//   - bytes: int 传输的字节数
+//   - elapsed: time.Duration 传输耗时
+func (b *Bandwidth) Record(p peer.ID, bytes int, elapsed time.Duration) {
+	if b == nil || bytes <= 0 || elapsed <= 0 {
+		return
+	}
+	rate := float64(bytes) / elapsed.Seconds()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	pb, ok := b.peers[p]
+	if !ok {
+		b.peers[p] = &peerBandwidth{rate: rate, samples: 1, last: b.now()}
+		return
+	}
+	pb.rate += bandwidthAlpha * (rate - pb.rate)
+	pb.samples++
+	pb.last = b.now()
+}
+
+// Estimate 获取节点的带宽估计
+// 参数：
+//   - p: peer.ID 对端节点
+//
+// 返回值：
+//   - float64: 平滑后的速度，单位为字节/秒，没有采样时为 0
+//   - float64: 置信度，取值 [0, 1)，随采样数量增加、随估计过时降低
+func (b *Bandwidth) Estimate(p peer.ID) (float64, float64) {
+	if b == nil {
+		return 0, 0
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.estimate(p)
+}
+
+// estimate 获取节点的带宽估计，调用方需持有读锁
+func (b *Bandwidth) estimate(p peer.ID) (float64, float64) {
+	pb, ok := b.peers[p]
+	if !ok {
+		return 0, 0
+	}
+	confidence := 1 - math.Exp(-float64(pb.samples)/bandwidthSamples)
+	if age := b.now().Sub(pb.last); age > 0 {
+		confidence *= math.Exp(-age.Seconds() / bandwidthStale.Seconds())
+	}
+	return pb.rate, confidence
+}
+
+// Rank 按估计的带宽从高到低重排节点，估计相同的节点保持原有顺序
+// 每个节点的得分为按置信度在自身估计与所有已知节点的平均速度之间插值，
+// 因此没有采样的节点排在已知较快与已知较慢的节点之间
+// 参数：
+//   - peers: []peer.ID 待排序的节点，原地重排
+func (b *Bandwidth) Rank(peers []peer.ID) {
+	if b == nil || len(peers) < 2 {
+		return
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if len(b.peers) == 0 {
+		return
+	}
+
+	var prior float64
+	for _, pb := range b.peers {
+		prior += pb.rate
+	}
+	prior /= float64(len(b.peers))
+
+	scores := make(map[peer.ID]float64, len(peers))
+	for _, p := range peers {
+		rate, confidence := b.estimate(p)
+		scores[p] = confidence*rate + (1-confidence)*prior
+	}
+	sort.SliceStable(peers, func(i, j int) bool {
+		return scores[peers[i]] > scores[peers[j]]
+	})
+}
+
+// Forget 删除节点的带宽估计，用于节点离开网络时
+// 参数：
+//   - p: peer.ID 对端节点
+func (b *Bandwidth) Forget(p peer.ID) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	delete(b.peers, p)
+	b.mu.Unlock()
+}
@@ -0,0 +1,47 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+)
+
+func TestBandwidth(t *testing.T) {
+	now := time.Now()
+	b := NewBandwidth()
+	b.now = func() time.Time { return now }
+
+	fast, slow, unknown := test.RandPeerIDFatal(t), test.RandPeerIDFatal(t), test.RandPeerIDFatal(t)
+	for i := 0; i < 5; i++ {
+		b.Record(fast, 1<<20, time.Second)
+		b.Record(slow, 1<<10, time.Second)
+	}
+	b.Record(fast, 0, time.Second) // 空采样被忽略
+
+	rate, confidence := b.Estimate(fast)
+	if rate != 1<<20 || confidence < 0.8 {
+		t.Fatalf("Estimate(fast) = %v, %v", rate, confidence)
+	}
+	if rate, confidence := b.Estimate(unknown); rate != 0 || confidence != 0 {
+		t.Fatalf("Estimate(unknown) = %v, %v", rate, confidence)
+	}
+
+	peers := []peer.ID{slow, unknown, fast}
+	b.Rank(peers)
+	if peers[0] != fast || peers[1] != unknown || peers[2] != slow {
+		t.Fatalf("Rank = %v", peers)
+	}
+
+	// 过时的估计置信度下降
+	now = now.Add(time.Hour)
+	if _, c := b.Estimate(fast); c >= confidence/10 {
+		t.Fatalf("过时估计的置信度 = %v", c)
+	}
+
+	b.Forget(fast)
+	if rate, _ := b.Estimate(fast); rate != 0 {
+		t.Fatal("Forget 后仍有估计")
+	}
+}
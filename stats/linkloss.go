@@ -0,0 +1,91 @@
+package stats
+
+import (
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	// linkLossAlpha 每次传输在平滑丢包率中的权重
+	linkLossAlpha = 0.3
+	// linkLossStale 丢包率估计的时效，超过该时长未更新的估计视为未知
+	linkLossStale = 30 * time.Minute
+)
+
+// peerLinkLoss 单个节点链路的丢包率估计
+type peerLinkLoss struct {
+	loss float64   // 平滑后的丢包率
+	last time.Time // 最近一次采样的时间
+}
+
+// LinkLoss 各节点链路的丢包率估计，由数据报传输的重传统计采样
+// 用于识别高丢包的链路，对其启用前向纠错
+type LinkLoss struct {
+	mu    sync.RWMutex
+	peers map[peer.ID]*peerLinkLoss // 节点到丢包率估计的映射
+	now   func() time.Time          // 当前时间，便于测试
+}
+
+// NewLinkLoss 创建并初始化一个新的 LinkLoss 实例
+func NewLinkLoss() *LinkLoss {
+	return &LinkLoss{
+		peers: make(map[peer.ID]*peerLinkLoss),
+		now:   time.Now,
+	}
+}
+
+// Record 记录一次向节点传输的丢包率
+// 参数：
+//   - p: peer.ID 对端节点
+//   - loss: float64 本次传输估计的丢包率，如重传与经校验恢复的数据包占数据包总数的比例
+func (l *LinkLoss) Record(p peer.ID, loss float64) {
+	if l == nil || loss < 0 {
+		return
+	}
+	if loss > 1 {
+		loss = 1
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	pl, ok := l.peers[p]
+	if !ok || l.now().Sub(pl.last) > linkLossStale {
+		l.peers[p] = &peerLinkLoss{loss: loss, last: l.now()}
+		return
+	}
+	pl.loss += linkLossAlpha * (loss - pl.loss)
+	pl.last = l.now()
+}
+
+// Loss 获取节点链路的丢包率估计
+// 参数：
+//   - p: peer.ID 对端节点
+//
+// 返回值：
+//   - float64: 平滑后的丢包率，没有采样或估计过时时为 0
+func (l *LinkLoss) Loss(p peer.ID) float64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	pl, ok := l.peers[p]
+	if !ok || l.now().Sub(pl.last) > linkLossStale {
+		return 0
+	}
+	return pl.loss
+}
+
+// Forget 删除节点的丢包率估计，用于节点离开网络时
+// 参数：
+//   - p: peer.ID 对端节点
+func (l *LinkLoss) Forget(p peer.ID) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	delete(l.peers, p)
+	l.mu.Unlock()
+}
@@ -0,0 +1,46 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/test"
+)
+
+func TestLinkLoss(t *testing.T) {
+	now := time.Now()
+	l := NewLinkLoss()
+	l.now = func() time.Time { return now }
+
+	lossy, clean, unknown := test.RandPeerIDFatal(t), test.RandPeerIDFatal(t), test.RandPeerIDFatal(t)
+	for i := 0; i < 5; i++ {
+		l.Record(lossy, 0.2)
+		l.Record(clean, 0)
+	}
+	if loss := l.Loss(lossy); loss < 0.19 || loss > 0.21 {
+		t.Fatalf("Loss(lossy) = %v", loss)
+	}
+	if loss := l.Loss(clean); loss != 0 {
+		t.Fatalf("Loss(clean) = %v", loss)
+	}
+	if loss := l.Loss(unknown); loss != 0 {
+		t.Fatalf("Loss(unknown) = %v", loss)
+	}
+
+	// 单次无丢包的传输只部分拉低估计
+	l.Record(lossy, 0)
+	if loss := l.Loss(lossy); loss <= 0.1 || loss >= 0.2 {
+		t.Fatalf("平滑后的 Loss(lossy) = %v", loss)
+	}
+
+	// 过时的估计视为未知
+	now = now.Add(time.Hour)
+	if loss := l.Loss(lossy); loss != 0 {
+		t.Fatalf("过时估计的 Loss = %v", loss)
+	}
+
+	l.Forget(lossy)
+	if _, ok := l.peers[lossy]; ok {
+		t.Fatal("Forget 后仍保留估计")
+	}
+}
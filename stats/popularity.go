@@ -0,0 +1,159 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// popularityHalfLife 文件片段请求热度的半衰期
+	// 片段每经过一个半衰期没有新的请求，热度减半
+	popularityHalfLife = 10 * time.Minute
+	// popularityFloor 热度衰减到该值以下的片段不再跟踪
+	popularityFloor = 0.01
+)
+
+// SegmentKey 文件片段的标识
+type SegmentKey struct {
+	FileID    string // 文件唯一标识
+	SegmentID string // 文件片段的唯一标识
+}
+
+// SegmentHeat 文件片段的请求热度
+type SegmentHeat struct {
+	SegmentKey
+	Score float64 // 按半衰期衰减后的请求次数
+}
+
+// segmentHeat 单个文件片段的热度记录
+type segmentHeat struct {
+	score float64   // 截至 last 的热度
+	last  time.Time // 最近一次更新热度的时间
+}
+
+// Popularity 存储节点上各文件片段的请求热度
+// 每次响应片段的下载请求时热度加 1，此后按半衰期指数衰减，
+// 因此热度近似于最近一个半衰期内的请求次数，突发的热点文件可以被及时发现
+type Popularity struct {
+	mu       sync.Mutex
+	halfLife time.Duration               // 热度的半衰期
+	segments map[SegmentKey]*segmentHeat // 文件片段到热度记录的映射
+	now      func() time.Time            // 当前时间，便于测试
+}
+
+// NewPopularity 创建并初始化一个新的 Popularity 实例
+// 参数：
+//   - halfLife: time.Duration 热度的半衰期，不大于 0 时使用默认的 10 分钟
+func NewPopularity(halfLife time.Duration) *Popularity {
+	if halfLife <= 0 {
+		halfLife = popularityHalfLife
+	}
+	return &Popularity{
+		halfLife: halfLife,
+		segments: make(map[SegmentKey]*segmentHeat),
+		now:      time.Now,
+	}
+}
+
+// Record 记录一次对文件片段的请求
+// 参数：
+//   - fileID: string 文件唯一标识
+//   - segmentID: string 文件片段的唯一标识
+func (p *Popularity) Record(fileID, segmentID string) {
+	if p == nil {
+		return
+	}
+	now := p.now()
+	key := SegmentKey{FileID: fileID, SegmentID: segmentID}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h, ok := p.segments[key]
+	if !ok {
+		p.segments[key] = &segmentHeat{score: 1, last: now}
+		return
+	}
+	h.score = p.decay(h, now) + 1
+	h.last = now
+}
+
+// Score 获取文件片段当前的热度
+// 参数：
+//   - fileID: string 文件唯一标识
+//   - segmentID: string 文件片段的唯一标识
+//
+// 返回值：
+//   - float64: 衰减后的热度，没有请求记录时为 0
+func (p *Popularity) Score(fileID, segmentID string) float64 {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h, ok := p.segments[SegmentKey{FileID: fileID, SegmentID: segmentID}]
+	if !ok {
+		return 0
+	}
+	return p.decay(h, p.now())
+}
+
+// Hot 获取热度不低于阈值的文件片段，按热度从高到低排列，同时清理热度过低的记录
+// 参数：
+//   - threshold: float64 热度阈值
+//   - limit: int 返回的最大数量，不大于 0 时不限制
+//
+// 返回值：
+//   - []SegmentHeat: 热门的文件片段
+func (p *Popularity) Hot(threshold float64, limit int) []SegmentHeat {
+	if p == nil {
+		return nil
+	}
+	now := p.now()
+
+	p.mu.Lock()
+	var hot []SegmentHeat
+	for key, h := range p.segments {
+		score := p.decay(h, now)
+		if score < popularityFloor {
+			delete(p.segments, key)
+			continue
+		}
+		if score >= threshold {
+			hot = append(hot, SegmentHeat{SegmentKey: key, Score: score})
+		}
+	}
+	p.mu.Unlock()
+
+	sort.Slice(hot, func(i, j int) bool { return hot[i].Score > hot[j].Score })
+	if limit > 0 && len(hot) > limit {
+		hot = hot[:limit]
+	}
+	return hot
+}
+
+// Forget 删除文件的所有热度记录，如文件片段被删除后
+// 参数：
+//   - fileID: string 文件唯一标识
+func (p *Popularity) Forget(fileID string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key := range p.segments {
+		if key.FileID == fileID {
+			delete(p.segments, key)
+		}
+	}
+}
+
+// decay 计算热度记录衰减到指定时间的值，调用方需持有锁
+func (p *Popularity) decay(h *segmentHeat, now time.Time) float64 {
+	age := now.Sub(h.last)
+	if age <= 0 {
+		return h.score
+	}
+	return h.score * math.Exp2(-age.Seconds()/p.halfLife.Seconds())
+}
@@ -0,0 +1,56 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPopularity(t *testing.T) {
+	now := time.Now()
+	p := NewPopularity(time.Minute)
+	p.now = func() time.Time { return now }
+
+	for i := 0; i < 8; i++ {
+		p.Record("file-1", "hot")
+	}
+	p.Record("file-1", "cold")
+	p.Record("file-2", "warm")
+	p.Record("file-2", "warm")
+
+	if score := p.Score("file-1", "hot"); score != 8 {
+		t.Fatalf("Score(hot) = %v", score)
+	}
+	if score := p.Score("file-1", "missing"); score != 0 {
+		t.Fatalf("Score(missing) = %v", score)
+	}
+
+	// 经过一个半衰期热度减半
+	now = now.Add(time.Minute)
+	if score := p.Score("file-1", "hot"); score < 3.99 || score > 4.01 {
+		t.Fatalf("衰减后的 Score(hot) = %v", score)
+	}
+	p.Record("file-2", "warm")
+	if score := p.Score("file-2", "warm"); score < 1.99 || score > 2.01 {
+		t.Fatalf("衰减后再次请求的 Score(warm) = %v", score)
+	}
+
+	hot := p.Hot(1.5, 0)
+	if len(hot) != 2 || hot[0].SegmentID != "hot" || hot[1].SegmentID != "warm" {
+		t.Fatalf("Hot(1.5) = %v", hot)
+	}
+	if hot := p.Hot(0, 1); len(hot) != 1 || hot[0].SegmentID != "hot" {
+		t.Fatalf("Hot(0, 1) = %v", hot)
+	}
+
+	// 长时间没有请求的记录被清理
+	now = now.Add(time.Hour)
+	if hot := p.Hot(0, 0); len(hot) != 0 || len(p.segments) != 0 {
+		t.Fatalf("过时的记录未清理: %v", hot)
+	}
+
+	p.Record("file-3", "a")
+	p.Forget("file-3")
+	if score := p.Score("file-3", "a"); score != 0 {
+		t.Fatalf("Forget 后 Score = %v", score)
+	}
+}
@@ -0,0 +1,67 @@
+package stats
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RoutingCollector 将路由表指标导出为 Prometheus 指标
+// 每个跟踪器以 mode 标签区分，如 "client"、"server"
+type RoutingCollector struct {
+	trackers map[string]*RoutingTracker // 标签值到跟踪器的映射
+
+	size      *prometheus.Desc
+	bucket    *prometheus.Desc
+	bucketAge *prometheus.Desc
+	peerAge   *prometheus.Desc
+	added     *prometheus.Desc
+	evicted   *prometheus.Desc
+}
+
+// NewRoutingCollector 创建路由表指标的 Prometheus 收集器
+// 参数：
+//   - trackers: map[string]*RoutingTracker 标签值到跟踪器的映射
+//
+// 返回值：
+//   - *RoutingCollector: 可注册到 prometheus.Registerer 的收集器
+func NewRoutingCollector(trackers map[string]*RoutingTracker) *RoutingCollector {
+	return &RoutingCollector{
+		trackers:  trackers,
+		size:      prometheus.NewDesc("defs_routing_table_peers", "路由表中的节点总数", []string{"mode"}, nil),
+		bucket:    prometheus.NewDesc("defs_routing_bucket_peers", "按公共前缀长度统计的节点数量", []string{"mode", "cpl"}, nil),
+		bucketAge: prometheus.NewDesc("defs_routing_bucket_peer_age_seconds", "按公共前缀长度统计的节点平均在表时长", []string{"mode", "cpl"}, nil),
+		peerAge:   prometheus.NewDesc("defs_routing_peer_age_seconds", "节点在路由表中的平均时长", []string{"mode"}, nil),
+		added:     prometheus.NewDesc("defs_routing_peers_added_total", "加入路由表的节点数", []string{"mode"}, nil),
+		evicted:   prometheus.NewDesc("defs_routing_peers_evicted_total", "从路由表移除的节点数", []string{"mode"}, nil),
+	}
+}
+
+// Describe 实现 prometheus.Collector 接口
+func (c *RoutingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.size
+	ch <- c.bucket
+	ch <- c.bucketAge
+	ch <- c.peerAge
+	ch <- c.added
+	ch <- c.evicted
+}
+
+// Collect 实现 prometheus.Collector 接口
+func (c *RoutingCollector) Collect(ch chan<- prometheus.Metric) {
+	for mode, tracker := range c.trackers {
+		m := tracker.Metrics()
+		if m == nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.size, prometheus.GaugeValue, float64(m.Size), mode)
+		ch <- prometheus.MustNewConstMetric(c.peerAge, prometheus.GaugeValue, m.AvgPeerAge.Seconds(), mode)
+		ch <- prometheus.MustNewConstMetric(c.added, prometheus.CounterValue, float64(m.Added), mode)
+		ch <- prometheus.MustNewConstMetric(c.evicted, prometheus.CounterValue, float64(m.Evicted), mode)
+		for _, b := range m.Buckets {
+			cpl := strconv.Itoa(b.Cpl)
+			ch <- prometheus.MustNewConstMetric(c.bucket, prometheus.GaugeValue, float64(b.Peers), mode, cpl)
+			ch <- prometheus.MustNewConstMetric(c.bucketAge, prometheus.GaugeValue, b.AvgPeerAge.Seconds(), mode, cpl)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// reputationHalfLife 存储承诺争议的半衰期
+// 节点每经过一个半衰期没有新的争议，累计的争议次数减半，违约的节点可以逐渐恢复信誉
+const reputationHalfLife = 24 * time.Hour
+
+// peerDisputes 单个节点的争议记录
+type peerDisputes struct {
+	count float64   // 截至 last 的争议次数
+	last  time.Time // 最近一次更新的时间
+}
+
+// Reputation 存储节点的信誉，由上传方对存储承诺提出的争议累计
+// 选择存储节点时信誉较低的节点排在后面，未违约的节点保持原有顺序
+type Reputation struct {
+	mu    sync.Mutex
+	peers map[peer.ID]*peerDisputes // 节点到争议记录的映射
+	now   func() time.Time          // 当前时间，便于测试
+}
+
+// NewReputation 创建并初始化一个新的 Reputation 实例
+func NewReputation() *Reputation {
+	return &Reputation{
+		peers: make(map[peer.ID]*peerDisputes),
+		now:   time.Now,
+	}
+}
+
+// Penalize 记录一次针对节点的争议，如节点未能在承诺期内提供片段
+// 参数：
+//   - p: peer.ID 违约的存储节点
+func (r *Reputation) Penalize(p peer.ID) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	d, ok := r.peers[p]
+	if !ok {
+		r.peers[p] = &peerDisputes{count: 1, last: now}
+		return
+	}
+	d.count = decay(d.count, now.Sub(d.last), reputationHalfLife) + 1
+	d.last = now
+}
+
+// Score 获取节点的信誉得分
+// 参数：
+//   - p: peer.ID 存储节点
+//
+// 返回值：
+//   - float64: 取值 (0, 1] 的得分，没有争议的节点为 1
+func (r *Reputation) Score(p peer.ID) float64 {
+	if r == nil {
+		return 1
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.score(p)
+}
+
+// score 获取节点的信誉得分，调用方需持有锁
+func (r *Reputation) score(p peer.ID) float64 {
+	d, ok := r.peers[p]
+	if !ok {
+		return 1
+	}
+	return 1 / (1 + decay(d.count, r.now().Sub(d.last), reputationHalfLife))
+}
+
+// Rank 按信誉得分从高到低重排节点，得分相同的节点保持原有顺序
+// 参数：
+//   - peers: []peer.ID 待排序的节点，原地重排
+func (r *Reputation) Rank(peers []peer.ID) {
+	if r == nil || len(peers) < 2 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.peers) == 0 {
+		return
+	}
+
+	scores := make(map[peer.ID]float64, len(peers))
+	for _, p := range peers {
+		scores[p] = r.score(p)
+	}
+	sort.SliceStable(peers, func(i, j int) bool {
+		return scores[peers[i]] > scores[peers[j]]
+	})
+}
+
+// decay 按半衰期衰减累计值
+func decay(value float64, elapsed, halfLife time.Duration) float64 {
+	if elapsed <= 0 {
+		return value
+	}
+	return value * math.Exp2(-elapsed.Seconds()/halfLife.Seconds())
+}
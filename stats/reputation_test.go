@@ -0,0 +1,39 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+)
+
+func TestReputation(t *testing.T) {
+	now := time.Now()
+	r := NewReputation()
+	r.now = func() time.Time { return now }
+
+	good, bad, worse := test.RandPeerIDFatal(t), test.RandPeerIDFatal(t), test.RandPeerIDFatal(t)
+	r.Penalize(bad)
+	r.Penalize(worse)
+	r.Penalize(worse)
+
+	if s := r.Score(good); s != 1 {
+		t.Fatalf("Score(good) = %v", s)
+	}
+	if s := r.Score(bad); s != 0.5 {
+		t.Fatalf("Score(bad) = %v", s)
+	}
+
+	peers := []peer.ID{worse, bad, good}
+	r.Rank(peers)
+	if peers[0] != good || peers[1] != bad || peers[2] != worse {
+		t.Fatalf("Rank = %v", peers)
+	}
+
+	// 争议按半衰期衰减，节点逐渐恢复信誉
+	now = now.Add(10 * reputationHalfLife)
+	if s := r.Score(worse); s < 0.99 {
+		t.Fatalf("衰减后的得分 = %v", s)
+	}
+}
@@ -0,0 +1,275 @@
+package stats
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bpfs/dep2p/kbucket"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// rateWindow 计算加入与驱逐速率的时间窗口
+const rateWindow = 10 * time.Minute
+
+// BucketMetrics 路由表中一个桶的指标
+// 最后一个桶包含公共前缀长度大于等于其索引的所有节点，这里按公共前缀长度分别统计
+type BucketMetrics struct {
+	Cpl        int           // 与本地节点的公共前缀长度
+	Peers      int           // 节点数量
+	AvgPeerAge time.Duration // 节点在路由表中的平均时长
+}
+
+// RoutingMetrics 路由表的占用与变动指标
+type RoutingMetrics struct {
+	Size       int             // 路由表中的节点总数
+	Buckets    []BucketMetrics // 按公共前缀长度排列的桶指标
+	AvgPeerAge time.Duration   // 所有节点在路由表中的平均时长
+	Added      uint64          // 开始跟踪以来加入的节点数
+	Evicted    uint64          // 开始跟踪以来移除的节点数
+	AddRate    float64         // 最近 10 分钟内每分钟加入的节点数
+	EvictRate  float64         // 最近 10 分钟内每分钟移除的节点数
+	TakenAt    time.Time       // 指标生成的时间
+}
+
+// routingPollInterval 对比路由表快照统计节点加入与移除的间隔
+const routingPollInterval = 30 * time.Second
+
+// RoutingTracker 跟踪路由表的节点加入与移除
+// 通过定期对比路由表快照计数，不修改路由表的 PeerAdded 与 PeerRemoved 通知函数，
+// 两次对比之间加入又移除的节点不会被计入
+type RoutingTracker struct {
+	rt    *kbucket.RoutingTable // 被跟踪的路由表
+	local kbucket.ID            // 本地节点在 DHT 空间中的 ID
+
+	mu        sync.Mutex       // 用于保护计数的互斥锁
+	prev      *RoutingSnapshot // 上一次对比的快照
+	added     uint64           // 加入的节点数
+	evicted   uint64           // 移除的节点数
+	addedAt   []time.Time      // 时间窗口内的加入时间
+	evictedAt []time.Time      // 时间窗口内的移除时间
+}
+
+// NewRoutingTracker 开始跟踪路由表，应在节点启动时调用一次
+// 创建时路由表中已有的节点不计入加入的节点数
+// 参数：
+//   - rt: *kbucket.RoutingTable 路由表
+//   - local: peer.ID 本地节点
+//
+// 返回值：
+//   - *RoutingTracker: 路由表跟踪器
+func NewRoutingTracker(rt *kbucket.RoutingTable, local peer.ID) *RoutingTracker {
+	t := &RoutingTracker{rt: rt, local: kbucket.ConvertPeerID(local)}
+	t.prev = t.Snapshot()
+	return t
+}
+
+// Run 定期对比路由表快照，直到上下文结束
+// 参数：
+//   - ctx: context.Context 上下文
+func (t *RoutingTracker) Run(ctx context.Context) {
+	if t == nil {
+		return
+	}
+	ticker := time.NewTicker(routingPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.poll()
+		}
+	}
+}
+
+// poll 对比当前与上一次的路由表快照，记录其间加入与移除的节点
+func (t *RoutingTracker) poll() {
+	s := t.Snapshot()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d := s.Diff(t.prev)
+	t.prev = s
+	t.added += uint64(len(d.Added))
+	t.evicted += uint64(len(d.Removed))
+	t.addedAt = appendTimes(trimBefore(t.addedAt, s.TakenAt.Add(-rateWindow)), s.TakenAt, len(d.Added))
+	t.evictedAt = appendTimes(trimBefore(t.evictedAt, s.TakenAt.Add(-rateWindow)), s.TakenAt, len(d.Removed))
+}
+
+// appendTimes 追加 n 个相同的时间
+func appendTimes(times []time.Time, at time.Time, n int) []time.Time {
+	for i := 0; i < n; i++ {
+		times = append(times, at)
+	}
+	return times
+}
+
+// Metrics 生成路由表的占用与变动指标
+// 返回值：
+//   - *RoutingMetrics: 路由表指标，跟踪器为 nil 时返回 nil
+func (t *RoutingTracker) Metrics() *RoutingMetrics {
+	if t == nil {
+		return nil
+	}
+
+	t.poll()
+	now := time.Now()
+	m := &RoutingMetrics{TakenAt: now}
+
+	// 按公共前缀长度统计节点数量与平均时长
+	type bucketSum struct {
+		peers int
+		age   time.Duration
+	}
+	buckets := make(map[int]*bucketSum)
+	var totalAge time.Duration
+	for _, info := range t.rt.GetPeerInfos() {
+		cpl := kbucket.CommonPrefixLen(kbucket.ConvertPeerID(info.Id), t.local)
+		sum, ok := buckets[cpl]
+		if !ok {
+			sum = new(bucketSum)
+			buckets[cpl] = sum
+		}
+		age := now.Sub(info.AddedAt)
+		sum.peers++
+		sum.age += age
+		totalAge += age
+		m.Size++
+	}
+	for cpl, sum := range buckets {
+		m.Buckets = append(m.Buckets, BucketMetrics{
+			Cpl:        cpl,
+			Peers:      sum.peers,
+			AvgPeerAge: sum.age / time.Duration(sum.peers),
+		})
+	}
+	sort.Slice(m.Buckets, func(i, j int) bool { return m.Buckets[i].Cpl < m.Buckets[j].Cpl })
+	if m.Size > 0 {
+		m.AvgPeerAge = totalAge / time.Duration(m.Size)
+	}
+
+	t.mu.Lock()
+	t.addedAt = trimBefore(t.addedAt, now.Add(-rateWindow))
+	t.evictedAt = trimBefore(t.evictedAt, now.Add(-rateWindow))
+	m.Added, m.Evicted = t.added, t.evicted
+	m.AddRate = float64(len(t.addedAt)) / rateWindow.Minutes()
+	m.EvictRate = float64(len(t.evictedAt)) / rateWindow.Minutes()
+	t.mu.Unlock()
+
+	return m
+}
+
+// trimBefore 删除早于指定时间的记录，times 按时间递增排列
+func trimBefore(times []time.Time, before time.Time) []time.Time {
+	i := sort.Search(len(times), func(i int) bool { return !times[i].Before(before) })
+	return times[i:]
+}
+
+// RoutingSnapshot 路由表在某一时刻的节点集合
+type RoutingSnapshot struct {
+	Peers   map[peer.ID]time.Time // 节点及其加入路由表的时间
+	TakenAt time.Time             // 快照生成的时间
+}
+
+// RoutingDiff 两个路由表快照之间的变化
+type RoutingDiff struct {
+	Added   []peer.ID // 新加入的节点
+	Removed []peer.ID // 已移除的节点
+}
+
+// Empty 检查两个快照之间是否没有变化
+func (d *RoutingDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// Snapshot 生成路由表的节点快照，只获取一次路由表的锁
+// 返回值：
+//   - *RoutingSnapshot: 路由表快照，跟踪器为 nil 时返回 nil
+func (t *RoutingTracker) Snapshot() *RoutingSnapshot {
+	if t == nil {
+		return nil
+	}
+
+	infos := t.rt.GetPeerInfos()
+	s := &RoutingSnapshot{Peers: make(map[peer.ID]time.Time, len(infos)), TakenAt: time.Now()}
+	for _, info := range infos {
+		s.Peers[info.Id] = info.AddedAt
+	}
+	return s
+}
+
+// Diff 计算相对于上一个快照的变化
+// 节点被移除后重新加入时，其加入时间不同，同时出现在 Added 与 Removed 中
+// 参数：
+//   - prev: *RoutingSnapshot 上一个快照，为 nil 时所有节点视为新加入
+//
+// 返回值：
+//   - *RoutingDiff: 按节点ID排序的变化
+func (s *RoutingSnapshot) Diff(prev *RoutingSnapshot) *RoutingDiff {
+	d := new(RoutingDiff)
+	var before map[peer.ID]time.Time
+	if prev != nil {
+		before = prev.Peers
+	}
+
+	for p, addedAt := range s.Peers {
+		prevAddedAt, ok := before[p]
+		if !ok {
+			d.Added = append(d.Added, p)
+		} else if !prevAddedAt.Equal(addedAt) {
+			d.Added = append(d.Added, p)
+			d.Removed = append(d.Removed, p)
+		}
+	}
+	for p := range before {
+		if _, ok := s.Peers[p]; !ok {
+			d.Removed = append(d.Removed, p)
+		}
+	}
+
+	sort.Slice(d.Added, func(i, j int) bool { return d.Added[i] < d.Added[j] })
+	sort.Slice(d.Removed, func(i, j int) bool { return d.Removed[i] < d.Removed[j] })
+	return d
+}
+
+// TryAddPeers 批量将节点加入路由表
+// 先根据一次快照跳过重复或已在路由表中的节点，只对新节点逐个加锁加入
+// 参数：
+//   - peers: []peer.ID 待加入的节点
+//   - mode: int 节点的运行模式
+//   - queryPeer: bool 节点是否为查询节点
+//
+// 返回值：
+//   - []peer.ID: 新加入路由表的节点
+//   - map[peer.ID]error: 被路由表拒绝的节点及原因
+func (t *RoutingTracker) TryAddPeers(peers []peer.ID, mode int, queryPeer bool) ([]peer.ID, map[peer.ID]error) {
+	existing := t.Snapshot().Peers
+	seen := make(map[peer.ID]struct{}, len(peers))
+
+	var added []peer.ID
+	var rejected map[peer.ID]error
+	for _, p := range peers {
+		if _, ok := seen[p]; ok {
+			continue
+		}
+		seen[p] = struct{}{}
+		if _, ok := existing[p]; ok {
+			continue
+		}
+
+		ok, err := t.rt.TryAddPeer(p, mode, queryPeer, false)
+		if err != nil {
+			if rejected == nil {
+				rejected = make(map[peer.ID]error)
+			}
+			rejected[p] = err
+			continue
+		}
+		if ok {
+			added = append(added, p)
+		}
+	}
+	return added, rejected
+}
@@ -0,0 +1,423 @@
+package stats
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/bpfs/dep2p/kbucket"
+	"github.com/bpfs/dep2p/kbucket/peerdiversity"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	pstore "github.com/libp2p/go-libp2p/p2p/host/peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// simEpoch 模拟时钟的起始时间，固定取值使模拟结果与运行时间无关
+var simEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// SimOpKind 模拟操作的类型
+type SimOpKind int
+
+const (
+	SimJoin  SimOpKind = iota // 节点上线并尝试加入路由表
+	SimLeave                  // 节点下线，仍留在路由表中直到被驱逐或替换
+	SimQuery                  // 查询距离键最近的节点，响应的在线节点记为有用
+	SimEvict                  // 按驱逐策略驱逐过时的节点
+)
+
+// String 返回操作类型的名称
+func (k SimOpKind) String() string {
+	switch k {
+	case SimJoin:
+		return "join"
+	case SimLeave:
+		return "leave"
+	case SimQuery:
+		return "query"
+	case SimEvict:
+		return "evict"
+	default:
+		return fmt.Sprintf("SimOpKind(%d)", int(k))
+	}
+}
+
+// SimOp 模拟工作负载中的一次操作
+type SimOp struct {
+	At   time.Duration // 相对模拟开始的时间
+	Kind SimOpKind     // 操作类型
+	Peer int           // 节点在模拟节点集合中的索引，用于 SimJoin 与 SimLeave
+	Key  string        // 查询的键，用于 SimQuery
+}
+
+// SimConfig 路由表模拟的配置
+// 相同的配置与工作负载总是得到相同的结果，可用于离线比较桶策略或多样性过滤器的改动
+type SimConfig struct {
+	Seed        int64           // 随机数种子，决定本地节点与模拟节点的ID及地址
+	Peers       int             // 模拟节点的数量
+	BucketSize  int             // 路由表桶的容量，为 0 时使用 20
+	QueryCount  int             // 每次查询返回的节点数量，为 0 时使用桶的容量
+	QueryPeers  bool            // 加入的节点是否视为查询节点，查询节点加入时即记为有用
+	Replaceable bool            // 加入的节点是否可以被替换
+	Eviction    *EvictionPolicy // 驱逐策略，为 nil 时 SimEvict 不做任何操作
+
+	Groups int // 模拟节点分布的 IP 组(/16 网段)数量，为 0 时每个节点独占一个组
+	// Diversity 根据节点地址构建多样性过滤策略，为 nil 时不过滤
+	Diversity func(addrs func(peer.ID) []ma.Multiaddr) peerdiversity.PeerIPGroupFilter
+}
+
+// SimReport 模拟的结果指标
+type SimReport struct {
+	Ops        int             // 执行的操作数量
+	Joins      int             // 节点上线次数
+	Added      int             // 加入路由表的节点数量
+	Rejected   int             // 被路由表拒绝的加入次数
+	Removed    int             // 从路由表移除的节点数量，包括被替换与被驱逐的节点
+	Evicted    int             // 按驱逐策略驱逐的节点数量
+	Queries    int             // 查询次数
+	Recall     float64         // 查询结果对在线节点中真正最近节点的平均召回率
+	StaleHits  int             // 查询结果中已下线节点的数量
+	Size       int             // 模拟结束时路由表中的节点数量
+	Stale      int             // 模拟结束时路由表中已下线节点的数量
+	Buckets    []BucketMetrics // 模拟结束时按公共前缀长度排列的桶指标，时长按模拟时钟计算
+	VirtualEnd time.Duration   // 模拟时钟经过的时长
+}
+
+// simPeer 模拟节点在模拟时钟下的状态
+type simPeer struct {
+	addedAt      time.Time // 加入路由表的时间
+	lastUsefulAt time.Time // 最近一次有用的时间
+}
+
+// Simulation 在模拟时钟下重放路由表工作负载
+// 路由表本身使用真实的 kbucket.RoutingTable，节点的加入时间与有用时间另按模拟时钟记录，驱逐与指标都基于模拟时钟
+type Simulation struct {
+	cfg   SimConfig
+	now   time.Time             // 模拟时钟的当前时间
+	local peer.ID               // 本地节点
+	rt    *kbucket.RoutingTable // 路由表
+
+	peers  []peer.ID                  // 模拟节点，按索引排列
+	addrs  map[peer.ID][]ma.Multiaddr // 模拟节点的地址
+	online map[peer.ID]bool           // 在线的节点
+	state  map[peer.ID]*simPeer       // 路由表中节点的模拟状态
+
+	report  SimReport
+	recalls float64 // 召回率之和
+}
+
+// NewSimulation 创建路由表模拟
+// 参数：
+//   - cfg: SimConfig 模拟配置
+//
+// 返回值：
+//   - *Simulation: 路由表模拟
+//   - error: 配置无效时返回错误
+func NewSimulation(cfg SimConfig) (*Simulation, error) {
+	if cfg.Peers <= 0 {
+		return nil, fmt.Errorf("模拟节点的数量必须大于 0")
+	}
+	if cfg.BucketSize <= 0 {
+		cfg.BucketSize = 20
+	}
+	if cfg.QueryCount <= 0 {
+		cfg.QueryCount = cfg.BucketSize
+	}
+	if cfg.Groups <= 0 || cfg.Groups > cfg.Peers {
+		cfg.Groups = cfg.Peers
+	}
+
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	local, err := simPeerID(rng)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Simulation{
+		cfg:    cfg,
+		now:    simEpoch,
+		local:  local,
+		peers:  make([]peer.ID, cfg.Peers),
+		addrs:  make(map[peer.ID][]ma.Multiaddr, cfg.Peers),
+		online: make(map[peer.ID]bool),
+		state:  make(map[peer.ID]*simPeer),
+	}
+	for i := range s.peers {
+		p, err := simPeerID(rng)
+		if err != nil {
+			return nil, err
+		}
+		// 第 g 个组使用 /16 网段 (100+g/256).(g%256).0.0，避开按 /8 分组的传统网段
+		g := rng.Intn(cfg.Groups)
+		addr, err := ma.NewMultiaddr(fmt.Sprintf("/ip4/%d.%d.%d.%d/tcp/4001", 100+g/256, g%256, rng.Intn(256), 1+rng.Intn(254)))
+		if err != nil {
+			return nil, err
+		}
+		s.peers[i] = p
+		s.addrs[p] = []ma.Multiaddr{addr}
+	}
+
+	localID := kbucket.ConvertPeerID(local)
+	var df *peerdiversity.Filter
+	if cfg.Diversity != nil {
+		df, err = peerdiversity.NewFilter(cfg.Diversity(func(p peer.ID) []ma.Multiaddr { return s.addrs[p] }), "simulation", func(p peer.ID) int {
+			return kbucket.CommonPrefixLen(kbucket.ConvertPeerID(p), localID)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 模拟节点没有延迟数据，延迟上限只需足够大
+	s.rt, err = kbucket.NewRoutingTable(cfg.BucketSize, localID, time.Hour, pstore.NewMetrics(), 0, df)
+	if err != nil {
+		return nil, err
+	}
+	s.rt.PeerRemoved = func(p peer.ID) {
+		delete(s.state, p)
+		s.report.Removed++
+	}
+	return s, nil
+}
+
+// simPeerID 由随机数生成器确定性地生成节点ID
+func simPeerID(rng *rand.Rand) (peer.ID, error) {
+	_, pub, err := crypto.GenerateEd25519Key(rng)
+	if err != nil {
+		return "", err
+	}
+	return peer.IDFromPublicKey(pub)
+}
+
+// Peers 获取模拟节点，SimOp.Peer 为其中的索引
+func (s *Simulation) Peers() []peer.ID {
+	return s.peers
+}
+
+// Now 获取模拟时钟的当前时间
+func (s *Simulation) Now() time.Time {
+	return s.now
+}
+
+// Close 释放路由表
+func (s *Simulation) Close() error {
+	return s.rt.Close()
+}
+
+// Run 按时间顺序重放工作负载并返回结果指标
+// 参数：
+//   - ops: []SimOp 工作负载，按 At 排列
+//
+// 返回值：
+//   - *SimReport: 模拟的结果指标
+func (s *Simulation) Run(ops []SimOp) *SimReport {
+	for _, op := range ops {
+		s.Apply(op)
+	}
+	return s.Report()
+}
+
+// Apply 执行一次操作，模拟时钟先前进到操作的时间
+// 参数：
+//   - op: SimOp 模拟操作
+func (s *Simulation) Apply(op SimOp) {
+	if at := simEpoch.Add(op.At); at.After(s.now) {
+		s.now = at
+	}
+	s.report.Ops++
+
+	switch op.Kind {
+	case SimJoin:
+		p, ok := s.peer(op.Peer)
+		if !ok {
+			return
+		}
+		s.report.Joins++
+		s.online[p] = true
+		added, err := s.rt.TryAddPeer(p, 0, s.cfg.QueryPeers, s.cfg.Replaceable)
+		switch {
+		case err != nil:
+			s.report.Rejected++
+		case added:
+			s.report.Added++
+			state := &simPeer{addedAt: s.now}
+			if s.cfg.QueryPeers {
+				state.lastUsefulAt = s.now
+			}
+			s.state[p] = state
+		}
+
+	case SimLeave:
+		if p, ok := s.peer(op.Peer); ok {
+			delete(s.online, p)
+		}
+
+	case SimQuery:
+		s.query(op.Key)
+
+	case SimEvict:
+		s.evict()
+	}
+}
+
+// peer 获取索引对应的模拟节点
+func (s *Simulation) peer(index int) (peer.ID, bool) {
+	if index < 0 || index >= len(s.peers) {
+		return "", false
+	}
+	return s.peers[index], true
+}
+
+// query 查询距离键最近的节点，并与在线节点中真正最近的节点比较
+func (s *Simulation) query(key string) {
+	target := kbucket.ConvertKey(key)
+	got := s.rt.NearestPeers(target, s.cfg.QueryCount)
+
+	online := make([]peer.ID, 0, len(s.online))
+	for _, p := range s.peers {
+		if s.online[p] {
+			online = append(online, p)
+		}
+	}
+	want := kbucket.SortClosestPeers(online, target)
+	if len(want) > s.cfg.QueryCount {
+		want = want[:s.cfg.QueryCount]
+	}
+	closest := make(map[peer.ID]bool, len(want))
+	for _, p := range want {
+		closest[p] = true
+	}
+
+	found := 0
+	for _, p := range got {
+		if !s.online[p] {
+			s.report.StaleHits++
+			continue
+		}
+		// 响应查询的节点对本节点有用
+		if state, ok := s.state[p]; ok {
+			state.lastUsefulAt = s.now
+		}
+		if closest[p] {
+			found++
+		}
+	}
+
+	s.report.Queries++
+	if len(want) == 0 {
+		s.recalls++
+	} else {
+		s.recalls += float64(found) / float64(len(want))
+	}
+}
+
+// evict 按驱逐策略驱逐过时的节点，与 RoutingTracker.EvictStale 使用相同的选择规则
+func (s *Simulation) evict() {
+	if s.cfg.Eviction == nil || s.cfg.Eviction.BucketSize <= 0 {
+		return
+	}
+	evicted := selectStale(s.infos(), kbucket.ConvertPeerID(s.local), s.cfg.Eviction, s.now)
+	sort.Slice(evicted, func(i, j int) bool { return evicted[i] < evicted[j] })
+	for _, p := range evicted {
+		s.rt.RemovePeer(p)
+		s.report.Evicted++
+	}
+}
+
+// infos 获取路由表中的节点信息，加入时间与有用时间替换为模拟时钟下的值
+func (s *Simulation) infos() []kbucket.PeerInfo {
+	infos := s.rt.GetPeerInfos()
+	for i := range infos {
+		if state, ok := s.state[infos[i].Id]; ok {
+			infos[i].AddedAt = state.addedAt
+			infos[i].LastUsefulAt = state.lastUsefulAt
+		}
+	}
+	return infos
+}
+
+// Report 获取当前的结果指标
+// 返回值：
+//   - *SimReport: 模拟的结果指标
+func (s *Simulation) Report() *SimReport {
+	r := s.report
+	r.VirtualEnd = s.now.Sub(simEpoch)
+	if r.Queries > 0 {
+		r.Recall = s.recalls / float64(r.Queries)
+	}
+
+	local := kbucket.ConvertPeerID(s.local)
+	type bucketSum struct {
+		peers int
+		age   time.Duration
+	}
+	buckets := make(map[int]*bucketSum)
+	for _, info := range s.infos() {
+		r.Size++
+		if !s.online[info.Id] {
+			r.Stale++
+		}
+		cpl := kbucket.CommonPrefixLen(kbucket.ConvertPeerID(info.Id), local)
+		sum, ok := buckets[cpl]
+		if !ok {
+			sum = new(bucketSum)
+			buckets[cpl] = sum
+		}
+		sum.peers++
+		sum.age += s.now.Sub(info.AddedAt)
+	}
+	r.Buckets = nil
+	for cpl, sum := range buckets {
+		r.Buckets = append(r.Buckets, BucketMetrics{Cpl: cpl, Peers: sum.peers, AvgPeerAge: sum.age / time.Duration(sum.peers)})
+	}
+	sort.Slice(r.Buckets, func(i, j int) bool { return r.Buckets[i].Cpl < r.Buckets[j].Cpl })
+	return &r
+}
+
+// Workload 随机工作负载的参数，各操作按权重随机选择
+type Workload struct {
+	Seed       int64         // 随机数种子
+	Peers      int           // 模拟节点的数量，须与 SimConfig.Peers 一致
+	Ops        int           // 随机操作的数量
+	Span       time.Duration // 操作分布的时长
+	Join       int           // 节点上线的权重
+	Leave      int           // 节点下线的权重
+	Query      int           // 查询的权重
+	EvictEvery time.Duration // 驱逐的间隔，为 0 时不驱逐
+}
+
+// GenerateWorkload 按参数确定性地生成工作负载
+// 参数：
+//   - w: Workload 工作负载参数
+//
+// 返回值：
+//   - []SimOp: 按时间排列的操作
+func GenerateWorkload(w Workload) []SimOp {
+	total := w.Join + w.Leave + w.Query
+	if w.Peers <= 0 || w.Ops <= 0 || total <= 0 || w.Span <= 0 {
+		return nil
+	}
+
+	rng := rand.New(rand.NewSource(w.Seed))
+	ops := make([]SimOp, 0, w.Ops)
+	for i := 0; i < w.Ops; i++ {
+		op := SimOp{At: time.Duration(rng.Int63n(int64(w.Span)))}
+		switch n := rng.Intn(total); {
+		case n < w.Join:
+			op.Kind, op.Peer = SimJoin, rng.Intn(w.Peers)
+		case n < w.Join+w.Leave:
+			op.Kind, op.Peer = SimLeave, rng.Intn(w.Peers)
+		default:
+			op.Kind, op.Key = SimQuery, fmt.Sprintf("%016x", rng.Uint64())
+		}
+		ops = append(ops, op)
+	}
+	if w.EvictEvery > 0 {
+		for at := w.EvictEvery; at < w.Span; at += w.EvictEvery {
+			ops = append(ops, SimOp{At: at, Kind: SimEvict})
+		}
+	}
+	sort.SliceStable(ops, func(i, j int) bool { return ops[i].At < ops[j].At })
+	return ops
+}
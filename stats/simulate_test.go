@@ -0,0 +1,70 @@
+package stats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bpfs/dep2p/kbucket/peerdiversity"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// groupLimit 每个 IP 组最多允许 max 个节点的多样性过滤策略
+type groupLimit struct {
+	max    int
+	counts map[peerdiversity.PeerIPGroupKey]int
+	addrs  func(peer.ID) []ma.Multiaddr
+}
+
+func (g *groupLimit) Allow(info peerdiversity.PeerGroupInfo) bool {
+	return g.counts[info.IPGroupKey] < g.max
+}
+func (g *groupLimit) Increment(info peerdiversity.PeerGroupInfo) { g.counts[info.IPGroupKey]++ }
+func (g *groupLimit) Decrement(info peerdiversity.PeerGroupInfo) { g.counts[info.IPGroupKey]-- }
+func (g *groupLimit) PeerAddresses(p peer.ID) []ma.Multiaddr     { return g.addrs(p) }
+
+func TestSimulation(t *testing.T) {
+	workload := Workload{Seed: 7, Peers: 300, Ops: 3000, Span: 6 * time.Hour, Join: 5, Leave: 2, Query: 3, EvictEvery: 10 * time.Minute}
+	ops := GenerateWorkload(workload)
+	if len(ops) == 0 || !reflect.DeepEqual(ops, GenerateWorkload(workload)) {
+		t.Fatal("相同的参数应生成相同的工作负载")
+	}
+
+	run := func(cfg SimConfig) *SimReport {
+		s, err := NewSimulation(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		return s.Run(ops)
+	}
+
+	base := SimConfig{Seed: 1, Peers: 300, BucketSize: 4}
+	first, second := run(base), run(base)
+	if !reflect.DeepEqual(first, second) {
+		t.Fatalf("相同的种子应得到相同的结果:\n%+v\n%+v", first, second)
+	}
+	if first.Queries == 0 || first.Added == 0 || first.Evicted != 0 || first.VirtualEnd <= 0 {
+		t.Fatalf("结果指标不符: %+v", first)
+	}
+
+	// 驱逐过时节点后查询结果中已下线的节点更少
+	evicting := base
+	evicting.Eviction = &EvictionPolicy{BucketSize: 4, Grace: 5 * time.Minute, MinScore: 0.5}
+	evicted := run(evicting)
+	if evicted.Evicted == 0 || evicted.StaleHits >= first.StaleHits {
+		t.Fatalf("驱逐策略应减少过时节点: 不驱逐 %+v，驱逐 %+v", first, evicted)
+	}
+
+	// 所有节点只分布在 2 个 IP 组时，多样性过滤器限制路由表的大小
+	diverse := base
+	diverse.Groups = 2
+	diverse.Diversity = func(addrs func(peer.ID) []ma.Multiaddr) peerdiversity.PeerIPGroupFilter {
+		return &groupLimit{max: 3, counts: make(map[peerdiversity.PeerIPGroupKey]int), addrs: addrs}
+	}
+	limited := run(diverse)
+	if limited.Size > 6 || limited.Rejected == 0 {
+		t.Fatalf("多样性过滤器未生效: %+v", limited)
+	}
+}
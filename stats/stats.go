@@ -0,0 +1,127 @@
+// Package stats 维护节点运行时的传输与存储计数器，并提供一致的统计快照。
+// 计数器在数据写入或传输时增量更新，读取快照时无需扫描磁盘或任务。
+package stats
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+)
+
+// Counters 节点运行时的传输与存储计数器
+type Counters struct {
+	mu           sync.RWMutex // 用于保护计数器的读写锁
+	storedBytes  int64        // 本节点为其他节点存储的文件片段字节数
+	servedBytes  int64        // 本节点响应下载请求发送的字节数
+	fetchedBytes int64        // 本节点下载任务接收的字节数
+}
+
+// NewCounters 创建并初始化一个新的 Counters 实例
+func NewCounters() *Counters {
+	return &Counters{}
+}
+
+// AddStored 增加存储的字节数，删除文件片段时传入负数
+func (c *Counters) AddStored(n int64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.storedBytes += n
+	c.mu.Unlock()
+}
+
+// AddServed 增加响应下载请求发送的字节数
+func (c *Counters) AddServed(n int64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.servedBytes += n
+	c.mu.Unlock()
+}
+
+// AddFetched 增加下载任务接收的字节数
+func (c *Counters) AddFetched(n int64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.fetchedBytes += n
+	c.mu.Unlock()
+}
+
+// InitStored 启动时统计一次已存储的文件片段字节数，此后由计数器增量维护
+// 参数：
+//   - afe: afero.Afero 文件系统接口
+//   - dir: string 文件片段的存储目录
+//
+// 返回值：
+//   - error: 如果发生错误，返回错误信息
+func (c *Counters) InitStored(afe afero.Afero, dir string) error {
+	var total int64
+	err := afero.Walk(afe, dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil // 跳过无法访问的文件
+		}
+		if !info.IsDir() {
+			total += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	c.AddStored(total)
+	return nil
+}
+
+// Transfer 传输与存储的字节数
+type Transfer struct {
+	StoredBytes  int64 // 本节点为其他节点存储的文件片段字节数
+	ServedBytes  int64 // 本节点响应下载请求发送的字节数
+	FetchedBytes int64 // 本节点下载任务接收的字节数
+}
+
+// Transfer 获取传输与存储字节数的一致快照
+func (c *Counters) Transfer() Transfer {
+	if c == nil {
+		return Transfer{}
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return Transfer{
+		StoredBytes:  c.storedBytes,
+		ServedBytes:  c.servedBytes,
+		FetchedBytes: c.fetchedBytes,
+	}
+}
+
+// Snapshot 节点统计信息的快照
+type Snapshot struct {
+	Transfer                     // 传输与存储的字节数
+	UploadTasks   map[string]int // 各状态的上传任务数量
+	DownloadTasks map[string]int // 各状态的下载任务数量
+	Peers         map[int]int    // 各模式路由表中的节点数量
+	DBSize        int64          // 任务与索引等持久化数据的大小，单位为字节
+	TakenAt       time.Time      // 快照的生成时间
+}
+
+// FilesSize 获取一组文件的总大小，不存在的文件按0计算
+// 参数：
+//   - files: ...string 文件路径
+//
+// 返回值：
+//   - int64: 文件的总大小
+func FilesSize(files ...string) int64 {
+	var total int64
+	for _, file := range files {
+		if info, err := os.Stat(filepath.Clean(file)); err == nil && !info.IsDir() {
+			total += info.Size()
+		}
+	}
+	return total
+}
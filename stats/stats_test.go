@@ -0,0 +1,143 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/dep2p/kbucket"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+	pstore "github.com/libp2p/go-libp2p/p2p/host/peerstore"
+)
+
+func TestCounters(t *testing.T) {
+	afe := afero.NewMemMapFs()
+	afero.WriteFile(afe, "slices/a/1", make([]byte, 10), 0644)
+	afero.WriteFile(afe, "slices/b/2", make([]byte, 5), 0644)
+
+	c := NewCounters()
+	if err := c.InitStored(afe, "slices"); err != nil {
+		t.Fatalf("统计已存储的文件片段失败: %v", err)
+	}
+	c.AddStored(7)
+	c.AddServed(3)
+	c.AddFetched(4)
+
+	got := c.Transfer()
+	want := Transfer{StoredBytes: 22, ServedBytes: 3, FetchedBytes: 4}
+	if got != want {
+		t.Fatalf("期望 %+v，实际 %+v", want, got)
+	}
+}
+
+func TestRoutingTracker(t *testing.T) {
+	local := test.RandPeerIDFatal(t)
+	rt, err := kbucket.NewRoutingTable(20, kbucket.ConvertPeerID(local), time.Hour, pstore.NewMetrics(), time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := NewRoutingTracker(rt, local)
+
+	peers := make([]peer.ID, 5)
+	for i := range peers {
+		peers[i] = test.RandPeerIDFatal(t)
+		if _, err := rt.TryAddPeer(peers[i], 2, true, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tracker.poll()
+	rt.RemovePeer(peers[0])
+
+	m := tracker.Metrics()
+	if m.Size != 4 || m.Added != 5 || m.Evicted != 1 {
+		t.Fatalf("metrics = %+v", m)
+	}
+	total := 0
+	for _, b := range m.Buckets {
+		total += b.Peers
+	}
+	if total != m.Size || m.AddRate <= 0 {
+		t.Fatalf("buckets = %+v, add rate = %v", m.Buckets, m.AddRate)
+	}
+}
+
+func TestRoutingSnapshotDiff(t *testing.T) {
+	local := test.RandPeerIDFatal(t)
+	rt, err := kbucket.NewRoutingTable(20, kbucket.ConvertPeerID(local), time.Hour, pstore.NewMetrics(), time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := NewRoutingTracker(rt, local)
+
+	peers := make([]peer.ID, 4)
+	for i := range peers {
+		peers[i] = test.RandPeerIDFatal(t)
+	}
+	added, rejected := tracker.TryAddPeers([]peer.ID{peers[0], peers[1], peers[0]}, 2, true)
+	if len(added) != 2 || rejected != nil || rt.Size() != 2 {
+		t.Fatalf("added = %v, rejected = %v", added, rejected)
+	}
+	prev := tracker.Snapshot()
+
+	// 已在路由表中的节点不会重复加入
+	added, _ = tracker.TryAddPeers([]peer.ID{peers[1], peers[2], peers[3]}, 2, true)
+	if len(added) != 2 {
+		t.Fatalf("added = %v", added)
+	}
+	rt.RemovePeer(peers[0])
+
+	diff := tracker.Snapshot().Diff(prev)
+	if len(diff.Added) != 2 || len(diff.Removed) != 1 || diff.Removed[0] != peers[0] {
+		t.Fatalf("diff = %+v", diff)
+	}
+	if !tracker.Snapshot().Diff(tracker.Snapshot()).Empty() {
+		t.Fatal("相同的快照不应有变化")
+	}
+	if d := prev.Diff(nil); len(d.Added) != 2 {
+		t.Fatalf("diff(nil) = %+v", d)
+	}
+}
+
+func TestEvictStale(t *testing.T) {
+	local := test.RandPeerIDFatal(t)
+	rt, err := kbucket.NewRoutingTable(20, kbucket.ConvertPeerID(local), time.Hour, pstore.NewMetrics(), time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := NewRoutingTracker(rt, local)
+
+	peers := make([]peer.ID, 6)
+	for i := range peers {
+		peers[i] = test.RandPeerIDFatal(t)
+		if _, err := rt.TryAddPeer(peers[i], 2, false, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	MarkUseful(peers[0], rt)
+
+	scores := tracker.Scores()
+	if scores[peers[0]] < 0.99 || scores[peers[1]] != 0 {
+		t.Fatalf("scores = %v", scores)
+	}
+
+	// 新加入的节点在宽限期内不会被驱逐
+	if evicted := tracker.EvictStale(&EvictionPolicy{BucketSize: 1, Grace: time.Hour, MinScore: 0.5}); len(evicted) != 0 {
+		t.Fatalf("宽限期内驱逐了 %v", evicted)
+	}
+
+	evicted := tracker.EvictStale(&EvictionPolicy{BucketSize: 1, MinScore: 0.5})
+	if len(evicted) != len(peers)-1 || rt.Size() != 1 || rt.Find(peers[0]) == "" {
+		t.Fatalf("evicted = %v, size = %d", evicted, rt.Size())
+	}
+}
+
+func TestUsefulness(t *testing.T) {
+	now := time.Now()
+	if s := Usefulness(kbucket.PeerInfo{}, now); s != 0 {
+		t.Fatalf("从未有用的节点得分 = %v", s)
+	}
+	if s := Usefulness(kbucket.PeerInfo{LastUsefulAt: now.Add(-usefulnessHalfLife)}, now); s < 0.49 || s > 0.51 {
+		t.Fatalf("经过一个半衰期的得分 = %v", s)
+	}
+}
@@ -0,0 +1,161 @@
+package stats
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/dep2p/kbucket"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+)
+
+// usefulnessHalfLife 节点有用性得分的半衰期
+// 节点自上次对本节点有用以来每经过一个半衰期，得分减半
+const usefulnessHalfLife = 30 * time.Minute
+
+// EvictionPolicy 按有用性驱逐路由表节点的策略
+// 路由表的桶已满时，长期没有用处的节点让出位置，新的活跃节点才能加入
+type EvictionPolicy struct {
+	BucketSize int           // 路由表桶的容量，同一公共前缀长度的节点达到该数量时才驱逐
+	Grace      time.Duration // 新加入的节点在该时长内不会因没有用处被驱逐
+	MinScore   float64       // 得分低于该值的节点视为过时
+	Interval   time.Duration // 检查的间隔
+}
+
+// DefaultEvictionPolicy 默认的驱逐策略
+func DefaultEvictionPolicy() *EvictionPolicy {
+	return &EvictionPolicy{
+		BucketSize: 20,
+		Grace:      10 * time.Minute,
+		MinScore:   0.1,
+		Interval:   5 * time.Minute,
+	}
+}
+
+// Usefulness 计算节点的有用性得分
+// 节点刚对本节点有用时得分为 1，此后按半衰期指数衰减；从未有用过的节点得分为 0
+// 参数：
+//   - info: kbucket.PeerInfo 路由表中的节点信息
+//   - now: time.Time 当前时间
+//
+// 返回值：
+//   - float64: 取值 [0, 1] 的得分
+func Usefulness(info kbucket.PeerInfo, now time.Time) float64 {
+	if info.LastUsefulAt.IsZero() {
+		return 0
+	}
+	age := now.Sub(info.LastUsefulAt)
+	if age <= 0 {
+		return 1
+	}
+	return math.Exp2(-age.Seconds() / usefulnessHalfLife.Seconds())
+}
+
+// MarkUseful 记录节点刚对本节点有用，如完成了文件片段的上传或下载
+// 参数：
+//   - p: peer.ID 对端节点
+//   - tables: ...*kbucket.RoutingTable 节点可能所在的路由表
+func MarkUseful(p peer.ID, tables ...*kbucket.RoutingTable) {
+	now := time.Now()
+	for _, rt := range tables {
+		if rt != nil {
+			rt.UpdateLastUsefulAt(p, now)
+		}
+	}
+}
+
+// Scores 获取路由表中各节点的有用性得分，供节点信誉等模块参考
+// 返回值：
+//   - map[peer.ID]float64: 节点到得分的映射，跟踪器为 nil 时返回 nil
+func (t *RoutingTracker) Scores() map[peer.ID]float64 {
+	if t == nil {
+		return nil
+	}
+	now := time.Now()
+	infos := t.rt.GetPeerInfos()
+	scores := make(map[peer.ID]float64, len(infos))
+	for _, info := range infos {
+		scores[info.Id] = Usefulness(info, now)
+	}
+	return scores
+}
+
+// EvictStale 从已满的桶中驱逐过时的节点
+// 每个公共前缀长度的节点按得分从低到高驱逐，直到桶中空出一个位置或没有过时的节点
+// 参数：
+//   - policy: *EvictionPolicy 驱逐策略
+//
+// 返回值：
+//   - []peer.ID: 被驱逐的节点
+func (t *RoutingTracker) EvictStale(policy *EvictionPolicy) []peer.ID {
+	if t == nil || policy == nil || policy.BucketSize <= 0 {
+		return nil
+	}
+
+	evicted := selectStale(t.rt.GetPeerInfos(), t.local, policy, time.Now())
+	for _, p := range evicted {
+		t.rt.RemovePeer(p)
+	}
+	return evicted
+}
+
+// selectStale 按驱逐策略选出已满的桶中需要驱逐的过时节点
+func selectStale(infos []kbucket.PeerInfo, local kbucket.ID, policy *EvictionPolicy, now time.Time) []peer.ID {
+	type candidate struct {
+		id    peer.ID
+		score float64
+	}
+	counts := make(map[int]int)
+	stale := make(map[int][]candidate)
+	for _, info := range infos {
+		cpl := kbucket.CommonPrefixLen(kbucket.ConvertPeerID(info.Id), local)
+		counts[cpl]++
+		if now.Sub(info.AddedAt) < policy.Grace {
+			continue
+		}
+		if score := Usefulness(info, now); score < policy.MinScore {
+			stale[cpl] = append(stale[cpl], candidate{info.Id, score})
+		}
+	}
+
+	var evicted []peer.ID
+	for cpl, candidates := range stale {
+		excess := counts[cpl] - policy.BucketSize + 1
+		if excess <= 0 {
+			continue
+		}
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i].score < candidates[j].score })
+		if excess > len(candidates) {
+			excess = len(candidates)
+		}
+		for _, c := range candidates[:excess] {
+			evicted = append(evicted, c.id)
+		}
+	}
+	return evicted
+}
+
+// RunEviction 按策略的间隔定期驱逐过时的节点，直到上下文取消
+// 参数：
+//   - ctx: context.Context 上下文
+//   - policy: *EvictionPolicy 驱逐策略
+func (t *RoutingTracker) RunEviction(ctx context.Context, policy *EvictionPolicy) {
+	if t == nil || policy == nil || policy.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(policy.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if evicted := t.EvictStale(policy); len(evicted) > 0 {
+				logrus.Debugf("[%s]驱逐了 %d 个过时的路由表节点", debug.WhereAmI(), len(evicted))
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package defs
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/defs/peermode"
+	"github.com/bpfs/defs/stats"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Stats 获取节点统计信息的快照
+// 传输与存储字节数取自同一时刻的计数器，任务数量与节点数量取自内存中的状态，不扫描磁盘
+// 返回值：
+//   - *stats.Snapshot: 统计信息快照
+func (fs *FS) Stats() *stats.Snapshot {
+	snapshot := &stats.Snapshot{
+		Transfer:      fs.opt.GetCounters().Transfer(),
+		UploadTasks:   fs.upload.TaskStatusCounts(),
+		DownloadTasks: fs.download.TaskStatusCounts(),
+		Peers:         make(map[int]int),
+		TakenAt:       time.Now(),
+	}
+
+	// 各模式路由表中的节点数量
+	for _, mode := range []int{peermode.ModeClient, peermode.ModeServer} {
+		if table := fs.p2p.RoutingTable(mode); table != nil {
+			snapshot.Peers[mode] = table.Size()
+		}
+	}
+
+	// 持久化数据的大小
+	root := paths.GetRootPath()
+	snapshot.DBSize = stats.FilesSize(
+		filepath.Join(root, paths.GetUploadPath(), "tasks"),   // 上传任务
+		filepath.Join(root, paths.GetDownloadPath(), "tasks"), // 下载任务
+		filepath.Join(paths.GetDBDir(), "index"),              // 元数据索引
+	)
+
+	return snapshot
+}
+
+// RoutingMetrics 获取路由表的占用与变动指标
+// 参数：
+//   - mode: int 路由表模式(peermode.ModeClient 或 peermode.ModeServer)
+//
+// 返回值：
+//   - *stats.RoutingMetrics: 路由表指标，路由表不存在时返回 nil
+func (fs *FS) RoutingMetrics(mode int) *stats.RoutingMetrics {
+	return fs.routing[mode].Metrics()
+}
+
+// RoutingCollector 获取路由表指标的 Prometheus 收集器，注册到 Prometheus 后即可导出
+// 返回值：
+//   - prometheus.Collector: 路由表指标收集器
+func (fs *FS) RoutingCollector() prometheus.Collector {
+	trackers := make(map[string]*stats.RoutingTracker)
+	for mode, tracker := range fs.routing {
+		switch mode {
+		case peermode.ModeClient:
+			trackers["client"] = tracker
+		case peermode.ModeServer:
+			trackers["server"] = tracker
+		}
+	}
+	return stats.NewRoutingCollector(trackers)
+}
+
+// RoutingSnapshot 获取路由表的节点快照，与上一个快照比较即可得到节点的加入与移除
+// 参数：
+//   - mode: int 路由表模式(peermode.ModeClient 或 peermode.ModeServer)
+//
+// 返回值：
+//   - *stats.RoutingSnapshot: 路由表快照，路由表不存在时返回 nil
+func (fs *FS) RoutingSnapshot(mode int) *stats.RoutingSnapshot {
+	return fs.routing[mode].Snapshot()
+}
+
+// RoutingScores 获取路由表中各节点的有用性得分
+// 得分随节点上次对本节点有用以来的时间指数衰减，可作为节点信誉的参考
+// 参数：
+//   - mode: int 路由表模式(peermode.ModeClient 或 peermode.ModeServer)
+//
+// 返回值：
+//   - map[peer.ID]float64: 节点到得分的映射，路由表不存在时返回 nil
+func (fs *FS) RoutingScores(mode int) map[peer.ID]float64 {
+	return fs.routing[mode].Scores()
+}
+
+// TryAddPeers 批量将节点加入路由表
+// 参数：
+//   - mode: int 路由表模式(peermode.ModeClient 或 peermode.ModeServer)
+//   - peers: []peer.ID 待加入的节点
+//
+// 返回值：
+//   - []peer.ID: 新加入路由表的节点
+//   - map[peer.ID]error: 被路由表拒绝的节点及原因
+//   - error: 路由表不存在时返回包装了 errs.ErrInvalidArgument 的错误
+func (fs *FS) TryAddPeers(mode int, peers []peer.ID) ([]peer.ID, map[peer.ID]error, error) {
+	tracker, ok := fs.routing[mode]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: 路由表模式 %d", errs.ErrInvalidArgument, mode)
+	}
+	added, rejected := tracker.TryAddPeers(peers, mode, true)
+	return added, rejected, nil
+}
@@ -0,0 +1,350 @@
+// Package supervise 在子系统的后台任务边界上恢复 panic，避免一个任务的崩溃使整个节点退出。
+// 崩溃时记录错误与调用栈、发出崩溃事件，并调用子系统注册的保存函数持久化状态；
+// 之后按子系统的重启策略以退避间隔重新运行任务，短时间内崩溃过多时放弃重启。
+// 任务应按仅崩溃(crash-only)的方式编写：重新运行时从已保存的状态继续，而不依赖崩溃前的内存状态。
+package supervise
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/opts"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+)
+
+// HistorySize 保留的最近崩溃记录数量
+const HistorySize = 64
+
+// Crash 一次崩溃的记录
+type Crash struct {
+	Subsystem  string    // 子系统名称
+	Worker     string    // 后台任务名称
+	Value      string    // panic 的值
+	Stack      string    // 崩溃时的调用栈
+	Time       time.Time // 崩溃的时间
+	Restarts   int       // 崩溃前已重启的次数
+	Restarting bool      // 是否将重新运行
+	GaveUp     bool      // 是否因崩溃过多而放弃重启
+}
+
+// Error 返回崩溃的描述
+func (c Crash) Error() string {
+	return fmt.Sprintf("%s/%s 崩溃: %s", c.Subsystem, c.Worker, c.Value)
+}
+
+// Worker 后台任务的运行状态
+type Worker struct {
+	Subsystem string    // 子系统名称
+	Name      string    // 后台任务名称
+	Running   bool      // 是否正在运行或等待重启
+	Restarts  int       // 已重启的次数
+	Crashes   int       // 崩溃的次数
+	LastCrash time.Time // 最近一次崩溃的时间，没有崩溃时为零值
+	GaveUp    bool      // 是否因崩溃过多而放弃重启
+}
+
+// worker 受监管的后台任务
+type worker struct {
+	Worker
+	recent []time.Time // 统计窗口内的重启时间
+}
+
+// Supervisor 监管各子系统的后台任务
+type Supervisor struct {
+	ctx context.Context // 上下文，结束后不再重启任务
+	opt *opts.Options   // 文件存储选项配置
+
+	mu      sync.Mutex
+	workers map[string]*worker  // 子系统/任务名称到任务的映射
+	persist map[string][]func() // 子系统崩溃时调用的保存函数
+	history []Crash             // 最近的崩溃记录
+	crashes chan Crash          // 崩溃的通知
+}
+
+type NewSupervisorInput struct {
+	fx.In
+	Ctx context.Context // 全局上下文
+	Opt *opts.Options   // 文件存储选项配置
+}
+
+type NewSupervisorOutput struct {
+	fx.Out
+	Supervisor *Supervisor // 后台任务的崩溃恢复
+}
+
+// NewSupervisor 创建并初始化一个新的 Supervisor 实例。
+// 参数：
+//   - input: NewSupervisorInput 用于初始化 Supervisor 的输入结构体。
+//
+// 返回值：
+//   - NewSupervisorOutput: 包含 Supervisor 的输出结构体。
+func NewSupervisor(input NewSupervisorInput) (out NewSupervisorOutput) {
+	out.Supervisor = New(input.Ctx, input.Opt)
+	return out
+}
+
+// New 创建后台任务的监管者
+// 参数：
+//   - ctx: context.Context 上下文，结束后不再重启任务
+//   - opt: *opts.Options 文件存储选项配置
+//
+// 返回值：
+//   - *Supervisor: 监管者
+func New(ctx context.Context, opt *opts.Options) *Supervisor {
+	return &Supervisor{
+		ctx:     ctx,
+		opt:     opt,
+		workers: make(map[string]*worker),
+		persist: make(map[string][]func()),
+		crashes: make(chan Crash, 16),
+	}
+}
+
+// policy 获取子系统的重启策略
+func (s *Supervisor) policy(subsystem string) opts.RestartPolicy {
+	if s.opt == nil || s.opt.GetSupervisionConfig() == nil {
+		return opts.RestartPolicy{Mode: opts.RestartNever}
+	}
+	return s.opt.GetSupervisionConfig().Policy(subsystem)
+}
+
+// OnCrash 注册子系统崩溃时调用的保存函数，用于在重启前持久化状态
+// 参数：
+//   - subsystem: string 子系统名称
+//   - persist: func() 保存函数
+func (s *Supervisor) OnCrash(subsystem string, persist func()) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.persist[subsystem] = append(s.persist[subsystem], persist)
+}
+
+// Go 在新的协程中运行受监管的后台任务
+// 任务正常返回时结束；发生 panic 时记录崩溃，并按子系统的重启策略重新运行
+// 监管者为 nil 时直接运行任务，panic 只记录日志而不重启
+// 参数：
+//   - subsystem: string 子系统名称
+//   - name: string 后台任务名称
+//   - run: func() 后台任务
+func (s *Supervisor) Go(subsystem, name string, run func()) {
+	if s == nil {
+		go func() {
+			if value, stack, panicked := call(run); panicked {
+				logrus.Errorf("[%s/%s]后台任务崩溃: %v\n%s", subsystem, name, value, stack)
+			}
+		}()
+		return
+	}
+
+	key := subsystem + "/" + name
+	s.mu.Lock()
+	w, ok := s.workers[key]
+	if !ok {
+		w = &worker{Worker: Worker{Subsystem: subsystem, Name: name}}
+		s.workers[key] = w
+	}
+	w.Running = true
+	w.GaveUp = false
+	s.mu.Unlock()
+
+	go s.supervise(w, run)
+}
+
+// Recover 恢复一次性协程中的 panic，记录崩溃并调用保存函数，但不重新运行
+// 用法：在协程开头 defer s.Recover(子系统, 名称)
+// 参数：
+//   - subsystem: string 子系统名称
+//   - name: string 协程名称
+func (s *Supervisor) Recover(subsystem, name string) {
+	value := recover()
+	if value == nil {
+		return
+	}
+	crash := Crash{Subsystem: subsystem, Worker: name, Value: fmt.Sprint(value), Stack: string(debug.Stack()), Time: time.Now()}
+	if s == nil {
+		logrus.Errorf("[%s/%s]协程崩溃: %s\n%s", subsystem, name, crash.Value, crash.Stack)
+		return
+	}
+	s.report(crash)
+}
+
+// Spawn 在新的协程中运行一次性任务，panic 时记录崩溃并调用保存函数，但不重新运行
+// 用于按任务或按请求启动的短期协程，这类协程不计入 Workers
+// 参数：
+//   - subsystem: string 子系统名称
+//   - name: string 协程名称
+//   - run: func() 一次性任务
+func (s *Supervisor) Spawn(subsystem, name string, run func()) {
+	go func() {
+		defer s.Recover(subsystem, name)
+		run()
+	}()
+}
+
+// supervise 运行后台任务，崩溃后按重启策略重新运行
+func (s *Supervisor) supervise(w *worker, run func()) {
+	for {
+		value, stack, panicked := call(run)
+		if !panicked {
+			s.mu.Lock()
+			w.Running = false
+			s.mu.Unlock()
+			return
+		}
+
+		policy := s.policy(w.Subsystem)
+		now := time.Now()
+
+		s.mu.Lock()
+		// 只统计窗口内的重启
+		recent := w.recent[:0]
+		for _, t := range w.recent {
+			if policy.Window <= 0 || now.Sub(t) < policy.Window {
+				recent = append(recent, t)
+			}
+		}
+		w.recent = recent
+		restart := policy.Mode == opts.RestartOnPanic && s.ctx.Err() == nil &&
+			(policy.MaxRestarts == 0 || len(w.recent) < policy.MaxRestarts)
+
+		crash := Crash{
+			Subsystem:  w.Subsystem,
+			Worker:     w.Name,
+			Value:      fmt.Sprint(value),
+			Stack:      string(stack),
+			Time:       now,
+			Restarts:   w.Restarts,
+			Restarting: restart,
+			GaveUp:     !restart && policy.Mode == opts.RestartOnPanic && s.ctx.Err() == nil,
+		}
+		w.Crashes++
+		w.LastCrash = now
+		if restart {
+			w.recent = append(w.recent, now)
+			w.Restarts++
+		} else {
+			w.Running = false
+			w.GaveUp = crash.GaveUp
+		}
+		delay, restarts := backoff(policy, len(w.recent)), w.Restarts
+		s.mu.Unlock()
+
+		s.report(crash)
+		if !restart {
+			return
+		}
+
+		select {
+		case <-s.ctx.Done():
+			s.mu.Lock()
+			w.Running = false
+			s.mu.Unlock()
+			return
+		case <-time.After(delay):
+		}
+		logrus.Warnf("[%s/%s]重新运行崩溃的后台任务，第 %d 次重启", w.Subsystem, w.Name, restarts)
+	}
+}
+
+// report 记录崩溃，调用子系统的保存函数并发出通知
+func (s *Supervisor) report(crash Crash) {
+	logrus.Errorf("[%s/%s]后台任务崩溃: %s\n%s", crash.Subsystem, crash.Worker, crash.Value, crash.Stack)
+
+	s.mu.Lock()
+	s.history = append(s.history, crash)
+	if len(s.history) > HistorySize {
+		s.history = s.history[len(s.history)-HistorySize:]
+	}
+	persist := append([]func(){}, s.persist[crash.Subsystem]...)
+	s.mu.Unlock()
+
+	// 保存函数本身的崩溃只记录日志
+	for _, save := range persist {
+		if value, stack, panicked := call(save); panicked {
+			logrus.Errorf("[%s]崩溃后保存状态失败: %v\n%s", crash.Subsystem, value, stack)
+		}
+	}
+
+	select {
+	case s.crashes <- crash:
+	default:
+		// 没有及时读取时丢弃通知，崩溃记录仍可通过 History 获取
+	}
+}
+
+// call 运行函数并恢复其中的 panic
+// 返回值：
+//   - interface{}: panic 的值
+//   - []byte: 崩溃时的调用栈
+//   - bool: 是否发生了 panic
+func call(run func()) (value interface{}, stack []byte, panicked bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			value, stack, panicked = v, debug.Stack(), true
+		}
+	}()
+	run()
+	return nil, nil, false
+}
+
+// backoff 计算第 n 次重启前的等待时间
+func backoff(policy opts.RestartPolicy, n int) time.Duration {
+	delay := policy.Backoff
+	for i := 1; i < n && delay < policy.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if policy.MaxBackoff > 0 && delay > policy.MaxBackoff {
+		delay = policy.MaxBackoff
+	}
+	return delay
+}
+
+// Crashes 返回崩溃的通知通道，没有及时读取时丢弃通知
+func (s *Supervisor) Crashes() <-chan Crash {
+	return s.crashes
+}
+
+// History 获取最近的崩溃记录
+// 返回值：
+//   - []Crash: 按时间排列的崩溃记录，最多 HistorySize 条
+func (s *Supervisor) History() []Crash {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Crash(nil), s.history...)
+}
+
+// Workers 获取所有受监管的后台任务的运行状态
+// 返回值：
+//   - []Worker: 按子系统与任务名称排列的运行状态
+func (s *Supervisor) Workers() []Worker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	workers := make([]Worker, 0, len(s.workers))
+	for _, w := range s.workers {
+		workers = append(workers, w.Worker)
+	}
+	sort.Slice(workers, func(i, j int) bool {
+		if workers[i].Subsystem != workers[j].Subsystem {
+			return workers[i].Subsystem < workers[j].Subsystem
+		}
+		return workers[i].Name < workers[j].Name
+	})
+	return workers
+}
+
+// StreamPanic 记录流处理程序中的崩溃，流处理程序不重新运行，只记录并调用保存函数
+// 参数：
+//   - protocol: string 协议ID
+//   - value: interface{} panic 的值
+//   - stack: []byte 崩溃时的调用栈
+func (s *Supervisor) StreamPanic(protocol string, value interface{}, stack []byte) {
+	s.report(Crash{Subsystem: "network", Worker: protocol, Value: fmt.Sprint(value), Stack: string(stack), Time: time.Now()})
+}
@@ -0,0 +1,144 @@
+package supervise
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bpfs/defs/opts"
+)
+
+func newTestSupervisor(t *testing.T, policy opts.RestartPolicy) *Supervisor {
+	opt := opts.DefaultOptions()
+	if err := opt.BuildSupervisionConfig(&opts.SupervisionConfig{Default: policy}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return New(ctx, opt)
+}
+
+func waitCrash(t *testing.T, s *Supervisor) Crash {
+	t.Helper()
+	select {
+	case crash := <-s.Crashes():
+		return crash
+	case <-time.After(5 * time.Second):
+		t.Fatal("no crash reported")
+		return Crash{}
+	}
+}
+
+func TestSupervisorRestart(t *testing.T) {
+	s := newTestSupervisor(t, opts.RestartPolicy{Mode: opts.RestartOnPanic, MaxRestarts: 2, Window: time.Minute, Backoff: time.Millisecond, MaxBackoff: 4 * time.Millisecond})
+
+	var saved atomic.Int32
+	s.OnCrash("sub", func() { saved.Add(1) })
+	s.OnCrash("sub", func() { panic("save failed") })
+
+	// 前两次运行崩溃后重启，第三次运行正常返回
+	var runs atomic.Int32
+	done := make(chan struct{})
+	s.Go("sub", "loop", func() {
+		if runs.Add(1) <= 2 {
+			panic("boom")
+		}
+		close(done)
+	})
+
+	for i := 0; i < 2; i++ {
+		crash := waitCrash(t, s)
+		if crash.Subsystem != "sub" || crash.Worker != "loop" || crash.Value != "boom" || crash.Stack == "" {
+			t.Fatalf("crash = %+v", crash)
+		}
+		if !crash.Restarting || crash.GaveUp || crash.Restarts != i {
+			t.Fatalf("crash %d: restarting = %v, gave up = %v, restarts = %d", i, crash.Restarting, crash.GaveUp, crash.Restarts)
+		}
+	}
+	<-done
+	time.Sleep(10 * time.Millisecond)
+
+	// 保存函数本身崩溃不影响其他保存函数
+	if n := saved.Load(); n != 2 {
+		t.Fatalf("saved = %d, want 2", n)
+	}
+	workers := s.Workers()
+	if len(workers) != 1 || workers[0].Running || workers[0].Restarts != 2 || workers[0].Crashes != 2 || workers[0].LastCrash.IsZero() {
+		t.Fatalf("workers = %+v", workers)
+	}
+	if history := s.History(); len(history) != 2 {
+		t.Fatalf("history = %d, want 2", len(history))
+	}
+}
+
+func TestSupervisorGiveUp(t *testing.T) {
+	s := newTestSupervisor(t, opts.RestartPolicy{Mode: opts.RestartOnPanic, MaxRestarts: 1, Window: time.Minute, Backoff: time.Millisecond})
+
+	// 窗口内重启次数用完后放弃
+	s.Go("sub", "loop", func() { panic("boom") })
+	if crash := waitCrash(t, s); !crash.Restarting {
+		t.Fatalf("first crash not restarted: %+v", crash)
+	}
+	if crash := waitCrash(t, s); crash.Restarting || !crash.GaveUp {
+		t.Fatalf("second crash: restarting = %v, gave up = %v", crash.Restarting, crash.GaveUp)
+	}
+	if w := s.Workers()[0]; w.Running || !w.GaveUp {
+		t.Fatalf("worker = %+v", w)
+	}
+}
+
+func TestSupervisorNever(t *testing.T) {
+	s := newTestSupervisor(t, opts.RestartPolicy{Mode: opts.RestartNever})
+
+	var runs atomic.Int32
+	s.Go("sub", "loop", func() {
+		runs.Add(1)
+		panic("boom")
+	})
+	if crash := waitCrash(t, s); crash.Restarting || crash.GaveUp {
+		t.Fatalf("crash = %+v", crash)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := runs.Load(); n != 1 {
+		t.Fatalf("runs = %d, want 1", n)
+	}
+}
+
+func TestSupervisorRecover(t *testing.T) {
+	s := newTestSupervisor(t, opts.DefaultSupervisionConfig().Default)
+
+	go func() {
+		defer s.Recover("sub", "once")
+		panic("boom")
+	}()
+	if crash := waitCrash(t, s); crash.Worker != "once" || crash.Restarting {
+		t.Fatalf("crash = %+v", crash)
+	}
+
+	s.Spawn("sub", "spawned", func() { panic("boom") })
+	if crash := waitCrash(t, s); crash.Worker != "spawned" || crash.Restarting {
+		t.Fatalf("crash = %+v", crash)
+	}
+	if len(s.Workers()) != 0 {
+		t.Fatalf("spawned task listed as worker: %+v", s.Workers())
+	}
+
+	// 监管者为 nil 时仍恢复 panic
+	var nilSupervisor *Supervisor
+	done := make(chan struct{})
+	nilSupervisor.Go("sub", "loop", func() {
+		defer close(done)
+		panic("boom")
+	})
+	<-done
+}
+
+func TestBackoff(t *testing.T) {
+	policy := opts.RestartPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	for n, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		if got := backoff(policy, n); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", n, got, want)
+		}
+	}
+}
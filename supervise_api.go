@@ -0,0 +1,24 @@
+package defs
+
+import (
+	"github.com/bpfs/defs/supervise"
+)
+
+// Workers 获取各子系统后台任务的运行状态，包括崩溃与重启次数
+// 返回值：
+//   - []supervise.Worker: 按子系统与任务名称排列的运行状态
+func (fs *FS) Workers() []supervise.Worker {
+	return fs.supervisor.Workers()
+}
+
+// Crashes 获取后台任务与流处理程序崩溃的通知通道，没有及时读取时丢弃通知
+func (fs *FS) Crashes() <-chan supervise.Crash {
+	return fs.supervisor.Crashes()
+}
+
+// CrashHistory 获取最近的崩溃记录
+// 返回值：
+//   - []supervise.Crash: 按时间排列的崩溃记录
+func (fs *FS) CrashHistory() []supervise.Crash {
+	return fs.supervisor.History()
+}
@@ -0,0 +1,155 @@
+package uploads
+
+import (
+	stdgzip "compress/gzip"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/zip/gzip"
+	"github.com/sirupsen/logrus"
+)
+
+// CodecGzip 分片前使用 gzip 压缩文件内容
+const CodecGzip = "gzip"
+
+const (
+	minCompressSize  = 4 << 10  // 小于该大小的文件不压缩，节省的空间不足以抵消开销
+	compressSample   = 64 << 10 // 判断是否值得压缩时试压缩的样本大小
+	minCompressRatio = 0.9      // 压缩后大小超过原大小的该比例时视为不可压缩
+)
+
+// incompressibleTypes 内容已经压缩过的 MIME 类型前缀
+var incompressibleTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/x-bzip2",
+	"application/x-xz",
+	"application/zstd",
+	"application/vnd.openxmlformats-officedocument.",
+}
+
+// incompressibleExtensions 内容已经压缩过的文件扩展名
+var incompressibleExtensions = map[string]bool{
+	".zip": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".7z": true,
+	".rar": true, ".zst": true, ".jpg": true, ".jpeg": true, ".png": true, ".gif": true,
+	".webp": true, ".heic": true, ".mp3": true, ".mp4": true, ".mkv": true, ".mov": true,
+	".avi": true, ".docx": true, ".xlsx": true, ".pptx": true, ".apk": true, ".jar": true,
+}
+
+// skipCompression 根据文件的类型和大小判断是否跳过压缩
+func (meta *FileMeta) skipCompression() bool {
+	if meta.Size < minCompressSize || incompressibleExtensions[strings.ToLower(meta.Extension)] {
+		return true
+	}
+	for _, prefix := range incompressibleTypes {
+		if strings.HasPrefix(meta.ContentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// compressible 检查压缩后的大小是否足够小
+func compressible(original, compressed int) bool {
+	return float64(compressed) <= float64(original)*minCompressRatio
+}
+
+// compressContent 在分片前压缩文件内容，并在元数据中记录压缩算法
+// 文件内容以流的方式压缩到临时文件，不会整个读入内存
+// 未开启压缩、文件类型不可压缩或试压缩样本效果不佳时，返回原始内容
+// 参数：
+//   - opt: *opts.Options 文件存储选项
+//   - meta: *FileMeta 文件元数据，压缩时更新 Codec 与 StoredSize
+//   - file: afero.File 文件对象
+//   - dir: string 保存压缩内容的临时目录
+//
+// 返回值：
+//   - io.Reader: 用于分片的内容
+//   - func(): 分片完成后删除临时文件的函数
+//   - error: 如果发生错误，返回错误信息
+func compressContent(opt *opts.Options, meta *FileMeta, file afero.File, dir string) (io.Reader, func(), error) {
+	meta.StoredSize = meta.Size
+	if !opt.GetCompressUploads() || meta.skipCompression() {
+		return file, func() {}, nil
+	}
+
+	// 先压缩样本，避免对不可压缩的内容做完整压缩
+	if meta.Size > compressSample {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+			return nil, nil, err
+		}
+		sample := make([]byte, compressSample)
+		if _, err := io.ReadFull(file, sample); err != nil {
+			logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+			return nil, nil, err
+		}
+		compressed, err := gzip.CompressData(sample)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !compressible(compressSample, len(compressed)) {
+			return rewind(file)
+		}
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return nil, nil, err
+	}
+	temp, err := os.CreateTemp(dir, "content-*.gz")
+	if err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return nil, nil, err
+	}
+	cleanup := func() {
+		temp.Close()
+		os.Remove(temp.Name())
+	}
+
+	w := stdgzip.NewWriter(temp)
+	if _, err := io.Copy(w, file); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	if err := w.Close(); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	size, err := temp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	if !compressible(int(meta.Size), int(size)) {
+		cleanup()
+		return rewind(file)
+	}
+	if _, err := temp.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	meta.Codec = CodecGzip
+	meta.StoredSize = size
+	return temp, cleanup, nil
+}
+
+// rewind 回到文件开头，返回未压缩的原始内容
+func rewind(file afero.File) (io.Reader, func(), error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return nil, nil, err
+	}
+	return file, func() {}, nil
+}
@@ -0,0 +1,167 @@
+package uploads
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/network"
+	"github.com/bpfs/defs/network/datagram"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/stats"
+	"github.com/bpfs/defs/util"
+
+	"github.com/bpfs/dep2p"
+	"github.com/bpfs/dep2p/streams"
+	"github.com/libp2p/go-libp2p/core/peer"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"github.com/sirupsen/logrus"
+)
+
+// datagramTakeTimeout 等待数据报传输的数据登记完成的最长时间
+const datagramTakeTimeout = 5 * time.Second
+
+// 协商数据报传输的请求消息
+type DatagramNegotiateReq struct {
+	Size int // 待传输的数据大小
+}
+
+// 协商数据报传输的响应消息
+type DatagramNegotiateRes struct {
+	Port  int    // 接收端监听的 UDP 端口
+	Token []byte // 传输令牌
+}
+
+// handleDatagramNegotiate 处理数据报传输的协商
+func (sp *StreamProtocol) handleDatagramNegotiate(req *streams.RequestMessage, res *streams.ResponseMessage) (int32, string) {
+	if sp.Datagram == nil {
+		return 6609, "未启用数据报传输"
+	}
+	if sp.Opt.GetReadOnly() {
+		return 6610, "只读节点不接受文件片段"
+	}
+
+	payload := new(DatagramNegotiateReq)
+	if err := util.DecodeFromBytes(req.Payload, payload); err != nil {
+		logrus.Errorf("[%s]解码错误: %v", debug.WhereAmI(), err)
+		return 6603, "解码错误"
+	}
+	if payload.Size <= 0 || int64(payload.Size) > sp.Opt.GetMaxSliceSize() {
+		return 6609, "数据大小超出限制"
+	}
+
+	sender, err := peer.Decode(req.Message.GetSender())
+	if err != nil {
+		return 6603, "解码错误"
+	}
+	token, err := sp.Datagram.Expect(sender, payload.Size)
+	if errors.Is(err, errs.ErrQuotaExceeded) {
+		logrus.Warnf("[%s]拒绝节点 %s 的数据报传输: %v", debug.WhereAmI(), sender, err)
+		return 6613, "数据报传输繁忙"
+	}
+	if err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return 500, "生成传输令牌失败"
+	}
+
+	negotiateBytes, err := util.EncodeToBytes(DatagramNegotiateRes{
+		Port:  sp.Datagram.Port(),
+		Token: token,
+	})
+	if err != nil {
+		return 6605, fmt.Sprintf("%s", err)
+	}
+
+	res.Data = negotiateBytes
+	return 200, "成功"
+}
+
+// takeDatagram 取出通过数据报传输的切片内容
+func (sp *StreamProtocol) takeDatagram(token []byte) ([]byte, error) {
+	if sp.Datagram == nil {
+		return nil, fmt.Errorf("未启用数据报传输")
+	}
+	ctx, cancel := context.WithTimeout(sp.Ctx, datagramTakeTimeout)
+	defer cancel()
+	sliceByte, ok := sp.Datagram.Take(ctx, token)
+	if !ok {
+		return nil, fmt.Errorf("数据报传输的数据不存在或未接收完成")
+	}
+	return sliceByte, nil
+}
+
+// datagramConfig 返回向节点传输切片内容的数据报参数，未启用数据报传输时为 nil
+// 启用前向纠错且节点链路估计的丢包率达到阈值时，为数据包附加校验包
+// 参数：
+//   - opt: *opts.Options 文件存储选项配置
+//   - node: peer.ID 目标节点
+//
+// 返回值：
+//   - *datagram.Config: 数据报传输参数
+func datagramConfig(opt *opts.Options, node peer.ID) *datagram.Config {
+	if opt.GetDatagramTransport() == "" {
+		return nil
+	}
+	cfg := datagram.DefaultConfig()
+	if fec := opt.GetWireFECConfig(); fec.Enabled && opt.GetLinkLoss().Loss(node) >= fec.LossThreshold {
+		cfg.FECGroup = fec.GroupSize
+	}
+	return cfg
+}
+
+// sendSliceDatagram 与目标节点协商并通过数据报传输切片内容
+// 传输完成后按重传统计更新节点链路的丢包率估计
+// 参数：
+//   - ctx: context.Context 上下文
+//   - p2p: *dep2p.DeP2P 网络主机
+//   - node: peer.ID 目标节点
+//   - sliceByte: []byte 切片内容
+//   - cfg: *datagram.Config 数据报传输参数
+//   - links: *stats.LinkLoss 节点链路的丢包率估计
+//
+// 返回值：
+//   - []byte: 传输令牌，接收端凭此取出切片内容
+//   - error: 协商或传输失败时返回错误
+func sendSliceDatagram(ctx context.Context, p2p *dep2p.DeP2P, node peer.ID, sliceByte []byte, cfg *datagram.Config, links *stats.LinkLoss) ([]byte, error) {
+	// 数据报传输使用与现有连接相同的 IP 地址
+	conns := p2p.Host().Network().ConnsToPeer(node)
+	if len(conns) == 0 {
+		return nil, fmt.Errorf("与节点 %s 没有连接", node.String())
+	}
+	ip, err := manet.ToIP(conns[0].RemoteMultiaddr())
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := network.SendStreamContext(ctx, p2p, StreamDatagramNegotiateProtocol, "", node, DatagramNegotiateReq{Size: len(sliceByte)})
+	if err != nil {
+		return nil, err
+	}
+	if res == nil || res.Code != 200 || res.Data == nil {
+		return nil, fmt.Errorf("节点 %s 不支持数据报传输", node.String())
+	}
+
+	negotiate := new(DatagramNegotiateRes)
+	if err := util.DecodeFromBytes(res.Data, negotiate); err != nil {
+		return nil, err
+	}
+
+	addr := net.JoinHostPort(ip.String(), strconv.Itoa(negotiate.Port))
+	sent, err := datagram.SendToWithStats(ctx, addr, negotiate.Token, sliceByte, cfg)
+	if err != nil {
+		if errors.Is(err, datagram.ErrGaveUp) {
+			links.Record(node, 1) // 超过重传次数，视为链路严重丢包
+		}
+		return nil, err
+	}
+	links.Record(node, sent.Loss())
+	if sent.Parity > 0 {
+		logrus.Debugf("[%s]向节点 %s 的数据报传输使用前向纠错，恢复 %d 个数据包，重传 %d 个数据包", debug.WhereAmI(), node.String(), sent.Recovered, sent.Retransmits)
+	}
+	return negotiate.Token, nil
+}
@@ -0,0 +1,213 @@
+package uploads
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/delta"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/defs/util"
+	"github.com/bpfs/dep2p"
+	"github.com/bpfs/dep2p/pubsub"
+	"github.com/sirupsen/logrus"
+)
+
+// DeltaUploadInfo 增量上传成功后的返回信息
+// FileID 指向增量清单文件而不是完整的新版本，下载该文件得到的是增量清单，需配合 Parent 指向的上一版本合并
+type DeltaUploadInfo struct {
+	*UploadSuccessInfo        // 增量清单文件的上传信息
+	Parent             string // 上一版本的文件唯一标识
+	VersionSize        int64  // 新版本的文件大小
+	UploadedSize       int64  // 实际上传的新增内容大小
+}
+
+// NewUploadDelta 以增量方式上传文件的新版本
+// 新版本与上一版本的块清单比较后，只上传发生变化的块，未变化的块引用上一版本的内容。
+// 上一版本须在开启 opts.BuildDeltaManifests 时上传，本节点才保存有它的块清单。
+// 上传的是增量清单文件，下载流程不会自动合并：下载方需同时持有上一版本，
+// 下载增量清单后调用 delta.ApplyFile(上一版本路径, 增量清单路径, 输出路径) 得到新版本。
+// 参数：
+//   - opt: *opts.Options 文件存储选项配置。
+//   - afe: afero.Afero 文件系统接口。
+//   - p2p: *dep2p.DeP2P 网络主机。
+//   - pubsub: *pubsub.DeP2PPubSub 网络订阅。
+//   - path: string 新版本的文件路径。
+//   - parentID: string 上一版本的文件唯一标识，必须由本节点上传过。
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥。
+//
+// 返回值：
+//   - *DeltaUploadInfo: 增量上传成功后的返回信息。
+//   - error: 如果发生错误，返回错误信息。
+func (manager *UploadManager) NewUploadDelta(
+	opt *opts.Options, // 文件存储选项配置
+	afe afero.Afero, // 文件系统接口
+	p2p *dep2p.DeP2P, // 网络主机
+	pubsub *pubsub.DeP2PPubSub, // 网络订阅
+	path string, // 新版本的文件路径
+	parentID string, // 上一版本的文件唯一标识
+	ownerPriv *ecdsa.PrivateKey, // 所有者的私钥
+) (*DeltaUploadInfo, error) {
+	return manager.NewUploadDeltaContext(context.Background(), opt, afe, p2p, pubsub, path, parentID, ownerPriv)
+}
+
+// NewUploadDeltaContext 以增量方式上传文件的新版本，ctx 结束时上传任务随之取消
+func (manager *UploadManager) NewUploadDeltaContext(
+	ctx context.Context, // 上传任务的上下文
+	opt *opts.Options, // 文件存储选项配置
+	afe afero.Afero, // 文件系统接口
+	p2p *dep2p.DeP2P, // 网络主机
+	pubsub *pubsub.DeP2PPubSub, // 网络订阅
+	path string, // 新版本的文件路径
+	parentID string, // 上一版本的文件唯一标识
+	ownerPriv *ecdsa.PrivateKey, // 所有者的私钥
+) (*DeltaUploadInfo, error) {
+	if err := opt.CheckWritable("增量上传文件"); err != nil {
+		return nil, err
+	}
+	path = strings.TrimSpace(path) // 删除了所有前导和尾随空格
+	if path == "" {
+		return nil, fmt.Errorf("%w: 文件路径不可为空", errs.ErrInvalidArgument)
+	}
+
+	// 加载上一版本的块清单
+	parent, err := LoadManifest(afe, parentID)
+	if err != nil {
+		logrus.Errorf("[%s]加载上一版本的块清单时失败(上传上一版本时需开启块清单): %v", debug.WhereAmI(), err)
+		return nil, err
+	}
+
+	// 增量清单直接写入临时文件后按普通文件上传，文件名沿用新版本的文件名
+	tempDir, err := os.MkdirTemp(filepath.Join(paths.GetRootPath(), paths.GetUploadPath()), "delta-")
+	if err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir) // 上传任务创建时已读取全部内容
+
+	deltaPath := filepath.Join(tempDir, filepath.Base(path)+".delta")
+	manifest, uploadedSize, err := writeDelta(parent, path, deltaPath)
+	if err != nil {
+		logrus.Errorf("[%s]计算增量时失败: %v", debug.WhereAmI(), err)
+		return nil, err
+	}
+
+	info, err := manager.upload(ctx, opt, afe, p2p, pubsub, deltaPath, ownerPriv, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	// 新版本的块清单保存在增量清单文件的唯一标识下，支持连续的增量版本
+	manifest.FileID = info.FileID
+	if err := SaveManifest(afe, manifest); err != nil {
+		logrus.Warnf("[%s]保存块清单时失败: %v", debug.WhereAmI(), err)
+	}
+
+	return &DeltaUploadInfo{
+		UploadSuccessInfo: info,
+		Parent:            parentID,
+		VersionSize:       manifest.Size,
+		UploadedSize:      uploadedSize,
+	}, nil
+}
+
+// writeDelta 比较新版本与上一版本的块清单，将增量清单写入文件
+// 返回值：
+//   - *delta.Manifest: 新版本的块清单
+//   - int64: 新增内容的总大小
+//   - error: 如果发生错误，返回错误信息
+func writeDelta(parent *delta.Manifest, path, deltaPath string) (*delta.Manifest, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	out, err := os.Create(deltaPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	manifest, uploadedSize, err := delta.Diff(parent, file, out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return manifest, uploadedSize, nil
+}
+
+// manifestFilePath 获取块清单的文件路径
+func manifestFilePath(fileID string) string {
+	return filepath.Join(paths.GetManifestPath(), fileID+".json")
+}
+
+// saveFileManifest 开启块清单时对本地文件分块并保存块清单，失败只记录日志
+func saveFileManifest(opt *opts.Options, afe afero.Afero, fileID, path string) {
+	if !opt.GetDeltaManifests() {
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		logrus.Warnf("[%s]保存块清单时失败: %v", debug.WhereAmI(), err)
+		return
+	}
+	defer file.Close()
+
+	manifest, err := delta.NewManifest(fileID, file)
+	if err != nil {
+		logrus.Warnf("[%s]保存块清单时失败: %v", debug.WhereAmI(), err)
+		return
+	}
+	if err := SaveManifest(afe, manifest); err != nil {
+		logrus.Warnf("[%s]保存块清单时失败: %v", debug.WhereAmI(), err)
+	}
+}
+
+// SaveManifest 保存文件版本的块清单
+// 参数：
+//   - afe: afero.Afero 文件系统接口
+//   - manifest: *delta.Manifest 块清单
+//
+// 返回值：
+//   - error: 如果发生错误，返回错误信息
+func SaveManifest(afe afero.Afero, manifest *delta.Manifest) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := afe.MkdirAll(paths.GetManifestPath(), 0755); err != nil {
+		return err
+	}
+
+	return util.WriteFileAtomic(afe, manifestFilePath(manifest.FileID), data, 0644)
+}
+
+// LoadManifest 加载文件版本的块清单
+// 参数：
+//   - afe: afero.Afero 文件系统接口
+//   - fileID: string 文件唯一标识
+//
+// 返回值：
+//   - *delta.Manifest: 块清单
+//   - error: 块清单不存在或解析失败时返回错误
+func LoadManifest(afe afero.Afero, fileID string) (*delta.Manifest, error) {
+	data, err := afero.ReadFile(afe, manifestFilePath(fileID))
+	if err != nil {
+		return nil, fmt.Errorf("%w: 文件 %s 的块清单: %v", errs.ErrNotFound, fileID, err)
+	}
+	manifest := new(delta.Manifest)
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
@@ -0,0 +1,112 @@
+package uploads
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/bpfs/defs/errs"
+)
+
+// UploadDetail 上传任务的详细进度，包括各存储节点的片段分布
+type UploadDetail struct {
+	TaskID            string          // 任务唯一标识
+	FileID            string          // 文件唯一标识
+	Status            UploadStatus    // 上传任务的状态
+	TotalSegments     int             // 文件总分片数
+	CompletedSegments int             // 已完成上传的片段数量
+	Peers             []*PeerProgress // 各存储节点的片段分布，按节点ID排列
+}
+
+// Detail 获取上传任务的详细进度
+// 返回值：
+//   - *UploadDetail: 上传任务的详细进度
+func (task *UploadTask) Detail() *UploadDetail {
+	task.Mu.RLock()
+	status := task.Status
+	task.Mu.RUnlock()
+
+	completed := 0
+	for _, segment := range task.File.Segments {
+		if segment.Status == SegmentStatusCompleted {
+			completed++
+		}
+	}
+
+	detail := &UploadDetail{
+		TaskID:            task.TaskID,
+		FileID:            task.File.FileID,
+		Status:            status,
+		TotalSegments:     len(task.File.Segments),
+		CompletedSegments: completed,
+	}
+	if task.placement != nil {
+		detail.Peers = task.placement.peers()
+	}
+	return detail
+}
+
+// UploadDetail 获取指定上传任务的详细进度
+// 参数：
+//   - taskID: string 任务唯一标识
+//
+// 返回值：
+//   - *UploadDetail: 上传任务的详细进度
+//   - error: 任务不存在时返回包装了 errs.ErrTaskNotFound 的错误
+func (manager *UploadManager) UploadDetail(taskID string) (*UploadDetail, error) {
+	manager.Mu.Lock()
+	task, ok := manager.Tasks[taskID]
+	manager.Mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: 上传任务 %s", errs.ErrTaskNotFound, taskID)
+	}
+	return task.Detail(), nil
+}
+
+// ListUploadDetails 列出所有上传任务的详细进度
+// 返回值：
+//   - []*UploadDetail: 按任务ID排列的上传任务详细进度
+func (manager *UploadManager) ListUploadDetails() []*UploadDetail {
+	manager.Mu.Lock()
+	tasks := make([]*UploadTask, 0, len(manager.Tasks))
+	for _, task := range manager.Tasks {
+		tasks = append(tasks, task)
+	}
+	manager.Mu.Unlock()
+
+	details := make([]*UploadDetail, 0, len(tasks))
+	for _, task := range tasks {
+		details = append(details, task.Detail())
+	}
+	sort.Slice(details, func(i, j int) bool { return details[i].TaskID < details[j].TaskID })
+	return details
+}
+
+// UploadDetailContext 获取指定上传任务的详细进度，ctx 已结束时返回其错误
+// 参数：
+//   - ctx: context.Context 调用的上下文
+//   - taskID: string 任务唯一标识
+//
+// 返回值：
+//   - *UploadDetail: 上传任务的详细进度
+//   - error: 任务不存在时返回包装了 errs.ErrTaskNotFound 的错误
+func (manager *UploadManager) UploadDetailContext(ctx context.Context, taskID string) (*UploadDetail, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return manager.UploadDetail(taskID)
+}
+
+// ListUploadDetailsContext 列出所有上传任务的详细进度，ctx 已结束时返回其错误
+// 参数：
+//   - ctx: context.Context 调用的上下文
+//
+// 返回值：
+//   - []*UploadDetail: 按任务ID排列的上传任务详细进度
+//   - error: ctx 已结束时返回其错误
+func (manager *UploadManager) ListUploadDetailsContext(ctx context.Context) ([]*UploadDetail, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return manager.ListUploadDetails(), nil
+}
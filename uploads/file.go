@@ -44,8 +44,8 @@ func NewUploadFile(opt *opts.Options, ownerPriv *ecdsa.PrivateKey, file afero.Fi
 		return nil, err
 	}
 
-	// 使用文件所有者的私钥和FileID生成秘密
-	secret, err := util.GenerateSecretFromPrivateKeyAndChecksum(ownerPriv, []byte(fileMeta.FileID))
+	// 获取文件加密密钥，默认由文件所有者的私钥和FileID生成
+	secret, err := opt.GetKeyProvider().FileKey(ownerPriv, fileMeta.FileID)
 	if err != nil {
 		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
 		return nil, err
@@ -66,16 +66,36 @@ func NewUploadFile(opt *opts.Options, ownerPriv *ecdsa.PrivateKey, file afero.Fi
 		return nil, err
 	}
 
+	// 加密文件元数据，仅所有者及被授权的身份可以解密
+	if opt.GetEncryptMetadata() {
+		fileSecurity.Metadata, err = util.SealMetadata(ownerPriv, &util.FileMetadata{
+			Name:        fileMeta.Name,
+			ContentType: fileMeta.ContentType,
+		}, opt.GetMetadataGrantees()...)
+		if err != nil {
+			logrus.Errorf("[%s]加密文件元数据时失败: %v", debug.WhereAmI(), err)
+			return nil, err
+		}
+	}
+
+	// 按需在分片前压缩文件内容，压缩后的内容同时减少存储和纠删码的开销
+	content, cleanup, err := compressContent(opt, fileMeta, file, tempStorage)
+	if err != nil {
+		logrus.Errorf("[%s]压缩文件内容时失败: %v", debug.WhereAmI(), err)
+		return nil, err
+	}
+	defer cleanup()
+
 	// 根据文件大小和存储选项计算数据分片和奇偶校验分片的数量
 	dataShards, parityShards, err := fileMeta.CalculateShards(opt)
 	if err != nil {
 		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
 		return nil, err
 	}
-	capacity := fileMeta.Size + opt.GetDefaultBufSize()
+	capacity := fileMeta.StoredSize + opt.GetDefaultBufSize()
 
 	// 创建并初始化一个新的FileSegment实例，提供分片的详细信息及其上传状态
-	segments, err := NewFileSegment(opt, file, fileMeta.FileID, capacity, dataShards, parityShards)
+	segments, err := NewFileSegment(opt, content, fileMeta.FileID, capacity, dataShards, parityShards)
 	if err != nil {
 		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
 		return nil, err
@@ -98,6 +118,8 @@ func NewUploadFile(opt *opts.Options, ownerPriv *ecdsa.PrivateKey, file afero.Fi
 	u.Size = fileMeta.Size               // 文件大小，单位为字节，描述文件的总大小
 	u.ContentType = fileMeta.ContentType // MIME类型，表示文件的内容类型，如"text/plain"
 	u.Checksum = fileMeta.Checksum       // 文件的校验和，用于在上传前后验证文件的完整性和一致性
+	u.Codec = fileMeta.Codec             // 分片前对内容使用的压缩算法
+	u.StoredSize = fileMeta.StoredSize   // 参与分片的内容大小
 
 	return u, nil
 }
@@ -0,0 +1,131 @@
+package uploads
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// HealthGrade 文件冗余健康等级
+type HealthGrade string
+
+const (
+	GradeHealthy  HealthGrade = "healthy"  // 所有片段的存储节点均可达
+	GradeDegraded HealthGrade = "degraded" // 部分片段不可达，剩余片段仍有冗余
+	GradeAtRisk   HealthGrade = "at-risk"  // 可达片段不多于恢复所需的数量，再失去一个片段即无法恢复
+)
+
+// DefaultProbeTimeout 探测单个存储节点的默认超时
+const DefaultProbeTimeout = 10 * time.Second
+
+// AssetHealth 单个文件当前的冗余状况
+type AssetHealth struct {
+	FileID      string      // 文件唯一标识
+	Name        string      // 文件名
+	Required    int         // 恢复文件所需的片段数
+	Total       int         // 上传时的片段总数
+	Reachable   int         // 存储节点可达的片段数
+	Unreachable []int       // 存储节点不可达的片段索引
+	Grade       HealthGrade // 健康等级
+	Actions     []string    // 建议的修复操作
+	CheckedAt   int64       // 检查的时间戳
+}
+
+// Prober 探测存储节点是否可达
+type Prober func(ctx context.Context, node peer.ID) error
+
+// HostProber 返回通过网络主机探测节点的函数，已连接的节点直接视为可达，否则尝试在超时内建立连接
+// 参数：
+//   - h: host.Host 网络主机
+//   - timeout: time.Duration 单个节点的探测超时
+//
+// 返回值：
+//   - Prober: 探测函数
+func HostProber(h host.Host, timeout time.Duration) Prober {
+	return func(ctx context.Context, node peer.ID) error {
+		if h.Network().Connectedness(node) == network.Connected {
+			return nil
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return h.Connect(ctx, peer.AddrInfo{ID: node})
+	}
+}
+
+// CheckHealth 探测完整性报告中各片段的存储节点，评估文件当前的冗余状况
+// 每个节点只探测一次，存放在同一节点上的片段共享探测结果
+// 参数：
+//   - ctx: context.Context 上下文，取消时中止探测
+//   - report: *IntegrityReport 文件上传完成时的完整性报告
+//   - probe: Prober 探测函数
+//
+// 返回值：
+//   - *AssetHealth: 文件的冗余状况
+func CheckHealth(ctx context.Context, report *IntegrityReport, probe Prober) *AssetHealth {
+	nodes := make(map[peer.ID]bool)
+	for _, segment := range report.Segments {
+		if segment.Peer != "" {
+			nodes[segment.Peer] = false
+		}
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for node := range nodes {
+		wg.Add(1)
+		go func(node peer.ID) {
+			defer wg.Done()
+			reachable := probe(ctx, node) == nil
+			mu.Lock()
+			nodes[node] = reachable
+			mu.Unlock()
+		}(node)
+	}
+	wg.Wait()
+
+	health := &AssetHealth{
+		FileID:    report.FileID,
+		Name:      report.Name,
+		Required:  report.DataShards,
+		Total:     len(report.Segments),
+		CheckedAt: time.Now().Unix(),
+	}
+	for _, segment := range report.Segments {
+		if nodes[segment.Peer] {
+			health.Reachable++
+			continue
+		}
+		health.Unreachable = append(health.Unreachable, segment.Index)
+		health.Actions = append(health.Actions, fmt.Sprintf("重新上传片段 %d(%s)，原存储节点 %s 不可达", segment.Index, segment.SegmentID, segment.Peer))
+	}
+	sort.Ints(health.Unreachable)
+	health.Grade = grade(health.Reachable, health.Required, health.Total)
+
+	switch {
+	case health.Reachable < health.Required:
+		health.Actions = append(health.Actions, "可达片段不足以恢复文件，请在节点恢复后立即下载或从本地副本重新上传")
+	case health.Grade == GradeAtRisk:
+		health.Actions = append(health.Actions, "已没有冗余片段，请优先修复")
+	}
+	return health
+}
+
+// grade 根据可达片段数评定健康等级
+func grade(reachable, required, total int) HealthGrade {
+	switch {
+	case reachable >= total:
+		return GradeHealthy
+	case reachable > required:
+		return GradeDegraded
+	default:
+		return GradeAtRisk
+	}
+}
@@ -12,6 +12,8 @@ import (
 	"github.com/bpfs/defs/opts"
 	"github.com/bpfs/defs/paths"
 	"github.com/bpfs/defs/shamir"
+	"github.com/bpfs/defs/supervise"
+	"github.com/bpfs/defs/util"
 	"github.com/bpfs/dep2p"
 	"github.com/bpfs/dep2p/pubsub"
 	"github.com/sirupsen/logrus"
@@ -28,12 +30,24 @@ type UploadManager struct {
 	UploadChan      chan *UploadChan       // 上传状态更新通道，用于通知外部上传进度和状态
 	SaveTasksToFile chan struct{}          // 保存任务至文件通道
 	Scheme          *shamir.ShamirScheme   // 创建一个新的ShamirScheme实例
+	recovery        *RecoveryReport        // 启动时核对任务状态的结果
+	progress        *util.Coalescer        // 合并片段完成后的任务保存
+	supervisor      *supervise.Supervisor  // 后台任务的崩溃恢复
+	opt             *opts.Options          // 文件存储选项配置
+
+	powerWake   chan struct{}   // 电源或网络状态变化的通知
+	powerPaused map[string]bool // 因电源状态暂停的任务，条件恢复后自动继续
+	powerState  opts.PowerState // 最近一次获取的电源与网络状态
+	powerReason string          // 暂停后台上传的原因，为空时未暂停
 }
 
 type NewUploadManagerInput struct {
 	fx.In
-	LC  fx.Lifecycle
-	Ctx context.Context // 全局上下文
+	LC         fx.Lifecycle
+	Ctx        context.Context       // 全局上下文
+	Opt        *opts.Options         // 文件存储选项配置
+	Afe        afero.Afero           // 文件系统接口
+	Supervisor *supervise.Supervisor // 后台任务的崩溃恢复
 }
 
 type NewUploadManagerOutput struct {
@@ -53,7 +67,14 @@ func NewUploadManager(input NewUploadManagerInput) (out NewUploadManagerOutput,
 		UploadChan:      make(chan *UploadChan),                                // 上传对外通道
 		SaveTasksToFile: make(chan struct{}, 1),                                // 保存任务至文件通道，缓冲区大小为1，只保存最新的信息
 		Scheme:          shamir.NewShamirScheme(TotalShares, Threshold, prime), // 创建一个新的ShamirScheme实例
+		powerWake:       make(chan struct{}, 1),                                // 电源状态变化的通知，只保留最新的一次
+		powerPaused:     make(map[string]bool),                                 // 因电源状态暂停的任务
+		powerState:      opts.PowerState{Battery: -1},                          // 尚未获取电源状态
+		supervisor:      input.Supervisor,                                      // 后台任务的崩溃恢复
+		opt:             input.Opt,                                             // 文件存储选项配置
 	}
+	flush := input.Opt.GetProgressFlushConfig()
+	upload.progress = util.NewCoalescer(flush.Interval, flush.MaxPending, upload.SaveTasksToFileSingleChan)
 
 	filePath := filepath.Join(paths.GetRootPath(), paths.GetUploadPath(), "tasks") // 设置子目录
 	// 加载任务
@@ -66,17 +87,29 @@ func NewUploadManager(input NewUploadManagerInput) (out NewUploadManagerOutput,
 		}
 	}
 
+	// 核对崩溃前声称上传中的任务
+	upload.recovery = upload.Recover(input.Afe)
+	upload.recovery.log()
+
 	out.Upload = upload
 
+	// 后台任务崩溃时保存任务，重启后从保存的状态继续
+	input.Supervisor.OnCrash("uploads", func() { out.Upload.saveTasks(filePath) })
+
 	input.LC.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
 			// 应用启动时的逻辑，例如初始化资源、启动后台服务等
 			logrus.Println("上传管理器已启动")
 			// 启动定时保存任务的定时器
-			go out.Upload.PeriodicSave(filePath, time.Minute)
+			input.Supervisor.Go("uploads", "periodic-save", func() { out.Upload.PeriodicSave(filePath, time.Minute) })
 
 			// 保存任务
-			go out.Upload.SaveTasksToFileSingleChan()
+			input.Supervisor.Spawn("uploads", "save-tasks", out.Upload.SaveTasksToFileSingleChan)
+
+			// 按电源与网络状态暂停或继续后台上传任务
+			if policy := input.Opt.GetPowerPolicy(); policy != nil {
+				input.Supervisor.Go("uploads", "power", func() { out.Upload.runPower(policy) })
+			}
 
 			return nil
 		},
@@ -85,8 +118,8 @@ func NewUploadManager(input NewUploadManagerInput) (out NewUploadManagerOutput,
 			logrus.Println("上传管理器正在停止")
 			out.Upload.cancel() // 调用取消函数，确保所有协程被正确终止
 
-			// 保存任务
-			go out.Upload.SaveTasksToFileSingleChan()
+			// 保存任务，包括尚未保存的进度
+			out.Upload.saveTasks(filePath)
 
 			return nil
 		},
@@ -112,6 +145,22 @@ func (manager *UploadManager) IsMaxConcurrencyReached() bool {
 	return false
 }
 
+// TaskStatusCounts 获取各状态的上传任务数量
+// 返回值：
+//   - map[string]int: 上传任务状态到任务数量的映射
+func (manager *UploadManager) TaskStatusCounts() map[string]int {
+	manager.Mu.Lock()
+	defer manager.Mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, task := range manager.Tasks {
+		task.Mu.RLock()
+		counts[string(task.Status)]++
+		task.Mu.RUnlock()
+	}
+	return counts
+}
+
 // RegisterTask 向管理器注册一个新的上传任务。
 // 参数：
 //   - task: *DownloadTask 为准备注册的上传任务。
@@ -123,14 +172,18 @@ func (manager *UploadManager) RegisterTask(opt *opts.Options, afe afero.Afero, p
 		manager.Tasks[task.TaskID] = task
 		logrus.Printf("添加任务: %s 成功。\n", task.TaskID)
 
+		// 片段完成后合并保存任务
+		task.onProgress = manager.progress.Mark
+		task.supervisor = manager.supervisor
+
 		// 启动通道事件处理
-		go task.ChannelEvents(opt, afe, p2p, pubsub, manager.UploadChan)
+		task.spawn("channel-events", func() { task.ChannelEvents(opt, afe, p2p, pubsub, manager.UploadChan) })
 
 		// 定时任务，发送数据到网络
-		go task.PeriodicSend()
+		task.spawn("periodic-send", task.PeriodicSend)
 
 		// 通知准备好本地存储文件片段
-		go task.SegmentReadySingleChan()
+		task.spawn("segment-ready", task.SegmentReadySingleChan)
 
 	} else {
 		logrus.Printf("任务: %s 已存在。\n", task.TaskID)
@@ -151,11 +204,11 @@ func (manager *UploadManager) PeriodicSave(filePath string, interval time.Durati
 			return
 		case <-ticker.C:
 			// 保存任务数据到文件
-			go manager.saveTasks(filePath)
+			manager.supervisor.Spawn("uploads", "save-tasks", func() { manager.saveTasks(filePath) })
 
 		case <-manager.SaveTasksToFile:
 			// 保存任务数据到文件
-			go manager.saveTasks(filePath)
+			manager.supervisor.Spawn("uploads", "save-tasks", func() { manager.saveTasks(filePath) })
 		}
 	}
 }
@@ -164,6 +217,11 @@ func (manager *UploadManager) PeriodicSave(filePath string, interval time.Durati
 // 参数：
 //   - filePath: string 文件路径
 func (manager *UploadManager) saveTasks(filePath string) {
+	// 只读模式下不写入任务文件，任务状态只保存在内存中
+	if manager.opt != nil && manager.opt.GetReadOnly() {
+		return
+	}
+
 	manager.Mu.Lock()
 	tasks := make(map[string]*UploadTaskSerializable)
 	for id, task := range manager.Tasks {
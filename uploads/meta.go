@@ -8,6 +8,7 @@ import (
 
 	"github.com/bpfs/defs/afero"
 	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/expiry"
 	"github.com/bpfs/defs/opts"
 	"github.com/bpfs/defs/util"
 	"github.com/sirupsen/logrus"
@@ -16,12 +17,15 @@ import (
 // FileMeta 代表文件的基本元数据信息
 // 它为文件上传提供了必要的描述信息，如文件大小、类型等
 type FileMeta struct {
-	FileID      string // 文件唯一标识，用于在系统内部唯一区分文件
-	Name        string // 文件名，包括扩展名，描述文件的名称
-	Extension   string // 文件的扩展名
-	Size        int64  // 文件大小，单位为字节，描述文件的总大小
-	ContentType string // MIME类型，表示文件的内容类型，如"text/plain"
-	Checksum    []byte // 文件的校验和，用于在上传前后验证文件的完整性和一致性
+	FileID      string         // 文件唯一标识，用于在系统内部唯一区分文件
+	Name        string         // 文件名，包括扩展名，描述文件的名称
+	Extension   string         // 文件的扩展名
+	Size        int64          // 文件大小，单位为字节，描述文件的总大小
+	ContentType string         // MIME类型，表示文件的内容类型，如"text/plain"
+	Checksum    []byte         // 文件的校验和，用于在上传前后验证文件的完整性和一致性
+	Codec       string         // 分片前对内容使用的压缩算法，为空表示未压缩
+	StoredSize  int64          // 参与分片的内容大小，未压缩时等于 Size
+	Expiry      *expiry.Notice // 到期声明，为 nil 时永不到期
 }
 
 // NewFileMeta 创建并初始化一个新的 FileMeta 实例，提供文件的基本元数据信息。
@@ -81,10 +85,12 @@ func NewFileMeta(file afero.File, privateKey *ecdsa.PrivateKey) (*FileMeta, erro
 		Size:        fileInfo.Size(),    // 文件大小
 		ContentType: contentType,        // MIME 类型
 		Checksum:    checksum,           // 文件的校验和
+		StoredSize:  fileInfo.Size(),    // 参与分片的内容大小
 	}, nil
 }
 
 // CalculateShards 根据文件大小和存储选项计算数据分片和奇偶校验分片的数量。
+// 文件在分片前被压缩时，按压缩后的大小计算。
 // 参数：
 //   - opt: *opts.Options 存储选项，包含存储模式和其他参数。
 //
@@ -99,17 +105,17 @@ func (meta *FileMeta) CalculateShards(opt *opts.Options) (int64, int64, error) {
 	// 根据存储模式计算分片数量
 	switch opt.GetStorageMode() {
 	case opts.FileMode:
-		if meta.Size > opt.GetMaxSliceSize() {
+		if meta.StoredSize > opt.GetMaxSliceSize() {
 			// 文件大于最大片段的大小时，自动切换至切片模式
-			dataShards = int64(math.Ceil(float64(meta.Size) / float64(opt.GetShardSize())))
+			dataShards = int64(math.Ceil(float64(meta.StoredSize) / float64(opt.GetShardSize())))
 		}
 
 	case opts.SliceMode:
-		if meta.Size < opt.GetMinSliceSize() {
+		if meta.StoredSize < opt.GetMinSliceSize() {
 			// 文件小于最小片段的大小时，保持文件模式
 			break
 		}
-		totalShards := math.Ceil(float64(meta.Size) / float64(opt.GetShardSize()))
+		totalShards := math.Ceil(float64(meta.StoredSize) / float64(opt.GetShardSize()))
 		dataShards = int64(totalShards)
 
 	case opts.RS_Size:
@@ -119,7 +125,7 @@ func (meta *FileMeta) CalculateShards(opt *opts.Options) (int64, int64, error) {
 
 	case opts.RS_Proportion:
 		// 纠删码(比例)模式，根据比例计算数据和奇偶校验分片数量
-		totalShards := math.Ceil(float64(meta.Size) / float64(opt.GetShardSize()))
+		totalShards := math.Ceil(float64(meta.StoredSize) / float64(opt.GetShardSize()))
 		dataShards = int64(float64(totalShards) / (1 + opt.GetParityRatio()))
 		parityShards = int64(totalShards) - dataShards
 
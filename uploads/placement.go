@@ -0,0 +1,275 @@
+package uploads
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/defs/stats"
+	"github.com/bpfs/defs/util"
+
+	"github.com/bpfs/dep2p"
+	"github.com/bpfs/dep2p/kbucket"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// placement 记录上传任务中各文件片段的存储节点及失败重试状态
+type placement struct {
+	mu        sync.Mutex
+	nodes     map[int]peer.ID          // 文件片段已确认或正在发送的存储节点
+	confirmed map[int]bool             // 存储节点已确认接收的文件片段
+	failed    map[int]map[peer.ID]bool // 本轮中拒绝或超时的节点，重试时跳过
+	failures  map[peer.ID]int          // 各节点拒绝或未能接收片段的累计次数
+	rounds    map[int]int              // 所有候选节点都失败的轮数
+	retryAt   map[int]time.Time        // 下一轮重试的时间
+	finished  bool                     // 分布清单是否已保存
+}
+
+// newPlacement 创建文件片段的分布记录
+func newPlacement() *placement {
+	return &placement{
+		nodes:     make(map[int]peer.ID),
+		confirmed: make(map[int]bool),
+		failed:    make(map[int]map[peer.ID]bool),
+		failures:  make(map[peer.ID]int),
+		rounds:    make(map[int]int),
+		retryAt:   make(map[int]time.Time),
+	}
+}
+
+// selectPeer 按与片段的距离选择下一个候选节点，跳过本轮中已失败的节点及不满足分布约束的节点
+// 距离相近的候选节点中优先选择估计带宽较高的节点，存储承诺有争议的节点排在最后
+// 参数：
+//   - policy: *opts.PlacementPolicy 分布约束
+//   - bandwidth: *stats.Bandwidth 节点带宽估计，为 nil 时仅按距离选择
+//   - reputation: *stats.Reputation 存储节点的信誉，为 nil 时不考虑信誉
+//   - p2p: *dep2p.DeP2P 网络主机
+//   - index: int 文件片段索引
+//   - segmentID: string 文件片段的唯一标识
+//   - isParity: func(int) bool 判断片段是否为纠删码片段，用于数据与纠删码片段的分离约束
+//
+// 返回值：
+//   - peer.ID: 选中的节点，已为该片段预留
+//   - error: 没有可用的候选节点时返回 errs.ErrInsufficientPeers
+func (pl *placement) selectPeer(policy *opts.PlacementPolicy, bandwidth *stats.Bandwidth, reputation *stats.Reputation, p2p *dep2p.DeP2P, index int, segmentID string, isParity func(int) bool) (peer.ID, error) {
+	rt := p2p.RoutingTable(2)
+	if rt == nil || rt.Size() < 1 {
+		return "", fmt.Errorf("%w: 路由表中没有可用的存储节点", errs.ErrInsufficientPeers)
+	}
+	candidates := rt.NearestPeers(kbucket.ConvertKey(segmentID), rt.Size())
+	rankNearest(candidates, bandwidth)
+	reputation.Rank(candidates)
+
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	placed := make([]peer.ID, 0, len(pl.nodes))
+	var opposite []peer.ID
+	for i, node := range pl.nodes {
+		if i == index {
+			continue
+		}
+		placed = append(placed, node)
+		if isParity(i) != isParity(index) {
+			opposite = append(opposite, node)
+		}
+	}
+
+	for _, node := range candidates {
+		if pl.failed[index][node] || !policy.Allows(node, placed) || !policy.Separates(node, opposite) {
+			continue
+		}
+		pl.nodes[index] = node
+		return node, nil
+	}
+	return "", fmt.Errorf("%w: 文件片段 %d 没有满足分布约束的候选节点", errs.ErrInsufficientPeers, index)
+}
+
+// fail 记录节点拒绝或未能接收片段，释放该片段的预留
+func (pl *placement) fail(index int, node peer.ID) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if pl.failed[index] == nil {
+		pl.failed[index] = make(map[peer.ID]bool)
+	}
+	pl.failed[index][node] = true
+	pl.failures[node]++
+	if pl.nodes[index] == node {
+		delete(pl.nodes, index)
+		delete(pl.confirmed, index)
+	}
+}
+
+// release 释放片段对节点的预留，不计为失败
+func (pl *placement) release(index int, node peer.ID) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if pl.nodes[index] == node {
+		delete(pl.nodes, index)
+		delete(pl.confirmed, index)
+	}
+}
+
+// exhaust 记录片段的所有候选节点都已失败，清空失败记录以便下一轮重新尝试
+// 参数：
+//   - index: int 文件片段索引
+//   - interval: time.Duration 下一轮重试前的等待时间
+//
+// 返回值：
+//   - int: 已失败的轮数
+func (pl *placement) exhaust(index int, interval time.Duration) int {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	delete(pl.failed, index)
+	delete(pl.nodes, index)
+	delete(pl.confirmed, index)
+	pl.rounds[index]++
+	pl.retryAt[index] = time.Now().Add(interval)
+	return pl.rounds[index]
+}
+
+// confirm 记录片段最终的存储节点
+func (pl *placement) confirm(index int, node peer.ID) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.nodes[index] = node
+	pl.confirmed[index] = true
+	delete(pl.failed, index)
+	delete(pl.retryAt, index)
+}
+
+// ready 检查片段是否已到下一轮重试的时间
+func (pl *placement) ready(index int) bool {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	return time.Now().After(pl.retryAt[index])
+}
+
+// snapshot 返回各片段的存储节点
+func (pl *placement) snapshot() map[int]peer.ID {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	nodes := make(map[int]peer.ID, len(pl.nodes))
+	for i, node := range pl.nodes {
+		nodes[i] = node
+	}
+	return nodes
+}
+
+// PeerProgress 上传任务中单个存储节点的片段分布
+type PeerProgress struct {
+	Peer      peer.ID // 存储节点
+	Confirmed int     // 已确认接收的片段数量
+	Pending   int     // 正在发送、尚未确认的片段数量
+	Failed    int     // 拒绝或未能接收片段的累计次数
+}
+
+// peers 统计各存储节点已确认、正在发送及失败的片段数量
+func (pl *placement) peers() []*PeerProgress {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	byPeer := make(map[peer.ID]*PeerProgress)
+	get := func(node peer.ID) *PeerProgress {
+		p, ok := byPeer[node]
+		if !ok {
+			p = &PeerProgress{Peer: node}
+			byPeer[node] = p
+		}
+		return p
+	}
+	for index, node := range pl.nodes {
+		if pl.confirmed[index] {
+			get(node).Confirmed++
+		} else {
+			get(node).Pending++
+		}
+	}
+	for node, n := range pl.failures {
+		get(node).Failed += n
+	}
+
+	result := make([]*PeerProgress, 0, len(byPeer))
+	for _, p := range byPeer {
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Peer < result[j].Peer })
+	return result
+}
+
+// PlacementManifest 文件上传完成后各片段最终的存储节点
+type PlacementManifest struct {
+	FileID      string          // 文件唯一标识
+	Segments    map[int]peer.ID // 文件片段索引到存储节点的映射
+	CompletedAt int64           // 上传完成的时间戳
+}
+
+// placementPath 获取文件分布清单的保存路径
+func placementPath(fileID string) string {
+	return filepath.Join(paths.GetManifestPath(), fileID+".placement.json")
+}
+
+// SavePlacement 保存文件的分布清单
+// 参数：
+//   - afe: afero.Afero 文件系统接口
+//   - manifest: *PlacementManifest 分布清单
+//
+// 返回值：
+//   - error: 保存失败时返回错误
+func SavePlacement(afe afero.Afero, manifest *PlacementManifest) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := afe.MkdirAll(paths.GetManifestPath(), 0755); err != nil {
+		return err
+	}
+	path := placementPath(manifest.FileID)
+	return util.WriteFileAtomic(afe, path, data, 0644)
+}
+
+// LoadPlacement 加载文件的分布清单
+// 参数：
+//   - afe: afero.Afero 文件系统接口
+//   - fileID: string 文件唯一标识
+//
+// 返回值：
+//   - *PlacementManifest: 分布清单
+//   - error: 清单不存在时返回包装了 errs.ErrNotFound 的错误
+func LoadPlacement(afe afero.Afero, fileID string) (*PlacementManifest, error) {
+	data, err := afero.ReadFile(afe, placementPath(fileID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: 文件 %s 的分布清单", errs.ErrNotFound, fileID)
+		}
+		return nil, err
+	}
+	manifest := new(PlacementManifest)
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// rankWindow 按带宽重排候选节点时每组的节点数量
+// 组内按带宽排序，组间仍按与片段的距离排列，片段不会被放到远离其标识的节点上
+const rankWindow = 3
+
+// rankNearest 将按距离排列的候选节点分组，组内按估计带宽从高到低重排
+func rankNearest(candidates []peer.ID, bandwidth *stats.Bandwidth) {
+	for i := 0; i < len(candidates); i += rankWindow {
+		end := i + rankWindow
+		if end > len(candidates) {
+			end = len(candidates)
+		}
+		bandwidth.Rank(candidates[i:end])
+	}
+}
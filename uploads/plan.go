@@ -0,0 +1,136 @@
+package uploads
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/util"
+	"github.com/bpfs/dep2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// 按当前路由表演练文件片段的分布，不发送任何数据，便于在大规模迁移前检验分布约束。
+// 演练与上传使用相同的选择逻辑：按与片段的距离及估计带宽选择候选节点，并遵守分布约束；
+// 演练时假定所有节点都会接收片段，实际上传中被拒绝的片段会改投其他节点，最终分布可能不同。
+
+// PlannedSegment 演练中单个文件片段的分布
+type PlannedSegment struct {
+	Index     int     // 文件片段索引
+	SegmentID string  // 文件片段的唯一标识
+	IsParity  bool    // 是否为纠删码片段
+	Peer      peer.ID // 选中的存储节点，没有满足约束的候选节点时为空
+	Zone      string  // 存储节点所在的区域，未按区域约束时为空
+}
+
+// PlacementPlan 文件片段分布的演练结果
+type PlacementPlan struct {
+	FileID         string           // 文件唯一标识
+	DataSegments   int              // 数据片段数量
+	ParitySegments int              // 纠删码片段数量
+	Candidates     int              // 路由表中可作为存储节点的节点数量
+	Segments       []PlannedSegment // 各文件片段的分布，按索引排列
+	Peers          map[peer.ID]int  // 各存储节点分到的片段数量
+	Zones          map[string]int   // 各区域分到的片段数量，未按区域约束时为空
+	Unplaced       []int            // 没有满足约束的候选节点的片段索引
+	PeerFailures   int              // 最坏情况下可同时失效而不丢失文件的存储节点数量
+	ZoneFailures   int              // 最坏情况下可同时失效而不丢失文件的区域数量，未按区域约束时为 -1
+	Satisfied      bool             // 所有片段都在遵守约束的前提下找到了存储节点
+}
+
+// PlanPlacement 按当前路由表演练文件片段的分布，不发送任何数据
+// 参数：
+//   - opt: *opts.Options 文件存储选项配置，用于计算片段数量与按带宽排序候选节点
+//   - p2p: *dep2p.DeP2P 网络主机
+//   - meta: *FileMeta 文件的元数据，需设置文件唯一标识与大小
+//   - policy: *opts.PlacementPolicy 要检验的分布约束，为 nil 时不约束；检验当前配置时传入 opt.GetPlacementPolicy()
+//
+// 返回值：
+//   - *PlacementPlan: 演练结果
+//   - error: 元数据无效或无法计算片段数量时返回错误
+func (manager *UploadManager) PlanPlacement(opt *opts.Options, p2p *dep2p.DeP2P, meta *FileMeta, policy *opts.PlacementPolicy) (*PlacementPlan, error) {
+	if meta == nil || meta.FileID == "" || meta.Size <= 0 {
+		return nil, fmt.Errorf("%w: 文件元数据需包含文件唯一标识与大小", errs.ErrInvalidArgument)
+	}
+	sized := *meta
+	if sized.StoredSize <= 0 {
+		sized.StoredSize = sized.Size
+	}
+	dataShards, parityShards, err := sized.CalculateShards(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &PlacementPlan{
+		FileID:         meta.FileID,
+		DataSegments:   int(dataShards),
+		ParitySegments: int(parityShards),
+		Peers:          make(map[peer.ID]int),
+		Zones:          make(map[string]int),
+		ZoneFailures:   -1,
+	}
+	if rt := p2p.RoutingTable(2); rt != nil {
+		plan.Candidates = rt.Size()
+	}
+
+	total := plan.DataSegments + plan.ParitySegments
+	isParity := func(i int) bool { return i >= plan.DataSegments }
+	pl := newPlacement()
+	for index := 0; index < total; index++ {
+		segmentID, err := util.GenerateSegmentID(meta.FileID, index)
+		if err != nil {
+			return nil, err
+		}
+		segment := PlannedSegment{Index: index, SegmentID: segmentID, IsParity: isParity(index)}
+		node, err := pl.selectPeer(policy, opt.GetBandwidth(), opt.GetReputation(), p2p, index, segmentID, isParity)
+		if err != nil {
+			plan.Unplaced = append(plan.Unplaced, index)
+		} else {
+			pl.confirm(index, node)
+			segment.Peer = node
+			plan.Peers[node]++
+			if policy != nil && policy.Zone != nil {
+				if segment.Zone = policy.Zone(node); segment.Zone != "" {
+					plan.Zones[segment.Zone]++
+				}
+			}
+		}
+		plan.Segments = append(plan.Segments, segment)
+	}
+
+	plan.Satisfied = len(plan.Unplaced) == 0
+	// 未放置的片段视为已丢失，只能再承受剩余的纠删码片段数量的损失
+	spare := plan.ParitySegments - len(plan.Unplaced)
+	plan.PeerFailures = tolerableFailures(plan.Peers, spare)
+	if len(plan.Zones) > 0 {
+		plan.ZoneFailures = tolerableFailures(plan.Zones, spare)
+	}
+	return plan, nil
+}
+
+// tolerableFailures 计算最坏情况下可同时失效的分组数量
+// 依次移除片段最多的分组，直到丢失的片段超过可以损失的数量
+// 参数：
+//   - groups: map[K]int 各分组的片段数量
+//   - spare: int 可以损失的片段数量
+//
+// 返回值：
+//   - int: 可同时失效的分组数量，无法承受任何损失时为 0
+func tolerableFailures[K comparable](groups map[K]int, spare int) int {
+	counts := make([]int, 0, len(groups))
+	for _, n := range groups {
+		counts = append(counts, n)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(counts)))
+
+	failures, lost := 0, 0
+	for _, n := range counts {
+		if lost+n > spare {
+			break
+		}
+		lost += n
+		failures++
+	}
+	return failures
+}
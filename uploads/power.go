@@ -0,0 +1,114 @@
+package uploads
+
+import (
+	"time"
+
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/qos"
+	"github.com/sirupsen/logrus"
+)
+
+// 设备使用电池且电量不足，或连接按流量计费时，服务等级为后台的上传任务由管理器自动暂停；
+// 条件恢复后只继续由管理器暂停的任务，用户手动暂停的任务保持暂停。
+
+// PowerStatus 电源感知的当前状态
+type PowerStatus struct {
+	State  opts.PowerState // 最近一次获取的电源与网络状态
+	Reason string          // 暂停后台上传的原因，为空时未暂停
+	Paused []string        // 因电源状态暂停的上传任务
+}
+
+// PowerChanged 通知管理器设备的电源或网络状态已变化，立即重新检查而不等待下一个检查间隔
+// 嵌入方可在平台的状态变化回调中调用
+func (manager *UploadManager) PowerChanged() {
+	select {
+	case manager.powerWake <- struct{}{}:
+	default:
+	}
+}
+
+// PowerStatus 获取电源感知的当前状态
+// 返回值：
+//   - PowerStatus: 最近一次检查的结果
+func (manager *UploadManager) PowerStatus() PowerStatus {
+	manager.Mu.Lock()
+	defer manager.Mu.Unlock()
+
+	status := PowerStatus{State: manager.powerState, Reason: manager.powerReason}
+	for id := range manager.powerPaused {
+		status.Paused = append(status.Paused, id)
+	}
+	return status
+}
+
+// checkPower 按电源与网络状态暂停或继续后台上传任务
+// 参数：
+//   - policy: *opts.PowerPolicy 电源感知策略
+//   - state: opts.PowerState 当前状态
+//
+// 返回值：
+//   - paused: int 本次暂停的任务数量
+//   - resumed: int 本次继续的任务数量
+func (manager *UploadManager) checkPower(policy *opts.PowerPolicy, state opts.PowerState) (paused, resumed int) {
+	reason := policy.Constrained(state)
+
+	manager.Mu.Lock()
+	defer manager.Mu.Unlock()
+	manager.powerState, manager.powerReason = state, reason
+
+	for id, task := range manager.Tasks {
+		task.Mu.Lock()
+		switch {
+		case manager.powerPaused[id]:
+			// 任务已不再受限(条件恢复或服务等级已调整)时继续
+			if reason == "" || task.QoS != qos.ClassBackground {
+				delete(manager.powerPaused, id)
+				if task.Status == StatusPaused {
+					task.SetStatusUploading()
+					go task.SegmentReadySingleChan()
+					resumed++
+				}
+			}
+		case reason != "" && task.QoS == qos.ClassBackground &&
+			(task.Status == StatusPending || task.Status == StatusUploading):
+			// 与 SetStatusPaused 相同，另在事件中记录暂停的原因
+			task.Status = StatusPaused
+			task.timeline.record(TimelineEvent{Kind: EventStatus, Status: StatusPaused, Index: -1, Detail: reason})
+			manager.powerPaused[id] = true
+			paused++
+		}
+		task.Mu.Unlock()
+	}
+
+	// 已取消或清空的任务不再记录
+	for id := range manager.powerPaused {
+		if _, ok := manager.Tasks[id]; !ok {
+			delete(manager.powerPaused, id)
+		}
+	}
+	return paused, resumed
+}
+
+// runPower 定期及在收到状态变化通知时检查电源与网络状态，直到管理器停止
+// 参数：
+//   - policy: *opts.PowerPolicy 电源感知策略
+func (manager *UploadManager) runPower(policy *opts.PowerPolicy) {
+	ticker := time.NewTicker(policy.Interval)
+	defer ticker.Stop()
+
+	for {
+		paused, resumed := manager.checkPower(policy, policy.State())
+		if paused > 0 || resumed > 0 {
+			logrus.Infof("[%s]按电源状态暂停 %d 个、继续 %d 个后台上传任务", debug.WhereAmI(), paused, resumed)
+			go manager.SaveTasksToFileSingleChan()
+		}
+
+		select {
+		case <-manager.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-manager.powerWake:
+		}
+	}
+}
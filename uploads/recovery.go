@@ -0,0 +1,102 @@
+package uploads
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/paths"
+	"github.com/sirupsen/logrus"
+)
+
+// RecoveryReport 启动时核对上传任务状态的结果
+type RecoveryReport struct {
+	Paused        []string // 声称上传中、已转为暂停的任务
+	Failed        []string // 本地片段已丢失、无法继续上传的任务
+	ResetSegments int      // 重置为待上传的片段数量
+}
+
+// Recover 核对从文件加载的上传任务与本地实际状态
+// 进程崩溃后任务可能仍声称正在上传而实际没有任何协程在运行：
+// 正在发送的片段重置为待上传，已完成但没有存储节点记录的片段重新上传，
+// 未完成片段的本地文件仍在时任务转为暂停，可恢复上传，否则转为失败
+// 参数：
+//   - afe: afero.Afero 文件系统接口
+//
+// 返回值：
+//   - *RecoveryReport: 核对结果
+func (manager *UploadManager) Recover(afe afero.Afero) *RecoveryReport {
+	manager.Mu.Lock()
+	defer manager.Mu.Unlock()
+
+	report := new(RecoveryReport)
+	for id, task := range manager.Tasks {
+		if task.Status != StatusUploading {
+			continue
+		}
+
+		reset, intact := task.reconcile(afe)
+		report.ResetSegments += reset
+		if intact {
+			task.SetStatusPaused()
+			report.Paused = append(report.Paused, id)
+		} else {
+			task.SetStatusFailed()
+			report.Failed = append(report.Failed, id)
+		}
+	}
+	sort.Strings(report.Paused)
+	sort.Strings(report.Failed)
+	return report
+}
+
+// reconcile 按进度与存储节点记录核对片段状态
+// 返回值：
+//   - int: 重置为待上传的片段数量
+//   - bool: 未完成片段的本地文件是否都在
+func (task *UploadTask) reconcile(afe afero.Afero) (int, bool) {
+	task.Mu.Lock()
+	defer task.Mu.Unlock()
+
+	placed := task.placement.snapshot()
+	reset, intact := 0, true
+	for index, segment := range task.File.Segments {
+		if task.Progress.IsSet(index) {
+			if _, ok := placed[index]; ok {
+				if segment.Status != SegmentStatusCompleted {
+					segment.SetStatusCompleted()
+				}
+				continue
+			}
+			// 没有存储节点记录的片段无法证明已送达，重新上传
+			task.Progress.Clear(index)
+		}
+
+		if segment.Status != SegmentStatusPending {
+			segment.SetStatusPending()
+			reset++
+		}
+		path := filepath.Join(paths.GetUploadPath(), task.File.FileID, segment.SegmentID)
+		if ok, err := afero.Exists(afe, path); err != nil || !ok {
+			intact = false
+		}
+	}
+	return reset, intact
+}
+
+// RecoveryReport 获取启动时核对上传任务状态的结果
+func (manager *UploadManager) RecoveryReport() *RecoveryReport {
+	return manager.recovery
+}
+
+// log 记录核对结果
+func (report *RecoveryReport) log() {
+	if len(report.Paused) == 0 && len(report.Failed) == 0 {
+		return
+	}
+	logrus.Infof("[%s]上传任务恢复：%d 个转为暂停，%d 个转为失败，重置 %d 个片段", debug.WhereAmI(), len(report.Paused), len(report.Failed), report.ResetSegments)
+	for _, id := range report.Failed {
+		logrus.Warnf("[%s]上传任务 %s 的本地片段已丢失，无法继续上传", debug.WhereAmI(), id)
+	}
+}
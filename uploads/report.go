@@ -0,0 +1,247 @@
+package uploads
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/paths"
+	sign "github.com/bpfs/defs/sign/ecdsa"
+	"github.com/bpfs/defs/util"
+	"github.com/bpfs/defs/wallets"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+)
+
+// SegmentReport 完整性报告中单个文件片段的记录
+type SegmentReport struct {
+	Index     int     // 分片索引
+	SegmentID string  // 文件片段的唯一标识
+	Size      int     // 分片大小，单位为字节
+	Checksum  string  // 分片校验和的十六进制字符串
+	IsRsCodes bool    // 是否是纠删码片段
+	Peer      peer.ID // 存储该片段的节点
+}
+
+// IntegrityReport 文件上传完成后由所有者签名的完整性报告
+// 报告与文件分布清单一同保存，审计方可以仅凭报告本身验证签名，并据此逐个核对各存储节点上的片段
+type IntegrityReport struct {
+	FileID       string           // 文件唯一标识
+	Name         string           // 文件名
+	Size         int64            // 文件大小，单位为字节
+	Checksum     string           // 文件校验和的十六进制字符串
+	DataShards   int              // 数据分片数
+	ParityShards int              // 奇偶校验分片数
+	Segments     []*SegmentReport // 各文件片段，按分片索引排列
+	StartedAt    int64            // 上传开始的时间戳
+	CompletedAt  int64            // 上传完成的时间戳
+	Owner        string           // 所有者公钥哈希的十六进制字符串
+	PublicKey    []byte           // 所有者公钥
+	Signature    []byte           // 所有者对报告的签名
+}
+
+// NewIntegrityReport 根据已完成的上传任务生成并签名完整性报告
+// 参数：
+//   - task: *UploadTask 已完成的上传任务
+//   - completedAt: int64 上传完成的时间戳
+//
+// 返回值：
+//   - *IntegrityReport: 签名后的完整性报告
+//   - error: 如果发生错误，返回错误信息
+func NewIntegrityReport(task *UploadTask, completedAt int64) (*IntegrityReport, error) {
+	ownerPriv := task.File.Security.PrivateKey
+	if ownerPriv == nil {
+		return nil, fmt.Errorf("%w: 所有者私钥不能为空", errs.ErrInvalidArgument)
+	}
+
+	var nodes map[int]peer.ID
+	if task.placement != nil {
+		nodes = task.placement.snapshot()
+	}
+
+	report := &IntegrityReport{
+		FileID:      task.File.FileID,
+		Name:        task.File.Name,
+		Size:        task.File.Size,
+		Checksum:    hex.EncodeToString(task.File.Checksum),
+		Segments:    make([]*SegmentReport, 0, len(task.File.Segments)),
+		StartedAt:   task.File.StartedAt,
+		CompletedAt: completedAt,
+	}
+	for index, segment := range task.File.Segments {
+		isRsCodes := segment.IsRsCodes
+		if table, ok := task.File.SliceTable[index]; ok {
+			isRsCodes = table.IsRsCodes
+		}
+		if isRsCodes {
+			report.ParityShards++
+		} else {
+			report.DataShards++
+		}
+		report.Segments = append(report.Segments, &SegmentReport{
+			Index:     index,
+			SegmentID: segment.SegmentID,
+			Size:      segment.Size,
+			Checksum:  hex.EncodeToString(segment.Checksum),
+			IsRsCodes: isRsCodes,
+			Peer:      nodes[index],
+		})
+	}
+	sort.Slice(report.Segments, func(i, j int) bool { return report.Segments[i].Index < report.Segments[j].Index })
+
+	if err := report.Sign(ownerPriv); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// Sign 使用所有者私钥签名完整性报告
+// 参数：
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥
+//
+// 返回值：
+//   - error: 如果发生错误，返回错误信息
+func (r *IntegrityReport) Sign(ownerPriv *ecdsa.PrivateKey) error {
+	publicKey, err := wallets.MarshalPublicKey(ownerPriv.PublicKey)
+	if err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return err
+	}
+	pubKeyHash, ok := wallets.PrivateKeyToPublicKeyHash(ownerPriv)
+	if !ok {
+		return fmt.Errorf("通过私钥生成公钥哈希时失败")
+	}
+	r.Owner = hex.EncodeToString(pubKeyHash)
+	r.PublicKey = publicKey
+
+	data, err := r.signingData()
+	if err != nil {
+		return err
+	}
+	r.Signature, err = sign.SignData(ownerPriv, data)
+	if err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return err
+	}
+	return nil
+}
+
+// Verify 验证完整性报告的签名及所有者
+// 返回值：
+//   - error: 验证失败时返回包装了 errs.ErrUnauthorized 的错误
+func (r *IntegrityReport) Verify() error {
+	publicKey, err := wallets.UnmarshalPublicKey(r.PublicKey)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errs.ErrUnauthorized, err)
+	}
+
+	// 所有者必须与公钥一致
+	pubKeyHash, ok := wallets.PublicKeyToPublicKeyHash(publicKey)
+	if !ok || hex.EncodeToString(pubKeyHash) != r.Owner {
+		return fmt.Errorf("%w: 报告所有者与公钥不匹配", errs.ErrUnauthorized)
+	}
+
+	data, err := r.signingData()
+	if err != nil {
+		return err
+	}
+	valid, err := sign.VerifySignature(&publicKey, data, r.Signature)
+	if err != nil || !valid {
+		return fmt.Errorf("%w: 完整性报告签名无效", errs.ErrUnauthorized)
+	}
+	return nil
+}
+
+// signingData 返回报告中参与签名的字段
+func (r *IntegrityReport) signingData() ([]byte, error) {
+	return util.MergeFieldsForSigning(r.FileID, r.Name, r.Size, r.Checksum, r.DataShards, r.ParityShards,
+		r.Segments, r.StartedAt, r.CompletedAt, r.Owner, r.PublicKey)
+}
+
+// reportPath 获取完整性报告的保存路径
+func reportPath(fileID string) string {
+	return filepath.Join(paths.GetManifestPath(), fileID+".report.json")
+}
+
+// SaveReport 保存文件的完整性报告
+// 参数：
+//   - afe: afero.Afero 文件系统接口
+//   - report: *IntegrityReport 完整性报告
+//
+// 返回值：
+//   - error: 保存失败时返回错误
+func SaveReport(afe afero.Afero, report *IntegrityReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	if err := afe.MkdirAll(paths.GetManifestPath(), 0755); err != nil {
+		return err
+	}
+	path := reportPath(report.FileID)
+	return util.WriteFileAtomic(afe, path, data, 0644)
+}
+
+// LoadReport 加载文件的完整性报告
+// 参数：
+//   - afe: afero.Afero 文件系统接口
+//   - fileID: string 文件唯一标识
+//
+// 返回值：
+//   - *IntegrityReport: 完整性报告
+//   - error: 报告不存在时返回包装了 errs.ErrNotFound 的错误
+func LoadReport(afe afero.Afero, fileID string) (*IntegrityReport, error) {
+	data, err := afero.ReadFile(afe, reportPath(fileID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: 文件 %s 的完整性报告", errs.ErrNotFound, fileID)
+		}
+		return nil, err
+	}
+	report := new(IntegrityReport)
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// ListReports 列出本节点保存的所有完整性报告，即本节点上传的所有文件
+// 参数：
+//   - afe: afero.Afero 文件系统接口
+//
+// 返回值：
+//   - []*IntegrityReport: 完整性报告，按文件唯一标识排列
+//   - error: 读取目录失败时返回错误
+func ListReports(afe afero.Afero) ([]*IntegrityReport, error) {
+	entries, err := afero.ReadDir(afe, paths.GetManifestPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var reports []*IntegrityReport
+	for _, entry := range entries {
+		fileID, ok := strings.CutSuffix(entry.Name(), ".report.json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		report, err := LoadReport(afe, fileID)
+		if err != nil {
+			logrus.Warnf("[%s]读取文件 %s 的完整性报告失败: %v", debug.WhereAmI(), fileID, err)
+			continue
+		}
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].FileID < reports[j].FileID })
+	return reports, nil
+}
@@ -0,0 +1,195 @@
+package uploads
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/network"
+	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/defs/space"
+	"github.com/bpfs/defs/util"
+	"github.com/bpfs/dep2p"
+	"github.com/bpfs/dep2p/streams"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+)
+
+// 上传方在发送片段前先请求存储节点预留空间。存储节点确认或拒绝，
+// 上传方在拒绝时立即换下一个候选节点，而不是在传输片段的过程中才发现被拒绝。
+// 预留在片段存储后释放，或在有效期过后自动失效。
+
+const (
+	maxReservationTTL    = 10 * time.Minute // 存储节点接受的最长预留有效期
+	maxPeerReservations  = 256              // 单个上传方同时持有的最多预留数量
+	maxPeerReservedBytes = 1 << 30          // 单个上传方同时持有的最多预留字节数(1GB)
+)
+
+// 预留空间的请求消息
+type ReserveReq struct {
+	FileID        string // 文件唯一标识
+	SegmentID     string // 文件片段的唯一标识，须由文件唯一标识与分片索引生成
+	TotalSegments int    // 文件总分片数
+	Index         int    // 分片索引
+	Size          int64  // 片段大小，单位为字节
+	TTL           int64  // 预留的有效期，单位为秒
+}
+
+// validate 检查片段是否属于请求中的文件
+func (req *ReserveReq) validate() error {
+	if req.FileID == "" || req.Index < 0 || req.Index >= req.TotalSegments || req.Size <= 0 {
+		return fmt.Errorf("%w: 预留请求缺少文件或分片信息", errs.ErrInvalidArgument)
+	}
+	segmentID, err := util.GenerateSegmentID(req.FileID, req.Index)
+	if err != nil {
+		return err
+	}
+	if segmentID != req.SegmentID {
+		return fmt.Errorf("%w: 片段 %s 不属于文件 %s", errs.ErrInvalidArgument, req.SegmentID, req.FileID)
+	}
+	return nil
+}
+
+// reservationKey 预留的唯一标识
+type reservationKey struct {
+	uploader  peer.ID // 上传方
+	segmentID string  // 文件片段的唯一标识
+}
+
+// reservation 一次空间预留
+type reservation struct {
+	size      int64     // 预留的字节数
+	expiresAt time.Time // 失效时间
+}
+
+// reservations 存储节点为上传方预留的空间
+type reservations struct {
+	mu      sync.Mutex
+	entries map[reservationKey]reservation
+	free    func() (int64, error) // 获取本地可用空间，便于测试
+}
+
+// newReservations 创建空间预留记录
+func newReservations() *reservations {
+	return &reservations{
+		entries: make(map[reservationKey]reservation),
+		free: func() (int64, error) {
+			available, err := space.GetAvailableSpace(paths.GetRootPath())
+			return int64(available), err
+		},
+	}
+}
+
+// reserve 在可用空间扣除已有预留后足以容纳片段时预留空间
+// 同一上传方对同一片段的重复预留只更新大小与有效期，不计入该上传方的上限
+// 返回值：
+//   - error: 空间不足或超过单个上传方的上限时返回包装了 errs.ErrQuotaExceeded 的错误
+func (rs *reservations) reserve(key reservationKey, size int64, ttl time.Duration) error {
+	if ttl <= 0 || ttl > maxReservationTTL {
+		ttl = maxReservationTTL
+	}
+	free, err := rs.free()
+	if err != nil {
+		return err
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	now := time.Now()
+	var reserved, peerReserved int64
+	var peerCount int
+	for k, r := range rs.entries {
+		if now.After(r.expiresAt) {
+			delete(rs.entries, k)
+			continue
+		}
+		if k == key {
+			continue
+		}
+		reserved += r.size
+		if k.uploader == key.uploader {
+			peerReserved += r.size
+			peerCount++
+		}
+	}
+	if peerCount+1 > maxPeerReservations || peerReserved+size > maxPeerReservedBytes {
+		return fmt.Errorf("%w: 上传方已预留 %d 个片段共 %d 字节", errs.ErrQuotaExceeded, peerCount, peerReserved)
+	}
+	if reserved+size > free {
+		return fmt.Errorf("%w: 可用空间 %d 字节，已预留 %d 字节", errs.ErrQuotaExceeded, free, reserved)
+	}
+	rs.entries[key] = reservation{size: size, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+// release 释放预留，片段已存储或上传方放弃时调用
+func (rs *reservations) release(key reservationKey) {
+	rs.mu.Lock()
+	delete(rs.entries, key)
+	rs.mu.Unlock()
+}
+
+// handleReserve 处理预留空间的请求
+// 预留按上传节点计数，上传节点取流连接上经过认证的对方节点ID，伪造 Sender 不能绕过每个节点的上限
+func (sp *StreamProtocol) handleReserve(req *streams.RequestMessage, res *streams.ResponseMessage) (int32, string) {
+	payload := new(ReserveReq)
+	if err := util.DecodeFromBytes(req.Payload, payload); err != nil {
+		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+		return 6603, "解码错误"
+	}
+
+	// 只读节点不接受其他节点存储的文件片段
+	if sp.Opt.GetReadOnly() {
+		return 6610, "只读节点不接受文件片段"
+	}
+
+	uploader, err := peer.Decode(req.Message.GetSender())
+	if err != nil {
+		return 6603, "解码错误"
+	}
+	if err := payload.validate(); err != nil {
+		logrus.Warnf("[%s]拒绝节点 %s 的预留请求: %v", debug.WhereAmI(), uploader, err)
+		return 6612, "无效的预留请求"
+	}
+	key := reservationKey{uploader: uploader, segmentID: payload.SegmentID}
+	if err := sp.Reservations.reserve(key, payload.Size, time.Duration(payload.TTL)*time.Second); err != nil {
+		logrus.Warnf("[%s]拒绝节点 %s 预留 %d 字节: %v", debug.WhereAmI(), uploader, payload.Size, err)
+		return 6611, "存储空间不足"
+	}
+	return 200, "成功"
+}
+
+// reserveOnNode 请求存储节点为片段预留空间
+// 参数：
+//   - ctx: context.Context 上下文，任务取消时中止请求
+//   - p2p: *dep2p.DeP2P 网络主机
+//   - node: peer.ID 存储节点
+//   - segment: *FileSegmentInfo 文件片段的信息
+//   - size: int 片段大小
+//   - ttl: time.Duration 预留的有效期
+//
+// 返回值：
+//   - error: 存储节点明确拒绝时返回包装了 errs.ErrPeerRejected 的错误
+//     不支持预留协议或请求失败时不返回错误，由发送片段时的结果决定
+func reserveOnNode(ctx context.Context, p2p *dep2p.DeP2P, node peer.ID, segment *FileSegmentInfo, size int, ttl time.Duration) error {
+	res, err := network.SendStreamContext(ctx, p2p, StreamReserveProtocol, "", node, &ReserveReq{
+		FileID:        segment.FileID,
+		SegmentID:     segment.SegmentID,
+		TotalSegments: segment.TotalSegments,
+		Index:         segment.Index,
+		Size:          int64(size),
+		TTL:           int64(ttl / time.Second),
+	})
+	if err != nil || res == nil {
+		logrus.Debugf("[%s]节点 %s 未响应预留请求: %v", debug.WhereAmI(), node, err)
+		return nil
+	}
+	if res.Code != 200 {
+		return fmt.Errorf("%w: 节点 %s 拒绝预留空间: %s", errs.ErrPeerRejected, node, res.Msg)
+	}
+	return nil
+}
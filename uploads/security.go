@@ -21,6 +21,7 @@ type FileSecurity struct {
 	PrivateKey    *ecdsa.PrivateKey // 文件签名密钥
 	P2PKHScript   []byte            // P2PKH 脚本，用于区块链场景中验证文件所有者的身份
 	P2PKScript    []byte            // P2PK 脚本，用于区块链场景中进行文件验签操作
+	Metadata      []byte            // 加密的文件元数据，未开启元数据加密时为空
 }
 
 // NewFileSecurity 创建并初始化一个新的FileSecurity实例，封装了文件的安全和权限相关的信息
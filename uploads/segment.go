@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"io"
+	"sync"
 
 	"github.com/bpfs/defs/debug"
 	"github.com/bpfs/defs/opts"
@@ -14,6 +15,18 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// shardPool 复用分片缓冲区，分片写入临时存储后即可归还
+// 池中的缓冲区按 64 字节对齐，分片数或大小不符时由 SplitInto 重新分配
+var shardPool sync.Pool
+
+// getShards 从池中获取 total 个分片缓冲区
+func getShards(total int) [][]byte {
+	if shards, ok := shardPool.Get().([][]byte); ok && len(shards) == total {
+		return shards
+	}
+	return make([][]byte, total)
+}
+
 // FileSegment 描述一个文件分片的详细信息及其上传状态
 // 文件被分割成多个片段独立上传，以支持大文件的高效传输和断点续传
 type FileSegment struct {
@@ -52,12 +65,13 @@ func NewFileSegment(opt *opts.Options, r io.Reader, fileID string, capacity, dat
 		return nil, fmt.Errorf("纠错码编码器初始化时失败: %v", err)
 	}
 
-	// 将数据切片分割为提供给编码器的分片数量，并在必要时创建空奇偶校验分片。
-	shards, err := enc.Split(buf.Bytes())
-	if err != nil {
+	// 将数据写入复用的分片缓冲区，分片写入临时存储后归还
+	shards := getShards(int(dataShards + parityShards))
+	if err := enc.(reedsolomon.Extensions).SplitInto(buf.Bytes(), shards); err != nil {
 		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
 		return nil, fmt.Errorf("分割数据时失败: %v", err)
 	}
+	defer shardPool.Put(shards)
 
 	// 对一组数据分片进行奇偶校验编码。 输入是“分片”，其中包含数据分片，后跟奇偶校验分片。
 	if err := enc.Encode(shards); err != nil {
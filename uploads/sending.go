@@ -1,10 +1,13 @@
 package uploads
 
 import (
-	"fmt"
+	"context"
 
 	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
 	"github.com/bpfs/defs/network"
+	"github.com/bpfs/defs/network/datagram"
+	"github.com/bpfs/defs/stats"
 	"github.com/bpfs/defs/util"
 
 	"github.com/bpfs/dep2p"
@@ -55,13 +58,17 @@ import (
 // }
 
 // sendSliceToNode 向目标节点发送文件片段。
+// ctx：上下文，任务取消时中止发送。
 // p2p：P2P网络对象。
 // segmentInfo：文件片段信息。
 // node：目标节点。
 // sliceByte：文件片段的字节数据。
 // networkReceivedChan：网络响应通道。
+// commitUntil：要求存储节点承诺保存的截止时间，为 0 时不要求承诺。
+// dgram：数据报传输参数，不为 nil 时优先通过数据报传输切片内容，协商或传输失败时回退到流传输。
+// links：节点链路的丢包率估计，由数据报传输的重传统计更新。
 // 返回可能的错误。
-func sendSliceToNode(p2p *dep2p.DeP2P, segmentInfo *FileSegmentInfo, node peer.ID, sliceByte []byte, networkReceived chan *NetworkResponse) error {
+func sendSliceToNode(ctx context.Context, p2p *dep2p.DeP2P, segmentInfo *FileSegmentInfo, node peer.ID, sliceByte []byte, networkReceived chan *NetworkResponse, commitUntil int64, dgram *datagram.Config, links *stats.LinkLoss) error {
 	// 准备发送请求的数据
 	sendingToNetworkReq := SendingToNetworkReq{
 		FileID:        segmentInfo.FileID,
@@ -70,18 +77,29 @@ func sendSliceToNode(p2p *dep2p.DeP2P, segmentInfo *FileSegmentInfo, node peer.I
 		Index:         segmentInfo.Index,
 		IsRsCodes:     segmentInfo.IsRsCodes,
 		SliceByte:     sliceByte,
+		CommitUntil:   commitUntil,
+	}
+
+	// 通过数据报传输切片内容，请求中只携带传输令牌
+	if dgram != nil {
+		token, err := sendSliceDatagram(ctx, p2p, node, sliceByte, dgram, links)
+		if err != nil {
+			logrus.Warnf("[%s]向节点 %s 的数据报传输失败，回退到流传输: %v", debug.WhereAmI(), node.String(), err)
+		} else {
+			sendingToNetworkReq.SliceByte = nil
+			sendingToNetworkReq.DatagramToken = token
+		}
 	}
 
-	network.StreamMutex.Lock()
 	// 发送文件片段到目标节点
-	res, err := network.SendStream(p2p, StreamSendingToNetworkProtocol, "", node, sendingToNetworkReq)
+	res, err := network.SendStreamContext(ctx, p2p, StreamSendingToNetworkProtocol, "", node, sendingToNetworkReq)
 	if err != nil {
 		logrus.Errorf("[%s]向节点 %s 发送数据失败: %v", debug.WhereAmI(), node.String(), err)
-		return err
+		return errs.Unreachable(node, StreamSendingToNetworkProtocol, err)
 	}
 
 	if res == nil {
-		return fmt.Errorf("向节点 %s 发送数据失败", node.String())
+		return errs.Unreachable(node, StreamSendingToNetworkProtocol, nil)
 	}
 
 	// 处理响应数据
@@ -91,12 +109,25 @@ func sendSliceToNode(p2p *dep2p.DeP2P, segmentInfo *FileSegmentInfo, node peer.I
 			logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
 		}
 
+		// 验证存储承诺收据，无效的收据不予保存
+		receipt := sendingToNetwork.Receipt
+		if receipt != nil {
+			if err := receipt.Verify(); err != nil {
+				logrus.Warnf("[%s]节点 %s 签发的存储承诺收据无效: %v", debug.WhereAmI(), node.String(), err)
+				receipt = nil
+			} else if err := receipt.Matches(node, p2p.Host().ID(), segmentInfo.FileID, segmentInfo.SegmentID, sliceByte); err != nil {
+				logrus.Warnf("[%s]节点 %s 签发的存储承诺收据无效: %v", debug.WhereAmI(), node.String(), err)
+				receipt = nil
+			}
+		}
+
 		networkReceived <- &NetworkResponse{
 			Index:          segmentInfo.Index,   // 分片索引
 			ReceiverPeerID: sendingToNetwork.ID, // 存储该文件片段的节点ID
+			Receipt:        receipt,             // 存储承诺收据
 		}
 		return nil
 	}
 
-	return fmt.Errorf("目标节点 %s 响应错误码：%d", node.String(), res.Code)
+	return errs.Rejected(node, StreamSendingToNetworkProtocol, res.Code, res.Msg)
 }
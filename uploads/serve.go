@@ -1,6 +1,7 @@
 package uploads
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"encoding/hex"
 	"fmt"
@@ -9,7 +10,10 @@ import (
 
 	"github.com/bpfs/defs/afero"
 	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/expiry"
 	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/qos"
 	"github.com/bpfs/defs/util"
 	"github.com/bpfs/dep2p"
 	"github.com/bpfs/dep2p/pubsub"
@@ -50,20 +54,154 @@ func (manager *UploadManager) NewUpload(
 	path string, // 文件路径
 	ownerPriv *ecdsa.PrivateKey, // 所有者的私钥
 ) (*UploadSuccessInfo, error) {
+	return manager.NewUploadContext(context.Background(), opt, afe, p2p, pubsub, path, ownerPriv)
+}
+
+// NewUploadContext 新上传操作，ctx 结束时上传任务随之取消
+// 上传任务在返回后继续在后台执行，ctx 应覆盖整个上传过程，而不仅是本次调用
+// 参数：
+//   - ctx: context.Context 上传任务的上下文，可设置截止时间或用于取消任务。
+//   - opt: *opts.Options 文件存储选项配置。
+//   - afe: afero.Afero 文件系统接口。
+//   - p2p: *dep2p.DeP2P 网络主机。
+//   - pubsub: *pubsub.DeP2PPubSub 网络订阅。
+//   - path: string 文件路径。
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥。
+//
+// 返回值：
+//   - *UploadSuccessInfo: 文件上传成功后的返回信息。
+//   - error: 如果发生错误，返回错误信息。
+func (manager *UploadManager) NewUploadContext(
+	ctx context.Context, // 上传任务的上下文
+	opt *opts.Options, // 文件存储选项配置
+	afe afero.Afero, // 文件系统接口
+	p2p *dep2p.DeP2P, // 网络主机
+	pubsub *pubsub.DeP2PPubSub, // 网络订阅
+	path string, // 文件路径
+	ownerPriv *ecdsa.PrivateKey, // 所有者的私钥
+) (*UploadSuccessInfo, error) {
+	info, err := manager.upload(ctx, opt, afe, p2p, pubsub, path, ownerPriv, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	// 保存块清单，供之后的新版本增量上传
+	saveFileManifest(opt, afe, info.FileID, path)
+
+	return info, nil
+}
+
+// NewUploadWithExpiry 新上传操作，文件在到期时间后从全网清理
+// 到期时间经文件签名密钥签名后写入每个文件片段，存储节点据此独立清理；本节点在到期时广播到期通知
+// 参数：
+//   - ctx: context.Context 上传任务的上下文，可设置截止时间或用于取消任务。
+//   - opt: *opts.Options 文件存储选项配置。
+//   - afe: afero.Afero 文件系统接口。
+//   - p2p: *dep2p.DeP2P 网络主机。
+//   - pubsub: *pubsub.DeP2PPubSub 网络订阅。
+//   - path: string 文件路径。
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥。
+//   - expiresAt: time.Time 到期时间，必须晚于当前时间。
+//
+// 返回值：
+//   - *UploadSuccessInfo: 文件上传成功后的返回信息。
+//   - error: 如果发生错误，返回错误信息。
+func (manager *UploadManager) NewUploadWithExpiry(
+	ctx context.Context, // 上传任务的上下文
+	opt *opts.Options, // 文件存储选项配置
+	afe afero.Afero, // 文件系统接口
+	p2p *dep2p.DeP2P, // 网络主机
+	pubsub *pubsub.DeP2PPubSub, // 网络订阅
+	path string, // 文件路径
+	ownerPriv *ecdsa.PrivateKey, // 所有者的私钥
+	expiresAt time.Time, // 到期时间
+) (*UploadSuccessInfo, error) {
+	if !expiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: 到期时间必须晚于当前时间", errs.ErrInvalidArgument)
+	}
+	info, err := manager.upload(ctx, opt, afe, p2p, pubsub, path, ownerPriv, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	// 保存块清单，供之后的新版本增量上传
+	saveFileManifest(opt, afe, info.FileID, path)
+
+	return info, nil
+}
+
+// NewUploadWithProfile 新上传操作，使用按名称选择的上传参数组合
+// 参数组合中未设置的字段沿用全局选项；设置了到期时长时，文件在上传后到期时长从全网清理
+// 参数：
+//   - ctx: context.Context 上传任务的上下文，可设置截止时间或用于取消任务。
+//   - opt: *opts.Options 文件存储选项配置。
+//   - afe: afero.Afero 文件系统接口。
+//   - p2p: *dep2p.DeP2P 网络主机。
+//   - pubsub: *pubsub.DeP2PPubSub 网络订阅。
+//   - path: string 文件路径。
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥。
+//   - name: string 上传参数组合的名称，如 "archive" 或 "quick-share"。
+//
+// 返回值：
+//   - *UploadSuccessInfo: 文件上传成功后的返回信息。
+//   - error: 如果发生错误，返回错误信息。
+func (manager *UploadManager) NewUploadWithProfile(
+	ctx context.Context, // 上传任务的上下文
+	opt *opts.Options, // 文件存储选项配置
+	afe afero.Afero, // 文件系统接口
+	p2p *dep2p.DeP2P, // 网络主机
+	pubsub *pubsub.DeP2PPubSub, // 网络订阅
+	path string, // 文件路径
+	ownerPriv *ecdsa.PrivateKey, // 所有者的私钥
+	name string, // 上传参数组合的名称
+) (*UploadSuccessInfo, error) {
+	p, err := opt.GetUploadProfiles().Get(name)
+	if err != nil {
+		return nil, err
+	}
+	derived, err := opt.WithUploadProfile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var expiresAt time.Time
+	if p.TTL > 0 {
+		expiresAt = time.Now().Add(p.TTL)
+	}
+	info, err := manager.upload(ctx, derived, afe, p2p, pubsub, path, ownerPriv, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	// 保存块清单，供之后的新版本增量上传
+	saveFileManifest(derived, afe, info.FileID, path)
+
+	return info, nil
+}
+
+// upload 创建上传任务并注册到管理器
+// expiresAt 为零值时文件永不到期
+func (manager *UploadManager) upload(ctx context.Context, opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, pubsub *pubsub.DeP2PPubSub, path string, ownerPriv *ecdsa.PrivateKey, expiresAt time.Time) (*UploadSuccessInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := opt.CheckWritable("上传文件"); err != nil {
+		return nil, err
+	}
 	path = strings.TrimSpace(path) // 删除了所有前导和尾随空格
 	if path == "" {
-		return nil, fmt.Errorf("文件路径不可为空")
+		return nil, fmt.Errorf("%w: 文件路径不可为空", errs.ErrInvalidArgument)
 	}
 	if ownerPriv == nil {
 		ownerPriv = opt.GetDefaultOwnerPriv() // 获取默认所有者的私钥
 		if ownerPriv == nil {
-			return nil, fmt.Errorf("所有者密钥不可为空")
+			return nil, fmt.Errorf("%w: 所有者密钥不可为空", errs.ErrInvalidArgument)
 		}
 	}
 
 	// 检查是否达到上传允许的最大并发数
 	if manager.IsMaxConcurrencyReached() {
-		return nil, fmt.Errorf("已达到上传允许的最大并发数")
+		return nil, fmt.Errorf("%w: 上传任务", errs.ErrConcurrencyLimit)
 	}
 
 	// 打开一个文件，返回该文件或错误（如果发生）。
@@ -88,6 +226,27 @@ func (manager *UploadManager) NewUpload(
 		return nil, err
 	}
 
+	if !expiresAt.IsZero() {
+		// 使用文件签名密钥签发到期声明，写入文件片段前设置
+		notice, err := expiry.Sign(task.File.Security.PrivateKey, task.File.FileID, expiresAt)
+		if err != nil {
+			logrus.Errorf("[%s]签发到期声明时失败: %v", debug.WhereAmI(), err)
+			task.cancel()
+			return nil, err
+		}
+		task.File.Expiry = notice
+
+		// 记录到期计划，到期时由本节点广播到期通知
+		if err := expiry.Schedule(afe, notice); err != nil {
+			logrus.Errorf("[%s]保存到期计划时失败: %v", debug.WhereAmI(), err)
+			task.cancel()
+			return nil, err
+		}
+	}
+
+	// 调用方的上下文结束时取消任务
+	context.AfterFunc(ctx, task.cancel)
+
 	// 向管理器注册一个新的上传任务
 	go manager.RegisterTask(opt, afe, p2p, pubsub, task)
 
@@ -109,30 +268,98 @@ func (manager *UploadManager) NewUpload(
 
 // PauseUpload 暂停上传操作
 func (manager *UploadManager) PauseUpload(taskID string) error {
+	return manager.PauseUploadContext(context.Background(), taskID)
+}
+
+// PauseUploadContext 暂停上传操作，ctx 已结束时不暂停并返回其错误
+// 参数：
+//   - ctx: context.Context 调用的上下文
+//   - taskID: string 任务唯一标识
+//
+// 返回值：
+//   - error: 如果发生错误，返回错误信息
+func (manager *UploadManager) PauseUploadContext(ctx context.Context, taskID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	task, ok := manager.Tasks[taskID]
 
 	if !ok {
 		// TODO: 失败事件
-		return fmt.Errorf("未找到上传任务: %s", taskID)
+		return fmt.Errorf("%w: 上传任务 %s", errs.ErrTaskNotFound, taskID)
 	}
+
+	// 手动暂停的任务在电源条件恢复后不自动继续
+	manager.Mu.Lock()
+	delete(manager.powerPaused, taskID)
+	manager.Mu.Unlock()
+
 	task.Mu.Lock()
 	defer task.Mu.Unlock()
-	task.Status = StatusPaused
+	task.SetStatusPaused()
+	return nil
+}
+
+// SetUploadQoS 设置上传任务的服务等级
+// 参数：
+//   - taskID: string 任务唯一标识
+//   - class: qos.Class 服务等级
+//
+// 返回值：
+//   - error: 如果发生错误，返回错误信息
+func (manager *UploadManager) SetUploadQoS(taskID string, class qos.Class) error {
+	if !class.Valid() {
+		return fmt.Errorf("%w: 无效的服务等级 %d", errs.ErrInvalidArgument, class)
+	}
+	manager.Mu.Lock()
+	task, ok := manager.Tasks[taskID]
+	manager.Mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: 上传任务 %s", errs.ErrTaskNotFound, taskID)
+	}
+	task.Mu.Lock()
+	task.QoS = class
+	task.Mu.Unlock()
+
+	go manager.SaveTasksToFileSingleChan() // 保存任务至文件
 	return nil
 }
 
-// ClearUpload 清空上传记录
+// ClearUpload 清空上传记录，演练模式下只报告将要清空的记录数量
 func (manager *UploadManager) ClearUpload() error {
+	if manager.opt.GetDryRun() {
+		logrus.Infof("[%s]演练模式: 将清空 %d 条上传记录", debug.WhereAmI(), len(manager.Tasks))
+		return nil
+	}
 	manager.Tasks = make(map[string]*UploadTask)
 	return nil
 }
 
 // CancelUpload 取消上传操作
 func (manager *UploadManager) CancelUpload(taskID string) error {
+	return manager.CancelUploadContext(context.Background(), taskID)
+}
+
+// CancelUploadContext 取消上传操作，ctx 已结束时不取消并返回其错误
+// 演练模式下只报告将要取消的任务，不删除任务
+// 参数：
+//   - ctx: context.Context 调用的上下文
+//   - taskID: string 任务唯一标识
+//
+// 返回值：
+//   - error: 如果发生错误，返回错误信息
+func (manager *UploadManager) CancelUploadContext(ctx context.Context, taskID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	task, ok := manager.Tasks[taskID]
 	if !ok {
 		// TODO: 失败事件
-		return fmt.Errorf("未找到上传任务: %s", taskID)
+		return fmt.Errorf("%w: 上传任务 %s", errs.ErrTaskNotFound, taskID)
+	}
+	if manager.opt.GetDryRun() {
+		logrus.Infof("[%s]演练模式: 将取消上传任务 %s", debug.WhereAmI(), task.TaskID)
+		return nil
 	}
 	delete(manager.Tasks, task.TaskID)
 	return nil
@@ -140,14 +367,29 @@ func (manager *UploadManager) CancelUpload(taskID string) error {
 
 // ContinueUpload 继续上传操作
 func (manager *UploadManager) ContinueUpload(taskID string) error {
+	return manager.ContinueUploadContext(context.Background(), taskID)
+}
+
+// ContinueUploadContext 继续上传操作，ctx 已结束时不继续并返回其错误
+// 继续后的上传在后台执行，不随 ctx 结束而暂停
+// 参数：
+//   - ctx: context.Context 调用的上下文
+//   - taskID: string 任务唯一标识
+//
+// 返回值：
+//   - error: 如果发生错误，返回错误信息
+func (manager *UploadManager) ContinueUploadContext(ctx context.Context, taskID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	task, ok := manager.Tasks[taskID]
 	if !ok {
 		// TODO: 失败事件
-		return fmt.Errorf("未找到上传任务: %s", taskID)
+		return fmt.Errorf("%w: 上传任务 %s", errs.ErrTaskNotFound, taskID)
 	}
 	task.Mu.Lock()
 	defer task.Mu.Unlock()
-	task.Status = StatusUploading
+	task.SetStatusUploading()
 
 	// 准备好本地存储文件片段
 	go task.SegmentReadySingleChan()
@@ -20,8 +20,8 @@ import (
 
 // sliceLocalFileHandle 文件片段存储为本地文件
 func sliceLocalFileHandle(task *UploadTask) error {
-	// 将文件大小转换为 []byte
-	sizeByte, err := util.ToBytes[int64](task.File.Size)
+	// 将参与分片的内容大小转换为 []byte，下载方按该大小拼接数据片段
+	sizeByte, err := util.ToBytes[int64](task.File.StoredSize)
 	if err != nil {
 		logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
 		return err
@@ -51,6 +51,12 @@ func sliceLocalFileHandle(task *UploadTask) error {
 
 	encryptionKey := task.File.Security.EncryptionKey[1]
 
+	// 开启元数据加密时，文件名和MIME类型仅保存在加密的元数据中
+	name, contentType := []byte(task.File.Name), []byte(task.File.ContentType)
+	if len(task.File.Security.Metadata) > 0 {
+		name, contentType = []byte{}, []byte{}
+	}
+
 	// 文件分片信息
 	for index, s := range task.File.Segments {
 		if task.Status == StatusPaused { // 上传任务的当前状态:已暂停，则退出
@@ -88,9 +94,9 @@ func sliceLocalFileHandle(task *UploadTask) error {
 
 		data := map[string][]byte{
 			"FILEID":          []byte(task.File.FileID),       // 写入文件的唯一标识
-			"NAME":            []byte(task.File.Name),         // 写入文件的名称
+			"NAME":            name,                           // 写入文件的名称
 			"SIZE":            sizeByte,                       // 写入文件的长度
-			"CONTENTTYPE":     []byte(task.File.ContentType),  // MIME类型
+			"CONTENTTYPE":     contentType,                    // MIME类型
 			"CHECKSUM":        task.File.Checksum,             // 文件的校验和
 			"UPLOADTIME":      uploadTimeByte,                 // 写入文件的上传时间
 			"P2PKHSCRIPT":     task.File.Security.P2PKHScript, // 写入文件的 P2PKH 脚本
@@ -105,6 +111,32 @@ func sliceLocalFileHandle(task *UploadTask) error {
 			"SHARED":          sharedByte,                     // 写入文件共享状态(私有)
 			"VERSION":         []byte(opts.Version),           // 版本
 		}
+		if len(task.File.Security.Metadata) > 0 {
+			data["METADATA"] = task.File.Security.Metadata // 写入加密的文件元数据
+		}
+		// 压缩算法与压缩前的大小一同签名，下载方据此限制解压后的大小
+		var codecFields [][]byte
+		if task.File.Codec != "" {
+			rawSizeByte, err := util.ToBytes[int64](task.File.Size)
+			if err != nil {
+				logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+				return err
+			}
+			data["CODEC"] = []byte(task.File.Codec) // 写入分片前使用的压缩算法
+			data["RAWSIZE"] = rawSizeByte           // 写入压缩前的文件大小
+			codecFields = [][]byte{data["CODEC"], data["RAWSIZE"]}
+		}
+		if task.File.Expiry != nil {
+			// 写入经过签名的到期时间，存储节点据此独立清理到期的片段
+			fields, err := task.File.Expiry.Fields()
+			if err != nil {
+				logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+				return err
+			}
+			for k, v := range fields {
+				data[k] = v
+			}
+		}
 
 		// 根据给定的私钥和已经是[]byte的数据直接生成签名
 		signature, err := generateSignature(task.File.Security.PrivateKey,
@@ -116,6 +148,7 @@ func sliceLocalFileHandle(task *UploadTask) error {
 			data["INDEX"],           // 文件片段的索引
 			data["SEGMENTCHECKSUM"], // 分片的校验和
 			data["CONTENT"],         // 文件片段的内容(加密)
+			codecFields...,          // 压缩算法与压缩前的大小
 		)
 		if err != nil {
 			logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
@@ -196,15 +229,20 @@ func compressAndEncrypt(pk, data []byte) ([]byte, error) {
 // index,           // 分片索引
 // segmentChecksum, // 分片的校验和
 // encryptedData,	// 文件片段的内容(加密)
+// extra,           // 可选的附加字段，如压缩算法与压缩前的大小
 func generateSignature(privateKey *ecdsa.PrivateKey, fileId []byte,
 	contentType []byte,
 	checksum []byte,
 	sliceTable []byte,
 	index []byte,
 	segmentID []byte,
-	segmentsChecksum []byte, content []byte) ([]byte, error) {
+	segmentsChecksum []byte, content []byte, extra ...[]byte) ([]byte, error) {
 	// 待签名数据
-	merged, err := util.MergeFieldsForSigning(fileId, contentType, checksum, sliceTable, index, segmentID, segmentsChecksum, content)
+	fields := []interface{}{fileId, contentType, checksum, sliceTable, index, segmentID, segmentsChecksum, content}
+	for _, field := range extra {
+		fields = append(fields, field)
+	}
+	merged, err := util.MergeFieldsForSigning(fields...)
 	if err != nil {
 		return nil, fmt.Errorf("合并字段签名失败: %v", err)
 	}
@@ -7,9 +7,14 @@ import (
 	"time"
 
 	"github.com/bpfs/defs/afero"
+	"github.com/bpfs/defs/cluster"
+	"github.com/bpfs/defs/commitment"
 	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/network"
+	"github.com/bpfs/defs/network/datagram"
 	"github.com/bpfs/defs/opts"
 	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/defs/provider"
 	"github.com/bpfs/defs/util"
 
 	"github.com/bpfs/dep2p"
@@ -28,6 +33,12 @@ var (
 
 	// 发送任务到网络
 	StreamSendingToNetworkProtocol = fmt.Sprintf("defs@stream/sending/network/%s", version)
+
+	// 协商数据报传输
+	StreamDatagramNegotiateProtocol = fmt.Sprintf("defs@stream/datagram/negotiate/%s", version)
+
+	// 预留存储空间
+	StreamReserveProtocol = fmt.Sprintf("defs@stream/reserve/%s", version)
 )
 
 // 流协议
@@ -38,17 +49,24 @@ type StreamProtocol struct {
 	P2P    *dep2p.DeP2P        // 网络主机
 	PubSub *pubsub.DeP2PPubSub // 网络订阅
 	Upload *UploadManager      // 管理所有上传任务
+
+	Cluster      *cluster.Cluster   // 集群，节点独立运行时未启用
+	Providers    *provider.Notifier // 文件片段变更通告
+	Datagram     *datagram.Server   // 数据报传输的接收端，未启用时为 nil
+	Reservations *reservations      // 为上传方预留的存储空间
 }
 
 type RegisterStreamProtocolInput struct {
 	fx.In
-	LC     fx.Lifecycle
-	Ctx    context.Context     // 全局上下文
-	Opt    *opts.Options       // 文件存储选项配置
-	Afe    afero.Afero         // 文件系统接口
-	P2P    *dep2p.DeP2P        // 网络主机
-	PubSub *pubsub.DeP2PPubSub // 网络订阅
-	Upload *UploadManager      // 管理所有上传任务
+	LC        fx.Lifecycle
+	Ctx       context.Context     // 全局上下文
+	Opt       *opts.Options       // 文件存储选项配置
+	Afe       afero.Afero         // 文件系统接口
+	P2P       *dep2p.DeP2P        // 网络主机
+	PubSub    *pubsub.DeP2PPubSub // 网络订阅
+	Upload    *UploadManager      // 管理所有上传任务
+	Cluster   *cluster.Cluster    // 集群
+	Providers *provider.Notifier  // 文件片段变更通告
 }
 
 // RegisterUploadStreamProtocol 注册上传流
@@ -56,25 +74,49 @@ func RegisterUploadStreamProtocol(input RegisterStreamProtocolInput) {
 	// 流协议
 
 	usp := &StreamProtocol{
-		Ctx:    input.Ctx,
-		Opt:    input.Opt,
-		Afe:    input.Afe,
-		P2P:    input.P2P,
-		PubSub: input.PubSub,
+		Ctx:     input.Ctx,
+		Opt:     input.Opt,
+		Afe:     input.Afe,
+		P2P:     input.P2P,
+		PubSub:  input.PubSub,
+		Cluster: input.Cluster,
+
+		Reservations: newReservations(),
+		Providers:    input.Providers,
 	}
 
 	input.LC.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
 			// 注册对等距离
-			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamPeerDistanceProtocol), streams.HandlerWithRW(usp.handlePeerDistance))
+			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamPeerDistanceProtocol), network.HandlerWithLimits(StreamPeerDistanceProtocol, network.HandlerWithRW(usp.handlePeerDistance)))
 
 			// 注册发送任务到网络的请求
-			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamSendingToNetworkProtocol), streams.HandlerWithRW(usp.handleSendingToNetwork))
+			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamSendingToNetworkProtocol), network.HandlerWithLimits(StreamSendingToNetworkProtocol, network.HandlerWithRW(usp.handleSendingToNetwork)))
+			network.RegisterReusableHandler(input.P2P.Host(), StreamSendingToNetworkProtocol, usp.handleSendingToNetwork)
+
+			// 启动数据报传输的接收端，失败时仅使用流传输
+			if addr := input.Opt.GetDatagramTransport(); addr != "" {
+				server, err := datagram.Listen(addr, nil)
+				if err != nil {
+					logrus.Errorf("[%s]启动数据报传输失败: %v", debug.WhereAmI(), err)
+				} else {
+					usp.Datagram = server
+				}
+			}
+
+			// 注册预留存储空间的请求
+			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamReserveProtocol), network.HandlerWithLimits(StreamReserveProtocol, network.HandlerWithRW(usp.handleReserve)))
+
+			// 注册数据报传输的协商
+			streams.RegisterStreamHandler(input.P2P.Host(), protocol.ID(StreamDatagramNegotiateProtocol), network.HandlerWithLimits(StreamDatagramNegotiateProtocol, network.HandlerWithRW(usp.handleDatagramNegotiate)))
 
 			return nil
 		},
 		OnStop: func(ctx context.Context) error {
 			// 清理资源等停止逻辑
+			if usp.Datagram != nil {
+				return usp.Datagram.Close()
+			}
 			return nil
 		},
 	})
@@ -151,17 +193,20 @@ type SendingToNetworkReq struct {
 	Index         int    // 分片索引，表示该片段在文件中的顺序
 	IsRsCodes     bool   // 标记该分片是否使用了纠删码技术，用于数据的恢复和冗余
 	SliceByte     []byte // 切片内容
+	CommitUntil   int64  // 要求存储节点承诺保存的截止时间(Unix 秒)，为 0 时不要求承诺
+	DatagramToken []byte // 切片内容已通过数据报传输时的传输令牌，此时 SliceByte 为空
 }
 
 // 发送任务到网络的响应消息
 type SendingToNetworkRes struct {
-	FileID        string  // 文件唯一标识，用于在系统内部唯一区分文件
-	SegmentID     string  // 文件片段的唯一标识
-	TotalSegments int     // 文件总分片数
-	Index         int     // 分片索引，表示该片段在文件中的顺序
-	IsRsCodes     bool    // 标记该分片是否使用了纠删码技术，用于数据的恢复和冗余
-	ID            peer.ID // 节点的ID
-	UploadAt      int64   // 文件片段上传的时间戳
+	FileID        string              // 文件唯一标识，用于在系统内部唯一区分文件
+	SegmentID     string              // 文件片段的唯一标识
+	TotalSegments int                 // 文件总分片数
+	Index         int                 // 分片索引，表示该片段在文件中的顺序
+	IsRsCodes     bool                // 标记该分片是否使用了纠删码技术，用于数据的恢复和冗余
+	ID            peer.ID             // 节点的ID
+	UploadAt      int64               // 文件片段上传的时间戳
+	Receipt       *commitment.Receipt // 存储承诺收据，未要求承诺或节点拒绝承诺时为空
 }
 
 // handleSendingToNetwork 处理发送任务到网络
@@ -172,6 +217,11 @@ func (sp *StreamProtocol) handleSendingToNetwork(req *streams.RequestMessage, re
 		return 6603, "解码错误"
 	}
 
+	// 只读节点不接受其他节点存储的文件片段
+	if sp.Opt.GetReadOnly() {
+		return 6610, "只读节点不接受文件片段"
+	}
+
 	// logrus.Printf("FileID: %s", payload.FileID)
 	// logrus.Printf("SegmentID: %s", payload.SegmentID)
 	// logrus.Printf("TotalSegments: %d", payload.TotalSegments)
@@ -179,13 +229,39 @@ func (sp *StreamProtocol) handleSendingToNetwork(req *streams.RequestMessage, re
 	// logrus.Printf("IsRsCodes: %v", payload.IsRsCodes)
 	// logrus.Printf("SliceByte: %d", len(payload.SliceByte))
 
-	// 设置文件存储的子目录
-	subDir := filepath.Join(paths.GetSlicePath(), sp.P2P.Host().ID().String(), payload.FileID)
+	// 切片内容已通过数据报传输
+	if len(payload.DatagramToken) > 0 {
+		sliceByte, err := sp.takeDatagram(payload.DatagramToken)
+		if err != nil {
+			logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+			return 6608, "数据报传输的数据不存在"
+		}
+		payload.SliceByte = sliceByte
+	}
 
-	// 将文件片段内容写入本地存储
-	if err := util.Write(sp.Opt, sp.Afe, subDir, payload.SegmentID, payload.SliceByte); err != nil {
-		logrus.Error("存储接收内容失败, error:", err)
-		return 500, "存储接收内容失败"
+	if sp.Cluster.Enabled() {
+		// 集群模式下片段由负责的成员存储，本节点代表整个集群响应
+		if _, err := sp.Cluster.Store(sp.Ctx, payload.FileID, payload.SegmentID, payload.SliceByte); err != nil {
+			logrus.Error("存储接收内容失败, error:", err)
+			return 500, "存储接收内容失败"
+		}
+	} else {
+		// 设置文件存储的子目录
+		subDir := filepath.Join(paths.GetSlicePath(), sp.P2P.Host().ID().String(), payload.FileID)
+
+		// 将文件片段内容写入本地存储
+		if err := util.Write(sp.Opt, sp.Afe, subDir, payload.SegmentID, payload.SliceByte); err != nil {
+			logrus.Error("存储接收内容失败, error:", err)
+			return 500, "存储接收内容失败"
+		}
+		sp.Opt.GetCounters().AddStored(int64(len(payload.SliceByte)))
+		// 修复时重新上传的片段可能存放在新的节点上，通告进行中的下载任务
+		sp.Providers.Added(payload.FileID, payload.SegmentID)
+	}
+
+	// 片段已存储，释放上传方的预留
+	if uploader, err := peer.Decode(req.Message.GetSender()); err == nil {
+		sp.Reservations.release(reservationKey{uploader: uploader, segmentID: payload.SegmentID})
 	}
 
 	sendingToNetwork := SendingToNetworkRes{
@@ -198,6 +274,26 @@ func (sp *StreamProtocol) handleSendingToNetwork(req *streams.RequestMessage, re
 		UploadAt:      time.Now().Unix(),     // 文件片段上传的时间戳
 	}
 
+	// 签发存储承诺收据，承诺时长不超过本节点愿意承诺的最长时长
+	if payload.CommitUntil > 0 && sp.Opt.GetMaxCommitment() > 0 {
+		expiresAt := payload.CommitUntil
+		if limit := time.Now().Add(sp.Opt.GetMaxCommitment()).Unix(); expiresAt > limit {
+			expiresAt = limit
+		}
+		// 请求的 Sender 为流连接上经过认证的对方节点，收据只对实际的上传方有效
+		uploader, _ := peer.Decode(req.Message.GetSender())
+		priv := sp.P2P.Host().Peerstore().PrivKey(sp.P2P.Host().ID())
+		receipt, err := commitment.NewReceipt(priv, uploader, payload.FileID, payload.SegmentID, payload.SliceByte, expiresAt)
+		if err != nil {
+			logrus.Errorf("[%s]签发存储承诺收据失败: %v", debug.WhereAmI(), err)
+		} else if err := sp.Opt.GetCommitments().Add(receipt); err != nil {
+			// 无法记录的承诺不能保证在承诺期内不被清理，不签发收据
+			logrus.Errorf("[%s]保存签发的存储承诺收据失败: %v", debug.WhereAmI(), err)
+		} else {
+			sendingToNetwork.Receipt = receipt
+		}
+	}
+
 	// 编码文件片段的哈希表
 	sendingToNetworkBytes, err := util.EncodeToBytes(sendingToNetwork)
 	if err != nil {
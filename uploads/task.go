@@ -11,12 +11,16 @@ import (
 
 	"github.com/bpfs/defs/afero"
 	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/middleware"
 	"github.com/bpfs/defs/opts"
 	"github.com/bpfs/defs/paths"
+	"github.com/bpfs/defs/qos"
 	"github.com/bpfs/defs/shamir"
+	"github.com/bpfs/defs/stats"
+	"github.com/bpfs/defs/supervise"
 	"github.com/bpfs/defs/util"
 	"github.com/bpfs/dep2p"
-	"github.com/bpfs/dep2p/kbucket"
 	"github.com/bpfs/dep2p/pubsub"
 	"github.com/sirupsen/logrus"
 )
@@ -34,6 +38,13 @@ type UploadTask struct {
 	TaskID   string      // 任务唯一标识，用于区分和管理不同的上传任务
 	File     *UploadFile // 待上传的文件信息，包含文件的元数据和分片信息
 	Progress util.BitSet // 上传任务的进度，表示为0到100之间的百分比
+	QoS      qos.Class   // 任务的服务等级，决定任务可以使用的带宽与并发份额
+
+	placement *placement // 各文件片段的存储节点及失败重试状态
+	timeline  timeline   // 任务生命周期的事件记录，用于事后排查
+
+	onProgress func()                // 片段完成后通知保存任务，保存操作由管理器合并
+	supervisor *supervise.Supervisor // 后台任务的崩溃恢复，由管理器注册任务时设置
 
 	SegmentReady    chan struct{}         // 用于通知准备好本地存储文件片段的通道
 	SendToNetwork   chan int              // 用于触发向网络发送已存储文件片段的动作的通道
@@ -54,15 +65,15 @@ func NewUploadTask(ctx context.Context, opt *opts.Options, mu *sync.Mutex, schem
 	}
 
 	if f.Size < opt.GetMinUploadSize() {
-		return nil, fmt.Errorf("文件不可小于最小上传大小 %d", opt.GetMinUploadSize())
+		return nil, fmt.Errorf("%w: 文件不可小于最小上传大小 %d", errs.ErrInvalidArgument, opt.GetMinUploadSize())
 	}
 	if f.Size > opt.GetMaxUploadSize() {
-		return nil, fmt.Errorf("文件不可最大上传大小 %d", opt.GetMaxUploadSize())
+		return nil, fmt.Errorf("%w: 文件不可大于最大上传大小 %d", errs.ErrQuotaExceeded, opt.GetMaxUploadSize())
 	}
 
 	ct, cancel := context.WithCancel(ctx)
 
-	return &UploadTask{
+	task := &UploadTask{
 		ctx:        ct,
 		cancel:     cancel,
 		Mu:         sync.RWMutex{}, // 任务允许的最大并发上传数
@@ -73,11 +84,16 @@ func NewUploadTask(ctx context.Context, opt *opts.Options, mu *sync.Mutex, schem
 		File:     f,                                  // 待上传的文件信息
 		Progress: *util.NewBitSet(len(f.SliceTable)), // 上传任务的进度
 
+		placement: newPlacement(), // 文件片段的分布记录
+
 		SegmentReady:    make(chan struct{}, 1),
 		SendToNetwork:   make(chan int, MaxConcurrency), // 通道缓冲为任务允许的最大并发上传数
 		UploadDone:      make(chan struct{}, 1),
 		NetworkReceived: make(chan *NetworkResponse),
-	}, nil
+	}
+	task.timeline.record(TimelineEvent{Kind: EventCreated, Index: -1, Detail: f.Name})
+
+	return task, nil
 }
 
 // ChannelEvents 通道事件处理
@@ -103,16 +119,24 @@ func (task *UploadTask) ChannelEvents(
 		case index := <-task.SendToNetwork:
 			logrus.Printf("开始将 %d 发送到网络", index)
 			// 发送文件片段到网络
-			go task.SendingSliceToNetwork(afe, p2p, index)
+			task.spawn("send-slice", func() { task.SendingSliceToNetwork(opt, afe, p2p, index) })
 
 		// 网络接收通道，用于接收网络返回的接受方节点地址信息，以及进行下一步的发送操作。
 		case response := <-task.NetworkReceived:
 			// 处理网络接收通道的响应
-			go task.handleNetworkResponse(response, uploadChan)
+			task.spawn("network-response", func() { task.handleNetworkResponse(opt, afe, response, uploadChan) })
 		}
 	}
 }
 
+// spawn 在新的协程中运行任务的一次性操作，panic 时只结束该协程而不影响节点
+// 参数：
+//   - name: string 协程名称
+//   - run: func() 一次性操作
+func (task *UploadTask) spawn(name string, run func()) {
+	task.supervisor.Spawn("uploads", name, run)
+}
+
 // PeriodicSend 定时任务，发送数据到网络
 func (task *UploadTask) PeriodicSend() {
 	ticker := time.NewTicker(1 * time.Second)
@@ -128,7 +152,7 @@ func (task *UploadTask) PeriodicSend() {
 			return
 		case <-ticker.C:
 			// 检查是否需要发送到网络
-			go task.CheckSegmentsStatus()
+			task.spawn("check-segments", task.CheckSegmentsStatus)
 		}
 	}
 }
@@ -156,11 +180,12 @@ func (task *UploadTask) UploadCompleteCount() int {
 
 // SendingSliceToNetwork 发送文件片段到网络。
 // 参数：
+//   - opt: 文件存储选项配置。
 //   - afe: 文件系统接口，用于读取文件片段。
 //   - p2p: P2P网络对象。
 //   - index: 文件片段索引。
 //   - networkReceivedChan: 网络响应通道，用于发送网络响应结果。
-func (task *UploadTask) SendingSliceToNetwork(afe afero.Afero, p2p *dep2p.DeP2P, index int) {
+func (task *UploadTask) SendingSliceToNetwork(opt *opts.Options, afe afero.Afero, p2p *dep2p.DeP2P, index int) {
 	// 获取指定索引的文件片段信息
 	segment, exists := task.File.Segments[index]
 	if !exists {
@@ -184,33 +209,17 @@ func (task *UploadTask) SendingSliceToNetwork(afe afero.Afero, p2p *dep2p.DeP2P,
 	// 设置文件片段的状态为上传中
 	segment.SetStatusUploading()
 
-	for i := 0; ; {
-		// 节点不足
-		if p2p.RoutingTable(2).Size() < 1 {
-			// 延时1秒后退出
-			logrus.Warnf("上传时所需节点不足:%d", p2p.RoutingTable(2).Size())
-			time.Sleep(1 * time.Second)
-			return
-		}
-		receiverPeers := p2p.RoutingTable(2).NearestPeers(kbucket.ConvertKey(segment.SegmentID), i+1)
-		if len(receiverPeers) == i {
-			logrus.Errorf("临近节点资源不足")
-
-			// 设置文件片段的状态为失败
-			segment.SetStatusFailed()
-
+	for {
+		// 按与片段的距离选择下一个满足分布约束的候选节点，跳过已拒绝或超时的节点
+		node, err := task.placement.selectPeer(opt.GetPlacementPolicy(), opt.GetBandwidth(), opt.GetReputation(), p2p, index, segment.SegmentID, func(i int) bool {
+			table, ok := task.File.SliceTable[i]
+			return ok && table.IsRsCodes
+		})
+		if err != nil {
+			task.retryLater(opt, segment, err)
 			return
 		}
 
-		if len(receiverPeers) == 0 {
-			i++
-			continue
-		}
-
-		if i >= len(receiverPeers) {
-			i = 0
-		}
-
 		// 通知准备发送到网络
 		segmentInfo := &FileSegmentInfo{
 			TaskID:        task.TaskID,                                         // 任务ID
@@ -223,22 +232,99 @@ func (task *UploadTask) SendingSliceToNetwork(afe afero.Afero, p2p *dep2p.DeP2P,
 			IsRsCodes:     task.File.SliceTable[index].IsRsCodes,               // 是否使用纠删码
 		}
 
-		node := receiverPeers[i]
+		// 执行片段发送前的中间件
+		sendCtx := &middleware.SegmentSendContext{
+			Ctx:       task.ctx,
+			TaskID:    task.TaskID,
+			FileID:    task.File.FileID,
+			SegmentID: segment.SegmentID,
+			Index:     index,
+			IsRsCodes: segmentInfo.IsRsCodes,
+			Receiver:  node,
+			Data:      sliceByte,
+		}
+		if err := opt.GetMiddleware().RunBeforeSegmentSend(sendCtx); err != nil {
+			logrus.Errorf("[%s]中间件拒绝发送文件片段 %d: %v", debug.WhereAmI(), index, err)
+
+			// 设置文件片段和任务的状态为失败，并停止任务
+			segment.SetStatusFailed()
+			task.SetStatusFailed()
+			task.cancel()
+
+			return
+		}
+
+		// 先请求存储节点预留空间，被拒绝时立即换下一个候选节点
+		if ttl := opt.GetReservationTTL(); ttl > 0 {
+			if err := reserveOnNode(task.ctx, p2p, node, segmentInfo, len(sendCtx.Data), ttl); err != nil {
+				logrus.Warnf("[%s]%v，尝试下一个候选节点", debug.WhereAmI(), err)
+				task.timeline.record(TimelineEvent{Kind: EventPeerRejected, Index: index, Peer: node, Detail: err.Error()})
+				task.placement.fail(index, node)
+				continue
+			}
+		}
+
+		// 按任务的服务等级获取传输槽位和带宽
+		release, err := opt.GetScheduler().Acquire(task.ctx, task.QoS)
+		if err != nil {
+			task.placement.release(index, node)
+			return
+		}
+		if err := opt.GetScheduler().WaitN(task.ctx, task.QoS, len(sendCtx.Data)); err != nil {
+			release()
+			task.placement.release(index, node)
+			return
+		}
+
 		// 向目标节点发送文件片段
-		if err := sendSliceToNode(p2p, segmentInfo, node, sliceByte, task.NetworkReceived); err != nil {
-			i++
+		var commitUntil int64
+		if d := opt.GetCommitmentDuration(); d > 0 {
+			commitUntil = time.Now().Add(d).Unix()
+		}
+		start := time.Now()
+		err = sendSliceToNode(qos.WithClass(task.ctx, task.QoS), p2p, segmentInfo, node, sendCtx.Data, task.NetworkReceived, commitUntil, datagramConfig(opt, node), opt.GetLinkLoss())
+		release()
+		if err != nil {
+			// 节点拒绝或超时，换下一个候选节点重试
+			logrus.Warnf("[%s]节点 %s 未能接收文件片段 %d，尝试下一个候选节点: %v", debug.WhereAmI(), node, index, err)
+			task.timeline.record(TimelineEvent{Kind: EventPeerRejected, Index: index, Peer: node, Detail: err.Error()})
+			task.placement.fail(index, node)
 			continue
 		}
 
+		// 记录发送耗时，供后续选择存储节点与下载选择来源参考
+		opt.GetBandwidth().Record(node, len(sendCtx.Data), time.Since(start))
+		stats.MarkUseful(node, p2p.RoutingTable(2))
+
 		// 设置文件片段的状态为已完成
 		segment.SetStatusCompleted()
+		task.timeline.record(TimelineEvent{Kind: EventSegmentSent, Index: index, Peer: node})
+
+		return
+	}
+}
 
+// retryLater 所有候选节点都失败时，将片段标记为失败并在重试间隔后重新尝试，超过最大重试轮数时任务失败
+// 参数：
+//   - opt: *opts.Options 文件存储选项配置
+//   - segment: *FileSegment 文件片段
+//   - cause: error 失败原因
+func (task *UploadTask) retryLater(opt *opts.Options, segment *FileSegment, cause error) {
+	rounds := task.placement.exhaust(segment.Index, opt.GetRetryInterval())
+	segment.SetStatusFailed()
+	task.timeline.record(TimelineEvent{Kind: EventRetry, Index: segment.Index, Detail: fmt.Sprintf("第 %d 轮: %v", rounds, cause)})
+
+	if int64(rounds) > opt.GetMaxRetries() {
+		logrus.Errorf("[%s]文件片段 %d 重试 %d 轮后仍未上传，任务失败: %v", debug.WhereAmI(), segment.Index, rounds-1, cause)
+		task.SetStatusFailed()
+		task.cancel()
 		return
 	}
+	logrus.Warnf("[%s]文件片段 %d 暂无可用的存储节点，%s 后重试: %v", debug.WhereAmI(), segment.Index, opt.GetRetryInterval(), cause)
 }
 
 // handleNetworkResponse 处理网络接收通道的响应
-func (task *UploadTask) handleNetworkResponse(response *NetworkResponse, uploadChan chan *UploadChan) {
+func (task *UploadTask) handleNetworkResponse(opt *opts.Options, afe afero.Afero, response *NetworkResponse, uploadChan chan *UploadChan) {
 	task.Mu.Lock()
 	defer task.Mu.Unlock()
 
@@ -248,13 +334,55 @@ func (task *UploadTask) handleNetworkResponse(response *NetworkResponse, uploadC
 		return
 	}
 
+	// 保存存储承诺收据
+	if err := opt.GetReceipts().Add(response.Receipt); err != nil {
+		logrus.Errorf("[%s]保存存储承诺收据失败: %v", debug.WhereAmI(), err)
+	}
+
+	// 记录片段最终的存储节点
+	task.placement.confirm(response.Index, response.ReceiverPeerID)
+
 	// 设置任务进度
 	task.Progress.Set(response.Index)
+	if task.onProgress != nil {
+		task.onProgress() // 合并保存进度，崩溃时未保存的片段在启动核对后重新上传
+	}
 	// 检查指定文件的上传是否完成
 	isComplete := task.IsUploadComplete()
 	// 更新任务状态
 	if isComplete {
-		task.SetStatusCompleted() // 设置为已完成
+		// 执行任务完成前的中间件
+		if err := opt.GetMiddleware().RunBeforeTaskComplete(&middleware.TaskCompleteContext{
+			Kind:   middleware.TaskUpload,
+			TaskID: task.TaskID,
+			FileID: task.File.FileID,
+			Name:   task.File.Name,
+			Size:   task.File.Size,
+		}); err != nil {
+			logrus.Errorf("[%s]中间件拒绝完成上传任务 %s: %v", debug.WhereAmI(), task.TaskID, err)
+			task.SetStatusFailed() // 设置为失败
+			task.cancel()
+			isComplete = false
+		} else {
+			task.SetStatusCompleted() // 设置为已完成
+
+			// 保存文件的分布清单
+			completedAt := time.Now().Unix()
+			if err := SavePlacement(afe, &PlacementManifest{
+				FileID:      task.File.FileID,
+				Segments:    task.placement.snapshot(),
+				CompletedAt: completedAt,
+			}); err != nil {
+				logrus.Errorf("[%s]保存文件分布清单时失败: %v", debug.WhereAmI(), err)
+			}
+
+			// 生成并保存签名的完整性报告
+			if report, err := NewIntegrityReport(task, completedAt); err != nil {
+				logrus.Errorf("[%s]生成完整性报告时失败: %v", debug.WhereAmI(), err)
+			} else if err := SaveReport(afe, report); err != nil {
+				logrus.Errorf("[%s]保存完整性报告时失败: %v", debug.WhereAmI(), err)
+			}
+		}
 	} else if task.Status != StatusPaused {
 		task.SetStatusUploading() // 设置为上传中
 	}
@@ -278,9 +406,18 @@ func (task *UploadTask) handleNetworkResponse(response *NetworkResponse, uploadC
 // CheckSegmentsStatus 检查是否有待上传或失败的文件片段
 // 返回值：bool 是否存在待上传或失败的文件片段
 func (task *UploadTask) CheckSegmentsStatus() {
+	// 已暂停的任务不再发送文件片段
+	task.Mu.RLock()
+	paused := task.Status == StatusPaused
+	task.Mu.RUnlock()
+	if paused {
+		return
+	}
+
 	for _, segment := range task.File.Segments {
-		// 上传状态为"待上传"、"失败"的分片，通知发送至网络
-		if segment.Status == SegmentStatusPending || segment.Status == SegmentStatusFailed {
+		// 上传状态为"待上传"的分片，以及已到重试时间的"失败"的分片，通知发送至网络
+		if segment.Status == SegmentStatusPending ||
+			(segment.Status == SegmentStatusFailed && task.placement.ready(segment.Index)) {
 			task.SendToNetworkChan(segment.Index)
 		}
 	}
@@ -324,21 +461,25 @@ func (task *UploadTask) UploadDoneSingleChan() {
 
 // SetStatusPending 设置上传任务的状态为待上传
 func (task *UploadTask) SetStatusPending() {
+	task.recordStatus(task.Status, StatusPending)
 	task.Status = StatusPending
 }
 
 // SetStatusUploading 设置上传任务的状态为上传中
 func (task *UploadTask) SetStatusUploading() {
+	task.recordStatus(task.Status, StatusUploading)
 	task.Status = StatusUploading
 }
 
 // SetStatusPaused 设置上传任务的状态为已暂停
 func (task *UploadTask) SetStatusPaused() {
+	task.recordStatus(task.Status, StatusPaused)
 	task.Status = StatusPaused
 }
 
 // SetStatusCompleted 设置上传任务的状态为已完成
 func (task *UploadTask) SetStatusCompleted() {
+	task.recordStatus(task.Status, StatusCompleted)
 	task.Status = StatusCompleted
 	// 向任务的通知上传完成的通道发送通知
 	task.UploadDoneSingleChan()
@@ -346,5 +487,6 @@ func (task *UploadTask) SetStatusCompleted() {
 
 // SetStatusFailed 设置上传任务的状态为失败
 func (task *UploadTask) SetStatusFailed() {
+	task.recordStatus(task.Status, StatusFailed)
 	task.Status = StatusFailed
 }
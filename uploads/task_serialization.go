@@ -7,8 +7,10 @@ import (
 	"path/filepath"
 
 	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/qos"
 	"github.com/bpfs/defs/util"
 	"github.com/bpfs/defs/wallets"
+	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/sirupsen/logrus"
 )
 
@@ -24,6 +26,9 @@ type UploadTaskSerializable struct {
 	Progress     util.BitSet               `json:"progress"`      // 上传任务的进度
 	Status       UploadStatus              `json:"status"`        // 上传任务的状态
 	FileSecurity *FileSecuritySerializable `json:"file_security"` // 文件安全信息
+	QoS          qos.Class                 `json:"qos"`           // 任务的服务等级
+	Placement    map[int]peer.ID           `json:"placement"`     // 已完成片段的存储节点
+	Timeline     []TimelineEvent           `json:"timeline"`      // 任务生命周期的事件记录
 }
 
 // FileSecuritySerializable 是 FileSecurity 的可序列化版本
@@ -33,6 +38,7 @@ type FileSecuritySerializable struct {
 	PrivateKey    []byte   `json:"private_key"`    // 文件签名密钥的序列化字节
 	P2PKHScript   []byte   `json:"p2pkh_script"`   // P2PKH 脚本
 	P2PKScript    []byte   `json:"p2pk_script"`    // P2PK 脚本
+	Metadata      []byte   `json:"metadata"`       // 加密的文件元数据
 }
 
 // ToSerializable 将 UploadTask 转换为可序列化的结构体
@@ -52,6 +58,7 @@ func (task *UploadTask) ToSerializable() (*UploadTaskSerializable, error) {
 		PrivateKey:    privKeyBytes,
 		P2PKHScript:   task.File.Security.P2PKHScript,
 		P2PKScript:    task.File.Security.P2PKScript,
+		Metadata:      task.File.Security.Metadata,
 	}
 
 	serializable := &UploadTaskSerializable{
@@ -65,6 +72,18 @@ func (task *UploadTask) ToSerializable() (*UploadTaskSerializable, error) {
 		Progress:     task.Progress,
 		Status:       task.Status,
 		FileSecurity: fileSecurity,
+		QoS:          task.QoS,
+		Placement:    make(map[int]peer.ID),
+		Timeline:     task.timeline.snapshot(),
+	}
+
+	// 只保存已完成片段的存储节点，正在发送的预留在恢复后重新选择
+	if task.placement != nil {
+		for index, node := range task.placement.snapshot() {
+			if task.Progress.IsSet(index) {
+				serializable.Placement[index] = node
+			}
+		}
 	}
 
 	return serializable, nil
@@ -105,11 +124,23 @@ func (task *UploadTask) FromSerializable(serializable *UploadTaskSerializable) e
 			PrivateKey:    privateKey,
 			P2PKHScript:   serializable.FileSecurity.P2PKHScript,
 			P2PKScript:    serializable.FileSecurity.P2PKScript,
+			Metadata:      serializable.FileSecurity.Metadata,
 		},
 	}
 
+	// 早期保存的任务没有记录参与分片的内容大小
+	if task.File.StoredSize == 0 {
+		task.File.StoredSize = task.File.Size
+	}
+
 	task.Progress = serializable.Progress
 	task.Status = serializable.Status
+	task.QoS = serializable.QoS
+	task.placement = newPlacement()
+	for index, node := range serializable.Placement {
+		task.placement.confirm(index, node)
+	}
+	task.timeline.restore(serializable.Timeline)
 
 	// 重新初始化通道
 	task.SegmentReady = make(chan struct{}, 1)
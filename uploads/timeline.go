@@ -0,0 +1,121 @@
+package uploads
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/errs"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// TimelineCapacity 每个上传任务保留的事件数量，超出时覆盖最早的事件
+const TimelineCapacity = 256
+
+// TimelineEventKind 上传任务事件的类型
+type TimelineEventKind string
+
+const (
+	EventCreated      TimelineEventKind = "created"       // 任务已创建
+	EventStatus       TimelineEventKind = "status"        // 任务状态变化
+	EventSegmentSent  TimelineEventKind = "segment_sent"  // 文件片段已发送至节点
+	EventPeerRejected TimelineEventKind = "peer_rejected" // 节点拒绝或未能接收文件片段
+	EventRetry        TimelineEventKind = "retry"         // 所有候选节点都失败，文件片段等待重试
+)
+
+// TimelineEvent 上传任务的一条事件
+type TimelineEvent struct {
+	At     int64             `json:"at"`               // 发生时间(Unix 毫秒)
+	Kind   TimelineEventKind `json:"kind"`             // 事件类型
+	Status UploadStatus      `json:"status,omitempty"` // 变化后的任务状态，仅状态变化事件有效
+	Index  int               `json:"index"`            // 文件片段索引，与片段无关的事件为 -1
+	Peer   peer.ID           `json:"peer,omitempty"`   // 相关的节点
+	Detail string            `json:"detail,omitempty"` // 附加说明，如失败原因
+}
+
+// String 返回事件的可读描述
+func (e TimelineEvent) String() string {
+	s := time.UnixMilli(e.At).Format("2006-01-02 15:04:05.000") + " " + string(e.Kind)
+	if e.Status != "" {
+		s += " " + string(e.Status)
+	}
+	if e.Index >= 0 {
+		s += fmt.Sprintf(" 片段 %d", e.Index)
+	}
+	if e.Peer != "" {
+		s += " 节点 " + e.Peer.String()
+	}
+	if e.Detail != "" {
+		s += ": " + e.Detail
+	}
+	return s
+}
+
+// timeline 固定容量的环形事件记录
+type timeline struct {
+	mu     sync.Mutex
+	events []TimelineEvent // 事件缓冲区
+	next   int             // 下一条事件写入的位置
+	full   bool            // 缓冲区是否已写满一轮
+}
+
+// record 记录一条事件
+func (tl *timeline) record(e TimelineEvent) {
+	if e.At == 0 {
+		e.At = time.Now().UnixMilli()
+	}
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	if tl.events == nil {
+		tl.events = make([]TimelineEvent, TimelineCapacity)
+	}
+	tl.events[tl.next] = e
+	tl.next = (tl.next + 1) % len(tl.events)
+	if tl.next == 0 {
+		tl.full = true
+	}
+}
+
+// snapshot 按时间顺序返回全部事件
+func (tl *timeline) snapshot() []TimelineEvent {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	if !tl.full {
+		return append([]TimelineEvent(nil), tl.events[:tl.next]...)
+	}
+	return append(append([]TimelineEvent(nil), tl.events[tl.next:]...), tl.events[:tl.next]...)
+}
+
+// restore 恢复保存的事件，超出容量时只保留最近的事件
+func (tl *timeline) restore(events []TimelineEvent) {
+	if len(events) > TimelineCapacity {
+		events = events[len(events)-TimelineCapacity:]
+	}
+	for _, e := range events {
+		tl.record(e)
+	}
+}
+
+// recordStatus 状态发生变化时记录状态变化事件
+func (task *UploadTask) recordStatus(from, to UploadStatus) {
+	if from != to {
+		task.timeline.record(TimelineEvent{Kind: EventStatus, Status: to, Index: -1})
+	}
+}
+
+// GetTaskTimeline 获取上传任务的事件记录，用于排查长时间运行的任务
+// 参数：
+//   - taskID: string 任务唯一标识
+//
+// 返回值：
+//   - []TimelineEvent: 按时间顺序排列的事件，最多保留 TimelineCapacity 条
+//   - error: 任务不存在时返回包装了 errs.ErrTaskNotFound 的错误
+func (manager *UploadManager) GetTaskTimeline(taskID string) ([]TimelineEvent, error) {
+	manager.Mu.Lock()
+	task, ok := manager.Tasks[taskID]
+	manager.Mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: 上传任务 %s", errs.ErrTaskNotFound, taskID)
+	}
+	return task.timeline.snapshot(), nil
+}
@@ -3,6 +3,7 @@ package uploads
 import (
 	"time"
 
+	"github.com/bpfs/defs/commitment"
 	"github.com/libp2p/go-libp2p/core/peer"
 )
 
@@ -103,6 +104,7 @@ type UploadChan struct {
 
 // NetworkResponse 表示从网络接收到的响应信息
 type NetworkResponse struct {
-	Index          int     // 文件片段索引，表示该片段在文件中的顺序
-	ReceiverPeerID peer.ID // 接收该文件片段的节点ID
+	Index          int                 // 文件片段索引，表示该片段在文件中的顺序
+	ReceiverPeerID peer.ID             // 接收该文件片段的节点ID
+	Receipt        *commitment.Receipt // 存储节点签发的存储承诺收据
 }
@@ -1,5 +1,15 @@
 package util
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bpfs/defs/errs"
+)
+
 // BitSet 实现一个简单的位集合，用于表示多个布尔值的集合。
 // bits 字节切片，用于存储位信息。
 type BitSet struct {
@@ -78,3 +88,141 @@ func (b *BitSet) None() bool {
 	}
 	return true
 }
+
+// DifferenceIndices 返回在 b 中置位但在 other 中未置位的所有位的索引。
+// 该方法按字节计算差集，不会分配中间 BitSet，适合在每个调度周期中计算"待处理 - 进行中 - 已完成"的片段集合。
+// 参数：
+//   - other: *BitSet 要排除的位集合，为 nil 或长度不足时视为全 0。
+//   - buf: []uint 用于复用的结果缓冲区，结果会从 buf[:0] 开始追加。
+//
+// 返回值：
+//   - []uint: 差集中所有位的索引，按升序排列。
+func (b *BitSet) DifferenceIndices(other *BitSet, buf []uint) []uint {
+	buf = buf[:0]
+	for i, word := range b.bits {
+		if other != nil && i < len(other.bits) {
+			word &^= other.bits[i]
+		}
+		for j := 0; word != 0; j++ {
+			if word&1 != 0 {
+				buf = append(buf, uint(i*8+j))
+			}
+			word >>= 1
+		}
+	}
+	return buf
+}
+
+// String 返回位集合的区间表示，便于在调试输出中查看。
+// 返回值：
+//   - string: 与 MarshalText 相同的区间表示。
+func (b BitSet) String() string {
+	text, _ := b.MarshalText()
+	return string(text)
+}
+
+// MarshalText 将位集合编码为紧凑的区间表示，例如 "0-1023,2048,4096-8191/8192"。
+// 逗号分隔置位的索引或闭区间，"/" 之后为位集合的总位数，用于在解码时恢复原有大小。
+// 返回值：
+//   - []byte: 区间表示。
+//   - error: 始终为 nil。
+func (b BitSet) MarshalText() ([]byte, error) {
+	var buf bytes.Buffer
+	size := len(b.bits) * 8
+	for i := 0; i < size; {
+		if !b.IsSet(i) {
+			i++
+			continue
+		}
+		start := i
+		for i < size && b.IsSet(i) {
+			i++
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(strconv.Itoa(start))
+		if i-1 > start {
+			buf.WriteByte('-')
+			buf.WriteString(strconv.Itoa(i - 1))
+		}
+	}
+	buf.WriteByte('/')
+	buf.WriteString(strconv.Itoa(size))
+	return buf.Bytes(), nil
+}
+
+// UnmarshalText 从 MarshalText 生成的区间表示解码位集合。
+// 省略 "/" 及总位数时，位集合的大小取能容纳最大索引的最小值。
+// 参数：
+//   - text: []byte 区间表示。
+//
+// 返回值：
+//   - error: 格式错误或索引超出总位数时返回包装了 errs.ErrInvalidArgument 的错误。
+func (b *BitSet) UnmarshalText(text []byte) error {
+	ranges, sizeText, hasSize := strings.Cut(strings.TrimSpace(string(text)), "/")
+
+	type span struct{ start, end int }
+	var spans []span
+	max := -1
+	if ranges != "" {
+		for _, part := range strings.Split(ranges, ",") {
+			startText, endText, isRange := strings.Cut(part, "-")
+			start, err := strconv.Atoi(strings.TrimSpace(startText))
+			if err != nil || start < 0 {
+				return fmt.Errorf("%w: 位集合区间 %q", errs.ErrInvalidArgument, part)
+			}
+			end := start
+			if isRange {
+				if end, err = strconv.Atoi(strings.TrimSpace(endText)); err != nil || end < start {
+					return fmt.Errorf("%w: 位集合区间 %q", errs.ErrInvalidArgument, part)
+				}
+			}
+			spans = append(spans, span{start, end})
+			if end > max {
+				max = end
+			}
+		}
+	}
+
+	size := max + 1
+	if hasSize {
+		n, err := strconv.Atoi(strings.TrimSpace(sizeText))
+		if err != nil || n < 0 {
+			return fmt.Errorf("%w: 位集合大小 %q", errs.ErrInvalidArgument, sizeText)
+		}
+		if max >= n {
+			return fmt.Errorf("%w: 索引 %d 超出位集合大小 %d", errs.ErrInvalidArgument, max, n)
+		}
+		size = n
+	}
+
+	bits := make([]byte, (size+7)/8)
+	for _, s := range spans {
+		for i := s.start; i <= s.end; i++ {
+			bits[i/8] |= 1 << (i % 8)
+		}
+	}
+	b.bits = bits
+	return nil
+}
+
+// UnmarshalJSON 从 JSON 字符串解码位集合。
+// 早期版本的位集合被编码为空对象 "{}"，此时解码为空的位集合，以兼容已保存的任务文件。
+// 参数：
+//   - data: []byte JSON 数据。
+//
+// 返回值：
+//   - error: 格式错误时返回错误。
+func (b *BitSet) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		var legacy map[string]json.RawMessage
+		if json.Unmarshal(data, &legacy) == nil {
+			b.bits = nil
+			return nil
+		}
+		return err
+	}
+	return b.UnmarshalText([]byte(text))
+}
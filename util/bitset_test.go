@@ -0,0 +1,101 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/bpfs/defs/errs"
+)
+
+func TestDifferenceIndices(t *testing.T) {
+	wanted := NewBitSet(20)
+	for _, i := range []int{0, 3, 7, 8, 12, 19} {
+		wanted.Set(i)
+	}
+	inFlight := NewBitSet(10)
+	inFlight.Set(3)
+	inFlight.Set(8)
+
+	got := wanted.DifferenceIndices(inFlight, nil)
+	want := []uint{0, 7, 12, 19}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("DifferenceIndices = %v, want %v", got, want)
+	}
+
+	// 复用缓冲区并与 nil 求差
+	buf := make([]uint, 0, 8)
+	got = wanted.DifferenceIndices(nil, buf)
+	want = []uint{0, 3, 7, 8, 12, 19}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("DifferenceIndices(nil) = %v, want %v", got, want)
+	}
+	if &got[0] != &buf[:1][0] {
+		t.Fatalf("DifferenceIndices did not reuse buf")
+	}
+}
+
+func TestBitSetText(t *testing.T) {
+	b := NewBitSet(8192)
+	for i := 0; i < 1024; i++ {
+		b.Set(i)
+	}
+	b.Set(2048)
+	for i := 4096; i < 8192; i++ {
+		b.Set(i)
+	}
+
+	text, err := b.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "0-1023,2048,4096-8191/8192"; string(text) != want {
+		t.Fatalf("MarshalText = %q, want %q", text, want)
+	}
+
+	var got BitSet
+	if err := got.UnmarshalText(text); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.bits, b.bits) {
+		t.Fatalf("UnmarshalText 未能还原位集合: %s", got.String())
+	}
+
+	// 省略总位数时按最大索引确定大小
+	if err := got.UnmarshalText([]byte("1,3-4")); err != nil || len(got.bits) != 1 || !got.IsSet(4) || got.IsSet(2) {
+		t.Fatalf("UnmarshalText(\"1,3-4\") = %s, %v", got.String(), err)
+	}
+
+	for _, bad := range []string{"a", "3-1", "-1", "1,,2", "8/4", "1/x"} {
+		if err := got.UnmarshalText([]byte(bad)); !errors.Is(err, errs.ErrInvalidArgument) {
+			t.Fatalf("UnmarshalText(%q) 应返回 ErrInvalidArgument, 实际 %v", bad, err)
+		}
+	}
+}
+
+func TestBitSetJSON(t *testing.T) {
+	type task struct {
+		Progress BitSet `json:"progress"`
+	}
+	in := task{Progress: *NewBitSet(10)}
+	in.Progress.Set(1)
+	in.Progress.Set(2)
+
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"progress":"1-2/16"}`; string(data) != want {
+		t.Fatalf("json.Marshal = %s, want %s", data, want)
+	}
+	var out task
+	if err := json.Unmarshal(data, &out); err != nil || !reflect.DeepEqual(out, in) {
+		t.Fatalf("json.Unmarshal = %+v, %v", out, err)
+	}
+
+	// 兼容早期版本保存的空对象
+	if err := json.Unmarshal([]byte(`{"progress":{}}`), &out); err != nil || out.Progress.Any() {
+		t.Fatalf("json.Unmarshal 旧格式 = %+v, %v", out, err)
+	}
+}
@@ -0,0 +1,73 @@
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// Coalescer 合并频繁的保存请求
+// 累计 maxPending 次变更或距首次未保存的变更超过 interval 时执行一次保存，保存操作之间不会并发
+type Coalescer struct {
+	interval   time.Duration // 未保存的变更最长等待时间
+	maxPending int           // 累计多少次变更时立即保存
+	save       func()        // 保存操作
+
+	mu      sync.Mutex
+	pending int         // 未保存的变更次数
+	timer   *time.Timer // 等待保存的定时器，没有未保存的变更时为 nil
+
+	saveMu sync.Mutex // 保证保存操作依次执行
+}
+
+// NewCoalescer 创建合并保存请求的 Coalescer
+// 参数：
+//   - interval: time.Duration 未保存的变更最长等待时间
+//   - maxPending: int 累计多少次变更时立即保存
+//   - save: func() 保存操作
+//
+// 返回值：
+//   - *Coalescer: 新创建的 Coalescer
+func NewCoalescer(interval time.Duration, maxPending int, save func()) *Coalescer {
+	return &Coalescer{interval: interval, maxPending: maxPending, save: save}
+}
+
+// Mark 记录一次变更，达到数量上限时立即保存，否则在等待时间结束后保存
+func (c *Coalescer) Mark() {
+	c.mu.Lock()
+	c.pending++
+	if c.pending < c.maxPending {
+		if c.timer == nil {
+			c.timer = time.AfterFunc(c.interval, c.Flush)
+		}
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+	c.Flush()
+}
+
+// Pending 获取未保存的变更次数
+func (c *Coalescer) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pending
+}
+
+// Flush 立即保存未保存的变更，没有未保存的变更时不执行保存
+func (c *Coalescer) Flush() {
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+
+	c.mu.Lock()
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	pending := c.pending
+	c.pending = 0
+	c.mu.Unlock()
+
+	if pending > 0 {
+		c.save()
+	}
+}
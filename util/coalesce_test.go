@@ -0,0 +1,44 @@
+package util
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalescer(t *testing.T) {
+	var saves atomic.Int32
+	c := NewCoalescer(time.Hour, 4, func() { saves.Add(1) })
+
+	// 未达到数量上限时不保存
+	for i := 0; i < 3; i++ {
+		c.Mark()
+	}
+	if n := saves.Load(); n != 0 {
+		t.Fatalf("saves = %d, want 0", n)
+	}
+
+	// 达到数量上限时立即保存一次
+	c.Mark()
+	if n := saves.Load(); n != 1 || c.Pending() != 0 {
+		t.Fatalf("saves = %d, pending = %d, want 1, 0", n, c.Pending())
+	}
+
+	// 没有未保存的变更时 Flush 不保存
+	c.Flush()
+	if n := saves.Load(); n != 1 {
+		t.Fatalf("saves = %d, want 1", n)
+	}
+
+	// 等待时间结束后保存
+	c = NewCoalescer(10*time.Millisecond, 100, func() { saves.Add(1) })
+	c.Mark()
+	c.Mark()
+	deadline := time.Now().Add(time.Second)
+	for saves.Load() != 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := saves.Load(); n != 2 {
+		t.Fatalf("saves = %d, want 2", n)
+	}
+}
@@ -10,12 +10,16 @@ import (
 	"github.com/bpfs/defs/afero"
 	"github.com/bpfs/defs/debug"
 	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/paths"
 	"github.com/sirupsen/logrus"
 )
 
 // CreateFile 在指定子目录创建一个新文件
 func CreateFile(opt *opts.Options, afe afero.Afero, subDir, fileName string) error {
-	filePath := filepath.Join(subDir, fileName)
+	filePath, err := paths.SafeJoin(subDir, fileName)
+	if err != nil {
+		return err
+	}
 	file, err := afe.Create(filePath)
 	if err != nil {
 		logrus.Errorf("[%s]无法创建文件: %v", debug.WhereAmI(), err)
@@ -26,17 +30,23 @@ func CreateFile(opt *opts.Options, afe afero.Afero, subDir, fileName string) err
 
 // Write 写入数据到指定的文件
 func Write(opt *opts.Options, afe afero.Afero, subDir, fileName string, data []byte) error {
+	filePath, err := paths.SafeJoin(subDir, fileName)
+	if err != nil {
+		return err
+	}
 	if err := afe.MkdirAll(filepath.Join(subDir), 0755); err != nil {
 		logrus.Errorf("[%s]无法创建子目录: %v", debug.WhereAmI(), err)
 		return err
 	}
-	filePath := filepath.Join(subDir, fileName)
 	return afero.WriteFile(afe, filePath, data, 0644)
 }
 
 // Read 从指定的文件读取数据
 func Read(opt *opts.Options, afe afero.Afero, subDir, fileName string) ([]byte, error) {
-	filePath := filepath.Join(subDir, fileName)
+	filePath, err := paths.SafeJoin(subDir, fileName)
+	if err != nil {
+		return nil, err
+	}
 	exists, err := afero.Exists(afe, filePath)
 	if err != nil {
 		logrus.Errorf("[%s]无法检查文件是否存在: %v", debug.WhereAmI(), err)
@@ -51,7 +61,10 @@ func Read(opt *opts.Options, afe afero.Afero, subDir, fileName string) ([]byte,
 
 // OpenFile 打开指定子目录和文件名的文件
 func OpenFile(opt *opts.Options, afe afero.Afero, subDir, fileName string) (*os.File, error) {
-	filePath := filepath.Join(subDir, fileName)
+	filePath, err := paths.SafeJoin(subDir, fileName)
+	if err != nil {
+		return nil, err
+	}
 	if exists, err := afero.Exists(afe, filePath); !exists {
 		logrus.Errorf("[%s]未找到文件 %s: %v", debug.WhereAmI(), fileName, err)
 		return nil, err
@@ -75,7 +88,10 @@ func OpenFile(opt *opts.Options, afe afero.Afero, subDir, fileName string) (*os.
 
 // Delete 删除指定的文件
 func Delete(opt *opts.Options, afe afero.Afero, subDir, fileName string) error {
-	filePath := filepath.Join(subDir, fileName)
+	filePath, err := paths.SafeJoin(subDir, fileName)
+	if err != nil {
+		return err
+	}
 	return afe.Remove(filePath)
 }
 
@@ -87,7 +103,10 @@ func DeleteAll(opt *opts.Options, afe afero.Afero, subDir string) error {
 
 // Exists 检查指定的文件是否存在
 func Exists(opt *opts.Options, afe afero.Afero, subDir, fileName string) (bool, error) {
-	filePath := filepath.Join(subDir, fileName)
+	filePath, err := paths.SafeJoin(subDir, fileName)
+	if err != nil {
+		return false, err
+	}
 	return afero.Exists(afe, filePath)
 }
 
@@ -155,6 +174,20 @@ func RenameFile(opt *opts.Options, afe afero.Afero, oldSubDir, oldFileName, newS
 	return afe.Rename(oldFilePath, newFilePath)
 }
 
+// WriteFileAtomic 写入数据到指定的文件，写入中断时保留原有内容
+// opts 依赖的包不能引用 util，直接使用 afero.WriteFileAtomic
+// 参数：
+//   - afe: afero.Afero 文件系统接口，本地文件使用 afero.NewOsFs()
+//   - filePath: string 文件路径
+//   - data: []byte 文件内容
+//   - perm: os.FileMode 文件权限
+//
+// 返回值：
+//   - error: 如果发生错误，返回错误信息
+func WriteFileAtomic(afe afero.Afero, filePath string, data []byte, perm os.FileMode) error {
+	return afero.WriteFileAtomic(afe, filePath, data, perm)
+}
+
 // WalkFiles 遍历指定目录下的文件并执行回调函数
 func WalkFiles(opt *opts.Options, afe afero.Afero, subDir string, callback func(filePath string, info os.FileInfo) error) error {
 	dirPath := filepath.Join(subDir)
@@ -0,0 +1,148 @@
+package util
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/bpfs/defs/crypto/gcm"
+	"github.com/bpfs/defs/errs"
+)
+
+// FileMetadata 文件级元数据，开启元数据加密后仅所有者及被授权的身份可以解密
+type FileMetadata struct {
+	Name        string   // 文件名，包括扩展名
+	ContentType string   // MIME类型
+	Labels      []string // 文件标签
+}
+
+// MetadataEnvelope 加密的文件元数据
+// 元数据使用随机生成的密钥加密，该密钥再分别通过所有者与每个授权身份之间的 ECDH 共享密钥加密
+type MetadataEnvelope struct {
+	OwnerKey   []byte            // 所有者的公钥(ECDH 编码)
+	Ciphertext []byte            // 加密后的元数据
+	Grants     map[string][]byte // 授权身份公钥哈希(十六进制)到加密后的元数据密钥的映射
+}
+
+// SealMetadata 加密文件元数据，所有者始终拥有解密权限
+// 参数:
+//   - ownerPriv: *ecdsa.PrivateKey 所有者的私钥
+//   - meta: *FileMetadata 文件元数据
+//   - grantees: ...*ecdsa.PublicKey 被授权解密元数据的身份
+//
+// 返回值:
+//   - []byte: 编码后的加密元数据
+//   - error: 处理过程中发生的任何错误
+func SealMetadata(ownerPriv *ecdsa.PrivateKey, meta *FileMetadata, grantees ...*ecdsa.PublicKey) ([]byte, error) {
+	priv, err := ownerPriv.ECDH()
+	if err != nil {
+		return nil, err
+	}
+
+	// 随机生成元数据密钥
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	plain, err := EncodeToBytes(meta)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := gcm.EncryptData(plain, key)
+	if err != nil {
+		return nil, fmt.Errorf("加密元数据时失败: %v", err)
+	}
+
+	envelope := &MetadataEnvelope{
+		OwnerKey:   priv.PublicKey().Bytes(),
+		Ciphertext: ciphertext,
+		Grants:     make(map[string][]byte),
+	}
+
+	// 所有者与自身协商密钥，其余身份与所有者协商密钥
+	recipients := append([]*ecdsa.PublicKey{&ownerPriv.PublicKey}, grantees...)
+	for _, recipient := range recipients {
+		pub, err := recipient.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		wrapKey, err := metadataWrapKey(priv, pub)
+		if err != nil {
+			return nil, err
+		}
+		wrapped, err := gcm.EncryptData(key, wrapKey)
+		if err != nil {
+			return nil, fmt.Errorf("加密元数据密钥时失败: %v", err)
+		}
+		envelope.Grants[metadataGrantID(pub)] = wrapped
+	}
+
+	return EncodeToBytes(envelope)
+}
+
+// OpenMetadata 使用所有者或被授权身份的私钥解密文件元数据
+// 参数:
+//   - priv: *ecdsa.PrivateKey 所有者或被授权身份的私钥
+//   - sealed: []byte 编码后的加密元数据
+//
+// 返回值:
+//   - *FileMetadata: 文件元数据
+//   - error: 未被授权或解密失败时返回错误
+func OpenMetadata(priv *ecdsa.PrivateKey, sealed []byte) (*FileMetadata, error) {
+	envelope := new(MetadataEnvelope)
+	if err := DecodeFromBytes(sealed, envelope); err != nil {
+		return nil, err
+	}
+
+	self, err := priv.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	wrapped, ok := envelope.Grants[metadataGrantID(self.PublicKey())]
+	if !ok {
+		return nil, fmt.Errorf("%w: 解密元数据", errs.ErrUnauthorized)
+	}
+
+	owner, err := ecdh.P256().NewPublicKey(envelope.OwnerKey)
+	if err != nil {
+		return nil, err
+	}
+	wrapKey, err := metadataWrapKey(self, owner)
+	if err != nil {
+		return nil, err
+	}
+	key, err := gcm.DecryptData(wrapped, wrapKey)
+	if err != nil {
+		return nil, fmt.Errorf("解密元数据密钥时失败: %v", err)
+	}
+
+	plain, err := gcm.DecryptData(envelope.Ciphertext, key)
+	if err != nil {
+		return nil, fmt.Errorf("解密元数据时失败: %v", err)
+	}
+	meta := new(FileMetadata)
+	if err := DecodeFromBytes(plain, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// metadataWrapKey 通过 ECDH 共享密钥派生用于加密元数据密钥的密钥
+func metadataWrapKey(priv *ecdh.PrivateKey, pub *ecdh.PublicKey) ([]byte, error) {
+	shared, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(shared)
+	return sum[:], nil
+}
+
+// metadataGrantID 获取授权身份在 Grants 中的标识
+func metadataGrantID(pub *ecdh.PublicKey) string {
+	sum := sha256.Sum256(pub.Bytes())
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,34 @@
+package util
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+)
+
+func TestSealAndOpenMetadata(t *testing.T) {
+	owner, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	grantee, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	stranger, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	meta := &FileMetadata{Name: "report.pdf", ContentType: "application/pdf"}
+	sealed, err := SealMetadata(owner, meta, &grantee.PublicKey)
+	if err != nil {
+		t.Fatalf("加密元数据失败: %v", err)
+	}
+
+	for _, priv := range []*ecdsa.PrivateKey{owner, grantee} {
+		opened, err := OpenMetadata(priv, sealed)
+		if err != nil {
+			t.Fatalf("解密元数据失败: %v", err)
+		}
+		if opened.Name != meta.Name || opened.ContentType != meta.ContentType {
+			t.Fatalf("元数据不一致: %+v", opened)
+		}
+	}
+
+	if _, err := OpenMetadata(stranger, sealed); err == nil {
+		t.Fatal("未授权的身份不应能解密元数据")
+	}
+}
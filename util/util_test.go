@@ -1,8 +1,11 @@
 package util
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 
+	"github.com/bpfs/defs/afero"
 	"github.com/sirupsen/logrus"
 )
 
@@ -10,3 +13,50 @@ func TestCalculateHash(t *testing.T) {
 	hash := CalculateHash([]byte("1234234"))
 	logrus.Printf("%d", len(hash))
 }
+
+func TestWriteFileAtomic(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	if err := WriteFileAtomic(fs, "data/records.json", []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(fs, "data/records.json", []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := afero.ReadFile(fs, "data/records.json"); string(data) != "v2" {
+		t.Fatalf("content = %q, want v2", data)
+	}
+	if infos, _ := afero.ReadDir(fs, "data"); len(infos) != 1 || infos[0].Mode().Perm() != 0644 {
+		t.Fatalf("data = %v, want only records.json with mode 0644", infos)
+	}
+
+	// 并发写入者各自使用独立的临时文件，最终内容为其中一次完整写入
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := WriteFileAtomic(fs, "data/records.json", []byte(fmt.Sprintf("w%d", i)), 0644); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if data, _ := afero.ReadFile(fs, "data/records.json"); len(data) != 2 || data[0] != 'w' {
+		t.Fatalf("content = %q after concurrent writes", data)
+	}
+	if infos, _ := afero.ReadDir(fs, "data"); len(infos) != 1 {
+		t.Fatalf("temporary files left behind: %v", infos)
+	}
+	if err := WriteFileAtomic(fs, "data/records.json", []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 只读文件系统上写入失败，不留下临时文件
+	ro := afero.NewReadOnlyFs(fs)
+	if err := WriteFileAtomic(ro, "data/records.json", []byte("v3"), 0644); err == nil {
+		t.Fatal("write to read-only fs succeeded")
+	}
+	if data, _ := afero.ReadFile(fs, "data/records.json"); string(data) != "v2" {
+		t.Fatalf("content = %q, want v2", data)
+	}
+}
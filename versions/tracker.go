@@ -0,0 +1,331 @@
+// Package versions 记录网络中节点的软件版本，生成兼容性报告，
+// 并在运行即将停止支持版本的节点比例过高时发出警告，便于协调全网升级。
+// 节点的版本来自 libp2p identify 握手中的 AgentVersion，节点创建主机时应使用 UserAgent() 作为用户代理。
+package versions
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/opts"
+	"github.com/bpfs/defs/supervise"
+	"github.com/bpfs/dep2p"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+)
+
+// agentPrefix 用户代理中 DeFS 版本的前缀
+const agentPrefix = "defs/"
+
+// protocolPrefix DeFS 流协议的前缀
+const protocolPrefix = "defs@"
+
+// UserAgent 返回本节点应在 identify 握手中声明的用户代理，创建主机时通过 libp2p.UserAgent 设置
+func UserAgent() string {
+	return agentPrefix + opts.Version
+}
+
+// ParseAgent 从用户代理中解析 DeFS 的版本
+// 参数：
+//   - agent: string identify 握手中的用户代理，如 "defs/0.0.1" 或 "myapp/1.2 defs/0.0.1"
+//
+// 返回值：
+//   - string: DeFS 的版本
+//   - bool: 是否找到有效的版本
+func ParseAgent(agent string) (string, bool) {
+	for _, field := range strings.Fields(agent) {
+		if v, ok := strings.CutPrefix(field, agentPrefix); ok && opts.ValidVersion(v) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// Status 节点版本的兼容状态
+type Status string
+
+const (
+	StatusCurrent      Status = "current"      // 兼容且不在弃用范围内
+	StatusDeprecated   Status = "deprecated"   // 兼容但即将停止支持
+	StatusIncompatible Status = "incompatible" // 低于兼容的最低版本
+	StatusUnknown      Status = "unknown"      // 未声明 DeFS 版本
+)
+
+// PeerVersion 节点在握手中声明的版本信息
+type PeerVersion struct {
+	Peer      peer.ID  // 节点ID
+	Agent     string   // 用户代理
+	Version   string   // DeFS 版本，未声明时为空
+	Protocols []string // 支持的 DeFS 流协议，按名称排列
+	SeenAt    int64    // 最近一次握手的时间戳
+	Status    Status   // 兼容状态，生成报告时按策略计算
+}
+
+// Report 网络中节点版本的兼容性报告
+type Report struct {
+	Peers              []PeerVersion  // 统计范围内的节点，按节点ID排列
+	Versions           map[string]int // 各版本的节点数量，未声明版本的节点不计入
+	Statuses           map[Status]int // 各兼容状态的节点数量
+	Protocols          map[string]int // 各 DeFS 流协议的支持节点数量
+	DeprecatedFraction float64        // 运行即将停止支持版本的节点占已知版本节点的比例
+	Warning            string         // 比例达到阈值时的警告，为空时未达到
+}
+
+// Warning 运行即将停止支持版本的节点比例达到阈值时发出的警告
+type Warning struct {
+	At       int64   // 发出警告的时间戳
+	Fraction float64 // 运行即将停止支持版本的节点比例
+	Message  string  // 警告内容
+}
+
+// Tracker 记录节点在握手中声明的版本
+type Tracker struct {
+	ctx    context.Context    // 上下文用于管理协程的生命周期
+	cancel context.CancelFunc // 取消函数
+	mu     sync.Mutex         // 用于保护状态的互斥锁
+
+	opt      *opts.Options            // 文件存储选项配置
+	peers    map[peer.ID]*PeerVersion // 节点ID到版本信息的映射
+	warnings chan Warning             // 警告的通知
+}
+
+type NewTrackerInput struct {
+	fx.In
+	LC         fx.Lifecycle
+	Ctx        context.Context       // 全局上下文
+	Opt        *opts.Options         // 文件存储选项配置
+	P2P        *dep2p.DeP2P          // 网络主机
+	Supervisor *supervise.Supervisor // 后台任务的崩溃恢复
+}
+
+type NewTrackerOutput struct {
+	fx.Out
+	Versions *Tracker // 节点版本记录
+}
+
+// NewTracker 创建并初始化一个新的 Tracker 实例。
+// 始终记录节点的版本；设置了版本检查策略时定期检查版本分布并发出警告。
+// 参数：
+//   - input: NewTrackerInput 用于初始化 Tracker 的输入结构体。
+//
+// 返回值：
+//   - NewTrackerOutput: 包含 Tracker 的输出结构体。
+func NewTracker(input NewTrackerInput) (out NewTrackerOutput) {
+	t := New(input.Ctx, input.Opt)
+	out.Versions = t
+
+	input.LC.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			h := input.P2P.Host()
+			sub, err := h.EventBus().Subscribe(new(event.EvtPeerIdentificationCompleted))
+			if err != nil {
+				logrus.Errorf("[%s]: %v", debug.WhereAmI(), err)
+				return err
+			}
+			// 记录启动前已完成握手的节点
+			for _, p := range h.Network().Peers() {
+				t.observeHost(h, p)
+			}
+			input.Supervisor.Go("versions", "watch", func() { t.watch(h, sub) })
+
+			if policy := t.opt.GetVersionPolicy(); policy != nil {
+				input.Supervisor.Go("versions", "periodic-check", func() { t.periodicCheck(policy.Interval) })
+			}
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			t.cancel()
+			return nil
+		},
+	})
+
+	return out
+}
+
+// New 创建节点版本记录
+// 参数：
+//   - ctx: context.Context 上下文
+//   - opt: *opts.Options 文件存储选项配置
+//
+// 返回值：
+//   - *Tracker: 节点版本记录
+func New(ctx context.Context, opt *opts.Options) *Tracker {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Tracker{
+		ctx:      ctx,
+		cancel:   cancel,
+		opt:      opt,
+		peers:    make(map[peer.ID]*PeerVersion),
+		warnings: make(chan Warning, 16),
+	}
+}
+
+// watch 处理节点握手完成的事件，直到记录停止
+func (t *Tracker) watch(h host.Host, sub event.Subscription) {
+	defer sub.Close()
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case e, ok := <-sub.Out():
+			if !ok {
+				return
+			}
+			if evt, ok := e.(event.EvtPeerIdentificationCompleted); ok {
+				t.observeHost(h, evt.Peer)
+			}
+		}
+	}
+}
+
+// observeHost 从节点存储中读取节点在握手中声明的用户代理与支持的协议
+func (t *Tracker) observeHost(h host.Host, p peer.ID) {
+	var agent string
+	if v, err := h.Peerstore().Get(p, "AgentVersion"); err == nil {
+		agent, _ = v.(string)
+	}
+	var protocols []string
+	if ids, err := h.Peerstore().GetProtocols(p); err == nil {
+		for _, id := range ids {
+			protocols = append(protocols, string(id))
+		}
+	}
+	t.Observe(p, agent, protocols, time.Now())
+}
+
+// Observe 记录节点在握手中声明的版本信息
+// 参数：
+//   - p: peer.ID 节点ID
+//   - agent: string 用户代理
+//   - protocols: []string 节点支持的协议，只记录 DeFS 流协议
+//   - now: time.Time 握手的时间
+func (t *Tracker) Observe(p peer.ID, agent string, protocols []string, now time.Time) {
+	pv := &PeerVersion{Peer: p, Agent: agent, SeenAt: now.Unix()}
+	pv.Version, _ = ParseAgent(agent)
+	for _, id := range protocols {
+		if strings.HasPrefix(id, protocolPrefix) {
+			pv.Protocols = append(pv.Protocols, id)
+		}
+	}
+	sort.Strings(pv.Protocols)
+
+	t.mu.Lock()
+	t.peers[p] = pv
+	t.mu.Unlock()
+}
+
+// Report 生成最近见过的节点的兼容性报告，并清除超出统计范围的节点
+// 参数：
+//   - now: time.Time 当前时间
+//
+// 返回值：
+//   - *Report: 兼容性报告
+func (t *Tracker) Report(now time.Time) *Report {
+	policy := t.opt.GetVersionPolicy()
+	report := &Report{
+		Versions:  make(map[string]int),
+		Statuses:  make(map[Status]int),
+		Protocols: make(map[string]int),
+	}
+
+	t.mu.Lock()
+	for p, pv := range t.peers {
+		if policy != nil && now.Sub(time.Unix(pv.SeenAt, 0)) > policy.Window {
+			delete(t.peers, p)
+			continue
+		}
+		entry := *pv
+		entry.Protocols = append([]string(nil), pv.Protocols...)
+		entry.Status = classify(policy, entry.Version)
+		report.Peers = append(report.Peers, entry)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(report.Peers, func(i, j int) bool { return report.Peers[i].Peer < report.Peers[j].Peer })
+	known := 0
+	for _, pv := range report.Peers {
+		report.Statuses[pv.Status]++
+		if pv.Version != "" {
+			report.Versions[pv.Version]++
+			known++
+		}
+		for _, id := range pv.Protocols {
+			report.Protocols[id]++
+		}
+	}
+	if known > 0 {
+		report.DeprecatedFraction = float64(report.Statuses[StatusDeprecated]) / float64(known)
+	}
+	if policy != nil && policy.DeprecateBelow != "" && report.Statuses[StatusDeprecated] > 0 && report.DeprecatedFraction >= policy.WarnFraction {
+		report.Warning = fmt.Sprintf("%d 个节点(占已知版本节点的 %.0f%%)运行低于 %s 的版本，这些版本即将停止支持",
+			report.Statuses[StatusDeprecated], report.DeprecatedFraction*100, policy.DeprecateBelow)
+	}
+	return report
+}
+
+// classify 按策略计算版本的兼容状态
+func classify(policy *opts.VersionPolicy, version string) Status {
+	switch {
+	case version == "":
+		return StatusUnknown
+	case policy == nil:
+		return StatusCurrent
+	case policy.MinVersion != "" && opts.CompareVersions(version, policy.MinVersion) < 0:
+		return StatusIncompatible
+	case policy.DeprecateBelow != "" && opts.CompareVersions(version, policy.DeprecateBelow) < 0:
+		return StatusDeprecated
+	default:
+		return StatusCurrent
+	}
+}
+
+// Check 检查节点的版本分布，运行即将停止支持版本的节点比例达到阈值时发出警告
+// 参数：
+//   - now: time.Time 当前时间
+//
+// 返回值：
+//   - *Report: 兼容性报告
+func (t *Tracker) Check(now time.Time) *Report {
+	report := t.Report(now)
+	if n := report.Statuses[StatusIncompatible]; n > 0 {
+		logrus.Warnf("[%s]%d 个节点运行不兼容的版本", debug.WhereAmI(), n)
+	}
+	if report.Warning == "" {
+		return report
+	}
+
+	logrus.Warnf("[%s]%s", debug.WhereAmI(), report.Warning)
+	select {
+	case t.warnings <- Warning{At: now.Unix(), Fraction: report.DeprecatedFraction, Message: report.Warning}:
+	default:
+		// 无人接收时丢弃，不阻塞检查
+	}
+	return report
+}
+
+// Warnings 获取弃用版本警告的通知通道
+func (t *Tracker) Warnings() <-chan Warning {
+	return t.warnings
+}
+
+// periodicCheck 定期检查节点的版本分布，直到记录停止
+func (t *Tracker) periodicCheck(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case now := <-ticker.C:
+			t.Check(now)
+		}
+	}
+}
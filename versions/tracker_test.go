@@ -0,0 +1,84 @@
+package versions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bpfs/defs/opts"
+	"github.com/libp2p/go-libp2p/core/test"
+)
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"0.0.1", "0.0.1", 0},
+		{"v1.2", "1.2.0", 0},
+		{"1.2.0", "1.10.0", -1},
+		{"1.0.0-rc1", "1.0.0", -1},
+		{"2.0.0", "1.9.9", 1},
+		{"bad", "0.0.1", -1},
+	}
+	for _, c := range cases {
+		if got := opts.CompareVersions(c.a, c.b); got != c.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+
+	for agent, want := range map[string]string{"defs/0.0.1": "0.0.1", "myapp/1.2 defs/1.3.0": "1.3.0", "go-libp2p": "", "defs/x": ""} {
+		if got, _ := ParseAgent(agent); got != want {
+			t.Errorf("ParseAgent(%q) = %q, want %q", agent, got, want)
+		}
+	}
+}
+
+func TestTracker(t *testing.T) {
+	opt := opts.DefaultOptions()
+	policy := opts.DefaultVersionPolicy()
+	policy.MinVersion, policy.DeprecateBelow, policy.WarnFraction = "0.2.0", "0.3.0", 0.4
+	if err := opt.BuildVersionPolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+	if err := opt.BuildVersionPolicy(&opts.VersionPolicy{MinVersion: "1.0", DeprecateBelow: "0.9", WarnFraction: 1, Window: time.Hour, Interval: time.Minute}); err == nil {
+		t.Fatal("弃用版本低于最低版本时应被拒绝")
+	}
+
+	tracker := New(context.Background(), opt)
+	now := time.Now()
+	agents := []string{"defs/0.1.0", "defs/0.2.5", "defs/0.2.9", "defs/0.3.0", "go-libp2p"}
+	for _, agent := range agents {
+		tracker.Observe(test.RandPeerIDFatal(t), agent, []string{"defs@stream/index/search/", "/ipfs/id/1.0.0"}, now)
+	}
+	// 超出统计范围的节点不计入
+	tracker.Observe(test.RandPeerIDFatal(t), "defs/0.2.0", nil, now.Add(-25*time.Hour))
+
+	report := tracker.Check(now)
+	want := map[Status]int{StatusIncompatible: 1, StatusDeprecated: 2, StatusCurrent: 1, StatusUnknown: 1}
+	for status, n := range want {
+		if report.Statuses[status] != n {
+			t.Fatalf("Statuses = %v, want %v", report.Statuses, want)
+		}
+	}
+	if len(report.Peers) != 5 || report.Protocols["defs@stream/index/search/"] != 5 || len(report.Protocols) != 1 {
+		t.Fatalf("报告的节点或协议不符: %d %v", len(report.Peers), report.Protocols)
+	}
+	if report.DeprecatedFraction != 0.5 || report.Warning == "" {
+		t.Fatalf("应发出弃用警告: %v %q", report.DeprecatedFraction, report.Warning)
+	}
+	select {
+	case w := <-tracker.Warnings():
+		if w.Fraction != 0.5 {
+			t.Fatalf("Fraction = %v", w.Fraction)
+		}
+	default:
+		t.Fatal("应通知弃用警告")
+	}
+
+	// 比例低于阈值时不警告
+	policy.WarnFraction = 0.6
+	if report := tracker.Check(now); report.Warning != "" {
+		t.Fatalf("比例低于阈值时不应警告: %q", report.Warning)
+	}
+}
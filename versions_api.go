@@ -0,0 +1,19 @@
+package defs
+
+import (
+	"time"
+
+	"github.com/bpfs/defs/versions"
+)
+
+// PeerVersions 获取最近见过的节点的软件版本兼容性报告
+// 返回值：
+//   - *versions.Report: 各版本与兼容状态的节点数量、各协议的支持情况，以及弃用版本的警告
+func (fs *FS) PeerVersions() *versions.Report {
+	return fs.versions.Report(time.Now())
+}
+
+// VersionWarnings 获取运行即将停止支持版本的节点比例达到阈值时的警告通知通道
+func (fs *FS) VersionWarnings() <-chan versions.Warning {
+	return fs.versions.Warnings()
+}
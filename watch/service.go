@@ -0,0 +1,375 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/errs"
+	"github.com/bpfs/defs/supervise"
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+)
+
+// Service 监视已注册的文件夹，文件新建或修改后等待一段时间不再变化时交给处理函数
+type Service struct {
+	ctx    context.Context    // 上下文用于管理协程的生命周期
+	cancel context.CancelFunc // 取消函数
+	mu     sync.Mutex         // 用于保护状态的互斥锁
+
+	supervisor *supervise.Supervisor // 后台任务的崩溃恢复
+
+	watcher *fsnotify.Watcher      // 文件系统通知，第一次注册文件夹时创建
+	folders map[string]*watched    // 已注册的文件夹，键为文件夹路径
+	pending map[string]*time.Timer // 等待上传的文件，键为文件路径
+}
+
+// watched 已注册的文件夹
+type watched struct {
+	folder  *Folder
+	handler Handler
+}
+
+type NewServiceInput struct {
+	fx.In
+	LC         fx.Lifecycle
+	Ctx        context.Context       // 全局上下文
+	Supervisor *supervise.Supervisor // 后台任务的崩溃恢复
+}
+
+type NewServiceOutput struct {
+	fx.Out
+	Watch *Service // 文件夹监视
+}
+
+// NewService 创建并初始化一个新的文件夹监视服务
+// 参数：
+//   - input: NewServiceInput 用于初始化 Service 的输入结构体。
+//
+// 返回值：
+//   - NewServiceOutput: 包含 Service 的输出结构体。
+func NewService(input NewServiceInput) (out NewServiceOutput) {
+	s := newService(input.Ctx)
+	s.supervisor = input.Supervisor
+	out.Watch = s
+
+	input.LC.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			return s.Close()
+		},
+	})
+	return out
+}
+
+// newService 创建文件夹监视服务
+func newService(ctx context.Context) *Service {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Service{
+		ctx:     ctx,
+		cancel:  cancel,
+		folders: make(map[string]*watched),
+		pending: make(map[string]*time.Timer),
+	}
+}
+
+// Add 注册自动上传的文件夹
+// 只处理注册之后新建或修改的文件，已存在的文件不会被上传
+// 参数：
+//   - folder: *Folder 自动上传的文件夹，路径会被转换为绝对路径
+//   - handler: Handler 处理需要上传的文件
+//
+// 返回值：
+//   - error: 文件夹配置无效或已注册时返回包装了 errs.ErrInvalidArgument 的错误
+func (s *Service) Add(folder *Folder, handler Handler) error {
+	if handler == nil {
+		return fmt.Errorf("%w: 处理函数为空", errs.ErrInvalidArgument)
+	}
+	f := *folder
+	if err := f.validate(); err != nil {
+		return err
+	}
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%w: %s 不是文件夹", errs.ErrInvalidArgument, f.Path)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	if _, ok := s.folders[f.Path]; ok {
+		return fmt.Errorf("%w: 文件夹 %s 已注册", errs.ErrInvalidArgument, f.Path)
+	}
+	if s.watcher == nil {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return err
+		}
+		s.watcher = watcher
+		s.supervisor.Go("watch", "loop", func() { s.loop(watcher) })
+	}
+
+	s.folders[f.Path] = &watched{folder: &f, handler: handler}
+	if err := s.addDirLocked(f.Path, f.Recursive); err != nil {
+		delete(s.folders, f.Path)
+		s.removeDirLocked(f.Path)
+		return err
+	}
+	return nil
+}
+
+// Remove 取消注册文件夹，尚未交给处理函数的文件不再上传
+// 参数：
+//   - path: string 文件夹路径
+//
+// 返回值：
+//   - error: 文件夹未注册时返回包装了 errs.ErrNotFound 的错误
+func (s *Service) Remove(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.folders[path]; !ok {
+		return fmt.Errorf("%w: 文件夹 %s", errs.ErrNotFound, path)
+	}
+	delete(s.folders, path)
+	s.removeDirLocked(path)
+
+	for file, timer := range s.pending {
+		if s.folderOfLocked(file) == nil {
+			timer.Stop()
+			delete(s.pending, file)
+		}
+	}
+	return nil
+}
+
+// Folders 获取已注册的文件夹
+// 返回值：
+//   - []*Folder: 按路径排列的文件夹
+func (s *Service) Folders() []*Folder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	folders := make([]*Folder, 0, len(s.folders))
+	for _, w := range s.folders {
+		f := *w.folder
+		folders = append(folders, &f)
+	}
+	sort.Slice(folders, func(i, j int) bool { return folders[i].Path < folders[j].Path })
+	return folders
+}
+
+// Close 停止监视所有文件夹
+// 返回值：
+//   - error: 关闭文件系统通知时的错误
+func (s *Service) Close() error {
+	s.cancel()
+
+	s.mu.Lock()
+	for file, timer := range s.pending {
+		timer.Stop()
+		delete(s.pending, file)
+	}
+	s.folders = make(map[string]*watched)
+	watcher := s.watcher
+	s.watcher = nil
+	s.mu.Unlock()
+
+	// 在锁外关闭，关闭过程中等待通知协程取走剩余的通知
+	if watcher == nil {
+		return nil
+	}
+	return watcher.Close()
+}
+
+// loop 处理文件系统通知
+func (s *Service) loop(watcher *fsnotify.Watcher) {
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			s.handleEvent(event)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			logrus.Warnf("[%s]文件夹监视出错: %v", debug.WhereAmI(), err)
+		}
+	}
+}
+
+// handleEvent 处理一个文件系统通知
+func (s *Service) handleEvent(event fsnotify.Event) {
+	path := filepath.Clean(event.Name)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ctx.Err() != nil {
+		return
+	}
+
+	// 文件被删除或移走时不再上传
+	if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		if timer, ok := s.pending[path]; ok {
+			timer.Stop()
+			delete(s.pending, path)
+		}
+		return
+	}
+	if event.Op&(fsnotify.Create|fsnotify.Write) == 0 {
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	if info.IsDir() {
+		// 监视新建的子文件夹，并处理监视开始前已写入其中的文件
+		if event.Op&fsnotify.Create != 0 {
+			if w := s.folderOfLocked(path); w != nil && w.folder.Recursive {
+				if err := s.addDirLocked(path, true); err != nil {
+					logrus.Warnf("[%s]监视文件夹 %s 失败: %v", debug.WhereAmI(), path, err)
+				}
+				s.scheduleDirLocked(path)
+			}
+		}
+		return
+	}
+	s.scheduleLocked(path)
+}
+
+// scheduleLocked 文件变化后重新计时，文件夹不需要上传该文件时忽略
+func (s *Service) scheduleLocked(path string) {
+	w := s.folderOfLocked(path)
+	if w == nil || !w.folder.Match(path) {
+		return
+	}
+	if timer, ok := s.pending[path]; ok {
+		timer.Reset(w.folder.debounce())
+		return
+	}
+	s.pending[path] = time.AfterFunc(w.folder.debounce(), func() { s.fire(path) })
+}
+
+// scheduleDirLocked 将文件夹中已有的文件加入等待上传
+func (s *Service) scheduleDirLocked(dir string) {
+	_ = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() {
+			s.scheduleLocked(path)
+		}
+		return nil
+	})
+}
+
+// fire 等待时间结束，文件在等待期间没有变化时交给处理函数
+func (s *Service) fire(path string) {
+	s.mu.Lock()
+	if _, ok := s.pending[path]; !ok {
+		s.mu.Unlock()
+		return
+	}
+	w := s.folderOfLocked(path)
+	if w == nil {
+		delete(s.pending, path)
+		s.mu.Unlock()
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		delete(s.pending, path)
+		s.mu.Unlock()
+		return
+	}
+	// 部分平台的写入不会产生通知，修改时间仍在等待时间内时继续等待
+	if wait := w.folder.debounce() - time.Since(info.ModTime()); wait > 0 {
+		s.pending[path].Reset(wait)
+		s.mu.Unlock()
+		return
+	}
+	delete(s.pending, path)
+	folder := *w.folder
+	handler := w.handler
+	s.mu.Unlock()
+
+	handler(&Event{
+		Folder: &folder,
+		Path:   path,
+		Size:   info.Size(),
+		ModAt:  info.ModTime(),
+	})
+}
+
+// folderOfLocked 获取文件所属的文件夹，嵌套注册时取路径最长的文件夹
+func (s *Service) folderOfLocked(path string) *watched {
+	var found *watched
+	for root, w := range s.folders {
+		if path != root && !strings.HasPrefix(path, root+string(filepath.Separator)) {
+			continue
+		}
+		if found == nil || len(root) > len(found.folder.Path) {
+			found = w
+		}
+	}
+	return found
+}
+
+// addDirLocked 监视文件夹，recursive 为 true 时同时监视所有子文件夹
+func (s *Service) addDirLocked(dir string, recursive bool) error {
+	if !recursive {
+		return s.watcher.Add(dir)
+	}
+	return filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		return s.watcher.Add(path)
+	})
+}
+
+// removeDirLocked 停止监视文件夹及其子文件夹中不再属于任何已注册文件夹的部分
+func (s *Service) removeDirLocked(dir string) {
+	if s.watcher == nil {
+		return
+	}
+	_ = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if w := s.folderOfLocked(path); w != nil && (w.folder.Path == path || w.folder.Recursive) {
+			return nil
+		}
+		_ = s.watcher.Remove(path)
+		return nil
+	})
+}
@@ -0,0 +1,104 @@
+// Package watch 监视本地文件夹，将新建或修改的文件自动加入上传队列
+package watch
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bpfs/defs/errs"
+)
+
+// DefaultDebounce 文件最后一次变化后等待的默认时间，等待期间再次变化会重新计时
+const DefaultDebounce = 2 * time.Second
+
+// Folder 自动上传的文件夹
+type Folder struct {
+	Path      string        // 文件夹路径
+	Recursive bool          // 是否监视子文件夹
+	Include   []string      // 需要上传的文件的匹配模式，为空时上传所有文件
+	Exclude   []string      // 不上传的文件的匹配模式，优先于 Include
+	Debounce  time.Duration // 文件最后一次变化后等待的时间，为 0 时使用 DefaultDebounce
+	Bucket    string        // 上传文件归属的存储桶
+	Labels    []string      // 上传文件的标签
+}
+
+// Event 文件夹中需要上传的文件
+type Event struct {
+	Folder *Folder   // 文件所在的自动上传文件夹
+	Path   string    // 文件路径
+	Size   int64     // 文件大小，单位为字节
+	ModAt  time.Time // 文件的修改时间
+}
+
+// Handler 处理需要上传的文件
+type Handler func(event *Event)
+
+// validate 检查文件夹配置并规范化路径
+func (f *Folder) validate() error {
+	if f.Path == "" {
+		return fmt.Errorf("%w: 文件夹路径为空", errs.ErrInvalidArgument)
+	}
+	if f.Debounce < 0 {
+		return fmt.Errorf("%w: 等待时间不能为负数", errs.ErrInvalidArgument)
+	}
+	for _, pattern := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%w: 匹配模式 %q: %v", errs.ErrInvalidArgument, pattern, err)
+		}
+	}
+
+	path, err := filepath.Abs(f.Path)
+	if err != nil {
+		return err
+	}
+	f.Path = path
+	return nil
+}
+
+// debounce 获取文件最后一次变化后等待的时间
+func (f *Folder) debounce() time.Duration {
+	if f.Debounce == 0 {
+		return DefaultDebounce
+	}
+	return f.Debounce
+}
+
+// Match 检查文件是否需要上传
+// 不含路径分隔符的模式匹配文件名，含路径分隔符的模式匹配相对于文件夹的路径，分隔符统一为 "/"
+// 参数：
+//   - path: string 文件路径
+//
+// 返回值：
+//   - bool: 文件是否需要上传
+func (f *Folder) Match(path string) bool {
+	rel, err := filepath.Rel(f.Path, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	if !f.Recursive && strings.Contains(rel, "/") {
+		return false
+	}
+
+	if matchAny(f.Exclude, rel) {
+		return false
+	}
+	return len(f.Include) == 0 || matchAny(f.Include, rel)
+}
+
+// matchAny 检查相对路径是否匹配任意一个模式
+func matchAny(patterns []string, rel string) bool {
+	name := rel[strings.LastIndex(rel, "/")+1:]
+	for _, pattern := range patterns {
+		target := name
+		if strings.Contains(pattern, "/") {
+			target = rel
+		}
+		if ok, _ := filepath.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
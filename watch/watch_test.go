@@ -0,0 +1,122 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFolderMatch(t *testing.T) {
+	root := t.TempDir()
+	f := &Folder{
+		Path:      root,
+		Recursive: true,
+		Include:   []string{"*.jpg", "docs/*.md"},
+		Exclude:   []string{".*", "*.tmp.jpg"},
+	}
+	if err := f.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]bool{
+		"a.jpg":         true,
+		"sub/b.jpg":     true,
+		".hidden.jpg":   false,
+		"c.tmp.jpg":     false,
+		"notes.md":      false,
+		"docs/notes.md": true,
+		"a.png":         false,
+	}
+	for rel, want := range cases {
+		if got := f.Match(filepath.Join(root, rel)); got != want {
+			t.Errorf("%s: 期望 %v, 实际 %v", rel, want, got)
+		}
+	}
+
+	f.Recursive = false
+	if f.Match(filepath.Join(root, "sub", "b.jpg")) {
+		t.Error("不监视子文件夹时不应匹配子文件夹中的文件")
+	}
+	if f.Match(filepath.Join(filepath.Dir(root), "a.jpg")) {
+		t.Error("不应匹配文件夹之外的文件")
+	}
+}
+
+func TestServiceDebounce(t *testing.T) {
+	root := t.TempDir()
+	s := newService(context.Background())
+	defer s.Close()
+
+	events := make(chan *Event, 8)
+	folder := &Folder{
+		Path:      root,
+		Recursive: true,
+		Exclude:   []string{"*.part"},
+		Debounce:  200 * time.Millisecond,
+		Bucket:    "photos",
+		Labels:    []string{"camera"},
+	}
+	if err := s.Add(folder, func(e *Event) { events <- e }); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(folder, func(e *Event) {}); err == nil {
+		t.Fatal("重复注册文件夹应返回错误")
+	}
+
+	// 连续写入同一文件只触发一次
+	path := filepath.Join(root, "a.txt")
+	for i := 0; i < 5; i++ {
+		if err := os.WriteFile(path, []byte("data"+string(rune('0'+i))), 0644); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(30 * time.Millisecond)
+	}
+	if err := os.WriteFile(filepath.Join(root, "b.part"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 新建子文件夹中的文件同样会被上传
+	sub := filepath.Join(root, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sub, "c.txt"), []byte("c"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]*Event)
+	timeout := time.After(5 * time.Second)
+	for len(got) < 2 {
+		select {
+		case e := <-events:
+			if _, ok := got[e.Path]; ok {
+				t.Fatalf("%s 被重复触发", e.Path)
+			}
+			got[e.Path] = e
+		case <-timeout:
+			t.Fatalf("等待文件变化超时, 已收到 %d 个", len(got))
+		}
+	}
+	e, ok := got[path]
+	if !ok || e.Size != 5 || e.Folder.Bucket != "photos" || len(e.Folder.Labels) != 1 {
+		t.Fatalf("a.txt 的事件不正确: %+v", e)
+	}
+	if _, ok := got[filepath.Join(sub, "c.txt")]; !ok {
+		t.Fatal("未收到子文件夹中的文件")
+	}
+
+	select {
+	case e := <-events:
+		t.Fatalf("收到多余的事件: %s", e.Path)
+	case <-time.After(400 * time.Millisecond):
+	}
+
+	if err := s.Remove(root); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Folders()) != 0 {
+		t.Fatal("取消注册后不应有文件夹")
+	}
+}
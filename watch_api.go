@@ -0,0 +1,53 @@
+package defs
+
+import (
+	"crypto/ecdsa"
+
+	"github.com/bpfs/defs/debug"
+	"github.com/bpfs/defs/uploads"
+	"github.com/bpfs/defs/watch"
+	"github.com/sirupsen/logrus"
+)
+
+// WatchUploadFunc 自动上传完成后的回调，可根据文件夹的存储桶与标签发布文件元数据
+type WatchUploadFunc func(event *watch.Event, info *uploads.UploadSuccessInfo, err error)
+
+// WatchFolder 注册自动上传的文件夹，文件夹中新建或修改的文件在不再变化后自动上传
+// 参数：
+//   - folder: *watch.Folder 自动上传的文件夹，包括匹配模式、等待时间、存储桶与标签
+//   - ownerPriv: *ecdsa.PrivateKey 上传文件所有者的私钥
+//   - onUpload: WatchUploadFunc 每个文件创建上传任务后的回调，可以为 nil
+//
+// 返回值：
+//   - error: 只读模式下返回包装了 errs.ErrReadOnly 的错误，文件夹配置无效时返回包装了 errs.ErrInvalidArgument 的错误
+func (fs *FS) WatchFolder(folder *watch.Folder, ownerPriv *ecdsa.PrivateKey, onUpload WatchUploadFunc) error {
+	if err := fs.opt.CheckWritable("自动上传文件夹"); err != nil {
+		return err
+	}
+	return fs.watch.Add(folder, func(event *watch.Event) {
+		info, err := fs.upload.NewUploadContext(fs.ctx, fs.opt, fs.afe, fs.p2p, fs.pub, event.Path, ownerPriv)
+		if err != nil {
+			logrus.Errorf("[%s]自动上传文件 %s 失败: %v", debug.WhereAmI(), event.Path, err)
+		}
+		if onUpload != nil {
+			onUpload(event, info, err)
+		}
+	})
+}
+
+// UnwatchFolder 取消注册自动上传的文件夹，已创建的上传任务不受影响
+// 参数：
+//   - path: string 文件夹路径
+//
+// 返回值：
+//   - error: 文件夹未注册时返回包装了 errs.ErrNotFound 的错误
+func (fs *FS) UnwatchFolder(path string) error {
+	return fs.watch.Remove(path)
+}
+
+// WatchedFolders 获取已注册的自动上传文件夹
+// 返回值：
+//   - []*watch.Folder: 按路径排列的文件夹
+func (fs *FS) WatchedFolders() []*watch.Folder {
+	return fs.watch.Folders()
+}